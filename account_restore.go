@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/importer"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+const (
+	// how big an account archive can be, it has everything someone ever read
+	maxRestoreSize = 200 << 20
+
+	// read posts are marked read this many at a time
+	restoreReadsBatch = 500
+)
+
+// settingsRestoreHandler restores an account archive (see
+// exportArchiveHandler) into the account of whoever is logged in, a fresh
+// one or not, on this instance or another. The archive is read as it's
+// uploaded, like it was written. What's restored is added to what the account
+// has: preferences are replaced, subscriptions and stars added, and the posts
+// read marked read, for the ones mire has.
+func (s *Site) settingsRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsRestoreHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRestoreSize)
+	file, _, err := r.FormFile("archive")
+	if err != nil {
+		s.renderErr("settingsRestoreHandler", w, fmt.Sprintf("could not read the archive: %s", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	username := s.username(r)
+	var result importResult
+	err = s.restoreArchive(json.NewDecoder(file), username, &result)
+	if err != nil {
+		var restoreErr archiveError
+		if errors.As(err, &restoreErr) {
+			s.renderErr("settingsRestoreHandler", w, err.Error(), http.StatusBadRequest)
+		} else {
+			// or a subscription quota, or mire failing
+			s.renderQuotaErr("settingsRestoreHandler", w, err)
+		}
+		return
+	}
+
+	s.renderPage(w, r, "import", result)
+}
+
+// archiveError is an archive that can't be restored, as opposed to mire
+// failing to restore it
+type archiveError struct {
+	err error
+}
+
+func (e archiveError) Error() string {
+	return fmt.Sprintf("could not restore this archive: %s", e.err)
+}
+
+// restoreArchive goes through an archive one item at a time, the whole of it
+// would be as big as the upload
+func (s *Site) restoreArchive(decoder *json.Decoder, username string, result *importResult) error {
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return archiveError{fmt.Errorf("expected an object")}
+	}
+
+	var reads []sqlite.RestoredRead
+	restoreReads := func() error {
+		restored, err := s.db.RestoreReads(username, reads)
+		result.Read += restored
+		result.ReadNotFound += len(reads) - restored
+		reads = reads[:0]
+		return err
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return archiveError{err}
+		}
+		key, _ := token.(string)
+
+		switch key {
+		case "preferences":
+			var values map[string]string
+			if err := decoder.Decode(&values); err != nil {
+				return archiveError{err}
+			}
+			if err := s.restorePreferences(username, values); err != nil {
+				return err
+			}
+			result.Preferences = true
+
+		case "subscriptions":
+			var subscriptions []archiveSubscription
+			err := decodeArchiveList(decoder, func() error {
+				var subscription archiveSubscription
+				if err := decoder.Decode(&subscription); err != nil {
+					return err
+				}
+				subscriptions = append(subscriptions, subscription)
+				return nil
+			})
+			if err != nil {
+				return archiveError{err}
+			}
+			if err := s.restoreSubscriptions(username, subscriptions, result); err != nil {
+				return err
+			}
+
+		case "stars":
+			var stars []archiveStar
+			err := decodeArchiveList(decoder, func() error {
+				var star archiveStar
+				if err := decoder.Decode(&star); err != nil {
+					return err
+				}
+				stars = append(stars, star)
+				return nil
+			})
+			if err != nil {
+				return archiveError{err}
+			}
+			if err := s.restoreStars(username, stars, result); err != nil {
+				return err
+			}
+
+		case "read":
+			var restoreErr error
+			err := decodeArchiveList(decoder, func() error {
+				var read archiveRead
+				if err := decoder.Decode(&read); err != nil {
+					return err
+				}
+				readAt, _ := time.Parse(time.RFC3339, read.ReadAt)
+				reads = append(reads, sqlite.RestoredRead{URL: read.URL, ReadAt: readAt})
+				if len(reads) == restoreReadsBatch {
+					restoreErr = restoreReads()
+				}
+				return restoreErr
+			})
+			if restoreErr != nil {
+				return restoreErr
+			}
+			if err != nil {
+				return archiveError{err}
+			}
+			if err := restoreReads(); err != nil {
+				return err
+			}
+
+		default:
+			// the username, when it was exported, and whatever newer
+			// versions of mire add
+			var skipped json.RawMessage
+			if err := decoder.Decode(&skipped); err != nil {
+				return archiveError{err}
+			}
+		}
+	}
+
+	return nil
+}
+
+// decodeArchiveList calls decodeItem for every item of the list the decoder
+// is at
+func decodeArchiveList(decoder *json.Decoder, decodeItem func() error) error {
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return fmt.Errorf("expected a list")
+	}
+	for decoder.More() {
+		if err := decodeItem(); err != nil {
+			return err
+		}
+	}
+	_, err := decoder.Token()
+	return err
+}
+
+func (s *Site) restorePreferences(username string, values map[string]string) error {
+	userId := s.db.GetUserID(username)
+	preferences := user_preferences.GetUserPreferences(s.db, userId)
+	if err := user_preferences.SetFromMap(preferences, values); err != nil {
+		return archiveError{err}
+	}
+	if err := validatePreferences(preferences); err != nil {
+		return archiveError{err}
+	}
+	user_preferences.SaveUserPreferences(s.db, userId, preferences)
+	return nil
+}
+
+func (s *Site) restoreSubscriptions(username string, subscriptions []archiveSubscription, result *importResult) error {
+	if len(subscriptions) > maxImportedFeeds {
+		return archiveError{fmt.Errorf("at most %d feeds can be restored", maxImportedFeeds)}
+	}
+	current := s.db.GetUserFeedURLs(username)
+
+	var feedURLs []string
+	var restored []archiveSubscription
+	for _, subscription := range subscriptions {
+		feedURL := strings.TrimSpace(subscription.URL)
+		if !s.reaper.HasFeed(feedURL) {
+			resolved, err := s.resolveBatchFeedURL(feedURL)
+			if err != nil {
+				result.Invalid = append(result.Invalid, subscription.URL)
+				continue
+			}
+			feedURL = resolved
+		}
+		if slices.Contains(feedURLs, feedURL) {
+			continue
+		}
+		feedURLs = append(feedURLs, feedURL)
+		subscription.URL = feedURL
+		restored = append(restored, subscription)
+
+		if slices.Contains(current, feedURL) {
+			result.AlreadySubscribed++
+		} else {
+			result.Subscribed++
+		}
+	}
+
+	if err := s.subscribeToFeeds(username, feedURLs); err != nil {
+		return err
+	}
+
+	for _, subscription := range restored {
+		if subscription.Favorite {
+			if err := s.db.SetFeedFavoriteStatus(username, subscription.URL, true); err != nil {
+				return err
+			}
+		}
+		if subscription.Notify {
+			if err := s.db.SetFeedNotify(username, subscription.URL, true); err != nil {
+				return err
+			}
+		}
+		if note := strings.TrimSpace(subscription.Note); note != "" {
+			if len([]rune(note)) > maxSubscriptionNoteLength {
+				note = string([]rune(note)[:maxSubscriptionNoteLength])
+			}
+			if err := s.db.SetSubscriptionNote(username, subscription.URL, note); err != nil {
+				return err
+			}
+		}
+		if title := strings.TrimSpace(subscription.CustomTitle); title != "" {
+			if len([]rune(title)) > maxSubscriptionTitleLength {
+				title = string([]rune(title)[:maxSubscriptionTitleLength])
+			}
+			if err := s.db.SetSubscriptionTitle(username, subscription.URL, title); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Site) restoreStars(username string, stars []archiveStar, result *importResult) error {
+	for _, star := range stars {
+		post, err := s.db.GetPostByURL(star.URL)
+		if err != nil {
+			return err
+		}
+		if post == nil {
+			result.StarsNotFound = append(result.StarsNotFound, importer.Item{URL: star.URL, Title: star.Title, FeedURL: star.FeedURL})
+			continue
+		}
+
+		if len([]rune(star.Quote)) > maxStarQuoteLength {
+			star.Quote = string([]rune(star.Quote)[:maxStarQuoteLength])
+		}
+		if len([]rune(star.Note)) > maxStarNoteLength {
+			star.Note = string([]rune(star.Note)[:maxStarNoteLength])
+		}
+
+		starredAt, err := time.Parse(time.RFC3339, star.StarredAt)
+		if err != nil {
+			starredAt = time.Now()
+		}
+		restored, err := s.db.RestoreStar(username, post, star.Quote, star.Note, starredAt)
+		if err != nil {
+			return err
+		}
+		if restored {
+			result.Starred++
+		} else {
+			result.AlreadyStarred++
+		}
+	}
+	return nil
+}
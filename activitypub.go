@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/activitypub"
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+const numRecommendationsInOutbox = 20
+
+// instanceHost is the host fediverse handles live on, eg. the "mire.meadow.cafe"
+// in "@alice@mire.meadow.cafe"
+func instanceHost() string {
+	u, err := url.Parse(constants.BASE_URL)
+	if err != nil {
+		log.Fatalf("instanceHost: invalid base url '%s': %s", constants.BASE_URL, err)
+	}
+	return u.Host
+}
+
+func fediverseHandle(username string) string {
+	return "@" + username + "@" + instanceHost()
+}
+
+func actorID(username string) string {
+	return constants.BASE_URL + "/ap/u/" + url.PathEscape(username)
+}
+
+func recommendationNoteID(username string, postId int) string {
+	return fmt.Sprintf("%s/recommendations/%d", actorID(username), postId)
+}
+
+// publishesToFediverse reports whether a user opted into being followable
+// from the fediverse
+func (s *Site) publishesToFediverse(username string) bool {
+	if !s.db.UserExists(username) {
+		return false
+	}
+	return user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username)).PublishRecommendationsToFediverse
+}
+
+// activityPubKeys returns the key pair a user signs their activities with,
+// generating it the first time it's needed
+func (s *Site) activityPubKeys(username string) (privateKey string, publicKey string, err error) {
+	privateKey, publicKey, err = s.db.GetActivityPubKeys(username)
+	if err != nil || privateKey != "" {
+		return privateKey, publicKey, err
+	}
+
+	privateKey, publicKey, err = activitypub.GenerateKeyPair()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = s.db.SaveActivityPubKeys(username, privateKey, publicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	// read them back in case another request generated them at the same time
+	return s.db.GetActivityPubKeys(username)
+}
+
+func recommendationNote(username string, post *sqlite.RecommendedPost) *activitypub.Note {
+	link := constants.BASE_URL + shareURL(post.ID)
+	content := fmt.Sprintf(`<p>recommended <a href="%s">%s</a></p><p><a href="%s">%s</a></p>`,
+		html.EscapeString(post.URL), html.EscapeString(post.Title),
+		html.EscapeString(link), html.EscapeString(link))
+
+	return &activitypub.Note{
+		ID:           recommendationNoteID(username, post.ID),
+		Type:         "Note",
+		AttributedTo: actorID(username),
+		Content:      content,
+		URL:          link,
+		Published:    post.RecommendedAt,
+		To:           []string{activitypub.Public},
+		Cc:           []string{actorID(username) + "/followers"},
+	}
+}
+
+func renderActivityJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", activitypub.ContentType)
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Println("renderActivityJSON:: " + err.Error())
+	}
+}
+
+// webfingerHandler resolves "acct:alice@host" into alice's actor, which is how
+// fediverse servers find out who to follow
+func (s *Site) webfingerHandler(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+
+	var username string
+	if acct, ok := strings.CutPrefix(resource, "acct:"); ok {
+		user, host, _ := strings.Cut(strings.TrimPrefix(acct, "@"), "@")
+		if !strings.EqualFold(host, instanceHost()) {
+			http.NotFound(w, r)
+			return
+		}
+		username = user
+	} else if user, ok := strings.CutPrefix(resource, constants.BASE_URL+"/ap/u/"); ok {
+		username = user
+	}
+
+	if username == "" || !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/jrd+json")
+	err := json.NewEncoder(w).Encode(map[string]any{
+		"subject": "acct:" + username + "@" + instanceHost(),
+		"aliases": []string{actorID(username), constants.BASE_URL + "/u/" + username},
+		"links": []map[string]string{
+			{"rel": "self", "type": activitypub.ContentType, "href": actorID(username)},
+			{"rel": "http://webfinger.net/rel/profile-page", "type": "text/html", "href": constants.BASE_URL + "/u/" + username},
+		},
+	})
+	if err != nil {
+		log.Println("webfingerHandler:: " + err.Error())
+	}
+}
+
+func (s *Site) activityPubActorHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	_, publicKey, err := s.activityPubKeys(username)
+	if err != nil {
+		s.renderErr("activityPubActorHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	card, err := s.getProfileCard(username)
+	if err != nil {
+		s.renderErr("activityPubActorHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	actor := activitypub.NewActor(actorID(username), username, constants.BASE_URL+"/u/"+username, publicKey)
+	actor.Summary = html.EscapeString(card.Profile.Bio)
+	if card.AvatarURL != "" {
+		avatar := card.AvatarURL
+		if strings.HasPrefix(avatar, "/") {
+			avatar = constants.BASE_URL + avatar
+		}
+		actor.Icon = &activitypub.Image{Type: "Image", URL: avatar}
+	}
+
+	renderActivityJSON(w, actor)
+}
+
+// activityPubOutboxHandler lists a user's latest recommendations, some servers
+// use it to backfill the profile of people they just followed
+func (s *Site) activityPubOutboxHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	posts, err := s.db.GetUserRecommendedPosts(username, numRecommendationsInOutbox)
+	if err != nil {
+		s.renderErr("activityPubOutboxHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]any, 0, len(posts))
+	for _, post := range posts {
+		items = append(items, activitypub.NewCreate(recommendationNote(username, post)))
+	}
+
+	renderActivityJSON(w, activitypub.NewOrderedCollection(actorID(username)+"/outbox", len(items), items))
+}
+
+// activityPubFollowersHandler only tells how many followers a user has, who
+// they are is nobody else's business
+func (s *Site) activityPubFollowersHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	count, err := s.db.CountActivityPubFollowers(username)
+	if err != nil {
+		s.renderErr("activityPubFollowersHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	renderActivityJSON(w, activitypub.NewOrderedCollection(actorID(username)+"/followers", count, nil))
+}
+
+func (s *Site) activityPubNoteHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetUserRecommendedPost(username, postId)
+	if err != nil {
+		s.renderErr("activityPubNoteHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	note := recommendationNote(username, post)
+	note.Context = "https://www.w3.org/ns/activitystreams"
+	renderActivityJSON(w, note)
+}
+
+// activityPubInboxHandler handles what other servers send to a user. Only
+// follows (and unfollows) are of interest, everything else is dropped.
+func (s *Site) activityPubInboxHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.publishesToFediverse(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	privateKey, _, err := s.activityPubKeys(username)
+	if err != nil {
+		s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	body, err := activitypub.ReadBody(r)
+	if err != nil {
+		s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	actor, err := activitypub.VerifyRequest(r, body, func(keyID string) (*activitypub.Actor, error) {
+		return activitypub.FetchActor(activitypub.ActorIDFromKeyID(keyID), activitypub.KeyID(actorID(username)), privateKey)
+	})
+	if err != nil {
+		s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var activity activitypub.Activity
+	err = json.Unmarshal(body, &activity)
+	if err != nil {
+		s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if activity.Actor != actor.ID {
+		s.renderErr("activityPubInboxHandler", w, "activity wasn't signed by its actor", http.StatusUnauthorized)
+		return
+	}
+
+	switch activity.Type {
+	case "Follow":
+		if activity.ObjectID() != actorID(username) {
+			break
+		}
+
+		err = s.db.AddActivityPubFollower(username, actor.ID, actor.DeliveryInbox())
+		if err != nil {
+			s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		go s.deliverActivity(username, actor.Inbox, activitypub.NewAccept(actorID(username), &activity))
+	case "Undo":
+		undone := activity.ObjectActivity()
+		if undone == nil || undone.Type != "Follow" {
+			break
+		}
+
+		err = s.db.RemoveActivityPubFollower(username, actor.ID)
+		if err != nil {
+			s.renderErr("activityPubInboxHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deliverActivity sends an activity to a single inbox. Failures are only
+// logged, the fediverse is used to servers coming and going.
+func (s *Site) deliverActivity(username string, inbox string, activity *activitypub.Activity) {
+	privateKey, _, err := s.activityPubKeys(username)
+	if err == nil {
+		err = activitypub.Deliver(inbox, activity, activitypub.KeyID(actorID(username)), privateKey)
+	}
+	if err != nil {
+		log.Printf("[err] deliverActivity: could not deliver '%s' for '%s' to '%s': %s\n", activity.Type, username, inbox, err)
+	}
+}
+
+// federateRecommendation lets a user's fediverse followers know about a post
+// they just recommended (or stopped recommending). Deliveries happen in the
+// background.
+func (s *Site) federateRecommendation(username string, postId int, recommended bool) {
+	if !s.publishesToFediverse(username) {
+		return
+	}
+
+	inboxes, err := s.db.GetActivityPubFollowerInboxes(username)
+	if err != nil {
+		log.Printf("[err] federateRecommendation: could not get the followers of '%s': %s\n", username, err)
+		return
+	}
+	if len(inboxes) == 0 {
+		return
+	}
+
+	var activity *activitypub.Activity
+	if recommended {
+		post, err := s.db.GetUserRecommendedPost(username, postId)
+		if err != nil || post == nil {
+			log.Printf("[err] federateRecommendation: could not get post '%d' recommended by '%s': %v\n", postId, username, err)
+			return
+		}
+		activity = activitypub.NewCreate(recommendationNote(username, post))
+	} else {
+		activity = activitypub.NewDelete(actorID(username), recommendationNoteID(username, postId))
+	}
+
+	go func() {
+		for _, inbox := range inboxes {
+			s.deliverActivity(username, inbox, activity)
+		}
+	}()
+}
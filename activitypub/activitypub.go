@@ -0,0 +1,286 @@
+// Package activitypub holds the bits of the ActivityPub protocol mire needs to
+// publish what its users recommend: the JSON documents and signing (and
+// verifying) requests with HTTP signatures.
+package activitypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// ContentType is the media type of ActivityPub documents
+const ContentType = "application/activity+json"
+
+const (
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	securityContext        = "https://w3id.org/security/v1"
+
+	// Public is the special collection that makes an activity public
+	Public = "https://www.w3.org/ns/activitystreams#Public"
+)
+
+// max size of a document fetched from (or sent by) another server
+const maxDocumentSize = 1 << 20
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+type PublicKey struct {
+	ID           string `json:"id"`
+	Owner        string `json:"owner"`
+	PublicKeyPem string `json:"publicKeyPem"`
+}
+
+type Image struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type Actor struct {
+	Context           any        `json:"@context,omitempty"`
+	ID                string     `json:"id"`
+	Type              string     `json:"type"`
+	PreferredUsername string     `json:"preferredUsername"`
+	Name              string     `json:"name,omitempty"`
+	Summary           string     `json:"summary,omitempty"`
+	URL               string     `json:"url,omitempty"`
+	Inbox             string     `json:"inbox"`
+	Outbox            string     `json:"outbox,omitempty"`
+	Followers         string     `json:"followers,omitempty"`
+	Icon              *Image     `json:"icon,omitempty"`
+	PublicKey         *PublicKey `json:"publicKey,omitempty"`
+	Endpoints         *struct {
+		SharedInbox string `json:"sharedInbox,omitempty"`
+	} `json:"endpoints,omitempty"`
+}
+
+// DeliveryInbox returns the inbox activities for this actor should be sent
+// to, preferring the shared inbox of their server.
+func (a *Actor) DeliveryInbox() string {
+	if a.Endpoints != nil && a.Endpoints.SharedInbox != "" {
+		return a.Endpoints.SharedInbox
+	}
+	return a.Inbox
+}
+
+type Note struct {
+	Context      any       `json:"@context,omitempty"`
+	ID           string    `json:"id"`
+	Type         string    `json:"type"`
+	AttributedTo string    `json:"attributedTo"`
+	Content      string    `json:"content"`
+	URL          string    `json:"url,omitempty"`
+	Published    time.Time `json:"published"`
+	To           []string  `json:"to,omitempty"`
+	Cc           []string  `json:"cc,omitempty"`
+}
+
+// Activity is any activity, Object is left raw since it can either be an id
+// or a whole embedded object.
+type Activity struct {
+	Context   any             `json:"@context,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Type      string          `json:"type"`
+	Actor     string          `json:"actor"`
+	Object    json.RawMessage `json:"object"`
+	Published *time.Time      `json:"published,omitempty"`
+	To        []string        `json:"to,omitempty"`
+	Cc        []string        `json:"cc,omitempty"`
+}
+
+// ObjectID returns the id of the activity's object, whether it was sent as
+// a plain id or embedded.
+func (a *Activity) ObjectID() string {
+	var id string
+	if json.Unmarshal(a.Object, &id) == nil {
+		return id
+	}
+
+	var object struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal(a.Object, &object) == nil {
+		return object.ID
+	}
+	return ""
+}
+
+// ObjectActivity decodes the activity's object as an activity itself, used
+// to find out what an Undo undoes. Returns nil if the object isn't embedded.
+func (a *Activity) ObjectActivity() *Activity {
+	var object Activity
+	if json.Unmarshal(a.Object, &object) != nil || object.Type == "" {
+		return nil
+	}
+	return &object
+}
+
+type OrderedCollection struct {
+	Context      any    `json:"@context,omitempty"`
+	ID           string `json:"id"`
+	Type         string `json:"type"`
+	TotalItems   int    `json:"totalItems"`
+	OrderedItems []any  `json:"orderedItems,omitempty"`
+}
+
+// NewActor returns an actor document for a user, ready to be served
+func NewActor(id string, username string, profileURL string, publicKeyPem string) *Actor {
+	return &Actor{
+		Context:           []string{activityStreamsContext, securityContext},
+		ID:                id,
+		Type:              "Person",
+		PreferredUsername: username,
+		Name:              username,
+		URL:               profileURL,
+		Inbox:             id + "/inbox",
+		Outbox:            id + "/outbox",
+		Followers:         id + "/followers",
+		PublicKey: &PublicKey{
+			ID:           KeyID(id),
+			Owner:        id,
+			PublicKeyPem: publicKeyPem,
+		},
+	}
+}
+
+// NewOrderedCollection returns a collection document with the given items
+func NewOrderedCollection(id string, totalItems int, items []any) *OrderedCollection {
+	return &OrderedCollection{
+		Context:      activityStreamsContext,
+		ID:           id,
+		Type:         "OrderedCollection",
+		TotalItems:   totalItems,
+		OrderedItems: items,
+	}
+}
+
+// NewCreate wraps a note in the Create activity that announces it
+func NewCreate(note *Note) *Activity {
+	object, _ := json.Marshal(note)
+	return &Activity{
+		Context:   activityStreamsContext,
+		ID:        note.ID + "/activity",
+		Type:      "Create",
+		Actor:     note.AttributedTo,
+		Object:    object,
+		Published: &note.Published,
+		To:        note.To,
+		Cc:        note.Cc,
+	}
+}
+
+// NewAccept returns the activity accepting someone's follow request
+func NewAccept(actorID string, follow *Activity) *Activity {
+	object, _ := json.Marshal(follow)
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#accepts/%d", actorID, time.Now().UnixNano()),
+		Type:    "Accept",
+		Actor:   actorID,
+		Object:  object,
+	}
+}
+
+// NewDelete returns the activity retracting one of the actor's objects
+func NewDelete(actorID string, objectID string) *Activity {
+	object, _ := json.Marshal(map[string]string{"id": objectID, "type": "Tombstone"})
+	return &Activity{
+		Context: activityStreamsContext,
+		ID:      fmt.Sprintf("%s#delete/%d", objectID, time.Now().UnixNano()),
+		Type:    "Delete",
+		Actor:   actorID,
+		Object:  object,
+		To:      []string{Public},
+	}
+}
+
+// KeyID returns the id of an actor's public key
+func KeyID(actorID string) string {
+	return actorID + "#main-key"
+}
+
+// FetchActor retrieves an actor from its server. The request is signed with
+// the given key since some servers refuse unsigned requests.
+func FetchActor(actorID string, keyID string, privateKeyPem string) (*Actor, error) {
+	u, err := url.Parse(actorID)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("invalid actor id '%s'", actorID)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, actorID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType)
+
+	err = SignRequest(req, nil, keyID, privateKeyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching actor '%s' returned status %d", actorID, resp.StatusCode)
+	}
+
+	var actor Actor
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&actor)
+	if err != nil {
+		return nil, err
+	}
+	return &actor, nil
+}
+
+// Deliver posts an activity to an inbox, signed with the given key
+func Deliver(inbox string, activity any, keyID string, privateKeyPem string) error {
+	body, err := json.Marshal(activity)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", ContentType)
+
+	err = SignRequest(req, body, keyID, privateKeyPem)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxDocumentSize))
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("delivering to '%s' returned status %d", inbox, resp.StatusCode)
+	}
+	return nil
+}
+
+// ReadBody reads the body of an incoming request, refusing huge ones
+func ReadBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxDocumentSize {
+		return nil, fmt.Errorf("request body is too large")
+	}
+	return body, nil
+}
@@ -0,0 +1,95 @@
+package activitypub
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+const testActorID = "https://mire.example/ap/u/alice"
+
+func signedTestRequest(t *testing.T, body []byte) (*http.Request, *Actor) {
+	privateKeyPem, publicKeyPem, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "https://other.example/inbox", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = SignRequest(req, body, KeyID(testActorID), privateKeyPem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return req, NewActor(testActorID, "alice", "https://mire.example/u/alice", publicKeyPem)
+}
+
+func TestSignAndVerifyRequest(t *testing.T) {
+	body := []byte(`{"type":"Follow"}`)
+	req, actor := signedTestRequest(t, body)
+
+	verified, err := VerifyRequest(req, body, func(keyID string) (*Actor, error) {
+		if ActorIDFromKeyID(keyID) != testActorID {
+			t.Errorf("Expected the key to belong to '%s', got '%s'", testActorID, keyID)
+		}
+		return actor, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if verified.ID != testActorID {
+		t.Errorf("Expected '%s' to have signed the request, got '%s'", testActorID, verified.ID)
+	}
+}
+
+func TestVerifyRejectsTamperedBody(t *testing.T) {
+	body := []byte(`{"type":"Follow"}`)
+	req, actor := signedTestRequest(t, body)
+
+	_, err := VerifyRequest(req, []byte(`{"type":"Undo"}`), func(string) (*Actor, error) {
+		return actor, nil
+	})
+	if err == nil {
+		t.Errorf("Expected a tampered body to fail verification")
+	}
+}
+
+func TestVerifyRejectsWrongKey(t *testing.T) {
+	body := []byte(`{"type":"Follow"}`)
+	req, _ := signedTestRequest(t, body)
+	_, otherActor := signedTestRequest(t, body)
+
+	_, err := VerifyRequest(req, body, func(string) (*Actor, error) {
+		return otherActor, nil
+	})
+	if err == nil {
+		t.Errorf("Expected a signature made with another key to fail verification")
+	}
+}
+
+func TestActivityObject(t *testing.T) {
+	var undo Activity
+	err := json.Unmarshal([]byte(`{
+		"type": "Undo",
+		"actor": "https://other.example/users/bob",
+		"object": {"id": "https://other.example/follows/1", "type": "Follow", "actor": "https://other.example/users/bob", "object": "`+testActorID+`"}
+	}`), &undo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	follow := undo.ObjectActivity()
+	if follow == nil || follow.Type != "Follow" {
+		t.Fatalf("Expected the undone activity to be a follow, got %+v", follow)
+	}
+	if follow.ObjectID() != testActorID {
+		t.Errorf("Expected the follow to target '%s', got '%s'", testActorID, follow.ObjectID())
+	}
+	if undo.ObjectID() != "https://other.example/follows/1" {
+		t.Errorf("Expected the embedded object id, got '%s'", undo.ObjectID())
+	}
+}
@@ -0,0 +1,210 @@
+package activitypub
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// how far off the Date of a signed request can be from our clock
+const maxClockSkew = 12 * time.Hour
+
+// GenerateKeyPair returns a new PEM encoded RSA key pair, which is what every
+// fediverse server expects actors to sign with.
+func GenerateKeyPair() (privateKeyPem string, publicKeyPem string, err error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return "", "", err
+	}
+
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", "", err
+	}
+
+	privateKeyPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	publicKeyPem = string(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicKeyBytes,
+	}))
+	return privateKeyPem, publicKeyPem, nil
+}
+
+// SignRequest adds an HTTP signature to an outgoing request. The body must be
+// the same bytes the request sends, or nil for requests without one.
+func SignRequest(req *http.Request, body []byte, keyID string, privateKeyPem string) error {
+	key, err := parsePrivateKey(privateKeyPem)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date"}
+	if body != nil {
+		req.Header.Set("Digest", digest(body))
+		headers = append(headers, "digest")
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(req, req.URL.Host, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyID, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature),
+	))
+	return nil
+}
+
+// VerifyRequest checks the HTTP signature of an incoming request and returns
+// the actor that signed it. lookupActor is used to fetch the actor owning the
+// key the request claims to be signed with.
+func VerifyRequest(r *http.Request, body []byte, lookupActor func(keyID string) (*Actor, error)) (*Actor, error) {
+	params := parseSignatureHeader(r.Header.Get("Signature"))
+	keyID, headers, signature := params["keyId"], strings.Fields(params["headers"]), params["signature"]
+	if keyID == "" || signature == "" {
+		return nil, fmt.Errorf("missing or malformed signature")
+	}
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+
+	// make sure the parts that matter are covered by the signature
+	for _, required := range []string{"(request-target)", "host", "date", "digest"} {
+		if !containsFold(headers, required) {
+			return nil, fmt.Errorf("signature doesn't cover '%s'", required)
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid date: %w", err)
+	}
+	if d := time.Since(date); d > maxClockSkew || d < -maxClockSkew {
+		return nil, fmt.Errorf("date is too far off")
+	}
+
+	if r.Header.Get("Digest") != digest(body) {
+		return nil, fmt.Errorf("digest doesn't match the body")
+	}
+
+	rawSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signature encoding: %w", err)
+	}
+
+	actor, err := lookupActor(keyID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.PublicKey == nil || actor.PublicKey.ID != keyID {
+		return nil, fmt.Errorf("actor '%s' doesn't own key '%s'", actor.ID, keyID)
+	}
+
+	publicKey, err := parsePublicKey(actor.PublicKey.PublicKeyPem)
+	if err != nil {
+		return nil, err
+	}
+
+	hashed := sha256.Sum256([]byte(signingString(r, r.Host, headers)))
+	err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], rawSignature)
+	if err != nil {
+		return nil, fmt.Errorf("signature doesn't verify: %w", err)
+	}
+
+	return actor, nil
+}
+
+// ActorIDFromKeyID guesses the actor owning a key, which is the key id
+// without its fragment for every server out there.
+func ActorIDFromKeyID(keyID string) string {
+	actorID, _, _ := strings.Cut(keyID, "#")
+	return actorID
+}
+
+func signingString(r *http.Request, host string, headers []string) string {
+	lines := make([]string, 0, len(headers))
+	for _, h := range headers {
+		h = strings.ToLower(h)
+		switch h {
+		case "(request-target)":
+			lines = append(lines, fmt.Sprintf("%s: %s %s", h, strings.ToLower(r.Method), r.URL.RequestURI()))
+		case "host":
+			lines = append(lines, "host: "+host)
+		default:
+			lines = append(lines, fmt.Sprintf("%s: %s", h, r.Header.Get(h)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func parseSignatureHeader(header string) map[string]string {
+	params := make(map[string]string)
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		params[key] = strings.Trim(value, `"`)
+	}
+	return params
+}
+
+func digest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func parsePrivateKey(privateKeyPem string) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(privateKeyPem))
+	if block == nil {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func parsePublicKey(publicKeyPem string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(publicKeyPem))
+	if block == nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		// some servers still hand out PKCS1 keys
+		rsaKey, pkcs1Err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if pkcs1Err != nil {
+			return nil, err
+		}
+		return rsaKey, nil
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type %T", key)
+	}
+	return rsaKey, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+type adminDBData struct {
+	Queries []sqlite.QueryStats
+
+	// how many posts the search index has
+	NumIndexedPosts int
+}
+
+// adminDBHandler shows how long the queries of each method of the database
+// have been taking since mire started, to find what makes pages slow
+func (s *Site) adminDBHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminDBHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	numIndexed, err := s.db.GetNumIndexedPosts()
+	if err != nil {
+		s.renderErr("adminDBHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderPage(w, r, "admin_db", adminDBData{
+		Queries:         s.db.GetQueryStats(),
+		NumIndexedPosts: numIndexed,
+	})
+}
+
+// adminReindexSearchHandler rebuilds the search index of posts, in the
+// background since it goes through every post
+func (s *Site) adminReindexSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminReindexSearchHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	go func() {
+		start := time.Now()
+		if err := s.db.ReindexPostSearch(); err != nil {
+			log.Printf("[err] adminReindexSearchHandler: could not rebuild the search index: %s\n", err)
+			return
+		}
+		log.Printf("adminReindexSearchHandler: rebuilt the search index in %s\n", time.Since(start).Round(time.Millisecond))
+	}()
+
+	http.Redirect(w, r, "/admin/db", http.StatusSeeOther)
+}
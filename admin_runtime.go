@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// when mire started, for the uptime
+var startedAt = time.Now()
+
+// how many of the slowest feeds the runtime page lists
+const numSlowestFeeds = 50
+
+type adminRuntimeData struct {
+	Uptime        time.Duration
+	NumGoroutines int
+
+	HeapAlloc   string
+	HeapInuse   string
+	HeapObjects uint64
+	Sys         string
+	NumGC       uint32
+	LastGC      time.Time
+	GCPauses    time.Duration
+
+	Reaper reaper.Diagnostics
+}
+
+// adminRuntimeHandler shows how mire itself is doing (goroutines, memory,
+// what the reaper is busy with), to figure out what's wrong without having
+// to log into the server
+func (s *Site) adminRuntimeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminRuntimeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	diagnostics := s.reaper.Diagnostics()
+	diagnostics.LastFetches = diagnostics.LastFetches[:min(numSlowestFeeds, len(diagnostics.LastFetches))]
+
+	s.renderPage(w, r, "admin_runtime", adminRuntimeData{
+		Uptime:        time.Since(startedAt).Round(time.Second),
+		NumGoroutines: runtime.NumGoroutine(),
+		HeapAlloc:     formatBytes(mem.HeapAlloc),
+		HeapInuse:     formatBytes(mem.HeapInuse),
+		HeapObjects:   mem.HeapObjects,
+		Sys:           formatBytes(mem.Sys),
+		NumGC:         mem.NumGC,
+		LastGC:        time.Unix(0, int64(mem.LastGC)),
+		GCPauses:      time.Duration(mem.PauseTotalNs),
+		Reaper:        diagnostics,
+	})
+}
+
+func formatBytes(b uint64) string {
+	const unit = 1024
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div, exp := uint64(unit), 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+type adminStatsData struct {
+	Stats    MireSiteStats
+	Interval time.Duration
+}
+
+// adminStatsHandler shows the stats of the instance, when they were computed
+// and how often they are
+func (s *Site) adminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminStatsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	s.renderPage(w, r, "admin_stats", adminStatsData{
+		Stats:    getSiteStats(),
+		Interval: statsInterval(s),
+	})
+}
+
+// adminSaveStatsIntervalHandler sets how often the stats are computed, or
+// goes back to the default when the interval is empty
+func (s *Site) adminSaveStatsIntervalHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminSaveStatsIntervalHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	value := strings.TrimSpace(r.FormValue("interval"))
+	if value != "" {
+		interval, err := time.ParseDuration(value)
+		if err != nil {
+			s.renderErr("adminSaveStatsIntervalHandler", w, "the interval should look like 6h or 90m", http.StatusBadRequest)
+			return
+		}
+		if interval < minStatsInterval {
+			s.renderErr("adminSaveStatsIntervalHandler", w, "the stats can't be computed more often than every "+minStatsInterval.String(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := s.db.SetSiteSetting(sqlite.SettingStatsInterval, value)
+	if err != nil {
+		s.renderErr("adminSaveStatsIntervalHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/stats", http.StatusSeeOther)
+}
+
+// adminRecomputeStatsHandler has the stats computed right away instead of at
+// their next round
+func (s *Site) adminRecomputeStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminRecomputeStatsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	recomputeStatsNow()
+	http.Redirect(w, r, "/admin/stats", http.StatusSeeOther)
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/matrix"
+	"codeberg.org/meadowingc/mire/ntfy"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	maxKeywordAlertsPerUser = 20
+	minKeywordLength        = 2
+	maxKeywordLength        = 100
+	numKeywordAlertMatches  = 100
+)
+
+// alertsHandler shows a user's keyword alerts and the posts they matched
+func (s *Site) alertsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("alertsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	alerts, err := s.db.GetUserKeywordAlerts(username)
+	if err != nil {
+		s.renderErr("alertsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matches, err := s.db.GetKeywordAlertMatches(username, numKeywordAlertMatches)
+	if err != nil {
+		s.renderErr("alertsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ntfySubscription, err := s.db.GetNtfySubscription(username)
+	if err != nil {
+		s.renderErr("alertsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	matrixNotification, err := s.db.GetMatrixNotification(username)
+	if err != nil {
+		s.renderErr("alertsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Alerts  []*sqlite.KeywordAlert
+		Matches []*sqlite.KeywordAlertMatch
+		CanPush bool
+	}{
+		Alerts:  alerts,
+		Matches: matches,
+		CanPush: ntfySubscription != nil || matrixNotification != nil,
+	}
+
+	s.renderPage(w, r, "alerts", data)
+}
+
+// addAlertHandler adds a keyword alert, or updates it if the user already
+// has one for the same keyword
+func (s *Site) addAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("addAlertHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	keyword := strings.Join(strings.Fields(r.FormValue("keyword")), " ")
+	if n := utf8.RuneCountInString(keyword); n < minKeywordLength || n > maxKeywordLength {
+		e := fmt.Sprintf("keywords should be between %d and %d characters long", minKeywordLength, maxKeywordLength)
+		s.renderErr("addAlertHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	scope := r.FormValue("scope")
+	if scope != sqlite.AlertScopeMine && scope != sqlite.AlertScopeAll {
+		s.renderErr("addAlertHandler", w, fmt.Sprintf("invalid scope '%s'", scope), http.StatusBadRequest)
+		return
+	}
+
+	alerts, err := s.db.GetUserKeywordAlerts(username)
+	if err != nil {
+		s.renderErr("addAlertHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	updating := false
+	for _, alert := range alerts {
+		updating = updating || alert.Keyword == keyword
+	}
+	if !updating && len(alerts) >= maxKeywordAlertsPerUser {
+		e := fmt.Sprintf("you can have at most %d alerts", maxKeywordAlertsPerUser)
+		s.renderErr("addAlertHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.AddKeywordAlert(username, keyword, scope, r.FormValue("notify") == "on")
+	if err != nil {
+		s.renderErr("addAlertHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts", http.StatusSeeOther)
+}
+
+func (s *Site) deleteAlertHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("deleteAlertHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid alert id '%s'", r.PathValue("id"))
+		s.renderErr("deleteAlertHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveKeywordAlert(s.username(r), id)
+	if err != nil {
+		s.renderErr("deleteAlertHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts", http.StatusSeeOther)
+}
+
+// clearAlertsHandler empties the list of posts a user's alerts matched
+func (s *Site) clearAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("clearAlertsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.ClearKeywordAlertMatches(s.username(r))
+	if err != nil {
+		s.renderErr("clearAlertsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/alerts", http.StatusSeeOther)
+}
+
+// sendKeywordAlertNotifications pushes the alert matches people asked to be
+// notified about to their phone (ntfy) or Matrix room
+func sendKeywordAlertNotifications(s *Site) {
+	usernames, err := s.db.GetUsersWithUnnotifiedKeywordAlerts()
+	if err != nil {
+		log.Printf("[err] sendKeywordAlertNotifications: could not get users: %s\n", err)
+		return
+	}
+
+	for _, username := range usernames {
+		matches, err := s.db.GetUnnotifiedKeywordAlertMatches(username)
+		if err != nil {
+			log.Printf("[err] sendKeywordAlertNotifications: could not get the matches of '%s': %s\n", username, err)
+			continue
+		}
+
+		err = s.pushKeywordAlertMatches(username, matches)
+		if err != nil {
+			// try again on the next check
+			log.Printf("[err] sendKeywordAlertNotifications: could not notify '%s': %s\n", username, err)
+			continue
+		}
+
+		err = s.db.MarkKeywordAlertMatchesNotified(matches)
+		if err != nil {
+			log.Printf("[err] sendKeywordAlertNotifications: could not mark the matches of '%s': %s\n", username, err)
+		}
+	}
+}
+
+// pushKeywordAlertMatches sends alert matches through every push channel a
+// user set up. Matches of someone without any are just shown on /alerts.
+func (s *Site) pushKeywordAlertMatches(username string, matches []*sqlite.KeywordAlertMatch) error {
+	ntfySubscription, err := s.db.GetNtfySubscription(username)
+	if err != nil {
+		return err
+	}
+	if ntfySubscription != nil {
+		for i, m := range matches {
+			if i == maxNtfyNotificationsPerCheck {
+				err = ntfy.Publish(ntfySubscription.TopicURL, &ntfy.Notification{
+					Title:   "mire",
+					Message: fmt.Sprintf("...and %d more posts matched your alerts", len(matches)-i),
+					Click:   constants.BASE_URL + "/alerts",
+				})
+				if err != nil {
+					return err
+				}
+				break
+			}
+
+			err = ntfy.Publish(ntfySubscription.TopicURL, &ntfy.Notification{
+				Title:   fmt.Sprintf("\"%s\" on %s", m.Keyword, s.feedTitleOrDomain(m.FeedURL)),
+				Message: m.Title,
+				Click:   m.URL,
+				Tags:    []string{"bell"},
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	matrixNotification, err := s.db.GetMatrixNotification(username)
+	if err != nil {
+		return err
+	}
+	if matrixNotification != nil {
+		var text, formatted strings.Builder
+		text.WriteString("Your alerts matched:\n")
+		formatted.WriteString("<p>Your alerts matched:</p><ul>")
+		for i, m := range matches {
+			if i == numMatrixPostsPerMessage {
+				more := fmt.Sprintf("...and %d more", len(matches)-i)
+				text.WriteString(more + "\n")
+				formatted.WriteString("<li>" + more + "</li>")
+				break
+			}
+
+			feed := s.feedTitleOrDomain(m.FeedURL)
+			fmt.Fprintf(&text, "- [%s] %s (%s) %s\n", m.Keyword, m.Title, feed, m.URL)
+			fmt.Fprintf(&formatted, `<li>[%s] <a href="%s">%s</a> · %s</li>`,
+				html.EscapeString(m.Keyword), html.EscapeString(m.URL), html.EscapeString(m.Title), html.EscapeString(feed))
+		}
+		formatted.WriteString("</ul>")
+
+		client := &matrix.Client{Homeserver: matrixNotification.Homeserver, AccessToken: matrixNotification.AccessToken}
+		err = client.Send(matrixNotification.RoomID, "mire-alerts-"+strconv.FormatInt(time.Now().UnixNano(), 10), &matrix.Message{
+			Body:          text.String(),
+			FormattedBody: formatted.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
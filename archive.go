@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+// posts are archived once they're older than defaultArchiveAfterDays, unless
+// an admin says otherwise, see archiveAfterDays
+const defaultArchiveAfterDays = 365
+
+// posts are moved numPostsArchivedAtOnce at a time, so that archiving lots of
+// them doesn't hold the database for long
+const numPostsArchivedAtOnce = 500
+
+// how many archived posts a search returns at most
+const numArchiveSearchResults = 100
+
+// archiveAfterDays is how old posts are when they're archived, as set by an
+// admin. 0 means posts are never archived.
+func archiveAfterDays(s *Site) int {
+	value, err := s.db.GetSiteSetting(sqlite.SettingArchiveAfterDays, strconv.Itoa(defaultArchiveAfterDays))
+	if err != nil {
+		log.Printf("[err] archiveAfterDays: could not get the setting: %s\n", err)
+		return 0
+	}
+
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		log.Printf("[err] archiveAfterDays: invalid setting '%s', not archiving\n", value)
+		return 0
+	}
+	return days
+}
+
+// archiveProcess moves old posts out of the way of the timelines every day
+func archiveProcess(ctx context.Context, s *Site) error {
+	for {
+		archiveOldPosts(ctx, s)
+		if !supervisor.Sleep(ctx, 24*time.Hour) {
+			return nil
+		}
+	}
+}
+
+func archiveOldPosts(ctx context.Context, s *Site) {
+	days := archiveAfterDays(s)
+	if days == 0 {
+		return
+	}
+
+	olderThan := time.Now().AddDate(0, 0, -days)
+	total := 0
+	for ctx.Err() == nil {
+		archived, err := s.db.ArchivePosts(olderThan, numPostsArchivedAtOnce)
+		if err != nil {
+			log.Printf("[err] archiveOldPosts: could not archive posts: %s\n", err)
+			return
+		}
+		total += archived
+		if archived < numPostsArchivedAtOnce {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("archiveOldPosts: archived %d posts older than %d days\n", total, days)
+	}
+}
+
+type archiveData struct {
+	Query     string
+	Posts     []*sqlite.Post
+	AfterDays int
+}
+
+// archiveHandler searches the archived posts of the feeds someone is
+// subscribed to, by title
+func (s *Site) archiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("archiveHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	data := archiveData{
+		Query:     strings.TrimSpace(r.URL.Query().Get("q")),
+		AfterDays: archiveAfterDays(s),
+	}
+	if data.Query != "" {
+		var err error
+		data.Posts, err = s.db.SearchArchivedPosts(s.username(r), data.Query, numArchiveSearchResults)
+		if err != nil {
+			s.renderErr("archiveHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.renderPage(w, r, "archive", data)
+}
+
+type adminArchiveData struct {
+	NumArchived int
+	AfterDays   int
+}
+
+// adminArchiveHandler shows how many posts were archived and after how long
+func (s *Site) adminArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminArchiveHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	numArchived, err := s.db.GetNumArchivedPosts()
+	if err != nil {
+		s.renderErr("adminArchiveHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderPage(w, r, "admin_archive", adminArchiveData{
+		NumArchived: numArchived,
+		AfterDays:   archiveAfterDays(s),
+	})
+}
+
+// adminSaveArchiveHandler sets how old posts are when they're archived, 0
+// to stop archiving
+func (s *Site) adminSaveArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminSaveArchiveHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	days, err := strconv.Atoi(strings.TrimSpace(r.FormValue("days")))
+	if err != nil || days < 0 {
+		s.renderErr("adminSaveArchiveHandler", w, "the number of days should be 0 or more", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetSiteSetting(sqlite.SettingArchiveAfterDays, strconv.Itoa(days))
+	if err != nil {
+		s.renderErr("adminSaveArchiveHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/archive", http.StatusSeeOther)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+// autoMarkReadProcess marks posts read for whoever asked to have them marked
+// read once they're old (see UserPreferences.AutoMarkReadAfterDays), every
+// hour, so that coming back after a while doesn't mean thousands of stale
+// unread posts
+func autoMarkReadProcess(ctx context.Context, s *Site) error {
+	for {
+		autoMarkRead(ctx, s)
+		if !supervisor.Sleep(ctx, time.Hour) {
+			return nil
+		}
+	}
+}
+
+func autoMarkRead(ctx context.Context, s *Site) {
+	values, err := s.db.GetUsersWithPreference("autoMarkReadAfterDays")
+	if err != nil {
+		log.Printf("[err] autoMarkRead: could not get who wants posts marked read: %s\n", err)
+		return
+	}
+
+	for username, value := range values {
+		if ctx.Err() != nil {
+			return
+		}
+
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			continue
+		}
+
+		marked, err := s.db.MarkReadPublishedBefore(username, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Printf("[err] autoMarkRead: could not mark posts read for %s: %s\n", username, err)
+			continue
+		}
+		if marked > 0 {
+			log.Printf("autoMarkRead: marked %d posts older than %d days read for %s\n", marked, days, username)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+// Package autodiscovery finds the feeds a web page advertises with
+// <link rel="alternate" type="application/rss+xml" href="..."> elements
+// (https://www.rssboard.org/rss-autodiscovery), so people can subscribe to a
+// site without hunting for its feed.
+package autodiscovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+	"golang.org/x/net/html"
+)
+
+// max size of the page read while looking for its feeds
+const maxPageSize = 2 << 20
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+var feedTypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/feed+json",
+	"application/json",
+}
+
+// Feed is a feed advertised by a page
+type Feed struct {
+	URL   string
+	Title string
+	Type  string
+}
+
+// Find returns the feeds of a page, in the order the page lists them. A URL
+// that is itself a feed is returned as is.
+func Find(pageURL string) ([]Feed, error) {
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/html, application/xhtml+xml, application/rss+xml, application/atom+xml;q=0.9, */*;q=0.8")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("fetching '%s' returned status %d", pageURL, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if isFeed(mediaType, body) {
+		return []Feed{{URL: pageURL, Type: mediaType}}, nil
+	}
+
+	// relative links are relative to where we ended up after redirects
+	return FromPage(resp.Request.URL, body), nil
+}
+
+// isFeed tells feeds from pages, going by their content type and, since
+// plenty of feeds are served as text/xml, text/plain or plain json, by their
+// first element or their version
+func isFeed(mediaType string, body []byte) bool {
+	switch mediaType {
+	case "application/rss+xml", "application/atom+xml":
+		return true
+	case "text/html", "application/xhtml+xml":
+		return false
+	case "application/json", "application/feed+json":
+		return isJSONFeed(body)
+	}
+
+	// the root element can come after a long prolog of comments and
+	// stylesheets, the names of the elements are all that's needed
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return false
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			switch start.Name.Local {
+			case "rss", "feed", "RDF":
+				return true
+			}
+			return false
+		}
+	}
+}
+
+// isJSONFeed tells a JSON Feed (https://www.jsonfeed.org/version/1.1/) from
+// any other json
+func isJSONFeed(body []byte) bool {
+	var feed struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(body, &feed); err != nil {
+		return false
+	}
+	return strings.HasPrefix(feed.Version, "https://jsonfeed.org/")
+}
+
+// FromPage returns the feeds a page links to with <link rel="alternate">
+func FromPage(base *url.URL, page []byte) []Feed {
+	var feeds []Feed
+	seen := map[string]bool{}
+
+	tokenizer := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return feeds
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data == "body" {
+				// feeds are only advertised in the head
+				return feeds
+			}
+			if token.Data != "link" {
+				continue
+			}
+
+			var rel, feedType, href, title string
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "rel":
+					rel = attr.Val
+				case "type":
+					feedType = strings.ToLower(strings.TrimSpace(attr.Val))
+				case "href":
+					href = attr.Val
+				case "title":
+					title = strings.TrimSpace(attr.Val)
+				}
+			}
+			if !hasRel(rel, "alternate") || !isFeedType(feedType) || strings.TrimSpace(href) == "" {
+				continue
+			}
+
+			feedURL, err := base.Parse(strings.TrimSpace(href))
+			if err != nil || (feedURL.Scheme != "http" && feedURL.Scheme != "https") || seen[feedURL.String()] {
+				continue
+			}
+			seen[feedURL.String()] = true
+			feeds = append(feeds, Feed{URL: feedURL.String(), Title: title, Type: feedType})
+		}
+	}
+}
+
+func hasRel(rels string, rel string) bool {
+	for _, r := range strings.Fields(rels) {
+		if strings.EqualFold(r, rel) {
+			return true
+		}
+	}
+	return false
+}
+
+func isFeedType(feedType string) bool {
+	for _, t := range feedTypes {
+		if feedType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// IsComments guesses whether a feed has a site's comments rather than its
+// posts, sites that advertise both often list the comments first
+func (f Feed) IsComments() bool {
+	if strings.Contains(strings.ToLower(f.Title), "comments") {
+		return true
+	}
+	u, err := url.Parse(f.URL)
+	if err != nil {
+		return false
+	}
+	return strings.Contains(strings.ToLower(u.Path), "comments")
+}
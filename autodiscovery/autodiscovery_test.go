@@ -0,0 +1,124 @@
+package autodiscovery
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestFromPage(t *testing.T) {
+	base, _ := url.Parse("https://example.com/blog/post")
+	page := []byte(`<!doctype html>
+<html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="Posts" href="/feed.xml">
+<link href="https://example.com/atom.xml" rel="alternate" type="application/atom+xml" />
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" type="text/html" hreflang="fr" href="/fr/">
+<link rel="alternate" type="application/rss+xml" href="javascript:alert(1)">
+<link rel="alternate" type="application/feed+json" href="comments.json" title="Comments">
+</head><body>
+<link rel="alternate" type="application/rss+xml" href="/not-in-head.xml">
+</body></html>`)
+
+	feeds := FromPage(base, page)
+	expected := []Feed{
+		{URL: "https://example.com/feed.xml", Title: "Posts", Type: "application/rss+xml"},
+		{URL: "https://example.com/atom.xml", Type: "application/atom+xml"},
+		{URL: "https://example.com/blog/comments.json", Title: "Comments", Type: "application/feed+json"},
+	}
+	if len(feeds) != len(expected) {
+		t.Fatalf("Expected %d feeds, got %+v", len(expected), feeds)
+	}
+	for i := range expected {
+		if feeds[i] != expected[i] {
+			t.Errorf("Expected %+v, got %+v", expected[i], feeds[i])
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="/index.xml"></head></html>`))
+		case "/index.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel></channel></rss>`))
+		case "/feed.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"version": "https://jsonfeed.org/version/1.1", "title": "Posts", "items": []}`))
+		case "/data.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"version": 2, "items": []}`))
+		case "/prolog.xml":
+			w.Header().Set("Content-Type", "text/xml")
+			w.Write([]byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<?xml-stylesheet type="text/xsl" href="/feed.xsl"?>
+<!-- ` + strings.Repeat("a long licence notice ", 100) + ` -->
+<feed xmlns="http://www.w3.org/2005/Atom"></feed>`))
+		case "/down":
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	feeds, err := Find(server.URL + "/")
+	if err != nil || len(feeds) != 1 || feeds[0].URL != server.URL+"/index.xml" {
+		t.Errorf("Expected the page's feed, got %+v (%v)", feeds, err)
+	}
+
+	feeds, err = Find(server.URL + "/index.xml")
+	if err != nil || len(feeds) != 1 || feeds[0].URL != server.URL+"/index.xml" {
+		t.Errorf("Expected the feed itself, got %+v (%v)", feeds, err)
+	}
+
+	for _, feedURL := range []string{server.URL + "/feed.json", server.URL + "/prolog.xml"} {
+		feeds, err = Find(feedURL)
+		if err != nil || len(feeds) != 1 || feeds[0].URL != feedURL {
+			t.Errorf("Expected %s to be a feed, got %+v (%v)", feedURL, feeds, err)
+		}
+	}
+
+	feeds, err = Find(server.URL + "/data.json")
+	if err != nil || len(feeds) != 0 {
+		t.Errorf("Expected json that isn't a JSON Feed not to be a feed, got %+v (%v)", feeds, err)
+	}
+
+	if _, err := Find(server.URL + "/missing"); err == nil {
+		t.Errorf("Expected an error for a page that doesn't exist")
+	}
+	if _, err := Find(server.URL + "/down"); err == nil {
+		t.Errorf("Expected an error for a site that's down")
+	}
+}
+
+func TestIsComments(t *testing.T) {
+	for _, tc := range []struct {
+		feed     Feed
+		comments bool
+	}{
+		{Feed{URL: "https://example.com/feed/"}, false},
+		{Feed{URL: "https://example.com/comments/feed/"}, true},
+		{Feed{URL: "https://example.com/feed", Title: "Example » Comments Feed"}, true},
+		{Feed{URL: "https://example.com/feed?tag=comments"}, false},
+	} {
+		if tc.feed.IsComments() != tc.comments {
+			t.Errorf("Expected %+v to be comments: %t", tc.feed, tc.comments)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"codeberg.org/meadowingc/mire/bench"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// benchPage is a page timed by `mire bench`, path builds its URL for one of
+// the made up users
+type benchPage struct {
+	name string
+	path func(username string, feedURL string) string
+}
+
+// the pages people load the most
+var benchPages = []benchPage{
+	{"discover", func(string, string) string { return "/discover" }},
+	// where people land when they log in, their timeline
+	{"profile", func(username string, _ string) string { return "/u/" + username }},
+	{"feed details", func(_ string, feedURL string) string { return "/feeds/" + url.QueryEscape(feedURL) }},
+	{"starred", func(string, string) string { return "/starred" }},
+	{"unread count", func(string, string) string { return "/api/v1/unread-count" }},
+	{"settings", func(string, string) string { return "/settings" }},
+}
+
+// runBench is `mire bench`: it seeds a throwaway database with made up users,
+// feeds and posts, then times the pages people load the most against it, as
+// a random user every time. Run it before deploying changes to queries.
+func runBench(args []string) {
+	cfg := bench.DefaultConfig()
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	flags.IntVar(&cfg.Users, "users", cfg.Users, "how many users to make up")
+	flags.IntVar(&cfg.Feeds, "feeds", cfg.Feeds, "how many feeds to make up")
+	flags.IntVar(&cfg.PostsPerFeed, "posts", cfg.PostsPerFeed, "how many posts every feed has")
+	flags.IntVar(&cfg.SubscriptionsPerUser, "subscriptions", cfg.SubscriptionsPerUser, "how many feeds every user subscribes to")
+	flags.Float64Var(&cfg.ReadRatio, "read", cfg.ReadRatio, "the share of their posts users read")
+	requests := flags.Int("requests", 50, "how many times to load every page")
+	flags.Parse(args)
+
+	dir, err := os.MkdirTemp("", "mire-bench")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// the request log (and the migrations) would drown the results. The
+	// reaper isn't started, the made up feeds can't be fetched anyway.
+	log.SetOutput(io.Discard)
+	middleware.DefaultLogger = middleware.RequestLogger(&middleware.DefaultLogFormatter{Logger: log.New(io.Discard, "", 0)})
+
+	s := newSite(filepath.Join(dir, "bench.db"))
+	defer s.db.Close()
+
+	fmt.Printf("bench: seeding %d users and %d feeds of %d posts...\n", cfg.Users, cfg.Feeds, cfg.PostsPerFeed)
+	start := time.Now()
+	data, err := bench.Seed(s.db, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "bench: could not seed the database: %s\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("bench: seeded %d posts in %s\n\n", data.Posts, time.Since(start).Round(time.Millisecond))
+
+	// only count the queries of the pages
+	s.db.ResetQueryStats()
+
+	router := buildRouter(s)
+	random := rand.New(rand.NewSource(1))
+
+	out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "page\tp50\tp95\tmax\terrors")
+	for _, page := range benchPages {
+		var durations []time.Duration
+		errors := 0
+		for range *requests {
+			username := data.Usernames[random.Intn(len(data.Usernames))]
+			feedURL := data.FeedURLs[random.Intn(len(data.FeedURLs))]
+
+			r := httptest.NewRequest(http.MethodGet, page.path(username, feedURL), nil)
+			r.AddCookie(&http.Cookie{Name: "session_token", Value: bench.SessionToken(username)})
+			w := httptest.NewRecorder()
+
+			start := time.Now()
+			router.ServeHTTP(w, r)
+			durations = append(durations, time.Since(start))
+
+			if w.Code != http.StatusOK {
+				errors++
+			}
+		}
+
+		slices.Sort(durations)
+		fmt.Fprintf(out, "%s\t%s\t%s\t%s\t%d\n", page.name,
+			percentile(durations, 50), percentile(durations, 95), durations[len(durations)-1].Round(time.Microsecond), errors)
+	}
+	out.Flush()
+
+	fmt.Println()
+	out = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(out, "queries of\tcount\taverage\tmax\ttotal")
+	queryStats := s.db.GetQueryStats()
+	for _, stats := range queryStats[:min(15, len(queryStats))] {
+		fmt.Fprintf(out, "%s\t%d\t%s\t%s\t%s\n", stats.Family, stats.Count,
+			stats.Average().Round(time.Microsecond), stats.Max.Round(time.Microsecond), stats.Total.Round(time.Millisecond))
+	}
+	out.Flush()
+}
+
+// percentile returns the p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (len(sorted) - 1) * p / 100
+	return sorted[i].Round(time.Microsecond)
+}
@@ -0,0 +1,103 @@
+// Package bench fills databases with made up users, feeds and posts, to see
+// how mire copes with lots of data before real people find out.
+package bench
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// Config is how much to make up
+type Config struct {
+	Users        int
+	Feeds        int
+	PostsPerFeed int
+
+	// how many feeds every user subscribes to, at most Feeds
+	SubscriptionsPerUser int
+
+	// the share of each user's timeline they read, between 0 and 1
+	ReadRatio float64
+}
+
+// DefaultConfig is about the size of a small instance
+func DefaultConfig() Config {
+	return Config{
+		Users:                100,
+		Feeds:                500,
+		PostsPerFeed:         50,
+		SubscriptionsPerUser: 50,
+		ReadRatio:            0.5,
+	}
+}
+
+// Dataset is what Seed made up
+type Dataset struct {
+	Usernames []string
+	FeedURLs  []string
+	Posts     int
+}
+
+// SessionToken is the session token of a made up user, to make requests as
+// them without logging in
+func SessionToken(username string) string {
+	return "bench-" + username
+}
+
+// Seed fills a new database following cfg. It always makes up the same
+// data for the same config, so that runs can be compared.
+func Seed(db *sqlite.DB, cfg Config) (*Dataset, error) {
+	random := rand.New(rand.NewSource(1))
+	data := &Dataset{}
+
+	for i := range cfg.Feeds {
+		// .invalid never resolves, the reaper gives up on these right away
+		feedURL := fmt.Sprintf("https://feed-%d.bench.invalid/rss", i)
+		db.WriteFeed(feedURL)
+		data.FeedURLs = append(data.FeedURLs, feedURL)
+
+		posts := make([]*sqlite.Post, 0, cfg.PostsPerFeed)
+		for j := range cfg.PostsPerFeed {
+			posts = append(posts, &sqlite.Post{
+				FeedURL:           feedURL,
+				Title:             fmt.Sprintf("Post %d of feed %d", j, i),
+				URL:               fmt.Sprintf("https://feed-%d.bench.invalid/posts/%d", i, j),
+				PublishedDatetime: time.Now().Add(-time.Duration(random.Intn(365*24)) * time.Hour),
+				WordCount:         random.Intn(3000),
+			})
+		}
+		data.Posts += db.SavePosts(posts)
+	}
+
+	subscriptions := min(cfg.SubscriptionsPerUser, cfg.Feeds)
+	for i := range cfg.Users {
+		username := fmt.Sprintf("bench%d", i)
+		// nobody logs in with a password, see SessionToken
+		if err := db.AddUser(username, "-"); err != nil {
+			return nil, err
+		}
+		if err := db.SetSessionToken(username, SessionToken(username), time.Now().AddDate(1, 0, 0)); err != nil {
+			return nil, err
+		}
+		data.Usernames = append(data.Usernames, username)
+
+		for _, f := range random.Perm(cfg.Feeds)[:subscriptions] {
+			db.Subscribe(username, data.FeedURLs[f])
+		}
+
+		var read []int
+		for _, entry := range db.GetPostsForUser(username, subscriptions*cfg.PostsPerFeed) {
+			if random.Float64() < cfg.ReadRatio {
+				read = append(read, entry.PostID)
+			}
+		}
+		if err := db.SetPostsReadStatus(username, read, true); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
@@ -0,0 +1,128 @@
+package bench
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// small enough for go test, big enough for the queries to have some work
+var testConfig = Config{
+	Users:                20,
+	Feeds:                100,
+	PostsPerFeed:         50,
+	SubscriptionsPerUser: 30,
+	ReadRatio:            0.5,
+}
+
+// the benchmarks share one database, seeding takes longer than they do
+var (
+	sharedOnce sync.Once
+	sharedDir  string
+	sharedDB   *sqlite.DB
+	sharedData *Dataset
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if sharedDir != "" {
+		os.RemoveAll(sharedDir)
+	}
+	os.Exit(code)
+}
+
+func seedSharedDB(b *testing.B) (*sqlite.DB, *Dataset) {
+	sharedOnce.Do(func() {
+		var err error
+		sharedDir, err = os.MkdirTemp("", "mire-bench")
+		if err != nil {
+			log.Fatal(err)
+		}
+		sharedDB = sqlite.New(filepath.Join(sharedDir, "bench_go_test.db"))
+		sharedData, err = Seed(sharedDB, testConfig)
+		if err != nil {
+			log.Fatal(err)
+		}
+	})
+	return sharedDB, sharedData
+}
+
+func seedTestDB(tb testing.TB, cfg Config) (*sqlite.DB, *Dataset) {
+	db := sqlite.New(filepath.Join(tb.TempDir(), "bench_go_test.db"))
+	tb.Cleanup(func() { db.Close() })
+
+	data, err := Seed(db, cfg)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return db, data
+}
+
+func TestSeed(t *testing.T) {
+	cfg := Config{Users: 3, Feeds: 5, PostsPerFeed: 4, SubscriptionsPerUser: 2, ReadRatio: 1}
+	db, data := seedTestDB(t, cfg)
+
+	if len(data.Usernames) != 3 || len(data.FeedURLs) != 5 || data.Posts != 20 {
+		t.Fatalf("expected 3 users, 5 feeds and 20 posts, got %d, %d and %d", len(data.Usernames), len(data.FeedURLs), data.Posts)
+	}
+
+	username := data.Usernames[0]
+	if got := db.GetUsernameBySessionToken(SessionToken(username)); got != username {
+		t.Errorf("expected the session token to be %s's, got '%s'", username, got)
+	}
+	if n := len(db.GetUserFeedURLs(username)); n != 2 {
+		t.Errorf("expected 2 subscriptions, got %d", n)
+	}
+	if count, _ := db.GetUnreadCountForUser(username); count != 0 {
+		t.Errorf("expected everything to be read, got %d unread", count)
+	}
+}
+
+func BenchmarkGetPostsForUser(b *testing.B) {
+	db, data := seedSharedDB(b)
+	b.ResetTimer()
+
+	for i := range b.N {
+		db.GetPostsForUser(data.Usernames[i%len(data.Usernames)], 100)
+	}
+}
+
+func BenchmarkGetTimelinePage(b *testing.B) {
+	db, data := seedSharedDB(b)
+	b.ResetTimer()
+
+	for i := range b.N {
+		_, err := db.GetTimelinePage(data.Usernames[i%len(data.Usernames)], sqlite.TimelineFilter{}, 0, 0, 20)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkGetDiscoverPosts(b *testing.B) {
+	db, data := seedSharedDB(b)
+	b.ResetTimer()
+
+	for i := range b.N {
+		filter := sqlite.DiscoverFilter{
+			ExcludeSubscribedBy: data.Usernames[i%len(data.Usernames)],
+			ApplyMutesOf:        data.Usernames[i%len(data.Usernames)],
+		}
+		db.GetDiscoverPosts(filter, 100)
+	}
+}
+
+func BenchmarkSetReadStatus(b *testing.B) {
+	db, data := seedSharedDB(b)
+	username := data.Usernames[0]
+	posts := db.GetPostsForUser(username, 1000)
+	b.ResetTimer()
+
+	for i := range b.N {
+		db.SetReadStatus(username, posts[i%len(posts)].Post.Link, i%2 == 0)
+	}
+}
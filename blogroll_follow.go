@@ -0,0 +1,45 @@
+package main
+
+import "net/http"
+
+// Following someone's blogroll puts every feed they subscribe to on your
+// timeline, including the ones they subscribe to later on.
+
+func (s *Site) followBlogrollHandler(w http.ResponseWriter, r *http.Request) {
+	s.setFollowingBlogroll("followBlogrollHandler", w, r, true)
+}
+
+func (s *Site) unfollowBlogrollHandler(w http.ResponseWriter, r *http.Request) {
+	s.setFollowingBlogroll("unfollowBlogrollHandler", w, r, false)
+}
+
+func (s *Site) setFollowingBlogroll(caller string, w http.ResponseWriter, r *http.Request, follow bool) {
+	if !s.loggedIn(r) {
+		s.renderErr(caller, w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	followee := r.PathValue("username")
+	if !s.db.UserExists(followee) {
+		http.NotFound(w, r)
+		return
+	}
+	if followee == username {
+		s.renderErr(caller, w, "you can't follow your own blogroll", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if follow {
+		err = s.db.FollowBlogroll(username, followee)
+	} else {
+		err = s.db.UnfollowBlogroll(username, followee)
+	}
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/u/"+followee+"/blogroll"), http.StatusSeeOther)
+}
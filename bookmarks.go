@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/bookmarks"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	defaultBookmarkTags = "mire"
+	maxBookmarkTags     = 10
+)
+
+func bookmarkClient(service *sqlite.BookmarkService) *bookmarks.Client {
+	return &bookmarks.Client{
+		Service:  service.Service,
+		Instance: service.Instance,
+		Token:    service.Token,
+	}
+}
+
+// settingsBookmarksHandler connects (or disconnects) the linkding or shaarli
+// instance bookmarks are created in when someone stars a post
+func (s *Site) settingsBookmarksHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsBookmarksHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	if strings.TrimSpace(r.FormValue("instance")) == "" {
+		err := s.db.RemoveBookmarkService(username)
+		if err != nil {
+			s.renderErr("settingsBookmarksHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/settings#bookmarks", http.StatusSeeOther)
+		return
+	}
+
+	serviceName := r.FormValue("service")
+	if !bookmarks.ValidService(serviceName) {
+		s.renderErr("settingsBookmarksHandler", w, fmt.Sprintf("unknown bookmark service '%s'", serviceName), http.StatusBadRequest)
+		return
+	}
+
+	instance, err := bookmarks.NormalizeInstance(r.FormValue("instance"))
+	if err != nil {
+		s.renderErr("settingsBookmarksHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	tags := bookmarks.ParseTags(r.FormValue("tags"))
+	if len(tags) > maxBookmarkTags {
+		s.renderErr("settingsBookmarksHandler", w, fmt.Sprintf("at most %d tags can be added", maxBookmarkTags), http.StatusBadRequest)
+		return
+	}
+
+	// the token can be left empty to keep the one already saved
+	token := strings.TrimSpace(r.FormValue("token"))
+	if token == "" {
+		existing, err := s.db.GetBookmarkService(username)
+		if err != nil {
+			s.renderErr("settingsBookmarksHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing == nil || existing.Service != serviceName || existing.Instance != instance {
+			s.renderErr("settingsBookmarksHandler", w, "an API token (or secret, for shaarli) is needed", http.StatusBadRequest)
+			return
+		}
+		token = existing.Token
+	}
+
+	service := &sqlite.BookmarkService{
+		Service:  serviceName,
+		Instance: instance,
+		Token:    token,
+		Tags:     tags,
+	}
+
+	err = bookmarkClient(service).Check()
+	if err != nil {
+		s.renderErr("settingsBookmarksHandler", w, fmt.Sprintf("could not connect to %s: %s", instance, err), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetBookmarkService(username, service)
+	if err != nil {
+		s.renderErr("settingsBookmarksHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#bookmarks", http.StatusSeeOther)
+}
+
+// bookmarkStar creates a bookmark for a post someone just starred, if they
+// connected a bookmark service. Errors are shown in their settings.
+func (s *Site) bookmarkStar(username string, post *sqlite.Post, quote string, note string) {
+	service, err := s.db.GetBookmarkService(username)
+	if err != nil {
+		log.Printf("[err] bookmarkStar: could not get the bookmark service of '%s': %s\n", username, err)
+		return
+	}
+	if service == nil {
+		return
+	}
+
+	err = bookmarkClient(service).Add(&bookmarks.Bookmark{
+		URL:         post.URL,
+		Title:       post.Title,
+		Description: quote,
+		Notes:       note,
+		Tags:        service.Tags,
+	})
+	lastError := ""
+	if err != nil {
+		log.Printf("[err] bookmarkStar: could not bookmark post %d for '%s': %s\n", post.ID, username, err)
+		lastError = err.Error()
+	}
+
+	if lastError != service.LastError {
+		s.db.SetBookmarkServiceError(username, lastError)
+	}
+}
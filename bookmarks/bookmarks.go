@@ -0,0 +1,206 @@
+// Package bookmarks creates bookmarks in self-hosted bookmark managers:
+// linkding (https://linkding.link/api/), with an API token, and Shaarli
+// (https://shaarli.github.io/api-documentation/), with the instance's API
+// secret, which requests are signed with.
+package bookmarks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// the services bookmarks can be created in
+const (
+	Linkding = "linkding"
+	Shaarli  = "shaarli"
+)
+
+var Services = []string{Linkding, Shaarli}
+
+// max size of the response body read
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+// ErrUnauthorized is returned when a service doesn't accept the token or
+// secret it was given
+var ErrUnauthorized = errors.New("the bookmark service didn't accept these credentials")
+
+type Bookmark struct {
+	URL         string
+	Title       string
+	Description string
+	Notes       string
+	Tags        []string
+}
+
+// Client creates bookmarks in a linkding or shaarli instance
+type Client struct {
+	Service  string
+	Instance string
+
+	// the API token for linkding, the API secret for shaarli
+	Token string
+}
+
+func ValidService(service string) bool {
+	return service == Linkding || service == Shaarli
+}
+
+// NormalizeInstance turns what someone typed ("links.example.com",
+// "https://example.com/shaarli/") into the base URL of an instance
+func NormalizeInstance(instance string) (string, error) {
+	instance = strings.TrimSpace(instance)
+	if !strings.Contains(instance, "://") {
+		instance = "https://" + instance
+	}
+
+	u, err := url.Parse(instance)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || u.RawQuery != "" {
+		return "", fmt.Errorf("'%s' is not a URL", instance)
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+// ParseTags splits space or comma separated tags, dropping blanks and
+// duplicates
+func ParseTags(value string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' || r == '\n' }) {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
+// Check returns an error if the instance can't be reached or doesn't accept
+// the client's credentials
+func (c *Client) Check() error {
+	switch c.Service {
+	case Linkding:
+		return c.do(http.MethodGet, "/api/bookmarks/?limit=1", nil)
+	case Shaarli:
+		return c.do(http.MethodGet, "/api/v1/info", nil)
+	}
+	return fmt.Errorf("unknown bookmark service '%s'", c.Service)
+}
+
+// Add creates a bookmark. Linkding updates the bookmark it already has for a
+// URL, shaarli refuses duplicates, which isn't treated as an error.
+func (c *Client) Add(b *Bookmark) error {
+	tags := b.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+
+	switch c.Service {
+	case Linkding:
+		return c.do(http.MethodPost, "/api/bookmarks/", map[string]any{
+			"url":         b.URL,
+			"title":       b.Title,
+			"description": b.Description,
+			"notes":       b.Notes,
+			"tag_names":   tags,
+		})
+	case Shaarli:
+		description := b.Description
+		if b.Notes != "" {
+			if description != "" {
+				description += "\n\n"
+			}
+			description += b.Notes
+		}
+		err := c.do(http.MethodPost, "/api/v1/links", map[string]any{
+			"url":         b.URL,
+			"title":       b.Title,
+			"description": description,
+			"tags":        tags,
+			"private":     true,
+		})
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusConflict {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown bookmark service '%s'", c.Service)
+}
+
+type statusError struct {
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("returned status %d: %s", e.code, e.body)
+}
+
+func (c *Client) do(method string, path string, body any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.Instance+path, reqBody)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.Service == Shaarli {
+		req.Header.Set("Authorization", "Bearer "+ShaarliToken(c.Token, time.Now()))
+	} else {
+		req.Header.Set("Authorization", "Token "+c.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrUnauthorized
+	}
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return &statusError{code: resp.StatusCode, body: string(respBody)}
+	}
+	return nil
+}
+
+// ShaarliToken returns the JWT shaarli expects requests to be authenticated
+// with: signed with the API secret, and only valid for a few minutes after
+// it's issued
+func ShaarliToken(secret string, issuedAt time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+
+	header := encode([]byte(`{"typ":"JWT","alg":"HS512"}`))
+	payload := encode([]byte(fmt.Sprintf(`{"iat":%d}`, issuedAt.Unix())))
+
+	mac := hmac.New(sha512.New, []byte(secret))
+	mac.Write([]byte(header + "." + payload))
+	return header + "." + payload + "." + encode(mac.Sum(nil))
+}
@@ -0,0 +1,146 @@
+package bookmarks
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestShaarliToken(t *testing.T) {
+	token := ShaarliToken("secret", time.Unix(1700000000, 0))
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected a JWT, got '%s'", token)
+	}
+
+	payload, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	if string(payload) != `{"iat":1700000000}` {
+		t.Errorf("Unexpected payload '%s'", payload)
+	}
+
+	mac := hmac.New(sha512.New, []byte("secret"))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if parts[2] != base64.RawURLEncoding.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Expected the token to be signed with the secret")
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	got := strings.Join(ParseTags(" mire, reading  Mire\nblogs,"), "|")
+	if got != "mire|reading|blogs" {
+		t.Errorf("Unexpected tags '%s'", got)
+	}
+}
+
+func TestAdd(t *testing.T) {
+	var received map[string]any
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		if auth == "Token bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/bookmarks/", "/api/v1/info":
+			if r.Method == http.MethodPost {
+				json.NewDecoder(r.Body).Decode(&received)
+				w.WriteHeader(http.StatusCreated)
+			}
+		case "/api/v1/links":
+			json.NewDecoder(r.Body).Decode(&received)
+			if received["url"] == "https://example.com/duplicate" {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	bookmark := &Bookmark{
+		URL:         "https://example.com/post",
+		Title:       "A post",
+		Description: "a quote",
+		Notes:       "a note",
+		Tags:        []string{"mire"},
+	}
+
+	linkding := &Client{Service: Linkding, Instance: server.URL, Token: "token"}
+	if err := linkding.Check(); err != nil {
+		t.Errorf("Expected linkding to accept the token, got %v", err)
+	}
+	if err := (&Client{Service: Linkding, Instance: server.URL, Token: "bad"}).Check(); err != ErrUnauthorized {
+		t.Errorf("Expected linkding to refuse the token, got %v", err)
+	}
+
+	err := linkding.Add(bookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if auth != "Token token" || received["url"] != "https://example.com/post" || received["notes"] != "a note" || received["tag_names"].([]any)[0] != "mire" {
+		t.Errorf("Unexpected linkding bookmark %v (%s)", received, auth)
+	}
+
+	shaarli := &Client{Service: Shaarli, Instance: server.URL, Token: "secret"}
+	if err := shaarli.Check(); err != nil {
+		t.Errorf("Expected shaarli to accept the token, got %v", err)
+	}
+
+	err = shaarli.Add(bookmark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(auth, "Bearer ") || received["description"] != "a quote\n\na note" || received["private"] != true {
+		t.Errorf("Unexpected shaarli bookmark %v (%s)", received, auth)
+	}
+
+	if err := shaarli.Add(&Bookmark{URL: "https://example.com/duplicate"}); err != nil {
+		t.Errorf("Expected duplicates to be ignored, got %v", err)
+	}
+	if err := (&Client{Service: Linkding, Instance: server.URL + "/nope", Token: "token"}).Add(bookmark); err == nil {
+		t.Errorf("Expected an error when the instance isn't found")
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// bookmark services inside the instance's network are only reached when
+	// it allows it
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	c := &Client{Service: Linkding, Instance: server.URL, Token: "token"}
+	err := c.Check()
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
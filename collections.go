@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// collectionHandler shows one of a user's public collections
+func (s *Site) collectionHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	if !s.db.UserExists(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	collection, err := s.db.GetCollection(username, r.PathValue("collection"))
+	if err != nil {
+		s.renderErr("collectionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var subscriptions []string
+	if s.loggedIn(r) {
+		subscriptions = s.db.GetUserFeedURLs(s.username(r))
+	}
+
+	data := struct {
+		Collection        *sqlite.Collection
+		Subscriptions     []string
+		RequestingOwnPage bool
+	}{
+		Collection:        collection,
+		Subscriptions:     subscriptions,
+		RequestingOwnPage: s.username(r) == username,
+	}
+
+	s.renderPageWithTitle(w, r, "collection", collection.Name+" by "+username, data)
+}
+
+// collectionSubscribeHandler subscribes the user to every feed in a
+// collection, on top of the feeds they're already subscribed to.
+func (s *Site) collectionSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("collectionSubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := r.PathValue("username")
+	if !s.db.UserExists(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	collection, err := s.db.GetCollection(username, r.PathValue("collection"))
+	if err != nil {
+		s.renderErr("collectionSubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if collection == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.subscribeToFeeds(s.username(r), collection.FeedURLs); err != nil {
+		s.renderQuotaErr("collectionSubscribeHandler", w, err)
+		return
+	}
+
+	http.Redirect(w, r, collectionURL(collection), http.StatusSeeOther)
+}
+
+// collectionsHandler lets users manage their own collections
+func (s *Site) collectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("collectionsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	collections, err := s.db.GetUserCollections(username)
+	if err != nil {
+		s.renderErr("collectionsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Collections   []*sqlite.Collection
+		Subscriptions []string
+	}{
+		Collections:   collections,
+		Subscriptions: s.db.GetUserFeedURLs(username),
+	}
+
+	s.renderPage(w, r, "collections", data)
+}
+
+// saveCollectionHandler creates or updates one of the user's collections
+func (s *Site) saveCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("saveCollectionHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	collection := &sqlite.Collection{
+		Username:    s.username(r),
+		Slug:        strings.TrimSpace(r.FormValue("slug")),
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+
+	if !slugRegex.MatchString(collection.Slug) {
+		e := fmt.Sprintf("invalid slug '%s', use lowercase letters, numbers and dashes", collection.Slug)
+		s.renderErr("saveCollectionHandler", w, e, http.StatusBadRequest)
+		return
+	}
+	if collection.Name == "" {
+		s.renderErr("saveCollectionHandler", w, "a collection needs a name", http.StatusBadRequest)
+		return
+	}
+
+	feedURLs, err := parseFeedURLList(r.FormValue("feeds"))
+	if err != nil {
+		s.renderErr("saveCollectionHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	collection.FeedURLs = feedURLs
+
+	err = s.db.SaveCollection(collection)
+	if err != nil {
+		s.renderErr("saveCollectionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, collectionURL(collection), http.StatusSeeOther)
+}
+
+func (s *Site) deleteCollectionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("deleteCollectionHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.DeleteCollection(s.username(r), r.PathValue("slug"))
+	if err != nil {
+		s.renderErr("deleteCollectionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/collections", http.StatusSeeOther)
+}
+
+func collectionURL(c *sqlite.Collection) string {
+	return "/c/" + url.PathEscape(c.Username) + "/" + c.Slug
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	maxCommentLength     = 500
+	numModerationEntries = 100
+)
+
+// commentsEnabled reports whether comments are turned on for this instance.
+// They're on unless an admin turned them off.
+func (s *Site) commentsEnabled() bool {
+	value, err := s.db.GetSiteSetting(sqlite.SettingCommentsEnabled, "true")
+	if err != nil {
+		log.Printf("[err] commentsEnabled: %s\n", err)
+		return false
+	}
+	return value == "true"
+}
+
+func shareURL(postId int) string {
+	return fmt.Sprintf("/share/%d", postId)
+}
+
+// postCommentHandler leaves a comment on a post's share page
+func (s *Site) postCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("postCommentHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+	if !s.commentsEnabled() {
+		s.renderErr("postCommentHandler", w, "comments are disabled on this instance", http.StatusForbidden)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("postCommentHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	body := strings.TrimSpace(r.FormValue("body"))
+	if body == "" {
+		s.renderErr("postCommentHandler", w, "a comment can't be empty", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		e := fmt.Sprintf("comments can be at most %d characters long", maxCommentLength)
+		s.renderErr("postCommentHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.AddPostComment(s.username(r), postId, body)
+	if err != nil {
+		s.renderErr("postCommentHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, shareURL(postId)+"#comments", http.StatusSeeOther)
+}
+
+// deleteCommentHandler removes a comment. Users can delete their own comments
+// and admins can delete anyone's.
+func (s *Site) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("deleteCommentHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	commentId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid comment id '%s'", r.PathValue("id"))
+		s.renderErr("deleteCommentHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	comment, err := s.db.GetComment(commentId)
+	if err != nil {
+		s.renderErr("deleteCommentHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if comment == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if comment.Username != s.username(r) && !s.isAdmin(r) {
+		s.renderErr("deleteCommentHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err = s.db.DeleteComment(commentId)
+	if err != nil {
+		s.renderErr("deleteCommentHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(comment.PostID)+"#comments"), http.StatusSeeOther)
+}
+
+// adminCommentsHandler lists the latest comments on the instance so admins
+// can keep an eye on them
+func (s *Site) adminCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminCommentsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	comments, err := s.db.GetRecentComments(numModerationEntries)
+	if err != nil {
+		s.renderErr("adminCommentsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Enabled  bool
+		Comments []*sqlite.Comment
+	}{
+		Enabled:  s.commentsEnabled(),
+		Comments: comments,
+	}
+
+	s.renderPage(w, r, "admin_comments", data)
+}
+
+// adminCommentSettingsHandler turns comments on or off for the whole
+// instance. Existing comments are kept but hidden while comments are off.
+func (s *Site) adminCommentSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminCommentSettingsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	enabled := r.FormValue("enabled") == "on"
+	err := s.db.SetSiteSetting(sqlite.SettingCommentsEnabled, strconv.FormatBool(enabled))
+	if err != nil {
+		s.renderErr("adminCommentSettingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/comments", http.StatusSeeOther)
+}
+
+// adminDeleteUserCommentsHandler removes every comment left by a user, for
+// when deleting them one by one won't cut it
+func (s *Site) adminDeleteUserCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminDeleteUserCommentsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := r.PathValue("username")
+	if !s.db.UserExists(username) {
+		http.NotFound(w, r)
+		return
+	}
+
+	err := s.db.DeleteUserComments(username)
+	if err != nil {
+		s.renderErr("adminDeleteUserCommentsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/comments", http.StatusSeeOther)
+}
@@ -3,3 +3,6 @@
 package constants
 
 const DEBUG_MODE = true
+
+// public url of the instance, used wherever absolute links are needed
+const BASE_URL = "http://localhost:5544"
@@ -3,3 +3,6 @@
 package constants
 
 const DEBUG_MODE = false
+
+// public url of the instance, used wherever absolute links are needed
+const BASE_URL = "https://mire.meadow.cafe"
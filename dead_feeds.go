@@ -0,0 +1,40 @@
+package main
+
+import "net/http"
+
+// feeds that failed every fetch for deadFeedDays, and at least
+// minDeadFeedFailures times so that a feed fetched rarely isn't judged on a
+// failure or two, are probably dead
+const (
+	deadFeedDays        = 30
+	minDeadFeedFailures = 10
+)
+
+// settingsRemoveDeadFeedsHandler unsubscribes someone from every feed of
+// theirs that's probably dead. Like any unsubscribe it can be undone for a
+// while.
+func (s *Site) settingsRemoveDeadFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsRemoveDeadFeedsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	deadFeeds, err := s.db.GetDeadFeeds(username, deadFeedDays, minDeadFeedFailures)
+	if err != nil {
+		s.renderErr("settingsRemoveDeadFeedsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, feed := range deadFeeds {
+		if err := s.db.Unsubscribe(username, feed.URL); err != nil {
+			s.renderErr("settingsRemoveDeadFeedsHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.db.DeleteOrphanedPostReads(username)
+	s.removeOrphanFeeds()
+
+	http.Redirect(w, r, "/settings#subscriptions", http.StatusSeeOther)
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/mailer"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+const numDigestPosts = 30
+
+var digestTemplate = template.Must(template.New("digest").Parse(`Hi {{ .Username }}, here's what's {{ if .FavoritesOnly }}unread from your favorite feeds{{ else }}unread{{ end }} on mire {{ .Period }}:
+{{ range .Posts }}
+- {{ .Post.Title }}
+  {{ .Post.Link }}
+  {{ .Domain }}{{ with .ReadingTime }} · {{ . }}{{ end }}
+{{ end }}{{ if .More }}
+...and {{ .More }} more: {{ .BaseURL }}/u/{{ .Username }}
+{{ end }}
+--
+You get this {{ .Schedule }} because you asked for it on mire.
+Change how often: {{ .BaseURL }}/settings#email-digest
+Unsubscribe: {{ .Unsubscribe }}
+`))
+
+type digestPost struct {
+	*sqlite.UserPostEntry
+	Domain      string
+	ReadingTime string
+}
+
+// digestInterval returns how often a digest is sent on a schedule, or 0 if
+// it's not sent at all
+func digestInterval(schedule string) time.Duration {
+	switch schedule {
+	case user_preferences.DigestDaily:
+		return 24 * time.Hour
+	case user_preferences.DigestWeekly:
+		return 7 * 24 * time.Hour
+	}
+	return 0
+}
+
+func digestUnsubscribeURL(token string) string {
+	return constants.BASE_URL + "/digest/unsubscribe/" + url.PathEscape(token)
+}
+
+// digestProcess sends the digests that are due, checking every so often
+func digestProcess(ctx context.Context, s *Site) error {
+	if !s.mailer.Enabled() {
+		log.Println("digestProcess: no smtp server configured, email digests are off")
+		return nil
+	}
+
+	for {
+		sendDueDigests(s)
+		if !supervisor.Sleep(ctx, 15*time.Minute) {
+			return nil
+		}
+	}
+}
+
+func sendDueDigests(s *Site) {
+	recipients, err := s.db.GetDigestRecipients()
+	if err != nil {
+		log.Printf("[err] sendDueDigests: could not get recipients: %s\n", err)
+		return
+	}
+
+	now := time.Now()
+	for _, recipient := range recipients {
+		userPreferences := user_preferences.GetUserPreferences(s.db, s.db.GetUserID(recipient.Username))
+
+		interval := digestInterval(userPreferences.DigestSchedule)
+		if interval == 0 {
+			continue
+		}
+		// a bit of slack so that digests don't drift later and later
+		if recipient.LastSentAt != nil && now.Sub(*recipient.LastSentAt) < interval-30*time.Minute {
+			continue
+		}
+
+		err = s.sendDigest(recipient, userPreferences)
+		if err != nil {
+			log.Printf("[err] sendDueDigests: could not send the digest of '%s': %s\n", recipient.Username, err)
+			continue
+		}
+
+		err = s.db.MarkDigestSent(recipient.Username, now)
+		if err != nil {
+			log.Printf("[err] sendDueDigests: could not mark the digest of '%s' as sent: %s\n", recipient.Username, err)
+		}
+	}
+}
+
+// sendDigest emails someone their unread posts. Nothing is sent if there's
+// nothing unread.
+func (s *Site) sendDigest(recipient *sqlite.DigestRecipient, userPreferences *user_preferences.UserPreferences) error {
+	var entries []*sqlite.UserPostEntry
+	more := 0
+	if userPreferences.DigestFavoritesOnly {
+		var err error
+		entries, err = s.db.GetFavoriteUnreadPosts(recipient.Username, numDigestPosts)
+		if err != nil {
+			return err
+		}
+	} else {
+		for _, entry := range s.db.GetPostsForUser(recipient.Username, userPreferences.NumPostsToShowInHomeScreen) {
+			if entry.IsRead {
+				continue
+			}
+			if len(entries) == numDigestPosts {
+				more++
+				continue
+			}
+			entries = append(entries, entry)
+		}
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	posts := make([]*digestPost, 0, len(entries))
+	for _, entry := range entries {
+		posts = append(posts, &digestPost{
+			UserPostEntry: entry,
+			Domain:        s.printDomain(entry.Post.Link),
+			ReadingTime:   s.readingTime(entry.WordCount),
+		})
+	}
+
+	period := "today"
+	if userPreferences.DigestSchedule == user_preferences.DigestWeekly {
+		period = "this week"
+	}
+
+	var body strings.Builder
+	err := digestTemplate.Execute(&body, map[string]any{
+		"Username":      recipient.Username,
+		"FavoritesOnly": userPreferences.DigestFavoritesOnly,
+		"Period":        period,
+		"Posts":         posts,
+		"More":          more,
+		"Schedule":      userPreferences.DigestSchedule,
+		"BaseURL":       constants.BASE_URL,
+		"Unsubscribe":   digestUnsubscribeURL(recipient.UnsubscribeToken),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(&mailer.Message{
+		To:          recipient.Email,
+		Subject:     fmt.Sprintf("Your mire digest: %d unread posts", len(posts)+more),
+		Body:        body.String(),
+		Unsubscribe: digestUnsubscribeURL(recipient.UnsubscribeToken),
+	})
+}
+
+// settingsDigestHandler sets (or clears) the address digests are sent to
+func (s *Site) settingsDigestHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDigestHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	email := strings.TrimSpace(r.FormValue("email"))
+
+	var err error
+	if email == "" {
+		err = s.db.RemoveDigestEmail(username)
+	} else {
+		address, parseErr := mail.ParseAddress(email)
+		if parseErr != nil || address.Address != email {
+			s.renderErr("settingsDigestHandler", w, fmt.Sprintf("invalid email address '%s'", email), http.StatusBadRequest)
+			return
+		}
+		err = s.db.SetDigestEmail(username, email, lib.GenerateSecureToken(32))
+	}
+	if err != nil {
+		s.renderErr("settingsDigestHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#email-digest", http.StatusSeeOther)
+}
+
+// digestUnsubscribeHandler turns off someone's digests from the link in the
+// email. Visiting the link only asks for confirmation so that link scanners
+// don't unsubscribe people, mail clients use the one-click POST.
+func (s *Site) digestUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	username, err := s.db.GetUsernameByUnsubscribeToken(r.PathValue("token"))
+	if err != nil {
+		s.renderErr("digestUnsubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if username == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	unsubscribed := r.Method == http.MethodPost
+	if unsubscribed {
+		err = s.db.SaveSingleUserPreference(s.db.GetUserID(username), "digestSchedule", user_preferences.DigestOff)
+		if err != nil {
+			s.renderErr("digestUnsubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Unsubscribed bool
+	}{
+		Unsubscribed: unsubscribed,
+	}
+
+	s.renderPage(w, r, "digest_unsubscribe", data)
+}
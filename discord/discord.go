@@ -0,0 +1,105 @@
+// Package discord posts messages to Discord channels through webhooks
+// (https://discord.com/developers/docs/resources/webhook).
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// discord refuses messages with more embeds than this
+const MaxEmbeds = 10
+
+// max size of the response body read after posting
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+var webhookPathRegex = regexp.MustCompile(`^/api/webhooks/[0-9]+/[A-Za-z0-9_-]+$`)
+
+type Message struct {
+	Content string  `json:"content,omitempty"`
+	Embeds  []Embed `json:"embeds,omitempty"`
+}
+
+type Embed struct {
+	Title       string       `json:"title,omitempty"`
+	URL         string       `json:"url,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Timestamp   string       `json:"timestamp,omitempty"`
+	Color       int          `json:"color,omitempty"`
+	Author      *EmbedAuthor `json:"author,omitempty"`
+}
+
+type EmbedAuthor struct {
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+// ValidWebhookURL reports whether a URL looks like a Discord webhook, so
+// that we don't POST people's posts to arbitrary places
+func ValidWebhookURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.RawQuery != "" {
+		return false
+	}
+
+	switch u.Host {
+	case "discord.com", "discordapp.com", "ptb.discord.com", "canary.discord.com":
+	default:
+		return false
+	}
+
+	return webhookPathRegex.MatchString(u.Path)
+}
+
+// WebhookID returns the public part of a webhook URL, which is fine to show
+// around, unlike the token that follows it
+func WebhookID(webhookURL string) string {
+	parts := strings.Split(webhookURL, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[len(parts)-2]
+}
+
+// Send posts a message through a webhook
+func Send(webhookURL string, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL holds the webhook's token, keep it out of the logs
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = "discord webhook " + WebhookID(webhookURL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("discord webhook %s returned status %d", WebhookID(webhookURL), resp.StatusCode)
+	}
+	return nil
+}
+
+// Truncate shortens text to fit in one of the fields of an embed, which
+// discord limits to a number of characters
+func Truncate(text string, max int) string {
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return string(runes[:max-1]) + "…"
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/discord"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	// messages posted per webhook on every check, anything past that is
+	// mentioned in an "and N more" line so that channels don't get flooded
+	maxDiscordMessagesPerCheck = 3
+
+	maxDiscordWebhooksPerUser = 10
+
+	// mire's accent color, shown on the side of embeds
+	discordEmbedColor = 0x6b8e23
+)
+
+// sendDiscordNotifications posts the posts saved since each webhook's last
+// check, up to latestPostId
+func sendDiscordNotifications(s *Site, latestPostId int) {
+	webhooks, err := s.db.GetDiscordWebhooks()
+	if err != nil {
+		log.Printf("[err] sendDiscordNotifications: could not get webhooks: %s\n", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.LastPostID >= latestPostId {
+			continue
+		}
+
+		posts, err := s.db.GetPostsForDiscordWebhook(webhook.ID, webhook.LastPostID, latestPostId, numNotificationPostsPerCheck)
+		if err != nil {
+			log.Printf("[err] sendDiscordNotifications: could not get the posts of webhook %d: %s\n", webhook.ID, err)
+			continue
+		}
+
+		checkedUpTo := latestPostId
+		if len(posts) == numNotificationPostsPerCheck {
+			checkedUpTo = posts[len(posts)-1].ID
+		}
+
+		err = s.postToDiscord(webhook, posts)
+		if err != nil {
+			// try again on the next check, we might have been rate limited
+			log.Printf("[err] sendDiscordNotifications: could not post to webhook %d of '%s': %s\n", webhook.ID, webhook.Username, err)
+			continue
+		}
+
+		err = s.db.SetDiscordWebhookLastPostID(webhook.ID, checkedUpTo)
+		if err != nil {
+			log.Printf("[err] sendDiscordNotifications: could not save progress for webhook %d: %s\n", webhook.ID, err)
+		}
+	}
+}
+
+// postToDiscord posts new posts as embeds, a handful per message
+func (s *Site) postToDiscord(webhook *sqlite.DiscordWebhook, posts []*sqlite.NotificationPost) error {
+	var embeds []discord.Embed
+	for _, post := range posts {
+		embed := discord.Embed{
+			Title: discord.Truncate(post.Title, 256),
+			URL:   post.URL,
+			Color: discordEmbedColor,
+			Author: &discord.EmbedAuthor{
+				Name: discord.Truncate(s.feedTitleOrDomain(post.FeedURL), 256),
+				URL:  constants.BASE_URL + "/feeds/" + url.QueryEscape(post.FeedURL),
+			},
+		}
+		if !post.PublishedDatetime.IsZero() {
+			embed.Timestamp = post.PublishedDatetime.UTC().Format(time.RFC3339)
+		}
+		embeds = append(embeds, embed)
+	}
+
+	for sent := 0; len(embeds) > 0; sent++ {
+		if sent == maxDiscordMessagesPerCheck {
+			return discord.Send(webhook.WebhookURL, &discord.Message{
+				Content: fmt.Sprintf("...and %d more new posts", len(embeds)),
+			})
+		}
+
+		n := min(len(embeds), discord.MaxEmbeds)
+		err := discord.Send(webhook.WebhookURL, &discord.Message{Embeds: embeds[:n]})
+		if err != nil {
+			return err
+		}
+		embeds = embeds[n:]
+	}
+
+	return nil
+}
+
+// settingsDiscordHandler adds a webhook for all the user's subscriptions or
+// for one of their collections, replacing the one it had
+func (s *Site) settingsDiscordHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDiscordHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	webhookURL := strings.TrimSpace(r.FormValue("webhook"))
+	if !discord.ValidWebhookURL(webhookURL) {
+		s.renderErr("settingsDiscordHandler", w, "that doesn't look like a discord webhook URL", http.StatusBadRequest)
+		return
+	}
+
+	collectionSlug := r.FormValue("collection")
+	if collectionSlug != "" {
+		collection, err := s.db.GetCollection(username, collectionSlug)
+		if err != nil {
+			s.renderErr("settingsDiscordHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if collection == nil {
+			s.renderErr("settingsDiscordHandler", w, fmt.Sprintf("no collection named '%s'", collectionSlug), http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhooks, err := s.db.GetUserDiscordWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsDiscordHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// replacing the webhook of a collection doesn't count as adding one
+	replacing := false
+	for _, webhook := range webhooks {
+		replacing = replacing || webhook.CollectionSlug == collectionSlug
+	}
+	if !replacing && len(webhooks) >= maxDiscordWebhooksPerUser {
+		e := fmt.Sprintf("you can have at most %d discord webhooks", maxDiscordWebhooksPerUser)
+		s.renderErr("settingsDiscordHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetDiscordWebhook(username, webhookURL, collectionSlug)
+	if err != nil {
+		s.renderErr("settingsDiscordHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#discord", http.StatusSeeOther)
+}
+
+func (s *Site) settingsDeleteDiscordHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDeleteDiscordHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid webhook id '%s'", r.PathValue("id"))
+		s.renderErr("settingsDeleteDiscordHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveDiscordWebhook(s.username(r), id)
+	if err != nil {
+		s.renderErr("settingsDeleteDiscordHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#discord", http.StatusSeeOther)
+}
@@ -0,0 +1,194 @@
+// Package epub writes simple EPUB 3 books made of a list of html chapters,
+// enough for e-readers (Kindles included) to read posts offline.
+package epub
+
+import (
+	"archive/zip"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type Chapter struct {
+	Title string
+
+	// html body of the chapter, it's sanitized into xhtml when the book is
+	// written
+	Body string
+}
+
+type Book struct {
+	// unique identifier of the book, eg. "urn:mire:alice:20240101"
+	ID       string
+	Title    string
+	Author   string
+	Language string
+	Chapters []Chapter
+}
+
+var funcs = template.FuncMap{
+	"x": html.EscapeString,
+	"add": func(a int, b int) int {
+		return a + b
+	},
+}
+
+var containerXML = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+var packageTemplate = template.Must(template.New("opf").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:identifier id="book-id">{{ x .Book.ID }}</dc:identifier>
+    <dc:title>{{ x .Book.Title }}</dc:title>
+    <dc:creator>{{ x .Book.Author }}</dc:creator>
+    <dc:language>{{ x .Book.Language }}</dc:language>
+    <meta property="dcterms:modified">{{ .Modified }}</meta>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    {{- range $i, $c := .Book.Chapters }}
+    <item id="chapter-{{ add $i 1 }}" href="chapter-{{ add $i 1 }}.xhtml" media-type="application/xhtml+xml"/>
+    {{- end }}
+  </manifest>
+  <spine toc="ncx">
+    {{- range $i, $c := .Book.Chapters }}
+    <itemref idref="chapter-{{ add $i 1 }}"/>
+    {{- end }}
+  </spine>
+</package>
+`))
+
+var navTemplate = template.Must(template.New("nav").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>{{ x .Title }}</title></head>
+<body>
+  <nav epub:type="toc">
+    <h1>{{ x .Title }}</h1>
+    <ol>
+      {{- range $i, $c := .Chapters }}
+      <li><a href="chapter-{{ add $i 1 }}.xhtml">{{ x $c.Title }}</a></li>
+      {{- end }}
+    </ol>
+  </nav>
+</body>
+</html>
+`))
+
+// EPUB 2 table of contents, older readers (and Kindles) still look for it
+var ncxTemplate = template.Must(template.New("ncx").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <head><meta name="dtb:uid" content="{{ x .ID }}"/></head>
+  <docTitle><text>{{ x .Title }}</text></docTitle>
+  <navMap>
+    {{- range $i, $c := .Chapters }}
+    <navPoint id="chapter-{{ add $i 1 }}" playOrder="{{ add $i 1 }}">
+      <navLabel><text>{{ x $c.Title }}</text></navLabel>
+      <content src="chapter-{{ add $i 1 }}.xhtml"/>
+    </navPoint>
+    {{- end }}
+  </navMap>
+</ncx>
+`))
+
+var chapterTemplate = template.Must(template.New("chapter").Funcs(funcs).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml">
+<head><title>{{ x .Title }}</title></head>
+<body>
+<h1>{{ x .Title }}</h1>
+<div>{{ .Body }}</div>
+</body>
+</html>
+`))
+
+// Write writes the book to w as an epub file
+func Write(w io.Writer, book *Book) error {
+	z := zip.NewWriter(w)
+
+	// the mimetype has to be the first file and can't be compressed
+	mimetype, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(mimetype, "application/epub+zip")
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(z, "META-INF/container.xml", func(w io.Writer) error {
+		_, err := io.WriteString(w, containerXML)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(z, "OEBPS/content.opf", func(w io.Writer) error {
+		return packageTemplate.Execute(w, map[string]any{
+			"Book":     book,
+			"Modified": time.Now().UTC().Format("2006-01-02T15:04:05Z"),
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(z, "OEBPS/nav.xhtml", func(w io.Writer) error {
+		return navTemplate.Execute(w, book)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = writeFile(z, "OEBPS/toc.ncx", func(w io.Writer) error {
+		return ncxTemplate.Execute(w, book)
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, chapter := range book.Chapters {
+		body, err := Sanitize(chapter.Body)
+		if err != nil {
+			return err
+		}
+
+		err = writeFile(z, fmt.Sprintf("OEBPS/chapter-%d.xhtml", i+1), func(w io.Writer) error {
+			return chapterTemplate.Execute(w, map[string]string{"Title": chapter.Title, "Body": body})
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return z.Close()
+}
+
+func writeFile(z *zip.Writer, name string, write func(w io.Writer) error) error {
+	w, err := z.Create(name)
+	if err != nil {
+		return err
+	}
+	return write(w)
+}
+
+// xmlText escapes text for xhtml, dropping the control characters xml
+// doesn't allow
+func xmlText(text string) string {
+	text = strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' && r != '\n' && r != '\r' {
+			return -1
+		}
+		return r
+	}, text)
+	return html.EscapeString(text)
+}
@@ -0,0 +1,98 @@
+package epub
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	book := &Book{
+		ID:       "urn:mire:test",
+		Title:    "Unread <posts>",
+		Author:   "mire",
+		Language: "en",
+		Chapters: []Chapter{
+			{Title: "First & foremost", Body: "<p>hello <b>world</b><br></p>"},
+			{Title: "Second", Body: "<div>unclosed <p>tags"},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := Write(&buf, book)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if z.File[0].Name != "mimetype" || z.File[0].Method != zip.Store {
+		t.Errorf("Expected an uncompressed mimetype to be the first file, got %s", z.File[0].Name)
+	}
+
+	files := make(map[string]string)
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, _ := io.ReadAll(r)
+		r.Close()
+		files[f.Name] = string(content)
+
+		if f.Name == "mimetype" {
+			continue
+		}
+
+		// every other file has to be well formed xml
+		d := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			_, err := d.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s is not well formed: %s\n%s", f.Name, err, content)
+			}
+		}
+	}
+
+	for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/toc.ncx", "OEBPS/chapter-1.xhtml", "OEBPS/chapter-2.xhtml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("Expected the book to contain %s", name)
+		}
+	}
+
+	if !strings.Contains(files["OEBPS/chapter-1.xhtml"], "hello <b>world</b><br/>") {
+		t.Errorf("Expected the first chapter's body, got %s", files["OEBPS/chapter-1.xhtml"])
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	cases := map[string]string{
+		`<p onclick="evil()">hi</p>`:                   `<p>hi</p>`,
+		`<script>alert(1)</script>text`:                `text`,
+		`<a href="javascript:alert(1)">x</a>`:          `<a>x</a>`,
+		`<a href="https://example.com/?a=1&b=2">x</a>`: `<a href="https://example.com/?a=1&amp;b=2">x</a>`,
+		`<span>un<i>wrapped</i></span>`:                `un<i>wrapped</i>`,
+		`<img src="cat.png" alt="a cat">`:              `[a cat]`,
+		`a<br>b<hr>`:                                   `a<br/>b<hr/>`,
+		"bad \x01 char":                                `bad  char`,
+	}
+
+	for in, expected := range cases {
+		got, err := Sanitize(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expected {
+			t.Errorf("Sanitize(%q) = %q, expected %q", in, got, expected)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package epub
+
+import (
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// elements kept as they are, everything else is either unwrapped (only its
+// children are kept) or dropped altogether
+var allowedElements = map[atom.Atom]bool{
+	atom.P: true, atom.Br: true, atom.Hr: true, atom.A: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Em: true, atom.I: true, atom.Strong: true, atom.B: true, atom.U: true, atom.S: true,
+	atom.Sub: true, atom.Sup: true, atom.Small: true, atom.Mark: true,
+	atom.Ul: true, atom.Ol: true, atom.Li: true, atom.Dl: true, atom.Dt: true, atom.Dd: true,
+	atom.Blockquote: true, atom.Pre: true, atom.Code: true, atom.Kbd: true, atom.Q: true, atom.Cite: true,
+	atom.Figure: true, atom.Figcaption: true,
+	atom.Table: true, atom.Thead: true, atom.Tbody: true, atom.Tfoot: true, atom.Tr: true, atom.Th: true, atom.Td: true,
+}
+
+// elements dropped along with everything inside them
+var droppedElements = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Iframe: true, atom.Object: true, atom.Embed: true,
+	atom.Form: true, atom.Svg: true, atom.Math: true, atom.Noscript: true, atom.Template: true,
+	atom.Video: true, atom.Audio: true, atom.Canvas: true, atom.Button: true, atom.Input: true,
+	atom.Select: true, atom.Textarea: true, atom.Head: true, atom.Title: true,
+}
+
+var voidElements = map[atom.Atom]bool{atom.Br: true, atom.Hr: true}
+
+// Sanitize turns an html fragment from a feed into xhtml safe to put in a
+// book. Only basic formatting and links are kept, images are replaced by
+// their alt text since the book has to work offline.
+func Sanitize(fragment string) (string, error) {
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(fragment), context)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		writeNode(&b, n)
+	}
+	return b.String(), nil
+}
+
+func writeNode(b *strings.Builder, n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		b.WriteString(xmlText(n.Data))
+		return
+	case html.ElementNode:
+	default:
+		return
+	}
+
+	if droppedElements[n.DataAtom] {
+		return
+	}
+
+	if n.DataAtom == atom.Img {
+		for _, attr := range n.Attr {
+			if attr.Key == "alt" && strings.TrimSpace(attr.Val) != "" {
+				b.WriteString("[" + xmlText(attr.Val) + "]")
+			}
+		}
+		return
+	}
+
+	if !allowedElements[n.DataAtom] {
+		writeChildren(b, n)
+		return
+	}
+
+	b.WriteString("<" + n.Data)
+	if n.DataAtom == atom.A {
+		for _, attr := range n.Attr {
+			if attr.Key == "href" && isSafeLink(attr.Val) {
+				b.WriteString(` href="` + xmlText(attr.Val) + `"`)
+			}
+		}
+	}
+
+	if voidElements[n.DataAtom] {
+		b.WriteString("/>")
+		return
+	}
+
+	b.WriteString(">")
+	writeChildren(b, n)
+	b.WriteString("</" + n.Data + ">")
+}
+
+func writeChildren(b *strings.Builder, n *html.Node) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		writeNode(b, c)
+	}
+}
+
+func isSafeLink(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	return u.Scheme == "http" || u.Scheme == "https" || u.Scheme == "mailto"
+}
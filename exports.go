@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/mail"
+	"slices"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/epub"
+	"codeberg.org/meadowingc/mire/mailer"
+	"codeberg.org/meadowingc/mire/reaper"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+const numExportedPosts = 50
+
+var errNothingUnread = errors.New("there's nothing unread to export")
+
+// unreadBook bundles someone's oldest unread posts into an ebook. Posts get
+// whatever content their feed provides, feeds that only publish links get a
+// link.
+func (s *Site) unreadBook(username string) (*epub.Book, error) {
+	userPreferences := user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username))
+
+	var chapters []epub.Chapter
+	posts := s.db.GetPostsForUser(username, userPreferences.NumPostsToShowInHomeScreen)
+	// posts come newest first, the book reads like the unread queue: oldest
+	// first
+	slices.Reverse(posts)
+	for _, entry := range posts {
+		if entry.IsRead {
+			continue
+		}
+		if len(chapters) == numExportedPosts {
+			break
+		}
+
+		link := html.EscapeString(entry.Post.Link)
+		body := fmt.Sprintf(`<p><a href="%s">%s</a>`, link, html.EscapeString(s.printDomain(entry.Post.Link)))
+		if entry.Post.PublishedParsed != nil {
+			body += " · " + entry.Post.PublishedParsed.Format("January 2, 2006")
+		}
+		body += "</p>"
+
+		if item := s.reaper.GetItem(entry.FeedURL, entry.Post.Link); item != nil && strings.TrimSpace(reaper.ItemBody(item)) != "" {
+			body += reaper.ItemBody(item)
+		} else {
+			body += fmt.Sprintf(`<p>This feed doesn't include the post itself, read it at <a href="%s">%s</a>.</p>`, link, link)
+		}
+
+		chapters = append(chapters, epub.Chapter{Title: entry.Post.Title, Body: body})
+	}
+
+	if len(chapters) == 0 {
+		return nil, errNothingUnread
+	}
+
+	return &epub.Book{
+		ID:       fmt.Sprintf("urn:mire:%s:%d", username, time.Now().Unix()),
+		Title:    "Unread on mire, " + time.Now().Format("January 2, 2006"),
+		Author:   "mire",
+		Language: "en",
+		Chapters: chapters,
+	}, nil
+}
+
+func (s *Site) renderUnreadBook(username string) ([]byte, error) {
+	book, err := s.unreadBook(username)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	err = epub.Write(&buf, book)
+	return buf.Bytes(), err
+}
+
+func unreadBookFilename() string {
+	return "mire-unread-" + time.Now().Format("2006-01-02") + ".epub"
+}
+
+// exportUnreadHandler downloads the unread queue as an epub
+func (s *Site) exportUnreadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("exportUnreadHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	book, err := s.renderUnreadBook(s.username(r))
+	if err == errNothingUnread {
+		s.renderErr("exportUnreadHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("exportUnreadHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/epub+zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+unreadBookFilename()+`"`)
+	w.Write(book)
+}
+
+// sendToKindleHandler emails the unread queue as an epub to the user's
+// kindle address
+func (s *Site) sendToKindleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("sendToKindleHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+	if !s.mailer.Enabled() {
+		s.renderErr("sendToKindleHandler", w, "this instance isn't set up to send emails", http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	address, err := s.db.GetKindleAddress(username)
+	if err != nil {
+		s.renderErr("sendToKindleHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if address == "" {
+		s.renderErr("sendToKindleHandler", w, "set your kindle address first", http.StatusBadRequest)
+		return
+	}
+
+	book, err := s.renderUnreadBook(username)
+	if err == errNothingUnread {
+		s.renderErr("sendToKindleHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("sendToKindleHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.mailer.Send(&mailer.Message{
+		To:      address,
+		Subject: "Unread on mire",
+		Body:    "Your unread posts are attached.",
+		Attachments: []*mailer.Attachment{
+			{Filename: unreadBookFilename(), ContentType: "application/epub+zip", Data: book},
+		},
+	})
+	if err != nil {
+		s.renderErr("sendToKindleHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/settings#export"), http.StatusSeeOther)
+}
+
+// settingsKindleHandler sets (or clears) the address ebooks are emailed to
+func (s *Site) settingsKindleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsKindleHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	email := strings.TrimSpace(r.FormValue("email"))
+
+	var err error
+	if email == "" {
+		err = s.db.RemoveKindleAddress(username)
+	} else {
+		address, parseErr := mail.ParseAddress(email)
+		if parseErr != nil || address.Address != email {
+			s.renderErr("settingsKindleHandler", w, fmt.Sprintf("invalid email address '%s'", email), http.StatusBadRequest)
+			return
+		}
+		err = s.db.SetKindleAddress(username, email)
+	}
+	if err != nil {
+		s.renderErr("settingsKindleHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#export", http.StatusSeeOther)
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/autodiscovery"
+	"codeberg.org/meadowingc/mire/fediverse"
+	"codeberg.org/meadowingc/mire/reaper"
+	"codeberg.org/meadowingc/mire/youtube"
+)
+
+// at most this many feeds found in a page by the extension are looked at
+const maxExtensionFeeds = 10
+
+// pageFeedEntry is a feed of the page someone is on, as the browser extension
+// and the bookmarklet show it
+type pageFeedEntry struct {
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	Subscribed bool   `json:"subscribed"`
+	Comments   bool   `json:"comments,omitempty"`
+}
+
+// pageURLParam returns the page the extension or bookmarklet is asking about
+func pageURLParam(r *http.Request) (string, error) {
+	pageURL := strings.TrimSpace(r.FormValue("url"))
+	u, err := url.ParseRequestURI(pageURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("'%s' is not the URL of a web page", pageURL)
+	}
+	if err := reaper.CheckFeedTarget(pageURL); err != nil {
+		return "", err
+	}
+	return pageURL, nil
+}
+
+// pageFeeds returns the feeds of a page: the ones the extension found in it
+// (it can read pages mire can't fetch), or else the ones mire finds itself
+func (s *Site) pageFeeds(pageURL string, found []string) ([]autodiscovery.Feed, error) {
+	var feeds []autodiscovery.Feed
+	for _, feedURL := range found {
+		u, err := url.ParseRequestURI(strings.TrimSpace(feedURL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			continue
+		}
+		feeds = append(feeds, autodiscovery.Feed{URL: u.String()})
+		if len(feeds) == maxExtensionFeeds {
+			break
+		}
+	}
+	if len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	if s.reaper.HasFeed(pageURL) {
+		return []autodiscovery.Feed{{URL: pageURL}}, nil
+	}
+
+	// youtube channels and fediverse accounts have feeds they don't link to
+	if youtube.IsYouTubeURL(pageURL) || fediverse.IsAccount(pageURL) {
+		feedURL, err := resolveFeedURL(pageURL)
+		if err != nil {
+			return nil, err
+		}
+		return []autodiscovery.Feed{{URL: feedURL}}, nil
+	}
+
+	return autodiscovery.Find(pageURL)
+}
+
+// pageFeedEntries tells which of a page's feeds someone is subscribed to
+func (s *Site) pageFeedEntries(username string, feeds []autodiscovery.Feed) []pageFeedEntry {
+	subscriptions := s.db.GetUserFeedURLs(username)
+
+	entries := []pageFeedEntry{}
+	for _, feed := range feeds {
+		title := s.feedTitle(feed.URL)
+		if title == "" {
+			title = feed.Title
+		}
+		entries = append(entries, pageFeedEntry{
+			URL:        feed.URL,
+			Title:      title,
+			Subscribed: slices.Contains(subscriptions, feed.URL),
+			Comments:   feed.IsComments(),
+		})
+	}
+	return entries
+}
+
+// pickPageFeed returns the feed of a page to offer first: the first one not
+// subscribed to yet that isn't only comments, or else the first one not
+// subscribed to yet. It's empty when they're all subscribed to already.
+func pickPageFeed(entries []pageFeedEntry) string {
+	picked := ""
+	for _, entry := range entries {
+		if entry.Subscribed {
+			continue
+		}
+		if !entry.Comments {
+			return entry.URL
+		}
+		if picked == "" {
+			picked = entry.URL
+		}
+	}
+	return picked
+}
+
+// apiExtensionPageHandler tells the browser extension which feeds the page
+// someone is on has, and whether they're subscribed to them
+func (s *Site) apiExtensionPageHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiExtensionPageHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	pageURL, err := pageURLParam(r)
+	if err != nil {
+		s.renderErr("apiExtensionPageHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	feeds, err := s.pageFeeds(pageURL, r.Form["feed"])
+	if err != nil {
+		s.renderErr("apiExtensionPageHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	entries := s.pageFeedEntries(s.username(r), feeds)
+	subscribed := slices.ContainsFunc(entries, func(feed pageFeedEntry) bool { return feed.Subscribed })
+
+	s.renderJSON(w, struct {
+		URL        string          `json:"url"`
+		Feeds      []pageFeedEntry `json:"feeds"`
+		Subscribed bool            `json:"subscribed"`
+	}{
+		URL:        pageURL,
+		Feeds:      entries,
+		Subscribed: subscribed,
+	})
+}
+
+// apiExtensionSubscribeHandler subscribes someone to the page they're on: to
+// the feed they picked, or else to the first one the page has
+func (s *Site) apiExtensionSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiExtensionSubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var feedURL string
+	if picked := strings.TrimSpace(r.FormValue("feed")); picked != "" {
+		resolved, err := resolveFeedURL(picked)
+		if err != nil {
+			s.renderErr("apiExtensionSubscribeHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		feedURL = resolved
+	} else {
+		pageURL, err := pageURLParam(r)
+		if err != nil {
+			s.renderErr("apiExtensionSubscribeHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		feeds, err := s.pageFeeds(pageURL, nil)
+		if err != nil {
+			s.renderErr("apiExtensionSubscribeHandler", w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		if len(feeds) == 0 {
+			s.renderErr("apiExtensionSubscribeHandler", w, "this page doesn't have a feed", http.StatusNotFound)
+			return
+		}
+
+		// with more than one feed, which one is up to them
+		if len(feeds) > 1 {
+			entries := s.pageFeedEntries(s.username(r), feeds)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusMultipleChoices)
+			s.renderJSON(w, struct {
+				URL    string          `json:"url"`
+				Feeds  []pageFeedEntry `json:"feeds"`
+				Picked string          `json:"picked,omitempty"`
+			}{
+				URL:    pageURL,
+				Feeds:  entries,
+				Picked: pickPageFeed(entries),
+			})
+			return
+		}
+		feedURL = feeds[0].URL
+	}
+
+	username := s.username(r)
+	if err := s.subscribeToFeeds(username, []string{feedURL}); err != nil {
+		s.renderQuotaErr("apiExtensionSubscribeHandler", w, err)
+		return
+	}
+
+	fetchErr, err := s.db.GetFeedFetchError(feedURL)
+	if err != nil {
+		s.renderErr("apiExtensionSubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		Feed       pageFeedEntry `json:"feed"`
+		FetchError string        `json:"fetch_error,omitempty"`
+	}{
+		Feed:       s.pageFeedEntries(username, []autodiscovery.Feed{{URL: feedURL}})[0],
+		FetchError: fetchErr,
+	})
+}
+
+// apiExtensionReadLaterHandler saves the page someone is on to the read later
+// services they connected (instapaper, wallabag)
+func (s *Site) apiExtensionReadLaterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiExtensionReadLaterHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	pageURL, err := pageURLParam(r)
+	if err != nil {
+		s.renderErr("apiExtensionReadLaterHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	title := strings.TrimSpace(r.FormValue("title"))
+
+	username := s.username(r)
+	savedTo := []string{}
+	var saveErrors []string
+	for _, service := range []struct {
+		name         string
+		save         func(string, string, string) error
+		notConnected error
+	}{
+		{"instapaper", s.saveToInstapaper, errInstapaperNotConnected},
+		{"wallabag", s.saveToWallabag, errWallabagNotConnected},
+	} {
+		err := service.save(username, pageURL, title)
+		if errors.Is(err, service.notConnected) {
+			continue
+		}
+		if err != nil {
+			saveErrors = append(saveErrors, fmt.Sprintf("%s: %s", service.name, err))
+			continue
+		}
+		savedTo = append(savedTo, service.name)
+	}
+
+	if len(savedTo) == 0 && len(saveErrors) == 0 {
+		s.renderErr("apiExtensionReadLaterHandler", w, "connect instapaper or wallabag in your settings to save pages to read later", http.StatusBadRequest)
+		return
+	}
+	if len(savedTo) == 0 {
+		s.renderErr("apiExtensionReadLaterHandler", w, strings.Join(saveErrors, "\n"), http.StatusBadGateway)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		SavedTo []string `json:"saved_to"`
+		Errors  []string `json:"errors,omitempty"`
+	}{
+		SavedTo: savedTo,
+		Errors:  saveErrors,
+	})
+}
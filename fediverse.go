@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"codeberg.org/meadowingc/mire/fediverse"
+)
+
+// fediverseFeed is what the page of a fediverse account's feed says about it
+type fediverseFeed struct {
+	Account *fediverse.Account
+
+	// whether the feed has the account's replies, boosts are never there
+	Replies bool
+
+	// whether the viewer is subscribed, and so can switch feeds
+	Subscribed bool
+}
+
+// getFediverseFeed returns what to show about a feed that's a fediverse
+// account, or nil if it isn't one
+func (s *Site) getFediverseFeed(r *http.Request, feedURL string) *fediverseFeed {
+	account, replies, ok := fediverse.ParseFeedURL(feedURL)
+	if !ok {
+		return nil
+	}
+
+	return &fediverseFeed{
+		Account:    account,
+		Replies:    replies,
+		Subscribed: s.loggedIn(r) && slices.Contains(s.db.GetUserFeedURLs(s.username(r)), feedURL),
+	}
+}
+
+// feedFediverseHandler switches someone's subscription to a fediverse account
+// between its feed with replies and the one without
+func (s *Site) feedFediverseHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedFediverseHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedFediverseHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, _, ok := fediverse.ParseFeedURL(feedURL)
+	if !ok {
+		s.renderErr("feedFediverseHandler", w, "this feed isn't a fediverse account", http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	if !slices.Contains(s.db.GetUserFeedURLs(username), feedURL) {
+		s.renderErr("feedFediverseHandler", w, "you're not subscribed to this feed", http.StatusBadRequest)
+		return
+	}
+
+	newFeedURL := s.db.KnownFeedURL(account.FeedURL(r.FormValue("replies") == "on"))
+	if newFeedURL == feedURL {
+		http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+		return
+	}
+
+	// not every server has a feed with replies, don't switch to one that
+	// can't be fetched
+	known := s.reaper.HasFeed(newFeedURL)
+	if err := s.registerFeeds([]string{newFeedURL}); err != nil {
+		s.renderQuotaErr("feedFediverseHandler", w, err)
+		return
+	}
+	if !known {
+		fetchErr, err := s.db.GetFeedFetchError(newFeedURL)
+		if err == nil && fetchErr != "" {
+			s.removeOrphanFeeds()
+			e := fmt.Sprintf("could not fetch the feed of %s at '%s': %s", account.Handle(), newFeedURL, fetchErr)
+			s.renderErr("feedFediverseHandler", w, e, http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = s.db.MoveSubscription(username, feedURL, newFeedURL)
+	if err != nil {
+		s.renderErr("feedFediverseHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.db.DeleteOrphanedPostReads(username)
+	s.removeOrphanFeeds()
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(newFeedURL), http.StatusSeeOther)
+}
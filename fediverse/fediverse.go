@@ -0,0 +1,195 @@
+// Package fediverse finds the RSS feed of fediverse accounts from their
+// profile URL or their @user@instance handle. Mastodon (and the servers that
+// copy its URLs) publishes one at https://instance/@user.rss, without boosts
+// or replies, and one with replies at /@user/with_replies.rss.
+package fediverse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/autodiscovery"
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// max size of the webfinger documents read
+const maxResponseSize = 1 << 20
+
+const profilePageRel = "http://webfinger.net/rel/profile-page"
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+// swapped in tests for servers that don't speak https
+var scheme = "https"
+
+var (
+	handleRegexp   = regexp.MustCompile(`^@([\w.-]+)@([\w-]+(?:\.[\w-]+)+(?::\d+)?|localhost:\d+)$`)
+	usernameRegexp = regexp.MustCompile(`^[\w.-]+$`)
+	feedPathRegexp = regexp.MustCompile(`^/@([\w.-]+)(/with_replies)?\.rss$`)
+)
+
+// Account is a fediverse account, on the instance that hosts it
+type Account struct {
+	Username string
+	Instance string
+}
+
+// Handle returns the @user@instance handle of an account
+func (a *Account) Handle() string {
+	return "@" + a.Username + "@" + a.Instance
+}
+
+// ProfileURL returns the mastodon style profile URL of an account
+func (a *Account) ProfileURL() string {
+	return scheme + "://" + a.Instance + "/@" + a.Username
+}
+
+// FeedURL returns the mastodon style feed of an account, with or without its
+// replies. Boosts are never in it.
+func (a *Account) FeedURL(withReplies bool) string {
+	if withReplies {
+		return a.ProfileURL() + "/with_replies.rss"
+	}
+	return a.ProfileURL() + ".rss"
+}
+
+// ParseHandle parses a "@user@instance" handle
+func ParseHandle(handle string) (*Account, bool) {
+	match := handleRegexp.FindStringSubmatch(strings.TrimSpace(handle))
+	if match == nil {
+		return nil, false
+	}
+	return &Account{Username: match[1], Instance: strings.ToLower(match[2])}, true
+}
+
+// ParseProfileURL parses the URL of a profile page, https://instance/@user,
+// including the ones instances show for accounts of other instances
+// (https://instance/@user@other.instance)
+func ParseProfileURL(rawURL string) (*Account, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, false
+	}
+
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasPrefix(path, "/@") || strings.Contains(path[1:], "/") || feedPathRegexp.MatchString(path) {
+		return nil, false
+	}
+
+	if account, ok := ParseHandle(path[1:]); ok {
+		return account, true
+	}
+	if !usernameRegexp.MatchString(path[2:]) {
+		return nil, false
+	}
+	return &Account{Username: path[2:], Instance: strings.ToLower(u.Host)}, true
+}
+
+// ParseFeedURL tells whether a feed is the mastodon style feed of an account,
+// and whether it has its replies
+func ParseFeedURL(feedURL string) (*Account, bool, bool) {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Host == "" || u.RawQuery != "" {
+		return nil, false, false
+	}
+
+	match := feedPathRegexp.FindStringSubmatch(u.Path)
+	if match == nil {
+		return nil, false, false
+	}
+	return &Account{Username: match[1], Instance: strings.ToLower(u.Host)}, match[2] != "", true
+}
+
+// IsAccount reports whether something someone pasted is a fediverse handle or
+// profile URL
+func IsAccount(input string) bool {
+	if _, ok := ParseHandle(input); ok {
+		return true
+	}
+	_, ok := ParseProfileURL(input)
+	return ok
+}
+
+// ResolveFeedURL returns the feed of the account a handle or profile URL
+// points to: the one its profile page links to, or the mastodon style one.
+func ResolveFeedURL(input string) (string, error) {
+	input = strings.TrimSpace(input)
+
+	profileURL := input
+	account, isHandle := ParseHandle(input)
+	if !isHandle {
+		var ok bool
+		account, ok = ParseProfileURL(input)
+		if !ok {
+			return "", fmt.Errorf("'%s' is not a fediverse account", input)
+		}
+		// instances show the profiles of accounts of other instances, their
+		// feed is on their own instance
+		isHandle = strings.Count(input, "@") > 1
+	}
+
+	if isHandle {
+		var err error
+		profileURL, err = WebFinger(account)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if feeds, err := autodiscovery.Find(profileURL); err == nil && len(feeds) > 0 {
+		return feeds[0].URL, nil
+	}
+	return strings.TrimSuffix(profileURL, "/") + ".rss", nil
+}
+
+type webFingerResponse struct {
+	Links []struct {
+		Rel  string `json:"rel"`
+		Type string `json:"type"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+// WebFinger looks an account up on its instance and returns its profile page
+func WebFinger(account *Account) (string, error) {
+	endpoint := scheme + "://" + account.Instance + "/.well-known/webfinger?resource=" +
+		url.QueryEscape("acct:"+account.Username+"@"+account.Instance)
+
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/jrd+json, application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("there's no %s account", account.Handle())
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s returned status %d looking up %s", account.Instance, resp.StatusCode, account.Handle())
+	}
+
+	var response webFingerResponse
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&response)
+	if err != nil {
+		return "", err
+	}
+
+	for _, link := range response.Links {
+		if link.Rel == profilePageRel && strings.HasPrefix(link.Href, "http") {
+			return link.Href, nil
+		}
+	}
+	return account.ProfileURL(), nil
+}
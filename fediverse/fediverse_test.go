@@ -0,0 +1,119 @@
+package fediverse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestParseHandle(t *testing.T) {
+	for input, expected := range map[string]string{
+		"@alice@example.social":   "alice@example.social",
+		" @Bob.B@Social.Example ": "Bob.B@social.example",
+		"alice@example.social":    "",
+		"@alice":                  "",
+		"@alice@localhost":        "",
+		"@al ice@example.social":  "",
+	} {
+		account, ok := ParseHandle(input)
+		got := ""
+		if ok {
+			got = account.Username + "@" + account.Instance
+		}
+		if got != expected {
+			t.Errorf("Expected '%s' to be '%s', got '%s'", input, expected, got)
+		}
+	}
+}
+
+func TestParseProfileURL(t *testing.T) {
+	for input, expected := range map[string]string{
+		"https://example.social/@alice":                    "alice@example.social",
+		"https://example.social/@alice/":                   "alice@example.social",
+		"https://example.social/@bob@other.example":        "bob@other.example",
+		"https://example.social/@alice/109876543210":       "",
+		"https://example.social/users/alice":               "",
+		"https://example.social/":                          "",
+		"mailto:alice@example.social":                      "",
+		"https://example.social/@alice?tab=media":          "alice@example.social",
+		"https://example.social/@alice/with_replies.rss":   "",
+		"https://example.social/@alice.rss":                "",
+		"https://example.social/@al%20ice":                 "",
+		"https://example.social/@alice@other.example/feed": "",
+	} {
+		account, ok := ParseProfileURL(input)
+		got := ""
+		if ok {
+			got = account.Username + "@" + account.Instance
+		}
+		if got != expected {
+			t.Errorf("Expected '%s' to be '%s', got '%s'", input, expected, got)
+		}
+	}
+}
+
+func TestParseFeedURL(t *testing.T) {
+	account, replies, ok := ParseFeedURL("https://example.social/@alice/with_replies.rss")
+	if !ok || !replies || account.Handle() != "@alice@example.social" {
+		t.Errorf("Expected alice's feed with replies, got %+v %v %v", account, replies, ok)
+	}
+
+	account, replies, ok = ParseFeedURL("https://example.social/@alice.rss")
+	if !ok || replies || account.FeedURL(true) != "https://example.social/@alice/with_replies.rss" {
+		t.Errorf("Expected alice's feed without replies, got %+v %v %v", account, replies, ok)
+	}
+
+	if _, _, ok := ParseFeedURL("https://example.com/feed.rss"); ok {
+		t.Errorf("Expected other feeds not to be fediverse accounts")
+	}
+}
+
+func TestResolveFeedURL(t *testing.T) {
+	scheme = "http"
+	defer func() { scheme = "https" }()
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/webfinger":
+			if r.URL.Query().Get("resource") != "acct:alice@"+r.Host {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"links": [{"rel": "self", "href": "` + server.URL + `/users/alice"}, {"rel": "http://webfinger.net/rel/profile-page", "href": "` + server.URL + `/@alice"}]}`))
+		case "/@alice":
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="` + server.URL + `/@alice.rss"></head></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for input, expected := range map[string]string{
+		"@alice@" + host:                server.URL + "/@alice.rss",
+		server.URL + "/@alice":          server.URL + "/@alice.rss",
+		server.URL + "/@alice@" + host:  server.URL + "/@alice.rss",
+		"http://" + host + "/@no-links": server.URL + "/@no-links.rss",
+	} {
+		got, err := ResolveFeedURL(input)
+		if err != nil || got != expected {
+			t.Errorf("Expected '%s' to resolve to '%s', got '%s' (%v)", input, expected, got, err)
+		}
+	}
+
+	if _, err := ResolveFeedURL("@bob@" + host); err == nil {
+		t.Errorf("Expected an error for an account that doesn't exist")
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// how many of the last fetch errors of a feed its page shows
+const numFetchHistoryEvents = 10
+
+// feedRefreshHandler lets admins have a feed fetched right away, ahead of the
+// feeds waiting for their periodic refresh. People subscribed to a feed that
+// can't be fetched can retry it too, to see if it's fixed.
+func (s *Site) feedRefreshHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedRefreshHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedRefreshHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !s.reaper.HasFeed(feedURL) {
+		s.renderErr("feedRefreshHandler", w, "no such feed", http.StatusNotFound)
+		return
+	}
+
+	if !s.isAdmin(r) {
+		subscribed := slices.Contains(s.db.GetUserFeedURLs(s.username(r)), feedURL)
+		fetchErr, err := s.db.GetFeedFetchError(feedURL)
+		if err != nil {
+			s.renderErr("feedRefreshHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !subscribed || fetchErr == "" {
+			s.renderErr("feedRefreshHandler", w, "", http.StatusUnauthorized)
+			return
+		}
+	}
+
+	s.reaper.Refresh(feedURL)
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
+// the refresh intervals feeds can be given. The ones shorter than an hour are
+// only for admins, and the ones longer than the default only for admins and
+// people who are the only ones subscribed to a feed, it would hold up everyone
+// else's posts. Stale feeds are looked for every 10 minutes, there's no point
+// in anything shorter than half an hour.
+var refreshIntervalChoices = []time.Duration{
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+}
+
+// feedRefreshIntervalHandler sets how often a feed is fetched, for everyone
+// subscribed to it, see refreshIntervalChoices
+func (s *Site) feedRefreshIntervalHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedRefreshIntervalHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedRefreshIntervalHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	isAdmin := s.isAdmin(r)
+	if !isAdmin && !slices.Contains(s.db.GetUserFeedURLs(s.username(r)), feedURL) {
+		s.renderErr("feedRefreshIntervalHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	interval, err := time.ParseDuration(r.FormValue("interval"))
+	if err != nil || interval != 0 && !slices.Contains(s.refreshIntervalChoices(isAdmin, feedURL), interval) {
+		e := fmt.Sprintf("invalid refresh interval '%s'", r.FormValue("interval"))
+		s.renderErr("feedRefreshIntervalHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.reaper.SetRefreshInterval(feedURL, interval); err != nil {
+		s.renderErr("feedRefreshIntervalHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
+// refreshIntervalChoices returns the refresh intervals someone can give a
+// feed, see refreshIntervalChoices
+func (s *Site) refreshIntervalChoices(isAdmin bool, feedURL string) []time.Duration {
+	if isAdmin {
+		return refreshIntervalChoices
+	}
+
+	onlySubscriber := s.db.GetNumSubscribersForFeed(feedURL) == 1
+	var choices []time.Duration
+	for _, interval := range refreshIntervalChoices {
+		if interval >= time.Hour && (interval <= reaper.DefaultRefreshInterval || onlySubscriber) {
+			choices = append(choices, interval)
+		}
+	}
+	return choices
+}
+
+// refreshInterval says how often a feed is fetched, eg. "every 6 hours"
+func (s *Site) refreshInterval(interval time.Duration) string {
+	var n int
+	var unit string
+	switch {
+	case interval%(7*24*time.Hour) == 0:
+		n, unit = int(interval/(7*24*time.Hour)), "week"
+	case interval%(24*time.Hour) == 0:
+		n, unit = int(interval/(24*time.Hour)), "day"
+	case interval%time.Hour == 0:
+		n, unit = int(interval/time.Hour), "hour"
+	default:
+		n, unit = int(interval/time.Minute), "minute"
+	}
+
+	if n == 1 {
+		return "every " + unit
+	}
+	return "every " + plural(n, unit)
+}
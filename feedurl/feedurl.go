@@ -0,0 +1,62 @@
+// Package feedurl tells when two urls are the same feed: the ones that only
+// differ by their scheme, the case of their host, a trailing slash or the
+// tracking parameters stuck on them.
+package feedurl
+
+import (
+	"net/url"
+	"strings"
+)
+
+// query parameters that only say where someone came from
+var trackingParams = []string{"fbclid", "gclid", "mc_cid", "mc_eid", "_hsenc", "_hsmi", "ref_src"}
+
+// Canonical is the url every url of the same feed shares. It's meant to
+// compare urls, not to fetch them: feeds are still fetched at the url they
+// were first subscribed to, which may only work over http for instance. urls
+// that aren't http(s) are only trimmed.
+func Canonical(rawURL string) string {
+	rawURL = strings.TrimSpace(rawURL)
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return rawURL
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return rawURL
+	}
+
+	u.Scheme = "https"
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); port == "80" || port == "443" {
+		u.Host = u.Hostname()
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	query := u.Query()
+	for param := range query {
+		if isTrackingParam(param) {
+			query.Del(param)
+		}
+	}
+	// sorted by key
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+func isTrackingParam(param string) bool {
+	param = strings.ToLower(param)
+	if strings.HasPrefix(param, "utm_") {
+		return true
+	}
+	for _, p := range trackingParams {
+		if param == p {
+			return true
+		}
+	}
+	return false
+}
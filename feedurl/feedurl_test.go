@@ -0,0 +1,38 @@
+package feedurl
+
+import "testing"
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"https://a.com/feed", "https://a.com/feed"},
+		{"https://a.com/feed/", "https://a.com/feed"},
+		{"http://a.com/feed", "https://a.com/feed"},
+		{"HTTPS://A.com/feed", "https://a.com/feed"},
+		{"https://a.com:443/feed", "https://a.com/feed"},
+		{"http://a.com:80/feed", "https://a.com/feed"},
+		{"https://a.com:8080/feed", "https://a.com:8080/feed"},
+		{"  https://a.com/feed#top ", "https://a.com/feed"},
+		{"https://a.com/", "https://a.com"},
+
+		// paths keep their case, they matter
+		{"https://a.com/Feed", "https://a.com/Feed"},
+
+		// query parameters are sorted, the tracking ones dropped
+		{"https://a.com/?feed=rss2&utm_source=x", "https://a.com?feed=rss2"},
+		{"https://a.com/feed?b=2&a=1&fbclid=abc", "https://a.com/feed?a=1&b=2"},
+		{"https://a.com/feed?UTM_Medium=email", "https://a.com/feed"},
+
+		// only http(s) urls are canonicalized
+		{"not a url", "not a url"},
+		{"ftp://A.com/feed/", "ftp://A.com/feed/"},
+	}
+
+	for _, test := range tests {
+		if got := Canonical(test.input); got != test.expected {
+			t.Errorf("Canonical(%q) = %q, expected %q", test.input, got, test.expected)
+		}
+	}
+}
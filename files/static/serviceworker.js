@@ -0,0 +1,126 @@
+// mire's service worker: keeps the timelines people visit (with their unread
+// list) around so they can read them offline, and shows the push
+// notifications sent when the feeds they're subscribed to post.
+
+const CACHE = "mire-v1";
+
+const PRECACHED = [
+	"/static/style.css",
+	"/static/favicon-32x32.png",
+	"/static/android-chrome-192x192.png",
+];
+
+self.addEventListener("install", function (event) {
+	event.waitUntil(
+		caches.open(CACHE)
+			.then(cache => cache.addAll(PRECACHED))
+			.then(() => self.skipWaiting())
+	);
+});
+
+self.addEventListener("activate", function (event) {
+	event.waitUntil(
+		caches.keys()
+			.then(keys => Promise.all(keys.filter(key => key !== CACHE).map(key => caches.delete(key))))
+			.then(() => self.clients.claim())
+	);
+});
+
+// pages are always fetched fresh when online, the cached copy is only for
+// when the network is gone
+async function networkFirst(request) {
+	const cache = await caches.open(CACHE);
+	try {
+		const response = await fetch(request);
+		if (response.ok) {
+			cache.put(request, response.clone());
+		}
+		return response;
+	} catch (err) {
+		const cached = await cache.match(request);
+		if (cached) {
+			return cached;
+		}
+		return new Response("you're offline and this page wasn't saved for offline reading (╥﹏╥)", {
+			status: 503,
+			headers: { "Content-Type": "text/plain; charset=utf-8" },
+		});
+	}
+}
+
+self.addEventListener("fetch", function (event) {
+	const request = event.request;
+	const url = new URL(request.url);
+	if (url.origin !== self.location.origin) {
+		return;
+	}
+
+	// whatever was saved for offline reading was someone's own
+	if (url.pathname === "/logout") {
+		event.waitUntil(caches.delete(CACHE));
+		return;
+	}
+
+	if (request.method !== "GET") {
+		return;
+	}
+
+	// timelines (the unread list) are what's worth reading offline, other
+	// pages are only useful online
+	const isTimeline = request.mode === "navigate" && url.pathname.startsWith("/u/");
+	if (isTimeline || url.pathname.startsWith("/static/")) {
+		event.respondWith(networkFirst(request));
+	}
+});
+
+// the unread lists saved for offline reading are refreshed when there are
+// new posts, so they have them even if the notification is opened offline
+async function refreshUnreadLists() {
+	const cache = await caches.open(CACHE);
+	const requests = await cache.keys();
+	await Promise.all(requests
+		.filter(request => new URL(request.url).pathname.startsWith("/u/"))
+		.map(request => fetch(request.url).then(response => {
+			if (response.ok) {
+				return cache.put(request, response);
+			}
+		}).catch(() => { })));
+}
+
+self.addEventListener("push", function (event) {
+	let notification = { title: "mire", body: "there are new posts" };
+	if (event.data) {
+		try {
+			notification = event.data.json();
+		} catch (err) {
+			notification.body = event.data.text();
+		}
+	}
+
+	event.waitUntil(Promise.all([
+		self.registration.showNotification(notification.title, {
+			body: notification.body,
+			tag: notification.tag,
+			icon: "/static/android-chrome-192x192.png",
+			badge: "/static/favicon-32x32.png",
+			data: { url: notification.url || "/" },
+		}),
+		refreshUnreadLists(),
+	]));
+});
+
+self.addEventListener("notificationclick", function (event) {
+	event.notification.close();
+
+	const url = new URL(event.notification.data.url, self.location.origin).href;
+	event.waitUntil(
+		self.clients.matchAll({ type: "window", includeUncontrolled: true }).then(function (windows) {
+			for (const client of windows) {
+				if (client.url === url && "focus" in client) {
+					return client.focus();
+				}
+			}
+			return self.clients.openWindow(url);
+		})
+	);
+});
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	maxFilterRulesPerUser  = 50
+	maxFilterPatternLength = 200
+)
+
+// settingsAddFilterHandler adds a rule marking read or hiding the posts whose
+// title matches it, see sqlite.FilterRule
+func (s *Site) settingsAddFilterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsAddFilterHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	rule := &sqlite.FilterRule{
+		FeedURL: strings.TrimSpace(r.FormValue("feed")),
+		Match:   r.FormValue("match"),
+		Pattern: strings.TrimSpace(r.FormValue("pattern")),
+		Action:  r.FormValue("action"),
+	}
+
+	if rule.Action != sqlite.FilterActionRead && rule.Action != sqlite.FilterActionHide {
+		s.renderErr("settingsAddFilterHandler", w, fmt.Sprintf("invalid action '%s'", rule.Action), http.StatusBadRequest)
+		return
+	}
+	if rule.Pattern == "" || utf8.RuneCountInString(rule.Pattern) > maxFilterPatternLength {
+		e := fmt.Sprintf("filters should look for 1 to %d characters", maxFilterPatternLength)
+		s.renderErr("settingsAddFilterHandler", w, e, http.StatusBadRequest)
+		return
+	}
+	switch rule.Match {
+	case sqlite.FilterMatchContains:
+	case sqlite.FilterMatchRegex:
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			s.renderErr("settingsAddFilterHandler", w, fmt.Sprintf("invalid regex: %s", err), http.StatusBadRequest)
+			return
+		}
+	default:
+		s.renderErr("settingsAddFilterHandler", w, fmt.Sprintf("invalid match '%s'", rule.Match), http.StatusBadRequest)
+		return
+	}
+	if rule.FeedURL != "" && !slices.Contains(s.db.GetUserFeedURLs(username), rule.FeedURL) {
+		e := fmt.Sprintf("you're not subscribed to '%s'", rule.FeedURL)
+		s.renderErr("settingsAddFilterHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	rules, err := s.db.GetUserFilterRules(username)
+	if err != nil {
+		s.renderErr("settingsAddFilterHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(rules) >= maxFilterRulesPerUser {
+		e := fmt.Sprintf("you can have at most %d filters", maxFilterRulesPerUser)
+		s.renderErr("settingsAddFilterHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.db.AddFilterRule(username, rule)
+	if err != nil {
+		s.renderErr("settingsAddFilterHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+}
+
+func (s *Site) settingsDeleteFilterHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDeleteFilterHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid filter id '%s'", r.PathValue("id"))
+		s.renderErr("settingsDeleteFilterHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveFilterRule(s.username(r), id)
+	if err != nil {
+		s.renderErr("settingsDeleteFilterHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+
+	"codeberg.org/meadowingc/mire/importer"
+)
+
+const (
+	// how big each file imported can be
+	maxImportSize = 10 << 20
+
+	maxImportedFeeds = 1000
+	maxImportedStars = 5000
+)
+
+// importResult is what came of importing someone's exports
+type importResult struct {
+	Subscribed        int
+	AlreadySubscribed int
+	Invalid           []string
+	Folders           int
+	Starred           int
+	AlreadyStarred    int
+
+	// the starred posts mire doesn't have, so it can't star them
+	StarsNotFound []importer.Item
+
+	// only account archives have these, see settingsRestoreHandler
+	Preferences  bool
+	Read         int
+	ReadNotFound int
+}
+
+// settingsImportHandler imports the files other feed readers export (see the
+// importer package): the feeds in them are subscribed to, the folders they
+// were in kept as their notes when they don't have one, and the starred posts
+// mire has are starred
+func (s *Site) settingsImportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsImportHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := r.ParseMultipartForm(maxImportSize)
+	if err != nil {
+		s.renderErr("settingsImportHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	files := r.MultipartForm.File["file"]
+	if len(files) == 0 {
+		s.renderErr("settingsImportHandler", w, "pick a file to import", http.StatusBadRequest)
+		return
+	}
+
+	var imported importer.Import
+	for _, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(io.LimitReader(file, maxImportSize+1))
+		file.Close()
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > maxImportSize {
+			e := fmt.Sprintf("%s: files can't be bigger than %dMB", header.Filename, maxImportSize>>20)
+			s.renderErr("settingsImportHandler", w, e, http.StatusBadRequest)
+			return
+		}
+
+		parsed, err := importer.Parse(data)
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, fmt.Sprintf("%s: %s", header.Filename, err), http.StatusBadRequest)
+			return
+		}
+		imported.Feeds = append(imported.Feeds, parsed.Feeds...)
+		imported.Starred = append(imported.Starred, parsed.Starred...)
+	}
+	if len(imported.Feeds) > maxImportedFeeds || len(imported.Starred) > maxImportedStars {
+		e := fmt.Sprintf("at most %d feeds and %d starred posts can be imported at once", maxImportedFeeds, maxImportedStars)
+		s.renderErr("settingsImportHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	var result importResult
+
+	subscriptions := s.db.GetUserFeedURLs(username)
+	var feedURLs []string
+	folders := make(map[string]string)
+	for _, feed := range imported.Feeds {
+		feedURL := feed.URL
+		if !s.reaper.HasFeed(feedURL) {
+			feedURL, err = resolveFeedURL(feedURL)
+			if err != nil {
+				result.Invalid = append(result.Invalid, feed.URL)
+				continue
+			}
+		}
+		if slices.Contains(feedURLs, feedURL) {
+			continue
+		}
+		feedURLs = append(feedURLs, feedURL)
+		if feed.Folder != "" {
+			folders[feedURL] = feed.Folder
+		}
+
+		if slices.Contains(subscriptions, feedURL) {
+			result.AlreadySubscribed++
+		} else {
+			result.Subscribed++
+		}
+	}
+
+	if err := s.subscribeToFeeds(username, feedURLs); err != nil {
+		s.renderQuotaErr("settingsImportHandler", w, err)
+		return
+	}
+
+	// mire has no folders, but notes are where people keep what they know
+	// about a subscription
+	for feedURL, folder := range folders {
+		note, subscribed, err := s.db.GetSubscriptionNote(username, feedURL)
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !subscribed || note != "" {
+			continue
+		}
+
+		folderNote := []rune("folder: " + folder)
+		if len(folderNote) > maxSubscriptionNoteLength {
+			folderNote = folderNote[:maxSubscriptionNoteLength]
+		}
+		if err := s.db.SetSubscriptionNote(username, feedURL, string(folderNote)); err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Folders++
+	}
+
+	for _, item := range imported.Starred {
+		post, err := s.db.GetPostByURL(item.URL)
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if post == nil {
+			result.StarsNotFound = append(result.StarsNotFound, item)
+			continue
+		}
+
+		// stars already there keep their quote and note
+		existing, err := s.db.GetPostStar(username, post.ID)
+		if err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			result.AlreadyStarred++
+			continue
+		}
+
+		if err := s.db.StarPost(username, post, "", ""); err != nil {
+			s.renderErr("settingsImportHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		result.Starred++
+	}
+
+	s.renderPage(w, r, "import", result)
+}
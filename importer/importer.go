@@ -0,0 +1,271 @@
+// Package importer reads what other feed readers export, to move to mire
+// with: subscriptions from OPML (Feedly, NewsBlur, Miniflux and most others
+// export it) along with their folders, or from the JSON of Miniflux's feeds
+// API, and starred posts from the JSON of Feedly's saved items, Miniflux's
+// entries API and NewsBlur's starred stories.
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// ErrUnknownFormat is returned for files that aren't OPML or one of the JSON
+// exports we know
+var ErrUnknownFormat = errors.New("this doesn't look like an OPML file or a Feedly, NewsBlur or Miniflux export")
+
+// Feed is a feed someone was subscribed to
+type Feed struct {
+	URL   string
+	Title string
+
+	// the folder (or category) the feed was in, nested folders are separated
+	// by slashes. Empty if it wasn't in one.
+	Folder string
+}
+
+// Item is a post someone starred (or saved for later)
+type Item struct {
+	URL   string
+	Title string
+
+	// the feed it's from, if the export says
+	FeedURL string
+}
+
+// Import is what an export had, the feeds and items without a http(s) URL
+// left out
+type Import struct {
+	Feeds   []Feed
+	Starred []Item
+}
+
+// Parse reads an export, telling OPML from JSON by its first character
+func Parse(data []byte) (*Import, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("\xef\xbb\xbf"))
+	if len(data) == 0 {
+		return nil, ErrUnknownFormat
+	}
+
+	var imp *Import
+	var err error
+	switch data[0] {
+	case '<':
+		imp, err = parseOPML(data)
+	case '[', '{':
+		imp, err = parseJSON(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	return imp.clean(), nil
+}
+
+// clean drops what has no http(s) URL and duplicates
+func (imp *Import) clean() *Import {
+	cleaned := &Import{}
+	seen := make(map[string]bool)
+	for _, feed := range imp.Feeds {
+		feed.URL = strings.TrimSpace(feed.URL)
+		if !isWebURL(feed.URL) || seen[feed.URL] {
+			continue
+		}
+		seen[feed.URL] = true
+		cleaned.Feeds = append(cleaned.Feeds, feed)
+	}
+
+	seen = make(map[string]bool)
+	for _, item := range imp.Starred {
+		item.URL = strings.TrimSpace(item.URL)
+		if !isWebURL(item.URL) || seen[item.URL] {
+			continue
+		}
+		seen[item.URL] = true
+		if !isWebURL(item.FeedURL) {
+			item.FeedURL = ""
+		}
+		cleaned.Starred = append(cleaned.Starred, item)
+	}
+	return cleaned
+}
+
+func isWebURL(rawURL string) bool {
+	u, err := url.ParseRequestURI(rawURL)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// outline is an OPML outline. Exporters don't agree on the case of attribute
+// names (xmlUrl, xmlurl, XMLURL), so they're all kept and looked up ignoring
+// case.
+type outline struct {
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Outlines []outline  `xml:"outline"`
+}
+
+func (o *outline) attr(name string) string {
+	for _, attr := range o.Attrs {
+		if strings.EqualFold(attr.Name.Local, name) {
+			return strings.TrimSpace(attr.Value)
+		}
+	}
+	return ""
+}
+
+func (o *outline) title() string {
+	if title := o.attr("title"); title != "" {
+		return title
+	}
+	return o.attr("text")
+}
+
+func parseOPML(data []byte) (*Import, error) {
+	var opml struct {
+		XMLName xml.Name
+		Body    struct {
+			Outlines []outline `xml:"outline"`
+		} `xml:"body"`
+	}
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// plenty of OPML files say they're in some encoding and are in UTF-8
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) { return input, nil }
+	if err := decoder.Decode(&opml); err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(opml.XMLName.Local, "opml") {
+		return nil, ErrUnknownFormat
+	}
+
+	imp := &Import{}
+	var walk func(outlines []outline, folder string)
+	walk = func(outlines []outline, folder string) {
+		for _, o := range outlines {
+			if feedURL := o.attr("xmlUrl"); feedURL != "" {
+				imp.Feeds = append(imp.Feeds, Feed{URL: feedURL, Title: o.title(), Folder: folder})
+				continue
+			}
+
+			subfolder := o.title()
+			if folder != "" && subfolder != "" {
+				subfolder = folder + "/" + subfolder
+			} else if subfolder == "" {
+				subfolder = folder
+			}
+			walk(o.Outlines, subfolder)
+		}
+	}
+	walk(opml.Body.Outlines, "")
+	return imp, nil
+}
+
+// jsonEntry is any of the things the JSON exports list: feeds or entries from
+// Miniflux, saved items from Feedly or starred stories from NewsBlur
+type jsonEntry struct {
+	Title string `json:"title"`
+
+	// miniflux feeds
+	FeedURL  string        `json:"feed_url"`
+	Category *jsonCategory `json:"category"`
+
+	// miniflux entries
+	URL     string `json:"url"`
+	Starred bool   `json:"starred"`
+	Feed    *struct {
+		FeedURL string `json:"feed_url"`
+	} `json:"feed"`
+
+	// feedly items
+	CanonicalURL string `json:"canonicalUrl"`
+	OriginID     string `json:"originId"`
+	Alternate    []struct {
+		Href string `json:"href"`
+	} `json:"alternate"`
+	Origin *struct {
+		StreamID string `json:"streamId"`
+	} `json:"origin"`
+
+	// newsblur stories
+	StoryPermalink string `json:"story_permalink"`
+	StoryTitle     string `json:"story_title"`
+}
+
+type jsonCategory struct {
+	Title string `json:"title"`
+}
+
+func parseJSON(data []byte) (*Import, error) {
+	var entries []jsonEntry
+	if data[0] == '[' {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, err
+		}
+	} else {
+		var export struct {
+			Entries []jsonEntry `json:"entries"` // miniflux
+			Stories []jsonEntry `json:"stories"` // newsblur
+			Items   []jsonEntry `json:"items"`   // feedly
+		}
+		if err := json.Unmarshal(data, &export); err != nil {
+			return nil, err
+		}
+		entries = append(append(export.Entries, export.Stories...), export.Items...)
+		if entries == nil {
+			return nil, ErrUnknownFormat
+		}
+	}
+
+	imp := &Import{}
+	for _, entry := range entries {
+		switch {
+		case entry.StoryPermalink != "":
+			imp.Starred = append(imp.Starred, Item{URL: entry.StoryPermalink, Title: entry.StoryTitle})
+
+		case entry.Origin != nil || entry.OriginID != "" || len(entry.Alternate) > 0:
+			item := Item{URL: entry.CanonicalURL, Title: entry.Title}
+			if item.URL == "" && len(entry.Alternate) > 0 {
+				item.URL = entry.Alternate[0].Href
+			}
+			if item.URL == "" {
+				item.URL = entry.OriginID
+			}
+			if entry.Origin != nil {
+				item.FeedURL = strings.TrimPrefix(entry.Origin.StreamID, "feed/")
+			}
+			imp.Starred = append(imp.Starred, item)
+
+		case entry.Feed != nil:
+			// entries that weren't starred have no business in mire's stars
+			if entry.Starred {
+				imp.Starred = append(imp.Starred, Item{URL: entry.URL, Title: entry.Title, FeedURL: entry.Feed.FeedURL})
+			}
+
+		case entry.FeedURL != "":
+			feed := Feed{URL: entry.FeedURL, Title: entry.Title}
+			if entry.Category != nil {
+				feed.Folder = entry.Category.Title
+			}
+			imp.Feeds = append(imp.Feeds, feed)
+		}
+	}
+	if len(entries) > 0 && len(imp.Feeds) == 0 && len(imp.Starred) == 0 && !anyMinifluxEntries(entries) {
+		return nil, ErrUnknownFormat
+	}
+	return imp, nil
+}
+
+// anyMinifluxEntries tells an export of Miniflux entries none of which were
+// starred apart from a file we can't read
+func anyMinifluxEntries(entries []jsonEntry) bool {
+	for _, entry := range entries {
+		if entry.Feed != nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package importer
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseOPML(t *testing.T) {
+	// feedly style, with folders, and a feed in none
+	opml := []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<opml version="1.0">
+<head><title>subscriptions in feedly Cloud</title></head>
+<body>
+<outline text="Tech" title="Tech">
+	<outline type="rss" text="Example" title="Example" xmlUrl="https://example.com/feed" htmlUrl="https://example.com"/>
+	<outline text="Go">
+		<outline type="rss" text="Go blog" xmlurl="https://go.dev/blog/feed.atom"/>
+	</outline>
+</outline>
+<outline type="rss" title="Loose" xmlUrl="http://loose.example.com/rss"/>
+<outline type="rss" title="Duplicate" xmlUrl="https://example.com/feed"/>
+<outline type="rss" title="Not the web" xmlUrl="file:///etc/passwd"/>
+</body>
+</opml>`)
+
+	imp, err := Parse(opml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Feed{
+		{URL: "https://example.com/feed", Title: "Example", Folder: "Tech"},
+		{URL: "https://go.dev/blog/feed.atom", Title: "Go blog", Folder: "Tech/Go"},
+		{URL: "http://loose.example.com/rss", Title: "Loose"},
+	}
+	if !reflect.DeepEqual(imp.Feeds, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, imp.Feeds)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		data    string
+		feeds   []Feed
+		starred []Item
+	}{
+		{
+			name:  "miniflux feeds",
+			data:  `[{"id": 1, "feed_url": "https://example.com/feed", "site_url": "https://example.com", "title": "Example", "category": {"id": 2, "title": "Friends"}}]`,
+			feeds: []Feed{{URL: "https://example.com/feed", Title: "Example", Folder: "Friends"}},
+		},
+		{
+			name: "miniflux entries",
+			data: `{"total": 2, "entries": [
+				{"id": 1, "url": "https://example.com/1", "title": "One", "starred": true, "feed": {"feed_url": "https://example.com/feed"}},
+				{"id": 2, "url": "https://example.com/2", "title": "Two", "starred": false, "feed": {"feed_url": "https://example.com/feed"}}]}`,
+			starred: []Item{{URL: "https://example.com/1", Title: "One", FeedURL: "https://example.com/feed"}},
+		},
+		{
+			name:    "feedly saved items",
+			data:    `[{"id": "x", "title": "Saved", "originId": "tag:example.com,2024:1", "alternate": [{"href": "https://example.com/saved", "type": "text/html"}], "origin": {"streamId": "feed/https://example.com/feed", "title": "Example"}}]`,
+			starred: []Item{{URL: "https://example.com/saved", Title: "Saved", FeedURL: "https://example.com/feed"}},
+		},
+		{
+			name:    "newsblur starred stories",
+			data:    `{"stories": [{"story_permalink": "https://example.com/story", "story_title": "Story", "story_feed_id": 42}]}`,
+			starred: []Item{{URL: "https://example.com/story", Title: "Story"}},
+		},
+	} {
+		imp, err := Parse([]byte(tc.data))
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(imp.Feeds, tc.feeds) || !reflect.DeepEqual(imp.Starred, tc.starred) {
+			t.Errorf("%s: expected %+v and %+v, got %+v and %+v", tc.name, tc.feeds, tc.starred, imp.Feeds, imp.Starred)
+		}
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	for _, data := range []string{"", "hello", `{"foo": 1}`, `<html><body></body></html>`, `[{"foo": 1}]`} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Expected '%s' not to be an export", data)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/indieauth"
+	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// how long apps have to redeem the code they get when people approve them
+const indieAuthCodeMaxAgeMinutes = 10
+
+// indieAuthMe returns the URL people sign in to IndieWeb apps with: their
+// timeline, which tells apps where mire's IndieAuth and Microsub endpoints are
+func indieAuthMe(username string) string {
+	return constants.BASE_URL + "/u/" + url.PathEscape(username)
+}
+
+// setIndieAuthLinks tells the IndieWeb apps looking at someone's timeline
+// where to sign them in and read their feeds
+func setIndieAuthLinks(w http.ResponseWriter) {
+	for rel, path := range map[string]string{
+		"authorization_endpoint": "/indieauth/auth",
+		"token_endpoint":         "/indieauth/token",
+		"indieauth-metadata":     "/.well-known/oauth-authorization-server",
+		"microsub":               "/microsub",
+	} {
+		w.Header().Add("Link", "<"+constants.BASE_URL+path+`>; rel="`+rel+`"`)
+	}
+}
+
+// renderOAuthErr renders an error the way OAuth apps (IndieAuth, Microsub)
+// expect them, https://www.rfc-editor.org/rfc/rfc6749#section-5.2
+func (s *Site) renderOAuthErr(caller string, w http.ResponseWriter, errorType string, description string, code int) {
+	log.Println(caller + ":: " + errorType + ": " + description)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	s.renderJSON(w, struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+	}{
+		Error:       errorType,
+		Description: description,
+	})
+}
+
+// bearerToken returns the token an app sent, in the Authorization header or
+// in the access_token parameter
+func bearerToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return r.FormValue("access_token")
+}
+
+// indieAuthToken returns the token an app sent, or nil if it didn't send a
+// valid one
+func (s *Site) indieAuthToken(r *http.Request) (*sqlite.IndieAuthToken, error) {
+	tokenValue := bearerToken(r)
+	if tokenValue == "" {
+		return nil, nil
+	}
+
+	token, err := s.db.GetIndieAuthToken(tokenValue)
+	if err != nil || token == nil {
+		return nil, err
+	}
+
+	err = s.db.TouchIndieAuthToken(token.ID)
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+// isSameOriginRequest tells forms posted from mire's own pages from the ones
+// other sites make browsers post, for browsers that say
+func isSameOriginRequest(r *http.Request) bool {
+	if site := r.Header.Get("Sec-Fetch-Site"); site != "" {
+		return site == "same-origin" || site == "none"
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		return origin == constants.BASE_URL
+	}
+	return true
+}
+
+// indieAuthRequest is an app asking someone to sign in
+type indieAuthRequest struct {
+	ClientID      string
+	ClientDomain  string
+	RedirectURI   string
+	State         string
+	CodeChallenge string
+	Scopes        []string
+}
+
+// parseIndieAuthRequest reads and checks an app's sign in request
+func parseIndieAuthRequest(r *http.Request) (*indieAuthRequest, error) {
+	if responseType := r.FormValue("response_type"); responseType != "" && responseType != "code" && responseType != "id" {
+		return nil, errors.New("only the code response type is supported")
+	}
+
+	clientID := r.FormValue("client_id")
+	client, err := indieauth.ParseClientID(clientID)
+	if err != nil {
+		return nil, err
+	}
+	redirectURI := r.FormValue("redirect_uri")
+	err = indieauth.CheckRedirectURI(clientID, redirectURI)
+	if err != nil {
+		return nil, err
+	}
+
+	// apps that predate PKCE don't send a challenge
+	challenge := r.FormValue("code_challenge")
+	if challenge != "" && r.FormValue("code_challenge_method") != "S256" {
+		return nil, errors.New("only the S256 code challenge method is supported")
+	}
+
+	return &indieAuthRequest{
+		ClientID:      clientID,
+		ClientDomain:  client.Host,
+		RedirectURI:   redirectURI,
+		State:         r.FormValue("state"),
+		CodeChallenge: challenge,
+		Scopes:        indieauth.ParseScope(r.FormValue("scope")),
+	}, nil
+}
+
+// indieAuthMetadataHandler tells apps where the IndieAuth endpoints are and
+// what they support
+func (s *Site) indieAuthMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	scopes := make([]string, 0, len(indieauth.Scopes))
+	for scope := range indieauth.Scopes {
+		scopes = append(scopes, scope)
+	}
+	slices.Sort(scopes)
+
+	s.renderJSON(w, struct {
+		Issuer                        string   `json:"issuer"`
+		AuthorizationEndpoint         string   `json:"authorization_endpoint"`
+		TokenEndpoint                 string   `json:"token_endpoint"`
+		ResponseTypesSupported        []string `json:"response_types_supported"`
+		GrantTypesSupported           []string `json:"grant_types_supported"`
+		CodeChallengeMethodsSupported []string `json:"code_challenge_methods_supported"`
+		ScopesSupported               []string `json:"scopes_supported"`
+		IssParameterSupported         bool     `json:"authorization_response_iss_parameter_supported"`
+	}{
+		Issuer:                        constants.BASE_URL + "/",
+		AuthorizationEndpoint:         constants.BASE_URL + "/indieauth/auth",
+		TokenEndpoint:                 constants.BASE_URL + "/indieauth/token",
+		ResponseTypesSupported:        []string{"code"},
+		GrantTypesSupported:           []string{"authorization_code"},
+		CodeChallengeMethodsSupported: []string{"S256"},
+		ScopesSupported:               scopes,
+		IssParameterSupported:         true,
+	})
+}
+
+// indieAuthHandler asks people whether to let an app sign in to their
+// account
+func (s *Site) indieAuthHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+
+	req, err := parseIndieAuthRequest(r)
+	if err != nil {
+		s.renderErr("indieAuthHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scopes := make([][2]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		scopes = append(scopes, [2]string{scope, indieauth.Scopes[scope]})
+	}
+
+	data := struct {
+		Request *indieAuthRequest
+		Scope   string
+		Scopes  [][2]string
+		Me      string
+	}{
+		Request: req,
+		Scope:   strings.Join(req.Scopes, " "),
+		Scopes:  scopes,
+		Me:      indieAuthMe(s.username(r)),
+	}
+
+	s.renderPage(w, r, "indieauth", data)
+}
+
+// indieAuthPostHandler is where people approve apps, and where apps that only
+// wanted to know who someone is redeem their code
+func (s *Site) indieAuthPostHandler(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("grant_type") == "authorization_code" {
+		code, errType, err := s.redeemIndieAuthCode(r)
+		if err != nil {
+			s.renderOAuthErr("indieAuthPostHandler", w, errType, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.renderJSON(w, struct {
+			Me string `json:"me"`
+		}{
+			Me: indieAuthMe(code.Username),
+		})
+		return
+	}
+
+	if !s.loggedIn(r) {
+		s.renderErr("indieAuthPostHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+	if !isSameOriginRequest(r) {
+		s.renderErr("indieAuthPostHandler", w, "apps can only be approved from mire", http.StatusForbidden)
+		return
+	}
+
+	req, err := parseIndieAuthRequest(r)
+	if err != nil {
+		s.renderErr("indieAuthPostHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	redirect, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		s.renderErr("indieAuthPostHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := redirect.Query()
+	query.Set("state", req.State)
+	query.Set("iss", constants.BASE_URL+"/")
+
+	if r.FormValue("approve") != "yes" {
+		query.Set("error", "access_denied")
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusSeeOther)
+		return
+	}
+
+	// people can untick the scopes they don't want to give
+	var granted []string
+	for _, scope := range r.Form["grant"] {
+		if slices.Contains(req.Scopes, scope) {
+			granted = append(granted, scope)
+		}
+	}
+
+	code := lib.GenerateSecureToken(32)
+	err = s.db.SaveIndieAuthCode(code, &sqlite.IndieAuthCode{
+		Username:      s.username(r),
+		ClientID:      req.ClientID,
+		RedirectURI:   req.RedirectURI,
+		CodeChallenge: req.CodeChallenge,
+		Scope:         strings.Join(granted, " "),
+	})
+	if err != nil {
+		s.renderErr("indieAuthPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	query.Set("code", code)
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusSeeOther)
+}
+
+// redeemIndieAuthCode checks the code an app sent, and that it's the app it
+// was given to. It returns the OAuth error type along with errors.
+func (s *Site) redeemIndieAuthCode(r *http.Request) (*sqlite.IndieAuthCode, string, error) {
+	code, err := s.db.RedeemIndieAuthCode(r.FormValue("code"), indieAuthCodeMaxAgeMinutes)
+	if err != nil {
+		return nil, "server_error", err
+	}
+	if code == nil {
+		return nil, "invalid_grant", errors.New("the code is unknown, expired or was already used")
+	}
+
+	if code.ClientID != r.FormValue("client_id") || code.RedirectURI != r.FormValue("redirect_uri") {
+		return nil, "invalid_grant", errors.New("the code was given to another app")
+	}
+
+	verifier := r.FormValue("code_verifier")
+	if (code.CodeChallenge != "" || verifier != "") && !indieauth.CheckPKCE(code.CodeChallenge, verifier) {
+		return nil, "invalid_grant", errors.New("the code verifier doesn't match the code challenge")
+	}
+
+	return code, "", nil
+}
+
+// indieAuthTokenHandler gives apps the token they act on behalf of someone
+// with, and lets them sign out
+func (s *Site) indieAuthTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// the revocation apps made before RFC 7009 became part of IndieAuth
+	if r.FormValue("action") == "revoke" {
+		err := s.db.DeleteIndieAuthToken(r.FormValue("token"))
+		if err != nil {
+			s.renderOAuthErr("indieAuthTokenHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	if r.FormValue("grant_type") != "authorization_code" {
+		s.renderOAuthErr("indieAuthTokenHandler", w, "unsupported_grant_type", "only the authorization_code grant type is supported", http.StatusBadRequest)
+		return
+	}
+
+	code, errType, err := s.redeemIndieAuthCode(r)
+	if err != nil {
+		s.renderOAuthErr("indieAuthTokenHandler", w, errType, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if code.Scope == "" {
+		s.renderOAuthErr("indieAuthTokenHandler", w, "invalid_grant", "no scope was granted, redeem the code at the authorization endpoint", http.StatusBadRequest)
+		return
+	}
+
+	token := lib.GenerateSecureToken(32)
+	err = s.db.AddIndieAuthToken(code.Username, code.ClientID, code.Scope, token)
+	if err != nil {
+		s.renderOAuthErr("indieAuthTokenHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		Scope       string `json:"scope"`
+		Me          string `json:"me"`
+	}{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		Scope:       code.Scope,
+		Me:          indieAuthMe(code.Username),
+	})
+}
+
+// indieAuthVerifyTokenHandler tells apps who a token was given to, and for
+// what
+func (s *Site) indieAuthVerifyTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := s.indieAuthToken(r)
+	if err != nil {
+		s.renderOAuthErr("indieAuthVerifyTokenHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if token == nil {
+		s.renderOAuthErr("indieAuthVerifyTokenHandler", w, "unauthorized", "the token is missing or was revoked", http.StatusUnauthorized)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		Me       string `json:"me"`
+		ClientID string `json:"client_id"`
+		Scope    string `json:"scope"`
+	}{
+		Me:       indieAuthMe(token.Username),
+		ClientID: token.ClientID,
+		Scope:    token.Scope,
+	})
+}
+
+// settingsRevokeAppHandler signs an app out of someone's account
+func (s *Site) settingsRevokeAppHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsRevokeAppHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		s.renderErr("settingsRevokeAppHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RevokeIndieAuthToken(s.username(r), id)
+	if err != nil {
+		s.renderErr("settingsRevokeAppHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#apps", http.StatusSeeOther)
+}
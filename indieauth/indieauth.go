@@ -0,0 +1,93 @@
+// Package indieauth has the checks an IndieAuth server
+// (https://indieauth.spec.indieweb.org) makes on the apps asking people to
+// sign in, which lets IndieWeb apps (like Microsub readers) act on behalf of
+// mire users.
+package indieauth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Scopes are the scopes apps can ask for, and what they let them do
+var Scopes = map[string]string{
+	"profile":  "see your username",
+	"read":     "read your timeline and mark posts as read",
+	"follow":   "subscribe you to feeds and unsubscribe you from them",
+	"channels": "create, rename and delete your collections",
+}
+
+// ParseClientID checks the URL an app identifies itself with
+// (https://indieauth.spec.indieweb.org/#client-identifier)
+func ParseClientID(clientID string) (*url.URL, error) {
+	u, err := url.Parse(clientID)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("'%s' is not the URL of an app", clientID)
+	}
+	if u.User != nil || u.Fragment != "" {
+		return nil, fmt.Errorf("the URL of an app can't have a username, password or fragment")
+	}
+	if slices.Contains(strings.Split(u.Path, "/"), ".") || slices.Contains(strings.Split(u.Path, "/"), "..") {
+		return nil, fmt.Errorf("the URL of an app can't have . or .. in its path")
+	}
+
+	// apps are addressed by domain name, only local ones can be on an ip
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !ip.IsLoopback() {
+		return nil, fmt.Errorf("the URL of an app can't be an ip address")
+	}
+
+	return u, nil
+}
+
+// CheckRedirectURI checks that an app sends people back to itself after they
+// sign in, and not to someone else who'd get their access
+func CheckRedirectURI(clientID string, redirectURI string) error {
+	client, err := ParseClientID(clientID)
+	if err != nil {
+		return err
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Fragment != "" {
+		return fmt.Errorf("'%s' is not a URL to redirect to", redirectURI)
+	}
+	if u.Scheme != client.Scheme || u.Host != client.Host {
+		return fmt.Errorf("%s can only redirect to its own site, not to %s", client.Host, redirectURI)
+	}
+	return nil
+}
+
+// CheckPKCE checks the verifier an app redeems its code with against the
+// challenge it started with. Only the S256 method is supported.
+func CheckPKCE(challenge string, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	hash := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(hash[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// ParseScope returns the known scopes out of the space separated ones an app
+// asked for, without duplicates
+func ParseScope(scope string) []string {
+	var scopes []string
+	for _, s := range strings.Fields(scope) {
+		if _, ok := Scopes[s]; ok && !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// HasScope reports whether the space separated scopes granted to an app
+// include the one needed
+func HasScope(granted string, scope string) bool {
+	return slices.Contains(strings.Fields(granted), scope)
+}
@@ -0,0 +1,68 @@
+package indieauth
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseClientID(t *testing.T) {
+	for clientID, valid := range map[string]bool{
+		"https://monocle.p3k.io/":        true,
+		"https://app.example.com/?x=1":   true,
+		"http://localhost:8080/":         true,
+		"http://127.0.0.1:8080/":         true,
+		"https://93.184.216.34/":         false,
+		"https://user:pw@example.com/":   false,
+		"https://example.com/#fragment":  false,
+		"https://example.com/./app":      false,
+		"https://example.com/a/../b":     false,
+		"ftp://example.com/":             false,
+		"example.com":                    false,
+		"https://app.example.com/reader": true,
+	} {
+		_, err := ParseClientID(clientID)
+		if (err == nil) != valid {
+			t.Errorf("Expected '%s' valid: %v, got %v", clientID, valid, err)
+		}
+	}
+}
+
+func TestCheckRedirectURI(t *testing.T) {
+	if err := CheckRedirectURI("https://app.example.com/", "https://app.example.com/callback?x=1"); err != nil {
+		t.Errorf("Expected a redirect to the app's own site to be fine, got %v", err)
+	}
+	for _, redirectURI := range []string{
+		"https://evil.example.com/callback",
+		"http://app.example.com/callback",
+		"https://app.example.com:8443/callback",
+		"https://app.example.com/callback#x",
+	} {
+		if err := CheckRedirectURI("https://app.example.com/", redirectURI); err == nil {
+			t.Errorf("Expected a redirect to '%s' to be refused", redirectURI)
+		}
+	}
+}
+
+func TestCheckPKCE(t *testing.T) {
+	// the example in appendix B of RFC 7636
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	if !CheckPKCE(challenge, verifier) {
+		t.Errorf("Expected the verifier to match the challenge")
+	}
+	if CheckPKCE(challenge, verifier[:42]+"a") || CheckPKCE(challenge, "short") {
+		t.Errorf("Expected other verifiers not to match")
+	}
+}
+
+func TestParseScope(t *testing.T) {
+	scopes := ParseScope("read follow read create channels")
+	if !slices.Equal(scopes, []string{"read", "follow", "channels"}) {
+		t.Errorf("Expected the known scopes once each, got %v", scopes)
+	}
+
+	if !HasScope("read follow", "follow") || HasScope("read", "follow") {
+		t.Errorf("Expected HasScope to look for the exact scope")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/instapaper"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+var errInstapaperNotConnected = errors.New("no instapaper account is connected")
+
+func instapaperToken(account *sqlite.InstapaperAccount) *instapaper.Token {
+	return &instapaper.Token{Token: account.Token, Secret: account.TokenSecret}
+}
+
+// instapaperConnectHandler exchanges the instapaper email and password someone
+// entered for a token, which is all that's kept
+func (s *Site) instapaperConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("instapaperConnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	if !s.instapaper.Enabled() {
+		s.renderErr("instapaperConnectHandler", w, "this instance isn't set up to save to instapaper", http.StatusNotFound)
+		return
+	}
+
+	email := strings.TrimSpace(r.FormValue("email"))
+	if email == "" {
+		s.renderErr("instapaperConnectHandler", w, "your instapaper email or username is required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := s.instapaper.AccessToken(email, r.FormValue("password"))
+	if errors.Is(err, instapaper.ErrInvalidCredentials) {
+		s.renderErr("instapaperConnectHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("instapaperConnectHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	accountName, err := s.instapaper.Username(token)
+	if err != nil {
+		s.renderErr("instapaperConnectHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	err = s.db.SaveInstapaperAccount(s.username(r), &sqlite.InstapaperAccount{
+		AccountName: accountName,
+		Token:       token.Token,
+		TokenSecret: token.Secret,
+	})
+	if err != nil {
+		s.renderErr("instapaperConnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#instapaper", http.StatusSeeOther)
+}
+
+func (s *Site) instapaperDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("instapaperDisconnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.DeleteInstapaperAccount(s.username(r))
+	if err != nil {
+		s.renderErr("instapaperDisconnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#instapaper", http.StatusSeeOther)
+}
+
+// saveToInstapaperHandler saves a post to the user's connected instapaper
+// account, to read later
+func (s *Site) saveToInstapaperHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("saveToInstapaperHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("saveToInstapaperHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = s.saveToInstapaper(s.username(r), post.URL, post.Title)
+	if errors.Is(err, errInstapaperNotConnected) {
+		http.Redirect(w, r, "/settings#instapaper", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		s.renderErr("saveToInstapaperHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
+
+// saveToInstapaper saves a page to someone's connected instapaper account
+func (s *Site) saveToInstapaper(username string, link string, title string) error {
+	account, err := s.db.GetInstapaperAccount(username)
+	if err != nil {
+		return err
+	}
+	if account == nil || !s.instapaper.Enabled() {
+		return errInstapaperNotConnected
+	}
+
+	err = s.instapaper.Add(instapaperToken(account), link, title)
+	if errors.Is(err, instapaper.ErrInvalidCredentials) {
+		return errors.New("instapaper doesn't accept mire's access anymore, please connect your account again in your settings")
+	}
+	return err
+}
@@ -0,0 +1,254 @@
+// Package instapaper saves links to people's Instapaper accounts through the
+// full Instapaper API. Instapaper only hands out API access to registered
+// applications, so an instance needs its own consumer key and secret, set
+// with environment variables. An instance without them simply doesn't offer
+// saving to Instapaper.
+//
+// People connect with xAuth: they give their Instapaper email and password
+// once, which are exchanged for an OAuth token. The password isn't kept.
+package instapaper
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/lib"
+)
+
+const defaultBaseURL = "https://www.instapaper.com"
+
+// max size of the responses read from instapaper
+const maxResponseSize = 1 << 20
+
+// ErrInvalidCredentials is returned when instapaper doesn't accept an email
+// and password, or a token that was revoked since
+var ErrInvalidCredentials = errors.New("instapaper didn't accept these credentials")
+
+type Config struct {
+	ConsumerKey    string
+	ConsumerSecret string
+}
+
+// ConfigFromEnv reads the consumer key and secret from
+// MIRE_INSTAPAPER_CONSUMER_KEY and MIRE_INSTAPAPER_CONSUMER_SECRET
+func ConfigFromEnv() Config {
+	return Config{
+		ConsumerKey:    os.Getenv("MIRE_INSTAPAPER_CONSUMER_KEY"),
+		ConsumerSecret: os.Getenv("MIRE_INSTAPAPER_CONSUMER_SECRET"),
+	}
+}
+
+// Token is what a connected account is used with, in place of its password
+type Token struct {
+	Token  string
+	Secret string
+}
+
+type Client struct {
+	config Config
+
+	// swapped out by tests
+	baseURL string
+	http    *http.Client
+	now     func() time.Time
+	nonce   func() string
+}
+
+func New(config Config) *Client {
+	return &Client{
+		config:  config,
+		baseURL: defaultBaseURL,
+		http:    &http.Client{Timeout: 15 * time.Second},
+		now:     time.Now,
+		nonce:   func() string { return lib.GenerateSecureToken(16) },
+	}
+}
+
+// Enabled reports whether the instance is set up to save to instapaper
+func (c *Client) Enabled() bool {
+	return c.config.ConsumerKey != "" && c.config.ConsumerSecret != ""
+}
+
+// AccessToken exchanges someone's instapaper email (or username) and password
+// for a token
+func (c *Client) AccessToken(username string, password string) (*Token, error) {
+	body, err := c.post("/api/1/oauth/access_token", nil, url.Values{
+		"x_auth_username": {username},
+		"x_auth_password": {password},
+		"x_auth_mode":     {"client_auth"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	token := &Token{Token: values.Get("oauth_token"), Secret: values.Get("oauth_token_secret")}
+	if token.Token == "" || token.Secret == "" {
+		return nil, fmt.Errorf("instapaper didn't return a token: %s", body)
+	}
+	return token, nil
+}
+
+// Username returns the username of the account a token belongs to
+func (c *Client) Username(token *Token) (string, error) {
+	body, err := c.post("/api/1/account/verify_credentials", token, url.Values{})
+	if err != nil {
+		return "", err
+	}
+
+	var users []struct {
+		Type     string `json:"type"`
+		Username string `json:"username"`
+	}
+	err = json.Unmarshal(body, &users)
+	if err != nil {
+		return "", err
+	}
+	for _, user := range users {
+		if user.Type == "user" {
+			return user.Username, nil
+		}
+	}
+	return "", fmt.Errorf("instapaper didn't return the account: %s", body)
+}
+
+// Add saves a link to the account a token belongs to. Saving a link that's
+// already saved moves it back to the top.
+func (c *Client) Add(token *Token, link string, title string) error {
+	form := url.Values{"url": {link}}
+	if title != "" {
+		form.Set("title", title)
+	}
+	_, err := c.post("/api/1/bookmarks/add", token, form)
+	return err
+}
+
+// post sends a signed request to the API, returning the body of the response
+func (c *Client) post(path string, token *Token, form url.Values) ([]byte, error) {
+	endpoint := c.baseURL + path
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", c.authorization(endpoint, token, form))
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return nil, ErrInvalidCredentials
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("instapaper returned status %d: %s", resp.StatusCode, apiError(body))
+	}
+	return body, nil
+}
+
+// apiError returns the message of an error returned by the API, or the whole
+// body if it's not one
+func apiError(body []byte) string {
+	var errs []struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &errs) == nil {
+		for _, e := range errs {
+			if e.Type == "error" && e.Message != "" {
+				return e.Message
+			}
+		}
+	}
+	return string(body)
+}
+
+// authorization returns the OAuth 1.0a header of a request, signed with
+// HMAC-SHA1
+func (c *Client) authorization(endpoint string, token *Token, form url.Values) string {
+	oauth := map[string]string{
+		"oauth_consumer_key":     c.config.ConsumerKey,
+		"oauth_nonce":            c.nonce(),
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        strconv.FormatInt(c.now().Unix(), 10),
+		"oauth_version":          "1.0",
+	}
+	tokenSecret := ""
+	if token != nil {
+		oauth["oauth_token"] = token.Token
+		tokenSecret = token.Secret
+	}
+
+	oauth["oauth_signature"] = Signature(http.MethodPost, endpoint, oauth, form, c.config.ConsumerSecret, tokenSecret)
+
+	keys := make([]string, 0, len(oauth))
+	for key := range oauth {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, fmt.Sprintf(`%s="%s"`, percentEncode(key), percentEncode(oauth[key])))
+	}
+	return "OAuth " + strings.Join(params, ", ")
+}
+
+// Signature returns the OAuth 1.0a HMAC-SHA1 signature of a request with the
+// given oauth and form parameters (RFC 5849, section 3.4)
+func Signature(method string, endpoint string, oauth map[string]string, form url.Values, consumerSecret string, tokenSecret string) string {
+	var params []string
+	for key, value := range oauth {
+		params = append(params, percentEncode(key)+"="+percentEncode(value))
+	}
+	for key, values := range form {
+		for _, value := range values {
+			params = append(params, percentEncode(key)+"="+percentEncode(value))
+		}
+	}
+	sort.Strings(params)
+
+	base := strings.ToUpper(method) + "&" + percentEncode(endpoint) + "&" + percentEncode(strings.Join(params, "&"))
+
+	mac := hmac.New(sha1.New, []byte(percentEncode(consumerSecret)+"&"+percentEncode(tokenSecret)))
+	mac.Write([]byte(base))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// percentEncode encodes everything but unreserved characters, as OAuth wants
+// (url.QueryEscape turns spaces into "+")
+func percentEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+			c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
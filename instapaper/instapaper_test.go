@@ -0,0 +1,112 @@
+package instapaper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	// the example from twitter's "creating a signature" documentation
+	oauth := map[string]string{
+		"oauth_consumer_key":     "xvz1evFS4wEEPTGEFPHBog",
+		"oauth_nonce":            "kYjzVBB8Y0ZFabxSWbWovY3uYSQ2pTgmZeNu2VS4cg",
+		"oauth_signature_method": "HMAC-SHA1",
+		"oauth_timestamp":        "1318622958",
+		"oauth_token":            "370773112-GmHxMAgYyLbNEtIKZeRNFsMKPR9EyMZeS9weJAEb",
+		"oauth_version":          "1.0",
+	}
+	form := url.Values{
+		"include_entities": {"true"},
+		"status":           {"Hello Ladies + Gentlemen, a signed OAuth request!"},
+	}
+
+	got := Signature("POST", "https://api.twitter.com/1.1/statuses/update.json", oauth, form,
+		"kAcSOqF21Fu85e7zjz7ZN2U4ZRhfV3WpwPAoE3Z7kBw", "LswwdoUaIvS8ltyTt5jkRh4J50vUPVVHtR2YPi5kE")
+	if got != "hCtSmYh+iHYCEqBWrE7C7hYmtUk=" {
+		t.Errorf("Unexpected signature '%s'", got)
+	}
+}
+
+func newTestClient(server *httptest.Server) *Client {
+	c := New(Config{ConsumerKey: "key", ConsumerSecret: "secret"})
+	c.baseURL = server.URL
+	c.now = func() time.Time { return time.Unix(1700000000, 0) }
+	c.nonce = func() string { return "nonce" }
+	return c
+}
+
+func TestConnectAndAdd(t *testing.T) {
+	var added url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "OAuth ") || !strings.Contains(auth, `oauth_consumer_key="key"`) || !strings.Contains(auth, "oauth_signature=") {
+			t.Errorf("Expected a signed request, got '%s'", auth)
+		}
+
+		switch r.URL.Path {
+		case "/api/1/oauth/access_token":
+			if r.PostForm.Get("x_auth_password") != "hunter2" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte("oauth_token=tok&oauth_token_secret=toksecret"))
+		case "/api/1/account/verify_credentials":
+			if !strings.Contains(auth, `oauth_token="tok"`) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`[{"type":"user","user_id":1,"username":"alice@example.com"}]`))
+		case "/api/1/bookmarks/add":
+			if r.PostForm.Get("url") == "https://example.com/broken" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`[{"type":"error","error_code":1240,"message":"Invalid URL specified"}]`))
+				return
+			}
+			added = r.PostForm
+			w.Write([]byte(`[{"type":"bookmark","bookmark_id":1}]`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := newTestClient(server)
+	if !c.Enabled() || New(Config{}).Enabled() {
+		t.Errorf("Expected the client to be enabled only with a consumer key and secret")
+	}
+
+	if _, err := c.AccessToken("alice@example.com", "wrong"); err != ErrInvalidCredentials {
+		t.Errorf("Expected a wrong password to be rejected, got %v", err)
+	}
+
+	token, err := c.AccessToken("alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Token != "tok" || token.Secret != "toksecret" {
+		t.Fatalf("Unexpected token %v", token)
+	}
+
+	username, err := c.Username(token)
+	if err != nil || username != "alice@example.com" {
+		t.Errorf("Expected the account's username, got '%s' (%v)", username, err)
+	}
+
+	err = c.Add(token, "https://example.com/post", "A post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Get("url") != "https://example.com/post" || added.Get("title") != "A post" {
+		t.Errorf("Expected the post to be saved, got %v", added)
+	}
+
+	err = c.Add(token, "https://example.com/broken", "")
+	if err == nil || !strings.Contains(err.Error(), "Invalid URL specified") {
+		t.Errorf("Expected instapaper's error message, got %v", err)
+	}
+}
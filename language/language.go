@@ -0,0 +1,163 @@
+// Package language guesses which language a piece of text is written in,
+// which is used to let people filter Discover to the languages they read.
+package language
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// All lists every language that can be detected, by ISO 639-1 code, in
+// display order
+var All = []string{
+	"en", "es", "fr", "de", "it", "pt", "nl", "sv", "pl",
+	"ru", "el", "ar", "he", "ja", "zh", "ko",
+}
+
+var names = map[string]string{
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"de": "Deutsch",
+	"it": "Italiano",
+	"pt": "Português",
+	"nl": "Nederlands",
+	"sv": "Svenska",
+	"pl": "Polski",
+	"ru": "Русский",
+	"el": "Ελληνικά",
+	"ar": "العربية",
+	"he": "עברית",
+	"ja": "日本語",
+	"zh": "中文",
+	"ko": "한국어",
+}
+
+// common short words, they're what gives a language away in short texts like
+// titles. Words shared by several languages are left out.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "on", "this", "are", "you", "my", "how", "what", "why", "from", "about", "your"},
+	"es": {"el", "los", "las", "del", "que", "y", "por", "para", "con", "una", "es", "lo", "como", "más", "pero", "sus", "mi", "mis", "está", "qué", "cómo", "sobre"},
+	"fr": {"le", "les", "des", "et", "est", "une", "du", "dans", "pour", "pas", "qui", "sur", "au", "avec", "ce", "mon", "sont", "comment", "pourquoi", "aux", "cette"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ein", "eine", "zu", "den", "mit", "von", "auf", "für", "ich", "sich", "auch", "wie", "warum", "dem", "über"},
+	"it": {"il", "di", "che", "è", "gli", "della", "per", "non", "sono", "una", "nel", "come", "anche", "alla", "dei", "perché", "questo", "mio", "delle", "più"},
+	"pt": {"o", "os", "da", "do", "que", "não", "uma", "é", "com", "para", "em", "dos", "das", "mais", "como", "meu", "está", "você", "sobre", "porque"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "op", "voor", "met", "zijn", "ik", "ook", "hoe", "waarom", "wat", "naar", "maar", "mijn"},
+	"sv": {"och", "att", "det", "som", "är", "på", "för", "inte", "med", "jag", "av", "till", "om", "hur", "varför", "min", "ett", "den", "har", "vad"},
+	"pl": {"i", "w", "nie", "na", "się", "z", "jest", "że", "do", "to", "jak", "dlaczego", "co", "mój", "czy", "oraz", "przez", "od", "ale", "tak"},
+}
+
+// minimum number of stopwords needed to tell a latin script language apart
+const minStopwordHits = 2
+
+// Name returns the name of a language in that language, or the code itself
+// for unknown codes
+func Name(code string) string {
+	if name, ok := names[code]; ok {
+		return name
+	}
+	return code
+}
+
+// IsValid reports whether code is one of the languages mire knows about
+func IsValid(code string) bool {
+	_, ok := names[code]
+	return ok
+}
+
+// Normalize turns a language tag as found in feeds ("en-US", "EN_gb") into
+// one of the known codes, or an empty string if it isn't one of them
+func Normalize(tag string) string {
+	code, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+	code, _, _ = strings.Cut(code, "_")
+	if !IsValid(code) {
+		return ""
+	}
+	return code
+}
+
+// Detect guesses the language of some text. Returns an empty string if it
+// can't tell.
+func Detect(text string) string {
+	if code := detectScript(text); code != "" {
+		return code
+	}
+
+	hits := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), isWordSeparator) {
+		for code, words := range stopwords {
+			for _, w := range words {
+				if w == word {
+					hits[code]++
+				}
+			}
+		}
+	}
+
+	codes := make([]string, 0, len(hits))
+	for code := range hits {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if hits[codes[i]] != hits[codes[j]] {
+			return hits[codes[i]] > hits[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+
+	if len(codes) == 0 || hits[codes[0]] < minStopwordHits {
+		return ""
+	}
+	// a tie means we can't tell
+	if len(codes) > 1 && hits[codes[0]] == hits[codes[1]] {
+		return ""
+	}
+	return codes[0]
+}
+
+// detectScript recognizes the languages that are given away by their
+// alphabet alone
+func detectScript(text string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+
+		switch {
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		}
+	}
+
+	// japanese mixes kana with han characters
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > letters/2 {
+		return "ja"
+	}
+
+	for _, code := range []string{"ko", "zh", "ru", "el", "ar", "he"} {
+		if counts[code] > letters/2 {
+			return code
+		}
+	}
+	return ""
+}
+
+func isWordSeparator(r rune) bool {
+	return !unicode.IsLetter(r) && r != '\''
+}
@@ -0,0 +1,39 @@
+package language
+
+import (
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := map[string]string{
+		"How I moved my blog to a static site generator and why":        "en",
+		"Cómo aprendí a programar en mis ratos libres":                  "es",
+		"Pourquoi j'ai quitté les réseaux sociaux pour de bon":          "fr",
+		"Warum ich nicht mehr auf Twitter bin und was ich gelernt habe": "de",
+		"Почему я перестал пользоваться социальными сетями":             "ru",
+		"静的サイトジェネレーターに移行しました":                                           "ja",
+		"Hello": "",
+	}
+
+	for text, expected := range cases {
+		if got := Detect(text); got != expected {
+			t.Errorf("Detect(%q): expected '%s', got '%s'", text, expected, got)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	cases := map[string]string{
+		"en-US": "en",
+		"EN_gb": "en",
+		"pt-BR": "pt",
+		"tlh":   "",
+		"":      "",
+	}
+
+	for tag, expected := range cases {
+		if got := Normalize(tag); got != expected {
+			t.Errorf("Normalize(%q): expected '%s', got '%s'", tag, expected, got)
+		}
+	}
+}
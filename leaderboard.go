@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const numLeaderboardFeeds = 50
+
+type leaderboardEntry struct {
+	*sqlite.FeedSubscriberCount
+	Title string
+}
+
+// leaderboardHandler lists the feeds with the most subscribers on the instance
+func (s *Site) leaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	feeds, err := s.db.GetMostSubscribedFeeds(numLeaderboardFeeds)
+	if err != nil {
+		s.renderErr("leaderboardHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var entries []*leaderboardEntry
+	for _, feed := range feeds {
+		if s.feedBlocksDirectories(feed.URL) {
+			continue
+		}
+		entries = append(entries, &leaderboardEntry{
+			FeedSubscriberCount: feed,
+			Title:               s.feedTitle(feed.URL),
+		})
+	}
+
+	s.renderPage(w, r, "leaderboard", entries)
+}
+
+// feedBlocksDirectories returns whether the feed asks to not be listed in
+// directories through the <itunes:block> tag, which we treat as an opt out of
+// the leaderboard.
+func (s *Site) feedBlocksDirectories(feedURL string) bool {
+	if !s.reaper.HasFeed(feedURL) {
+		return false
+	}
+	feed := s.reaper.GetFeed(feedURL)
+	return feed.ITunesExt != nil && feed.ITunesExt.Block == "yes"
+}
+
+// feedLeaderboardHandler lets admins hide a feed from the leaderboard when
+// its owner asks for it.
+func (s *Site) feedLeaderboardHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("feedLeaderboardHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedLeaderboardHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetFeedHiddenFromLeaderboard(feedURL, r.FormValue("hide") == "on")
+	if err != nil {
+		s.renderErr("feedLeaderboardHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
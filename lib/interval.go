@@ -0,0 +1,36 @@
+package lib
+
+import (
+	"fmt"
+	"time"
+)
+
+// PostingInterval turns the average time between a feed's posts into roughly
+// how often it posts, eg. "every 3 days"
+func PostingInterval(interval time.Duration) string {
+	hours := int(interval.Hours())
+	days := hours / 24
+	weeks := days / 7
+	months := days / 30
+
+	switch {
+	case months >= 1:
+		return every(months, "month")
+	case weeks >= 1:
+		return every(weeks, "week")
+	case days >= 1:
+		return every(days, "day")
+	case hours >= 1:
+		return every(hours, "hour")
+	default:
+		return "more than once an hour"
+	}
+}
+
+// every is how often something happens, "every day" or "every 2 days"
+func every(n int, unit string) string {
+	if n == 1 {
+		return "every " + unit
+	}
+	return fmt.Sprintf("every %d %ss", n, unit)
+}
@@ -0,0 +1,32 @@
+package lib
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPostingInterval(t *testing.T) {
+	const day = 24 * time.Hour
+	for _, test := range []struct {
+		interval time.Duration
+		expected string
+	}{
+		{30 * time.Minute, "more than once an hour"},
+		{time.Hour, "every hour"},
+		{23 * time.Hour, "every 23 hours"},
+		{24 * time.Hour, "every day"},
+		{30 * time.Hour, "every day"},
+		{2 * day, "every 2 days"},
+		{6 * day, "every 6 days"},
+		{7 * day, "every week"},
+		{10 * day, "every week"},
+		{14 * day, "every 2 weeks"},
+		{29 * day, "every 4 weeks"},
+		{30 * day, "every month"},
+		{90 * day, "every 3 months"},
+	} {
+		if got := PostingInterval(test.interval); got != test.expected {
+			t.Errorf("Expected %s to be '%s', got '%s'", test.interval, test.expected, got)
+		}
+	}
+}
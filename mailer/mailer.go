@@ -0,0 +1,211 @@
+// Package mailer sends plain text emails through an SMTP server. The server
+// is configured with environment variables, an instance without them simply
+// doesn't send emails.
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/lib"
+)
+
+type Config struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// ConfigFromEnv reads the SMTP settings from MIRE_SMTP_HOST, MIRE_SMTP_PORT
+// (587 by default), MIRE_SMTP_USERNAME, MIRE_SMTP_PASSWORD and MIRE_SMTP_FROM
+func ConfigFromEnv() Config {
+	config := Config{
+		Host:     os.Getenv("MIRE_SMTP_HOST"),
+		Port:     os.Getenv("MIRE_SMTP_PORT"),
+		Username: os.Getenv("MIRE_SMTP_USERNAME"),
+		Password: os.Getenv("MIRE_SMTP_PASSWORD"),
+		From:     os.Getenv("MIRE_SMTP_FROM"),
+	}
+	if config.Port == "" {
+		config.Port = "587"
+	}
+	return config
+}
+
+type Mailer struct {
+	config Config
+
+	// swapped out by tests
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+}
+
+func New(config Config) *Mailer {
+	return &Mailer{config: config, sendMail: smtp.SendMail}
+}
+
+// Enabled reports whether the instance is set up to send emails
+func (m *Mailer) Enabled() bool {
+	return m.config.Host != "" && m.config.From != ""
+}
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+
+	// optional url people can visit to stop receiving these emails
+	Unsubscribe string
+
+	Attachments []*Attachment
+}
+
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+var errHeaderInjection = errors.New("header values can't contain line breaks")
+
+// Bytes renders the message as it's sent over the wire
+func (msg *Message) Bytes(from string) ([]byte, error) {
+	for _, value := range []string{from, msg.To, msg.Subject, msg.Unsubscribe} {
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, errHeaderInjection
+		}
+	}
+
+	var buf bytes.Buffer
+	header := func(key string, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", key, value)
+	}
+
+	header("From", from)
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", fmt.Sprintf("<%s@%s>", lib.GenerateSecureToken(16), domainOf(from)))
+	header("MIME-Version", "1.0")
+	if msg.Unsubscribe != "" {
+		header("List-Unsubscribe", "<"+msg.Unsubscribe+">")
+		header("List-Unsubscribe-Post", "List-Unsubscribe=One-Click")
+	}
+
+	if len(msg.Attachments) == 0 {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+
+		err := writeQuotedPrintable(&buf, msg.Body)
+		if err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	parts := multipart.NewWriter(&buf)
+	header("Content-Type", "multipart/mixed; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	text, err := parts.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = writeQuotedPrintable(text, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attachment := range msg.Attachments {
+		if strings.ContainsAny(attachment.Filename+attachment.ContentType, "\r\n\"") {
+			return nil, errHeaderInjection
+		}
+
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {attachment.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {`attachment; filename="` + attachment.Filename + `"`},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		// base64 lines can't be longer than 76 characters
+		encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+		for len(encoded) > 76 {
+			io.WriteString(part, encoded[:76]+"\r\n")
+			encoded = encoded[76:]
+		}
+		io.WriteString(part, encoded+"\r\n")
+	}
+
+	err = parts.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	_, err := qp.Write([]byte(strings.ReplaceAll(text, "\n", "\r\n")))
+	if err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// Send delivers a message, it's an error to call it when the mailer isn't
+// enabled
+func (m *Mailer) Send(msg *Message) error {
+	if !m.Enabled() {
+		return errors.New("mailer: no smtp server configured")
+	}
+
+	body, err := msg.Bytes(m.config.From)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if m.config.Username != "" {
+		auth = smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+	}
+
+	addr := net.JoinHostPort(m.config.Host, m.config.Port)
+	return m.sendMail(addr, auth, envelopeAddress(m.config.From), []string{msg.To}, body)
+}
+
+// envelopeAddress strips the display name from an address like
+// "mire <mire@example.com>"
+func envelopeAddress(address string) string {
+	if start := strings.LastIndex(address, "<"); start != -1 {
+		return strings.TrimSuffix(address[start+1:], ">")
+	}
+	return address
+}
+
+func domainOf(address string) string {
+	_, domain, found := strings.Cut(envelopeAddress(address), "@")
+	if !found {
+		return "localhost"
+	}
+	return domain
+}
@@ -0,0 +1,120 @@
+package mailer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"strings"
+	"testing"
+)
+
+func TestMessageBytes(t *testing.T) {
+	msg := &Message{
+		To:          "alice@example.com",
+		Subject:     "Your digest ✨",
+		Body:        "hello\nworld",
+		Unsubscribe: "https://example.com/unsubscribe/abc",
+	}
+
+	body, err := msg.Bytes("mire <mire@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := string(body)
+	for _, expected := range []string{
+		"From: mire <mire@example.com>\r\n",
+		"To: alice@example.com\r\n",
+		"Subject: =?utf-8?q?Your_digest_=E2=9C=A8?=\r\n",
+		"List-Unsubscribe: <https://example.com/unsubscribe/abc>\r\n",
+		"@example.com>\r\n",
+		"\r\n\r\nhello\r\nworld",
+	} {
+		if !strings.Contains(text, expected) {
+			t.Errorf("Expected the message to contain %q, got:\n%s", expected, text)
+		}
+	}
+
+	msg.Subject = "hi\r\nBcc: eve@example.com"
+	if _, err := msg.Bytes("mire@example.com"); err == nil {
+		t.Errorf("Expected line breaks in headers to be rejected")
+	}
+}
+
+func TestMessageWithAttachments(t *testing.T) {
+	data := bytes.Repeat([]byte("epub!"), 100)
+	msg := &Message{
+		To:      "alice@kindle.com",
+		Subject: "Your unread posts",
+		Body:    "see attached",
+		Attachments: []*Attachment{
+			{Filename: "unread.epub", ContentType: "application/epub+zip", Data: data},
+		},
+	}
+
+	body, err := msg.Bytes("mire@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Expected a multipart message, got %s (%v)", mediaType, err)
+	}
+
+	r := multipart.NewReader(parsed.Body, params["boundary"])
+	text, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := io.ReadAll(text); string(content) != "see attached" {
+		t.Errorf("Expected the text part first, got %q", content)
+	}
+
+	attachment, err := r.NextPart()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attachment.FileName() != "unread.epub" {
+		t.Errorf("Expected the attachment's file name, got %q", attachment.FileName())
+	}
+	encoded, _ := io.ReadAll(attachment)
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("Expected the attachment to round trip, got %v", err)
+	}
+}
+
+func TestSend(t *testing.T) {
+	m := New(Config{})
+	if m.Enabled() {
+		t.Errorf("Expected a mailer without a host to be disabled")
+	}
+	if err := m.Send(&Message{To: "alice@example.com"}); err == nil {
+		t.Errorf("Expected sending with a disabled mailer to fail")
+	}
+
+	m = New(Config{Host: "smtp.example.com", Port: "25", From: "mire <mire@example.com>"})
+	var gotAddr, gotFrom string
+	var gotTo []string
+	m.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		gotAddr, gotFrom, gotTo = addr, from, to
+		return nil
+	}
+
+	err := m.Send(&Message{To: "alice@example.com", Subject: "hi", Body: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAddr != "smtp.example.com:25" || gotFrom != "mire@example.com" || len(gotTo) != 1 || gotTo[0] != "alice@example.com" {
+		t.Errorf("Unexpected envelope: %s %s %v", gotAddr, gotFrom, gotTo)
+	}
+}
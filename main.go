@@ -9,11 +9,17 @@ import (
 	"syscall"
 
 	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/supervisor"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		runBench(os.Args[2:])
+		return
+	}
+
 	if constants.DEBUG_MODE {
 		log.Println("main: running in debug mode")
 	} else {
@@ -23,11 +29,23 @@ func main() {
 	s := New()
 	router := buildRouter(s)
 
-	go statsCalculatorProcess(s)
+	// stopped on interrupt (ctrl+c), or when a background process fails
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Setup channel to listen for interrupt signal (ctrl+c)
-	interruptChan := make(chan os.Signal, 1)
-	signal.Notify(interruptChan, os.Interrupt, syscall.SIGTERM)
+	group := supervisor.New(ctx)
+	s.reaper.Start(group)
+	group.Go("stats calculator", func(ctx context.Context) error { return statsCalculatorProcess(ctx, s) })
+	group.Go("digests", func(ctx context.Context) error { return digestProcess(ctx, s) })
+	group.Go("notifications", func(ctx context.Context) error { return notificationsProcess(ctx, s) })
+	group.Go("webhook delivery", func(ctx context.Context) error { return webhookDeliveryProcess(ctx, s) })
+	group.Go("archiver", func(ctx context.Context) error { return archiveProcess(ctx, s) })
+	group.Go("unsubscribe expiry", func(ctx context.Context) error { return unsubscribeExpiryProcess(ctx, s) })
+	group.Go("auto mark read", func(ctx context.Context) error { return autoMarkReadProcess(ctx, s) })
+	group.Go("read history expiry", func(ctx context.Context) error { return readHistoryExpiryProcess(ctx, s) })
+	if constants.DEBUG_MODE {
+		group.Go("template reloader", func(ctx context.Context) error { return templateReloaderProcess(ctx, s) })
+	}
 
 	server := &http.Server{Addr: ":5544", Handler: router}
 	go func() {
@@ -37,20 +55,25 @@ func main() {
 		}
 	}()
 
-	// Block until we receive our interrupt
-	<-interruptChan
+	<-group.Context().Done()
 
 	log.Println("main: shutting down server...")
 
+	if err := server.Shutdown(context.TODO()); err != nil {
+		log.Fatalf("main: server shutdown failed: %+v", err)
+	}
+
+	// the reaper saves the posts that were fetched but not saved yet before
+	// returning
+	if err := group.Wait(); err != nil {
+		log.Printf("[err] main: %s\n", err)
+	}
+
 	err := s.db.Close()
 	if err != nil {
 		log.Fatalf("main: database shutdown failed: %+v", err)
 	}
 
-	if err := server.Shutdown(context.TODO()); err != nil {
-		log.Fatalf("main: server shutdown failed: %+v", err)
-	}
-
 	log.Println("main: server gracefully stopped")
 }
 
@@ -71,26 +94,183 @@ func buildRouter(s *Site) *chi.Mux {
 	router.Use(middleware.CleanPath)
 
 	router.Get("/", s.indexHandler)
-	router.Get("/about", s.aboutHandler)
-	router.Get("/u/{username}", s.userHandler)
+	router.Get("/about", cacheForAnonymous(s.aboutHandler))
+	router.Get("/u/{username}", cacheForAnonymous(s.userHandler))
 	router.Get("/u/{username}/blogroll", s.userBlogrollHandler)
+	router.Get("/u/{username}/blogroll.json", s.userBlogrollJSONHandler)
+	router.Post("/u/{username}/blogroll/follow", s.followBlogrollHandler)
+	router.Post("/u/{username}/blogroll/unfollow", s.unfollowBlogrollHandler)
+	router.Get("/u/{username}/avatar", s.userAvatarHandler)
+	router.Post("/u/{username}/follow", s.followHandler)
+	router.Post("/u/{username}/unfollow", s.unfollowHandler)
+	router.Get("/c/{username}/{collection}", s.collectionHandler)
+	router.Post("/c/{username}/{collection}/subscribe", s.collectionSubscribeHandler)
+	router.Get("/collections", s.collectionsHandler)
+	router.Post("/collections", s.saveCollectionHandler)
+	router.Post("/collections/{slug}/delete", s.deleteCollectionHandler)
+	router.Get("/teams", s.teamsHandler)
+	router.Post("/teams", s.createTeamHandler)
+	router.Get("/teams/{slug}", s.teamHandler)
+	router.Post("/teams/{slug}/feeds", s.teamAddFeedsHandler)
+	router.Post("/teams/{slug}/feeds/remove", s.teamRemoveFeedHandler)
+	router.Post("/teams/{slug}/members", s.teamAddMemberHandler)
+	router.Post("/teams/{slug}/members/remove", s.teamRemoveMemberHandler)
+	router.Post("/teams/{slug}/posts", s.teamPostHandler)
+	router.Post("/teams/{slug}/delete", s.deleteTeamHandler)
+	router.Get("/alerts", s.alertsHandler)
+	router.Post("/alerts", s.addAlertHandler)
+	router.Post("/alerts/clear", s.clearAlertsHandler)
+	router.Post("/alerts/{id}/delete", s.deleteAlertHandler)
+	router.Get("/starred", s.starredHandler)
+	router.Get("/archive", s.archiveHandler)
+	router.Get("/starred.csv", s.starredCSVHandler)
+	router.Get("/activity", s.activityHandler)
+	router.Post("/activity/{id}/delete", s.deleteActivityHandler)
 	router.Get("/static/{file}", s.staticHandler)
-	router.Get("/discover", s.discoverHandler)
+	router.Get("/serviceworker.js", s.serviceWorkerHandler)
+	router.Get("/discover", cacheForAnonymous(s.discoverHandler))
+	router.Get("/discover/hot", cacheForAnonymous(s.discoverHotHandler))
+	router.Post("/discover/mutes", s.addDiscoverMuteHandler)
+	router.Post("/discover/mutes/delete", s.removeDiscoverMuteHandler)
+	router.Get("/leaderboard", s.leaderboardHandler)
+	router.Post("/recommendations/{url}/dismiss", s.dismissRecommendationHandler)
 	router.Get("/random", s.visitRandomPostHandler)
+	router.Get("/random/mine", s.visitRandomUnreadPostHandler)
+	router.Get("/share/{postID}", s.shareHandler)
+	router.Post("/share/{postID}/recommend", s.recommendPostHandler)
+	router.Post("/share/{postID}/unrecommend", s.unrecommendPostHandler)
+	router.Post("/share/{postID}/mastodon", s.shareToMastodonHandler)
+	router.Post("/share/{postID}/instapaper", s.saveToInstapaperHandler)
+	router.Post("/share/{postID}/wallabag", s.saveToWallabagHandler)
+	router.Post("/share/{postID}/star", s.starPostHandler)
+	router.Post("/share/{postID}/unstar", s.unstarPostHandler)
+	router.Post("/share/{postID}/comments", s.postCommentHandler)
+	router.Post("/comments/{id}/delete", s.deleteCommentHandler)
 	router.Get("/settings", s.settingsHandler)
-	router.Post("/settings/subscribe", s.settingsSubscribeHandler)
+	router.Post("/settings/subscriptions/add", s.settingsAddSubscriptionsHandler)
+	router.Post("/settings/import", s.settingsImportHandler)
+	router.Post("/settings/restore", s.settingsRestoreHandler)
+	router.Post("/settings/read-history/clear", s.settingsClearReadHistoryHandler)
+	router.Post("/settings/filters", s.settingsAddFilterHandler)
+	router.Post("/settings/filters/{id}/delete", s.settingsDeleteFilterHandler)
+	router.Post("/settings/subscriptions/remove", s.settingsRemoveSubscriptionHandler)
+	router.Post("/settings/subscriptions/remove-dead", s.settingsRemoveDeadFeedsHandler)
+	router.Post("/settings/subscriptions/undo", s.settingsUndoUnsubscribeHandler)
 	router.Post("/settings/change-password", s.changePasswordHandler)
 	router.Post("/settings/preferences", s.settingsPreferencesHandler)
+	router.Post("/settings/profile", s.settingsProfileHandler)
+	router.Post("/settings/mastodon/connect", s.mastodonConnectHandler)
+	router.Get("/settings/mastodon/callback", s.mastodonCallbackHandler)
+	router.Post("/settings/mastodon/disconnect", s.mastodonDisconnectHandler)
+	router.Post("/settings/mastodon/template", s.mastodonTemplateHandler)
+	router.Post("/settings/instapaper/connect", s.instapaperConnectHandler)
+	router.Post("/settings/instapaper/disconnect", s.instapaperDisconnectHandler)
+	router.Post("/settings/wallabag/connect", s.wallabagConnectHandler)
+	router.Post("/settings/wallabag/disconnect", s.wallabagDisconnectHandler)
+	router.Post("/settings/digest", s.settingsDigestHandler)
+	router.Post("/settings/kindle", s.settingsKindleHandler)
+	router.Post("/settings/ntfy", s.settingsNtfyHandler)
+	router.Post("/settings/ntfy/test", s.settingsNtfyTestHandler)
+	router.Post("/settings/push/test", s.settingsPushTestHandler)
+	router.Post("/settings/discord", s.settingsDiscordHandler)
+	router.Post("/settings/discord/{id}/delete", s.settingsDeleteDiscordHandler)
+	router.Post("/settings/slack", s.settingsSlackHandler)
+	router.Post("/settings/slack/{id}/delete", s.settingsDeleteSlackHandler)
+	router.Post("/settings/webhooks", s.settingsWebhookHandler)
+	router.Post("/settings/webhooks/{id}/delete", s.settingsDeleteWebhookHandler)
+	router.Post("/settings/matrix", s.settingsMatrixHandler)
+	router.Post("/settings/matrix/test", s.settingsMatrixTestHandler)
+	router.Post("/settings/readwise", s.settingsReadwiseHandler)
+	router.Post("/settings/bookmarks", s.settingsBookmarksHandler)
+	router.Post("/settings/apps/token", s.settingsCreateTokenHandler)
+	router.Post("/settings/apps/{id}/revoke", s.settingsRevokeAppHandler)
+	router.Get("/export/unread.epub", s.exportUnreadHandler)
+	router.Get("/export/subscriptions.opml", s.exportSubscriptionsHandler)
+	router.Get("/export/history.csv", s.exportHistoryHandler)
+	router.Get("/export/archive.json", s.exportArchiveHandler)
+	router.Post("/export/unread/kindle", s.sendToKindleHandler)
+	router.Get("/digest/unsubscribe/{token}", s.digestUnsubscribeHandler)
+	router.Post("/digest/unsubscribe/{token}", s.digestUnsubscribeHandler)
 	router.Get("/login", s.loginHandler)
 	router.Post("/login", s.loginHandler)
 	router.Get("/logout", s.logoutHandler)
 	router.Post("/logout", s.logoutHandler)
 	router.Post("/register", s.registerHandler)
+	router.Get("/welcome", s.welcomeHandler)
+	router.Get("/subscribe", s.subscribeHandler)
+	router.Post("/subscribe", s.subscribeConfirmHandler)
+	router.Post("/welcome/{slug}/subscribe", s.starterPackSubscribeHandler)
+	router.Get("/admin/starter-packs", s.adminStarterPacksHandler)
+	router.Post("/admin/starter-packs", s.adminSaveStarterPackHandler)
+	router.Post("/admin/starter-packs/{slug}/delete", s.adminDeleteStarterPackHandler)
+	router.Get("/admin/comments", s.adminCommentsHandler)
+	router.Post("/admin/comments/settings", s.adminCommentSettingsHandler)
+	router.Post("/admin/comments/user/{username}/delete", s.adminDeleteUserCommentsHandler)
+	router.Get("/admin/reports", s.adminReportsHandler)
+	router.Get("/admin/slack", s.adminSlackHandler)
+	router.Post("/admin/slack", s.adminSaveSlackHandler)
+	router.Get("/admin/db", s.adminDBHandler)
+	router.Post("/admin/db/reindex-search", s.adminReindexSearchHandler)
+	router.Get("/admin/runtime", s.adminRuntimeHandler)
+	router.Get("/admin/archive", s.adminArchiveHandler)
+	router.Post("/admin/archive", s.adminSaveArchiveHandler)
+	router.Get("/admin/stats", s.adminStatsHandler)
+	router.Post("/admin/stats", s.adminSaveStatsIntervalHandler)
+	router.Post("/admin/stats/recompute", s.adminRecomputeStatsHandler)
+	router.Post("/admin/reports/{id}", s.adminReportActionHandler)
 	router.Get("/feeds/{url}", s.feedDetailsHandler)
+	router.Post("/feeds/{url}/topics", s.feedTopicsHandler)
+	router.Post("/feeds/{url}/sensitive", s.feedSensitiveHandler)
+	router.Post("/feeds/{url}/discover", s.feedDiscoverHandler)
+	router.Post("/feeds/{url}/report", s.feedReportHandler)
+	router.Post("/feeds/{url}/leaderboard", s.feedLeaderboardHandler)
+	router.Post("/feeds/{url}/refresh", s.feedRefreshHandler)
+	router.Post("/feeds/{url}/refresh-interval", s.feedRefreshIntervalHandler)
+	router.Post("/feeds/{url}/subscribe", s.feedSubscribeHandler)
+	router.Post("/feeds/{url}/fediverse", s.feedFediverseHandler)
+	router.Post("/feeds/{url}/note", s.feedNoteHandler)
+	router.Post("/feeds/{url}/title", s.feedTitleHandler)
+	router.Post("/feeds/{url}/mute", s.feedMuteHandler)
+
+	// indieauth and microsub, so people can read mire in IndieWeb readers
+	router.Get("/.well-known/oauth-authorization-server", s.indieAuthMetadataHandler)
+	router.Get("/indieauth/auth", s.indieAuthHandler)
+	router.Post("/indieauth/auth", s.indieAuthPostHandler)
+	router.Get("/indieauth/token", s.indieAuthVerifyTokenHandler)
+	router.Post("/indieauth/token", s.indieAuthTokenHandler)
+	router.Get("/microsub", s.microsubHandler)
+	router.Post("/microsub", s.microsubHandler)
+
+	// activitypub, so people on the fediverse can follow what users recommend
+	router.Get("/.well-known/webfinger", s.webfingerHandler)
+	router.Get("/ap/u/{username}", s.activityPubActorHandler)
+	router.Post("/ap/u/{username}/inbox", s.activityPubInboxHandler)
+	router.Get("/ap/u/{username}/outbox", s.activityPubOutboxHandler)
+	router.Get("/ap/u/{username}/followers", s.activityPubFollowersHandler)
+	router.Get("/ap/u/{username}/recommendations/{postID}", s.activityPubNoteHandler)
 
 	// api functions
 	router.Post("/api/v1/set-post-read-status/{postUrl}", s.apiSetPostReadStatus)
 	router.Post("/api/v1/toggle-favorite-feed-status/{feedUrl}", s.apiSetFavoriteFeedHandler)
+	router.Post("/api/v1/toggle-feed-notify/{feedUrl}", s.apiSetFeedNotifyHandler)
+	router.Post("/api/v1/toggle-feed-mute/{feedUrl}", s.apiSetFeedMutedHandler)
+	router.Post("/api/v1/set-feed-title/{feedUrl}", s.apiSetFeedTitleHandler)
+	router.Get("/api/v1/unread-count", s.apiUnreadCountHandler)
+	router.Get("/api/v1/subscriptions/search", s.apiSubscriptionsSearchHandler)
+	router.Get("/api/v1/push/key", s.apiPushKeyHandler)
+	router.Post("/api/v1/push/subscribe", s.apiPushSubscribeHandler)
+	router.Post("/api/v1/push/unsubscribe", s.apiPushUnsubscribeHandler)
+	router.Get("/api/v1/extension/page", s.apiExtensionPageHandler)
+	router.Post("/api/v1/extension/subscribe", s.apiExtensionSubscribeHandler)
+	router.Post("/api/v1/extension/read-later", s.apiExtensionReadLaterHandler)
+	router.Post("/api/v1/subscriptions", s.apiBatchSubscriptionsHandler)
+	router.Get("/api/v1/triggers/starred", s.apiStarredTriggerHandler)
+	router.Get("/api/v1/triggers/alerts", s.apiAlertTriggerHandler)
+	router.Get("/api/v1/triage/current", s.apiTriageCurrentHandler)
+	router.Post("/api/v1/triage/next", s.apiTriageNextHandler)
+	router.Post("/api/v1/triage/previous", s.apiTriagePreviousHandler)
+	router.Post("/api/v1/triage/toggle-read", s.apiTriageToggleReadHandler)
+	router.Post("/api/v1/triage/open", s.apiTriageOpenHandler)
 	router.Get("/api/v1/ping", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("pong"))
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/reaper"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	defaultTootTemplate   = "{title}\n\n{url}"
+	maxTootTemplateLength = 400
+	mastodonScopes        = "read:accounts write:statuses"
+	mastodonStateCookie   = "mastodon_oauth_state"
+)
+
+var mastodonClient = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+func mastodonRedirectURI() string {
+	return constants.BASE_URL + "/settings/mastodon/callback"
+}
+
+// normalizeMastodonInstance turns whatever the user typed ("mastodon.social",
+// "https://mastodon.social/", "@me@mastodon.social") into the instance host
+func normalizeMastodonInstance(input string) (string, error) {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if i := strings.LastIndex(input, "@"); i >= 0 {
+		input = input[i+1:]
+	}
+	if !strings.Contains(input, "://") {
+		input = "https://" + input
+	}
+
+	u, err := url.Parse(input)
+	if err != nil || u.Host == "" || strings.ContainsAny(u.Host, " /") {
+		return "", fmt.Errorf("invalid mastodon instance '%s'", input)
+	}
+	return u.Host, nil
+}
+
+// renderToot fills in a toot template for the given post
+func renderToot(tootTemplate string, post *sqlite.Post, feedTitle string) string {
+	if tootTemplate == "" {
+		tootTemplate = defaultTootTemplate
+	}
+	if feedTitle == "" {
+		feedTitle = post.FeedURL
+	}
+
+	return strings.NewReplacer(
+		"{title}", post.Title,
+		"{url}", post.URL,
+		"{share_url}", constants.BASE_URL+shareURL(post.ID),
+		"{feed}", feedTitle,
+	).Replace(tootTemplate)
+}
+
+// mastodonRequest calls the API of a mastodon instance, decoding the JSON
+// response into `out` if it's not nil
+func mastodonRequest(req *http.Request, out any) error {
+	resp, err := mastodonClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s %s returned status %d: %s", req.Method, req.URL, resp.StatusCode, body)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
+
+func mastodonPostForm(endpoint string, form url.Values, out any) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return mastodonRequest(req, out)
+}
+
+// mastodonApp returns the app mire registered on an instance, registering it
+// the first time someone from that instance connects
+func (s *Site) mastodonApp(instance string) (*sqlite.MastodonApp, error) {
+	app, err := s.db.GetMastodonApp(instance)
+	if err != nil || app != nil {
+		return app, err
+	}
+
+	var registered struct {
+		ClientID     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+	}
+	err = mastodonPostForm("https://"+instance+"/api/v1/apps", url.Values{
+		"client_name":   {"Mire"},
+		"redirect_uris": {mastodonRedirectURI()},
+		"scopes":        {mastodonScopes},
+		"website":       {constants.BASE_URL},
+	}, &registered)
+	if err != nil {
+		return nil, err
+	}
+
+	app = &sqlite.MastodonApp{
+		Instance:     instance,
+		ClientID:     registered.ClientID,
+		ClientSecret: registered.ClientSecret,
+	}
+	return app, s.db.SaveMastodonApp(app)
+}
+
+// mastodonConnectHandler sends the user to their instance to authorize mire
+// to post on their behalf
+func (s *Site) mastodonConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("mastodonConnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	instance, err := normalizeMastodonInstance(r.FormValue("instance"))
+	if err != nil {
+		s.renderErr("mastodonConnectHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	app, err := s.mastodonApp(instance)
+	if err != nil {
+		e := fmt.Sprintf("could not register mire on '%s': %s", instance, err)
+		s.renderErr("mastodonConnectHandler", w, e, http.StatusBadGateway)
+		return
+	}
+
+	// the state ties the callback to this browser, and remembers the instance
+	state := lib.GenerateSecureToken(16)
+	http.SetCookie(w, &http.Cookie{
+		Name:     mastodonStateCookie,
+		Value:    state + "|" + instance,
+		Path:     "/settings/mastodon",
+		MaxAge:   600,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	authorizeURL := "https://" + instance + "/oauth/authorize?" + url.Values{
+		"client_id":     {app.ClientID},
+		"redirect_uri":  {mastodonRedirectURI()},
+		"response_type": {"code"},
+		"scope":         {mastodonScopes},
+		"state":         {state},
+	}.Encode()
+
+	http.Redirect(w, r, authorizeURL, http.StatusSeeOther)
+}
+
+// mastodonCallbackHandler is where instances send users back to after they
+// authorized mire
+func (s *Site) mastodonCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("mastodonCallbackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	cookie, err := r.Cookie(mastodonStateCookie)
+	if err != nil {
+		s.renderErr("mastodonCallbackHandler", w, "connecting took too long, please try again", http.StatusBadRequest)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: mastodonStateCookie, Path: "/settings/mastodon", MaxAge: -1})
+
+	state, instance, _ := strings.Cut(cookie.Value, "|")
+	if state == "" || r.URL.Query().Get("state") != state {
+		s.renderErr("mastodonCallbackHandler", w, "invalid oauth state", http.StatusBadRequest)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		// the user denied access
+		http.Redirect(w, r, "/settings#mastodon", http.StatusSeeOther)
+		return
+	}
+
+	app, err := s.db.GetMastodonApp(instance)
+	if err != nil || app == nil {
+		s.renderErr("mastodonCallbackHandler", w, fmt.Sprintf("unknown instance '%s'", instance), http.StatusBadRequest)
+		return
+	}
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	err = mastodonPostForm("https://"+instance+"/oauth/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"client_id":     {app.ClientID},
+		"client_secret": {app.ClientSecret},
+		"redirect_uri":  {mastodonRedirectURI()},
+		"scope":         {mastodonScopes},
+		"code":          {code},
+	}, &token)
+	if err != nil {
+		s.renderErr("mastodonCallbackHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "https://"+instance+"/api/v1/accounts/verify_credentials", nil)
+	if err != nil {
+		s.renderErr("mastodonCallbackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	var account struct {
+		Username string `json:"username"`
+	}
+	err = mastodonRequest(req, &account)
+	if err != nil {
+		s.renderErr("mastodonCallbackHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	err = s.db.SaveMastodonAccount(s.username(r), &sqlite.MastodonAccount{
+		Instance:    instance,
+		AccessToken: token.AccessToken,
+		AccountName: account.Username,
+	})
+	if err != nil {
+		s.renderErr("mastodonCallbackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#mastodon", http.StatusSeeOther)
+}
+
+func (s *Site) mastodonDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("mastodonDisconnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	account, err := s.db.GetMastodonAccount(username)
+	if err != nil {
+		s.renderErr("mastodonDisconnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if account != nil {
+		// best effort, the token is forgotten even if the instance is gone
+		if app, _ := s.db.GetMastodonApp(account.Instance); app != nil {
+			mastodonPostForm("https://"+account.Instance+"/oauth/revoke", url.Values{
+				"client_id":     {app.ClientID},
+				"client_secret": {app.ClientSecret},
+				"token":         {account.AccessToken},
+			}, nil)
+		}
+	}
+
+	err = s.db.DeleteMastodonAccount(username)
+	if err != nil {
+		s.renderErr("mastodonDisconnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#mastodon", http.StatusSeeOther)
+}
+
+func (s *Site) mastodonTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("mastodonTemplateHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	tootTemplate := strings.TrimSpace(strings.ReplaceAll(r.FormValue("template"), "\r\n", "\n"))
+	if len([]rune(tootTemplate)) > maxTootTemplateLength {
+		e := fmt.Sprintf("the template can be at most %d characters long", maxTootTemplateLength)
+		s.renderErr("mastodonTemplateHandler", w, e, http.StatusBadRequest)
+		return
+	}
+	if tootTemplate == defaultTootTemplate {
+		tootTemplate = ""
+	}
+
+	err := s.db.SetMastodonTootTemplate(s.username(r), tootTemplate)
+	if err != nil {
+		s.renderErr("mastodonTemplateHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#mastodon", http.StatusSeeOther)
+}
+
+// shareToMastodonHandler posts a post to the user's connected mastodon account
+func (s *Site) shareToMastodonHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("shareToMastodonHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("shareToMastodonHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	username := s.username(r)
+	account, err := s.db.GetMastodonAccount(username)
+	if err != nil {
+		s.renderErr("shareToMastodonHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if account == nil {
+		http.Redirect(w, r, "/settings#mastodon", http.StatusSeeOther)
+		return
+	}
+
+	status := renderToot(account.TootTemplate, post, s.feedTitle(post.FeedURL))
+	req, err := http.NewRequest(http.MethodPost, "https://"+account.Instance+"/api/v1/statuses",
+		strings.NewReader(url.Values{"status": {status}}.Encode()))
+	if err != nil {
+		s.renderErr("shareToMastodonHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+account.AccessToken)
+	// mastodon drops duplicates of the same key, so double clicks only toot once
+	req.Header.Set("Idempotency-Key", fmt.Sprintf("mire-%s-%d", username, postId))
+
+	err = mastodonRequest(req, nil)
+	if err != nil {
+		s.renderErr("shareToMastodonHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
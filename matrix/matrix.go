@@ -0,0 +1,138 @@
+// Package matrix sends messages to Matrix rooms with the client-server API
+// (https://spec.matrix.org/latest/client-server-api/), using an access token
+// of an account that joined the room.
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// max size of the response body read
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+type Client struct {
+	Homeserver  string
+	AccessToken string
+}
+
+type Message struct {
+	// plain text, shown by clients that don't render HTML
+	Body string
+
+	// optional HTML version of the body
+	FormattedBody string
+}
+
+// NormalizeHomeserver turns what someone typed ("matrix.org",
+// "https://matrix.example.com/") into the base URL of a homeserver
+func NormalizeHomeserver(homeserver string) (string, error) {
+	homeserver = strings.TrimSpace(homeserver)
+	if !strings.Contains(homeserver, "://") {
+		homeserver = "https://" + homeserver
+	}
+
+	u, err := url.Parse(homeserver)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || u.RawQuery != "" {
+		return "", fmt.Errorf("'%s' is not a homeserver URL", homeserver)
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+func (c *Client) do(method string, path string, body any, result any) error {
+	var reqBody io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.Homeserver+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.AccessToken)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var matrixErr struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+		if json.Unmarshal(respBody, &matrixErr) == nil && matrixErr.ErrCode != "" {
+			return fmt.Errorf("homeserver returned %s: %s", matrixErr.ErrCode, matrixErr.Error)
+		}
+		return fmt.Errorf("homeserver returned status %d", resp.StatusCode)
+	}
+
+	if result != nil {
+		return json.Unmarshal(respBody, result)
+	}
+	return nil
+}
+
+// ResolveRoom returns the id of a room given either its id (!abc:example.org)
+// or one of its aliases (#room:example.org)
+func (c *Client) ResolveRoom(room string) (string, error) {
+	room = strings.TrimSpace(room)
+	if strings.HasPrefix(room, "!") && strings.Contains(room, ":") {
+		return room, nil
+	}
+	if !strings.HasPrefix(room, "#") || !strings.Contains(room, ":") {
+		return "", errors.New("a room should look like !id:example.org or #alias:example.org")
+	}
+
+	var result struct {
+		RoomID string `json:"room_id"`
+	}
+	err := c.do(http.MethodGet, "/_matrix/client/v3/directory/room/"+url.PathEscape(room), nil, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.RoomID == "" {
+		return "", fmt.Errorf("could not find the room '%s'", room)
+	}
+	return result.RoomID, nil
+}
+
+// Send posts a notice to a room. Sending again with the same transaction id
+// doesn't post the message twice, so failed sends can be retried safely.
+func (c *Client) Send(roomID string, txnID string, msg *Message) error {
+	content := map[string]string{
+		"msgtype": "m.notice",
+		"body":    msg.Body,
+	}
+	if msg.FormattedBody != "" {
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = msg.FormattedBody
+	}
+
+	path := fmt.Sprintf("/_matrix/client/v3/rooms/%s/send/m.room.message/%s", url.PathEscape(roomID), url.PathEscape(txnID))
+	return c.do(http.MethodPut, path, content, nil)
+}
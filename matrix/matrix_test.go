@@ -0,0 +1,113 @@
+package matrix
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestNormalizeHomeserver(t *testing.T) {
+	for homeserver, expected := range map[string]string{
+		"matrix.org":                  "https://matrix.org",
+		"https://matrix.example.com/": "https://matrix.example.com",
+		"http://localhost:8008":       "http://localhost:8008",
+		"ftp://matrix.org":            "",
+		"https://user:pw@matrix.org":  "",
+		"https://matrix.org/?a=b":     "",
+	} {
+		got, err := NormalizeHomeserver(homeserver)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("Expected '%s' to be rejected, got '%s'", homeserver, got)
+			}
+			continue
+		}
+		if err != nil || got != expected {
+			t.Errorf("Expected '%s' to be '%s', got '%s' (%v)", homeserver, expected, got, err)
+		}
+	}
+}
+
+func TestSendAndResolveRoom(t *testing.T) {
+	var sentPath, auth string
+	var sent map[string]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/_matrix/client/v3/directory/room/#reading:example.org":
+			w.Write([]byte(`{"room_id": "!abc:example.org"}`))
+		case r.Method == http.MethodPut:
+			sentPath = r.URL.Path
+			json.NewDecoder(r.Body).Decode(&sent)
+			w.Write([]byte(`{"event_id": "$1"}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"errcode": "M_NOT_FOUND", "error": "Room alias not found"}`))
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Homeserver: server.URL, AccessToken: "token"}
+
+	roomID, err := c.ResolveRoom("#reading:example.org")
+	if err != nil || roomID != "!abc:example.org" {
+		t.Fatalf("Expected the alias to resolve to !abc:example.org, got '%s' (%v)", roomID, err)
+	}
+	if roomID, _ := c.ResolveRoom("!xyz:example.org"); roomID != "!xyz:example.org" {
+		t.Errorf("Expected room ids to be used as they are, got '%s'", roomID)
+	}
+	if _, err := c.ResolveRoom("#nope:example.org"); err == nil || err.Error() != "homeserver returned M_NOT_FOUND: Room alias not found" {
+		t.Errorf("Expected the homeserver's error, got %v", err)
+	}
+	if _, err := c.ResolveRoom("reading"); err == nil {
+		t.Errorf("Expected something that isn't a room to be rejected")
+	}
+
+	err = c.Send("!abc:example.org", "mire-1", &Message{Body: "hello", FormattedBody: "<b>hello</b>"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sentPath != "/_matrix/client/v3/rooms/!abc:example.org/send/m.room.message/mire-1" {
+		t.Errorf("Expected the message to be sent to the room, got %s", sentPath)
+	}
+	if auth != "Bearer token" {
+		t.Errorf("Expected the access token to be sent, got '%s'", auth)
+	}
+	if sent["msgtype"] != "m.notice" || sent["body"] != "hello" || sent["formatted_body"] != "<b>hello</b>" {
+		t.Errorf("Expected a notice with both bodies, got %v", sent)
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// homeservers inside the instance's network are only reached when it
+	// allows it
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	c := &Client{Homeserver: server.URL, AccessToken: "token"}
+	err := c.Send("!abc:example.org", "1", &Message{Body: "hi"})
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/matrix"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// posts listed in a single matrix message, the rest are counted in an "and N
+// more" line
+const numMatrixPostsPerMessage = 20
+
+// sendMatrixNotifications tells people in their Matrix room about the posts
+// saved since their last check, up to latestPostId, and about the feeds
+// that started failing
+func sendMatrixNotifications(s *Site, latestPostId int) {
+	notifications, err := s.db.GetMatrixNotifications()
+	if err != nil {
+		log.Printf("[err] sendMatrixNotifications: could not get notifications: %s\n", err)
+		return
+	}
+
+	for _, n := range notifications {
+		client := &matrix.Client{Homeserver: n.Homeserver, AccessToken: n.AccessToken}
+
+		if n.LastPostID < latestPostId {
+			err = s.sendMatrixPosts(client, n, latestPostId)
+			if err != nil {
+				// try again on the next check, the homeserver might be down
+				log.Printf("[err] sendMatrixNotifications: could not send the posts of '%s': %s\n", n.Username, err)
+			}
+		}
+
+		if n.FeedFailures {
+			err = s.sendMatrixFeedFailures(client, n)
+			if err != nil {
+				log.Printf("[err] sendMatrixNotifications: could not send the feed failures of '%s': %s\n", n.Username, err)
+			}
+		}
+	}
+}
+
+func (s *Site) sendMatrixPosts(client *matrix.Client, n *sqlite.MatrixNotification, latestPostId int) error {
+	var posts []*sqlite.NotificationPost
+	checkedUpTo := latestPostId
+
+	if n.Posts != sqlite.MatrixPostsNone {
+		newPosts, err := s.db.GetNewSubscribedPosts(n.Username, n.LastPostID, latestPostId, numNotificationPostsPerCheck)
+		if err != nil {
+			return err
+		}
+		if len(newPosts) == numNotificationPostsPerCheck {
+			checkedUpTo = newPosts[len(newPosts)-1].ID
+		}
+
+		for _, post := range newPosts {
+			if n.Posts == sqlite.MatrixPostsFavorites && !post.IsFavorite {
+				continue
+			}
+			posts = append(posts, post)
+		}
+	}
+
+	if len(posts) > 0 {
+		var text, formatted strings.Builder
+		text.WriteString("New posts on mire:\n")
+		formatted.WriteString("<p>New posts on mire:</p><ul>")
+		for i, post := range posts {
+			if i == numMatrixPostsPerMessage {
+				more := fmt.Sprintf("...and %d more", len(posts)-i)
+				text.WriteString(more + "\n")
+				formatted.WriteString("<li>" + more + "</li>")
+				break
+			}
+
+			feed := s.feedTitleOrDomain(post.FeedURL)
+			fmt.Fprintf(&text, "- %s (%s) %s\n", post.Title, feed, post.URL)
+			fmt.Fprintf(&formatted, `<li><a href="%s">%s</a> · %s</li>`,
+				html.EscapeString(post.URL), html.EscapeString(post.Title), html.EscapeString(feed))
+		}
+		formatted.WriteString("</ul>")
+
+		// the same range of posts always gets the same transaction id, so a
+		// retry after a timeout doesn't post the message twice
+		txnID := fmt.Sprintf("mire-posts-%d-%d", n.LastPostID, checkedUpTo)
+		err := client.Send(n.RoomID, txnID, &matrix.Message{
+			Body:          text.String(),
+			FormattedBody: formatted.String(),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.db.SetMatrixLastPostID(n.Username, checkedUpTo)
+}
+
+func (s *Site) sendMatrixFeedFailures(client *matrix.Client, n *sqlite.MatrixNotification) error {
+	feeds, err := s.db.GetNewlyFailingFeedsForMatrix(n.Username)
+	if err != nil || len(feeds) == 0 {
+		return err
+	}
+
+	var text, formatted strings.Builder
+	text.WriteString("Some of your feeds stopped working:\n")
+	formatted.WriteString("<p>Some of your feeds stopped working:</p><ul>")
+	for _, feed := range feeds {
+		fmt.Fprintf(&text, "- %s: %s\n", feed.URL, feed.Error)
+		fmt.Fprintf(&formatted, "<li>%s: <code>%s</code></li>", html.EscapeString(feed.URL), html.EscapeString(feed.Error))
+	}
+	formatted.WriteString("</ul>")
+	fmt.Fprintf(&text, "See %s/settings", constants.BASE_URL)
+	fmt.Fprintf(&formatted, `<p><a href="%s/settings">See your settings</a></p>`, constants.BASE_URL)
+
+	err = client.Send(n.RoomID, "mire-failures-"+strconv.FormatInt(time.Now().UnixNano(), 10), &matrix.Message{
+		Body:          text.String(),
+		FormattedBody: formatted.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.db.MarkMatrixFeedFailuresReported(n.Username, feeds)
+}
+
+// settingsMatrixHandler sets (or clears) the room notifications are sent
+// to. The access token is only asked for once, leaving it empty keeps the
+// one that was saved.
+func (s *Site) settingsMatrixHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsMatrixHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	if strings.TrimSpace(r.FormValue("homeserver")) == "" {
+		err := s.db.RemoveMatrixNotification(username)
+		if err != nil {
+			s.renderErr("settingsMatrixHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/settings#matrix", http.StatusSeeOther)
+		return
+	}
+
+	homeserver, err := matrix.NormalizeHomeserver(r.FormValue("homeserver"))
+	if err != nil {
+		s.renderErr("settingsMatrixHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	posts := r.FormValue("posts")
+	switch posts {
+	case sqlite.MatrixPostsAll, sqlite.MatrixPostsFavorites, sqlite.MatrixPostsNone:
+	default:
+		s.renderErr("settingsMatrixHandler", w, fmt.Sprintf("invalid posts value '%s'", posts), http.StatusBadRequest)
+		return
+	}
+
+	accessToken := strings.TrimSpace(r.FormValue("token"))
+	if accessToken == "" {
+		existing, err := s.db.GetMatrixNotification(username)
+		if err != nil {
+			s.renderErr("settingsMatrixHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if existing == nil || existing.Homeserver != homeserver {
+			s.renderErr("settingsMatrixHandler", w, "an access token is needed to send messages", http.StatusBadRequest)
+			return
+		}
+		accessToken = existing.AccessToken
+	}
+
+	client := &matrix.Client{Homeserver: homeserver, AccessToken: accessToken}
+	roomID, err := client.ResolveRoom(r.FormValue("room"))
+	if err != nil {
+		s.renderErr("settingsMatrixHandler", w, "could not find the room: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetMatrixNotification(&sqlite.MatrixNotification{
+		Username:     username,
+		Homeserver:   homeserver,
+		AccessToken:  accessToken,
+		RoomID:       roomID,
+		Posts:        posts,
+		FeedFailures: r.FormValue("failures") == "on",
+	})
+	if err != nil {
+		s.renderErr("settingsMatrixHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#matrix", http.StatusSeeOther)
+}
+
+// settingsMatrixTestHandler sends a message right away so people can check
+// that the bot account can post in the room
+func (s *Site) settingsMatrixTestHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsMatrixTestHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	n, err := s.db.GetMatrixNotification(s.username(r))
+	if err != nil {
+		s.renderErr("settingsMatrixTestHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if n == nil {
+		s.renderErr("settingsMatrixTestHandler", w, "set up a matrix room first", http.StatusBadRequest)
+		return
+	}
+
+	client := &matrix.Client{Homeserver: n.Homeserver, AccessToken: n.AccessToken}
+	err = client.Send(n.RoomID, "mire-test-"+strconv.FormatInt(time.Now().UnixNano(), 10), &matrix.Message{
+		Body: "Notifications from mire are working!",
+	})
+	if err != nil {
+		s.renderErr("settingsMatrixTestHandler", w, "could not send the message: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#matrix", http.StatusSeeOther)
+}
@@ -0,0 +1,486 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/indieauth"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// Microsub (https://indieweb.org/Microsub-spec) lets IndieWeb readers like
+// Monocle read mire timelines. Its channels are the timelines mire has: the
+// feeds people asked to be notified about, all of their feeds, and one per
+// collection.
+const (
+	microsubNotificationsChannel = "notifications"
+	microsubHomeChannel          = "default"
+	microsubCollectionPrefix     = "collection:"
+
+	microsubPageSize = 20
+)
+
+// microsubChannel is a timeline, as Microsub readers see it
+type microsubChannel struct {
+	UID    string `json:"uid"`
+	Name   string `json:"name"`
+	Unread int    `json:"unread"`
+}
+
+// microsubFilter returns the timeline a channel stands for, and the
+// collection for collection channels
+func (s *Site) microsubFilter(username string, channel string) (sqlite.TimelineFilter, *sqlite.Collection, error) {
+	switch channel {
+	case microsubHomeChannel, "":
+		return sqlite.TimelineFilter{}, nil, nil
+	case microsubNotificationsChannel:
+		return sqlite.TimelineFilter{NotifyOnly: true}, nil, nil
+	}
+
+	slug, ok := strings.CutPrefix(channel, microsubCollectionPrefix)
+	if !ok {
+		return sqlite.TimelineFilter{}, nil, fmt.Errorf("unknown channel '%s'", channel)
+	}
+	collection, err := s.db.GetCollection(username, slug)
+	if err != nil {
+		return sqlite.TimelineFilter{}, nil, err
+	}
+	if collection == nil {
+		return sqlite.TimelineFilter{}, nil, fmt.Errorf("unknown channel '%s'", channel)
+	}
+	return sqlite.TimelineFilter{CollectionSlug: slug}, collection, nil
+}
+
+// microsubHandler is the Microsub endpoint, which does what readers ask it to
+// through the action parameter
+func (s *Site) microsubHandler(w http.ResponseWriter, r *http.Request) {
+	token, err := s.indieAuthToken(r)
+	if err != nil {
+		s.renderOAuthErr("microsubHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if token == nil {
+		s.renderOAuthErr("microsubHandler", w, "unauthorized", "the token is missing or was revoked", http.StatusUnauthorized)
+		return
+	}
+
+	action := r.FormValue("action")
+	method := r.FormValue("method")
+
+	scope := "read"
+	switch {
+	case r.Method == http.MethodPost && action == "channels":
+		scope = "channels"
+	case r.Method == http.MethodPost && (action == "follow" || action == "unfollow"):
+		scope = "follow"
+	}
+	if !indieauth.HasScope(token.Scope, scope) {
+		s.renderOAuthErr("microsubHandler", w, "insufficient_scope", "this needs the "+scope+" scope", http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case action == "channels" && r.Method == http.MethodGet:
+		s.microsubChannels(w, token.Username)
+	case action == "channels" && method == "delete":
+		s.microsubDeleteChannel(w, r, token.Username)
+	case action == "channels":
+		s.microsubSaveChannel(w, r, token.Username)
+	case action == "timeline" && r.Method == http.MethodGet:
+		s.microsubTimeline(w, r, token.Username)
+	case action == "timeline" && (method == "mark_read" || method == "mark_unread"):
+		s.microsubMarkRead(w, r, token.Username, method == "mark_read")
+	case action == "follow" && r.Method == http.MethodGet:
+		s.microsubFollowing(w, r, token.Username)
+	case action == "follow":
+		s.microsubFollow(w, r, token.Username)
+	case action == "unfollow" && r.Method == http.MethodPost:
+		s.microsubUnfollow(w, r, token.Username)
+	case action == "search" && r.Method == http.MethodPost:
+		s.microsubSearch(w, r, token.Username)
+	default:
+		s.renderOAuthErr("microsubHandler", w, "invalid_request", fmt.Sprintf("'%s' is not a supported action", action), http.StatusBadRequest)
+	}
+}
+
+// microsubChannels lists someone's timelines, notifications first as
+// Microsub wants
+func (s *Site) microsubChannels(w http.ResponseWriter, username string) {
+	collections, err := s.db.GetUserCollections(username)
+	if err != nil {
+		s.renderOAuthErr("microsubChannels", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	channels := []microsubChannel{
+		{UID: microsubNotificationsChannel, Name: "Notifications"},
+		{UID: microsubHomeChannel, Name: "Home"},
+	}
+	for _, c := range collections {
+		channels = append(channels, microsubChannel{UID: microsubCollectionPrefix + c.Slug, Name: c.Name})
+	}
+
+	for i := range channels {
+		filter, _, err := s.microsubFilter(username, channels[i].UID)
+		if err == nil {
+			channels[i].Unread, err = s.db.GetTimelineUnreadCount(username, filter)
+		}
+		if err != nil {
+			s.renderOAuthErr("microsubChannels", w, "server_error", err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	s.renderJSON(w, struct {
+		Channels []microsubChannel `json:"channels"`
+	}{
+		Channels: channels,
+	})
+}
+
+var nonSlugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// microsubSaveChannel creates a collection, or renames one
+func (s *Site) microsubSaveChannel(w http.ResponseWriter, r *http.Request, username string) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		s.renderOAuthErr("microsubSaveChannel", w, "invalid_request", "a channel needs a name", http.StatusBadRequest)
+		return
+	}
+
+	var collection *sqlite.Collection
+	if uid := r.FormValue("channel"); uid != "" {
+		var err error
+		_, collection, err = s.microsubFilter(username, uid)
+		if err != nil {
+			s.renderOAuthErr("microsubSaveChannel", w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		if collection == nil {
+			s.renderOAuthErr("microsubSaveChannel", w, "invalid_request", "only collections can be renamed", http.StatusBadRequest)
+			return
+		}
+		collection.Name = name
+	} else {
+		// new collections get a slug made from their name, that isn't taken
+		base := strings.Trim(nonSlugRegex.ReplaceAllString(strings.ToLower(name), "-"), "-")
+		if base == "" {
+			base = "channel"
+		}
+		slug := base
+		for i := 2; ; i++ {
+			existing, err := s.db.GetCollection(username, slug)
+			if err != nil {
+				s.renderOAuthErr("microsubSaveChannel", w, "server_error", err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if existing == nil {
+				break
+			}
+			slug = base + "-" + strconv.Itoa(i)
+		}
+		collection = &sqlite.Collection{Username: username, Slug: slug, Name: name}
+	}
+
+	err := s.db.SaveCollection(collection)
+	if err != nil {
+		s.renderOAuthErr("microsubSaveChannel", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, microsubChannel{UID: microsubCollectionPrefix + collection.Slug, Name: collection.Name})
+}
+
+// microsubDeleteChannel deletes a collection
+func (s *Site) microsubDeleteChannel(w http.ResponseWriter, r *http.Request, username string) {
+	_, collection, err := s.microsubFilter(username, r.FormValue("channel"))
+	if err != nil {
+		s.renderOAuthErr("microsubDeleteChannel", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+	if collection == nil {
+		s.renderOAuthErr("microsubDeleteChannel", w, "invalid_request", "only collections can be deleted", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.DeleteCollection(username, collection.Slug)
+	if err != nil {
+		s.renderOAuthErr("microsubDeleteChannel", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct{}{})
+}
+
+// microsubEntry is a post, as Microsub readers see it (jf2)
+type microsubEntry struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"_id"`
+	IsRead    bool            `json:"_is_read"`
+	URL       string          `json:"url"`
+	Name      string          `json:"name,omitempty"`
+	Published string          `json:"published,omitempty"`
+	Photo     []string        `json:"photo,omitempty"`
+	Author    *microsubAuthor `json:"author,omitempty"`
+}
+
+type microsubAuthor struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// microsubTimeline returns a page of a channel's posts
+func (s *Site) microsubTimeline(w http.ResponseWriter, r *http.Request, username string) {
+	filter, _, err := s.microsubFilter(username, r.FormValue("channel"))
+	if err != nil {
+		s.renderOAuthErr("microsubTimeline", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// cursors are post ids, anything else starts from the newest posts
+	before, _ := strconv.Atoi(r.FormValue("before"))
+	after, _ := strconv.Atoi(r.FormValue("after"))
+
+	page, err := s.db.GetTimelinePage(username, filter, before, after, microsubPageSize)
+	if err != nil {
+		s.renderOAuthErr("microsubTimeline", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := []microsubEntry{}
+	for _, entry := range page.Entries {
+		item := microsubEntry{
+			Type:   "entry",
+			ID:     strconv.Itoa(entry.PostID),
+			IsRead: entry.IsRead,
+			URL:    entry.Post.Link,
+			Name:   entry.Post.Title,
+			Author: &microsubAuthor{
+				Type: "card",
+				Name: s.feedTitleOrDomain(entry.FeedURL),
+				URL:  entry.FeedURL,
+			},
+		}
+		if entry.Post.PublishedParsed != nil {
+			item.Published = entry.Post.PublishedParsed.Format(time.RFC3339)
+		}
+		if entry.ThumbnailURL != "" {
+			item.Photo = []string{entry.ThumbnailURL}
+		}
+		items = append(items, item)
+	}
+
+	paging := map[string]string{}
+	if page.Before > 0 {
+		paging["before"] = strconv.Itoa(page.Before)
+	}
+	if page.After > 0 {
+		paging["after"] = strconv.Itoa(page.After)
+	}
+
+	s.renderJSON(w, struct {
+		Items  []microsubEntry   `json:"items"`
+		Paging map[string]string `json:"paging"`
+	}{
+		Items:  items,
+		Paging: paging,
+	})
+}
+
+// microsubMarkRead marks posts as read or unread: the ones listed, or every
+// post of the channel up to one of them
+func (s *Site) microsubMarkRead(w http.ResponseWriter, r *http.Request, username string, read bool) {
+	filter, _, err := s.microsubFilter(username, r.FormValue("channel"))
+	if err != nil {
+		s.renderOAuthErr("microsubMarkRead", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if lastRead := r.FormValue("last_read_entry"); lastRead != "" && read {
+		lastReadId, err := strconv.Atoi(lastRead)
+		if err != nil {
+			s.renderOAuthErr("microsubMarkRead", w, "invalid_request", fmt.Sprintf("'%s' is not an entry", lastRead), http.StatusBadRequest)
+			return
+		}
+		err = s.db.MarkTimelineReadUpTo(username, filter, lastReadId)
+		if err != nil {
+			s.renderOAuthErr("microsubMarkRead", w, "server_error", err.Error(), http.StatusInternalServerError)
+			return
+		}
+		s.renderJSON(w, struct{}{})
+		return
+	}
+
+	var postIds []int
+	for _, entry := range append(r.Form["entry"], r.Form["entry[]"]...) {
+		postId, err := strconv.Atoi(entry)
+		if err != nil {
+			s.renderOAuthErr("microsubMarkRead", w, "invalid_request", fmt.Sprintf("'%s' is not an entry", entry), http.StatusBadRequest)
+			return
+		}
+		postIds = append(postIds, postId)
+	}
+	if len(postIds) == 0 {
+		s.renderOAuthErr("microsubMarkRead", w, "invalid_request", "no entry to mark", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetPostsReadStatus(username, postIds, read)
+	if err != nil {
+		s.renderOAuthErr("microsubMarkRead", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.renderJSON(w, struct{}{})
+}
+
+// microsubFeed is a feed, as Microsub readers see it
+type microsubFeed struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	Name string `json:"name,omitempty"`
+}
+
+// microsubFollowing lists the feeds of a channel
+func (s *Site) microsubFollowing(w http.ResponseWriter, r *http.Request, username string) {
+	_, collection, err := s.microsubFilter(username, r.FormValue("channel"))
+	if err != nil {
+		s.renderOAuthErr("microsubFollowing", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var feedURLs []string
+	switch {
+	case collection != nil:
+		feedURLs = collection.FeedURLs
+	case r.FormValue("channel") == microsubNotificationsChannel:
+		feedURLs, err = s.db.GetNotifyFeedURLs(username)
+	default:
+		feedURLs = s.db.GetUserFeedURLs(username)
+	}
+	if err != nil {
+		s.renderOAuthErr("microsubFollowing", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := []microsubFeed{}
+	for _, feedURL := range feedURLs {
+		items = append(items, microsubFeed{Type: "feed", URL: feedURL, Name: s.feedTitle(feedURL)})
+	}
+
+	s.renderJSON(w, struct {
+		Items []microsubFeed `json:"items"`
+	}{
+		Items: items,
+	})
+}
+
+// microsubFollow subscribes someone to a feed, adding it to the channel's
+// collection or turning on notifications for it
+func (s *Site) microsubFollow(w http.ResponseWriter, r *http.Request, username string) {
+	channel := r.FormValue("channel")
+	_, collection, err := s.microsubFilter(username, channel)
+	if err != nil {
+		s.renderOAuthErr("microsubFollow", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	feedURL := strings.TrimSpace(r.FormValue("url"))
+	if !s.reaper.HasFeed(feedURL) {
+		feedURL, err = resolveFeedURL(feedURL)
+		if err != nil {
+			s.renderOAuthErr("microsubFollow", w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := s.subscribeToFeeds(username, []string{feedURL}); err != nil {
+		var quotaErr quotaError
+		if errors.As(err, &quotaErr) {
+			s.renderOAuthErr("microsubFollow", w, "forbidden", err.Error(), quotaErr.code)
+			return
+		}
+		s.renderOAuthErr("microsubFollow", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case collection != nil && !slices.Contains(collection.FeedURLs, feedURL):
+		collection.FeedURLs = append(collection.FeedURLs, feedURL)
+		err = s.db.SaveCollection(collection)
+	case channel == microsubNotificationsChannel:
+		err = s.db.SetFeedNotify(username, feedURL, true)
+	}
+	if err != nil {
+		s.renderOAuthErr("microsubFollow", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, microsubFeed{Type: "feed", URL: feedURL, Name: s.feedTitle(feedURL)})
+}
+
+// microsubUnfollow takes a feed out of a channel: out of the collection, off
+// notifications, or unsubscribes from it for the home channel
+func (s *Site) microsubUnfollow(w http.ResponseWriter, r *http.Request, username string) {
+	channel := r.FormValue("channel")
+	_, collection, err := s.microsubFilter(username, channel)
+	if err != nil {
+		s.renderOAuthErr("microsubUnfollow", w, "invalid_request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	feedURL := strings.TrimSpace(r.FormValue("url"))
+	switch {
+	case collection != nil:
+		collection.FeedURLs = slices.DeleteFunc(collection.FeedURLs, func(u string) bool { return u == feedURL })
+		err = s.db.SaveCollection(collection)
+	case channel == microsubNotificationsChannel:
+		err = s.db.SetFeedNotify(username, feedURL, false)
+	default:
+		err = s.db.Unsubscribe(username, feedURL)
+		if err == nil {
+			s.db.DeleteOrphanedPostReads(username)
+			s.removeOrphanFeeds()
+		}
+	}
+	if err != nil {
+		s.renderOAuthErr("microsubUnfollow", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct{}{})
+}
+
+// microsubSearch finds the feeds of a web page
+func (s *Site) microsubSearch(w http.ResponseWriter, r *http.Request, username string) {
+	query := strings.TrimSpace(r.FormValue("query"))
+
+	// people often type a domain rather than a full URL
+	if !strings.Contains(query, "://") && !strings.HasPrefix(query, "@") {
+		query = "https://" + query
+	}
+
+	results := []microsubFeed{}
+	if feedURL, err := resolveFeedURL(query); err == nil {
+		feeds, err := s.pageFeeds(feedURL, nil)
+		if err != nil {
+			s.renderOAuthErr("microsubSearch", w, "invalid_request", err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, entry := range s.pageFeedEntries(username, feeds) {
+			results = append(results, microsubFeed{Type: "feed", URL: entry.URL, Name: entry.Title})
+		}
+	}
+
+	s.renderJSON(w, struct {
+		Results []microsubFeed `json:"results"`
+	}{
+		Results: results,
+	})
+}
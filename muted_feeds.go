@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// feedMuteHandler mutes or unmutes one of someone's feeds. Muted feeds stay
+// subscribed to, with what was read of them, but their posts stay out of the
+// timeline and the unread count.
+func (s *Site) feedMuteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedMuteHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedMuteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetFeedMuted(s.username(r), feedURL, r.FormValue("muted") == "true")
+	if err != nil {
+		s.renderErr("feedMuteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/feeds/"+url.QueryEscape(feedURL)), http.StatusSeeOther)
+}
+
+// apiSetFeedMutedHandler is feedMuteHandler for the settings page and apps
+func (s *Site) apiSetFeedMutedHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiSetFeedMutedHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("feedUrl"))
+	if err != nil || feedURL == "" {
+		s.renderErr("apiSetFeedMutedHandler", w, "Feed URL is required", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetFeedMuted(s.username(r), feedURL, r.FormValue("new_muted") == "true")
+	if err != nil {
+		s.renderErr("apiSetFeedMutedHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// normalizeMuteDomain accepts either a bare hostname or a full url and returns
+// the lowercased hostname, without a leading "www.".
+func normalizeMuteDomain(input string) string {
+	input = strings.ToLower(strings.TrimSpace(input))
+	if strings.Contains(input, "://") {
+		if parsed, err := url.Parse(input); err == nil {
+			input = parsed.Hostname()
+		}
+	}
+	input = strings.TrimSuffix(input, "/")
+	return strings.TrimPrefix(input, "www.")
+}
+
+// isPostMuted returns whether a post is hidden by any of the given mutes
+func isPostMuted(mutes []*sqlite.DiscoverMute, post *sqlite.Post) bool {
+	// medium posts are shown as medium.com/@someone
+	host, _, _ := strings.Cut(post.Domain, "/")
+
+	for _, m := range mutes {
+		switch m.Kind {
+		case sqlite.MuteKindFeed:
+			if m.Value == post.FeedURL {
+				return true
+			}
+		case sqlite.MuteKindDomain:
+			if host == m.Value || strings.HasSuffix(host, "."+m.Value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// localRedirectTarget returns the "next" form value if it points somewhere on
+// this site, otherwise it returns the fallback.
+func localRedirectTarget(r *http.Request, fallback string) string {
+	next := r.FormValue("next")
+	if strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//") {
+		return next
+	}
+	return fallback
+}
+
+// parseDiscoverMute reads and validates the mute passed in the form
+func parseDiscoverMute(r *http.Request) (*sqlite.DiscoverMute, error) {
+	m := &sqlite.DiscoverMute{
+		Kind:  r.FormValue("kind"),
+		Value: strings.TrimSpace(r.FormValue("value")),
+	}
+
+	switch m.Kind {
+	case sqlite.MuteKindFeed:
+	case sqlite.MuteKindDomain:
+		m.Value = normalizeMuteDomain(m.Value)
+	default:
+		return nil, fmt.Errorf("unknown mute kind '%s'", m.Kind)
+	}
+
+	if m.Value == "" {
+		return nil, fmt.Errorf("nothing to mute")
+	}
+	return m, nil
+}
+
+func (s *Site) addDiscoverMuteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("addDiscoverMuteHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	m, err := parseDiscoverMute(r)
+	if err != nil {
+		s.renderErr("addDiscoverMuteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.AddDiscoverMute(s.username(r), m.Kind, m.Value)
+	if err != nil {
+		s.renderErr("addDiscoverMuteHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/discover"), http.StatusSeeOther)
+}
+
+func (s *Site) removeDiscoverMuteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("removeDiscoverMuteHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	m, err := parseDiscoverMute(r)
+	if err != nil {
+		s.renderErr("removeDiscoverMuteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveDiscoverMute(s.username(r), m.Kind, m.Value)
+	if err != nil {
+		s.renderErr("removeDiscoverMuteHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/settings#discover-mutes"), http.StatusSeeOther)
+}
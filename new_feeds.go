@@ -0,0 +1,49 @@
+package main
+
+import (
+	"slices"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+const (
+	newFeedsWindowDays = 7
+	numNewFeeds        = 10
+)
+
+type newFeedEntry struct {
+	*sqlite.NewFeed
+	Title string
+}
+
+// getNewFeeds returns the feeds that joined the instance this week so that
+// fresh blogs get some visibility on discover. Logged in users don't see the
+// feeds they muted.
+func (s *Site) getNewFeeds(username string, userPreferences *user_preferences.UserPreferences) ([]*newFeedEntry, error) {
+	newFeeds, err := s.db.GetNewFeeds(newFeedsWindowDays, numNewFeeds)
+	if err != nil {
+		return nil, err
+	}
+
+	if username != "" {
+		mutes, err := s.db.GetDiscoverMutes(username)
+		if err != nil {
+			return nil, err
+		}
+
+		hideSensitive := userPreferences.SensitivePosts == user_preferences.SensitivePostsHide
+		newFeeds = slices.DeleteFunc(newFeeds, func(f *sqlite.NewFeed) bool {
+			return isPostMuted(mutes, f.LatestPost) || (hideSensitive && f.LatestPost.Sensitive)
+		})
+	}
+
+	entries := make([]*newFeedEntry, 0, len(newFeeds))
+	for _, f := range newFeeds {
+		entries = append(entries, &newFeedEntry{
+			NewFeed: f,
+			Title:   s.feedTitle(f.URL),
+		})
+	}
+	return entries, nil
+}
@@ -0,0 +1,368 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/mailer"
+	"codeberg.org/meadowingc/mire/ntfy"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+const (
+	// posts looked at per person (or webhook) on every check, the rest wait
+	// for the next
+	numNotificationPostsPerCheck = 200
+
+	// notifications sent per person on every check, anything past that is
+	// rolled into a single "and N more" notification
+	maxNtfyNotificationsPerCheck = 5
+
+	maxNtfyKeywords = 20
+)
+
+// notificationsProcess sends notifications about new posts through every
+// channel people set up, and stars to readwise, checking every so often
+func notificationsProcess(ctx context.Context, s *Site) error {
+	for {
+		latestPostId, err := s.db.GetLatestPostID()
+		if err != nil {
+			log.Printf("[err] notificationsProcess: could not get the latest post: %s\n", err)
+		} else {
+			sendNtfyNotifications(s, latestPostId)
+			sendPushNotifications(s, latestPostId)
+			sendDiscordNotifications(s, latestPostId)
+			sendSlackNotifications(s, latestPostId)
+			sendMatrixNotifications(s, latestPostId)
+			queueOutgoingWebhookEvents(s, latestPostId)
+			sendFeedNotificationEmails(s, latestPostId)
+		}
+		sendKeywordAlertNotifications(s)
+		sendReadwiseHighlights(s)
+
+		if !supervisor.Sleep(ctx, 5*time.Minute) {
+			return nil
+		}
+	}
+}
+
+// sendNtfyNotifications notifies people about the posts saved since their
+// last check, up to latestPostId
+func sendNtfyNotifications(s *Site, latestPostId int) {
+	subs, err := s.db.GetNtfySubscriptions()
+	if err != nil {
+		log.Printf("[err] sendNtfyNotifications: could not get subscriptions: %s\n", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.LastPostID >= latestPostId {
+			continue
+		}
+
+		posts, err := s.db.GetNewSubscribedPosts(sub.Username, sub.LastPostID, latestPostId, numNotificationPostsPerCheck)
+		if err != nil {
+			log.Printf("[err] sendNtfyNotifications: could not get the posts of '%s': %s\n", sub.Username, err)
+			continue
+		}
+
+		// if we couldn't look at every post this time, pick up where we
+		// stopped on the next check
+		checkedUpTo := latestPostId
+		if len(posts) == numNotificationPostsPerCheck {
+			checkedUpTo = posts[len(posts)-1].ID
+		}
+
+		err = s.notifyNtfy(sub, posts)
+		if err != nil {
+			// try again on the next check, the server might be down
+			log.Printf("[err] sendNtfyNotifications: could not notify '%s': %s\n", sub.Username, err)
+			continue
+		}
+
+		err = s.db.SetNtfyLastPostID(sub.Username, checkedUpTo)
+		if err != nil {
+			log.Printf("[err] sendNtfyNotifications: could not save progress for '%s': %s\n", sub.Username, err)
+		}
+	}
+}
+
+var feedNotificationTemplate = template.Must(template.New("feedNotification").Parse(`Hi {{ .Username }}, there's something new from feeds you asked to hear about right away:
+{{ range .Posts }}
+- {{ .Title }}
+  {{ .URL }}
+  {{ .Feed }}
+{{ end }}
+--
+You get this because you turned on the bell next to these feeds on mire.
+Change it: {{ .BaseURL }}/settings
+Unsubscribe from all emails: {{ .Unsubscribe }}
+`))
+
+type feedNotificationPost struct {
+	*sqlite.NotificationPost
+	Feed string
+}
+
+// sendFeedNotificationEmails emails people who asked for it about the posts
+// from the feeds they want to be notified about, saved since their last
+// check, up to latestPostId
+func sendFeedNotificationEmails(s *Site, latestPostId int) {
+	if !s.mailer.Enabled() {
+		return
+	}
+
+	recipients, err := s.db.GetDigestRecipients()
+	if err != nil {
+		log.Printf("[err] sendFeedNotificationEmails: could not get recipients: %s\n", err)
+		return
+	}
+
+	for _, recipient := range recipients {
+		if recipient.NotifyLastPostID >= latestPostId {
+			continue
+		}
+
+		checkedUpTo := latestPostId
+		userPreferences := user_preferences.GetUserPreferences(s.db, s.db.GetUserID(recipient.Username))
+		if userPreferences.NotifyByEmail {
+			posts, err := s.db.GetNewSubscribedPosts(recipient.Username, recipient.NotifyLastPostID, latestPostId, numNotificationPostsPerCheck)
+			if err != nil {
+				log.Printf("[err] sendFeedNotificationEmails: could not get the posts of '%s': %s\n", recipient.Username, err)
+				continue
+			}
+			if len(posts) == numNotificationPostsPerCheck {
+				checkedUpTo = posts[len(posts)-1].ID
+			}
+
+			err = s.sendFeedNotificationEmail(recipient, posts)
+			if err != nil {
+				// try again on the next check
+				log.Printf("[err] sendFeedNotificationEmails: could not email '%s': %s\n", recipient.Username, err)
+				continue
+			}
+		}
+
+		// people who don't want emails move along too, so that turning them
+		// on later doesn't send everything that was posted in between
+		err = s.db.SetEmailNotifyLastPostID(recipient.Username, checkedUpTo)
+		if err != nil {
+			log.Printf("[err] sendFeedNotificationEmails: could not save progress for '%s': %s\n", recipient.Username, err)
+		}
+	}
+}
+
+// sendFeedNotificationEmail sends a single email about every post from a feed
+// someone wants to be notified about. Nothing is sent if there's none.
+func (s *Site) sendFeedNotificationEmail(recipient *sqlite.DigestRecipient, posts []*sqlite.NotificationPost) error {
+	var notifyPosts []*feedNotificationPost
+	for _, post := range posts {
+		if post.Notify {
+			notifyPosts = append(notifyPosts, &feedNotificationPost{
+				NotificationPost: post,
+				Feed:             s.feedTitleOrDomain(post.FeedURL),
+			})
+		}
+	}
+
+	if len(notifyPosts) == 0 {
+		return nil
+	}
+
+	var body strings.Builder
+	err := feedNotificationTemplate.Execute(&body, map[string]any{
+		"Username":    recipient.Username,
+		"Posts":       notifyPosts,
+		"BaseURL":     constants.BASE_URL,
+		"Unsubscribe": digestUnsubscribeURL(recipient.UnsubscribeToken),
+	})
+	if err != nil {
+		return err
+	}
+
+	subject := fmt.Sprintf("New from %s: %s", notifyPosts[0].Feed, notifyPosts[0].Title)
+	if len(notifyPosts) > 1 {
+		subject = fmt.Sprintf("%d new posts from feeds you follow closely", len(notifyPosts))
+	}
+
+	return s.mailer.Send(&mailer.Message{
+		To:          recipient.Email,
+		Subject:     subject,
+		Body:        body.String(),
+		Unsubscribe: digestUnsubscribeURL(recipient.UnsubscribeToken),
+	})
+}
+
+// ntfyReason returns why someone should be notified about a post, or an
+// empty string if they shouldn't
+func ntfyReason(sub *sqlite.NtfySubscription, post *sqlite.NotificationPost) string {
+	if post.Notify {
+		return "notify"
+	}
+	if sub.NotifyFavorites && post.IsFavorite {
+		return "favorite"
+	}
+
+	title := strings.ToLower(post.Title)
+	for _, keyword := range sub.Keywords {
+		if strings.Contains(title, strings.ToLower(keyword)) {
+			return keyword
+		}
+	}
+
+	return ""
+}
+
+// notifyNtfy sends a notification for every post worth one
+func (s *Site) notifyNtfy(sub *sqlite.NtfySubscription, posts []*sqlite.NotificationPost) error {
+	more := 0
+	sent := 0
+	for _, post := range posts {
+		reason := ntfyReason(sub, post)
+		if reason == "" {
+			continue
+		}
+		if sent == maxNtfyNotificationsPerCheck {
+			more++
+			continue
+		}
+
+		n := &ntfy.Notification{
+			Title:   s.feedTitleOrDomain(post.FeedURL),
+			Message: post.Title,
+			Click:   post.URL,
+		}
+		if reason == "notify" {
+			n.Tags = []string{"bell"}
+		} else if reason == "favorite" {
+			n.Tags = []string{"star"}
+		} else {
+			n.Tags = []string{"mag"}
+			n.Message += fmt.Sprintf("\n(mentions \"%s\")", reason)
+		}
+
+		err := ntfy.Publish(sub.TopicURL, n)
+		if err != nil {
+			return err
+		}
+		sent++
+	}
+
+	if more > 0 {
+		return ntfy.Publish(sub.TopicURL, &ntfy.Notification{
+			Title:   "mire",
+			Message: fmt.Sprintf("...and %d more new posts you asked to hear about", more),
+			Click:   constants.BASE_URL + "/u/" + sub.Username,
+		})
+	}
+
+	return nil
+}
+
+// feedTitleOrDomain returns the title of a feed, or its domain for feeds we
+// don't know the title of
+func (s *Site) feedTitleOrDomain(feedURL string) string {
+	if title := strings.TrimSpace(s.feedTitle(feedURL)); title != "" {
+		return title
+	}
+	return s.printDomain(feedURL)
+}
+
+// parseNtfyKeywords splits the comma or newline separated keywords someone
+// typed, dropping blanks and duplicates
+func parseNtfyKeywords(value string) []string {
+	var keywords []string
+	seen := map[string]bool{}
+	for _, keyword := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		keyword = strings.TrimSpace(keyword)
+		if keyword == "" || seen[strings.ToLower(keyword)] {
+			continue
+		}
+		seen[strings.ToLower(keyword)] = true
+		keywords = append(keywords, keyword)
+	}
+	return keywords
+}
+
+// settingsNtfyHandler sets (or clears) the ntfy topic push notifications are
+// sent to, and what they're sent for
+func (s *Site) settingsNtfyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsNtfyHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	topic := strings.TrimSpace(r.FormValue("topic"))
+
+	if topic == "" {
+		err := s.db.RemoveNtfySubscription(username)
+		if err != nil {
+			s.renderErr("settingsNtfyHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/settings#ntfy", http.StatusSeeOther)
+		return
+	}
+
+	topicURL, err := ntfy.TopicURL(topic)
+	if err != nil {
+		s.renderErr("settingsNtfyHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	keywords := parseNtfyKeywords(r.FormValue("keywords"))
+	if len(keywords) > maxNtfyKeywords {
+		e := fmt.Sprintf("you can have at most %d keywords", maxNtfyKeywords)
+		s.renderErr("settingsNtfyHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetNtfySubscription(username, topicURL, r.FormValue("favorites") == "on", keywords)
+	if err != nil {
+		s.renderErr("settingsNtfyHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#ntfy", http.StatusSeeOther)
+}
+
+// settingsNtfyTestHandler sends a notification right away so people can
+// check that their phone gets it
+func (s *Site) settingsNtfyTestHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsNtfyTestHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	sub, err := s.db.GetNtfySubscription(s.username(r))
+	if err != nil {
+		s.renderErr("settingsNtfyTestHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if sub == nil {
+		s.renderErr("settingsNtfyTestHandler", w, "set an ntfy topic first", http.StatusBadRequest)
+		return
+	}
+
+	err = ntfy.Publish(sub.TopicURL, &ntfy.Notification{
+		Title:   "mire",
+		Message: "Notifications from mire are working!",
+		Click:   constants.BASE_URL + "/settings#ntfy",
+		Tags:    []string{"tada"},
+	})
+	if err != nil {
+		s.renderErr("settingsNtfyTestHandler", w, "could not send the notification: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#ntfy", http.StatusSeeOther)
+}
@@ -0,0 +1,96 @@
+// Package ntfy publishes push notifications to ntfy (https://ntfy.sh) topics,
+// which people can subscribe to from the ntfy phone app.
+package ntfy
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// DefaultServer is where bare topic names are published to
+const DefaultServer = "https://ntfy.sh"
+
+// max size of the response body read after publishing
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+var topicNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type Notification struct {
+	Title   string
+	Message string
+
+	// opened when the notification is tapped
+	Click string
+
+	// emoji shortcodes shown next to the title, see
+	// https://docs.ntfy.sh/emojis/
+	Tags []string
+}
+
+// TopicURL turns what someone typed into the URL of their topic. It can be
+// the full URL of a topic on any ntfy server or just the name of a topic on
+// DefaultServer.
+func TopicURL(topic string) (string, error) {
+	topic = strings.TrimSpace(topic)
+	if topicNameRegex.MatchString(topic) {
+		return DefaultServer + "/" + topic, nil
+	}
+
+	u, err := url.Parse(topic)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil {
+		return "", fmt.Errorf("'%s' is not a topic name or the URL of a topic", topic)
+	}
+
+	name := strings.TrimPrefix(u.Path, "/")
+	if !topicNameRegex.MatchString(name) || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("'%s' is not the URL of a topic", topic)
+	}
+
+	return u.Scheme + "://" + u.Host + "/" + name, nil
+}
+
+// Publish sends a notification to everyone subscribed to the topic
+func Publish(topicURL string, n *Notification) error {
+	req, err := http.NewRequest(http.MethodPost, topicURL, strings.NewReader(n.Message))
+	if err != nil {
+		return err
+	}
+
+	// headers can't hold newlines or (reliably) non-ascii text, ntfy decodes
+	// RFC 2047 encoded titles
+	if n.Title != "" {
+		req.Header.Set("Title", mime.QEncoding.Encode("utf-8", oneLine(n.Title)))
+	}
+	if n.Click != "" {
+		req.Header.Set("Click", oneLine(n.Click))
+	}
+	if len(n.Tags) > 0 {
+		req.Header.Set("Tags", oneLine(strings.Join(n.Tags, ",")))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("ntfy topic '%s' returned status %d", topicURL, resp.StatusCode)
+	}
+	return nil
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
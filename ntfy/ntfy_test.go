@@ -0,0 +1,112 @@
+package ntfy
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestTopicURL(t *testing.T) {
+	for topic, expected := range map[string]string{
+		"mire_alerts":                     "https://ntfy.sh/mire_alerts",
+		" mire-alerts ":                   "https://ntfy.sh/mire-alerts",
+		"https://ntfy.example.com/alerts": "https://ntfy.example.com/alerts",
+		"http://localhost:8080/alerts":    "http://localhost:8080/alerts",
+		"https://ntfy.sh/alerts?foo=bar":  "",
+		"https://ntfy.sh/alerts/json":     "",
+		"https://user:pw@ntfy.sh/alerts":  "",
+		"ftp://ntfy.sh/alerts":            "",
+		"not a topic":                     "",
+		"https://ntfy.sh/":                "",
+	} {
+		got, err := TopicURL(topic)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("Expected '%s' to be rejected, got '%s'", topic, got)
+			}
+			continue
+		}
+		if err != nil || got != expected {
+			t.Errorf("Expected '%s' to be '%s', got '%s' (%v)", topic, expected, got, err)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	var received *http.Request
+	var body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		b, _ := io.ReadAll(r.Body)
+		body = string(b)
+	}))
+	defer server.Close()
+
+	err := Publish(server.URL+"/alerts", &Notification{
+		Title:   "New post ✨\nfrom a feed",
+		Message: "Hello world",
+		Click:   "https://example.com/hello",
+		Tags:    []string{"star"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if received.Method != http.MethodPost || received.URL.Path != "/alerts" {
+		t.Errorf("Expected a POST to /alerts, got %s %s", received.Method, received.URL.Path)
+	}
+	if body != "Hello world" {
+		t.Errorf("Expected the message as the body, got '%s'", body)
+	}
+	if title := received.Header.Get("Title"); title != "=?utf-8?q?New_post_=E2=9C=A8_from_a_feed?=" {
+		t.Errorf("Expected an encoded single line title, got '%s'", title)
+	}
+	if click := received.Header.Get("Click"); click != "https://example.com/hello" {
+		t.Errorf("Expected the click header to be set, got '%s'", click)
+	}
+	if tags := received.Header.Get("Tags"); tags != "star" {
+		t.Errorf("Expected the tags header to be set, got '%s'", tags)
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer failing.Close()
+
+	if err := Publish(failing.URL+"/alerts", &Notification{Message: "hi"}); err == nil {
+		t.Errorf("Expected an error when the server refuses the notification")
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// ntfy servers inside the instance's network are only reached when it
+	// allows it
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	err := Publish(server.URL+"/alerts", &Notification{Message: "hi"})
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/supervisor"
+	"codeberg.org/meadowingc/mire/webhooks"
+)
+
+const (
+	maxOutgoingWebhooksPerUser = 5
+
+	// a delivery is given up on after this many attempts, which with the
+	// backoff in webhooks.RetryDelay spans a bit over four hours
+	maxWebhookAttempts = 9
+
+	numWebhookDeliveriesPerRound = 100
+	numRecentWebhookDeliveries   = 10
+
+	// delivered and failed deliveries are kept around this long, so people
+	// can see what was sent
+	webhookDeliveryRetention = 7 * 24 * time.Hour
+)
+
+// webhookPayload is the body of every delivery
+type webhookPayload struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+type webhookPost struct {
+	ID          int       `json:"id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	FeedURL     string    `json:"feed_url"`
+	FeedTitle   string    `json:"feed_title"`
+	IsFavorite  bool      `json:"is_favorite"`
+}
+
+type webhookFeedError struct {
+	FeedURL string `json:"feed_url"`
+	Error   string `json:"error"`
+}
+
+type webhookFavorite struct {
+	FeedURL    string `json:"feed_url"`
+	FeedTitle  string `json:"feed_title"`
+	IsFavorite bool   `json:"is_favorite"`
+}
+
+func (s *Site) queueWebhookEvent(webhook *sqlite.OutgoingWebhook, event string, data any) error {
+	payload, err := json.Marshal(webhookPayload{
+		Event:     event,
+		CreatedAt: time.Now().UTC(),
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+	return s.db.QueueWebhookDelivery(webhook.ID, event, string(payload))
+}
+
+// queueOutgoingWebhookEvents queues the new posts, up to latestPostId, and
+// the feeds that started failing since the last check for every webhook
+// that wants them
+func queueOutgoingWebhookEvents(s *Site, latestPostId int) {
+	outgoingWebhooks, err := s.db.GetOutgoingWebhooks()
+	if err != nil {
+		log.Printf("[err] queueOutgoingWebhookEvents: could not get webhooks: %s\n", err)
+		return
+	}
+
+	for _, webhook := range outgoingWebhooks {
+		wantsPosts := webhook.HasEvent(webhooks.EventNewPost) || webhook.HasEvent(webhooks.EventNotify)
+		if wantsPosts && webhook.LastPostID < latestPostId {
+			err = s.queueNewPostWebhooks(webhook, latestPostId)
+			if err != nil {
+				log.Printf("[err] queueOutgoingWebhookEvents: could not queue the posts of webhook %d: %s\n", webhook.ID, err)
+			}
+		}
+
+		if webhook.HasEvent(webhooks.EventFeedError) {
+			err = s.queueFeedErrorWebhooks(webhook)
+			if err != nil {
+				log.Printf("[err] queueOutgoingWebhookEvents: could not queue the feed errors of webhook %d: %s\n", webhook.ID, err)
+			}
+		}
+	}
+}
+
+func (s *Site) queueNewPostWebhooks(webhook *sqlite.OutgoingWebhook, latestPostId int) error {
+	posts, err := s.db.GetNewSubscribedPosts(webhook.Username, webhook.LastPostID, latestPostId, numNotificationPostsPerCheck)
+	if err != nil {
+		return err
+	}
+
+	checkedUpTo := latestPostId
+	if len(posts) == numNotificationPostsPerCheck {
+		checkedUpTo = posts[len(posts)-1].ID
+	}
+
+	for _, post := range posts {
+		payload := webhookPost{
+			ID:          post.ID,
+			Title:       post.Title,
+			URL:         post.URL,
+			PublishedAt: post.PublishedDatetime,
+			FeedURL:     post.FeedURL,
+			FeedTitle:   s.feedTitle(post.FeedURL),
+			IsFavorite:  post.IsFavorite,
+		}
+
+		if webhook.HasEvent(webhooks.EventNewPost) {
+			err = s.queueWebhookEvent(webhook, webhooks.EventNewPost, payload)
+			if err != nil {
+				return err
+			}
+		}
+
+		if post.Notify && webhook.HasEvent(webhooks.EventNotify) {
+			err = s.queueWebhookEvent(webhook, webhooks.EventNotify, payload)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return s.db.SetOutgoingWebhookLastPostID(webhook.ID, checkedUpTo)
+}
+
+func (s *Site) queueFeedErrorWebhooks(webhook *sqlite.OutgoingWebhook) error {
+	err := s.db.ForgetRecoveredFeeds(webhook.ID)
+	if err != nil {
+		return err
+	}
+
+	feeds, err := s.db.GetNewlyFailingFeeds(webhook.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, feed := range feeds {
+		err = s.queueWebhookEvent(webhook, webhooks.EventFeedError, webhookFeedError{
+			FeedURL: feed.URL,
+			Error:   feed.Error,
+		})
+		if err != nil {
+			return err
+		}
+
+		err = s.db.MarkFeedFailureReported(webhook.ID, feed.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// queueFavoriteWebhooks lets a user's webhooks know they (un)favorited a feed
+func (s *Site) queueFavoriteWebhooks(username string, feedURL string, isFavorite bool) {
+	outgoingWebhooks, err := s.db.GetUserOutgoingWebhooks(username)
+	if err != nil {
+		log.Printf("[err] queueFavoriteWebhooks: could not get the webhooks of '%s': %s\n", username, err)
+		return
+	}
+
+	for _, webhook := range outgoingWebhooks {
+		if !webhook.HasEvent(webhooks.EventFavorite) {
+			continue
+		}
+
+		err = s.queueWebhookEvent(webhook, webhooks.EventFavorite, webhookFavorite{
+			FeedURL:    feedURL,
+			FeedTitle:  s.feedTitle(feedURL),
+			IsFavorite: isFavorite,
+		})
+		if err != nil {
+			log.Printf("[err] queueFavoriteWebhooks: could not queue the event for webhook %d: %s\n", webhook.ID, err)
+		}
+	}
+}
+
+// webhookDeliveryProcess delivers the queued webhook events, retrying the
+// ones that fail with an increasing delay
+func webhookDeliveryProcess(ctx context.Context, s *Site) error {
+	for {
+		deliverDueWebhooks(s)
+
+		err := s.db.DeleteOldWebhookDeliveries(time.Now().Add(-webhookDeliveryRetention))
+		if err != nil {
+			log.Printf("[err] webhookDeliveryProcess: could not delete old deliveries: %s\n", err)
+		}
+
+		if !supervisor.Sleep(ctx, 30*time.Second) {
+			return nil
+		}
+	}
+}
+
+func deliverDueWebhooks(s *Site) {
+	deliveries, err := s.db.GetDueWebhookDeliveries(time.Now(), numWebhookDeliveriesPerRound)
+	if err != nil {
+		log.Printf("[err] deliverDueWebhooks: could not get deliveries: %s\n", err)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		status := sqlite.WebhookDeliveryDelivered
+		nextAttemptAt := time.Now()
+		lastError := ""
+
+		err := webhooks.Deliver(delivery.URL, delivery.Secret, delivery.ID, delivery.Event, []byte(delivery.Payload))
+		if err != nil {
+			lastError = err.Error()
+			attempts := delivery.Attempts + 1
+			if attempts >= maxWebhookAttempts {
+				status = sqlite.WebhookDeliveryFailed
+			} else {
+				status = sqlite.WebhookDeliveryPending
+				nextAttemptAt = time.Now().Add(webhooks.RetryDelay(attempts))
+			}
+		}
+
+		err = s.db.RecordWebhookDeliveryAttempt(delivery.ID, status, nextAttemptAt, lastError)
+		if err != nil {
+			log.Printf("[err] deliverDueWebhooks: could not save delivery %d: %s\n", delivery.ID, err)
+		}
+	}
+}
+
+// settingsWebhookHandler adds a webhook, with a newly generated secret, for
+// the events the user picked
+func (s *Site) settingsWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsWebhookHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	webhookURL := strings.TrimSpace(r.FormValue("url"))
+	if !webhooks.ValidURL(webhookURL) {
+		s.renderErr("settingsWebhookHandler", w, fmt.Sprintf("invalid webhook URL '%s'", webhookURL), http.StatusBadRequest)
+		return
+	}
+
+	r.ParseForm()
+	events := r.Form["events"]
+	if len(events) == 0 {
+		s.renderErr("settingsWebhookHandler", w, "pick at least one event", http.StatusBadRequest)
+		return
+	}
+	for _, event := range events {
+		if !webhooks.ValidEvent(event) {
+			s.renderErr("settingsWebhookHandler", w, fmt.Sprintf("unknown event '%s'", event), http.StatusBadRequest)
+			return
+		}
+	}
+
+	existing, err := s.db.GetUserOutgoingWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsWebhookHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(existing) >= maxOutgoingWebhooksPerUser {
+		e := fmt.Sprintf("you can have at most %d webhooks", maxOutgoingWebhooksPerUser)
+		s.renderErr("settingsWebhookHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.AddOutgoingWebhook(username, webhookURL, lib.GenerateSecureToken(32), events)
+	if err != nil {
+		s.renderErr("settingsWebhookHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#webhooks", http.StatusSeeOther)
+}
+
+func (s *Site) settingsDeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDeleteWebhookHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid webhook id '%s'", r.PathValue("id"))
+		s.renderErr("settingsDeleteWebhookHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveOutgoingWebhook(s.username(r), id)
+	if err != nil {
+		s.renderErr("settingsDeleteWebhookHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#webhooks", http.StatusSeeOther)
+}
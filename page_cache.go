@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// how long anonymous visitors can be shown a page rendered for someone
+	// else, unless new posts are saved before then
+	pageCacheTTL = time.Minute
+
+	// the most pages kept, query strings make for endless URLs
+	maxCachedPages = 500
+)
+
+type cachedPage struct {
+	header    http.Header
+	body      []byte
+	expiresAt time.Time
+}
+
+// pageCache keeps the pages rendered for anonymous visitors (and crawlers),
+// which are the same for all of them, so that they don't hit the database on
+// every request. It's emptied whenever the reaper saves new posts.
+var pageCache = struct {
+	sync.Mutex
+	pages map[string]*cachedPage
+}{
+	pages: make(map[string]*cachedPage),
+}
+
+// clearPageCache forgets every cached page
+func clearPageCache() {
+	pageCache.Lock()
+	clear(pageCache.pages)
+	pageCache.Unlock()
+}
+
+func getCachedPage(key string) *cachedPage {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+
+	page := pageCache.pages[key]
+	if page == nil || time.Now().After(page.expiresAt) {
+		return nil
+	}
+	return page
+}
+
+func cachePage(key string, page *cachedPage) {
+	pageCache.Lock()
+	defer pageCache.Unlock()
+
+	if len(pageCache.pages) >= maxCachedPages {
+		now := time.Now()
+		for k, p := range pageCache.pages {
+			if now.After(p.expiresAt) {
+				delete(pageCache.pages, k)
+			}
+		}
+		if len(pageCache.pages) >= maxCachedPages {
+			return
+		}
+	}
+	pageCache.pages[key] = page
+}
+
+// pageRecorder keeps a copy of the page a handler writes
+type pageRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+
+	// the headers as they were sent, handlers can change them after that
+	// to no effect
+	header http.Header
+}
+
+func (r *pageRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+		r.header = r.ResponseWriter.Header().Clone()
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *pageRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.WriteHeader(http.StatusOK)
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// cacheForAnonymous serves anonymous visitors the page the handler rendered
+// for the last one, for a little while. People who are logged in always get
+// a fresh page, theirs differs.
+func cacheForAnonymous(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, err := r.Cookie("session_token"); err == nil {
+			handler(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		if page := getCachedPage(key); page != nil {
+			for name, values := range page.header {
+				w.Header()[name] = values
+			}
+			w.Write(page.body)
+			return
+		}
+
+		recorder := &pageRecorder{ResponseWriter: w}
+		handler(recorder, r)
+
+		// errors and redirects aren't worth keeping
+		if recorder.status != http.StatusOK || recorder.header.Get("Set-Cookie") != "" {
+			return
+		}
+		cachePage(key, &cachedPage{
+			header:    recorder.header,
+			body:      recorder.body.Bytes(),
+			expiresAt: time.Now().Add(pageCacheTTL),
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const maxBioLength = 500
+const maxAvatarSize = 256 * 1024
+
+var allowedAvatarContentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+}
+
+// profileCard holds everything the "profile_card" template needs
+type profileCard struct {
+	User      string
+	Profile   *sqlite.UserProfile
+	AvatarURL string
+}
+
+func (s *Site) getProfileCard(username string) (*profileCard, error) {
+	profile, err := s.db.GetUserProfile(username)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profileCard{
+		User:      username,
+		Profile:   profile,
+		AvatarURL: s.avatarURL(username, profile),
+	}, nil
+}
+
+// avatarURL returns the url of a user's avatar, preferring an uploaded one
+// over libravatar. Returns an empty string if the user has no avatar.
+func (s *Site) avatarURL(username string, profile *sqlite.UserProfile) string {
+	if profile.HasAvatar {
+		return "/u/" + url.PathEscape(username) + "/avatar"
+	}
+	if profile.LibravatarHash != "" {
+		return "https://seccdn.libravatar.org/avatar/" + profile.LibravatarHash + "?s=160&d=retro"
+	}
+	return ""
+}
+
+// libravatarHash returns the hash libravatar uses to identify an email
+func libravatarHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *Site) userAvatarHandler(w http.ResponseWriter, r *http.Request) {
+	data, contentType, err := s.db.GetUserAvatar(r.PathValue("username"))
+	if err != nil {
+		s.renderErr("userAvatarHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if data == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	// browsers shouldn't take an avatar for anything but the image it says it
+	// is
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+func (s *Site) settingsProfileHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsProfileHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+
+	err := r.ParseMultipartForm(maxAvatarSize + 64*1024)
+	if err != nil && err != http.ErrNotMultipart {
+		s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	bio := strings.TrimSpace(r.FormValue("bio"))
+	if len([]rune(bio)) > maxBioLength {
+		e := fmt.Sprintf("bio can't be longer than %d characters", maxBioLength)
+		s.renderErr("settingsProfileHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	homepage := strings.TrimSpace(r.FormValue("homepage"))
+	if homepage != "" {
+		parsed, err := url.ParseRequestURI(homepage)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			e := fmt.Sprintf("homepage '%s' is not a valid http(s) url", homepage)
+			s.renderErr("settingsProfileHandler", w, e, http.StatusBadRequest)
+			return
+		}
+	}
+
+	hash := ""
+	if libravatarEmail := strings.TrimSpace(r.FormValue("libravatarEmail")); libravatarEmail != "" {
+		hash = libravatarHash(libravatarEmail)
+	} else if r.FormValue("keepLibravatar") == "on" {
+		profile, err := s.db.GetUserProfile(username)
+		if err != nil {
+			s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		hash = profile.LibravatarHash
+	}
+
+	err = s.db.UpdateUserProfile(username, bio, homepage, hash)
+	if err != nil {
+		s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if r.FormValue("removeAvatar") == "on" {
+		err = s.db.SetUserAvatar(username, nil, "")
+		if err != nil {
+			s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	file, _, err := r.FormFile("avatar")
+	if err == nil {
+		defer file.Close()
+
+		data, err := io.ReadAll(io.LimitReader(file, maxAvatarSize+1))
+		if err != nil {
+			s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(data) > maxAvatarSize {
+			e := fmt.Sprintf("avatar can't be bigger than %dKB", maxAvatarSize/1024)
+			s.renderErr("settingsProfileHandler", w, e, http.StatusBadRequest)
+			return
+		}
+
+		contentType := http.DetectContentType(data)
+		allowed := false
+		for _, t := range allowedAvatarContentTypes {
+			if contentType == t {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			e := fmt.Sprintf("unsupported avatar format '%s'", contentType)
+			s.renderErr("settingsProfileHandler", w, e, http.StatusBadRequest)
+			return
+		}
+
+		err = s.db.SetUserAvatar(username, data, contentType)
+		if err != nil {
+			s.renderErr("settingsProfileHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
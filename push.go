@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/webpush"
+)
+
+// max size of the subscriptions browsers send
+const maxPushSubscriptionSize = 4096
+
+// browsers a single person can get push notifications in
+const maxPushSubscriptions = 10
+
+// new post notifications replace each other rather than pile up
+const newPostsPushTag = "new-posts"
+
+var vapidKeyMutex sync.Mutex
+
+// vapidKey returns the key the instance identifies itself to push services
+// with, generating it the first time it's needed. Browsers subscribed with
+// its public key, changing it would silently break every subscription.
+func (s *Site) vapidKey() (*webpush.VAPIDKey, error) {
+	vapidKeyMutex.Lock()
+	defer vapidKeyMutex.Unlock()
+
+	encoded, err := s.db.GetSiteSetting(sqlite.SettingVAPIDKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded == "" {
+		encoded, err = webpush.GenerateVAPIDKey()
+		if err != nil {
+			return nil, err
+		}
+		err = s.db.SetSiteSetting(sqlite.SettingVAPIDKey, encoded)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return webpush.ParseVAPIDKey(encoded)
+}
+
+// sendPush sends a notification to a browser, forgetting the ones that
+// aren't subscribed anymore
+func (s *Site) sendPush(sub *sqlite.PushSubscription, n *webpush.Notification) error {
+	key, err := s.vapidKey()
+	if err != nil {
+		return err
+	}
+
+	pushSub := &webpush.Subscription{Endpoint: sub.Endpoint}
+	pushSub.Keys.P256dh = sub.P256dh
+	pushSub.Keys.Auth = sub.Auth
+
+	err = webpush.Send(pushSub, n, key, constants.BASE_URL)
+	if errors.Is(err, webpush.ErrGone) {
+		return s.db.DeletePushSubscription(sub.ID)
+	}
+	return err
+}
+
+// sendPushNotifications tells people's browsers about the posts saved since
+// their last check, up to latestPostId, in a single notification
+func sendPushNotifications(s *Site, latestPostId int) {
+	subs, err := s.db.GetPushSubscriptions()
+	if err != nil {
+		log.Printf("[err] sendPushNotifications: could not get subscriptions: %s\n", err)
+		return
+	}
+
+	for _, sub := range subs {
+		if sub.LastPostID >= latestPostId {
+			continue
+		}
+
+		posts, err := s.db.GetNewSubscribedPosts(sub.Username, sub.LastPostID, latestPostId, numNotificationPostsPerCheck)
+		if err != nil {
+			log.Printf("[err] sendPushNotifications: could not get the posts of '%s': %s\n", sub.Username, err)
+			continue
+		}
+
+		checkedUpTo := latestPostId
+		if len(posts) == numNotificationPostsPerCheck {
+			checkedUpTo = posts[len(posts)-1].ID
+		}
+
+		if len(posts) > 0 {
+			err = s.sendPush(sub, s.newPostsPushNotification(sub.Username, posts))
+			if err != nil {
+				// try again on the next check, the push service might be down
+				log.Printf("[err] sendPushNotifications: could not notify '%s': %s\n", sub.Username, err)
+				continue
+			}
+		}
+
+		err = s.db.SetPushSubscriptionLastPostID(sub.ID, checkedUpTo)
+		if err != nil {
+			log.Printf("[err] sendPushNotifications: could not save progress for '%s': %s\n", sub.Username, err)
+		}
+	}
+}
+
+// newPostsPushNotification returns the notification about someone's new
+// posts: the post itself when there's one, how many there are otherwise
+func (s *Site) newPostsPushNotification(username string, posts []*sqlite.NotificationPost) *webpush.Notification {
+	if len(posts) == 1 {
+		return &webpush.Notification{
+			Title: s.feedTitleOrDomain(posts[0].FeedURL),
+			Body:  posts[0].Title,
+			URL:   posts[0].URL,
+			Tag:   newPostsPushTag,
+		}
+	}
+
+	return &webpush.Notification{
+		Title: "mire",
+		Body:  fmt.Sprintf("%d new posts, the latest from %s", len(posts), s.feedTitleOrDomain(posts[len(posts)-1].FeedURL)),
+		URL:   constants.BASE_URL + "/u/" + username,
+		Tag:   newPostsPushTag,
+	}
+}
+
+// apiPushKeyHandler returns the key browsers subscribe to push notifications
+// with
+func (s *Site) apiPushKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := s.vapidKey()
+	if err != nil {
+		s.renderErr("apiPushKeyHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		PublicKey string `json:"public_key"`
+	}{
+		PublicKey: key.PublicKey(),
+	})
+}
+
+// readPushSubscription reads the subscription a browser posted, as
+// PushSubscription.toJSON() gives it
+func readPushSubscription(r *http.Request) (*webpush.Subscription, error) {
+	var sub webpush.Subscription
+	err := json.NewDecoder(io.LimitReader(r.Body, maxPushSubscriptionSize)).Decode(&sub)
+	if err != nil {
+		return nil, fmt.Errorf("could not read the subscription: %s", err)
+	}
+	return &sub, nil
+}
+
+// apiPushSubscribeHandler turns push notifications on in the browser that
+// sent its subscription
+func (s *Site) apiPushSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiPushSubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	sub, err := readPushSubscription(r)
+	if err == nil {
+		err = sub.Validate()
+	}
+	if err != nil {
+		s.renderErr("apiPushSubscribeHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	subs, err := s.db.GetUserPushSubscriptions(username)
+	if err != nil {
+		s.renderErr("apiPushSubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resubscribing := slices.ContainsFunc(subs, func(existing *sqlite.PushSubscription) bool {
+		return existing.Endpoint == sub.Endpoint
+	})
+	if len(subs) >= maxPushSubscriptions && !resubscribing {
+		e := fmt.Sprintf("you can get notifications in at most %d browsers, turn them off in one first", maxPushSubscriptions)
+		s.renderErr("apiPushSubscribeHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.AddPushSubscription(username, sub.Endpoint, sub.Keys.P256dh, sub.Keys.Auth)
+	if err != nil {
+		s.renderErr("apiPushSubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		Subscribed bool `json:"subscribed"`
+	}{
+		Subscribed: true,
+	})
+}
+
+// apiPushUnsubscribeHandler turns push notifications off in the browser that
+// sent its subscription
+func (s *Site) apiPushUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiPushUnsubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	sub, err := readPushSubscription(r)
+	if err != nil {
+		s.renderErr("apiPushUnsubscribeHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemovePushSubscription(s.username(r), sub.Endpoint)
+	if err != nil {
+		s.renderErr("apiPushUnsubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		Subscribed bool `json:"subscribed"`
+	}{
+		Subscribed: false,
+	})
+}
+
+// settingsPushTestHandler sends a notification to every browser someone
+// turned push notifications on in, so they can check they get them
+func (s *Site) settingsPushTestHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsPushTestHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	subs, err := s.db.GetUserPushSubscriptions(s.username(r))
+	if err != nil {
+		s.renderErr("settingsPushTestHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(subs) == 0 {
+		s.renderErr("settingsPushTestHandler", w, "turn notifications on in a browser first", http.StatusBadRequest)
+		return
+	}
+
+	for _, sub := range subs {
+		err = s.sendPush(sub, &webpush.Notification{
+			Title: "mire",
+			Body:  "Notifications from mire are working!",
+			URL:   constants.BASE_URL + "/settings#push",
+		})
+		if err != nil {
+			s.renderErr("settingsPushTestHandler", w, "could not send the notification: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+	}
+
+	http.Redirect(w, r, "/settings#push", http.StatusSeeOther)
+}
+
+// serviceWorkerHandler serves the service worker from the root, so that it
+// can work offline for every page and not just the ones under /static
+func (s *Site) serviceWorkerHandler(w http.ResponseWriter, r *http.Request) {
+	http.ServeFile(w, r, filepath.Join("files", "static", "serviceworker.js"))
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// how many feeds the quick switcher lists at most
+const maxQuickSwitcherResults = 10
+
+type quickSwitcherFeed struct {
+	Title   string `json:"title"`
+	Domain  string `json:"domain"`
+	FeedURL string `json:"feed_url"`
+	URL     string `json:"url"`
+}
+
+// apiSubscriptionsSearchHandler finds the feeds someone is subscribed to whose
+// title or domain loosely match what they typed, for the quick switcher (see
+// the tail template). With nothing typed it lists their feeds by title.
+func (s *Site) apiSubscriptionsSearchHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiSubscriptionsSearchHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+
+	username := s.username(r)
+	titles, err := s.db.GetSubscriptionTitles(username)
+	if err != nil {
+		s.renderErr("apiSubscriptionsSearchHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	type match struct {
+		feed  quickSwitcherFeed
+		score int
+	}
+
+	var matches []match
+	for _, feedURL := range s.db.GetUserFeedURLs(username) {
+		title, ok := titles[feedURL]
+		if !ok {
+			title = strings.TrimSpace(s.feedTitle(feedURL))
+		}
+		feed := quickSwitcherFeed{
+			Title:   title,
+			Domain:  s.printDomain(feedURL),
+			FeedURL: feedURL,
+			URL:     "/feeds/" + url.QueryEscape(feedURL),
+		}
+		if feed.Title == "" {
+			feed.Title = feed.Domain
+		}
+
+		titleScore, titleMatches := fuzzyScore(query, strings.ToLower(feed.Title))
+		domainScore, domainMatches := fuzzyScore(query, strings.ToLower(feed.Domain))
+		if !titleMatches && !domainMatches {
+			continue
+		}
+		matches = append(matches, match{feed, max(titleScore, domainScore)})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return strings.ToLower(matches[i].feed.Title) < strings.ToLower(matches[j].feed.Title)
+	})
+
+	feeds := []quickSwitcherFeed{}
+	for _, m := range matches[:min(len(matches), maxQuickSwitcherResults)] {
+		feeds = append(feeds, m.feed)
+	}
+	s.renderJSON(w, feeds)
+}
+
+// fuzzyScore tells whether the letters of query appear in text in order, and
+// how well they do: letters next to each other and at the start of words count
+// for more, and so do shorter texts. Both are lowercase already.
+func fuzzyScore(query string, text string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	textRunes := []rune(text)
+	score := 0
+	last := -1
+	i := 0
+	for _, q := range query {
+		for i < len(textRunes) && textRunes[i] != q {
+			i++
+		}
+		if i == len(textRunes) {
+			return 0, false
+		}
+
+		score++
+		if i == last+1 {
+			score += 3
+		}
+		if i == 0 || !unicode.IsLetter(textRunes[i-1]) && !unicode.IsDigit(textRunes[i-1]) {
+			score += 2
+		}
+		last = i
+		i++
+	}
+
+	if strings.Contains(text, query) {
+		score += 10
+	}
+	return score*10 - len(textRunes), true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// the subscription quotas of instances that don't set theirs
+const (
+	defaultMaxFeedsPerUser    = 2000
+	defaultMaxNewFeedsPerHour = 1000
+)
+
+// subscriptionQuota keeps any one account from pointing the reaper at more
+// feeds than the instance is willing to fetch for it, or from adding them
+// faster than it can take. A limit of 0 means no limit.
+type subscriptionQuota struct {
+	// how many feeds someone can be subscribed to
+	maxFeeds int
+
+	// how many feeds someone can subscribe to in an hour
+	maxNewFeedsPerHour int
+
+	mu sync.Mutex
+	// when each user subscribed to feeds during the last hour
+	added map[string][]time.Time
+}
+
+// subscriptionQuotaFromEnv reads the limits from MIRE_MAX_FEEDS_PER_USER and
+// MIRE_MAX_NEW_FEEDS_PER_HOUR, when they're set
+func subscriptionQuotaFromEnv() *subscriptionQuota {
+	return &subscriptionQuota{
+		maxFeeds:           reaper.EnvInt("MIRE_MAX_FEEDS_PER_USER", defaultMaxFeedsPerUser),
+		maxNewFeedsPerHour: reaper.EnvInt("MIRE_MAX_NEW_FEEDS_PER_HOUR", defaultMaxNewFeedsPerHour),
+		added:              make(map[string][]time.Time),
+	}
+}
+
+// quotaError is a subscription that would take someone over their quota, or
+// feeds the reaper won't have, see registerFeeds
+type quotaError struct {
+	msg string
+
+	// the status code to answer with
+	code int
+
+	// what the reaper said, for feeds it won't have
+	err error
+}
+
+func (e quotaError) Error() string {
+	return e.msg
+}
+
+func (e quotaError) Unwrap() error {
+	return e.err
+}
+
+// reserve makes room for username subscribing to numNew more feeds on top of
+// the numSubscribed they're subscribed to, or tells why it can't
+func (q *subscriptionQuota) reserve(username string, numSubscribed int, numNew int) error {
+	if numNew == 0 {
+		return nil
+	}
+
+	if q.maxFeeds > 0 && numSubscribed+numNew > q.maxFeeds {
+		msg := fmt.Sprintf("you can subscribe to at most %d feeds, you're subscribed to %d already and this would add %d",
+			q.maxFeeds, numSubscribed, numNew)
+		return quotaError{msg: msg, code: http.StatusForbidden}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var added []time.Time
+	for _, t := range q.added[username] {
+		if now.Sub(t) < time.Hour {
+			added = append(added, t)
+		}
+	}
+
+	if q.maxNewFeedsPerHour > 0 && len(added)+numNew > q.maxNewFeedsPerHour {
+		q.added[username] = added
+		msg := fmt.Sprintf("you can subscribe to at most %d feeds an hour, you subscribed to %d in the last hour and this would add %d, try again later",
+			q.maxNewFeedsPerHour, len(added), numNew)
+		return quotaError{msg: msg, code: http.StatusTooManyRequests}
+	}
+
+	for range numNew {
+		added = append(added, now)
+	}
+	q.added[username] = added
+	return nil
+}
+
+// release gives back the room reserve made for numNew feeds username didn't
+// subscribe to after all
+func (q *subscriptionQuota) release(username string, numNew int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	added := q.added[username]
+	q.added[username] = added[:max(len(added)-numNew, 0)]
+}
+
+// renderQuotaErr renders an error of subscribeToFeeds or registerFeeds
+func (s *Site) renderQuotaErr(caller string, w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	var quotaErr quotaError
+	if errors.As(err, &quotaErr) {
+		code = quotaErr.code
+	}
+	s.renderErr(caller, w, err.Error(), code)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+// readHistoryExpiryProcess forgets what people read once it's older than they
+// want it kept (see UserPreferences.ReadHistoryDays), every day
+func readHistoryExpiryProcess(ctx context.Context, s *Site) error {
+	for {
+		expireReadHistory(ctx, s)
+		if !supervisor.Sleep(ctx, 24*time.Hour) {
+			return nil
+		}
+	}
+}
+
+func expireReadHistory(ctx context.Context, s *Site) {
+	values, err := s.db.GetUsersWithPreference("readHistoryDays")
+	if err != nil {
+		log.Printf("[err] expireReadHistory: could not get who wants their history forgotten: %s\n", err)
+		return
+	}
+
+	for username, value := range values {
+		if ctx.Err() != nil {
+			return
+		}
+
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			continue
+		}
+
+		_, err = s.db.ForgetReadHistory(username, time.Now().AddDate(0, 0, -days))
+		if err != nil {
+			log.Printf("[err] expireReadHistory: could not forget the history of %s: %s\n", username, err)
+		}
+	}
+}
+
+// settingsClearReadHistoryHandler forgets everything someone read, now
+func (s *Site) settingsClearReadHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsClearReadHistoryHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	// a little in the future, for the posts read this very second
+	_, err := s.db.ForgetReadHistory(s.username(r), time.Now().Add(time.Minute))
+	if err != nil {
+		s.renderErr("settingsClearReadHistoryHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
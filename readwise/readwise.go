@@ -0,0 +1,146 @@
+// Package readwise sends highlights to Readwise with its API
+// (https://readwise.io/api_deets), using an access token people get from
+// https://readwise.io/access_token, and writes them in the CSV format
+// Readwise imports for people who'd rather not connect their account.
+package readwise
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	maxTextLength   = 8191
+	maxTitleLength  = 511
+	maxAuthorLength = 1024
+
+	// highlights sent per request
+	batchSize = 100
+)
+
+// max size of the response body read
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Timeout: 30 * time.Second}
+
+// swapped out by tests
+var baseURL = "https://readwise.io/api/v2"
+
+// ErrInvalidToken is returned when readwise doesn't accept an access token
+var ErrInvalidToken = errors.New("readwise didn't accept this access token")
+
+type Highlight struct {
+	Text          string    `json:"text"`
+	Title         string    `json:"title,omitempty"`
+	Author        string    `json:"author,omitempty"`
+	SourceURL     string    `json:"source_url,omitempty"`
+	SourceType    string    `json:"source_type,omitempty"`
+	Category      string    `json:"category,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	HighlightedAt time.Time `json:"highlighted_at"`
+	HighlightURL  string    `json:"highlight_url,omitempty"`
+}
+
+// truncate cuts a string to at most max characters
+func truncate(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	return string(runes[:max-1]) + "…"
+}
+
+// fit cuts the fields of a highlight to what readwise accepts
+func (h *Highlight) fit() *Highlight {
+	fitted := *h
+	fitted.Text = truncate(h.Text, maxTextLength)
+	fitted.Title = truncate(h.Title, maxTitleLength)
+	fitted.Author = truncate(h.Author, maxAuthorLength)
+	fitted.Note = truncate(h.Note, maxTextLength)
+	return &fitted
+}
+
+func do(req *http.Request, token string) error {
+	req.Header.Set("Authorization", "Token "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return ErrInvalidToken
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return fmt.Errorf("readwise returned status %d: %s", resp.StatusCode, body)
+	}
+	return nil
+}
+
+// CheckToken returns an error if readwise doesn't accept an access token
+func CheckToken(token string) error {
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/auth/", nil)
+	if err != nil {
+		return err
+	}
+	return do(req, token)
+}
+
+// Send creates highlights in the account a token belongs to. Readwise
+// updates highlights it already has (same text and source) instead of
+// creating them again, so sending one twice is fine.
+func Send(token string, highlights []*Highlight) error {
+	for start := 0; start < len(highlights); start += batchSize {
+		end := min(start+batchSize, len(highlights))
+
+		batch := make([]*Highlight, 0, end-start)
+		for _, h := range highlights[start:end] {
+			batch = append(batch, h.fit())
+		}
+
+		body, err := json.Marshal(map[string]any{"highlights": batch})
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, baseURL+"/highlights/", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		err = do(req, token)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteCSV writes highlights in readwise's CSV import format
+func WriteCSV(w io.Writer, highlights []*Highlight) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Highlight", "Title", "Author", "URL", "Note", "Location", "Date"})
+	for _, h := range highlights {
+		h = h.fit()
+		cw.Write([]string{
+			h.Text,
+			h.Title,
+			h.Author,
+			h.SourceURL,
+			h.Note,
+			"",
+			h.HighlightedAt.UTC().Format(time.DateTime),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,102 @@
+package readwise
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSend(t *testing.T) {
+	var batches [][]map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Token good" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/auth/":
+			w.WriteHeader(http.StatusNoContent)
+		case "/highlights/":
+			var body struct {
+				Highlights []map[string]any `json:"highlights"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			batches = append(batches, body.Highlights)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	baseURL = server.URL
+
+	if err := CheckToken("good"); err != nil {
+		t.Errorf("Expected the token to be accepted, got %v", err)
+	}
+	if err := CheckToken("bad"); err != ErrInvalidToken {
+		t.Errorf("Expected the token to be rejected, got %v", err)
+	}
+
+	var highlights []*Highlight
+	for i := 0; i < batchSize+1; i++ {
+		highlights = append(highlights, &Highlight{
+			Text:          "A post",
+			Title:         strings.Repeat("t", maxTitleLength+10),
+			SourceURL:     "https://example.com/post",
+			Category:      "articles",
+			HighlightedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		})
+	}
+
+	if err := Send("bad", highlights); err != ErrInvalidToken {
+		t.Errorf("Expected the token to be rejected, got %v", err)
+	}
+
+	err := Send("good", highlights)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batches) != 2 || len(batches[0]) != batchSize || len(batches[1]) != 1 {
+		t.Fatalf("Expected the highlights to be sent in two batches, got %d", len(batches))
+	}
+	first := batches[0][0]
+	if first["text"] != "A post" || first["source_url"] != "https://example.com/post" || first["highlighted_at"] != "2024-01-02T03:04:05Z" {
+		t.Errorf("Unexpected highlight %v", first)
+	}
+	if title := first["title"].(string); len([]rune(title)) != maxTitleLength {
+		t.Errorf("Expected the title to be truncated to %d characters, got %d", maxTitleLength, len([]rune(title)))
+	}
+	if _, ok := first["note"]; ok {
+		t.Errorf("Expected empty notes to be left out, got %v", first)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var b strings.Builder
+	err := WriteCSV(&b, []*Highlight{{
+		Text:          "Some \"quoted\" text, with a comma",
+		Title:         "A post",
+		Author:        "A blog",
+		SourceURL:     "https://example.com/post",
+		Note:          "worth rereading",
+		HighlightedAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || strings.Join(records[0], ",") != "Highlight,Title,Author,URL,Note,Location,Date" {
+		t.Fatalf("Expected a header and a highlight, got %v", records)
+	}
+	expected := []string{"Some \"quoted\" text, with a comma", "A post", "A blog", "https://example.com/post", "worth rereading", "", "2024-01-02 03:04:05"}
+	if strings.Join(records[1], "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, records[1])
+	}
+}
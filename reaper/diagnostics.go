@@ -0,0 +1,100 @@
+package reaper
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// fetchTracker keeps track of the fetches in flight and of how long the last
+// fetch of each feed took, for Diagnostics
+type fetchTracker struct {
+	mu       sync.Mutex
+	inFlight map[string]time.Time
+	took     map[string]time.Duration
+}
+
+func newFetchTracker() *fetchTracker {
+	return &fetchTracker{
+		inFlight: make(map[string]time.Time),
+		took:     make(map[string]time.Duration),
+	}
+}
+
+func (t *fetchTracker) start(url string) time.Time {
+	now := time.Now()
+	t.mu.Lock()
+	t.inFlight[url] = now
+	t.mu.Unlock()
+	return now
+}
+
+func (t *fetchTracker) done(url string, started time.Time) {
+	t.mu.Lock()
+	delete(t.inFlight, url)
+	t.took[url] = time.Since(started)
+	t.mu.Unlock()
+}
+
+func (t *fetchTracker) forget(url string) {
+	t.mu.Lock()
+	delete(t.took, url)
+	t.mu.Unlock()
+}
+
+// FetchDiagnostics is a fetch of a feed, the one in flight or the last one
+type FetchDiagnostics struct {
+	URL      string
+	Duration time.Duration
+}
+
+// Diagnostics is what the reaper is up to, to see what's wrong when it's
+// struggling
+type Diagnostics struct {
+	NumFeeds int
+
+	// feeds waiting for a fetch worker
+	NumQueued int
+
+	// posts fetched but not saved yet
+	NumPendingPosts int
+
+	// the fetches in flight, the longest running first
+	InFlight []FetchDiagnostics
+
+	// the last fetch of every feed, the slowest first
+	LastFetches []FetchDiagnostics
+}
+
+// Diagnostics returns what the reaper is up to right now
+func (r *Reaper) Diagnostics() Diagnostics {
+	r.mu.RLock()
+	numFeeds := len(r.feeds)
+	r.mu.RUnlock()
+
+	d := Diagnostics{
+		NumFeeds:        numFeeds,
+		NumQueued:       r.queue.len(),
+		NumPendingPosts: int(r.pendingPosts.Load()),
+	}
+
+	now := time.Now()
+	r.tracker.mu.Lock()
+	for url, started := range r.tracker.inFlight {
+		d.InFlight = append(d.InFlight, FetchDiagnostics{URL: url, Duration: now.Sub(started)})
+	}
+	for url, took := range r.tracker.took {
+		d.LastFetches = append(d.LastFetches, FetchDiagnostics{URL: url, Duration: took})
+	}
+	r.tracker.mu.Unlock()
+
+	slowestFirst := func(fetches []FetchDiagnostics) {
+		sort.Slice(fetches, func(i, j int) bool {
+			return fetches[i].Duration > fetches[j].Duration
+		})
+	}
+	slowestFirst(d.InFlight)
+	slowestFirst(d.LastFetches)
+
+	return d
+}
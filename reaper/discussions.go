@@ -0,0 +1,115 @@
+package reaper
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// sites whose feeds are lists of links people discuss, where a post has both
+// the article it links to and its comments
+var discussionHosts = []string{"reddit.com", "news.ycombinator.com"}
+
+// reddit puts the article a post links to in its content, the entry's link
+// being the comments
+var redditArticleRegexp = regexp.MustCompile(`<a href="([^"]+)">\[link\]</a>`)
+
+// rssTranslator is gofeed's RSS translator, which also keeps the comments
+// link of items (hacker news puts it there)
+type rssTranslator struct {
+	gofeed.DefaultRSSTranslator
+}
+
+func (t *rssTranslator) Translate(feed interface{}) (*gofeed.Feed, error) {
+	result, err := t.DefaultRSSTranslator.Translate(feed)
+	if err != nil {
+		return nil, err
+	}
+
+	rssFeed, ok := feed.(*rss.Feed)
+	if !ok || len(rssFeed.Items) != len(result.Items) {
+		return nil, fmt.Errorf("unexpected rss feed translation")
+	}
+
+	for i, rssItem := range rssFeed.Items {
+		if rssItem.Comments == "" {
+			continue
+		}
+
+		// don't write to the map gofeed shares with the rss item
+		custom := map[string]string{commentsKey: rssItem.Comments}
+		for key, value := range result.Items[i].Custom {
+			custom[key] = value
+		}
+		result.Items[i].Custom = custom
+	}
+
+	return result, nil
+}
+
+func isDiscussionURL(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return false
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	for _, host := range discussionHosts {
+		if hostname == host || strings.HasSuffix(hostname, "."+host) {
+			return true
+		}
+	}
+	return false
+}
+
+// articleAndComments tells the article an item links to from its comments,
+// for sites where they're different pages. The comments link is empty if
+// there's none, or if the item is the discussion itself (a reddit self post,
+// an "ask HN").
+func articleAndComments(item *gofeed.Item) (string, string) {
+	article := item.Link
+
+	comments := ""
+	if item.Custom != nil {
+		comments = item.Custom[commentsKey]
+	}
+
+	if isDiscussionURL(item.Link) {
+		if match := redditArticleRegexp.FindStringSubmatch(ItemBody(item)); match != nil {
+			comments = item.Link
+			article = html.UnescapeString(match[1])
+		}
+	}
+
+	if !isWebURL(article) {
+		article = item.Link
+	}
+	if comments == article || !isDiscussionURL(comments) {
+		comments = ""
+	}
+	return article, comments
+}
+
+// ArticleURL returns the link to the article an item is about when it's not
+// the item's own link, found when it was sanitized by the reaper, or an empty
+// string if it's the same.
+func ArticleURL(item *gofeed.Item) string {
+	if item.Custom == nil {
+		return ""
+	}
+	return item.Custom[articleKey]
+}
+
+// CommentsURL returns the link to the comments of an item, found when it was
+// sanitized by the reaper, or an empty string if it has none.
+func CommentsURL(item *gofeed.Item) string {
+	if item.Custom == nil {
+		return ""
+	}
+	return item.Custom[commentsKey]
+}
@@ -0,0 +1,133 @@
+package reaper
+
+import (
+	"container/heap"
+	"math"
+	"sync"
+)
+
+// Feeds with a higher priority are fetched first. Feeds that are only due
+// for their periodic refresh get their number of subscribers, so that the
+// feeds most people read are fresh first.
+const (
+	priorityManual = math.MaxInt
+	priorityNew    = math.MaxInt - 1
+)
+
+type queuedFeed struct {
+	url      string
+	priority int
+
+	// fetched even if it isn't stale yet
+	force bool
+
+	// the order feeds were queued in, feeds with the same priority are fetched
+	// first come first served
+	seq int
+
+	// where it is in the heap, for heap.Fix
+	index int
+}
+
+// feedHeap implements heap.Interface, highest priority first
+type feedHeap []*queuedFeed
+
+func (h feedHeap) Len() int { return len(h) }
+
+func (h feedHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h feedHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *feedHeap) Push(x any) {
+	f := x.(*queuedFeed)
+	f.index = len(*h)
+	*h = append(*h, f)
+}
+
+func (h *feedHeap) Pop() any {
+	old := *h
+	f := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return f
+}
+
+// fetchQueue holds the feeds waiting to be fetched, each at most once
+type fetchQueue struct {
+	mu    sync.Mutex
+	cond  *sync.Cond
+	feeds feedHeap
+	byURL map[string]*queuedFeed
+	seq   int
+
+	// nothing is popped once the queue is closed, see close
+	closed bool
+}
+
+func newFetchQueue() *fetchQueue {
+	q := &fetchQueue{byURL: make(map[string]*queuedFeed)}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// push queues a feed, or moves it up if it's already queued with a lower
+// priority
+func (q *fetchQueue) push(url string, priority int, force bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if f, ok := q.byURL[url]; ok {
+		f.force = f.force || force
+		if priority > f.priority {
+			f.priority = priority
+			heap.Fix(&q.feeds, f.index)
+		}
+		return
+	}
+
+	q.seq++
+	f := &queuedFeed{url: url, priority: priority, force: force, seq: q.seq}
+	heap.Push(&q.feeds, f)
+	q.byURL[url] = f
+	q.cond.Signal()
+}
+
+// pop waits until there's a feed queued and returns the one to fetch next,
+// or nil once the queue is closed
+func (q *fetchQueue) pop() *queuedFeed {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.feeds) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return nil
+	}
+	f := heap.Pop(&q.feeds).(*queuedFeed)
+	delete(q.byURL, f.url)
+	return f
+}
+
+func (q *fetchQueue) len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.feeds)
+}
+
+// close has everyone waiting in pop, and everyone who pops later, get nil
+func (q *fetchQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.cond.Broadcast()
+}
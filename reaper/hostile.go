@@ -0,0 +1,270 @@
+package reaper
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrHostileTarget is a feed on the network mire runs in rather than on the
+// internet: localhost, private addresses, cloud metadata endpoints. Fetching
+// it would let anyone who can subscribe to a feed look around that network.
+var ErrHostileTarget = errors.New("mire doesn't fetch feeds from local or private addresses")
+
+// ErrHostFlood is too many new feeds on the same host at once, someone using
+// mire to hammer a site with fetches of made up feeds
+var ErrHostFlood = errors.New("too many new feeds on this site lately")
+
+// AllowPrivateAddresses lets mire connect to hostile addresses. Set
+// MIRE_ALLOW_PRIVATE_FEEDS on instances that read feeds from their own
+// network, and when fetching through a proxy: it's the proxy's address that's
+// dialed, the proxy has to do the checking.
+var AllowPrivateAddresses = os.Getenv("MIRE_ALLOW_PRIVATE_FEEDS") != ""
+
+// hostnames that only ever point inside the network
+var hostileHostnames = []string{"localhost", "metadata.google.internal"}
+
+// hostile suffixes, .localhost always resolves to the loopback and .internal
+// is for private networks
+var hostileSuffixes = []string{".localhost", ".internal"}
+
+// addresses not covered by the net.IP methods: the "this network" block,
+// carrier-grade NAT (where some clouds have their metadata endpoint, like
+// 100.100.100.200) and IETF protocol assignments
+var hostileNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// hostileIP tells whether an address is on the network mire runs in. Cloud
+// metadata endpoints (169.254.169.254, fd00:ec2::254) are link-local or
+// private addresses.
+func hostileIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return true
+	}
+	for _, network := range hostileNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFeedTarget tells whether a feed is on a hostile host, going by its URL
+// alone: hostnames resolving to a hostile address are only caught when
+// they're dialed, see blockHostileAddresses
+func CheckFeedTarget(feedURL string) error {
+	if AllowPrivateAddresses {
+		return nil
+	}
+	return checkFeedTarget(feedURL)
+}
+
+func checkFeedTarget(feedURL string) error {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return nil
+	}
+	hostname := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+
+	if ip := net.ParseIP(hostname); ip != nil && hostileIP(ip) {
+		return fmt.Errorf("%w: %s", ErrHostileTarget, hostname)
+	}
+	for _, hostile := range hostileHostnames {
+		if hostname == hostile {
+			return fmt.Errorf("%w: %s", ErrHostileTarget, hostname)
+		}
+	}
+	for _, suffix := range hostileSuffixes {
+		if strings.HasSuffix(hostname, suffix) {
+			return fmt.Errorf("%w: %s", ErrHostileTarget, hostname)
+		}
+	}
+	return nil
+}
+
+// blockHostileAddresses is the Control of the fetch dialer: it refuses to
+// connect to hostile addresses, whatever a feed's host resolved to and
+// wherever it redirected
+func blockHostileAddresses(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && hostileIP(ip) {
+		return fmt.Errorf("%w: %s", ErrHostileTarget, host)
+	}
+	return nil
+}
+
+// how long new feeds count against their host, and how many of them a host
+// can have in that time (MIRE_MAX_NEW_FEEDS_PER_HOST, 0 for no limit). Busy
+// hosts like youtube get a few dozen new feeds a day.
+const newFeedsWindow = 24 * time.Hour
+
+var maxNewFeedsPerHost = EnvInt("MIRE_MAX_NEW_FEEDS_PER_HOST", 200)
+
+// EnvInt reads a number of 0 or more from the environment variable name, or
+// returns fallback when it's not set or not such a number
+func EnvInt(name string, fallback int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		log.Printf("[warn] %s should be a number of 0 or more, not '%s', using %d", name, value, fallback)
+		return fallback
+	}
+	return n
+}
+
+// floodGuard counts the new feeds of every host, so that a flood of them on
+// one host can be told apart from a site people like
+type floodGuard struct {
+	mu    sync.Mutex
+	added map[string][]time.Time
+}
+
+func newFloodGuard() *floodGuard {
+	return &floodGuard{added: make(map[string][]time.Time)}
+}
+
+// reserve makes room for new feeds on their hosts, or tells which host has
+// had too many of them lately. Nothing is reserved when it errors.
+func (g *floodGuard) reserve(feedURLs []string, limit int, now time.Time) error {
+	if limit == 0 || len(feedURLs) == 0 {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	counts := g.count(feedURLs, now)
+	for host, n := range counts {
+		if err := g.check(host, n, limit); err != nil {
+			return err
+		}
+	}
+
+	for host, n := range counts {
+		for range n {
+			g.added[host] = append(g.added[host], now)
+		}
+	}
+	return nil
+}
+
+// refused tells which hosts of the new feeds have had too many of them lately,
+// and why, without reserving anything
+func (g *floodGuard) refused(feedURLs []string, limit int, now time.Time) map[string]error {
+	refused := make(map[string]error)
+	if limit == 0 || len(feedURLs) == 0 {
+		return refused
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for host, n := range g.count(feedURLs, now) {
+		if err := g.check(host, n, limit); err != nil {
+			refused[host] = err
+		}
+	}
+	return refused
+}
+
+// count counts the new feeds of every host, and forgets the ones that no
+// longer count against it. g.mu must be held.
+func (g *floodGuard) count(feedURLs []string, now time.Time) map[string]int {
+	counts := make(map[string]int)
+	for _, feedURL := range feedURLs {
+		counts[hostKey(feedURL)]++
+	}
+
+	for host := range counts {
+		var recent []time.Time
+		for _, t := range g.added[host] {
+			if now.Sub(t) < newFeedsWindow {
+				recent = append(recent, t)
+			}
+		}
+		g.added[host] = recent
+	}
+	return counts
+}
+
+// check tells whether n more new feeds would be too many for host. g.mu must
+// be held.
+func (g *floodGuard) check(host string, n int, limit int) error {
+	recent := len(g.added[host])
+	if recent+n > limit {
+		log.Printf("[warn] reaper: refusing %d more new feeds on %s, it had %d in the last day", n, host, recent)
+		return fmt.Errorf("%w: %s can get at most %d new feeds a day, it got %d in the last day and this would add %d, try again later",
+			ErrHostFlood, host, limit, recent, n)
+	}
+	return nil
+}
+
+// CheckNewFeeds tells whether the feeds can be added to mire, and counts the
+// ones it doesn't know yet against their host when they can. Feeds on hostile
+// hosts can't (see ErrHostileTarget), and neither can too many new feeds on
+// the same host (see ErrHostFlood).
+func (r *Reaper) CheckNewFeeds(feedURLs []string) error {
+	var newFeeds []string
+	for _, feedURL := range feedURLs {
+		if r.HasFeed(feedURL) {
+			continue
+		}
+		if err := CheckFeedTarget(feedURL); err != nil {
+			return err
+		}
+		newFeeds = append(newFeeds, feedURL)
+	}
+	return r.floodGuard.reserve(newFeeds, maxNewFeedsPerHost, time.Now())
+}
+
+// RefusedFeeds tells which of the feeds CheckNewFeeds would refuse, and why,
+// without counting any of them against their host. The feeds on a host are
+// refused together, they'd be too many together.
+func (r *Reaper) RefusedFeeds(feedURLs []string) map[string]error {
+	refused := make(map[string]error)
+	var newFeeds []string
+	for _, feedURL := range feedURLs {
+		if r.HasFeed(feedURL) {
+			continue
+		}
+		if err := CheckFeedTarget(feedURL); err != nil {
+			refused[feedURL] = err
+			continue
+		}
+		newFeeds = append(newFeeds, feedURL)
+	}
+
+	flooded := r.floodGuard.refused(newFeeds, maxNewFeedsPerHost, time.Now())
+	for _, feedURL := range newFeeds {
+		if err, ok := flooded[hostKey(feedURL)]; ok {
+			refused[feedURL] = err
+		}
+	}
+	return refused
+}
@@ -0,0 +1,109 @@
+package reaper
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// mediaExtensions returns the media rss elements with a given name of an
+// item, including the ones grouped in a media:group (which is how youtube
+// puts them)
+func mediaExtensions(item *gofeed.Item, name string) []ext.Extension {
+	media := item.Extensions["media"]
+	if media == nil {
+		return nil
+	}
+
+	found := append([]ext.Extension{}, media[name]...)
+	for _, group := range media["group"] {
+		found = append(found, group.Children[name]...)
+	}
+	return found
+}
+
+func isWebURL(link string) bool {
+	return strings.HasPrefix(link, "https://") || strings.HasPrefix(link, "http://")
+}
+
+// itemThumbnail returns the URL of the thumbnail a feed gives for an item, or
+// an empty string if it gives none
+func itemThumbnail(item *gofeed.Item) string {
+	for _, thumbnail := range mediaExtensions(item, "thumbnail") {
+		if isWebURL(thumbnail.Attrs["url"]) {
+			return thumbnail.Attrs["url"]
+		}
+	}
+	if item.ITunesExt != nil && isWebURL(item.ITunesExt.Image) {
+		return item.ITunesExt.Image
+	}
+	if item.Image != nil && isWebURL(item.Image.URL) {
+		return item.Image.URL
+	}
+	return ""
+}
+
+// itemDuration returns the length in seconds of the video or audio of an
+// item, or 0 if the feed doesn't say
+func itemDuration(item *gofeed.Item) int {
+	if item.ITunesExt != nil {
+		if duration := parseDuration(item.ITunesExt.Duration); duration > 0 {
+			return duration
+		}
+	}
+	for _, content := range mediaExtensions(item, "content") {
+		if duration := parseDuration(content.Attrs["duration"]); duration > 0 {
+			return duration
+		}
+	}
+	return 0
+}
+
+// parseDuration parses durations as feeds write them: a number of seconds,
+// "MM:SS" or "HH:MM:SS"
+func parseDuration(value string) int {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+
+	duration := 0
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	for _, part := range parts {
+		// seconds are sometimes given with a fraction
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		duration = duration*60 + int(n)
+	}
+	return duration
+}
+
+// Thumbnail returns the thumbnail found for an item when it was sanitized by
+// the reaper, or an empty string if there's none.
+func Thumbnail(item *gofeed.Item) string {
+	if item.Custom == nil {
+		return ""
+	}
+	return item.Custom[thumbnailKey]
+}
+
+// Duration returns the length in seconds found for an item when it was
+// sanitized by the reaper, or 0 if it is unknown.
+func Duration(item *gofeed.Item) int {
+	if item.Custom == nil {
+		return 0
+	}
+
+	duration, err := strconv.Atoi(item.Custom[durationKey])
+	if err != nil {
+		return 0
+	}
+	return duration
+}
@@ -0,0 +1,113 @@
+package reaper
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+// sites known to rate limit feed readers, and how long to wait between two
+// fetches of their feeds. Reddit allows about 10 unauthenticated requests a
+// minute, hacker news asks crawlers to wait 30 seconds.
+var hostFetchIntervals = map[string]time.Duration{
+	"reddit.com":           10 * time.Second,
+	"news.ycombinator.com": 30 * time.Second,
+	"hnrss.org":            5 * time.Second,
+}
+
+// how long a site that answered "429 Too Many Requests" is left alone
+const rateLimitBackoff = 30 * time.Minute
+
+// hostLimiter spaces out the fetches of feeds of rate limited sites, and
+// stops fetching from sites that said we're fetching too often for a while
+type hostLimiter struct {
+	mu           sync.Mutex
+	nextFetch    map[string]time.Time
+	blockedUntil map[string]time.Time
+}
+
+func newHostLimiter() *hostLimiter {
+	return &hostLimiter{
+		nextFetch:    make(map[string]time.Time),
+		blockedUntil: make(map[string]time.Time),
+	}
+}
+
+// limitedHost returns the rate limited site a feed is on (subdomains
+// included, old.reddit.com is reddit.com), or an empty string
+func limitedHost(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
+	}
+
+	hostname := strings.ToLower(u.Hostname())
+	for host := range hostFetchIntervals {
+		if hostname == host || strings.HasSuffix(hostname, "."+host) {
+			return host
+		}
+	}
+	return ""
+}
+
+// hostKey is what fetches are counted against: the rate limited site, or the
+// host of the feed
+func hostKey(feedURL string) string {
+	if host := limitedHost(feedURL); host != "" {
+		return host
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// reserve books the next fetch of a feed and returns how long to wait until
+// it's its turn, or an error if its site asked us to back off
+func (l *hostLimiter) reserve(feedURL string, now time.Time) (time.Duration, error) {
+	key := hostKey(feedURL)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if until := l.blockedUntil[key]; now.Before(until) {
+		return 0, fmt.Errorf("%s is rate limiting us, not fetching from it until %s", key, until.UTC().Format(time.RFC3339))
+	}
+
+	interval, limited := hostFetchIntervals[key]
+	if !limited {
+		return 0, nil
+	}
+
+	turn := l.nextFetch[key]
+	if turn.Before(now) {
+		turn = now
+	}
+	l.nextFetch[key] = turn.Add(interval)
+	return turn.Sub(now), nil
+}
+
+// wait blocks until a feed can be fetched, or until ctx is done
+func (l *hostLimiter) wait(ctx context.Context, feedURL string) error {
+	delay, err := l.reserve(feedURL, time.Now())
+	if err != nil {
+		return err
+	}
+	if !supervisor.Sleep(ctx, delay) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// backOff stops fetching from the site of a feed for a while
+func (l *hostLimiter) backOff(feedURL string, now time.Time) {
+	l.mu.Lock()
+	l.blockedUntil[hostKey(feedURL)] = now.Add(rateLimitBackoff)
+	l.mu.Unlock()
+}
@@ -1,112 +1,336 @@
 package reaper
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"html"
 	"log"
 	"math/rand"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"codeberg.org/meadowingc/mire/language"
 	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/supervisor"
 	"github.com/mmcdole/gofeed"
+	"golang.org/x/sync/singleflight"
 )
 
 const timeToBecomeStale = 3 * time.Hour
 
+// DefaultRefreshInterval is how long after being fetched feeds are fetched
+// again, unless they were given an interval of their own
+const DefaultRefreshInterval = timeToBecomeStale
+
+// how many feeds are fetched at the same time (not counting the ones of rate
+// limited sites)
+const numFetchWorkers = 5
+
+// posts are saved in batches of up to saveBatchSize, or whatever came in
+// during saveBatchInterval
+const (
+	saveBatchSize     = 100
+	saveBatchInterval = time.Second
+)
+
+// keys used to keep what we computed about a sanitized item in its Custom map
+const (
+	wordCountKey = "mire:word_count"
+	languageKey  = "mire:language"
+	thumbnailKey = "mire:thumbnail"
+	durationKey  = "mire:duration"
+	commentsKey  = "mire:comments"
+	articleKey   = "mire:article"
+)
+
+var htmlTagRegexp = regexp.MustCompile(`<[^>]*>`)
+
 type PostSaveRequest struct {
-	FeedLink string
-	Title    string
-	Link     string
-	Date     time.Time
+	FeedLink  string
+	Title     string
+	Link      string
+	Date      time.Time
+	WordCount int
+	Language  string
+	Thumbnail string
+	Duration  int
+	// the discussion of the post and the article it's about, for link
+	// aggregators
+	CommentsURL string
+	ArticleURL  string
 }
 
+// FeedHolder is a feed tracked by the reaper. Its fields are only read and
+// written with mu held, through its methods, since they change whenever the
+// feed is fetched.
 type FeedHolder struct {
+	mu          sync.RWMutex
 	Feed        *gofeed.Feed
 	LastFetched time.Time
+
+	// how long after being fetched the feed is stale, or 0 for
+	// timeToBecomeStale
+	RefreshInterval time.Duration
+}
+
+func (fh *FeedHolder) feed() *gofeed.Feed {
+	fh.mu.RLock()
+	defer fh.mu.RUnlock()
+	return fh.Feed
+}
+
+// isStale tells whether the feed is due to be fetched again
+func (fh *FeedHolder) isStale(now time.Time) bool {
+	fh.mu.RLock()
+	defer fh.mu.RUnlock()
+	interval := fh.RefreshInterval
+	if interval == 0 {
+		interval = timeToBecomeStale
+	}
+	return fh.LastFetched.Add(interval).Before(now)
+}
+
+func (fh *FeedHolder) setFeed(feed *gofeed.Feed) {
+	fh.mu.Lock()
+	fh.Feed = feed
+	fh.mu.Unlock()
+}
+
+func (fh *FeedHolder) setLastFetched(t time.Time) {
+	fh.mu.Lock()
+	fh.LastFetched = t
+	fh.mu.Unlock()
+}
+
+func (fh *FeedHolder) refreshInterval() time.Duration {
+	fh.mu.RLock()
+	defer fh.mu.RUnlock()
+	return fh.RefreshInterval
+}
+
+func (fh *FeedHolder) setRefreshInterval(interval time.Duration) {
+	fh.mu.Lock()
+	fh.RefreshInterval = interval
+	fh.mu.Unlock()
 }
 
 type Reaper struct {
 	// internal list of all rss feeds where the map
-	// key represents the url of the feed (which should be unique)
+	// key represents the url of the feed (which should be unique). mu guards
+	// the map, each feed has a lock of its own so that fetching one doesn't
+	// hold up reading the others.
 	feeds map[string]*FeedHolder
+	mu    sync.RWMutex
 
 	saverChannel chan *PostSaveRequest
 
+	// how many posts the saver holds, waiting for their batch to be saved
+	pendingPosts atomic.Int32
+
+	// the posts the saver knows are saved, it skips them
+	seen *seenPosts
+
+	// the processes of the reaper, see Start
+	group *supervisor.Group
+
+	limiter *hostLimiter
+
+	// new feeds by host, see CheckNewFeeds
+	floodGuard *floodGuard
+
+	// what feeds are fetched with, see newFetchClient
+	client *http.Client
+
+	// the feeds waiting to be fetched, see fetchWorker
+	queue *fetchQueue
+
+	// the fetches in flight by feed url, so that a feed is never fetched
+	// twice at the same time
+	fetches singleflight.Group
+
+	// how the fetches are going, see Diagnostics
+	tracker *fetchTracker
+
 	db *sqlite.DB
-}
 
-var mutex = make(chan struct{}, 1)
+	// called after new posts are saved, see OnNewPosts
+	onNewPosts atomic.Pointer[func()]
+}
 
 func New(db *sqlite.DB) *Reaper {
-	mutex <- struct{}{}
-
 	r := &Reaper{
 		feeds:        make(map[string]*FeedHolder),
 		saverChannel: make(chan *PostSaveRequest),
+		limiter:      newHostLimiter(),
+		floodGuard:   newFloodGuard(),
+		client:       newFetchClient(AllowPrivateAddresses),
+		queue:        newFetchQueue(),
+		tracker:      newFetchTracker(),
+		seen:         newSeenPosts(),
 		db:           db,
 	}
 
-	go r.start()
-	go r.startDbSaver()
+	// knowing the feeds is enough to serve pages, fetching them can wait
+	r.loadFeeds()
 
 	return r
 }
 
-func lock() {
-	<-mutex
-}
-
-func unlock() {
-	mutex <- struct{}{}
+// holder returns the feed tracked at url, or nil
+func (r *Reaper) holder(url string) *FeedHolder {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.feeds[url]
 }
 
-// Start initializes the reaper by populating a list of feeds from the database
-// and periodically refreshes all feeds every hour, if the feeds are stale.
-// reaper should only ever be started once (in New)
-func (r *Reaper) start() {
-	urls := r.db.GetAllFeedURLs()
+// loadFeeds populates the list of feeds from the database, with what they
+// said about themselves the last time they were fetched
+func (r *Reaper) loadFeeds() {
+	feeds, err := r.db.GetAllFeedMetadata()
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	lock()
-	for _, url := range urls {
-		// Setting FeedLink lets us defer fetching
-		feed := &gofeed.Feed{
-			FeedLink: url,
+	r.mu.Lock()
+	for _, m := range feeds {
+		// a zero LastFetched has them refreshed right away, whatever their
+		// refresh interval
+		r.feeds[m.URL] = &FeedHolder{
+			Feed:            stubFeed(m),
+			RefreshInterval: m.RefreshInterval,
 		}
+	}
+	r.mu.Unlock()
+}
 
-		// trigged immediate refresh by setting LastFetched to a time in the past
-		lastRefreshed := time.Now().Add(-timeToBecomeStale)
-		r.feeds[url] = &FeedHolder{
-			Feed:        feed,
-			LastFetched: lastRefreshed,
-		}
+// stubFeed is a feed that wasn't fetched yet, with what it said about itself
+// the last time it was. Setting FeedLink lets us defer fetching.
+func stubFeed(m *sqlite.FeedMetadata) *gofeed.Feed {
+	return &gofeed.Feed{
+		FeedLink:    m.URL,
+		Title:       m.Title,
+		Description: m.Description,
+		Link:        m.Link,
 	}
-	unlock()
+}
 
-	for {
-		r.refreshAllFeeds()
-		time.Sleep(10 * time.Minute)
+// Start runs the reaper in group: it fetches the feeds and saves their new
+// posts until the group stops, then saves the posts it has left. A reaper
+// should only ever be started once.
+func (r *Reaper) Start(group *supervisor.Group) {
+	r.group = group
+
+	// wake up the workers waiting for feeds to fetch, for them to stop
+	context.AfterFunc(group.Context(), r.queue.close)
+
+	group.Go("reaper saver", r.saveNewPosts)
+	for i := range numFetchWorkers {
+		group.Go(fmt.Sprintf("reaper fetch worker %d", i), r.fetchWorker)
 	}
+	group.Go("reaper", func(ctx context.Context) error {
+		for {
+			r.queueStaleFeeds()
+			if !supervisor.Sleep(ctx, 10*time.Minute) {
+				return nil
+			}
+		}
+	})
 }
 
-func (r *Reaper) startDbSaver() {
+// OnNewPosts sets a function to call whenever new posts are saved, for what's
+// computed from the posts to be computed again
+func (r *Reaper) OnNewPosts(f func()) {
+	r.onNewPosts.Store(&f)
+}
+
+// saveNewPosts saves the posts sent to saverChannel in batches, so that
+// refreshing big feeds doesn't take the database lock once per post. It saves
+// what it has left once ctx is done, for before the database is closed.
+func (r *Reaper) saveNewPosts(ctx context.Context) error {
+	ticker := time.NewTicker(saveBatchInterval)
+	defer ticker.Stop()
+
+	var batch []*sqlite.Post
 	for {
 		select {
 		case item := <-r.saverChannel:
-			r.db.SavePost(item.FeedLink, item.Title, item.Link, item.Date)
-		default:
-			time.Sleep(10 * time.Second)
+			if r.isSaved(item) {
+				continue
+			}
+			batch = append(batch, &sqlite.Post{
+				FeedURL:           item.FeedLink,
+				Title:             item.Title,
+				URL:               item.Link,
+				PublishedDatetime: item.Date,
+				WordCount:         item.WordCount,
+				Language:          item.Language,
+				ThumbnailURL:      item.Thumbnail,
+				Duration:          item.Duration,
+				CommentsURL:       item.CommentsURL,
+				ArticleURL:        item.ArticleURL,
+			})
+			r.pendingPosts.Store(int32(len(batch)))
+			if len(batch) < saveBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case <-ctx.Done():
+			if len(batch) > 0 {
+				r.saveBatch(batch)
+			}
+			return nil
+		}
+
+		saved := r.saveBatch(batch)
+		batch = nil
+		r.pendingPosts.Store(0)
+
+		if f := r.onNewPosts.Load(); f != nil && saved > 0 {
+			(*f)()
+		}
+	}
+}
+
+// saveBatch saves a batch of posts and remembers they're saved, it returns
+// how many of them are new
+func (r *Reaper) saveBatch(batch []*sqlite.Post) int {
+	saved := r.db.SavePosts(batch)
+	for _, post := range batch {
+		r.seen.add(post.FeedURL, post.URL)
+	}
+	return saved
+}
+
+// isSaved tells whether a post is known to be in the database already, most
+// posts of a feed are every time it's refreshed after mire restarted
+func (r *Reaper) isSaved(item *PostSaveRequest) bool {
+	if !r.seen.known(item.FeedLink) {
+		postURLs, err := r.db.GetRecentPostURLs(item.FeedLink, numSeenPostsPerFeed)
+		if err != nil {
+			log.Printf("[err] reaper: could not get the posts of '%s': %s\n", item.FeedLink, err)
+			return false
 		}
+		r.seen.load(item.FeedLink, postURLs)
 	}
+	return r.seen.has(item.FeedLink, item.Link)
 }
 
 func (r *Reaper) sanitizeFeedItems(feed *gofeed.Feed) {
 	whitespaceRegexp := regexp.MustCompile(`\s+`)
+	declaredLanguage := language.Normalize(feed.Language)
 	seen := make(map[string]bool)
 	uniqueItems := make([]*gofeed.Item, 0)
 
@@ -123,6 +347,10 @@ func (r *Reaper) sanitizeFeedItems(feed *gofeed.Feed) {
 		// strip whitespaces in item link
 		item.Link = strings.TrimSpace(item.Link)
 
+		// posts of link aggregators keep their link, which is what tells them
+		// apart, the article and the comments it's not are kept on the side
+		article, comments := articleAndComments(item)
+
 		// if link is not a valid http(s) link then we just skip it
 		if !strings.HasPrefix(item.Link, "http://") && !strings.HasPrefix(item.Link, "https://") {
 			continue
@@ -144,12 +372,31 @@ func (r *Reaper) sanitizeFeedItems(feed *gofeed.Feed) {
 			seen[item.Link] = true
 
 			if item.Link != "" {
-				// we don't really need to keep the whole item
+				// we don't really need to keep the whole item, just enough to
+				// display it and to estimate how long it takes to read
+				custom := map[string]string{
+					wordCountKey: strconv.Itoa(countWords(item)),
+					languageKey:  detectLanguage(item, declaredLanguage),
+				}
+				if thumbnail := itemThumbnail(item); thumbnail != "" {
+					custom[thumbnailKey] = thumbnail
+				}
+				if duration := itemDuration(item); duration > 0 {
+					custom[durationKey] = strconv.Itoa(duration)
+				}
+				if comments != "" && comments != item.Link {
+					custom[commentsKey] = comments
+				}
+				if article != item.Link {
+					custom[articleKey] = article
+				}
+
 				uniqueItems = append(uniqueItems, &gofeed.Item{
 					Title:           item.Title,
 					Link:            item.Link,
 					Published:       item.Published,
 					PublishedParsed: item.PublishedParsed,
+					Custom:          custom,
 				})
 			}
 		}
@@ -159,21 +406,105 @@ func (r *Reaper) sanitizeFeedItems(feed *gofeed.Feed) {
 	feed.Items = uniqueItems
 }
 
-func (r *Reaper) updateFeedAndSaveNewItemsToDb(fh *FeedHolder) {
-	f := fh.Feed
+// ItemBody returns the html body of a feed item, preferring the full content
+// over the summary when the feed provides both.
+func ItemBody(item *gofeed.Item) string {
+	if strings.TrimSpace(item.Content) == "" {
+		return item.Description
+	}
+	return item.Content
+}
+
+// countWords does a best-effort count of the words in the body of a feed item
+func countWords(item *gofeed.Item) int {
+	body := ItemBody(item)
+	body = htmlTagRegexp.ReplaceAllString(body, " ")
+	return len(strings.Fields(html.UnescapeString(body)))
+}
+
+// detectLanguage guesses the language of a feed item from its text, falling
+// back to the language the feed says it's written in.
+func detectLanguage(item *gofeed.Item, declaredLanguage string) string {
+	body := html.UnescapeString(htmlTagRegexp.ReplaceAllString(ItemBody(item), " "))
+
+	// the beginning of the post is plenty to tell
+	if len(body) > 2000 {
+		body = body[:2000]
+	}
+
+	if detected := language.Detect(item.Title + " " + body); detected != "" {
+		return detected
+	}
+	return declaredLanguage
+}
+
+// Language returns the language detected for an item when it was sanitized
+// by the reaper, or an empty string if it is unknown.
+func Language(item *gofeed.Item) string {
+	if item.Custom == nil {
+		return ""
+	}
+	return item.Custom[languageKey]
+}
+
+// FeedLanguage returns the most common language among the items of a feed,
+// falling back to the language the feed declares.
+func FeedLanguage(feed *gofeed.Feed) string {
+	counts := make(map[string]int)
+	best := ""
+	for _, item := range feed.Items {
+		lang := Language(item)
+		if lang == "" {
+			continue
+		}
+		counts[lang]++
+		if counts[lang] > counts[best] || (counts[lang] == counts[best] && lang < best) {
+			best = lang
+		}
+	}
+
+	if best == "" {
+		return language.Normalize(feed.Language)
+	}
+	return best
+}
+
+// WordCount returns the number of words computed for an item when it was
+// sanitized by the reaper, or 0 if it is unknown.
+func WordCount(item *gofeed.Item) int {
+	if item.Custom == nil {
+		return 0
+	}
+
+	count, err := strconv.Atoi(item.Custom[wordCountKey])
+	if err != nil {
+		return 0
+	}
+	return count
+}
+
+// refresh fetches a feed the reaper tracks and saves its new posts. If the
+// feed is being fetched already it waits for that fetch instead.
+func (r *Reaper) refresh(ctx context.Context, fh *FeedHolder) error {
+	_, err, _ := r.fetches.Do(fh.feed().FeedLink, func() (any, error) {
+		return nil, r.updateFeedAndSaveNewItemsToDb(ctx, fh)
+	})
+	return err
+}
+
+func (r *Reaper) updateFeedAndSaveNewItemsToDb(ctx context.Context, fh *FeedHolder) error {
+	f := fh.feed()
 
 	// TODO don't read from reaper, read from db
-	if _, ok := r.feeds[f.FeedLink]; !ok {
+	if !r.HasFeed(f.FeedLink) {
 		log.Printf("[err] reaper:updateFeedAndSaveNewItemsToDb → Tied to fetch a feed that is not known to Reaper")
-		return
+		return errors.New("feed not known to the reaper")
 	}
 
 	// refresh last attempted refresh time for feed, independently of whether
 	// the fetch succeeds or not
 	fetchTime := time.Now()
-	lock()
-	r.feeds[f.FeedLink].LastFetched = fetchTime
-	unlock()
+	fh.setLastFetched(fetchTime)
 	r.db.UpdateFeedLastRefreshTime(f.FeedLink, fetchTime)
 
 	originalItemsMap := make(map[string]*gofeed.Item)
@@ -181,17 +512,32 @@ func (r *Reaper) updateFeedAndSaveNewItemsToDb(fh *FeedHolder) {
 		originalItemsMap[item.Link] = item
 	}
 
-	newF, err := r.rawFetchFeed(f.FeedLink)
+	redirects := &redirectRecorder{}
+	newF, err := r.rawFetchFeed(withRedirectRecorder(ctx, redirects), f.FeedLink)
 
 	if err != nil {
-		r.handleFeedFetchFailure(f.FeedLink, err)
-		return
+		// stopped halfway, there's nothing wrong with the feed
+		if ctx.Err() == nil {
+			r.handleFeedFetchFailure(f.FeedLink, err)
+		}
+		return err
 	}
 
 	newF.FeedLink = f.FeedLink // sometimes this gets overwritten for some reason
 
+	// feeds that moved for good are fetched at their new url from now on,
+	// rather than rotting once the old one stops redirecting
+	if redirects.movedTo != "" && redirects.movedTo != f.FeedLink {
+		movedTo, err := r.moveFeed(f.FeedLink, redirects.movedTo)
+		if err != nil {
+			log.Printf("[err] reaper: could not move '%s' to '%s': %s\n", f.FeedLink, redirects.movedTo, err)
+		} else {
+			newF.FeedLink = movedTo
+		}
+	}
+
 	// otherwise tell the DB that we successfully fetched the feed
-	err = r.db.SetFeedFetchError(f.FeedLink, "")
+	err = r.db.SetFeedFetchError(newF.FeedLink, "")
 	if err != nil {
 		log.Printf("[err] reaper: could not clear feed fetch error '%s'\n", err)
 	}
@@ -215,9 +561,12 @@ func (r *Reaper) updateFeedAndSaveNewItemsToDb(fh *FeedHolder) {
 		r.AddFeedStub(newF.FeedLink)
 	}
 
-	lock()
-	r.feeds[newF.FeedLink].Feed = newF
-	unlock()
+	if fh := r.holder(newF.FeedLink); fh != nil {
+		fh.setFeed(newF)
+	}
+
+	r.db.SetFeedLanguage(newF.FeedLink, FeedLanguage(newF))
+	r.db.SetFeedMetadata(newF.FeedLink, newF.Title, newF.Description, newF.Link)
 
 	newItems := []*gofeed.Item{}
 	for _, item := range newF.Items {
@@ -230,50 +579,130 @@ func (r *Reaper) updateFeedAndSaveNewItemsToDb(fh *FeedHolder) {
 		log.Printf("Saving %d new items for feed %s\n", len(newItems), newF.FeedLink)
 
 		for _, newItem := range newItems {
-			r.saverChannel <- &PostSaveRequest{
-				FeedLink: newF.FeedLink,
-				Title:    newItem.Title,
-				Link:     newItem.Link,
-				Date:     *newItem.PublishedParsed,
+			post := &PostSaveRequest{
+				FeedLink:    newF.FeedLink,
+				Title:       newItem.Title,
+				Link:        newItem.Link,
+				Date:        *newItem.PublishedParsed,
+				WordCount:   WordCount(newItem),
+				Language:    Language(newItem),
+				Thumbnail:   Thumbnail(newItem),
+				Duration:    Duration(newItem),
+				CommentsURL: CommentsURL(newItem),
+				ArticleURL:  ArticleURL(newItem),
+			}
+
+			// the saver is gone once the reaper stopped, the posts are saved
+			// the next time the feed is fetched
+			select {
+			case r.saverChannel <- post:
+			case <-ctx.Done():
+				return ctx.Err()
 			}
 		}
 	}
 
-	fh.LastFetched = time.Now()
+	fh.setLastFetched(time.Now())
+	return nil
 }
 
-// UpdateAll fetches every feed & attempts updating them
-// asynchronously, then prints the duration of the sync
-func (r *Reaper) refreshAllFeeds() {
-	start := time.Now()
-	semaphore := make(chan struct{}, 5)
-	var wg sync.WaitGroup
+// queueStaleFeeds queues every stale feed to be refreshed, the ones with
+// more subscribers first
+func (r *Reaper) queueStaleFeeds() {
+	subscribers, err := r.db.GetSubscriberCounts()
+	if err != nil {
+		log.Printf("[err] reaper: could not count subscribers, refreshing feeds in any order: %s\n", err)
+	}
 
-	for feedLink := range r.feeds {
-		// if the feed is stale, update it
-		if r.feeds[feedLink].LastFetched.Add(timeToBecomeStale).Before(start) {
-			semaphore <- struct{}{} // acquire a token
-			wg.Add(1)               // increment the WaitGroup counter
+	now := time.Now()
+	queued := 0
+	r.mu.RLock()
+	for feedLink, fh := range r.feeds {
+		if fh.isStale(now) {
+			r.queue.push(feedLink, subscribers[feedLink], false)
+			queued++
+		}
+	}
+	r.mu.RUnlock()
 
-			go func(feedHolder *FeedHolder) {
-				defer func() {
-					<-semaphore // release the token when done
-					wg.Done()   // decrement the WaitGroup counter
-				}()
+	log.Printf("reaper: queued %d stale feeds, %d waiting in total\n", queued, r.queue.len())
+}
 
-				// wait a random amount of time so we spread out the fetches as
-				// time goes on (we don't want to do "burst" of fetches every
-				// `timeToBecomeStale`)
-				time.Sleep(time.Duration(10+rand.Intn(20)) * time.Millisecond)
+// RefreshInterval returns how long after being fetched a feed is fetched
+// again, or 0 if it goes by the default (or isn't tracked)
+func (r *Reaper) RefreshInterval(url string) time.Duration {
+	fh := r.holder(url)
+	if fh == nil {
+		return 0
+	}
+	return fh.refreshInterval()
+}
 
-				r.updateFeedAndSaveNewItemsToDb(feedHolder)
-			}(r.feeds[feedLink])
-		}
+// SetRefreshInterval changes how long after being fetched a feed is fetched
+// again, 0 for the default
+func (r *Reaper) SetRefreshInterval(url string, interval time.Duration) error {
+	fh := r.holder(url)
+	if fh == nil {
+		return fmt.Errorf("no such feed '%s'", url)
+	}
+	if err := r.db.SetFeedRefreshInterval(url, interval); err != nil {
+		return err
+	}
+	fh.setRefreshInterval(interval)
+	return nil
+}
+
+// Refresh fetches a feed ahead of everything else, even if it isn't stale
+func (r *Reaper) Refresh(url string) {
+	r.queue.push(url, priorityManual, true)
+}
+
+// Revalidate has a feed someone is looking at fetched soon, if it's stale or
+// the reaper doesn't track it yet. It doesn't wait for the fetch.
+func (r *Reaper) Revalidate(url string) {
+	fh := r.holder(url)
+	if fh == nil {
+		r.AddFeedStub(url)
+		return
+	}
+	if fh.isStale(time.Now()) {
+		r.queue.push(url, priorityNew, false)
 	}
+}
+
+// fetchWorker fetches the queued feeds, one at a time, until ctx is done
+func (r *Reaper) fetchWorker(ctx context.Context) error {
+	for {
+		f := r.queue.pop()
+		if f == nil {
+			return nil
+		}
 
-	wg.Wait() // wait for all goroutines to finish
+		fh := r.holder(f.url)
+
+		// removed, or fetched some other way since it was queued
+		if fh == nil || (!f.force && !fh.isStale(time.Now())) {
+			continue
+		}
+
+		// wait a random amount of time so we spread out the fetches as time
+		// goes on (we don't want to do "burst" of fetches every
+		// `timeToBecomeStale`)
+		if !supervisor.Sleep(ctx, time.Duration(10+rand.Intn(20))*time.Millisecond) {
+			return nil
+		}
 
-	log.Printf("reaper: refresh complete in %s\n", time.Since(start))
+		// feeds of rate limited sites spend most of their time waiting for
+		// their turn, they'd hold up everyone else if they took a worker
+		if limitedHost(f.url) != "" {
+			r.group.Go("reaper refresh of "+f.url, func(ctx context.Context) error {
+				r.refresh(ctx, fh)
+				return nil
+			})
+			continue
+		}
+		r.refresh(ctx, fh)
+	}
 }
 
 func (r *Reaper) handleFeedFetchFailure(url string, err error) {
@@ -299,20 +728,48 @@ func (r *Reaper) handleFeedFetchFailure(url string, err error) {
 // HasFeed checks whether a given url is represented
 // in the reaper cache.
 func (r *Reaper) HasFeed(url string) bool {
-	if _, ok := r.feeds[url]; ok {
-		return true
-	}
-	return false
+	return r.holder(url) != nil
 }
 
+// GetFeed returns a feed as it was last fetched. Feeds the reaper doesn't
+// track (yet) are looked up in the database, they're returned without
+// items, or nil if there's no such feed.
 func (r *Reaper) GetFeed(url string) *gofeed.Feed {
-	return r.feeds[url].Feed
+	if fh := r.holder(url); fh != nil {
+		return fh.feed()
+	}
+
+	m, err := r.db.GetFeedMetadata(url)
+	if err != nil {
+		log.Printf("[err] reaper: could not get feed '%s' from the db: %s\n", url, err)
+	}
+	if m == nil {
+		return nil
+	}
+	return stubFeed(m)
+}
+
+// GetItem returns the item of a feed linking to a post, or nil if the feed
+// isn't known or doesn't include the post (anymore)
+func (r *Reaper) GetItem(feedURL string, link string) *gofeed.Item {
+	if !r.HasFeed(feedURL) {
+		return nil
+	}
+	for _, item := range r.GetFeed(feedURL).Items {
+		if item.Link == link {
+			return item
+		}
+	}
+	return nil
 }
 
 func (r *Reaper) GetAllFeeds() []*gofeed.Feed {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	var result []*gofeed.Feed
-	for _, f := range r.feeds {
-		result = append(result, f.Feed)
+	for _, fh := range r.feeds {
+		result = append(result, fh.feed())
 	}
 
 	return result
@@ -341,16 +798,18 @@ func (r *Reaper) SortItemsByDate(posts []*gofeed.Item) []*gofeed.Item {
 }
 
 func (r *Reaper) AddFeedStub(url string) {
-	if r.HasFeed(url) {
+	r.mu.Lock()
+	if _, ok := r.feeds[url]; ok {
+		r.mu.Unlock()
 		return
 	}
-
-	lock()
 	r.feeds[url] = &FeedHolder{
 		Feed:        &gofeed.Feed{FeedLink: url},
 		LastFetched: time.Now().Add(-timeToBecomeStale), // force refresh
 	}
-	unlock()
+	r.mu.Unlock()
+
+	r.queue.push(url, priorityNew, false)
 }
 
 func (r *Reaper) RemoveFeed(url string) {
@@ -359,13 +818,23 @@ func (r *Reaper) RemoveFeed(url string) {
 		return
 	}
 
-	lock()
+	r.mu.Lock()
 	delete(r.feeds, url)
-	unlock()
+	r.mu.Unlock()
+
+	r.tracker.forget(url)
+	r.seen.forget(url)
 }
 
-func (r *Reaper) rawFetchFeed(url string) (*gofeed.Feed, error) {
+func (r *Reaper) rawFetchFeed(ctx context.Context, url string) (*gofeed.Feed, error) {
+	// some sites don't like being fetched too often
+	if err := r.limiter.wait(ctx, url); err != nil {
+		return nil, err
+	}
+
 	fp := gofeed.NewParser()
+	fp.RSSTranslator = &rssTranslator{}
+	fp.Client = r.client
 
 	// Be a nice internet citizen and add how a descriptive user agent header
 	// with subscriber stats.
@@ -373,13 +842,28 @@ func (r *Reaper) rawFetchFeed(url string) (*gofeed.Feed, error) {
 	numSubscribersForFeed := r.db.GetNumSubscribersForFeed(url)
 	fp.UserAgent = fmt.Sprintf("Mire (+https://mire.meadow.cafe) - %d subscribers", numSubscribersForFeed)
 
-	return fp.ParseURL(url)
+	started := r.tracker.start(url)
+	feed, err := fp.ParseURLWithContext(url, ctx)
+	r.tracker.done(url, started)
+	var httpErr gofeed.HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusTooManyRequests {
+		r.limiter.backOff(url, time.Now())
+	}
+	return feed, err
 }
 
 // Fetch attempts to fetch a feed from a given url, marshal
-// it into a feed object, and manage it via reaper.
+// it into a feed object, and manage it via reaper. If the feed is being
+// fetched already it waits for that fetch instead.
 func (r *Reaper) Fetch(url string) error {
-	feed, err := r.rawFetchFeed(url)
+	_, err, _ := r.fetches.Do(url, func() (any, error) {
+		return nil, r.fetch(url)
+	})
+	return err
+}
+
+func (r *Reaper) fetch(url string) error {
+	feed, err := r.rawFetchFeed(context.Background(), url)
 	if err != nil {
 		return err
 	}
@@ -387,13 +871,23 @@ func (r *Reaper) Fetch(url string) error {
 	feed.FeedLink = url // sometimes this gets overwritten for some reason
 
 	r.sanitizeFeedItems(feed)
+	r.db.SetFeedLanguage(url, FeedLanguage(feed))
+	r.db.SetFeedMetadata(url, feed.Title, feed.Description, feed.Link)
 
-	lock()
-	r.feeds[url] = &FeedHolder{
-		Feed:        feed,
-		LastFetched: time.Now(),
+	r.mu.Lock()
+	fh, ok := r.feeds[url]
+	if !ok {
+		r.feeds[url] = &FeedHolder{Feed: feed, LastFetched: time.Now()}
+	}
+	r.mu.Unlock()
+
+	// the feed might be being read or refreshed, it's updated in place
+	if ok {
+		fh.mu.Lock()
+		fh.Feed = feed
+		fh.LastFetched = time.Now()
+		fh.mu.Unlock()
 	}
-	unlock()
 
 	return nil
 }
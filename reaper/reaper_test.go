@@ -1,23 +1,57 @@
 package reaper
 
 import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/supervisor"
+	"github.com/mmcdole/gofeed"
 )
 
-func createNewTestDB() *sqlite.DB {
-	// remove old db if it exists
-	os.Remove("reaper_go_test.db")
+func TestMain(m *testing.M) {
+	// the feeds of the tests are served on the loopback
+	AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
 
-	db := sqlite.New("reaper_go_test.db")
+func createNewTestDB(t *testing.T) *sqlite.DB {
+	// every test gets its own db, the reapers of the tests before it are still
+	// fetching and saving to theirs
+	db := sqlite.New(filepath.Join(t.TempDir(), "reaper_go_test.db"))
 	return db
 }
 
+// startReaper starts a reaper until the end of the test, or until the stop
+// function it returns is called
+func startReaper(t *testing.T, r *Reaper) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	group := supervisor.New(ctx)
+	r.Start(group)
+
+	stop = func() {
+		cancel()
+		if err := group.Wait(); err != nil {
+			t.Error(err)
+		}
+	}
+	t.Cleanup(stop)
+	return stop
+}
+
 func TestHasFeed(t *testing.T) {
-	db := createNewTestDB()
+	db := createNewTestDB(t)
 	r := New(db)
 
 	r.Fetch("https://visakanv.substack.com/feed")
@@ -35,18 +69,758 @@ func TestHasFeed(t *testing.T) {
 }
 
 func TestNewPostsGetAddedToDatabase(t *testing.T) {
-	db := createNewTestDB()
+	db := createNewTestDB(t)
 	db.WriteFeed("https://meadow.bearblog.dev/feed/")
 
 	r := New(db)
+	startReaper(t, r)
 
 	time.Sleep(1 * time.Second)
 
 	r.Fetch("https://meadow.bearblog.dev/feed")
 
-	time.Sleep(11 * time.Second) // 11 to account for the saver delay
+	time.Sleep(2 * time.Second) // to account for the saver batching
 
 	if len(db.GetLatestPostsForDiscover(10)) == 0 {
 		t.Fatal("expected 3 posts in db")
 	}
 }
+
+func TestStopSavesPendingPosts(t *testing.T) {
+	db := createNewTestDB(t)
+	db.WriteFeed("http://example-feed.invalid")
+
+	r := New(db)
+	stop := startReaper(t, r)
+	r.saverChannel <- &PostSaveRequest{
+		FeedLink: "http://example-feed.invalid",
+		Title:    "Pending Post",
+		Link:     "http://example-feed.invalid/1",
+		Date:     time.Now(),
+	}
+
+	// returns once the workers and the saver are done
+	stop()
+
+	if len(db.GetLatestPostsForDiscover(10)) != 1 {
+		t.Fatal("expected the pending post to be saved on stop")
+	}
+}
+
+func TestFeedsAreKnownBeforeBeingFetched(t *testing.T) {
+	db := createNewTestDB(t)
+	db.WriteFeed("http://example-feed.invalid")
+	db.SetFeedMetadata("http://example-feed.invalid", "Example", "An example feed", "http://example.invalid")
+
+	r := New(db)
+
+	if !r.HasFeed("http://example-feed.invalid") {
+		t.Fatal("expected the feed to be known right away")
+	}
+	if title := r.GetFeed("http://example-feed.invalid").Title; title != "Example" {
+		t.Errorf("expected the title from the db, got '%s'", title)
+	}
+
+	// feeds the reaper doesn't track are looked up in the db
+	db.WriteFeed("http://untracked-feed.invalid")
+	db.SetFeedMetadata("http://untracked-feed.invalid", "Untracked", "", "")
+	if feed := r.GetFeed("http://untracked-feed.invalid"); feed == nil || feed.Title != "Untracked" {
+		t.Errorf("expected the untracked feed from the db, got %v", feed)
+	}
+	if r.GetFeed("http://unknown-feed.invalid") != nil {
+		t.Error("expected no feed for an unknown url")
+	}
+}
+
+func TestRefreshIntervals(t *testing.T) {
+	db := createNewTestDB(t)
+	db.WriteFeed("http://example-feed.invalid")
+	db.WriteFeed("http://weekly-feed.invalid")
+	db.SetFeedRefreshInterval("http://weekly-feed.invalid", 7*24*time.Hour)
+
+	r := New(db)
+
+	// feeds are fetched right away, whatever their interval
+	now := time.Now()
+	weekly := r.holder("http://weekly-feed.invalid")
+	if !weekly.isStale(now) {
+		t.Error("expected the feed to be stale before being fetched")
+	}
+
+	weekly.setLastFetched(now.Add(-24 * time.Hour))
+	if weekly.isStale(now) {
+		t.Error("expected the weekly feed to be fresh after a day")
+	}
+	other := r.holder("http://example-feed.invalid")
+	other.setLastFetched(now.Add(-24 * time.Hour))
+	if !other.isStale(now) {
+		t.Error("expected the other feed to go by the default interval")
+	}
+
+	if err := r.SetRefreshInterval("http://example-feed.invalid", 48*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if other.isStale(now) || r.RefreshInterval("http://example-feed.invalid") != 48*time.Hour {
+		t.Error("expected the new interval to apply right away")
+	}
+	if r.SetRefreshInterval("http://unknown-feed.invalid", time.Hour) == nil {
+		t.Error("expected unknown feeds to have no interval to set")
+	}
+
+	// and it's kept
+	if r := New(db); r.RefreshInterval("http://example-feed.invalid") != 48*time.Hour {
+		t.Error("expected the interval to be saved")
+	}
+}
+
+func TestFeedsFollowPermanentRedirects(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/old", http.RedirectHandler("/new", http.StatusMovedPermanently))
+	mux.Handle("/moved-then-temporary", http.RedirectHandler("/old", http.StatusPermanentRedirect))
+	mux.Handle("/temporary", http.RedirectHandler("/new", http.StatusFound))
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Moved</title>` +
+			`<item><title>Post</title><link>http://moved.invalid/1</link></item></channel></rss>`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	db := createNewTestDB(t)
+	r := New(db)
+
+	// only an unbroken chain of permanent redirects says where a feed lives
+	for path, expected := range map[string]string{
+		"/old":                  server.URL + "/new",
+		"/moved-then-temporary": server.URL + "/new",
+		"/temporary":            "",
+	} {
+		redirects := &redirectRecorder{}
+		if _, err := r.rawFetchFeed(withRedirectRecorder(context.Background(), redirects), server.URL+path); err != nil {
+			t.Fatal(err)
+		}
+		if redirects.movedTo != expected {
+			t.Errorf("expected %s to have moved to '%s', got '%s'", path, expected, redirects.movedTo)
+		}
+	}
+
+	oldURL := server.URL + "/old"
+	db.WriteFeed(oldURL)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", oldURL)
+	r = New(db)
+	startReaper(t, r)
+
+	newURL := server.URL + "/new"
+	deadline := time.Now().Add(5 * time.Second)
+	for !r.HasFeed(newURL) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !r.HasFeed(newURL) || r.HasFeed(oldURL) {
+		t.Fatal("expected the feed to be tracked at its new url only")
+	}
+	if feeds := db.GetUserFeedURLs("alice"); len(feeds) != 1 || feeds[0] != newURL {
+		t.Errorf("expected alice to be subscribed to the new url, got %v", feeds)
+	}
+}
+
+func TestRevalidateTracksUnknownFeeds(t *testing.T) {
+	db := createNewTestDB(t)
+	r := New(db)
+
+	// added to the db after the reaper started, by someone else
+	db.WriteFeed("http://example-feed.invalid")
+	if r.HasFeed("http://example-feed.invalid") {
+		t.Fatal("expected the feed not to be tracked yet")
+	}
+
+	r.Revalidate("http://example-feed.invalid")
+	if !r.HasFeed("http://example-feed.invalid") {
+		t.Error("expected the feed to be tracked after revalidating")
+	}
+}
+
+func TestConcurrentFetchesAreDeduplicated(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(200 * time.Millisecond)
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Slow</title>` +
+			`<item><title>Post</title><link>http://slow.invalid/1</link></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	r := New(createNewTestDB(t))
+
+	var wg sync.WaitGroup
+	for range 5 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := r.Fetch(server.URL); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := requests.Load(); n != 1 {
+		t.Errorf("expected the feed to be fetched once, got %d", n)
+	}
+	if title := r.GetFeed(server.URL).Title; title != "Slow" {
+		t.Errorf("expected the fetched feed, got title '%s'", title)
+	}
+}
+
+// subscribing to a url someone gave goes by why fetching it failed, sites are
+// looked into for the feeds they link to while feeds that are down are kept
+func TestFetchTellsSitesFromFeedsThatAreDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="alternate" type="application/rss+xml" href="/index.xml"></head></html>`))
+		case "/feed.json":
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"version": "https://jsonfeed.org/version/1.1", "title": "Json", "items": []}`))
+		default:
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	r := New(createNewTestDB(t))
+
+	if err := r.Fetch(server.URL + "/feed.json"); err != nil {
+		t.Errorf("expected the JSON Feed to be fetched, got %s", err)
+	}
+	if err := r.Fetch(server.URL + "/"); !errors.Is(err, gofeed.ErrFeedTypeNotDetected) {
+		t.Errorf("expected the site not to be a feed, got %v", err)
+	}
+	err := r.Fetch(server.URL + "/index.xml")
+	var httpErr gofeed.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the feed to be down, got %v", err)
+	}
+}
+
+func TestSanitizeKeepsWordCount(t *testing.T) {
+	r := &Reaper{}
+	now := time.Now()
+
+	feed := &gofeed.Feed{
+		Items: []*gofeed.Item{
+			{
+				Title:           "with content",
+				Link:            "https://example.com/1",
+				PublishedParsed: &now,
+				Description:     "a short summary",
+				Content:         "<p>one <b>two</b> three&nbsp;four</p><p>five</p>",
+			},
+			{
+				Title:           "summary only",
+				Link:            "https://example.com/2",
+				PublishedParsed: &now,
+				Description:     "just a summary",
+			},
+			{
+				Title:           "empty",
+				Link:            "https://example.com/3",
+				PublishedParsed: &now,
+			},
+		},
+	}
+
+	r.sanitizeFeedItems(feed)
+
+	expected := []int{5, 3, 0}
+	for i, item := range feed.Items {
+		if WordCount(item) != expected[i] {
+			t.Errorf("expected item %d to have %d words, got %d", i, expected[i], WordCount(item))
+		}
+	}
+}
+
+func TestSanitizeKeepsMedia(t *testing.T) {
+	r := &Reaper{}
+
+	youtubeFeed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns:yt="http://www.youtube.com/xml/schemas/2015" xmlns:media="http://search.yahoo.com/mrss/" xmlns="http://www.w3.org/2005/Atom">
+ <title>A channel</title>
+ <entry>
+  <title>A video</title>
+  <link rel="alternate" href="https://www.youtube.com/watch?v=dQw4w9WgXcQ"/>
+  <published>2024-01-01T00:00:00+00:00</published>
+  <media:group>
+   <media:title>A video</media:title>
+   <media:content url="https://www.youtube.com/v/dQw4w9WgXcQ" type="application/x-shockwave-flash" width="640" height="390"/>
+   <media:thumbnail url="https://i3.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" width="480" height="360"/>
+  </media:group>
+ </entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	podcastFeed, err := gofeed.NewParser().Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd">
+ <channel>
+  <title>A podcast</title>
+  <item>
+   <title>An episode</title>
+   <link>https://example.com/episode</link>
+   <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+   <itunes:duration>1:02:03</itunes:duration>
+   <itunes:image href="https://example.com/episode.jpg"/>
+  </item>
+ </channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.sanitizeFeedItems(youtubeFeed)
+	r.sanitizeFeedItems(podcastFeed)
+
+	video := youtubeFeed.Items[0]
+	if Thumbnail(video) != "https://i3.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" || Duration(video) != 0 {
+		t.Errorf("Unexpected video thumbnail '%s' and duration %d", Thumbnail(video), Duration(video))
+	}
+
+	episode := podcastFeed.Items[0]
+	if Thumbnail(episode) != "https://example.com/episode.jpg" || Duration(episode) != 3723 {
+		t.Errorf("Unexpected episode thumbnail '%s' and duration %d", Thumbnail(episode), Duration(episode))
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	for value, expected := range map[string]int{
+		"90":      90,
+		"12:34":   754,
+		"1:02:03": 3723,
+		"42.5":    42,
+		"":        0,
+		"soon":    0,
+		"1:2:3:4": 0,
+	} {
+		if got := parseDuration(value); got != expected {
+			t.Errorf("Expected '%s' to be %d seconds, got %d", value, expected, got)
+		}
+	}
+}
+
+func TestSanitizeSeparatesArticlesFromComments(t *testing.T) {
+	r := &Reaper{}
+	parser := gofeed.NewParser()
+	parser.RSSTranslator = &rssTranslator{}
+
+	redditFeed, err := parser.Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+ <title>r/rss</title>
+ <entry>
+  <title>A link post</title>
+  <link href="https://www.reddit.com/r/rss/comments/abc123/a_link_post/"/>
+  <updated>2024-01-01T00:00:00+00:00</updated>
+  <content type="html">&lt;span&gt;&lt;a href=&quot;https://example.com/article?a=1&amp;amp;b=2&quot;&gt;[link]&lt;/a&gt;&lt;/span&gt; &amp;#32; &lt;span&gt;&lt;a href=&quot;https://www.reddit.com/r/rss/comments/abc123/a_link_post/&quot;&gt;[comments]&lt;/a&gt;&lt;/span&gt;</content>
+ </entry>
+ <entry>
+  <title>A self post</title>
+  <link href="https://www.reddit.com/r/rss/comments/def456/a_self_post/"/>
+  <updated>2024-01-01T00:00:00+00:00</updated>
+  <content type="html">&lt;p&gt;some text&lt;/p&gt; &lt;span&gt;&lt;a href=&quot;https://www.reddit.com/r/rss/comments/def456/a_self_post/&quot;&gt;[link]&lt;/a&gt;&lt;/span&gt;</content>
+ </entry>
+</feed>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hnFeed, err := parser.Parse(strings.NewReader(`<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0">
+ <channel>
+  <title>Hacker News</title>
+  <item>
+   <title>An article</title>
+   <link>https://example.org/article</link>
+   <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+   <comments>https://news.ycombinator.com/item?id=1</comments>
+  </item>
+  <item>
+   <title>Ask HN: a question</title>
+   <link>https://news.ycombinator.com/item?id=2</link>
+   <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+   <comments>https://news.ycombinator.com/item?id=2</comments>
+  </item>
+  <item>
+   <title>A blog post</title>
+   <link>https://example.org/blog</link>
+   <pubDate>Mon, 01 Jan 2024 00:00:00 +0000</pubDate>
+   <comments>https://example.org/blog#comments</comments>
+  </item>
+ </channel>
+</rss>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.sanitizeFeedItems(redditFeed)
+	r.sanitizeFeedItems(hnFeed)
+
+	// reddit posts keep their own link, which tells apart the ones about the
+	// same article
+	expected := [][3]string{
+		{"https://www.reddit.com/r/rss/comments/abc123/a_link_post/", "https://example.com/article?a=1&b=2", ""},
+		{"https://www.reddit.com/r/rss/comments/def456/a_self_post/", "", ""},
+		{"https://example.org/article", "", "https://news.ycombinator.com/item?id=1"},
+		{"https://news.ycombinator.com/item?id=2", "", ""},
+		{"https://example.org/blog", "", ""},
+	}
+	items := append(redditFeed.Items, hnFeed.Items...)
+	if len(items) != len(expected) {
+		t.Fatalf("Expected %d items, got %d", len(expected), len(items))
+	}
+	for i, item := range items {
+		if item.Link != expected[i][0] || ArticleURL(item) != expected[i][1] || CommentsURL(item) != expected[i][2] {
+			t.Errorf("Expected item %d to link to '%s', '%s' and '%s', got '%s', '%s' and '%s'", i,
+				expected[i][0], expected[i][1], expected[i][2], item.Link, ArticleURL(item), CommentsURL(item))
+		}
+	}
+}
+
+func TestFetchQueue(t *testing.T) {
+	q := newFetchQueue()
+	q.push("http://few-subscribers.com", 1, false)
+	q.push("http://many-subscribers.com", 10, false)
+	q.push("http://also-few-subscribers.com", 1, false)
+	q.push("http://new.com", priorityNew, false)
+	q.push("http://few-subscribers.com", priorityManual, true)
+	q.push("http://many-subscribers.com", 2, false) // already queued higher
+
+	expected := []string{
+		"http://few-subscribers.com",
+		"http://new.com",
+		"http://many-subscribers.com",
+		"http://also-few-subscribers.com",
+	}
+	if q.len() != len(expected) {
+		t.Fatalf("expected %d queued feeds, got %d", len(expected), q.len())
+	}
+	for i, url := range expected {
+		f := q.pop()
+		if f.url != url {
+			t.Errorf("expected feed %d to be %s, got %s", i, url, f.url)
+		}
+		if f.force != (i == 0) {
+			t.Errorf("expected only the manual refresh to be forced, got %v for %s", f.force, f.url)
+		}
+	}
+
+	done := make(chan *queuedFeed)
+	go func() { done <- q.pop() }()
+	q.close()
+	if f := <-done; f != nil {
+		t.Errorf("expected nothing from a closed queue, got %s", f.url)
+	}
+}
+
+func TestHostLimiter(t *testing.T) {
+	l := newHostLimiter()
+	now := time.Now()
+
+	for i, feedURL := range []string{
+		"https://www.reddit.com/r/rss/.rss",
+		"https://old.reddit.com/r/golang/.rss",
+		"https://www.reddit.com/r/rss/.rss",
+	} {
+		delay, err := l.reserve(feedURL, now)
+		if err != nil || delay != time.Duration(i)*hostFetchIntervals["reddit.com"] {
+			t.Errorf("Expected fetch %d of reddit to wait %s, got %s (%v)", i, time.Duration(i)*hostFetchIntervals["reddit.com"], delay, err)
+		}
+	}
+
+	if delay, err := l.reserve("https://example.com/feed", now); err != nil || delay != 0 {
+		t.Errorf("Expected other sites not to wait, got %s (%v)", delay, err)
+	}
+
+	if delay, _ := l.reserve("https://www.reddit.com/r/rss/.rss", now.Add(time.Hour)); delay != 0 {
+		t.Errorf("Expected no wait once reddit wasn't fetched for a while, got %s", delay)
+	}
+
+	l.backOff("https://example.com/feed", now)
+	if _, err := l.reserve("https://example.com/other-feed", now.Add(time.Minute)); err == nil {
+		t.Errorf("Expected a site that rate limited us to be left alone")
+	}
+	if _, err := l.reserve("https://example.com/feed", now.Add(rateLimitBackoff+time.Second)); err != nil {
+		t.Errorf("Expected the site to be fetched again after backing off, got %v", err)
+	}
+}
+
+func TestFeedsCanBeReadWhileFetched(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Busy</title>` +
+			`<item><title>Post</title><link>http://busy.invalid/1</link></item></channel></rss>`))
+	}))
+	defer server.Close()
+
+	db := createNewTestDB(t)
+	r := New(db)
+	startReaper(t, r)
+	r.AddFeedStub(server.URL)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r.HasFeed(server.URL)
+				r.GetFeed(server.URL)
+				r.GetAllFeeds()
+				r.Revalidate(server.URL)
+			}
+		}()
+	}
+
+	for range 5 {
+		if err := r.Fetch(server.URL); err != nil {
+			t.Error(err)
+		}
+		r.Refresh(server.URL)
+	}
+	close(stop)
+	wg.Wait()
+
+	if title := r.GetFeed(server.URL).Title; title != "Busy" {
+		t.Errorf("expected the fetched feed, got title '%s'", title)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title></channel></rss>`))
+	}))
+	defer server.Close()
+
+	r := New(createNewTestDB(t))
+	if err := r.Fetch(server.URL); err != nil {
+		t.Fatal(err)
+	}
+	r.Refresh("http://queued-feed.invalid")
+
+	d := r.Diagnostics()
+	if d.NumFeeds != 1 || d.NumQueued != 1 || len(d.InFlight) != 0 {
+		t.Errorf("expected 1 feed, 1 queued and none in flight, got %d, %d and %d", d.NumFeeds, d.NumQueued, len(d.InFlight))
+	}
+	if len(d.LastFetches) != 1 || d.LastFetches[0].URL != server.URL || d.LastFetches[0].Duration <= 0 {
+		t.Errorf("expected how long fetching the feed took, got %v", d.LastFetches)
+	}
+
+	r.RemoveFeed(server.URL)
+	if d := r.Diagnostics(); len(d.LastFetches) != 0 {
+		t.Errorf("expected removed feeds to be forgotten, got %v", d.LastFetches)
+	}
+}
+
+func TestSaverSkipsSavedPosts(t *testing.T) {
+	db := createNewTestDB(t)
+	db.WriteFeed("http://example-feed.invalid")
+	db.SavePost("http://example-feed.invalid", "Saved Post", "http://example-feed.invalid/1", time.Now())
+
+	r := New(db)
+	saved := &PostSaveRequest{FeedLink: "http://example-feed.invalid", Title: "Saved Post", Link: "http://example-feed.invalid/1", Date: time.Now()}
+	fresh := &PostSaveRequest{FeedLink: "http://example-feed.invalid", Title: "New Post", Link: "http://example-feed.invalid/2", Date: time.Now()}
+
+	if !r.isSaved(saved) {
+		t.Error("expected the post in the db to be known as saved")
+	}
+	if r.isSaved(fresh) {
+		t.Error("expected the new post not to be known as saved")
+	}
+
+	stop := startReaper(t, r)
+	r.saverChannel <- saved
+	r.saverChannel <- fresh
+	stop()
+
+	if !r.isSaved(fresh) {
+		t.Error("expected the new post to be known as saved once the saver saved it")
+	}
+	if n := len(db.GetLatestPostsForDiscover(10)); n != 2 {
+		t.Errorf("expected 2 posts in the db, got %d", n)
+	}
+
+	r.RemoveFeed("http://example-feed.invalid")
+	if r.seen.known("http://example-feed.invalid") {
+		t.Error("expected the posts of a removed feed to be forgotten")
+	}
+}
+
+func TestSeenPostsForgetsTheOldest(t *testing.T) {
+	s := newSeenPosts()
+	s.load("http://feed.invalid", []string{"http://feed.invalid/0"})
+	for i := 1; i <= numSeenPostsPerFeed; i++ {
+		s.add("http://feed.invalid", "http://feed.invalid/"+strconv.Itoa(i))
+	}
+
+	if s.has("http://feed.invalid", "http://feed.invalid/0") {
+		t.Error("expected the oldest post to be forgotten")
+	}
+	if !s.has("http://feed.invalid", "http://feed.invalid/1") || !s.has("http://feed.invalid", "http://feed.invalid/"+strconv.Itoa(numSeenPostsPerFeed)) {
+		t.Error("expected the most recent posts to be remembered")
+	}
+}
+
+func TestDNSCache(t *testing.T) {
+	c := newDNSCache()
+	lookups := 0
+	c.lookupHost = func(ctx context.Context, host string) ([]string, error) {
+		lookups++
+		if host == "broken.invalid" {
+			return nil, &net.DNSError{Err: "no such host", Name: host}
+		}
+		return []string{"127.0.0.1"}, nil
+	}
+
+	for range 3 {
+		addrs, err := c.lookup(context.Background(), "example.invalid")
+		if err != nil || len(addrs) != 1 || addrs[0] != "127.0.0.1" {
+			t.Fatalf("expected the address of the host, got %v (%v)", addrs, err)
+		}
+	}
+	if lookups != 1 {
+		t.Errorf("expected the host to be looked up once, got %d lookups", lookups)
+	}
+
+	c.entries["example.invalid"] = dnsEntry{addrs: []string{"127.0.0.1"}, expires: time.Now().Add(-time.Second)}
+	c.lookup(context.Background(), "example.invalid")
+	if lookups != 2 {
+		t.Errorf("expected expired addresses to be looked up again, got %d lookups", lookups)
+	}
+
+	c.lookup(context.Background(), "broken.invalid")
+	c.lookup(context.Background(), "broken.invalid")
+	if lookups != 4 {
+		t.Errorf("expected failed lookups not to be remembered, got %d lookups", lookups)
+	}
+}
+
+func TestFetchesReuseConnections(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(`<?xml version="1.0"?><rss version="2.0"><channel><title>Feed</title></channel></rss>`))
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	r := New(createNewTestDB(t))
+	for range 3 {
+		if err := r.Fetch(server.URL); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := connections.Load(); n != 1 {
+		t.Errorf("expected the fetches to share a connection, got %d connections", n)
+	}
+}
+
+func TestHostileTargets(t *testing.T) {
+	for _, feedURL := range []string{
+		"http://localhost:8080/feed",
+		"http://printer.localhost/feed",
+		"http://127.0.0.1/feed",
+		"http://10.0.0.5/feed",
+		"http://192.168.1.1/rss",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://metadata.google.internal/computeMetadata/v1/",
+		"http://100.100.100.200/latest/meta-data/",
+		"http://[::1]/feed",
+		"http://[fd00:ec2::254]/feed",
+		"http://[::ffff:127.0.0.1]/feed",
+		"http://0.0.0.0/feed",
+	} {
+		if err := checkFeedTarget(feedURL); !errors.Is(err, ErrHostileTarget) {
+			t.Errorf("expected %s to be hostile, got %v", feedURL, err)
+		}
+	}
+
+	for _, feedURL := range []string{"https://example.com/feed", "http://93.184.215.14/feed", "https://[2606:4700::1]/feed"} {
+		if err := checkFeedTarget(feedURL); err != nil {
+			t.Errorf("expected %s to be fine, got %v", feedURL, err)
+		}
+	}
+}
+
+func TestHostileAddressesAreNotDialed(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// a hostname that resolves to the loopback gets through checkFeedTarget
+	_, err := newFetchClient(false).Get(server.URL)
+	if !errors.Is(err, ErrHostileTarget) {
+		t.Errorf("expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+
+	// and neither do the other requests mire makes
+	AllowPrivateAddresses = false
+	defer func() { AllowPrivateAddresses = true }()
+	_, err = (&http.Client{Transport: NewTransport()}).Get(server.URL)
+	if !errors.Is(err, ErrHostileTarget) {
+		t.Errorf("expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("expected no requests, got %d", n)
+	}
+}
+
+func TestFloodGuard(t *testing.T) {
+	g := newFloodGuard()
+	now := time.Now()
+
+	var feeds []string
+	for i := range 3 {
+		feeds = append(feeds, "https://example.com/feed?"+strconv.Itoa(i))
+	}
+	if err := g.reserve(feeds, 4, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.reserve([]string{"https://other.example.org/feed", "https://example.com/a", "https://example.com/b"}, 4, now); !errors.Is(err, ErrHostFlood) {
+		t.Errorf("expected example.com to be flooded, got %v", err)
+	}
+	// nothing was reserved for other.example.org
+	if err := g.reserve([]string{"https://other.example.org/feed", "https://example.com/a"}, 4, now); err != nil {
+		t.Errorf("expected room for one more feed on each host, got %v", err)
+	}
+	if err := g.reserve([]string{"https://example.com/b"}, 4, now.Add(newFeedsWindow)); err != nil {
+		t.Errorf("expected the old feeds not to count anymore, got %v", err)
+	}
+
+	refused := g.refused([]string{"https://example.com/c", "https://example.com/d", "https://elsewhere.example.net/feed"}, 2, now.Add(newFeedsWindow))
+	if len(refused) != 1 || !errors.Is(refused["example.com"], ErrHostFlood) {
+		t.Errorf("expected only example.com to be refused, got %v", refused)
+	}
+	// telling doesn't reserve
+	if err := g.reserve([]string{"https://elsewhere.example.net/feed", "https://elsewhere.example.net/other"}, 2, now.Add(newFeedsWindow)); err != nil {
+		t.Errorf("expected room for two feeds on elsewhere.example.net, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// how many redirects a fetch follows, like the default http client
+const maxRedirects = 10
+
+type redirectRecorderKey struct{}
+
+// redirectRecorder keeps where a fetch was permanently redirected to, see
+// checkRedirect
+type redirectRecorder struct {
+	// the last url reached through permanent redirects only
+	movedTo string
+
+	// whether a temporary redirect was followed, the permanent ones after it
+	// don't say where the feed lives
+	temporary bool
+}
+
+// withRedirectRecorder has the fetches made with the context it returns
+// record where they were permanently redirected to in rec
+func withRedirectRecorder(ctx context.Context, rec *redirectRecorder) context.Context {
+	return context.WithValue(ctx, redirectRecorderKey{}, rec)
+}
+
+// checkRedirect is the CheckRedirect of the fetch client, it records the
+// permanent redirects of the fetches that want to know where their feed
+// moved (see withRedirectRecorder)
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("stopped after too many redirects")
+	}
+
+	rec, ok := req.Context().Value(redirectRecorderKey{}).(*redirectRecorder)
+	if !ok || rec.temporary || req.Response == nil {
+		return nil
+	}
+	switch req.Response.StatusCode {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		rec.movedTo = req.URL.String()
+	default:
+		rec.temporary = true
+	}
+	return nil
+}
+
+// moveFeed has a feed that moved for good fetched at its new url from then
+// on, keeping its subscribers and what they read (see sqlite.MoveFeed). It
+// returns the url the feed goes by now: the new one, or the one mire already
+// knew it by.
+func (r *Reaper) moveFeed(from string, to string) (string, error) {
+	if err := CheckFeedTarget(to); err != nil {
+		return "", err
+	}
+
+	to, err := r.db.MoveFeed(from, to)
+	if err != nil {
+		return "", err
+	}
+
+	r.mu.Lock()
+	fh := r.feeds[from]
+	delete(r.feeds, from)
+	if _, ok := r.feeds[to]; !ok && fh != nil {
+		r.feeds[to] = fh
+	}
+	r.mu.Unlock()
+
+	r.tracker.forget(from)
+	r.seen.forget(from)
+
+	log.Printf("reaper: '%s' moved to '%s'\n", from, to)
+	return to, nil
+}
@@ -0,0 +1,102 @@
+package reaper
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+// how many posts are remembered per feed, the most recent ones. Feeds rarely
+// have more items than this, the older ones aren't in them anymore.
+const numSeenPostsPerFeed = 100
+
+// seenPosts remembers the posts the saver knows are in the database, by
+// feed, so that the ones every refresh of a feed brings back aren't sent to
+// the database again. Post URLs are kept as hashes, there's a lot of them.
+type seenPosts struct {
+	mu    sync.Mutex
+	feeds map[string]*seenFeed
+}
+
+type seenFeed struct {
+	posts map[uint64]struct{}
+
+	// oldest first, for the oldest to be forgotten first
+	order []uint64
+}
+
+func newSeenPosts() *seenPosts {
+	return &seenPosts{feeds: make(map[string]*seenFeed)}
+}
+
+func hashPostURL(postURL string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(postURL))
+	return h.Sum64()
+}
+
+// known tells whether the posts of a feed were loaded from the database, see
+// load
+func (s *seenPosts) known(feedURL string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.feeds[feedURL]
+	return ok
+}
+
+// load remembers the posts of a feed that are in the database, oldest first
+func (s *seenPosts) load(feedURL string, postURLs []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds[feedURL] = &seenFeed{posts: make(map[uint64]struct{})}
+	for _, postURL := range postURLs {
+		s.addLocked(feedURL, postURL)
+	}
+}
+
+func (s *seenPosts) has(feedURL string, postURL string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.feeds[feedURL]
+	if !ok {
+		return false
+	}
+	_, ok = f.posts[hashPostURL(postURL)]
+	return ok
+}
+
+// add remembers a post that was saved, forgetting the oldest one of its feed
+// if there's too many
+func (s *seenPosts) add(feedURL string, postURL string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addLocked(feedURL, postURL)
+}
+
+func (s *seenPosts) addLocked(feedURL string, postURL string) {
+	f, ok := s.feeds[feedURL]
+	if !ok {
+		// not loaded yet, it will be before it's looked at
+		return
+	}
+
+	h := hashPostURL(postURL)
+	if _, ok := f.posts[h]; ok {
+		return
+	}
+	f.posts[h] = struct{}{}
+	f.order = append(f.order, h)
+
+	if len(f.order) > numSeenPostsPerFeed {
+		delete(f.posts, f.order[0])
+		f.order = f.order[1:]
+	}
+}
+
+// forget forgets the posts of a feed, for when they're deleted
+func (s *seenPosts) forget(feedURL string) {
+	s.mu.Lock()
+	delete(s.feeds, feedURL)
+	s.mu.Unlock()
+}
@@ -0,0 +1,147 @@
+package reaper
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// how long the addresses of a host are remembered, feeds of the same site are
+// often fetched one after the other
+const dnsCacheTTL = 5 * time.Minute
+
+// how long a fetch can take at most, headers and body included, so that a
+// site that never answers doesn't hold up a fetch worker forever
+const fetchTimeout = time.Minute
+
+// newFetchClient returns the client every fetch goes through, so that
+// connections to the same site are reused from one fetch to the next. It
+// doesn't connect to hostile addresses unless allowPrivate, see
+// blockHostileAddresses, and records where feeds moved, see checkRedirect.
+func newFetchClient(allowPrivate bool) *http.Client {
+	dialer := newDialer(allowPrivate)
+	dns := newDNSCache()
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dns.dialContext(dialer),
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          200,
+		MaxIdleConnsPerHost:   numFetchWorkers,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{Transport: transport, Timeout: fetchTimeout, CheckRedirect: checkRedirect}
+}
+
+// newDialer returns the dialer of the clients mire makes requests with, which
+// doesn't connect to hostile addresses unless allowPrivate
+func newDialer(allowPrivate bool) *net.Dialer {
+	dialer := &net.Dialer{
+		Timeout:   15 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	if !allowPrivate {
+		dialer.Control = blockHostileAddresses
+	}
+	return dialer
+}
+
+// NewTransport returns a transport for the requests mire makes to sites its
+// users point it at besides fetching feeds: finding feeds, sending
+// webmentions, delivering webhooks. Like fetches, they don't go to hostile
+// addresses unless AllowPrivateAddresses.
+func NewTransport() *http.Transport {
+	dialer := newDialer(true)
+	dialer.Control = func(network string, address string, conn syscall.RawConn) error {
+		if AllowPrivateAddresses {
+			return nil
+		}
+		return blockHostileAddresses(network, address, conn)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+// dnsCache remembers the addresses hosts resolved to for a while. Failed
+// lookups aren't remembered.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+
+	// net.DefaultResolver.LookupHost, but tests count the lookups
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+}
+
+type dnsEntry struct {
+	addrs   []string
+	expires time.Time
+}
+
+func newDNSCache() *dnsCache {
+	return &dnsCache{
+		entries:    make(map[string]dnsEntry),
+		lookupHost: net.DefaultResolver.LookupHost,
+	}
+}
+
+func (c *dnsCache) lookup(ctx context.Context, host string) ([]string, error) {
+	now := time.Now()
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	c.mu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.entries[host] = dnsEntry{addrs: addrs, expires: now.Add(dnsCacheTTL)}
+	c.mu.Unlock()
+	return addrs, nil
+}
+
+// dialContext dials with dialer, looking up hosts in the cache first. The
+// addresses of a host are tried in order, like net.Dialer does.
+func (c *dnsCache) dialContext(dialer *net.Dialer) func(ctx context.Context, network string, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network string, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) != nil {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		addrs, err := c.lookup(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, &net.DNSError{Err: "no addresses", Name: host}
+		}
+
+		var errs []error
+		for _, ip := range addrs {
+			conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip, port))
+			if err == nil {
+				return conn, nil
+			}
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+}
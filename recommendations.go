@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const numRecommendedFeeds = 5
+
+type recommendedFeedEntry struct {
+	*sqlite.FeedRecommendation
+	Title string
+}
+
+func (s *Site) getRecommendedFeeds(username string, languages []string) ([]*recommendedFeedEntry, error) {
+	recommendations, err := s.db.GetFeedRecommendations(username, languages, numRecommendedFeeds)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]*recommendedFeedEntry, 0, len(recommendations))
+	for _, fr := range recommendations {
+		entries = append(entries, &recommendedFeedEntry{
+			FeedRecommendation: fr,
+			Title:              s.feedTitle(fr.URL),
+		})
+	}
+	return entries, nil
+}
+
+// dismissRecommendationHandler stops recommending a feed to the user
+func (s *Site) dismissRecommendationHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("dismissRecommendationHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("dismissRecommendationHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.DismissFeedRecommendation(s.username(r), feedURL)
+	if err != nil {
+		s.renderErr("dismissRecommendationHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/discover", http.StatusSeeOther)
+}
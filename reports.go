@@ -0,0 +1,183 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const maxReportReasonLength = 500
+
+// feedReportHandler lets people flag a feed for the admins to look at, eg.
+// because it's spam or it publishes something that shouldn't be on discover
+func (s *Site) feedReportHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedReportHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedReportHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists, err := s.db.FeedExists(feedURL)
+	if err != nil {
+		s.renderErr("feedReportHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !exists {
+		http.NotFound(w, r)
+		return
+	}
+
+	reason := strings.TrimSpace(r.FormValue("reason"))
+	if reason == "" {
+		s.renderErr("feedReportHandler", w, "please say why you're reporting this feed", http.StatusBadRequest)
+		return
+	}
+	if utf8.RuneCountInString(reason) > maxReportReasonLength {
+		s.renderErr("feedReportHandler", w, "the reason is too long", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.ReportFeed(s.username(r), feedURL, reason)
+	if err != nil {
+		s.renderErr("feedReportHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
+// adminReportsHandler shows the moderation queue: the reports nobody acted on
+// yet, plus what was done about the latest ones
+func (s *Site) adminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminReportsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	open, err := s.db.GetOpenFeedReports()
+	if err != nil {
+		s.renderErr("adminReportsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resolved, err := s.db.GetResolvedFeedReports(numModerationEntries)
+	if err != nil {
+		s.renderErr("adminReportsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Open     []*sqlite.FeedReport
+		Resolved []*sqlite.FeedReport
+	}{
+		Open:     open,
+		Resolved: resolved,
+	}
+
+	s.renderPage(w, r, "admin_reports", data)
+}
+
+// adminReportActionHandler acts on a report. Whatever the action, it closes
+// every open report about the same feed.
+func (s *Site) adminReportActionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminReportActionHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	reportId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	report, err := s.db.GetFeedReport(reportId)
+	if err != nil {
+		s.renderErr("adminReportActionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if report == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	var resolution string
+	switch r.FormValue("action") {
+	case "ignore":
+		resolution = sqlite.ReportResolutionIgnored
+	case "hide":
+		resolution = sqlite.ReportResolutionHidden
+		err = s.db.SetFeedHiddenFromDiscover(report.FeedURL, true)
+	case "delete":
+		resolution = sqlite.ReportResolutionDeleted
+		err = s.db.DeleteFeed(report.FeedURL)
+		if err == nil && s.reaper.HasFeed(report.FeedURL) {
+			s.reaper.RemoveFeed(report.FeedURL)
+		}
+	default:
+		s.renderErr("adminReportActionHandler", w, "unknown action", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("adminReportActionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.ResolveFeedReports(report.FeedURL, resolution)
+	if err != nil {
+		s.renderErr("adminReportActionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
+
+// feedDiscoverHandler lets admins hide a feed from discover, or bring back
+// one that was hidden.
+func (s *Site) feedDiscoverHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("feedDiscoverHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedDiscoverHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetFeedHiddenFromDiscover(feedURL, r.FormValue("hide") == "on")
+	if err != nil {
+		s.renderErr("feedDiscoverHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
+// feedReportStatus returns whether a feed is hidden from discover and whether
+// the viewer has an open report about it, for the feed details page
+func (s *Site) feedReportStatus(r *http.Request, feedURL string) (hiddenFromDiscover bool, reported bool, err error) {
+	hiddenFromDiscover, err = s.db.IsFeedHiddenFromDiscover(feedURL)
+	if err != nil && err != sql.ErrNoRows {
+		return false, false, err
+	}
+
+	if s.loggedIn(r) {
+		reported, err = s.db.HasOpenFeedReport(s.username(r), feedURL)
+		if err != nil {
+			return false, false, err
+		}
+	}
+	return hiddenFromDiscover, reported, nil
+}
@@ -0,0 +1,31 @@
+"""
+Grants (or revokes) admin rights to a user.
+
+Admins can moderate the instance from the web UI, e.g. by assigning topics to
+feeds.
+"""
+
+import sys
+import sqlite3
+
+def main(username, is_admin):
+    conn = sqlite3.connect('mire.db')
+    cursor = conn.cursor()
+
+    cursor.execute("SELECT id FROM user WHERE username=?", (username,))
+    if not cursor.fetchone():
+        print("User not found")
+        sys.exit(1)
+
+    cursor.execute("UPDATE user SET is_admin=? WHERE username=?", (1 if is_admin else 0, username))
+    conn.commit()
+    conn.close()
+
+    print(f"User {username} is {'now' if is_admin else 'no longer'} an admin")
+
+if __name__ == "__main__":
+    if len(sys.argv) not in (2, 3) or (len(sys.argv) == 3 and sys.argv[2] != "--revoke"):
+        print("Usage: set_admin.py <username> [--revoke]")
+        sys.exit(1)
+
+    main(sys.argv[1], len(sys.argv) == 2)
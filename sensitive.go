@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+
+	"codeberg.org/meadowingc/mire/topics"
+)
+
+// feedSensitiveHandler lets admins flag a feed as sensitive, mark it as safe
+// or hand the decision back to the heuristics.
+func (s *Site) feedSensitiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("feedSensitiveHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedSensitiveHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch r.FormValue("sensitive") {
+	case "yes":
+		err = s.db.SetFeedSensitive(feedURL, true, true)
+	case "no":
+		err = s.db.SetFeedSensitive(feedURL, false, true)
+	case "guess":
+		err = s.db.SetFeedSensitive(feedURL, s.guessFeedSensitive(feedURL), false)
+	default:
+		s.renderErr("feedSensitiveHandler", w, "invalid choice", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("feedSensitiveHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
+// guessFeedSensitive tells whether a feed looks like it should be flagged as
+// sensitive, going by what it says about itself and its recent posts.
+func (s *Site) guessFeedSensitive(feedURL string) bool {
+	postTitles, err := s.db.GetRecentPostTitlesForFeed(feedURL, 30)
+	if err != nil {
+		log.Printf("[err] guessFeedSensitive: could not get posts for '%s': %s\n", feedURL, err)
+	}
+
+	var title, description string
+	if s.reaper.HasFeed(feedURL) {
+		feed := s.reaper.GetFeed(feedURL)
+		title, description = feed.Title, feed.Description
+
+		// podcasts declare explicit content themselves
+		if feed.ITunesExt != nil && slices.Contains([]string{"yes", "true", "explicit"}, feed.ITunesExt.Explicit) {
+			return true
+		}
+	}
+
+	return topics.IsSensitive(title, description, postTitles)
+}
+
+// classifySensitiveFeeds guesses which feeds are sensitive, leaving alone the
+// ones an admin already decided about.
+func classifySensitiveFeeds(s *Site) {
+	feedURLs, err := s.db.GetFeedsWithoutAdminSensitivity()
+	if err != nil {
+		log.Printf("[err] classifySensitiveFeeds: could not get feeds: %s\n", err)
+		return
+	}
+
+	for _, feedURL := range feedURLs {
+		err = s.db.SetFeedSensitive(feedURL, s.guessFeedSensitive(feedURL), false)
+		if err != nil {
+			log.Printf("[err] classifySensitiveFeeds: could not save '%s': %s\n", feedURL, err)
+		}
+	}
+}
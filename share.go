@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const numRecommendedPostsOnProfile = 20
+
+// shareHandler shows a public permalink for a single post, meant to be
+// passed around when posting a find somewhere else.
+func (s *Site) shareHandler(w http.ResponseWriter, r *http.Request) {
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	recommenders, err := s.db.GetPostRecommenders(postId)
+	if err != nil {
+		s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	isRecommended := false
+	canShareToMastodon := false
+	canSaveToInstapaper := false
+	canSaveToWallabag := false
+	var star *sqlite.PostStar
+	if s.loggedIn(r) {
+		isRecommended, err = s.db.IsPostRecommendedBy(s.username(r), postId)
+		if err != nil {
+			s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		mastodonAccount, err := s.db.GetMastodonAccount(s.username(r))
+		if err != nil {
+			s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		canShareToMastodon = mastodonAccount != nil
+
+		if s.instapaper.Enabled() {
+			instapaperAccount, err := s.db.GetInstapaperAccount(s.username(r))
+			if err != nil {
+				s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			canSaveToInstapaper = instapaperAccount != nil
+		}
+
+		wallabagAccount, err := s.db.GetWallabagAccount(s.username(r))
+		if err != nil {
+			s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		canSaveToWallabag = wallabagAccount != nil
+
+		star, err = s.db.GetPostStar(s.username(r), postId)
+		if err != nil {
+			s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	var comments []*sqlite.Comment
+	commentsEnabled := s.commentsEnabled()
+	if commentsEnabled {
+		comments, err = s.db.GetPostComments(postId)
+		if err != nil {
+			s.renderErr("shareHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := struct {
+		Post                *sqlite.Post
+		FeedTitle           string
+		Recommenders        []string
+		IsRecommended       bool
+		CanShareToMastodon  bool
+		CanSaveToInstapaper bool
+		CanSaveToWallabag   bool
+		Star                *sqlite.PostStar
+		CommentsEnabled     bool
+		Comments            []*sqlite.Comment
+		MaxCommentLength    int
+		IsAdmin             bool
+	}{
+		Post:                post,
+		FeedTitle:           s.feedTitle(post.FeedURL),
+		Recommenders:        recommenders,
+		IsRecommended:       isRecommended,
+		CanShareToMastodon:  canShareToMastodon,
+		CanSaveToInstapaper: canSaveToInstapaper,
+		CanSaveToWallabag:   canSaveToWallabag,
+		Star:                star,
+		CommentsEnabled:     commentsEnabled,
+		Comments:            comments,
+		MaxCommentLength:    maxCommentLength,
+		IsAdmin:             s.isAdmin(r),
+	}
+
+	s.renderPageWithTitle(w, r, "share", post.Title, data)
+}
+
+func (s *Site) recommendPostHandler(w http.ResponseWriter, r *http.Request) {
+	s.setPostRecommended("recommendPostHandler", w, r, true)
+}
+
+func (s *Site) unrecommendPostHandler(w http.ResponseWriter, r *http.Request) {
+	s.setPostRecommended("unrecommendPostHandler", w, r, false)
+}
+
+// setPostRecommended publicly recommends (or stops recommending) a post.
+// Unlike favorites, recommendations are shown to everyone and always shared
+// with the user's followers.
+func (s *Site) setPostRecommended(caller string, w http.ResponseWriter, r *http.Request, recommend bool) {
+	if !s.loggedIn(r) {
+		s.renderErr(caller, w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	username := s.username(r)
+	wasRecommended, err := s.db.IsPostRecommendedBy(username, postId)
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if recommend {
+		err = s.db.RecommendPost(username, postId)
+	} else {
+		err = s.db.UnrecommendPost(username, postId)
+	}
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if recommend && !wasRecommended {
+		s.recordActivity(username, sqlite.ActivityRecommend, post.URL, post.Title)
+		s.sendRecommendationWebmention(username, post)
+	}
+	if recommend != wasRecommended {
+		s.federateRecommendation(username, postId, recommend)
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
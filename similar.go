@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const numSimilarFeeds = 10
+
+type similarFeedEntry struct {
+	*sqlite.SimilarFeed
+	Title        string
+	IsSubscribed bool
+}
+
+// getSimilarFeeds returns the feeds commonly co-subscribed with the given one,
+// flagging the ones the user is already subscribed to.
+func (s *Site) getSimilarFeeds(r *http.Request, feedURL string) ([]*similarFeedEntry, error) {
+	feeds, err := s.db.GetSimilarFeeds(feedURL, numSimilarFeeds)
+	if err != nil {
+		return nil, err
+	}
+
+	var userFeeds []string
+	if s.loggedIn(r) {
+		userFeeds = s.db.GetUserFeedURLs(s.username(r))
+	}
+
+	entries := make([]*similarFeedEntry, 0, len(feeds))
+	for _, feed := range feeds {
+		entries = append(entries, &similarFeedEntry{
+			SimilarFeed:  feed,
+			Title:        s.feedTitle(feed.URL),
+			IsSubscribed: slices.Contains(userFeeds, feed.URL),
+		})
+	}
+	return entries, nil
+}
+
+// feedSubscribeHandler subscribes the user to a single feed that mire already
+// knows about, without having to go through the settings page.
+func (s *Site) feedSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedSubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedSubscribeHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !s.reaper.HasFeed(feedURL) {
+		s.renderErr("feedSubscribeHandler", w, "unknown feed", http.StatusNotFound)
+		return
+	}
+
+	if err := s.subscribeToFeeds(s.username(r), []string{feedURL}); err != nil {
+		s.renderQuotaErr("feedSubscribeHandler", w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
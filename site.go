@@ -1,6 +1,8 @@
 package main
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
@@ -11,20 +13,41 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"codeberg.org/meadowingc/mire/bookmarks"
 	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/fediverse"
+	"codeberg.org/meadowingc/mire/instapaper"
+	"codeberg.org/meadowingc/mire/language"
 	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/mailer"
+	"codeberg.org/meadowingc/mire/ntfy"
 	"codeberg.org/meadowingc/mire/reaper"
 	"codeberg.org/meadowingc/mire/sqlite"
 	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+	"codeberg.org/meadowingc/mire/topics"
+	"codeberg.org/meadowingc/mire/youtube"
 	"github.com/mmcdole/gofeed"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+	// how long people who ask to be remembered stay logged in, unless the
+	// instance sets MIRE_SESSION_LIFETIME_DAYS
+	defaultSessionLifetimeDays = 365
+
+	// how long the sessions of people who don't ask to be remembered last at
+	// most, they also end when the browser is closed
+	shortSessionLifetime = 24 * time.Hour
+)
+
 type Site struct {
 	// title of the website
 	title string
@@ -34,33 +57,53 @@ type Site struct {
 
 	// site database handle
 	db *sqlite.DB
-}
 
-var templates *template.Template
+	// sends emails, when the instance is set up to
+	mailer *mailer.Mailer
+
+	// saves posts to people's instapaper, when the instance is set up to
+	instapaper *instapaper.Client
+
+	// how many feeds people can subscribe to
+	quota *subscriptionQuota
+
+	// how long people who asked to be remembered stay logged in, see login
+	sessionLifetime time.Duration
+}
 
 // New returns a fully populated & ready for action Site
 func New() *Site {
+	return newSite("mire.db?_pragma=journal_mode(WAL)")
+}
+
+// newSite sets up a site using the database at dbPath
+func newSite(dbPath string) *Site {
 	title := "mire"
-	db := sqlite.New(title + ".db?_pragma=journal_mode(WAL)")
+	db := sqlite.New(dbPath)
 
 	s := Site{
-		title:  title,
-		reaper: reaper.New(db),
-		db:     db,
+		title:      title,
+		reaper:     reaper.New(db),
+		db:         db,
+		mailer:     mailer.New(mailer.ConfigFromEnv()),
+		instapaper: instapaper.New(instapaper.ConfigFromEnv()),
+		quota:      subscriptionQuotaFromEnv(),
 	}
 
-	funcMap := template.FuncMap{
-		"printDomain": s.printDomain,
-		"timeSince":   s.timeSince,
-		"trimSpace":   strings.TrimSpace,
-		"escapeURL":   url.QueryEscape,
-		"makeSlice": func(args ...interface{}) []interface{} {
-			return args
-		},
+	// sessions can't last no time at all
+	sessionLifetimeDays := reaper.EnvInt("MIRE_SESSION_LIFETIME_DAYS", defaultSessionLifetimeDays)
+	if sessionLifetimeDays == 0 {
+		sessionLifetimeDays = defaultSessionLifetimeDays
+	}
+	s.sessionLifetime = time.Duration(sessionLifetimeDays) * 24 * time.Hour
+	if err := db.LimitSessionTokens(time.Now().Add(s.sessionLifetime)); err != nil {
+		log.Fatal(err)
 	}
 
-	tmplFiles := filepath.Join("files", "*.tmpl.html")
-	templates = template.Must(template.New("whatever").Funcs(funcMap).ParseGlob(tmplFiles))
+	// cached pages show posts, new ones should show up
+	s.reaper.OnNewPosts(clearPageCache)
+
+	templates.Store(template.Must(s.parseTemplates()))
 
 	return &s
 }
@@ -83,37 +126,146 @@ func (s *Site) indexHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Site) aboutHandler(w http.ResponseWriter, r *http.Request) {
-	s.renderPage(w, r, "about", globalSiteStats)
+	s.renderPage(w, r, "about", getSiteStats())
+}
+
+// discoverData is what the "discover" template renders, for both the latest
+// and the hot tabs
+type discoverData struct {
+	Items           []*sqlite.Post
+	UserPreferences *user_preferences.UserPreferences
+	Topics          []string
+	Filter          sqlite.DiscoverFilter
+	Hot             bool
+	LastComputed    time.Time
+	Recommended     []*recommendedFeedEntry
+	NewFeeds        []*newFeedEntry
+	HideSubscribed  bool
+	Languages       []string
+	CurrentPath     string
 }
 
 func (s *Site) discoverHandler(w http.ResponseWriter, r *http.Request) {
-	items := s.db.GetLatestPostsForDiscover(100)
-	s.renderPage(w, r, "discover", items)
+	userPreferences := user_preferences.GetDefaultUserPreferences()
+	var recommendedFeeds []*recommendedFeedEntry
+	if s.loggedIn(r) {
+		userPreferences = user_preferences.GetUserPreferences(s.db, s.db.GetUserID(s.username(r)))
+
+		var err error
+		recommendedFeeds, err = s.getRecommendedFeeds(s.username(r), discoverLanguages(userPreferences))
+		if err != nil {
+			s.renderErr("discoverHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	filter := sqlite.DiscoverFilter{
+		Topic: r.URL.Query().Get("topic"),
+	}
+	if filter.Topic != "" && !topics.IsValid(filter.Topic) {
+		e := fmt.Sprintf("unknown topic '%s'", filter.Topic)
+		s.renderErr("discoverHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	hideSubscribed := s.discoverHidesSubscribedFeeds(r, userPreferences)
+	if hideSubscribed {
+		filter.ExcludeSubscribedBy = s.username(r)
+	}
+	if s.loggedIn(r) {
+		filter.ApplyMutesOf = s.username(r)
+		filter.Languages = discoverLanguages(userPreferences)
+		filter.HideSensitive = userPreferences.SensitivePosts == user_preferences.SensitivePostsHide
+	}
+
+	// new feeds don't have topics yet, so they're only shown when browsing
+	// everything
+	var newFeeds []*newFeedEntry
+	if filter.Topic == "" {
+		var err error
+		newFeeds, err = s.getNewFeeds(s.username(r), userPreferences)
+		if err != nil {
+			s.renderErr("discoverHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	data := discoverData{
+		Items:           s.db.GetDiscoverPosts(filter, 100),
+		UserPreferences: userPreferences,
+		Topics:          topics.All,
+		Filter:          filter,
+		Recommended:     recommendedFeeds,
+		NewFeeds:        newFeeds,
+		HideSubscribed:  hideSubscribed,
+		Languages:       filter.Languages,
+		CurrentPath:     r.URL.RequestURI(),
+	}
+
+	s.renderPage(w, r, "discover", data)
+}
+
+// discoverLanguages returns the languages the user wants to see on discover,
+// or nil if they read every language.
+func discoverLanguages(userPreferences *user_preferences.UserPreferences) []string {
+	if userPreferences.DiscoverLanguages == user_preferences.AnyLanguage {
+		return nil
+	}
+
+	var languages []string
+	for _, code := range strings.Split(userPreferences.DiscoverLanguages, ",") {
+		if language.IsValid(code) {
+			languages = append(languages, code)
+		}
+	}
+	return languages
+}
+
+// discoverHidesSubscribedFeeds returns whether discover should leave out the
+// feeds the user is subscribed to. The "subscribed" query parameter overrides
+// the user's preference.
+func (s *Site) discoverHidesSubscribedFeeds(r *http.Request, userPreferences *user_preferences.UserPreferences) bool {
+	if !s.loggedIn(r) {
+		return false
+	}
+
+	switch r.URL.Query().Get("subscribed") {
+	case "hide":
+		return true
+	case "show":
+		return false
+	default:
+		return userPreferences.HideSubscribedFeedsInDiscover
+	}
 }
 
 func (s *Site) loginHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method == "GET" {
 		if s.loggedIn(r) {
-			http.Redirect(w, r, "/", http.StatusSeeOther)
+			http.Redirect(w, r, localRedirectTarget(r, "/"), http.StatusSeeOther)
 		} else {
-			s.renderPage(w, r, "login", nil)
+			s.renderPage(w, r, "login", struct{ Next string }{localRedirectTarget(r, "")})
 		}
 	}
 	if r.Method == "POST" {
 		username := r.FormValue("username")
 		password := r.FormValue("password")
+		remember := r.FormValue("remember") == "on"
 
-		err := s.login(w, username, password)
+		err := s.login(w, username, password, remember)
 		if err != nil {
 			s.renderErr("loginHandler", w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, localRedirectTarget(r, "/"), http.StatusSeeOther)
 	}
 }
 
 // TODO: make this take a POST only in accordance w/ some spec
 func (s *Site) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie("session_token"); err == nil {
+		s.db.DeleteShortSession(cookie.Value)
+	}
 	http.SetCookie(w, &http.Cookie{
 		Name:  "session_token",
 		Value: "",
@@ -129,12 +281,12 @@ func (s *Site) registerHandler(w http.ResponseWriter, r *http.Request) {
 		s.renderErr("registerHandler", w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = s.login(w, username, password)
+	err = s.login(w, username, password, true)
 	if err != nil {
 		s.renderErr("registerHandler", w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	http.Redirect(w, r, "/welcome", http.StatusSeeOther)
 }
 
 func (s *Site) userHandler(w http.ResponseWriter, r *http.Request) {
@@ -145,12 +297,16 @@ func (s *Site) userHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	s.hideFromSearchEngines(w, username)
+
+	// so IndieWeb readers know where to sign in and read from
+	setIndieAuthLinks(w)
 
 	// logged in user preferences
 	loggedInUsername := s.username(r)
 	var userPreferences *user_preferences.UserPreferences
 	if loggedInUsername != "" {
-		userPreferences = user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username))
+		userPreferences = user_preferences.GetUserPreferences(s.db, s.db.GetUserID(loggedInUsername))
 	} else {
 		userPreferences = user_preferences.GetDefaultUserPreferences()
 	}
@@ -195,23 +351,155 @@ func (s *Site) userHandler(w http.ResponseWriter, r *http.Request) {
 		favoritesUnread = favoritesUnreadFromDb
 	}
 
+	// optionally sort the unread queue so that the quickest reads come first.
+	// Posts with an unknown word count go last.
+	sortQueueByReadingTime := r.URL.Query().Get("sort") == "reading-time"
+	if sortQueueByReadingTime {
+		sort.SliceStable(oldestUnreadPosts, func(i, j int) bool {
+			a, b := oldestUnreadPosts[i].WordCount, oldestUnreadPosts[j].WordCount
+			if a == 0 || b == 0 {
+				return b == 0 && a != 0
+			}
+			return a < b
+		})
+	}
+
+	card, err := s.getProfileCard(username)
+	if err != nil {
+		s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if isUserRequestingOwnPage {
+		if err := s.applySubscriptionTitles(username, items, favoritesUnread); err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		mastodonAccount, err := s.db.GetMastodonAccount(username)
+		if err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if mastodonAccount != nil {
+			for _, entries := range [][]*sqlite.UserPostEntry{items, favoritesUnread} {
+				for _, entry := range entries {
+					entry.CanShareToMastodon = true
+				}
+			}
+		}
+
+		if s.instapaper.Enabled() {
+			instapaperAccount, err := s.db.GetInstapaperAccount(username)
+			if err != nil {
+				s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			if instapaperAccount != nil {
+				for _, entries := range [][]*sqlite.UserPostEntry{items, favoritesUnread} {
+					for _, entry := range entries {
+						entry.CanSaveToInstapaper = true
+					}
+				}
+			}
+		}
+
+		wallabagAccount, err := s.db.GetWallabagAccount(username)
+		if err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		if wallabagAccount != nil {
+			for _, entries := range [][]*sqlite.UserPostEntry{items, favoritesUnread} {
+				for _, entry := range entries {
+					entry.CanSaveToWallabag = true
+				}
+			}
+		}
+	}
+
+	// visitors get to see what the user recommends publicly
+	var recommended []*sqlite.RecommendedPost
+	if !isUserRequestingOwnPage {
+		recommended, err = s.db.GetUserRecommendedPosts(username, numRecommendedPostsOnProfile)
+		if err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// people know what they subscribed to, sensitive posts are only
+		// hidden from visitors
+		if userPreferences.SensitivePosts == user_preferences.SensitivePostsHide {
+			items = slices.DeleteFunc(items, func(entry *sqlite.UserPostEntry) bool { return entry.Sensitive })
+			recommended = slices.DeleteFunc(recommended, func(post *sqlite.RecommendedPost) bool { return post.Sensitive })
+		}
+		for _, entry := range items {
+			entry.Blur = entry.Sensitive && userPreferences.SensitivePosts == user_preferences.SensitivePostsBlur
+		}
+	}
+
+	isFollowing := false
+	if loggedInUsername != "" && !isUserRequestingOwnPage {
+		isFollowing, err = s.db.IsFollowing(loggedInUsername, username)
+		if err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	data := struct {
-		User              string
-		Items             []*sqlite.UserPostEntry
-		OldestUnread      []*sqlite.UserPostEntry
-		RequestingOwnPage bool
-		UserPreferences   *user_preferences.UserPreferences
-		FavoritesUnread   []*sqlite.UserPostEntry
+		User                   string
+		ProfileCard            *profileCard
+		IsFollowing            bool
+		Items                  []*sqlite.UserPostEntry
+		OldestUnread           []*sqlite.UserPostEntry
+		RequestingOwnPage      bool
+		UserPreferences        *user_preferences.UserPreferences
+		FavoritesUnread        []*sqlite.UserPostEntry
+		SortQueueByReadingTime bool
+		Recommended            []*sqlite.RecommendedPost
 	}{
-		User:              username,
-		Items:             items,
-		OldestUnread:      oldestUnreadPosts,
-		RequestingOwnPage: isUserRequestingOwnPage,
-		UserPreferences:   userPreferences,
-		FavoritesUnread:   favoritesUnread,
+		User:                   username,
+		ProfileCard:            card,
+		IsFollowing:            isFollowing,
+		Items:                  items,
+		OldestUnread:           oldestUnreadPosts,
+		RequestingOwnPage:      isUserRequestingOwnPage,
+		UserPreferences:        userPreferences,
+		FavoritesUnread:        favoritesUnread,
+		SortQueueByReadingTime: sortQueueByReadingTime,
+		Recommended:            recommended,
 	}
 
-	s.renderPage(w, r, "user", data)
+	title := "user | " + s.title
+	if isUserRequestingOwnPage {
+		unreadCount, err := s.db.GetUnreadCountForUser(username)
+		if err != nil {
+			s.renderErr("userHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if unreadCount > 0 {
+			title = fmt.Sprintf("(%d) %s", unreadCount, title)
+		}
+	}
+
+	s.renderPageWithTitle(w, r, "user", title, data)
+}
+
+// hideFromSearchEngines asks search engines not to index a page of someone
+// who'd rather their reading habits didn't show up in search results. Pages
+// rendered after it also say so in their <head>.
+func (s *Site) hideFromSearchEngines(w http.ResponseWriter, username string) {
+	preference := s.db.GetSingleUserPreference(s.db.GetUserID(username), "hideFromSearchEngines")
+	if preference == nil {
+		return
+	}
+	if hide, _ := strconv.ParseBool(*preference); hide {
+		w.Header().Set("X-Robots-Tag", "noindex")
+	}
 }
 
 func (s *Site) userBlogrollHandler(w http.ResponseWriter, r *http.Request) {
@@ -221,19 +509,96 @@ func (s *Site) userBlogrollHandler(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
+	s.hideFromSearchEngines(w, username)
+
+	card, err := s.getProfileCard(username)
+	if err != nil {
+		s.renderErr("userBlogrollHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	collections, err := s.db.GetUserCollections(username)
+	if err != nil {
+		s.renderErr("userBlogrollHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	isFollowingBlogroll := false
+	if s.loggedIn(r) && s.username(r) != username {
+		isFollowingBlogroll, err = s.db.IsFollowingBlogroll(s.username(r), username)
+		if err != nil {
+			s.renderErr("userBlogrollHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	items := s.db.GetUserFeedURLs(username)
 	data := struct {
-		User  string
-		Items []string
+		User                string
+		ProfileCard         *profileCard
+		Items               []string
+		Collections         []*sqlite.Collection
+		RequestingOwnPage   bool
+		IsFollowingBlogroll bool
 	}{
-		User:  username,
-		Items: items,
+		User:                username,
+		ProfileCard:         card,
+		Items:               items,
+		Collections:         collections,
+		RequestingOwnPage:   s.username(r) == username,
+		IsFollowingBlogroll: isFollowingBlogroll,
 	}
 
 	s.renderPage(w, r, "blogroll", data)
 }
 
+// blogrollFeed is a feed of a blogroll, as /u/{username}/blogroll.json has it
+type blogrollFeed struct {
+	Title   string `json:"title"`
+	FeedURL string `json:"feed_url"`
+	SiteURL string `json:"site_url"`
+}
+
+// userBlogrollJSONHandler serves someone's blogroll as JSON, for websites to
+// show it and keep it up to date with what they read on mire. Any website
+// can fetch it.
+func (s *Site) userBlogrollJSONHandler(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+
+	if !s.db.UserExists(username) {
+		http.NotFound(w, r)
+		return
+	}
+	s.hideFromSearchEngines(w, username)
+
+	feeds := []blogrollFeed{}
+	for _, feedURL := range s.db.GetUserFeedURLs(username) {
+		feed := blogrollFeed{FeedURL: feedURL, SiteURL: "https://" + s.printDomain(feedURL)}
+		if s.reaper.HasFeed(feedURL) {
+			f := s.reaper.GetFeed(feedURL)
+			feed.Title = strings.TrimSpace(f.Title)
+			if f.Link != "" {
+				feed.SiteURL = f.Link
+			}
+		}
+		if feed.Title == "" {
+			feed.Title = s.printDomain(feedURL)
+		}
+		feeds = append(feeds, feed)
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	s.renderJSON(w, struct {
+		Username string         `json:"username"`
+		URL      string         `json:"url"`
+		Feeds    []blogrollFeed `json:"feeds"`
+	}{
+		Username: username,
+		URL:      constants.BASE_URL + "/u/" + username + "/blogroll",
+		Feeds:    feeds,
+	})
+}
+
 func (s *Site) settingsHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.loggedIn(r) {
 		s.renderErr("settingsHandler", w, "", http.StatusUnauthorized)
@@ -252,51 +617,487 @@ func (s *Site) settingsHandler(w http.ResponseWriter, r *http.Request) {
 		return urlsAndErrors[i].URL < urlsAndErrors[j].URL
 	})
 
-	userPreferences := user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username))
+	userPreferences := user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username))
+
+	card, err := s.getProfileCard(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	discoverMutes, err := s.db.GetDiscoverMutes(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	followedBlogrolls, err := s.db.GetFollowedBlogrolls(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	mastodonAccount, err := s.db.GetMastodonAccount(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	instapaperAccount, err := s.db.GetInstapaperAccount(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	wallabagAccount, err := s.db.GetWallabagAccount(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	readwiseConnection, err := s.db.GetReadwiseConnection(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bookmarkService, err := s.db.GetBookmarkService(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	bookmarkTags := defaultBookmarkTags
+	if bookmarkService != nil {
+		bookmarkTags = strings.Join(bookmarkService.Tags, " ")
+	}
+
+	digestEmail, err := s.db.GetDigestEmail(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	kindleAddress, err := s.db.GetKindleAddress(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ntfySubscription, err := s.db.GetNtfySubscription(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	discordWebhooks, err := s.db.GetUserDiscordWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slackWebhooks, err := s.db.GetUserSlackWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	collections, err := s.db.GetUserCollections(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	outgoingWebhooks, err := s.db.GetUserOutgoingWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	webhookDeliveries, err := s.db.GetRecentWebhookDeliveries(username, numRecentWebhookDeliveries)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	matrixNotification, err := s.db.GetMatrixNotification(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	pushSubscriptions, err := s.db.GetUserPushSubscriptions(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	apps, err := s.db.GetUserIndieAuthTokens(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recentUnsubscribes, err := s.db.GetRecentUnsubscribes(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filterRules, err := s.db.GetUserFilterRules(username)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	deadFeeds, err := s.db.GetDeadFeeds(username, deadFeedDays, minDeadFeedFailures)
+	if err != nil {
+		s.renderErr("settingsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		UrlsAndErrors          []sqlite.FeedUrlForSettings
+		RecentUnsubscribes     []*sqlite.RecentUnsubscribe
+		DeadFeeds              []*sqlite.DeadFeed
+		DeadFeedDays           int
+		UserPreferences        *user_preferences.UserPreferences
+		ProfileCard            *profileCard
+		DiscoverMutes          []*sqlite.DiscoverMute
+		FollowedBlogrolls      []string
+		FediverseHandle        string
+		Mastodon               *sqlite.MastodonAccount
+		DefaultToot            string
+		Instapaper             *sqlite.InstapaperAccount
+		InstapaperEnabled      bool
+		Wallabag               *sqlite.WallabagAccount
+		Readwise               *sqlite.ReadwiseConnection
+		Bookmarks              *sqlite.BookmarkService
+		BookmarkServices       []string
+		BookmarkTags           string
+		Languages              []string
+		DiscoverLanguages      []string
+		MailerEnabled          bool
+		DigestEmail            string
+		KindleAddress          string
+		NumExportedPosts       int
+		Ntfy                   *sqlite.NtfySubscription
+		NtfyServer             string
+		NumPushBrowsers        int
+		DiscordWebhooks        []*sqlite.DiscordWebhook
+		SlackWebhooks          []*sqlite.SlackWebhook
+		IsAdmin                bool
+		Collections            []*sqlite.Collection
+		Webhooks               []*sqlite.OutgoingWebhook
+		WebhookDeliveries      []*sqlite.WebhookDelivery
+		Matrix                 *sqlite.MatrixNotification
+		Bookmarklet            template.URL
+		IndieAuthMe            string
+		Apps                   []*sqlite.IndieAuthToken
+		MaxFeeds               int
+		FilterRules            []*sqlite.FilterRule
+		MaxFilterPatternLength int
+	}{
+		UrlsAndErrors:          urlsAndErrors,
+		RecentUnsubscribes:     recentUnsubscribes,
+		DeadFeeds:              deadFeeds,
+		DeadFeedDays:           deadFeedDays,
+		UserPreferences:        userPreferences,
+		ProfileCard:            card,
+		DiscoverMutes:          discoverMutes,
+		FollowedBlogrolls:      followedBlogrolls,
+		FediverseHandle:        fediverseHandle(username),
+		Mastodon:               mastodonAccount,
+		DefaultToot:            defaultTootTemplate,
+		Instapaper:             instapaperAccount,
+		InstapaperEnabled:      s.instapaper.Enabled(),
+		Wallabag:               wallabagAccount,
+		Readwise:               readwiseConnection,
+		Bookmarks:              bookmarkService,
+		BookmarkServices:       bookmarks.Services,
+		BookmarkTags:           bookmarkTags,
+		Languages:              language.All,
+		DiscoverLanguages:      discoverLanguages(userPreferences),
+		MailerEnabled:          s.mailer.Enabled(),
+		DigestEmail:            digestEmail,
+		KindleAddress:          kindleAddress,
+		NumExportedPosts:       numExportedPosts,
+		Ntfy:                   ntfySubscription,
+		NtfyServer:             ntfy.DefaultServer,
+		NumPushBrowsers:        len(pushSubscriptions),
+		DiscordWebhooks:        discordWebhooks,
+		SlackWebhooks:          slackWebhooks,
+		IsAdmin:                s.isAdmin(r),
+		Collections:            collections,
+		Webhooks:               outgoingWebhooks,
+		WebhookDeliveries:      webhookDeliveries,
+		Matrix:                 matrixNotification,
+		Bookmarklet:            bookmarkletURL(),
+		IndieAuthMe:            indieAuthMe(username),
+		Apps:                   apps,
+		MaxFeeds:               s.quota.maxFeeds,
+		FilterRules:            filterRules,
+		MaxFilterPatternLength: maxFilterPatternLength,
+	}
+
+	s.renderPage(w, r, "settings", data)
+}
+
+// settingsAddSubscriptionsHandler subscribes someone to the feeds they
+// listed, one per line, on top of the ones they're subscribed to already
+func (s *Site) settingsAddSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsAddSubscriptionsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var inputURLs []string
+	for _, inputURL := range strings.Split(r.FormValue("urls"), "\n") {
+		if inputURL = strings.TrimSpace(inputURL); inputURL != "" {
+			inputURLs = append(inputURLs, inputURL)
+		}
+	}
+
+	// validate user input
+	username := s.username(r)
+	feedURLs := make([]string, len(inputURLs))
+	var toProbe []string
+	for i, inputURL := range inputURLs {
+		// if the entry is already in reaper (maybe by another url), don't
+		// validate
+		if knownURL := s.db.KnownFeedURL(inputURL); s.reaper.HasFeed(knownURL) {
+			feedURLs[i] = knownURL
+			continue
+		}
+		feedURL, err := resolveFeedURL(inputURL)
+		if err != nil {
+			s.renderErr("settingsAddSubscriptionsHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		feedURLs[i] = feedURL
+
+		// it might be a site rather than a feed, which only fetching it
+		// tells
+		if feedURL == inputURL && !slices.Contains(toProbe, feedURL) {
+			toProbe = append(toProbe, feedURL)
+		}
+	}
+
+	// the reaper fetches the new urls once, the quota is checked before it
+	// does and counts the ones kept when subscribing to them
+	err := s.quota.reserve(username, len(s.db.GetUserFeedURLs(username)), len(toProbe))
+	if err != nil {
+		s.renderQuotaErr("settingsAddSubscriptionsHandler", w, err)
+		return
+	}
+	err = s.registerFeeds(toProbe)
+	s.quota.release(username, len(toProbe))
+	if err != nil {
+		s.renderQuotaErr("settingsAddSubscriptionsHandler", w, err)
+		return
+	}
+
+	// the urls that aren't feeds are sites, subscribed to through the feed
+	// they link to. Feeds that can't be fetched right now are kept with
+	// their fetch error, like sites that don't link to any.
+	var sites []string
+	for _, feedURL := range toProbe {
+		fetchErr, _ := s.db.GetFeedFetchError(feedURL)
+		if fetchErr == gofeed.ErrFeedTypeNotDetected.Error() {
+			sites = append(sites, feedURL)
+		}
+	}
+
+	// looking for the feeds of a long list of sites one after the other
+	// would take ages
+	entries := make([][]pageFeedEntry, len(sites))
+	semaphore := make(chan struct{}, maxConcurrentFeedFetches)
+	var wg sync.WaitGroup
+	for i, site := range sites {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(i int, site string) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			entries[i], _ = s.discoverFeeds(username, site)
+		}(i, site)
+	}
+	wg.Wait()
+
+	for i, site := range sites {
+		if len(entries[i]) == 0 {
+			continue
+		}
+
+		// the reaper has no use for a site it can't parse
+		s.reaper.RemoveFeed(site)
+		if err := s.db.DeleteFeed(site); err != nil {
+			log.Printf("[err] could not forget '%s', it's not a feed: %s\n", site, err)
+		}
+
+		// one site with a few feeds, it's for them to pick
+		if len(entries[i]) > 1 && len(inputURLs) == 1 {
+			http.Redirect(w, r, "/subscribe?url="+url.QueryEscape(site), http.StatusSeeOther)
+			return
+		}
+		feedURL := pickPageFeed(entries[i])
+		if feedURL == "" {
+			feedURL = entries[i][0].URL
+		}
+		for j := range feedURLs {
+			if feedURLs[j] == site {
+				feedURLs[j] = feedURL
+			}
+		}
+	}
+
+	var validatedURLs []string
+	for _, feedURL := range feedURLs {
+		if !slices.Contains(validatedURLs, feedURL) {
+			validatedURLs = append(validatedURLs, feedURL)
+		}
+	}
+
+	if err := s.subscribeToFeeds(username, validatedURLs); err != nil {
+		s.renderQuotaErr("settingsAddSubscriptionsHandler", w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#subscriptions", http.StatusSeeOther)
+}
+
+// settingsRemoveSubscriptionHandler unsubscribes someone from one feed
+func (s *Site) settingsRemoveSubscriptionHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsRemoveSubscriptionHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	err := s.db.Unsubscribe(username, r.FormValue("url"))
+	if err != nil {
+		s.renderErr("settingsRemoveSubscriptionHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.db.DeleteOrphanedPostReads(username)
+	s.removeOrphanFeeds()
+
+	http.Redirect(w, r, "/settings#subscriptions", http.StatusSeeOther)
+}
+
+// removeOrphanFeeds forgets the feeds nobody is subscribed to anymore
+func (s *Site) removeOrphanFeeds() {
+	orphanedFeeds := s.db.DeleteOrphanFeeds()
+	for _, feedUrl := range orphanedFeeds {
+		s.reaper.RemoveFeed(feedUrl)
+	}
+}
+
+// slugRegex matches the slugs used in urls for things like collections
+var slugRegex = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// parseFeedURLList parses a list of feed urls, one per line, skipping empty
+// lines.
+func parseFeedURLList(text string) ([]string, error) {
+	var feedURLs []string
+	for _, feedURL := range strings.Split(text, "\n") {
+		feedURL = strings.TrimSpace(feedURL)
+		if feedURL == "" {
+			continue
+		}
+		resolved, err := resolveFeedURL(feedURL)
+		if err != nil {
+			return nil, err
+		}
+		feedURLs = append(feedURLs, resolved)
+	}
+	return feedURLs, nil
+}
+
+// resolveFeedURL checks a url someone gave as a feed, swapping youtube
+// channels and fediverse accounts for their feed
+func resolveFeedURL(input string) (string, error) {
+	if _, isHandle := fediverse.ParseHandle(input); isHandle {
+		return fediverse.ResolveFeedURL(input)
+	}
+
+	if _, err := url.ParseRequestURI(input); err != nil {
+		return "", fmt.Errorf("can't parse url '%s': %s", input, err)
+	}
+	if err := reaper.CheckFeedTarget(input); err != nil {
+		return "", err
+	}
+
+	switch {
+	case youtube.IsYouTubeURL(input):
+		return youtube.ResolveFeedURL(input)
+	case fediverse.IsAccount(input):
+		return fediverse.ResolveFeedURL(input)
+	}
+	return input, nil
+}
+
+// subscribeToFeeds subscribes the user to the given feeds on top of the ones
+// they're already subscribed to. It subscribes them to none of them if that
+// would take them over their quota, see renderQuotaErr.
+func (s *Site) subscribeToFeeds(username string, urls []string) error {
+	userFeeds := s.db.GetUserFeedURLs(username)
+	var newFeeds []string
+	for _, feedURL := range s.knownFeedURLs(urls) {
+		if !slices.Contains(userFeeds, feedURL) && !slices.Contains(newFeeds, feedURL) {
+			newFeeds = append(newFeeds, feedURL)
+		}
+	}
+	if err := s.quota.reserve(username, len(userFeeds), len(newFeeds)); err != nil {
+		return err
+	}
 
-	data := struct {
-		UrlsAndErrors   []sqlite.FeedUrlForSettings
-		UserPreferences *user_preferences.UserPreferences
-	}{
-		UrlsAndErrors:   urlsAndErrors,
-		UserPreferences: userPreferences,
+	if err := s.registerFeeds(newFeeds); err != nil {
+		// the feeds the reaper won't have don't count against their quota
+		s.quota.release(username, len(newFeeds))
+		return err
 	}
 
-	s.renderPage(w, r, "settings", data)
+	for _, feedURL := range newFeeds {
+		s.db.Subscribe(username, feedURL)
+		s.recordActivity(username, sqlite.ActivitySubscribe, feedURL, s.feedTitle(feedURL))
+	}
+	return nil
 }
 
-func (s *Site) settingsSubscribeHandler(w http.ResponseWriter, r *http.Request) {
-	if !s.loggedIn(r) {
-		s.renderErr("settingsSubscribeHandler", w, "", http.StatusUnauthorized)
-		return
+// knownFeedURLs swaps the urls of feeds mire knows by another url (see
+// sqlite.KnownFeedURL) for that one, so that they're not added twice
+func (s *Site) knownFeedURLs(urls []string) []string {
+	known := make([]string, len(urls))
+	for i, feedURL := range urls {
+		known[i] = s.db.KnownFeedURL(feedURL)
 	}
+	return known
+}
 
-	// validate user input
-	var validatedURLs []string
-	for _, inputURL := range strings.Split(r.FormValue("submit"), "\r\n") {
-		inputURL = strings.TrimSpace(inputURL)
-		if inputURL == "" {
-			continue
-		}
-
-		// if the entry is already in reaper, don't validate
-		if s.reaper.HasFeed(inputURL) {
-			validatedURLs = append(validatedURLs, inputURL)
-			continue
-		}
-		if _, err := url.ParseRequestURI(inputURL); err != nil {
-			e := fmt.Sprintf("can't parse url '%s': %s", inputURL, err)
-			s.renderErr("settingsSubscribeHandler", w, e, http.StatusBadRequest)
-			return
+// how many new feeds are fetched at once when someone subscribes to a bunch
+// of them
+const maxConcurrentFeedFetches = 20
+
+// registerFeeds makes sure every given feed is known to both the reaper and
+// the database, fetching the ones that are new to mire. It registers none of
+// them if the reaper won't have some of them, see reaper.CheckNewFeeds.
+func (s *Site) registerFeeds(urls []string) error {
+	if err := s.reaper.CheckNewFeeds(urls); err != nil {
+		code := http.StatusTooManyRequests
+		if errors.Is(err, reaper.ErrHostileTarget) {
+			code = http.StatusBadRequest
 		}
-		validatedURLs = append(validatedURLs, inputURL)
+		return quotaError{msg: err.Error(), code: code, err: err}
 	}
 
 	// write to reaper + db
-	semaphore := make(chan struct{}, 20)
+	semaphore := make(chan struct{}, maxConcurrentFeedFetches)
 	var wg sync.WaitGroup
 
-	for _, u := range validatedURLs {
+	for _, u := range urls {
 		semaphore <- struct{}{} // acquire a token
 		wg.Add(1)               // increment the WaitGroup counter
 		go func(u string) {
@@ -331,7 +1132,17 @@ func (s *Site) settingsSubscribeHandler(w http.ResponseWriter, r *http.Request)
 
 			// save feed posts to db
 			for _, post := range newFeed.Items {
-				s.db.SavePost(u, post.Title, post.Link, *post.PublishedParsed)
+				s.db.SavePostStruct(u, &sqlite.Post{
+					Title:             post.Title,
+					URL:               post.Link,
+					PublishedDatetime: *post.PublishedParsed,
+					WordCount:         reaper.WordCount(post),
+					Language:          reaper.Language(post),
+					ThumbnailURL:      reaper.Thumbnail(post),
+					Duration:          reaper.Duration(post),
+					CommentsURL:       reaper.CommentsURL(post),
+					ArticleURL:        reaper.ArticleURL(post),
+				})
 			}
 
 			log.Printf("reaper: registered new feed '%s' with '%d' posts\n", u, len(newFeed.Items))
@@ -339,35 +1150,7 @@ func (s *Site) settingsSubscribeHandler(w http.ResponseWriter, r *http.Request)
 	}
 
 	wg.Wait() // wait for all goroutines to finish
-
-	// TODO: the below is convoluted and can definitely be improved
-
-	username := s.username(r)
-	userOldFeeds := s.db.GetUserFeedURLsForSettings(username)
-
-	userOldFeedsMap := make(map[string]sqlite.FeedUrlForSettings)
-	for _, oldFeed := range userOldFeeds {
-		userOldFeedsMap[oldFeed.URL] = oldFeed
-	}
-
-	// subscribe to all listed feeds exclusively
-	s.db.UnsubscribeAll(username)
-	for _, url := range validatedURLs {
-		s.db.Subscribe(username, url)
-
-		// If the user was previously "favoriting" this feed, preserve favorite status
-		if oldFeed, ok := userOldFeedsMap[url]; ok && oldFeed.IsFavorite {
-			s.db.SetFeedFavoriteStatus(username, url, oldFeed.IsFavorite)
-		}
-	}
-
-	s.db.DeleteOrphanedPostReads(username)
-	orphanedFeeds := s.db.DeleteOrphanFeeds()
-	for _, feedUrl := range orphanedFeeds {
-		s.reaper.RemoveFeed(feedUrl)
-	}
-
-	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	return nil
 }
 
 func (s *Site) changePasswordHandler(w http.ResponseWriter, r *http.Request) {
@@ -414,6 +1197,26 @@ func (s *Site) settingsPreferencesHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	err := r.ParseForm()
+	if err != nil {
+		s.renderErr("settingsPreferencesHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// languages come as one checkbox per language
+	languagesValue := user_preferences.AnyLanguage
+	if languages := r.Form["discoverLanguages"]; len(languages) > 0 {
+		for _, code := range languages {
+			if !language.IsValid(code) {
+				e := fmt.Sprintf("invalid language '%s'", code)
+				s.renderErr("settingsPreferencesHandler", w, e, http.StatusBadRequest)
+				return
+			}
+		}
+		languagesValue = strings.Join(languages, ",")
+	}
+	r.Form.Set("discoverLanguages", languagesValue)
+
 	newPreferences := &user_preferences.UserPreferences{}
 
 	valPointer := reflect.ValueOf(newPreferences)
@@ -442,16 +1245,8 @@ func (s *Site) settingsPreferencesHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
-	// validate newPreferences
-	if newPreferences.NumPostsToShowInHomeScreen < 1 || newPreferences.NumPostsToShowInHomeScreen > 300 {
-		e := fmt.Sprintf("invalid number of posts to show '%d'", newPreferences.NumPostsToShowInHomeScreen)
-		s.renderErr("settingsPreferencesHandler", w, e, http.StatusBadRequest)
-		return
-	}
-
-	if newPreferences.NumUnreadPostsToShowInHomeScreen < 0 || newPreferences.NumUnreadPostsToShowInHomeScreen > 20 {
-		e := fmt.Sprintf("invalid number of unread posts to show '%d'", newPreferences.NumUnreadPostsToShowInHomeScreen)
-		s.renderErr("settingsPreferencesHandler", w, e, http.StatusBadRequest)
+	if err := validatePreferences(newPreferences); err != nil {
+		s.renderErr("settingsPreferencesHandler", w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -462,6 +1257,60 @@ func (s *Site) settingsPreferencesHandler(w http.ResponseWriter, r *http.Request
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
+// validatePreferences tells whether preferences make sense, whether they come
+// from the settings page or an account archive
+func validatePreferences(preferences *user_preferences.UserPreferences) error {
+	if preferences.NumPostsToShowInHomeScreen < 1 || preferences.NumPostsToShowInHomeScreen > 300 {
+		return fmt.Errorf("invalid number of posts to show '%d'", preferences.NumPostsToShowInHomeScreen)
+	}
+
+	if preferences.NumUnreadPostsToShowInHomeScreen < 0 || preferences.NumUnreadPostsToShowInHomeScreen > 20 {
+		return fmt.Errorf("invalid number of unread posts to show '%d'", preferences.NumUnreadPostsToShowInHomeScreen)
+	}
+
+	if preferences.DisplayDensity != user_preferences.DisplayDensityComfortable &&
+		preferences.DisplayDensity != user_preferences.DisplayDensityCompact {
+		return fmt.Errorf("invalid display density '%s'", preferences.DisplayDensity)
+	}
+
+	if preferences.SensitivePosts != user_preferences.SensitivePostsShow &&
+		preferences.SensitivePosts != user_preferences.SensitivePostsBlur &&
+		preferences.SensitivePosts != user_preferences.SensitivePostsHide {
+		return fmt.Errorf("invalid choice for sensitive posts '%s'", preferences.SensitivePosts)
+	}
+
+	if digestInterval(preferences.DigestSchedule) == 0 && preferences.DigestSchedule != user_preferences.DigestOff {
+		return fmt.Errorf("invalid digest schedule '%s'", preferences.DigestSchedule)
+	}
+
+	if preferences.DateDisplay != user_preferences.DateDisplayRelative &&
+		preferences.DateDisplay != user_preferences.DateDisplayAbsolute {
+		return fmt.Errorf("invalid date display '%s'", preferences.DateDisplay)
+	}
+
+	if !user_preferences.DateFormatRegex.MatchString(preferences.DateFormat) {
+		return fmt.Errorf("invalid date format '%s', use YYYY, MM, DD, HH, mm and the like", preferences.DateFormat)
+	}
+
+	if preferences.AutoMarkReadAfterDays < 0 || preferences.AutoMarkReadAfterDays > user_preferences.MaxAutoMarkReadAfterDays {
+		return fmt.Errorf("invalid number of days to mark posts read after '%d'", preferences.AutoMarkReadAfterDays)
+	}
+
+	if preferences.ReadHistoryDays < 0 || preferences.ReadHistoryDays > user_preferences.MaxReadHistoryDays {
+		return fmt.Errorf("invalid number of days to keep the read history for '%d'", preferences.ReadHistoryDays)
+	}
+
+	if preferences.DiscoverLanguages != user_preferences.AnyLanguage {
+		for _, code := range strings.Split(preferences.DiscoverLanguages, ",") {
+			if !language.IsValid(code) {
+				return fmt.Errorf("invalid language '%s'", code)
+			}
+		}
+	}
+
+	return nil
+}
+
 func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
 	encodedURL := r.PathValue("url")
 	decodedURL, err := url.QueryUnescape(encodedURL)
@@ -471,6 +1320,14 @@ func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// show what we know now, the page will be fresh the next time it's seen
+	feed := s.reaper.GetFeed(decodedURL)
+	if feed == nil {
+		s.renderErr("feedDetailsHandler", w, "no such feed", http.StatusNotFound)
+		return
+	}
+	s.reaper.Revalidate(decodedURL)
+
 	fetchErr, err := s.db.GetFeedFetchError(decodedURL)
 	if err != nil {
 		e := fmt.Sprintf("failed to fetch feed error '%s' %s", encodedURL, err)
@@ -478,19 +1335,182 @@ func (s *Site) feedDetailsHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	feedTopics, topicsAssignedByAdmin, err := s.db.GetFeedTopics(decodedURL)
+	if err != nil {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hiddenFromLeaderboard, err := s.db.IsFeedHiddenFromLeaderboard(decodedURL)
+	if err != nil && err != sql.ErrNoRows {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sensitive, sensitiveSetByAdmin, err := s.db.GetFeedSensitivity(decodedURL)
+	if err != nil && err != sql.ErrNoRows {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hiddenFromDiscover, reported, err := s.feedReportStatus(r, decodedURL)
+	if err != nil {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	similarFeeds, err := s.getSimilarFeeds(r, decodedURL)
+	if err != nil {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fetchHistory, err := s.db.GetFeedFetchHistory(decodedURL, numFetchHistoryEvents)
+	if err != nil {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats, err := s.db.GetFeedStats(decodedURL, s.username(r))
+	if err != nil {
+		s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var note, customTitle string
+	var subscribed, muted bool
+	if s.loggedIn(r) {
+		note, subscribed, err = s.db.GetSubscriptionNote(s.username(r), decodedURL)
+		if err != nil {
+			s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		titles, err := s.db.GetSubscriptionTitles(s.username(r))
+		if err != nil {
+			s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		customTitle = titles[decodedURL]
+		muted, err = s.db.IsFeedMuted(s.username(r), decodedURL)
+		if err != nil {
+			s.renderErr("feedDetailsHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	feedData := struct {
-		Feed         *gofeed.Feed
-		Posts        []*sqlite.Post
-		FetchFailure string
+		Feed                  *gofeed.Feed
+		FeedURL               string
+		Posts                 []*sqlite.Post
+		FetchFailure          string
+		FetchHistory          []*sqlite.FeedFetchEvent
+		Stats                 *sqlite.FeedStats
+		Topics                []string
+		TopicsAssignedByAdmin bool
+		AllTopics             []string
+		IsAdmin               bool
+		HiddenFromLeaderboard bool
+		Sensitive             bool
+		SensitiveSetByAdmin   bool
+		HiddenFromDiscover    bool
+		Reported              bool
+		MaxReasonLength       int
+		SimilarFeeds          []*similarFeedEntry
+		Fediverse             *fediverseFeed
+		Subscribed            bool
+		Note                  string
+		MaxNoteLength         int
+		CustomTitle           string
+		MaxTitleLength        int
+		Muted                 bool
+		RefreshInterval       time.Duration
+		DefaultRefresh        time.Duration
+		RefreshChoices        []time.Duration
 	}{
-		Feed:         s.reaper.GetFeed(decodedURL),
-		Posts:        s.db.GetPostsForFeed(decodedURL),
-		FetchFailure: fetchErr,
+		Feed:                  feed,
+		FeedURL:               decodedURL,
+		Posts:                 s.db.GetPostsForFeed(decodedURL),
+		FetchFailure:          fetchErr,
+		FetchHistory:          fetchHistory,
+		Stats:                 stats,
+		Topics:                feedTopics,
+		TopicsAssignedByAdmin: topicsAssignedByAdmin,
+		AllTopics:             topics.All,
+		IsAdmin:               s.isAdmin(r),
+		HiddenFromLeaderboard: hiddenFromLeaderboard,
+		Sensitive:             sensitive,
+		SensitiveSetByAdmin:   sensitiveSetByAdmin,
+		HiddenFromDiscover:    hiddenFromDiscover,
+		Reported:              reported,
+		MaxReasonLength:       maxReportReasonLength,
+		SimilarFeeds:          similarFeeds,
+		Fediverse:             s.getFediverseFeed(r, decodedURL),
+		Subscribed:            subscribed,
+		Note:                  note,
+		MaxNoteLength:         maxSubscriptionNoteLength,
+		CustomTitle:           customTitle,
+		MaxTitleLength:        maxSubscriptionTitleLength,
+		Muted:                 muted,
+		RefreshInterval:       s.reaper.RefreshInterval(decodedURL),
+		DefaultRefresh:        reaper.DefaultRefreshInterval,
+		RefreshChoices:        s.refreshIntervalChoices(s.isAdmin(r), decodedURL),
 	}
 
 	s.renderPage(w, r, "feedDetails", feedData)
 }
 
+// feedTitle returns the title of a feed known to the reaper, or an empty
+// string if we don't know it (yet).
+func (s *Site) feedTitle(feedURL string) string {
+	if !s.reaper.HasFeed(feedURL) {
+		return ""
+	}
+	return s.reaper.GetFeed(feedURL).Title
+}
+
+// feedTopicsHandler lets admins assign topics to a feed. Assigning no topics
+// at all hands the feed back to the heuristics.
+func (s *Site) feedTopicsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("feedTopicsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedTopicsHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		s.renderErr("feedTopicsHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	selectedTopics := r.Form["topic"]
+	for _, topic := range selectedTopics {
+		if !topics.IsValid(topic) {
+			e := fmt.Sprintf("unknown topic '%s'", topic)
+			s.renderErr("feedTopicsHandler", w, e, http.StatusBadRequest)
+			return
+		}
+	}
+
+	source := sqlite.TopicSourceAdmin
+	if len(selectedTopics) == 0 {
+		source = sqlite.TopicSourceHeuristic
+	}
+
+	err = s.db.SetFeedTopics(feedURL, selectedTopics, source)
+	if err != nil {
+		s.renderErr("feedTopicsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURL), http.StatusSeeOther)
+}
+
 // username fetches a client's username based
 // on the sessionToken that user has set. username
 // will return "" if there is no sessionToken.
@@ -510,9 +1530,16 @@ func (s *Site) loggedIn(r *http.Request) bool {
 	return s.username(r) != ""
 }
 
+func (s *Site) isAdmin(r *http.Request) bool {
+	username := s.username(r)
+	return username != "" && s.db.IsAdmin(username)
+}
+
 // login compares the sqlite password field against the user supplied password and
-// sets a session token against the supplied writer.
-func (s *Site) login(w http.ResponseWriter, username string, password string) error {
+// sets a session token against the supplied writer. People who ask to be
+// remembered get their lasting token for sessionLifetime, the others a short
+// session that ends with their browser or after shortSessionLifetime.
+func (s *Site) login(w http.ResponseWriter, username string, password string, remember bool) error {
 	if username == "" {
 		return fmt.Errorf("username cannot be empty")
 	}
@@ -527,20 +1554,35 @@ func (s *Site) login(w http.ResponseWriter, username string, password string) er
 	if err != nil {
 		return fmt.Errorf("invalid password")
 	}
+
+	if !remember {
+		sessionToken := lib.GenerateSecureToken(32)
+		err := s.db.AddShortSession(username, sessionToken, time.Now().Add(min(shortSessionLifetime, s.sessionLifetime)))
+		if err != nil {
+			return err
+		}
+		http.SetCookie(w, &http.Cookie{
+			Name:  "session_token",
+			Value: sessionToken,
+		})
+		return nil
+	}
+
+	// the token they have on their other devices lasts as long as this one
 	sessionToken, err := s.db.GetSessionToken(username)
 	if err != nil {
 		return err
 	}
 	if sessionToken == "" {
 		sessionToken = lib.GenerateSecureToken(32)
-		err := s.db.SetSessionToken(username, sessionToken)
-		if err != nil {
-			return err
-		}
+	}
+	expiresAt := time.Now().Add(s.sessionLifetime)
+	if err := s.db.SetSessionToken(username, sessionToken, expiresAt); err != nil {
+		return err
 	}
 	http.SetCookie(w, &http.Cookie{
 		Name:    "session_token",
-		Expires: time.Now().Add(time.Hour * 24 * 365),
+		Expires: expiresAt,
 		Value:   sessionToken,
 	})
 	return nil
@@ -562,8 +1604,67 @@ func (s *Site) register(username string, password string) error {
 	return nil
 }
 
+// randomPostFilter reads the optional "feed" and "tag" query parameters used
+// to scope the random post buttons.
+func randomPostFilter(r *http.Request) (sqlite.RandomPostFilter, error) {
+	filter := sqlite.RandomPostFilter{
+		FeedURL: r.URL.Query().Get("feed"),
+		Topic:   r.URL.Query().Get("tag"),
+	}
+	if filter.Topic != "" && !topics.IsValid(filter.Topic) {
+		return filter, fmt.Errorf("unknown tag '%s'", filter.Topic)
+	}
+	return filter, nil
+}
+
 func (s *Site) visitRandomPostHandler(w http.ResponseWriter, r *http.Request) {
-	post := s.db.GetRandomPost()
+	filter, err := randomPostFilter(r)
+	if err != nil {
+		s.renderErr("visitRandomPostHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	post, err := s.db.GetRandomPost(filter)
+	if err != nil {
+		s.renderErr("visitRandomPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		s.renderErr("visitRandomPostHandler", w, "no posts to pick from", http.StatusNotFound)
+		return
+	}
+
+	http.Redirect(w, r, post.URL, http.StatusSeeOther)
+}
+
+// visitRandomUnreadPostHandler sends the user to a random unread post from
+// their own subscriptions, marking it as read on the way.
+func (s *Site) visitRandomUnreadPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/random?"+r.URL.RawQuery, http.StatusSeeOther)
+		return
+	}
+
+	filter, err := randomPostFilter(r)
+	if err != nil {
+		s.renderErr("visitRandomUnreadPostHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	filter.UnreadBy = username
+
+	post, err := s.db.GetRandomPost(filter)
+	if err != nil {
+		s.renderErr("visitRandomUnreadPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		s.renderErr("visitRandomUnreadPostHandler", w, "you have no unread posts left", http.StatusNotFound)
+		return
+	}
+
+	s.db.SetReadStatus(username, post.URL, true)
 
 	http.Redirect(w, r, post.URL, http.StatusSeeOther)
 }
@@ -594,6 +1695,12 @@ func (s *Site) apiSetPostReadStatus(w http.ResponseWriter, r *http.Request) {
 // template execution engine. it's normally the last thing a
 // handler should do tbh.
 func (s *Site) renderPage(w http.ResponseWriter, r *http.Request, page string, data any) {
+	s.renderPageWithTitle(w, r, page, page+" | "+s.title, data)
+}
+
+// renderPageWithTitle is like renderPage, but lets the caller pick the
+// contents of the page's <title>.
+func (s *Site) renderPageWithTitle(w http.ResponseWriter, r *http.Request, page string, title string, data any) {
 	// fields on this anon struct are generally
 	// pulled out of Data when they're globally required
 	// callers should jam anything they want into Data
@@ -602,31 +1709,24 @@ func (s *Site) renderPage(w http.ResponseWriter, r *http.Request, page string, d
 		Username   string
 		LoggedIn   bool
 		CutePhrase string
-		Data       any
+		// empty for relative dates, see timeSince
+		DateFormat string
+		// see hideFromSearchEngines
+		NoIndex bool
+		Data    any
 	}{
-		Title:      page + " | " + s.title,
+		Title:      title,
 		Username:   s.username(r),
 		LoggedIn:   s.loggedIn(r),
 		CutePhrase: s.randomCutePhrase(),
+		NoIndex:    w.Header().Get("X-Robots-Tag") != "",
 		Data:       data,
 	}
-
-	if constants.DEBUG_MODE {
-		funcMap := template.FuncMap{
-			"printDomain": s.printDomain,
-			"timeSince":   s.timeSince,
-			"trimSpace":   strings.TrimSpace,
-			"escapeURL":   url.QueryEscape,
-			"makeSlice": func(args ...interface{}) []interface{} {
-				return args
-			},
-		}
-
-		tmplFiles := filepath.Join("files", "*.tmpl.html")
-		templates = template.Must(template.New("whatever").Funcs(funcMap).ParseGlob(tmplFiles))
+	if pageData.LoggedIn {
+		pageData.DateFormat = user_preferences.GetDateFormat(s.db, s.db.GetUserID(pageData.Username))
 	}
 
-	err := templates.ExecuteTemplate(w, page, pageData)
+	err := templates.Load().ExecuteTemplate(w, page, pageData)
 	if err != nil {
 		s.renderErr("renderPage", w, err.Error(), http.StatusInternalServerError)
 		return
@@ -635,62 +1735,90 @@ func (s *Site) renderPage(w http.ResponseWriter, r *http.Request, page string, d
 	w.Header().Set("Content-Type", http.DetectContentType([]byte(page)))
 }
 
+// renderJSON encodes data as the JSON body of the response. Like renderPage,
+// it's normally the last thing a handler should do.
+func (s *Site) renderJSON(w http.ResponseWriter, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(data)
+	if err != nil {
+		log.Println("renderJSON:: " + err.Error())
+	}
+}
+
 // printDomain does a best-effort uri parse and
 // prints the base domain, otherwise returning the
 // unmodified string
 func (s *Site) printDomain(rawURL string) string {
-	parsedURL, err := url.Parse(rawURL)
-	if err == nil {
-		hostname := parsedURL.Hostname()
-		if hostname == "medium.com" || strings.HasSuffix(hostname, ".medium.com") {
-			// Handle Medium URLs
-			pathSegments := strings.Split(parsedURL.Path, "/")
-			for _, segment := range pathSegments {
-				if len(segment) > 0 && segment[0] == '@' {
-					return "medium.com/" + segment
-				}
-			}
-		}
-		return hostname
-	}
-	// do our best to trim it manually if url parsing fails
-	trimmedStr := strings.TrimSpace(rawURL)
-	trimmedStr = strings.TrimPrefix(trimmedStr, "http://")
-	trimmedStr = strings.TrimPrefix(trimmedStr, "https://")
-
-	return strings.Split(trimmedStr, "/")[0]
+	return sqlite.URLDomain(rawURL)
 }
 
-func (s *Site) timeSince(t time.Time) string {
-	now := time.Now()
-	duration := now.Sub(t)
+// timeSince tells how long ago t was ("3 days ago"), as a <time> element
+// that pages show in the format people picked instead, if they did (see
+// tail.tmpl.html)
+func (s *Site) timeSince(t time.Time) template.HTML {
+	return template.HTML(fmt.Sprintf(`<time datetime="%s">%s</time>`,
+		t.UTC().Format(time.RFC3339), relativeTime(time.Since(t))))
+}
 
-	minutes := int(duration.Minutes())
-	hours := int(duration.Hours())
-	days := int(duration.Hours() / 24)
-	weeks := int(duration.Hours() / (24 * 7))
-	months := int(duration.Hours() / (24 * 7 * 4))
-	years := int(duration.Hours() / (24 * 7 * 4 * 12))
+// relativeTime tells how long ago something that happened d ago was
+func relativeTime(d time.Duration) string {
+	minutes := int(d.Minutes())
+	hours := int(d.Hours())
+	days := hours / 24
 
-	if years > 100 {
+	switch {
+	case days >= 365*100:
 		return "over 100 years ago ಠ_ಠ"
-	} else if years > 1 {
-		return fmt.Sprintf("%d years ago", years)
-	} else if months > 1 {
-		return fmt.Sprintf("%d months ago", months)
-	} else if weeks > 1 {
-		return fmt.Sprintf("%d weeks ago", weeks)
-	} else if days > 1 {
-		return fmt.Sprintf("%d days ago", days)
-	} else if hours > 1 {
-		return fmt.Sprintf("%d hours ago", hours)
-	} else if minutes > 1 {
-		return fmt.Sprintf("%d mins ago", minutes)
-	} else {
+	case days >= 365:
+		return plural(days/365, "year") + " ago"
+	case days >= 30:
+		return plural(days/30, "month") + " ago"
+	case days >= 7:
+		return plural(days/7, "week") + " ago"
+	case days >= 1:
+		return plural(days, "day") + " ago"
+	case hours >= 1:
+		return plural(hours, "hour") + " ago"
+	case minutes >= 1:
+		return plural(minutes, "min") + " ago"
+	default:
 		return "just now"
 	}
 }
 
+// plural is n of something, "1 day" or "2 days"
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// readingTime turns a word count into a rough reading time estimate, assuming
+// an average reading speed of 200 words per minute. Returns an empty string if
+// the word count is unknown.
+func (s *Site) readingTime(wordCount int) string {
+	if wordCount <= 0 {
+		return ""
+	}
+
+	minutes := (wordCount + 199) / 200
+	return fmt.Sprintf("≈ %d min read", minutes)
+}
+
+// mediaDuration formats the length of a video or audio post, in seconds, like
+// players do ("4:05", "1:02:03"). Returns an empty string if it is unknown.
+func (s *Site) mediaDuration(seconds int) string {
+	if seconds <= 0 {
+		return ""
+	}
+
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
 // renderErr sets the correct http status in the header,
 // optionally decorates certain errors, then renders the err page
 func (s *Site) renderErr(caller string, w http.ResponseWriter, error string, code int) {
@@ -754,6 +1882,50 @@ func (s *Site) randomCutePhrase() string {
 	return phrases[i]
 }
 
+// apiUnreadCountHandler returns the total number of unread posts for the
+// logged in user.
+func (s *Site) apiUnreadCountHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiUnreadCountHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	unreadCount, err := s.db.GetUnreadCountForUser(s.username(r))
+	if err != nil {
+		s.renderErr("apiUnreadCountHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderJSON(w, struct {
+		Unread int `json:"unread"`
+	}{
+		Unread: unreadCount,
+	})
+}
+
+// apiSetFeedNotifyHandler sets whether the user is notified as soon as a feed
+// posts
+func (s *Site) apiSetFeedNotifyHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiSetFeedNotifyHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedUrl, err := url.QueryUnescape(r.PathValue("feedUrl"))
+	if err != nil || feedUrl == "" {
+		s.renderErr("apiSetFeedNotifyHandler", w, "Feed URL is required", http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetFeedNotify(s.username(r), feedUrl, r.FormValue("new_notify") == "true")
+	if err != nil {
+		s.renderErr("apiSetFeedNotifyHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 // apiSetFavoriteFeedHandler toggles the favorite status of a feed for the user.
 func (s *Site) apiSetFavoriteFeedHandler(w http.ResponseWriter, r *http.Request) {
 	if !s.loggedIn(r) {
@@ -782,5 +1954,10 @@ func (s *Site) apiSetFavoriteFeedHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if isFavorite {
+		s.recordActivity(username, sqlite.ActivityFavorite, feedUrl, s.feedTitle(feedUrl))
+	}
+	s.queueFavoriteWebhooks(username, feedUrl, isFavorite)
+
 	w.WriteHeader(http.StatusOK)
 }
@@ -0,0 +1,88 @@
+// Package slack posts messages to Slack channels through incoming webhooks
+// (https://api.slack.com/messaging/webhooks).
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// max size of the response body read after posting
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{Timeout: 15 * time.Second}
+
+var webhookPathRegex = regexp.MustCompile(`^/services/[A-Z0-9]+/[A-Z0-9]+/[A-Za-z0-9]+$`)
+
+type Message struct {
+	// mrkdwn, see Link and Escape
+	Text string `json:"text"`
+
+	// previews of every linked page would drown the channel
+	UnfurlLinks bool `json:"unfurl_links"`
+	UnfurlMedia bool `json:"unfurl_media"`
+}
+
+// ValidWebhookURL reports whether a URL looks like a Slack incoming webhook,
+// so that we don't POST people's posts to arbitrary places
+func ValidWebhookURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	if err != nil || u.Scheme != "https" || u.User != nil || u.RawQuery != "" {
+		return false
+	}
+	return u.Host == "hooks.slack.com" && webhookPathRegex.MatchString(u.Path)
+}
+
+// WebhookID returns the public part of a webhook URL (the workspace and the
+// webhook), which is fine to show around, unlike the token that follows it
+func WebhookID(webhookURL string) string {
+	parts := strings.Split(webhookURL, "/")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[len(parts)-3] + "/" + parts[len(parts)-2]
+}
+
+// Escape escapes the characters slack gives a meaning to in messages
+func Escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// Link formats a link with its text for a message
+func Link(linkURL string, text string) string {
+	// | ends the URL in a link, the URL is escaped like text otherwise
+	linkURL = strings.ReplaceAll(Escape(linkURL), "|", "%7C")
+	return "<" + linkURL + "|" + Escape(text) + ">"
+}
+
+// Send posts a message through a webhook
+func Send(webhookURL string, msg *Message) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		// the URL holds the webhook's token, keep it out of the logs
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = "slack webhook " + WebhookID(webhookURL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		// slack says what's wrong in the body, like "channel_is_archived"
+		return fmt.Errorf("slack webhook %s returned status %d: %s", WebhookID(webhookURL), resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/slack"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	// posts listed per webhook on every check, anything past that is
+	// mentioned in an "and N more" line so that channels don't get flooded
+	maxSlackPostsPerCheck = 20
+
+	maxSlackWebhooksPerUser = 10
+)
+
+// sendSlackNotifications posts the posts saved since each webhook's last
+// check, up to latestPostId
+func sendSlackNotifications(s *Site, latestPostId int) {
+	webhooks, err := s.db.GetSlackWebhooks()
+	if err != nil {
+		log.Printf("[err] sendSlackNotifications: could not get webhooks: %s\n", err)
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if webhook.LastPostID >= latestPostId {
+			continue
+		}
+
+		posts, err := s.db.GetPostsForSlackWebhook(webhook.ID, webhook.LastPostID, latestPostId, numNotificationPostsPerCheck)
+		if err != nil {
+			log.Printf("[err] sendSlackNotifications: could not get the posts of webhook %d: %s\n", webhook.ID, err)
+			continue
+		}
+
+		checkedUpTo := latestPostId
+		if len(posts) == numNotificationPostsPerCheck {
+			checkedUpTo = posts[len(posts)-1].ID
+		}
+
+		if len(posts) > 0 {
+			err = slack.Send(webhook.WebhookURL, s.slackMessage(posts))
+			if err != nil {
+				// try again on the next check, we might have been rate limited
+				log.Printf("[err] sendSlackNotifications: could not post to webhook %d of '%s': %s\n", webhook.ID, webhook.Username, err)
+				continue
+			}
+		}
+
+		err = s.db.SetSlackWebhookLastPostID(webhook.ID, checkedUpTo)
+		if err != nil {
+			log.Printf("[err] sendSlackNotifications: could not save progress for webhook %d: %s\n", webhook.ID, err)
+		}
+	}
+}
+
+// slackMessage lists new posts, one per line, with the feed they're from
+func (s *Site) slackMessage(posts []*sqlite.NotificationPost) *slack.Message {
+	var lines []string
+	for i, post := range posts {
+		if i == maxSlackPostsPerCheck {
+			lines = append(lines, fmt.Sprintf("...and %d more new posts", len(posts)-i))
+			break
+		}
+		feedURL := constants.BASE_URL + "/feeds/" + url.QueryEscape(post.FeedURL)
+		lines = append(lines, "• "+slack.Link(post.URL, post.Title)+" — "+slack.Link(feedURL, s.feedTitleOrDomain(post.FeedURL)))
+	}
+
+	return &slack.Message{Text: strings.Join(lines, "\n")}
+}
+
+// settingsSlackHandler adds a webhook for all the user's subscriptions or for
+// one of their collections, replacing the one it had
+func (s *Site) settingsSlackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsSlackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	webhookURL := strings.TrimSpace(r.FormValue("webhook"))
+	if !slack.ValidWebhookURL(webhookURL) {
+		s.renderErr("settingsSlackHandler", w, "that doesn't look like a slack webhook URL", http.StatusBadRequest)
+		return
+	}
+
+	collectionSlug := r.FormValue("collection")
+	if collectionSlug != "" {
+		collection, err := s.db.GetCollection(username, collectionSlug)
+		if err != nil {
+			s.renderErr("settingsSlackHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if collection == nil {
+			s.renderErr("settingsSlackHandler", w, fmt.Sprintf("no collection named '%s'", collectionSlug), http.StatusBadRequest)
+			return
+		}
+	}
+
+	webhooks, err := s.db.GetUserSlackWebhooks(username)
+	if err != nil {
+		s.renderErr("settingsSlackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// replacing the webhook of a collection doesn't count as adding one
+	replacing := false
+	for _, webhook := range webhooks {
+		replacing = replacing || webhook.CollectionSlug == collectionSlug
+	}
+	if !replacing && len(webhooks) >= maxSlackWebhooksPerUser {
+		e := fmt.Sprintf("you can have at most %d slack webhooks", maxSlackWebhooksPerUser)
+		s.renderErr("settingsSlackHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetSlackWebhook(username, webhookURL, collectionSlug)
+	if err != nil {
+		s.renderErr("settingsSlackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#slack", http.StatusSeeOther)
+}
+
+func (s *Site) settingsDeleteSlackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsDeleteSlackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid webhook id '%s'", r.PathValue("id"))
+		s.renderErr("settingsDeleteSlackHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.RemoveSlackWebhook(s.username(r), id)
+	if err != nil {
+		s.renderErr("settingsDeleteSlackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#slack", http.StatusSeeOther)
+}
+
+// adminSlackHandler shows the instance's slack webhook, which gets the posts
+// of every feed on the instance
+func (s *Site) adminSlackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminSlackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	webhook, err := s.db.GetInstanceSlackWebhook()
+	if err != nil {
+		s.renderErr("adminSlackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderPage(w, r, "admin_slack", webhook)
+}
+
+// adminSaveSlackHandler sets the instance's slack webhook, or removes it when
+// the URL is empty
+func (s *Site) adminSaveSlackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminSaveSlackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var err error
+	webhookURL := strings.TrimSpace(r.FormValue("webhook"))
+	switch {
+	case webhookURL == "":
+		err = s.db.RemoveInstanceSlackWebhook()
+	case !slack.ValidWebhookURL(webhookURL):
+		s.renderErr("adminSaveSlackHandler", w, "that doesn't look like a slack webhook URL", http.StatusBadRequest)
+		return
+	default:
+		err = s.db.SetInstanceSlackWebhook(webhookURL)
+	}
+	if err != nil {
+		s.renderErr("adminSaveSlackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/slack", http.StatusSeeOther)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+// recordActivity saves something a user did so it can be shown to their
+// followers. Failing to do so is not worth failing the request over.
+func (s *Site) recordActivity(username string, kind string, targetURL string, targetTitle string) {
+	err := s.db.RecordActivity(username, kind, targetURL, targetTitle)
+	if err != nil {
+		log.Printf("[err] recordActivity: could not record '%s' for '%s': %s\n", kind, username, err)
+	}
+}
+
+// filterSharedActivity drops the events that their authors have chosen not to
+// share with their followers.
+func (s *Site) filterSharedActivity(activities []*sqlite.Activity) []*sqlite.Activity {
+	preferences := make(map[string]*user_preferences.UserPreferences)
+
+	shared := make([]*sqlite.Activity, 0, len(activities))
+	for _, a := range activities {
+		p, ok := preferences[a.Username]
+		if !ok {
+			p = user_preferences.GetUserPreferences(s.db, s.db.GetUserID(a.Username))
+			preferences[a.Username] = p
+		}
+
+		switch a.Kind {
+		case sqlite.ActivitySubscribe:
+			if !p.ShareSubscriptionActivity {
+				continue
+			}
+		case sqlite.ActivityFavorite:
+			if !p.ShareFavoriteActivity {
+				continue
+			}
+		}
+
+		shared = append(shared, a)
+	}
+
+	return shared
+}
+
+func (s *Site) followHandler(w http.ResponseWriter, r *http.Request) {
+	s.setFollowing("followHandler", w, r, true)
+}
+
+func (s *Site) unfollowHandler(w http.ResponseWriter, r *http.Request) {
+	s.setFollowing("unfollowHandler", w, r, false)
+}
+
+func (s *Site) setFollowing(caller string, w http.ResponseWriter, r *http.Request, follow bool) {
+	if !s.loggedIn(r) {
+		s.renderErr(caller, w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	followee := r.PathValue("username")
+	if !s.db.UserExists(followee) {
+		http.NotFound(w, r)
+		return
+	}
+	if followee == username {
+		s.renderErr(caller, w, "you can't follow yourself", http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if follow {
+		err = s.db.Follow(username, followee)
+	} else {
+		err = s.db.Unfollow(username, followee)
+	}
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/u/"+followee, http.StatusSeeOther)
+}
+
+func (s *Site) activityHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("activityHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+
+	following, err := s.db.GetFollowing(username)
+	if err != nil {
+		s.renderErr("activityHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	activities, err := s.db.GetActivityOfFollowedUsers(username, 200)
+	if err != nil {
+		s.renderErr("activityHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ownActivities, err := s.db.GetUserActivity(username, 50)
+	if err != nil {
+		s.renderErr("activityHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Following     []string
+		Activities    []*sqlite.Activity
+		OwnActivities []*sqlite.Activity
+	}{
+		Following:     following,
+		Activities:    s.filterSharedActivity(activities),
+		OwnActivities: s.filterSharedActivity(ownActivities),
+	}
+
+	s.renderPage(w, r, "activity", data)
+}
+
+// deleteActivityHandler lets users remove single events from what they share
+func (s *Site) deleteActivityHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("deleteActivityHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	activityId, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		e := fmt.Sprintf("invalid activity id '%s'", r.PathValue("id"))
+		s.renderErr("deleteActivityHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.DeleteActivity(s.username(r), activityId)
+	if err != nil {
+		s.renderErr("deleteActivityHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/activity", http.StatusSeeOther)
+}
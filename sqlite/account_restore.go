@@ -0,0 +1,81 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// RestoredRead is a post someone read, from an account archive
+type RestoredRead struct {
+	URL    string
+	ReadAt time.Time
+}
+
+// RestoreReads marks the posts of an account archive read, when mire has
+// them, preferring the ones in the feeds the user is subscribed to. It returns
+// how many of them it has.
+func (db *DB) RestoreReads(username string, reads []RestoredRead) (int, error) {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	restored := 0
+	for _, read := range reads {
+		var postId int
+		err := tx.QueryRow(`
+			SELECT id FROM post WHERE url = ?
+			ORDER BY feed_id IN (SELECT feed_id FROM subscribe WHERE user_id = ?) DESC
+			LIMIT 1`, read.URL, userId).Scan(&postId)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		restored++
+
+		res, err := tx.Exec("UPDATE post_read SET has_read = 1 WHERE user_id = ? AND post_id = ?", userId, postId)
+		if err != nil {
+			return 0, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			continue
+		}
+		_, err = tx.Exec("INSERT INTO post_read (user_id, post_id, has_read, created_at) VALUES (?, ?, 1, ?)",
+			userId, postId, read.ReadAt.UTC())
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forget(userId)
+	return restored, err
+}
+
+// RestoreStar stars a post from an account archive, as of when it was starred
+// then. It returns false if the user starred it already, that star is kept.
+func (db *DB) RestoreStar(username string, post *Post, quote string, note string, starredAt time.Time) (bool, error) {
+	userId := db.GetUserID(username)
+
+	lock()
+	res, err := db.sql.Exec(`
+		INSERT OR IGNORE INTO post_star (user_id, post_id, title, url, feed_url, quote, note, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		userId, post.ID, post.Title, post.URL, post.FeedURL, quote, note, starredAt.UTC(), starredAt.UTC())
+	unlock()
+	if err != nil {
+		return false, err
+	}
+
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetActivityPubKeys returns the PEM encoded key pair of a user, or empty
+// strings if they don't have one yet
+func (db *DB) GetActivityPubKeys(username string) (privateKey string, publicKey string, err error) {
+	err = db.sql.QueryRow(`
+		SELECT k.private_key, k.public_key
+		FROM activitypub_key k
+		JOIN user u ON k.user_id = u.id
+		WHERE u.username = ?`, username).Scan(&privateKey, &publicKey)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", nil
+	}
+	return privateKey, publicKey, err
+}
+
+// SaveActivityPubKeys stores a user's key pair unless they already have one,
+// keys never change once they've been handed out
+func (db *DB) SaveActivityPubKeys(username string, privateKey string, publicKey string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO activitypub_key (user_id, private_key, public_key) VALUES (?, ?, ?)
+		ON CONFLICT(user_id) DO NOTHING`, userId, privateKey, publicKey)
+	unlock()
+
+	return err
+}
+
+func (db *DB) AddActivityPubFollower(username string, actorId string, inbox string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO activitypub_follower (user_id, actor_id, inbox) VALUES (?, ?, ?)
+		ON CONFLICT(user_id, actor_id) DO UPDATE SET inbox=excluded.inbox`, userId, actorId, inbox)
+	unlock()
+
+	return err
+}
+
+func (db *DB) RemoveActivityPubFollower(username string, actorId string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM activitypub_follower WHERE user_id=? AND actor_id=?", userId, actorId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) CountActivityPubFollowers(username string) (int, error) {
+	var count int
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*)
+		FROM activitypub_follower f
+		JOIN user u ON f.user_id = u.id
+		WHERE u.username = ?`, username).Scan(&count)
+
+	return count, err
+}
+
+// GetActivityPubFollowerInboxes returns the inboxes to deliver a user's
+// activities to. Followers on the same server usually share an inbox, so
+// each one is only listed once.
+func (db *DB) GetActivityPubFollowerInboxes(username string) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT DISTINCT f.inbox
+		FROM activitypub_follower f
+		JOIN user u ON f.user_id = u.id
+		WHERE u.username = ?
+		ORDER BY f.inbox`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var inboxes []string
+	for rows.Next() {
+		var inbox string
+		if err := rows.Scan(&inbox); err != nil {
+			return nil, err
+		}
+		inboxes = append(inboxes, inbox)
+	}
+	return inboxes, rows.Err()
+}
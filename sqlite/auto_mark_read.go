@@ -0,0 +1,60 @@
+package sqlite
+
+import "time"
+
+// GetUsersWithPreference returns the value of a preference of everyone who set
+// it, by username. Those who didn't have its default.
+func (db *DB) GetUsersWithPreference(preferenceName string) (map[string]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT u.username, up.preference_value FROM user_preferences up
+		JOIN user u ON u.id = up.user_id
+		WHERE up.preference_name = ?`, preferenceName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[string]string)
+	for rows.Next() {
+		var username, value string
+		if err = rows.Scan(&username, &value); err != nil {
+			return nil, err
+		}
+		values[username] = value
+	}
+	return values, rows.Err()
+}
+
+// MarkReadPublishedBefore marks the posts of a user's timeline that were
+// published before a time and they haven't read as read, and returns how many
+// there were
+func (db *DB) MarkReadPublishedBefore(username string, before time.Time) (int, error) {
+	userId := db.GetUserID(username)
+
+	rows, err := db.sql.Query(`
+		SELECT p.id FROM post p
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+timelineFeedIDs+`) AND p.published_at < ? AND (pr.has_read IS NULL OR pr.has_read = 0)`,
+		userId, userId, userId, before)
+	if err != nil {
+		return 0, err
+	}
+	var postIds []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		postIds = append(postIds, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(postIds) == 0 {
+		return 0, nil
+	}
+
+	return len(postIds), db.SetPostsReadStatus(username, postIds, true)
+}
@@ -0,0 +1,88 @@
+package sqlite
+
+// timelineFeedIDs is a subquery returning the ids of every feed in a user's
+// timeline: the ones they subscribe to plus the ones subscribed to by the
+// users whose blogroll they follow, but for the ones they muted. It takes the
+// user id twice.
+const timelineFeedIDs = `
+	SELECT feed_id FROM subscribe WHERE user_id = ? AND is_muted = 0
+	UNION
+	SELECT s.feed_id FROM blogroll_follow bf
+	JOIN subscribe s ON s.user_id = bf.followee_id
+	WHERE bf.follower_id = ? AND NOT EXISTS (
+		SELECT 1 FROM subscribe m WHERE m.user_id = bf.follower_id AND m.feed_id = s.feed_id AND m.is_muted = 1)`
+
+// timelineUserIDs is the other way around: a subquery returning the ids of
+// the users with a feed in their timeline. It takes the feed id twice.
+const timelineUserIDs = `
+	SELECT user_id FROM subscribe WHERE feed_id = ? AND is_muted = 0
+	UNION
+	SELECT bf.follower_id FROM blogroll_follow bf
+	JOIN subscribe s ON s.user_id = bf.followee_id
+	WHERE s.feed_id = ? AND NOT EXISTS (
+		SELECT 1 FROM subscribe m WHERE m.user_id = bf.follower_id AND m.feed_id = s.feed_id AND m.is_muted = 1)`
+
+func (db *DB) FollowBlogroll(followerUsername string, followeeUsername string) error {
+	followerId := db.GetUserID(followerUsername)
+	followeeId := db.GetUserID(followeeUsername)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO blogroll_follow (follower_id, followee_id) VALUES (?, ?)
+		ON CONFLICT(follower_id, followee_id) DO NOTHING`, followerId, followeeId)
+	unlock()
+	db.unreadCounts.forget(followerId)
+
+	return err
+}
+
+func (db *DB) UnfollowBlogroll(followerUsername string, followeeUsername string) error {
+	followerId := db.GetUserID(followerUsername)
+	followeeId := db.GetUserID(followeeUsername)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM blogroll_follow WHERE follower_id=? AND followee_id=?", followerId, followeeId)
+	unlock()
+	db.unreadCounts.forget(followerId)
+
+	return err
+}
+
+func (db *DB) IsFollowingBlogroll(followerUsername string, followeeUsername string) (bool, error) {
+	var exists bool
+	err := db.sql.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM blogroll_follow bf
+			JOIN user a ON bf.follower_id = a.id
+			JOIN user b ON bf.followee_id = b.id
+			WHERE a.username = ? AND b.username = ?
+		)`, followerUsername, followeeUsername).Scan(&exists)
+
+	return exists, err
+}
+
+// GetFollowedBlogrolls returns the usernames of the users whose blogroll the
+// given user follows
+func (db *DB) GetFollowedBlogrolls(username string) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT b.username
+		FROM blogroll_follow bf
+		JOIN user a ON bf.follower_id = a.id
+		JOIN user b ON bf.followee_id = b.id
+		WHERE a.username = ?
+		ORDER BY b.username`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, u)
+	}
+	return usernames, rows.Err()
+}
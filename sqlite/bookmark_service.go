@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+type BookmarkService struct {
+	Service  string
+	Instance string
+	Token    string
+	Tags     []string
+
+	// why the last bookmark couldn't be created, empty if it could
+	LastError string
+}
+
+// SetBookmarkService connects a user to the instance bookmarks are created
+// in, replacing the one they had connected before
+func (db *DB) SetBookmarkService(username string, service *BookmarkService) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO bookmark_service (user_id, service, instance, token, tags) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			service=excluded.service,
+			instance=excluded.instance,
+			token=excluded.token,
+			tags=excluded.tags,
+			last_error=''`,
+		userId, service.Service, service.Instance, service.Token, strings.Join(service.Tags, " "))
+	unlock()
+
+	return err
+}
+
+// GetBookmarkService returns the instance a user connected to create
+// bookmarks in, or nil if they didn't connect one
+func (db *DB) GetBookmarkService(username string) (*BookmarkService, error) {
+	var service BookmarkService
+	var tags string
+	err := db.sql.QueryRow(`
+		SELECT b.service, b.instance, b.token, b.tags, b.last_error
+		FROM bookmark_service b
+		JOIN user u ON b.user_id = u.id
+		WHERE u.username = ?`, username).
+		Scan(&service.Service, &service.Instance, &service.Token, &tags, &service.LastError)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	service.Tags = strings.Fields(tags)
+	return &service, nil
+}
+
+func (db *DB) RemoveBookmarkService(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM bookmark_service WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
+
+// SetBookmarkServiceError records why the last bookmark couldn't be created,
+// an empty error meaning it could
+func (db *DB) SetBookmarkServiceError(username string, lastError string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE bookmark_service SET last_error=? WHERE user_id=?", lastError, userId)
+	unlock()
+
+	return err
+}
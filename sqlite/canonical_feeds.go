@@ -0,0 +1,261 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"codeberg.org/meadowingc/mire/feedurl"
+)
+
+// KnownFeedURL returns the url mire knows a feed by when it was given
+// another url of the same feed (see feedurl.Canonical), or feedURL itself
+func (db *DB) KnownFeedURL(feedURL string) string {
+	var knownURL string
+	err := db.sql.QueryRow(`
+		SELECT url FROM feed WHERE url = ?
+		UNION ALL
+		SELECT url FROM feed WHERE canonical_url = ?
+		LIMIT 1`, feedURL, feedurl.Canonical(feedURL)).Scan(&knownURL)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("[err] KnownFeedURL: %s\n", err)
+		}
+		return feedURL
+	}
+	return knownURL
+}
+
+// canonicalizeFeeds fills in the canonical url of the feeds that don't have
+// one yet, the ones from before mire kept them, and merges the feeds that
+// turn out to be the same one into the one with the most subscribers
+func (db *DB) canonicalizeFeeds() error {
+	rows, err := db.sql.Query("SELECT id, url FROM feed WHERE canonical_url IS NULL")
+	if err != nil {
+		return err
+	}
+	canonicalURLs := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var url string
+		if err := rows.Scan(&id, &url); err != nil {
+			rows.Close()
+			return err
+		}
+		canonicalURLs[id] = feedurl.Canonical(url)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(canonicalURLs) == 0 {
+		return nil
+	}
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, canonicalURL := range canonicalURLs {
+		_, err = tx.Exec("UPDATE feed SET canonical_url = ? WHERE id = ?", canonicalURL, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	rows, err = tx.Query(`
+		SELECT f.id, f.canonical_url FROM feed f
+		WHERE f.canonical_url IN (SELECT canonical_url FROM feed GROUP BY canonical_url HAVING COUNT(*) > 1)
+		ORDER BY f.canonical_url, (SELECT COUNT(*) FROM subscribe s WHERE s.feed_id = f.id) DESC, f.id`)
+	if err != nil {
+		return err
+	}
+	// the feed kept by canonical url, and the ones merged into it
+	keptIds := make(map[string]int)
+	merged := make(map[int]int)
+	for rows.Next() {
+		var id int
+		var canonicalURL string
+		if err := rows.Scan(&id, &canonicalURL); err != nil {
+			rows.Close()
+			return err
+		}
+		if keptId, ok := keptIds[canonicalURL]; ok {
+			merged[id] = keptId
+		} else {
+			keptIds[canonicalURL] = id
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, keptId := range merged {
+		if err = mergeFeedTx(tx, keptId, id); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	if len(merged) > 0 {
+		log.Printf("merged %d feed(s) into another url of the same feed\n", len(merged))
+	}
+	return nil
+}
+
+// mergeFeedTx moves everything of a feed over to another url of the same
+// feed, then deletes it. Its posts that the other feed has too are dropped,
+// what people did with them (reading, starring...) going to the other feed's.
+func mergeFeedTx(tx *instrumentedTx, keptId int, mergedId int) error {
+	var keptURL, mergedURL string
+	err := tx.QueryRow("SELECT (SELECT url FROM feed WHERE id = ?), (SELECT url FROM feed WHERE id = ?)", keptId, mergedId).
+		Scan(&keptURL, &mergedURL)
+	if err != nil {
+		return err
+	}
+
+	// the posts both feeds have, merged ones to kept ones
+	const duplicatePosts = `
+		SELECT m.id FROM post m
+		JOIN post k ON k.feed_id = ? AND k.url = m.url
+		WHERE m.feed_id = ?`
+	const keptPost = `(
+		SELECT k.id FROM post m
+		JOIN post k ON k.feed_id = ? AND k.url = m.url
+		WHERE m.id = post_id)`
+
+	_, err = tx.Exec(`
+		INSERT INTO post_read (user_id, post_id, has_read, hidden, created_at)
+		SELECT pr.user_id, k.id, pr.has_read, pr.hidden, pr.created_at FROM post_read pr
+		JOIN post m ON m.id = pr.post_id
+		JOIN post k ON k.feed_id = ? AND k.url = m.url
+		WHERE m.feed_id = ?
+			AND NOT EXISTS (SELECT 1 FROM post_read x WHERE x.user_id = pr.user_id AND x.post_id = k.id)`,
+		keptId, mergedId)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"post_recommendation", "post_star", "team_star", "keyword_alert_match", "post_comment", "triage_cursor"} {
+		_, err = tx.Exec("UPDATE OR IGNORE "+table+" SET post_id = "+keptPost+" WHERE post_id IN ("+duplicatePosts+")",
+			keptId, keptId, mergedId)
+		if err != nil {
+			return err
+		}
+	}
+	for _, table := range []string{"post_read", "post_recommendation", "post_star", "team_star", "keyword_alert_match", "post_comment", "triage_cursor"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE post_id IN ("+duplicatePosts+")", keptId, mergedId)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM post WHERE id IN ("+duplicatePosts+")", keptId, mergedId)
+	if err != nil {
+		return err
+	}
+
+	// people subscribed to both are only subscribed to the kept one
+	_, err = tx.Exec(`
+		UPDATE subscribe SET feed_id = ?
+		WHERE feed_id = ? AND user_id NOT IN (SELECT user_id FROM subscribe WHERE feed_id = ?)`,
+		keptId, mergedId, keptId)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"post", "post_archive", "unsubscribe", "team_feed", "feed_topic", "feed_recommendation", "dismissed_recommendation"} {
+		_, err = tx.Exec("UPDATE OR IGNORE "+table+" SET feed_id = ? WHERE feed_id = ?", keptId, mergedId)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM post_read WHERE post_id IN (SELECT id FROM post_archive WHERE feed_id = ?)", mergedId)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"post_archive", "subscribe", "unsubscribe", "team_feed", "feed_fetch_error", "feed_topic", "feed_recommendation", "dismissed_recommendation"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE feed_id = ?", mergedId)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = renameFeedURLTx(tx, mergedURL, keptURL); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM feed WHERE id = ?", mergedId)
+	return err
+}
+
+// renameFeedURLTx points what refers to a feed by its url rather than its id
+// to another url
+func renameFeedURLTx(tx *instrumentedTx, fromURL string, toURL string) error {
+	for _, table := range []string{"starter_pack_feed", "collection_feed", "outgoing_webhook_failing_feed", "matrix_failing_feed", "feed_report", "filter_rule", "post_star", "team_star"} {
+		_, err := tx.Exec("UPDATE OR IGNORE "+table+" SET feed_url = ? WHERE feed_url = ?", toURL, fromURL)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE feed_url = ?", fromURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MoveFeed changes the url of a feed that moved, keeping its subscribers and
+// what they read. If mire knows the new url as another feed already (see
+// KnownFeedURL) the feed is merged into that one instead. It returns the url
+// the feed goes by now.
+func (db *DB) MoveFeed(fromURL string, toURL string) (string, error) {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var fromId int
+	err = tx.QueryRow("SELECT id FROM feed WHERE url = ?", fromURL).Scan(&fromId)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("unknown feed '%s'", fromURL)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var keptId int
+	var keptURL string
+	err = tx.QueryRow(`
+		SELECT id, url FROM feed
+		WHERE (url = ? OR canonical_url = ?) AND id != ?
+		ORDER BY url = ? DESC
+		LIMIT 1`, toURL, feedurl.Canonical(toURL), fromId, toURL).Scan(&keptId, &keptURL)
+	switch {
+	case err == sql.ErrNoRows:
+		keptURL = toURL
+		_, err = tx.Exec("UPDATE feed SET url = ?, canonical_url = ? WHERE id = ?", toURL, feedurl.Canonical(toURL), fromId)
+		if err != nil {
+			return "", err
+		}
+		err = renameFeedURLTx(tx, fromURL, toURL)
+	case err == nil:
+		err = mergeFeedTx(tx, keptId, fromId)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forgetAll()
+	return keptURL, err
+}
@@ -0,0 +1,146 @@
+package sqlite
+
+import "database/sql"
+
+// Collection is a named public list of feeds curated by a user
+type Collection struct {
+	Username    string
+	Slug        string
+	Name        string
+	Description string
+	FeedURLs    []string
+}
+
+// GetUserCollections returns all the collections of a user along with their
+// feeds
+func (db *DB) GetUserCollections(username string) ([]*Collection, error) {
+	rows, err := db.sql.Query(`
+		SELECT c.slug, c.name, c.description, cf.feed_url
+		FROM collection c
+		JOIN user u ON c.user_id = u.id
+		LEFT JOIN collection_feed cf ON cf.collection_id = c.id
+		WHERE u.username = ?
+		ORDER BY c.name, c.slug, cf.feed_url`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var collections []*Collection
+	for rows.Next() {
+		c := Collection{Username: username}
+		var feedURL sql.NullString
+		if err := rows.Scan(&c.Slug, &c.Name, &c.Description, &feedURL); err != nil {
+			return nil, err
+		}
+
+		if len(collections) == 0 || collections[len(collections)-1].Slug != c.Slug {
+			collections = append(collections, &c)
+		}
+		if feedURL.Valid {
+			last := collections[len(collections)-1]
+			last.FeedURLs = append(last.FeedURLs, feedURL.String)
+		}
+	}
+	return collections, rows.Err()
+}
+
+// GetCollection returns a single collection, or nil if it doesn't exist
+func (db *DB) GetCollection(username string, slug string) (*Collection, error) {
+	collections, err := db.GetUserCollections(username)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range collections {
+		if c.Slug == slug {
+			return c, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveCollection creates a collection or, if the user already has one with
+// the same slug, replaces it.
+func (db *DB) SaveCollection(c *Collection) error {
+	userId := db.GetUserID(c.Username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO collection (user_id, slug, name, description) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, slug) DO UPDATE SET name = excluded.name, description = excluded.description`,
+		userId, c.Slug, c.Name, c.Description)
+	if err != nil {
+		return err
+	}
+
+	var collectionId int
+	err = tx.QueryRow("SELECT id FROM collection WHERE user_id = ? AND slug = ?", userId, c.Slug).Scan(&collectionId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM collection_feed WHERE collection_id = ?", collectionId)
+	if err != nil {
+		return err
+	}
+
+	for _, feedURL := range c.FeedURLs {
+		_, err = tx.Exec(
+			"INSERT OR IGNORE INTO collection_feed (collection_id, feed_url) VALUES (?, ?)",
+			collectionId, feedURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteCollection removes one of the user's collections
+func (db *DB) DeleteCollection(username string, slug string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM collection_feed
+		WHERE collection_id IN (SELECT id FROM collection WHERE user_id = ? AND slug = ?)`, userId, slug)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM discord_webhook
+		WHERE collection_id IN (SELECT id FROM collection WHERE user_id = ? AND slug = ?)`, userId, slug)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM slack_webhook
+		WHERE collection_id IN (SELECT id FROM collection WHERE user_id = ? AND slug = ?)`, userId, slug)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM collection WHERE user_id = ? AND slug = ?", userId, slug)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
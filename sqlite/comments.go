@@ -0,0 +1,93 @@
+package sqlite
+
+import (
+	"time"
+)
+
+type Comment struct {
+	ID        int
+	PostID    int
+	PostTitle string
+	Username  string
+	Body      string
+	CreatedAt time.Time
+}
+
+const commentColumns = `
+	SELECT c.id, c.post_id, p.title, u.username, c.body, c.created_at
+	FROM post_comment c
+	JOIN post p ON c.post_id = p.id
+	JOIN user u ON c.user_id = u.id`
+
+func (db *DB) AddPostComment(username string, postId int, body string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("INSERT INTO post_comment (post_id, user_id, body) VALUES (?, ?, ?)",
+		postId, userId, body)
+	unlock()
+
+	return err
+}
+
+// GetPostComments returns the comments on a post, oldest first
+func (db *DB) GetPostComments(postId int) ([]*Comment, error) {
+	return db.queryComments(commentColumns+`
+		WHERE c.post_id = ?
+		ORDER BY c.created_at ASC, c.id ASC`, postId)
+}
+
+// GetRecentComments returns the latest comments across the whole instance,
+// used by admins to moderate them
+func (db *DB) GetRecentComments(limit int) ([]*Comment, error) {
+	return db.queryComments(commentColumns+`
+		ORDER BY c.created_at DESC, c.id DESC
+		LIMIT ?`, limit)
+}
+
+// GetComment returns a single comment, or nil if there's no such comment
+func (db *DB) GetComment(commentId int) (*Comment, error) {
+	comments, err := db.queryComments(commentColumns+" WHERE c.id = ?", commentId)
+	if err != nil || len(comments) == 0 {
+		return nil, err
+	}
+	return comments[0], nil
+}
+
+func (db *DB) DeleteComment(commentId int) error {
+	lock()
+	_, err := db.sql.Exec("DELETE FROM post_comment WHERE id=?", commentId)
+	unlock()
+
+	return err
+}
+
+// DeleteUserComments removes every comment a user ever left
+func (db *DB) DeleteUserComments(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM post_comment WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) queryComments(query string, args ...any) ([]*Comment, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*Comment
+	for rows.Next() {
+		var c Comment
+		err = rows.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.Username, &c.Body, &c.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, &c)
+	}
+	return comments, rows.Err()
+}
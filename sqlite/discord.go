@@ -0,0 +1,126 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type DiscordWebhook struct {
+	ID         int
+	Username   string
+	WebhookURL string
+
+	// empty when the webhook gets posts from all the user's subscriptions
+	CollectionSlug string
+	CollectionName string
+
+	LastPostID int
+}
+
+// SetDiscordWebhook sets where the new posts of a user's subscriptions, or
+// of one of their collections when collectionSlug isn't empty, are posted.
+// Only posts saved from now on are posted.
+func (db *DB) SetDiscordWebhook(username string, webhookURL string, collectionSlug string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	collectionId := 0
+	if collectionSlug != "" {
+		err := db.sql.QueryRow("SELECT id FROM collection WHERE user_id = ? AND slug = ?", userId, collectionSlug).Scan(&collectionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := db.sql.Exec(`
+		INSERT INTO discord_webhook (user_id, webhook_url, collection_id, last_post_id)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(user_id, collection_id) DO UPDATE SET webhook_url = excluded.webhook_url`,
+		userId, webhookURL, collectionId)
+	return err
+}
+
+// RemoveDiscordWebhook removes one of the user's webhooks
+func (db *DB) RemoveDiscordWebhook(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM discord_webhook WHERE id = ? AND user_id = ?", id, userId)
+	unlock()
+
+	return err
+}
+
+const discordWebhookQuery = `
+	SELECT d.id, u.username, d.webhook_url, COALESCE(c.slug, ''), COALESCE(c.name, ''), d.last_post_id
+	FROM discord_webhook d
+	JOIN user u ON d.user_id = u.id
+	LEFT JOIN collection c ON d.collection_id = c.id`
+
+func scanDiscordWebhooks(rows *sql.Rows) ([]*DiscordWebhook, error) {
+	var webhooks []*DiscordWebhook
+	for rows.Next() {
+		var w DiscordWebhook
+		err := rows.Scan(&w.ID, &w.Username, &w.WebhookURL, &w.CollectionSlug, &w.CollectionName, &w.LastPostID)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (db *DB) GetUserDiscordWebhooks(username string) ([]*DiscordWebhook, error) {
+	rows, err := db.sql.Query(discordWebhookQuery+`
+		WHERE u.username = ?
+		ORDER BY d.collection_id ASC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDiscordWebhooks(rows)
+}
+
+func (db *DB) GetDiscordWebhooks() ([]*DiscordWebhook, error) {
+	rows, err := db.sql.Query(discordWebhookQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanDiscordWebhooks(rows)
+}
+
+// GetPostsForDiscordWebhook returns the posts saved after afterPostId, up to
+// and including upToPostId, that a webhook should post, oldest first
+func (db *DB) GetPostsForDiscordWebhook(webhookId int, afterPostId int, upToPostId int, limit int) ([]*NotificationPost, error) {
+	rows, err := db.sql.Query(`
+		SELECT p.id, p.title, p.url, p.published_at, f.url, COALESCE(s.is_favorite, 0), COALESCE(s.notify, 0)
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		JOIN discord_webhook d ON d.id = ?
+		LEFT JOIN subscribe s ON s.feed_id = f.id AND s.user_id = d.user_id
+		WHERE p.id > ? AND p.id <= ?
+		AND (
+			(d.collection_id = 0 AND s.user_id IS NOT NULL)
+			OR f.url IN (SELECT cf.feed_url FROM collection_feed cf WHERE cf.collection_id = d.collection_id)
+		)
+		ORDER BY p.id ASC
+		LIMIT ?`, webhookId, afterPostId, upToPostId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotificationPosts(rows)
+}
+
+func (db *DB) SetDiscordWebhookLastPostID(webhookId int, postId int) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE discord_webhook SET last_post_id = ? WHERE id = ?", postId, webhookId)
+	unlock()
+
+	return err
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+type DigestRecipient struct {
+	Username         string
+	Email            string
+	UnsubscribeToken string
+	LastSentAt       *time.Time
+
+	// where notification emails left off
+	NotifyLastPostID int
+}
+
+// SetDigestEmail sets the address a user's digests are sent to
+func (db *DB) SetDigestEmail(username string, email string, unsubscribeToken string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO email_digest (user_id, email, unsubscribe_token, notify_last_post_id)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(user_id) DO UPDATE SET email = excluded.email`,
+		userId, email, unsubscribeToken)
+	unlock()
+
+	return err
+}
+
+func (db *DB) RemoveDigestEmail(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM email_digest WHERE user_id = ?", userId)
+	unlock()
+
+	return err
+}
+
+// GetDigestEmail returns the address a user's digests are sent to, or an
+// empty string if they didn't set one
+func (db *DB) GetDigestEmail(username string) (string, error) {
+	var email string
+	err := db.sql.QueryRow(`
+		SELECT d.email FROM email_digest d
+		JOIN user u ON d.user_id = u.id
+		WHERE u.username = ?`, username).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
+
+// GetDigestRecipients returns everyone who set an address to get digests at,
+// whether they're due or not
+func (db *DB) GetDigestRecipients() ([]*DigestRecipient, error) {
+	rows, err := db.sql.Query(`
+		SELECT u.username, d.email, d.unsubscribe_token, d.last_sent_at, d.notify_last_post_id
+		FROM email_digest d
+		JOIN user u ON d.user_id = u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []*DigestRecipient
+	for rows.Next() {
+		var r DigestRecipient
+		var lastSentAt sql.NullTime
+		err = rows.Scan(&r.Username, &r.Email, &r.UnsubscribeToken, &lastSentAt, &r.NotifyLastPostID)
+		if err != nil {
+			return nil, err
+		}
+		if lastSentAt.Valid {
+			r.LastSentAt = &lastSentAt.Time
+		}
+		recipients = append(recipients, &r)
+	}
+	return recipients, rows.Err()
+}
+
+func (db *DB) MarkDigestSent(username string, sentAt time.Time) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE email_digest SET last_sent_at = ? WHERE user_id = ?", sentAt, userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) SetEmailNotifyLastPostID(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE email_digest SET notify_last_post_id = ? WHERE user_id = ?", postId, userId)
+	unlock()
+
+	return err
+}
+
+// GetUsernameByUnsubscribeToken returns who a digest unsubscribe token
+// belongs to, or an empty string if it's not a valid token
+func (db *DB) GetUsernameByUnsubscribeToken(token string) (string, error) {
+	var username string
+	err := db.sql.QueryRow(`
+		SELECT u.username FROM email_digest d
+		JOIN user u ON d.user_id = u.id
+		WHERE d.unsubscribe_token = ?`, token).Scan(&username)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return username, err
+}
@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+)
+
+// how many of the last fetch errors (and recoveries) of a feed are kept
+const feedFetchHistoryLength = 50
+
+// FeedFetchEvent is a time fetching a feed failed, or worked again after
+// failing, when Error is empty
+type FeedFetchEvent struct {
+	Error     string
+	CreatedAt time.Time
+}
+
+// pruneFeedFetchHistory forgets all but the last events of a feed's history
+func pruneFeedFetchHistory(tx *instrumentedTx, feedURL string) error {
+	_, err := tx.Exec(`
+		DELETE FROM feed_fetch_error
+		WHERE feed_id = (SELECT id FROM feed WHERE url = ?)
+			AND id NOT IN (
+				SELECT ffe.id FROM feed_fetch_error ffe
+				JOIN feed f ON f.id = ffe.feed_id
+				WHERE f.url = ?
+				ORDER BY ffe.id DESC
+				LIMIT ?)`, feedURL, feedURL, feedFetchHistoryLength)
+	return err
+}
+
+// GetFeedFetchHistory returns the last times fetching a feed failed, and
+// worked again, the most recent first
+func (db *DB) GetFeedFetchHistory(feedURL string, limit int) ([]*FeedFetchEvent, error) {
+	rows, err := db.sql.Query(`
+		SELECT ffe.error, ffe.created_at
+		FROM feed_fetch_error ffe
+		JOIN feed f ON f.id = ffe.feed_id
+		WHERE f.url = ?
+		ORDER BY ffe.id DESC
+		LIMIT ?`, feedURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*FeedFetchEvent
+	for rows.Next() {
+		var event FeedFetchEvent
+		if err = rows.Scan(&event.Error, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+	return events, rows.Err()
+}
+
+// DeadFeed is a feed that failed to be fetched for a long while, see
+// GetDeadFeeds
+type DeadFeed struct {
+	URL          string
+	Error        string
+	FailingSince time.Time
+	Failures     int
+}
+
+// GetDeadFeeds returns the feeds a user is subscribed to that failed to be
+// fetched every time for the last days, at least minFailures times in a row,
+// the longest failing first
+func (db *DB) GetDeadFeeds(username string, days int, minFailures int) ([]*DeadFeed, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, f.fetch_error, f.failing_since, f.fetch_failures FROM feed f
+		JOIN subscribe s ON s.feed_id = f.id
+		JOIN user u ON u.id = s.user_id
+		WHERE u.username = ? AND f.failing_since <= datetime('now', ?) AND f.fetch_failures >= ?
+		ORDER BY f.failing_since, f.url`, username, fmt.Sprintf("-%d days", days), minFailures)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*DeadFeed
+	for rows.Next() {
+		var feed DeadFeed
+		if err = rows.Scan(&feed.URL, &feed.Error, &feed.FailingSince, &feed.Failures); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, &feed)
+	}
+	return feeds, rows.Err()
+}
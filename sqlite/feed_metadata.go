@@ -0,0 +1,86 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// FeedMetadata is what a feed said about itself the last time it was fetched,
+// and how often it's fetched
+type FeedMetadata struct {
+	URL         string
+	Title       string
+	Description string
+
+	// the website of the feed
+	Link string
+
+	// how long after being fetched it's fetched again, or 0 for the default
+	RefreshInterval time.Duration
+}
+
+// SetFeedMetadata stores what a feed says about itself
+func (db *DB) SetFeedMetadata(feedURL string, title string, description string, link string) {
+	lock()
+	_, err := db.sql.Exec("UPDATE feed SET title=?, description=?, link=? WHERE url=?", title, description, link, feedURL)
+	unlock()
+	if err != nil {
+		log.Printf("SetFeedMetadata:: Error updating metadata for feed %s: %v", feedURL, err)
+	}
+}
+
+// GetFeedMetadata returns what a feed said about itself, or nil if there's no
+// such feed
+func (db *DB) GetFeedMetadata(feedURL string) (*FeedMetadata, error) {
+	m := &FeedMetadata{URL: feedURL}
+	var refreshInterval int64
+	err := db.sql.QueryRow("SELECT title, description, link, refresh_interval FROM feed WHERE url=?", feedURL).
+		Scan(&m.Title, &m.Description, &m.Link, &refreshInterval)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.RefreshInterval = time.Duration(refreshInterval) * time.Second
+	return m, nil
+}
+
+// GetAllFeedMetadata returns what every feed said about itself
+func (db *DB) GetAllFeedMetadata() ([]*FeedMetadata, error) {
+	rows, err := db.sql.Query("SELECT url, title, description, link, refresh_interval FROM feed")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*FeedMetadata
+	for rows.Next() {
+		m := &FeedMetadata{}
+		var refreshInterval int64
+		if err := rows.Scan(&m.URL, &m.Title, &m.Description, &m.Link, &refreshInterval); err != nil {
+			return nil, err
+		}
+		m.RefreshInterval = time.Duration(refreshInterval) * time.Second
+		feeds = append(feeds, m)
+	}
+	return feeds, rows.Err()
+}
+
+// SetFeedRefreshInterval sets how long after being fetched a feed is fetched
+// again, 0 for the default
+func (db *DB) SetFeedRefreshInterval(feedURL string, interval time.Duration) error {
+	lock()
+	res, err := db.sql.Exec("UPDATE feed SET refresh_interval = ? WHERE url = ?", int64(interval.Seconds()), feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("no such feed '%s'", feedURL)
+	}
+	return nil
+}
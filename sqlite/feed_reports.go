@@ -0,0 +1,196 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// what admins did about a report
+const (
+	ReportResolutionIgnored = "ignored"
+	ReportResolutionHidden  = "hidden from discover"
+	ReportResolutionDeleted = "feed deleted"
+)
+
+type FeedReport struct {
+	ID         int
+	FeedURL    string
+	Username   string
+	Reason     string
+	CreatedAt  time.Time
+	Resolution string
+	ResolvedAt *time.Time
+}
+
+const feedReportColumns = `
+	SELECT r.id, r.feed_url, u.username, r.reason, r.created_at, r.resolution, r.resolved_at
+	FROM feed_report r
+	JOIN user u ON r.user_id = u.id`
+
+// ReportFeed files a report about a feed. Reporting the same feed again while
+// the first report is still open just updates its reason.
+func (db *DB) ReportFeed(username string, feedURL string, reason string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO feed_report (feed_url, user_id, reason) VALUES (?, ?, ?)
+		ON CONFLICT(feed_url, user_id) WHERE resolved_at IS NULL DO UPDATE SET reason = excluded.reason`,
+		feedURL, userId, reason)
+	unlock()
+
+	return err
+}
+
+// HasOpenFeedReport returns whether a user reported a feed and admins didn't
+// act on it yet
+func (db *DB) HasOpenFeedReport(username string, feedURL string) (bool, error) {
+	var count int
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*) FROM feed_report r
+		JOIN user u ON r.user_id = u.id
+		WHERE u.username = ? AND r.feed_url = ? AND r.resolved_at IS NULL`, username, feedURL).Scan(&count)
+	return count > 0, err
+}
+
+// GetOpenFeedReports returns the reports admins haven't acted on yet, oldest
+// first
+func (db *DB) GetOpenFeedReports() ([]*FeedReport, error) {
+	return db.queryFeedReports(feedReportColumns + `
+		WHERE r.resolved_at IS NULL
+		ORDER BY r.created_at ASC, r.id ASC`)
+}
+
+// GetResolvedFeedReports returns the latest reports admins acted on
+func (db *DB) GetResolvedFeedReports(limit int) ([]*FeedReport, error) {
+	return db.queryFeedReports(feedReportColumns+`
+		WHERE r.resolved_at IS NOT NULL
+		ORDER BY r.resolved_at DESC, r.id DESC
+		LIMIT ?`, limit)
+}
+
+// GetFeedReport returns a single report, or nil if there's no such report
+func (db *DB) GetFeedReport(reportId int) (*FeedReport, error) {
+	reports, err := db.queryFeedReports(feedReportColumns+" WHERE r.id = ?", reportId)
+	if err != nil || len(reports) == 0 {
+		return nil, err
+	}
+	return reports[0], nil
+}
+
+// ResolveFeedReports closes every open report about a feed
+func (db *DB) ResolveFeedReports(feedURL string, resolution string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		UPDATE feed_report SET resolution = ?, resolved_at = CURRENT_TIMESTAMP
+		WHERE feed_url = ? AND resolved_at IS NULL`, resolution, feedURL)
+	unlock()
+
+	return err
+}
+
+func (db *DB) queryFeedReports(query string, args ...any) ([]*FeedReport, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []*FeedReport
+	for rows.Next() {
+		var r FeedReport
+		var resolvedAt sql.NullTime
+		err = rows.Scan(&r.ID, &r.FeedURL, &r.Username, &r.Reason, &r.CreatedAt, &r.Resolution, &resolvedAt)
+		if err != nil {
+			return nil, err
+		}
+		if resolvedAt.Valid {
+			r.ResolvedAt = &resolvedAt.Time
+		}
+		reports = append(reports, &r)
+	}
+	return reports, rows.Err()
+}
+
+// FeedExists returns whether a feed is known to the instance
+func (db *DB) FeedExists(feedURL string) (bool, error) {
+	var count int
+	err := db.sql.QueryRow("SELECT COUNT(*) FROM feed WHERE url = ?", feedURL).Scan(&count)
+	return count > 0, err
+}
+
+// IsFeedHiddenFromDiscover returns whether an admin hid a feed from discover
+func (db *DB) IsFeedHiddenFromDiscover(feedURL string) (bool, error) {
+	var hidden bool
+	err := db.sql.QueryRow("SELECT hide_from_discover FROM feed WHERE url = ?", feedURL).Scan(&hidden)
+	return hidden, err
+}
+
+// SetFeedHiddenFromDiscover sets whether a feed's posts show up on discover
+func (db *DB) SetFeedHiddenFromDiscover(feedURL string, hidden bool) error {
+	lock()
+	res, err := db.sql.Exec("UPDATE feed SET hide_from_discover = ? WHERE url = ?", hidden, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("unknown feed '%s'", feedURL)
+	}
+	return nil
+}
+
+// DeleteFeed removes a feed from the instance along with its posts and
+// everything that points to them, including people's subscriptions.
+func (db *DB) DeleteFeed(feedURL string) error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var feedId int
+	err = tx.QueryRow("SELECT id FROM feed WHERE url = ?", feedURL).Scan(&feedId)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("unknown feed '%s'", feedURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"post_read", "post_recommendation", "post_comment", "triage_cursor"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE post_id IN (SELECT id FROM post WHERE feed_id = ?)", feedId)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM post_read WHERE post_id IN (SELECT id FROM post_archive WHERE feed_id = ?)", feedId)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"post", "post_archive", "subscribe", "unsubscribe", "team_feed", "feed_fetch_error", "feed_topic", "feed_recommendation", "dismissed_recommendation"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE feed_id = ?", feedId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM feed WHERE id = ?", feedId)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forgetAll()
+	return err
+}
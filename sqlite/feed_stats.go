@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+// FeedStats is how much and how often a feed posts, archived posts included
+type FeedStats struct {
+	NumPosts  int
+	FirstPost time.Time
+	LastPost  time.Time
+
+	// how long the feed goes between posts on average, 0 if it posted once
+	AverageInterval time.Duration
+
+	NumPostsLast30Days int
+
+	// how many of the feed's posts the user asking read, when they're logged in
+	NumRead int
+}
+
+// ReadPercentage is the share of the feed's posts the user read, in percent
+func (f *FeedStats) ReadPercentage() int {
+	if f.NumPosts == 0 {
+		return 0
+	}
+	return f.NumRead * 100 / f.NumPosts
+}
+
+// GetFeedStats returns the stats of a feed, with what username read of it if
+// it's not empty
+func (db *DB) GetFeedStats(feedURL string, username string) (*FeedStats, error) {
+	feedId := db.GetFeedID(feedURL)
+
+	var stats FeedStats
+	var first, last sql.NullString
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*), MIN(published_at), MAX(published_at),
+			COUNT(CASE WHEN published_at >= ? THEN 1 END)
+		FROM (
+			SELECT published_at FROM post WHERE feed_id = ?
+			UNION ALL
+			SELECT published_at FROM post_archive WHERE feed_id = ?
+		)`, time.Now().UTC().AddDate(0, 0, -30), feedId, feedId).Scan(&stats.NumPosts, &first, &last, &stats.NumPostsLast30Days)
+	if err != nil {
+		return nil, err
+	}
+	if stats.NumPosts == 0 {
+		return &stats, nil
+	}
+
+	stats.FirstPost, err = db.TryParseDate(first.String)
+	if err != nil {
+		return nil, err
+	}
+	stats.LastPost, err = db.TryParseDate(last.String)
+	if err != nil {
+		return nil, err
+	}
+	if stats.NumPosts > 1 {
+		stats.AverageInterval = stats.LastPost.Sub(stats.FirstPost) / time.Duration(stats.NumPosts-1)
+	}
+
+	if username != "" {
+		err = db.sql.QueryRow(`
+			SELECT COUNT(*) FROM post_read pr
+			JOIN user u ON u.id = pr.user_id
+			WHERE u.username = ? AND pr.has_read = 1 AND pr.post_id IN (
+				SELECT id FROM post WHERE feed_id = ?
+				UNION ALL
+				SELECT id FROM post_archive WHERE feed_id = ?
+			)`, username, feedId, feedId).Scan(&stats.NumRead)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &stats, nil
+}
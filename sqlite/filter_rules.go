@@ -0,0 +1,208 @@
+package sqlite
+
+import (
+	"regexp"
+	"strings"
+)
+
+// how filter rules match the titles of posts
+const (
+	FilterMatchContains = "contains"
+	FilterMatchRegex    = "regex"
+)
+
+// what filter rules do to the posts they match
+const (
+	FilterActionRead = "read"
+	FilterActionHide = "hide"
+)
+
+// FilterRule marks read or hides the posts of a user's timeline whose title
+// matches it, see the filter_rule table
+type FilterRule struct {
+	ID int
+
+	// the feed it applies to, or empty for all of them
+	FeedURL string
+	Match   string
+	Pattern string
+	Action  string
+}
+
+// Matches tells whether a post's title matches the rule. Contains ignores
+// case, regexes go by Go's syntax ((?i) to ignore case).
+func (rule *FilterRule) Matches(title string) bool {
+	switch rule.Match {
+	case FilterMatchContains:
+		return strings.Contains(strings.ToLower(title), strings.ToLower(rule.Pattern))
+	case FilterMatchRegex:
+		re, err := regexp.Compile(rule.Pattern)
+		return err == nil && re.MatchString(title)
+	}
+	return false
+}
+
+// GetUserFilterRules returns a user's filter rules, oldest first
+func (db *DB) GetUserFilterRules(username string) ([]*FilterRule, error) {
+	rows, err := db.sql.Query(`
+		SELECT r.id, r.feed_url, r.match, r.pattern, r.action FROM filter_rule r
+		JOIN user u ON u.id = r.user_id
+		WHERE u.username = ?
+		ORDER BY r.id`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*FilterRule
+	for rows.Next() {
+		var rule FilterRule
+		if err = rows.Scan(&rule.ID, &rule.FeedURL, &rule.Match, &rule.Pattern, &rule.Action); err != nil {
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+	return rules, rows.Err()
+}
+
+// AddFilterRule adds a filter rule and applies it to the posts of the user's
+// timeline they haven't read yet, it returns how many it applied to
+func (db *DB) AddFilterRule(username string, rule *FilterRule) (int, error) {
+	userId := db.GetUserID(username)
+
+	rows, err := db.sql.Query(`
+		SELECT p.id, p.title FROM post p
+		JOIN feed f ON f.id = p.feed_id
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+timelineFeedIDs+`) AND (? = '' OR f.url = ?)
+			AND (pr.has_read IS NULL OR pr.has_read = 0)`,
+		userId, userId, userId, rule.FeedURL, rule.FeedURL)
+	if err != nil {
+		return 0, err
+	}
+	var postIds []int64
+	for rows.Next() {
+		var id int64
+		var title string
+		if err := rows.Scan(&id, &title); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if rule.Matches(title) {
+			postIds = append(postIds, id)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("INSERT INTO filter_rule (user_id, feed_url, match, pattern, action) VALUES (?, ?, ?, ?, ?)",
+		userId, rule.FeedURL, rule.Match, rule.Pattern, rule.Action)
+	if err != nil {
+		return 0, err
+	}
+	for _, postId := range postIds {
+		if err = filterPostTx(tx, userId, postId, rule.Action == FilterActionHide); err != nil {
+			return 0, err
+		}
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forget(userId)
+	return len(postIds), err
+}
+
+// RemoveFilterRule removes one of a user's filter rules. The posts it marked
+// read or hid stay that way.
+func (db *DB) RemoveFilterRule(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM filter_rule WHERE id = ? AND user_id = ?", id, userId)
+	unlock()
+
+	return err
+}
+
+// filterPostTx marks a post read for a user, and hides it when asked to
+func filterPostTx(tx *instrumentedTx, userId int, postId int64, hide bool) error {
+	res, err := tx.Exec("UPDATE post_read SET has_read = 1, hidden = ? WHERE user_id = ? AND post_id = ?", hide, userId, postId)
+	if err != nil {
+		return err
+	}
+	if updated, _ := res.RowsAffected(); updated > 0 {
+		return nil
+	}
+	_, err = tx.Exec("INSERT INTO post_read (user_id, post_id, has_read, hidden) VALUES (?, ?, 1, ?)", userId, postId, hide)
+	return err
+}
+
+// applyFilterRules applies the filter rules of the people whose timeline a
+// newly saved post is in. When a few rules of someone match it, hiding wins
+// over marking read.
+func (db *DB) applyFilterRules(postId int64, feedId int, title string) error {
+	rows, err := db.sql.Query(`
+		SELECT r.user_id, r.feed_url, r.match, r.pattern, r.action FROM filter_rule r
+		JOIN feed f ON f.id = ?
+		WHERE (r.feed_url = '' OR r.feed_url = f.url)
+			AND r.user_id IN (
+				SELECT user_id FROM subscribe WHERE feed_id = f.id
+				UNION
+				SELECT bf.follower_id FROM blogroll_follow bf
+				JOIN subscribe s ON s.user_id = bf.followee_id
+				WHERE s.feed_id = f.id)`, feedId)
+	if err != nil {
+		return err
+	}
+
+	// whether to hide the post, by user
+	hide := make(map[int]bool)
+	for rows.Next() {
+		var userId int
+		var rule FilterRule
+		if err = rows.Scan(&userId, &rule.FeedURL, &rule.Match, &rule.Pattern, &rule.Action); err != nil {
+			rows.Close()
+			return err
+		}
+		if rule.Matches(title) {
+			hide[userId] = hide[userId] || rule.Action == FilterActionHide
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	if len(hide) == 0 {
+		return nil
+	}
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for userId, hidden := range hide {
+		if err = filterPostTx(tx, userId, postId, hidden); err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	for userId := range hide {
+		db.unreadCounts.forget(userId)
+	}
+	return err
+}
@@ -0,0 +1,181 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// IndieAuthCode is what an app gets after someone approves it, to redeem for
+// a token
+type IndieAuthCode struct {
+	Username      string
+	ClientID      string
+	RedirectURI   string
+	CodeChallenge string
+	Scope         string
+}
+
+// IndieAuthToken is what an app acts on behalf of someone with
+type IndieAuthToken struct {
+	ID       int
+	Username string
+	ClientID string
+	Scope    string
+
+	// set for the tokens people created themselves, which have no client_id
+	Name string
+
+	CreatedAt time.Time
+
+	// zero if the app never used it
+	LastUsedAt time.Time
+}
+
+// SaveIndieAuthCode saves the code an app was given
+func (db *DB) SaveIndieAuthCode(code string, c *IndieAuthCode) error {
+	userId := db.GetUserID(c.Username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO indieauth_code (code, user_id, client_id, redirect_uri, code_challenge, scope)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		code, userId, c.ClientID, c.RedirectURI, c.CodeChallenge, c.Scope)
+	unlock()
+
+	return err
+}
+
+// RedeemIndieAuthCode returns what a code was given for, if it was given
+// less than maxAgeMinutes ago, and forgets it: codes can only be used once.
+// Returns nil if there's no such code.
+func (db *DB) RedeemIndieAuthCode(code string, maxAgeMinutes int) (*IndieAuthCode, error) {
+	lock()
+	defer unlock()
+
+	var c IndieAuthCode
+	err := db.sql.QueryRow(`
+		SELECT u.username, c.client_id, c.redirect_uri, c.code_challenge, c.scope
+		FROM indieauth_code c
+		JOIN user u ON c.user_id = u.id
+		WHERE c.code = ? AND c.created_at > datetime('now', ?)`,
+		code, fmt.Sprintf("-%d minutes", maxAgeMinutes)).Scan(&c.Username, &c.ClientID, &c.RedirectURI, &c.CodeChallenge, &c.Scope)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// expired codes go too
+	_, deleteErr := db.sql.Exec(`
+		DELETE FROM indieauth_code WHERE code = ? OR created_at <= datetime('now', ?)`,
+		code, fmt.Sprintf("-%d minutes", maxAgeMinutes))
+	if deleteErr != nil {
+		return nil, deleteErr
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return &c, nil
+}
+
+// AddPersonalToken saves a token someone created for themselves
+func (db *DB) AddPersonalToken(username string, name string, scope string, token string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO indieauth_token (user_id, client_id, name, scope, token) VALUES (?, '', ?, ?, ?)`,
+		userId, name, scope, token)
+	unlock()
+
+	return err
+}
+
+// AddIndieAuthToken saves a token given to an app
+func (db *DB) AddIndieAuthToken(username string, clientID string, scope string, token string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO indieauth_token (user_id, client_id, scope, token) VALUES (?, ?, ?, ?)`,
+		userId, clientID, scope, token)
+	unlock()
+
+	return err
+}
+
+const indieAuthTokenQuery = `
+	SELECT t.id, u.username, t.client_id, t.name, t.scope, t.created_at, t.last_used_at
+	FROM indieauth_token t
+	JOIN user u ON t.user_id = u.id`
+
+func scanIndieAuthToken(row interface{ Scan(...any) error }) (*IndieAuthToken, error) {
+	var t IndieAuthToken
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&t.ID, &t.Username, &t.ClientID, &t.Name, &t.Scope, &t.CreatedAt, &lastUsedAt)
+	if err != nil {
+		return nil, err
+	}
+	t.LastUsedAt = lastUsedAt.Time
+	return &t, nil
+}
+
+// GetIndieAuthToken returns who a token was given to, and for what, or nil
+// if there's no such token
+func (db *DB) GetIndieAuthToken(token string) (*IndieAuthToken, error) {
+	t, err := scanIndieAuthToken(db.sql.QueryRow(indieAuthTokenQuery+" WHERE t.token = ?", token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	return t, err
+}
+
+// TouchIndieAuthToken remembers when an app last used its token
+func (db *DB) TouchIndieAuthToken(id int) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE indieauth_token SET last_used_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+	unlock()
+
+	return err
+}
+
+// GetUserIndieAuthTokens returns the apps a user signed in to, and the tokens
+// they created, newest first
+func (db *DB) GetUserIndieAuthTokens(username string) ([]*IndieAuthToken, error) {
+	rows, err := db.sql.Query(indieAuthTokenQuery+" WHERE u.username = ? ORDER BY t.id DESC", username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*IndieAuthToken
+	for rows.Next() {
+		t, err := scanIndieAuthToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// RevokeIndieAuthToken signs an app out of a user's account
+func (db *DB) RevokeIndieAuthToken(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM indieauth_token WHERE id = ? AND user_id = ?", id, userId)
+	unlock()
+
+	return err
+}
+
+// DeleteIndieAuthToken forgets a token, for apps signing themselves out
+func (db *DB) DeleteIndieAuthToken(token string) error {
+	lock()
+	_, err := db.sql.Exec("DELETE FROM indieauth_token WHERE token = ?", token)
+	unlock()
+
+	return err
+}
@@ -0,0 +1,59 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type InstapaperAccount struct {
+	AccountName string
+	Token       string
+	TokenSecret string
+}
+
+// GetInstapaperAccount returns the instapaper account a user connected, or
+// nil if they didn't connect one
+func (db *DB) GetInstapaperAccount(username string) (*InstapaperAccount, error) {
+	var account InstapaperAccount
+	err := db.sql.QueryRow(`
+		SELECT i.account_name, i.token, i.token_secret
+		FROM instapaper_account i
+		JOIN user u ON i.user_id = u.id
+		WHERE u.username = ?`, username).
+		Scan(&account.AccountName, &account.Token, &account.TokenSecret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveInstapaperAccount connects an instapaper account to a user, replacing
+// the one they had connected before
+func (db *DB) SaveInstapaperAccount(username string, account *InstapaperAccount) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO instapaper_account (user_id, account_name, token, token_secret) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			account_name=excluded.account_name,
+			token=excluded.token,
+			token_secret=excluded.token_secret`,
+		userId, account.AccountName, account.Token, account.TokenSecret)
+	unlock()
+
+	return err
+}
+
+func (db *DB) DeleteInstapaperAccount(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM instapaper_account WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
@@ -0,0 +1,277 @@
+package sqlite
+
+import (
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// where a keyword alert looks for posts
+const (
+	AlertScopeMine = "mine"
+	AlertScopeAll  = "all"
+)
+
+type KeywordAlert struct {
+	ID       int
+	Username string
+	Keyword  string
+	Scope    string
+	Notify   bool
+}
+
+type KeywordAlertMatch struct {
+	AlertID   int
+	Keyword   string
+	PostID    int
+	Title     string
+	URL       string
+	FeedURL   string
+	MatchedAt time.Time
+}
+
+// MatchesKeyword reports whether a title mentions a keyword as a whole word
+// (or words), ignoring case. "go" matches "Learning Go" but not "good".
+func MatchesKeyword(title string, keyword string) bool {
+	title = strings.ToLower(title)
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	if keyword == "" {
+		return false
+	}
+
+	for start := 0; start < len(title); {
+		i := strings.Index(title[start:], keyword)
+		if i < 0 {
+			return false
+		}
+		i += start
+		end := i + len(keyword)
+
+		before, _ := utf8.DecodeLastRuneInString(title[:i])
+		after, _ := utf8.DecodeRuneInString(title[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+
+		_, size := utf8.DecodeRuneInString(title[i:])
+		start = i + size
+	}
+	return false
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+func (db *DB) AddKeywordAlert(username string, keyword string, scope string, notify bool) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO keyword_alert (user_id, keyword, scope, notify) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id, keyword) DO UPDATE SET scope = excluded.scope, notify = excluded.notify`,
+		userId, keyword, scope, notify)
+	unlock()
+
+	return err
+}
+
+// RemoveKeywordAlert removes one of the user's alerts along with what it
+// matched
+func (db *DB) RemoveKeywordAlert(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM keyword_alert WHERE id = ? AND user_id = ?", id, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	_, err = tx.Exec("DELETE FROM keyword_alert_match WHERE alert_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) queryKeywordAlerts(where string, args ...any) ([]*KeywordAlert, error) {
+	rows, err := db.sql.Query(`
+		SELECT a.id, u.username, a.keyword, a.scope, a.notify
+		FROM keyword_alert a
+		JOIN user u ON a.user_id = u.id
+		`+where+`
+		ORDER BY a.keyword COLLATE NOCASE ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var alerts []*KeywordAlert
+	for rows.Next() {
+		var a KeywordAlert
+		err = rows.Scan(&a.ID, &a.Username, &a.Keyword, &a.Scope, &a.Notify)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, &a)
+	}
+	return alerts, rows.Err()
+}
+
+func (db *DB) GetUserKeywordAlerts(username string) ([]*KeywordAlert, error) {
+	return db.queryKeywordAlerts("WHERE u.username = ?", username)
+}
+
+// matchKeywordAlerts records which alerts a newly saved post matches. Feeds
+// hidden from discover only match the alerts of their subscribers.
+func (db *DB) matchKeywordAlerts(postId int64, feedId int, title string) error {
+	rows, err := db.sql.Query(`
+		SELECT a.id, a.keyword
+		FROM keyword_alert a
+		JOIN feed f ON f.id = ?
+		LEFT JOIN subscribe s ON s.user_id = a.user_id AND s.feed_id = f.id
+		WHERE s.user_id IS NOT NULL OR (a.scope = ? AND f.hide_from_discover = 0)`, feedId, AlertScopeAll)
+	if err != nil {
+		return err
+	}
+
+	var matching []int
+	for rows.Next() {
+		var alertId int
+		var keyword string
+		err = rows.Scan(&alertId, &keyword)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		if MatchesKeyword(title, keyword) {
+			matching = append(matching, alertId)
+		}
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	lock()
+	defer unlock()
+	for _, alertId := range matching {
+		_, err = db.sql.Exec(`
+			INSERT INTO keyword_alert_match (alert_id, post_id) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, alertId, postId)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const keywordAlertMatchQuery = `
+	SELECT m.alert_id, a.keyword, p.id, p.title, p.url, f.url, m.matched_at
+	FROM keyword_alert_match m
+	JOIN keyword_alert a ON m.alert_id = a.id
+	JOIN post p ON m.post_id = p.id
+	JOIN feed f ON p.feed_id = f.id`
+
+func (db *DB) queryKeywordAlertMatches(query string, args ...any) ([]*KeywordAlertMatch, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []*KeywordAlertMatch
+	for rows.Next() {
+		var m KeywordAlertMatch
+		err = rows.Scan(&m.AlertID, &m.Keyword, &m.PostID, &m.Title, &m.URL, &m.FeedURL, &m.MatchedAt)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, &m)
+	}
+	return matches, rows.Err()
+}
+
+// GetKeywordAlertMatches returns the posts that matched a user's alerts,
+// newest first
+func (db *DB) GetKeywordAlertMatches(username string, limit int) ([]*KeywordAlertMatch, error) {
+	return db.queryKeywordAlertMatches(keywordAlertMatchQuery+`
+		JOIN user u ON a.user_id = u.id
+		WHERE u.username = ?
+		ORDER BY m.matched_at DESC, p.id DESC
+		LIMIT ?`, username, limit)
+}
+
+// GetUnnotifiedKeywordAlertMatches returns the matches of a user's alerts
+// that want notifications and that they weren't notified about yet, oldest
+// first
+func (db *DB) GetUnnotifiedKeywordAlertMatches(username string) ([]*KeywordAlertMatch, error) {
+	return db.queryKeywordAlertMatches(keywordAlertMatchQuery+`
+		JOIN user u ON a.user_id = u.id
+		WHERE u.username = ? AND a.notify = 1 AND m.notified = 0
+		ORDER BY p.id ASC`, username)
+}
+
+// GetUsersWithUnnotifiedKeywordAlerts returns who has alert matches waiting
+// to be notified about
+func (db *DB) GetUsersWithUnnotifiedKeywordAlerts() ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT DISTINCT u.username
+		FROM keyword_alert_match m
+		JOIN keyword_alert a ON m.alert_id = a.id
+		JOIN user u ON a.user_id = u.id
+		WHERE a.notify = 1 AND m.notified = 0`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err = rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+func (db *DB) MarkKeywordAlertMatchesNotified(matches []*KeywordAlertMatch) error {
+	lock()
+	defer unlock()
+
+	for _, m := range matches {
+		_, err := db.sql.Exec("UPDATE keyword_alert_match SET notified = 1 WHERE alert_id = ? AND post_id = ?", m.AlertID, m.PostID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClearKeywordAlertMatches forgets about everything a user's alerts matched
+func (db *DB) ClearKeywordAlertMatches(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM keyword_alert_match
+		WHERE alert_id IN (SELECT id FROM keyword_alert WHERE user_id = ?)`, userId)
+	unlock()
+
+	return err
+}
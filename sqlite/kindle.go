@@ -0,0 +1,39 @@
+package sqlite
+
+import "database/sql"
+
+func (db *DB) SetKindleAddress(username string, email string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO kindle_address (user_id, email) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET email = excluded.email`, userId, email)
+	unlock()
+
+	return err
+}
+
+func (db *DB) RemoveKindleAddress(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM kindle_address WHERE user_id = ?", userId)
+	unlock()
+
+	return err
+}
+
+// GetKindleAddress returns where to email a user's ebooks, or an empty string
+// if they didn't say
+func (db *DB) GetKindleAddress(username string) (string, error) {
+	var email string
+	err := db.sql.QueryRow(`
+		SELECT k.email FROM kindle_address k
+		JOIN user u ON k.user_id = u.id
+		WHERE u.username = ?`, username).Scan(&email)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return email, err
+}
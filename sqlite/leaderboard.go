@@ -0,0 +1,64 @@
+package sqlite
+
+import "fmt"
+
+// FeedSubscriberCount is an entry in the most subscribed feeds leaderboard
+type FeedSubscriberCount struct {
+	URL         string
+	Subscribers int
+}
+
+// GetMostSubscribedFeeds returns the feeds with the most subscribers, leaving
+// out the ones that have been hidden from the leaderboard.
+func (db *DB) GetMostSubscribedFeeds(limit int) ([]*FeedSubscriberCount, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, COUNT(s.user_id) AS subscribers
+		FROM feed f
+		JOIN subscribe s ON s.feed_id = f.id
+		WHERE f.hide_from_leaderboard = 0
+		GROUP BY f.id
+		ORDER BY subscribers DESC, f.url ASC
+		LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*FeedSubscriberCount
+	for rows.Next() {
+		var f FeedSubscriberCount
+		if err := rows.Scan(&f.URL, &f.Subscribers); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, &f)
+	}
+	return feeds, rows.Err()
+}
+
+// IsFeedHiddenFromLeaderboard returns whether a feed opted out of the most
+// subscribed feeds leaderboard.
+func (db *DB) IsFeedHiddenFromLeaderboard(feedURL string) (bool, error) {
+	var hidden bool
+	err := db.sql.QueryRow("SELECT hide_from_leaderboard FROM feed WHERE url = ?", feedURL).Scan(&hidden)
+	return hidden, err
+}
+
+// SetFeedHiddenFromLeaderboard sets whether a feed is listed on the most
+// subscribed feeds leaderboard.
+func (db *DB) SetFeedHiddenFromLeaderboard(feedURL string, hidden bool) error {
+	lock()
+	res, err := db.sql.Exec("UPDATE feed SET hide_from_leaderboard = ? WHERE url = ?", hidden, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("unknown feed '%s'", feedURL)
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+type MastodonApp struct {
+	Instance     string
+	ClientID     string
+	ClientSecret string
+}
+
+type MastodonAccount struct {
+	Instance    string
+	AccessToken string
+	AccountName string
+	// empty means the default template
+	TootTemplate string
+}
+
+// GetMastodonApp returns the app registered on an instance, or nil if there
+// isn't one yet
+func (db *DB) GetMastodonApp(instance string) (*MastodonApp, error) {
+	app := MastodonApp{Instance: instance}
+	err := db.sql.QueryRow("SELECT client_id, client_secret FROM mastodon_app WHERE instance=?", instance).
+		Scan(&app.ClientID, &app.ClientSecret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &app, nil
+}
+
+func (db *DB) SaveMastodonApp(app *MastodonApp) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO mastodon_app (instance, client_id, client_secret) VALUES (?, ?, ?)
+		ON CONFLICT(instance) DO UPDATE SET client_id=excluded.client_id, client_secret=excluded.client_secret`,
+		app.Instance, app.ClientID, app.ClientSecret)
+	unlock()
+
+	return err
+}
+
+// GetMastodonAccount returns the mastodon account a user connected, or nil if
+// they didn't connect one
+func (db *DB) GetMastodonAccount(username string) (*MastodonAccount, error) {
+	var account MastodonAccount
+	err := db.sql.QueryRow(`
+		SELECT m.instance, m.access_token, m.account_name, m.toot_template
+		FROM mastodon_account m
+		JOIN user u ON m.user_id = u.id
+		WHERE u.username = ?`, username).
+		Scan(&account.Instance, &account.AccessToken, &account.AccountName, &account.TootTemplate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveMastodonAccount connects a mastodon account to a user, replacing the one
+// they had connected before but keeping their toot template
+func (db *DB) SaveMastodonAccount(username string, account *MastodonAccount) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO mastodon_account (user_id, instance, access_token, account_name) VALUES (?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			instance=excluded.instance,
+			access_token=excluded.access_token,
+			account_name=excluded.account_name`,
+		userId, account.Instance, account.AccessToken, account.AccountName)
+	unlock()
+
+	return err
+}
+
+func (db *DB) SetMastodonTootTemplate(username string, tootTemplate string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE mastodon_account SET toot_template=? WHERE user_id=?", tootTemplate, userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) DeleteMastodonAccount(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM mastodon_account WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
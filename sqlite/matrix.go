@@ -0,0 +1,195 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+// which posts are sent to a matrix room
+const (
+	MatrixPostsAll       = "all"
+	MatrixPostsFavorites = "favorites"
+	MatrixPostsNone      = "none"
+)
+
+type MatrixNotification struct {
+	Username     string
+	Homeserver   string
+	AccessToken  string
+	RoomID       string
+	Posts        string
+	FeedFailures bool
+	LastPostID   int
+}
+
+// SetMatrixNotification sets where and when a user gets notifications in a
+// Matrix room. Only posts saved, and feeds that start failing, from now on
+// are notified about.
+func (db *DB) SetMatrixNotification(n *MatrixNotification) error {
+	userId := db.GetUserID(n.Username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO matrix_notification (user_id, homeserver, access_token, room_id, posts, feed_failures, last_post_id)
+		VALUES (?, ?, ?, ?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(user_id) DO UPDATE SET
+			homeserver = excluded.homeserver,
+			access_token = excluded.access_token,
+			room_id = excluded.room_id,
+			posts = excluded.posts,
+			feed_failures = excluded.feed_failures`,
+		userId, n.Homeserver, n.AccessToken, n.RoomID, n.Posts, n.FeedFailures)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO matrix_failing_feed (user_id, feed_url)
+		SELECT s.user_id, f.url FROM feed f
+		JOIN subscribe s ON f.id = s.feed_id
+		WHERE s.user_id = ? AND f.fetch_error IS NOT NULL AND f.fetch_error != ''
+		ON CONFLICT DO NOTHING`, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) RemoveMatrixNotification(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"matrix_notification", "matrix_failing_feed"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE user_id = ?", userId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) queryMatrixNotifications(where string, args ...any) ([]*MatrixNotification, error) {
+	rows, err := db.sql.Query(`
+		SELECT u.username, m.homeserver, m.access_token, m.room_id, m.posts, m.feed_failures, m.last_post_id
+		FROM matrix_notification m
+		JOIN user u ON m.user_id = u.id
+		`+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []*MatrixNotification
+	for rows.Next() {
+		var n MatrixNotification
+		err = rows.Scan(&n.Username, &n.Homeserver, &n.AccessToken, &n.RoomID, &n.Posts, &n.FeedFailures, &n.LastPostID)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, &n)
+	}
+	return notifications, rows.Err()
+}
+
+// GetMatrixNotification returns how a user gets notifications in Matrix, or
+// nil if they don't
+func (db *DB) GetMatrixNotification(username string) (*MatrixNotification, error) {
+	notifications, err := db.queryMatrixNotifications("WHERE u.username = ?", username)
+	if err != nil || len(notifications) == 0 {
+		return nil, err
+	}
+	return notifications[0], nil
+}
+
+func (db *DB) GetMatrixNotifications() ([]*MatrixNotification, error) {
+	return db.queryMatrixNotifications("")
+}
+
+func (db *DB) SetMatrixLastPostID(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE matrix_notification SET last_post_id = ? WHERE user_id = ?", postId, userId)
+	unlock()
+
+	return err
+}
+
+// GetNewlyFailingFeedsForMatrix returns the feeds a user is subscribed to
+// that are failing and that their room wasn't told about yet. Feeds that
+// work again are forgotten about first, so that the room is told if they
+// break again.
+func (db *DB) GetNewlyFailingFeedsForMatrix(username string) ([]*FailingFeed, error) {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM matrix_failing_feed
+		WHERE user_id = ? AND feed_url NOT IN (
+			SELECT url FROM feed WHERE fetch_error IS NOT NULL AND fetch_error != ''
+		)`, userId)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.sql.Query(`
+		SELECT f.url, f.fetch_error
+		FROM feed f
+		JOIN subscribe s ON f.id = s.feed_id
+		WHERE s.user_id = ? AND f.fetch_error IS NOT NULL AND f.fetch_error != ''
+		AND f.url NOT IN (SELECT feed_url FROM matrix_failing_feed WHERE user_id = s.user_id)`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFailingFeeds(rows)
+}
+
+func (db *DB) MarkMatrixFeedFailuresReported(username string, feeds []*FailingFeed) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	for _, feed := range feeds {
+		_, err := db.sql.Exec(`
+			INSERT INTO matrix_failing_feed (user_id, feed_url) VALUES (?, ?)
+			ON CONFLICT DO NOTHING`, userId, feed.URL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFailingFeeds(rows *sql.Rows) ([]*FailingFeed, error) {
+	var feeds []*FailingFeed
+	for rows.Next() {
+		var f FailingFeed
+		err := rows.Scan(&f.URL, &f.Error)
+		if err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, &f)
+	}
+	return feeds, rows.Err()
+}
@@ -0,0 +1,200 @@
+package sqlite
+
+import (
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// TimelineFilter picks one of a user's timelines: every feed they read (the
+// zero value), the ones they asked to be notified about, or the feeds of one
+// of their collections
+type TimelineFilter struct {
+	NotifyOnly     bool
+	CollectionSlug string
+}
+
+// feedIDs returns the query of the ids of the feeds in a timeline, and its
+// arguments
+func (f TimelineFilter) feedIDs(userId int) (string, []any) {
+	switch {
+	case f.CollectionSlug != "":
+		return `
+			SELECT fc.id FROM feed fc
+			JOIN collection_feed cf ON cf.feed_url = fc.url
+			JOIN collection c ON c.id = cf.collection_id
+			WHERE c.user_id = ? AND c.slug = ?`, []any{userId, f.CollectionSlug}
+	case f.NotifyOnly:
+		return "SELECT feed_id FROM subscribe WHERE user_id = ? AND notify = 1", []any{userId}
+	default:
+		return timelineFeedIDs, []any{userId, userId}
+	}
+}
+
+// TimelinePage is a page of a timeline, newest posts first
+type TimelinePage struct {
+	Entries []*UserPostEntry
+
+	// ids to pass back to get the newer or older posts, 0 when there's none
+	Before int
+	After  int
+}
+
+// GetTimelinePage returns posts from one of a user's timelines, in the order
+// mire saved them: the newest ones, the ones saved after beforeId or the ones
+// saved before afterId. Paging by id keeps pages stable as new posts come in.
+func (db *DB) GetTimelinePage(username string, filter TimelineFilter, beforeId int, afterId int, limit int) (*TimelinePage, error) {
+	userId := db.GetUserID(username)
+	feedIDs, feedArgs := filter.feedIDs(userId)
+
+	query := `
+		SELECT p.id, p.title, p.url, p.domain, p.published_at, p.word_count, p.thumbnail_url, p.duration, p.comments_url, p.article_url, COALESCE(pr.has_read, 0), f.url, f.sensitive
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (` + feedIDs + `) AND COALESCE(pr.hidden, 0) = 0`
+	args := append([]any{userId}, feedArgs...)
+
+	// newer posts are fetched oldest first, so that the ones right after
+	// beforeId come first, and put back in order below
+	order := "DESC"
+	if beforeId > 0 {
+		query += " AND p.id > ?"
+		args = append(args, beforeId)
+		order = "ASC"
+	} else if afterId > 0 {
+		query += " AND p.id < ?"
+		args = append(args, afterId)
+	}
+	query += fmt.Sprintf(" ORDER BY p.id %s LIMIT ?", order)
+	args = append(args, limit+1)
+
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*UserPostEntry
+	for rows.Next() {
+		var entry UserPostEntry
+		var p gofeed.Item
+		err = rows.Scan(&entry.PostID, &p.Title, &p.Link, &entry.Domain, &p.PublishedParsed, &entry.WordCount, &entry.ThumbnailURL, &entry.Duration, &entry.CommentsURL, &entry.ArticleURL, &entry.IsRead, &entry.FeedURL, &entry.Sensitive)
+		if err != nil {
+			return nil, err
+		}
+		entry.Post = &p
+		entries = append(entries, &entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	hasMore := len(entries) > limit
+	if hasMore {
+		entries = entries[:limit]
+	}
+	if beforeId > 0 {
+		for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+			entries[i], entries[j] = entries[j], entries[i]
+		}
+	}
+
+	page := &TimelinePage{Entries: entries}
+	if len(entries) == 0 {
+		// nothing newer yet, ask again from the same place later
+		page.Before = beforeId
+		return page, nil
+	}
+	page.Before = entries[0].PostID
+	if hasMore && beforeId == 0 {
+		page.After = entries[len(entries)-1].PostID
+	}
+	return page, nil
+}
+
+// GetTimelineUnreadCount returns the number of posts in one of a user's
+// timelines they haven't read yet
+func (db *DB) GetTimelineUnreadCount(username string, filter TimelineFilter) (int, error) {
+	userId := db.GetUserID(username)
+	feedIDs, feedArgs := filter.feedIDs(userId)
+
+	var count int
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*)
+		FROM post p
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+feedIDs+`) AND (pr.has_read IS NULL OR pr.has_read = 0)`,
+		append([]any{userId}, feedArgs...)...).Scan(&count)
+	return count, err
+}
+
+// SetPostsReadStatus marks posts, by id, as read or unread for a user
+func (db *DB) SetPostsReadStatus(username string, postIds []int, read bool) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, postId := range postIds {
+		err = setReadStatusTx(tx, userId, postId, read)
+		if err != nil {
+			return err
+		}
+	}
+	err = tx.Commit()
+	db.unreadCounts.forget(userId)
+	return err
+}
+
+// MarkTimelineReadUpTo marks every post of one of a user's timelines saved up
+// to lastReadId as read
+func (db *DB) MarkTimelineReadUpTo(username string, filter TimelineFilter, lastReadId int) error {
+	userId := db.GetUserID(username)
+	feedIDs, feedArgs := filter.feedIDs(userId)
+
+	rows, err := db.sql.Query(`
+		SELECT p.id FROM post p
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+feedIDs+`) AND p.id <= ? AND (pr.has_read IS NULL OR pr.has_read = 0)`,
+		append(append([]any{userId}, feedArgs...), lastReadId)...)
+	if err != nil {
+		return err
+	}
+	var postIds []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		postIds = append(postIds, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	return db.SetPostsReadStatus(username, postIds, true)
+}
+
+// setReadStatusTx is SetReadStatus by post id, within a transaction
+func setReadStatusTx(tx *instrumentedTx, userId int, postId int, read bool) error {
+	res, err := tx.Exec("UPDATE post_read SET has_read = ? WHERE user_id = ? AND post_id = ?", read, userId, postId)
+	if err != nil {
+		return err
+	}
+	if updated, _ := res.RowsAffected(); updated > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`
+		INSERT INTO post_read (user_id, post_id, has_read)
+		SELECT ?, ?, ? WHERE EXISTS (SELECT 1 FROM post WHERE id = ?)`, userId, postId, read, postId)
+	return err
+}
@@ -0,0 +1,7 @@
+-- keeps track of the post each user is currently looking at when triaging
+-- their timeline with the keyboard
+CREATE TABLE IF NOT EXISTS triage_cursor (
+    user_id INTEGER PRIMARY KEY,
+    post_id INTEGER NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
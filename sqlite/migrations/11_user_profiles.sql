@@ -0,0 +1,9 @@
+-- public profile information shown on a user's page and blogroll
+ALTER TABLE user ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN homepage TEXT NOT NULL DEFAULT '';
+
+-- an avatar is either uploaded (stored as-is in the db) or pulled from
+-- libravatar, in which case we only keep the hash of the user's email
+ALTER TABLE user ADD COLUMN avatar BLOB;
+ALTER TABLE user ADD COLUMN avatar_content_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE user ADD COLUMN libravatar_hash TEXT NOT NULL DEFAULT '';
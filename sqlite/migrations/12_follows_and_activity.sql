@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS follow (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    follower_id INTEGER NOT NULL,
+    followee_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(follower_id, followee_id)
+);
+
+-- things users did which can be shown to the people following them. The
+-- target is denormalized so that events survive their feed/post being
+-- deleted.
+CREATE TABLE IF NOT EXISTS activity (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    target_url TEXT NOT NULL,
+    target_title TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS activity_user_id_created_at ON activity(user_id, created_at);
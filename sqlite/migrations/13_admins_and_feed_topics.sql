@@ -0,0 +1,13 @@
+-- admins can moderate the instance. There's no UI to become one, use
+-- scripts/set_admin.py
+ALTER TABLE user ADD COLUMN is_admin BOOLEAN NOT NULL DEFAULT 0;
+
+-- coarse topics used to browse discover. Topics are either assigned by an
+-- admin or guessed by heuristics, admin assigned topics always win.
+CREATE TABLE IF NOT EXISTS feed_topic (
+    feed_id INTEGER NOT NULL,
+    topic TEXT NOT NULL,
+    source TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (feed_id, topic)
+);
@@ -0,0 +1,3 @@
+-- feed owners can ask for their feed to not be listed on the most subscribed
+-- feeds leaderboard
+ALTER TABLE feed ADD COLUMN hide_from_leaderboard BOOLEAN NOT NULL DEFAULT 0;
@@ -0,0 +1,17 @@
+-- feeds recommended to each user based on what similar users subscribe to,
+-- recomputed periodically by the stats process
+CREATE TABLE IF NOT EXISTS feed_recommendation (
+    user_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    score INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, feed_id)
+);
+
+-- recommendations a user doesn't want to see again
+CREATE TABLE IF NOT EXISTS dismissed_recommendation (
+    user_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, feed_id)
+);
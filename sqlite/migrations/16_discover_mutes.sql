@@ -0,0 +1,9 @@
+-- feeds and domains a user doesn't want to see on discover. `kind` is either
+-- 'feed' (value is the feed url) or 'domain' (value is a hostname).
+CREATE TABLE IF NOT EXISTS discover_mute (
+    user_id INTEGER NOT NULL,
+    kind TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, kind, value)
+);
@@ -0,0 +1,36 @@
+-- curated bundles of feeds new users can subscribe to in one click. They're
+-- managed by admins from /admin/starter-packs
+CREATE TABLE IF NOT EXISTS starter_pack (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT UNIQUE NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- feeds are kept as plain urls since they might not be known to mire until
+-- someone subscribes to them
+CREATE TABLE IF NOT EXISTS starter_pack_feed (
+    starter_pack_id INTEGER NOT NULL,
+    feed_url TEXT NOT NULL,
+    PRIMARY KEY (starter_pack_id, feed_url)
+);
+
+INSERT INTO starter_pack (slug, name, description) VALUES
+    ('indie-web', 'indie web', 'Small, personal corners of the web.'),
+    ('tech', 'tech', 'People tinkering with computers.'),
+    ('writing', 'writing', 'Essays and notes from people who love to write.');
+
+INSERT INTO starter_pack_feed (starter_pack_id, feed_url)
+SELECT id, 'https://meadow.cafe/feed/' FROM starter_pack WHERE slug = 'indie-web'
+UNION ALL SELECT id, 'https://herman.bearblog.dev/feed/' FROM starter_pack WHERE slug = 'indie-web'
+UNION ALL SELECT id, 'https://lili.bearblog.dev/feed/' FROM starter_pack WHERE slug = 'indie-web'
+UNION ALL SELECT id, 'https://tiramisu.bearblog.dev/feed/' FROM starter_pack WHERE slug = 'indie-web'
+UNION ALL SELECT id, 'https://j3s.sh/feed.atom' FROM starter_pack WHERE slug = 'tech'
+UNION ALL SELECT id, 'https://sizeof.cat/index.xml' FROM starter_pack WHERE slug = 'tech'
+UNION ALL SELECT id, 'https://roytang.net/blog/feed/rss/' FROM starter_pack WHERE slug = 'tech'
+UNION ALL SELECT id, 'https://craigmod.com/index.xml' FROM starter_pack WHERE slug = 'writing'
+UNION ALL SELECT id, 'https://www.visakanv.com/feed/' FROM starter_pack WHERE slug = 'writing'
+UNION ALL SELECT id, 'https://brandonwrites.xyz/feed/' FROM starter_pack WHERE slug = 'writing'
+UNION ALL SELECT id, 'https://reverie.bearblog.dev/feed/' FROM starter_pack WHERE slug = 'writing'
+UNION ALL SELECT id, 'https://aco.bearblog.dev/feed/' FROM starter_pack WHERE slug = 'writing';
@@ -0,0 +1,17 @@
+-- named public collections of feeds curated by users, shown at
+-- /c/{username}/{slug}
+CREATE TABLE IF NOT EXISTS collection (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    slug TEXT NOT NULL,
+    name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, slug)
+);
+
+CREATE TABLE IF NOT EXISTS collection_feed (
+    collection_id INTEGER NOT NULL,
+    feed_url TEXT NOT NULL,
+    PRIMARY KEY (collection_id, feed_url)
+);
@@ -0,0 +1,9 @@
+-- following someone's blogroll adds every feed they subscribe to (now or in
+-- the future) to your timeline. It's resolved at query time, the follower
+-- doesn't get actual subscriptions.
+CREATE TABLE IF NOT EXISTS blogroll_follow (
+    follower_id INTEGER NOT NULL,
+    followee_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (follower_id, followee_id)
+);
@@ -0,0 +1,8 @@
+-- public recommendations of a post, shown on its share page. Unlike
+-- favorites these are visible to everyone.
+CREATE TABLE IF NOT EXISTS post_recommendation (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, post_id)
+);
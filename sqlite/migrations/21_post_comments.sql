@@ -0,0 +1,16 @@
+-- short comments left on a post's share page
+CREATE TABLE IF NOT EXISTS post_comment (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    body TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_comment_post_id ON post_comment(post_id);
+
+-- instance wide settings admins can change at runtime
+CREATE TABLE IF NOT EXISTS site_setting (
+    key TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
@@ -0,0 +1,18 @@
+-- keys users sign their ActivityPub activities with, generated the first time
+-- they're needed
+CREATE TABLE IF NOT EXISTS activitypub_key (
+    user_id INTEGER PRIMARY KEY,
+    private_key TEXT NOT NULL,
+    public_key TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- fediverse accounts following a user. Recommendations get delivered to their
+-- inbox.
+CREATE TABLE IF NOT EXISTS activitypub_follower (
+    user_id INTEGER NOT NULL,
+    actor_id TEXT NOT NULL,
+    inbox TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, actor_id)
+);
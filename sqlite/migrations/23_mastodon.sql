@@ -0,0 +1,18 @@
+-- apps registered on mastodon instances, one per instance and shared by every
+-- user connecting an account on it
+CREATE TABLE IF NOT EXISTS mastodon_app (
+    instance TEXT PRIMARY KEY,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the mastodon account a user connected to share posts with
+CREATE TABLE IF NOT EXISTS mastodon_account (
+    user_id INTEGER PRIMARY KEY,
+    instance TEXT NOT NULL,
+    access_token TEXT NOT NULL,
+    account_name TEXT NOT NULL,
+    toot_template TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
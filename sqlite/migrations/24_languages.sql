@@ -0,0 +1,4 @@
+-- languages are guessed by the reaper when posts are ingested, empty means
+-- we couldn't tell
+ALTER TABLE post ADD COLUMN language TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+-- feeds can be flagged as sensitive (eg. adult content) so people can choose
+-- to blur or hide their posts. Like topics, the flag is either set by an admin
+-- or guessed by heuristics, admins always win.
+ALTER TABLE feed ADD COLUMN sensitive BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE feed ADD COLUMN sensitive_set_by_admin BOOLEAN NOT NULL DEFAULT 0;
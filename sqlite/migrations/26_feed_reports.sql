@@ -0,0 +1,34 @@
+-- people can report feeds to the admins. Reports keep the feed's url instead
+-- of its id so that they outlive the feed if it gets deleted.
+CREATE TABLE IF NOT EXISTS feed_report (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    feed_url TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    resolution TEXT NOT NULL DEFAULT '',
+    resolved_at TIMESTAMP
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_feed_report_open ON feed_report(feed_url, user_id) WHERE resolved_at IS NULL;
+
+-- feeds hidden from discover by an admin, this replaces the hardcoded list of
+-- spammy domains
+ALTER TABLE feed ADD COLUMN hide_from_discover BOOLEAN NOT NULL DEFAULT 0;
+UPDATE feed SET hide_from_discover = 1 WHERE id IN (
+    SELECT DISTINCT feed_id FROM post
+    WHERE url LIKE '%slashdot.org%'
+        OR url LIKE '%thisiscolossal.com%'
+        OR url LIKE '%vox.com%'
+        OR url LIKE '%arstechnica.com%'
+        OR url LIKE '%www.youtube.com%'
+        OR url LIKE '%www.facebook.com%'
+        OR url LIKE '%longreads.com%'
+        OR url LIKE '%nautil.us%'
+        OR url LIKE '%codeberg.org%'
+        OR url LIKE '%finshots.in%'
+        OR url LIKE '%namecoin.org%'
+        OR url LIKE '%kagifeedback.org%'
+        OR url LIKE '%scotthyoung.com%'
+        OR url LIKE '%nesslabs.com%'
+        OR url LIKE '%frame.work%'
+);
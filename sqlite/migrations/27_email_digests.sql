@@ -0,0 +1,8 @@
+-- people can get a digest of their unread posts by email. The token lets them
+-- unsubscribe from a link in the email without logging in.
+CREATE TABLE IF NOT EXISTS email_digest (
+    user_id INTEGER PRIMARY KEY,
+    email TEXT NOT NULL,
+    unsubscribe_token TEXT UNIQUE NOT NULL,
+    last_sent_at TIMESTAMP
+);
@@ -0,0 +1,6 @@
+-- where to email someone's unread posts as an ebook, eg. their
+-- "@kindle.com" address
+CREATE TABLE IF NOT EXISTS kindle_address (
+    user_id INTEGER PRIMARY KEY,
+    email TEXT NOT NULL
+);
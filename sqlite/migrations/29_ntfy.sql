@@ -0,0 +1,10 @@
+-- people can get push notifications on their phone through an ntfy topic when
+-- a favorite feed posts or a post mentions one of their keywords. Posts are
+-- checked in order of id, last_post_id is where the next check starts.
+CREATE TABLE IF NOT EXISTS ntfy_subscription (
+    user_id INTEGER PRIMARY KEY,
+    topic_url TEXT NOT NULL,
+    notify_favorites BOOLEAN NOT NULL DEFAULT 1,
+    keywords TEXT NOT NULL DEFAULT '',
+    last_post_id INTEGER NOT NULL DEFAULT 0
+);
@@ -0,0 +1,11 @@
+-- people can have new posts posted to a Discord channel, either from all the
+-- feeds they're subscribed to (collection_id 0) or from one of their
+-- collections. last_post_id works like it does for ntfy_subscription.
+CREATE TABLE IF NOT EXISTS discord_webhook (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    webhook_url TEXT NOT NULL,
+    collection_id INTEGER NOT NULL DEFAULT 0,
+    last_post_id INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (user_id, collection_id)
+);
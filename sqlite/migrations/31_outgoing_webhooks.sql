@@ -0,0 +1,37 @@
+-- webhooks people set up to get events (see the webhooks package) delivered
+-- to their own URLs. events is a comma separated list, last_post_id works
+-- like it does for ntfy_subscription.
+CREATE TABLE IF NOT EXISTS outgoing_webhook (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    events TEXT NOT NULL,
+    last_post_id INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- every event sent (or to be sent) to a webhook. Failed deliveries are
+-- retried at next_attempt_at until they run out of attempts.
+CREATE TABLE IF NOT EXISTS outgoing_webhook_delivery (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS outgoing_webhook_delivery_due
+ON outgoing_webhook_delivery (status, next_attempt_at);
+
+-- the failing feeds a webhook was already told about, so that a feed_error
+-- event is sent once when a feed starts failing rather than on every refresh
+CREATE TABLE IF NOT EXISTS outgoing_webhook_failing_feed (
+    webhook_id INTEGER NOT NULL,
+    feed_url TEXT NOT NULL,
+    PRIMARY KEY (webhook_id, feed_url)
+);
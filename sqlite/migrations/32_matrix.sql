@@ -0,0 +1,20 @@
+-- people can get notifications in a Matrix room, sent with an access token
+-- of their own account. posts is one of 'all', 'favorites' or 'none',
+-- last_post_id works like it does for ntfy_subscription.
+CREATE TABLE IF NOT EXISTS matrix_notification (
+    user_id INTEGER PRIMARY KEY,
+    homeserver TEXT NOT NULL,
+    access_token TEXT NOT NULL,
+    room_id TEXT NOT NULL,
+    posts TEXT NOT NULL DEFAULT 'favorites',
+    feed_failures BOOLEAN NOT NULL DEFAULT 1,
+    last_post_id INTEGER NOT NULL DEFAULT 0
+);
+
+-- like outgoing_webhook_failing_feed, the failing feeds a user was already
+-- told about in their room
+CREATE TABLE IF NOT EXISTS matrix_failing_feed (
+    user_id INTEGER NOT NULL,
+    feed_url TEXT NOT NULL,
+    PRIMARY KEY (user_id, feed_url)
+);
@@ -0,0 +1,20 @@
+-- keywords people want to hear about. New posts are matched against them as
+-- they're saved, either from every feed on the instance (scope 'all') or only
+-- from the feeds the user is subscribed to (scope 'mine').
+CREATE TABLE IF NOT EXISTS keyword_alert (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    keyword TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT 'mine',
+    notify BOOLEAN NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, keyword)
+);
+
+CREATE TABLE IF NOT EXISTS keyword_alert_match (
+    alert_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    notified BOOLEAN NOT NULL DEFAULT 0,
+    matched_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (alert_id, post_id)
+);
@@ -0,0 +1,7 @@
+-- people can ask to be notified right away when some of their feeds post
+ALTER TABLE subscribe ADD COLUMN notify BOOLEAN NOT NULL DEFAULT 0;
+
+-- where notification emails left off, like ntfy_subscription.last_post_id.
+-- Existing addresses start from now.
+ALTER TABLE email_digest ADD COLUMN notify_last_post_id INTEGER NOT NULL DEFAULT 0;
+UPDATE email_digest SET notify_last_post_id = (SELECT COALESCE(MAX(id), 0) FROM post);
@@ -0,0 +1,9 @@
+-- the instapaper account a user connected to save posts to, with the oauth
+-- token it was exchanged for (their password isn't kept)
+CREATE TABLE IF NOT EXISTS instapaper_account (
+    user_id INTEGER PRIMARY KEY,
+    account_name TEXT NOT NULL,
+    token TEXT NOT NULL,
+    token_secret TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
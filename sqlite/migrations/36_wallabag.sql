@@ -0,0 +1,14 @@
+-- the wallabag instance a user connected to save posts to, with the API
+-- client they created there and the tokens it gave (their password isn't
+-- kept)
+CREATE TABLE IF NOT EXISTS wallabag_account (
+    user_id INTEGER PRIMARY KEY,
+    instance TEXT NOT NULL,
+    client_id TEXT NOT NULL,
+    client_secret TEXT NOT NULL,
+    account_name TEXT NOT NULL,
+    access_token TEXT NOT NULL,
+    refresh_token TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,25 @@
+-- posts a user starred, privately, with an optional passage they want to
+-- remember and a note. The post's details are copied so that stars outlive
+-- the post, which is deleted when nobody is subscribed to its feed anymore.
+CREATE TABLE IF NOT EXISTS post_star (
+    user_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    feed_url TEXT NOT NULL,
+    quote TEXT NOT NULL DEFAULT '',
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    -- whether the star was sent to readwise since it last changed
+    readwise_synced BOOLEAN NOT NULL DEFAULT 0,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- the readwise account a user connected to send their stars to
+CREATE TABLE IF NOT EXISTS readwise_token (
+    user_id INTEGER PRIMARY KEY,
+    token TEXT NOT NULL,
+    last_synced_at TIMESTAMP,
+    last_error TEXT NOT NULL DEFAULT ''
+);
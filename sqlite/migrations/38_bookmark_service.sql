@@ -0,0 +1,12 @@
+-- the linkding or shaarli instance a user connected, where a bookmark is
+-- created for every post they star
+CREATE TABLE IF NOT EXISTS bookmark_service (
+    user_id INTEGER PRIMARY KEY,
+    service TEXT NOT NULL,
+    instance TEXT NOT NULL,
+    -- the API token for linkding, the API secret for shaarli
+    token TEXT NOT NULL,
+    -- space separated
+    tags TEXT NOT NULL DEFAULT '',
+    last_error TEXT NOT NULL DEFAULT ''
+);
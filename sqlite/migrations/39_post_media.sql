@@ -0,0 +1,4 @@
+-- thumbnail and length (in seconds) of the video or audio a post is about,
+-- for feeds that say (youtube, podcasts). Empty and 0 when unknown.
+ALTER TABLE post ADD COLUMN thumbnail_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE post ADD COLUMN duration INTEGER NOT NULL DEFAULT 0;
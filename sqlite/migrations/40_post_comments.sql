@@ -0,0 +1,6 @@
+-- where a post is discussed, and the article it's about when that's not its
+-- url, for posts of link aggregators (reddit, hacker news). Reddit posts are
+-- their discussion, their url tells them apart when several link to the same
+-- article. Empty when there's none.
+ALTER TABLE post ADD COLUMN comments_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE post ADD COLUMN article_url TEXT NOT NULL DEFAULT '';
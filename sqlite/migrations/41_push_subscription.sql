@@ -0,0 +1,13 @@
+-- browsers people turned on Web Push notifications in, one row per browser.
+-- endpoint is where the browser's push service accepts messages, p256dh and
+-- auth are the keys they're encrypted with. last_post_id works like it does
+-- for ntfy_subscription.
+CREATE TABLE IF NOT EXISTS push_subscription (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    endpoint TEXT NOT NULL UNIQUE,
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    last_post_id INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,23 @@
+-- apps people signed in to with IndieAuth (like Microsub readers). A code is
+-- what the app gets after people approve it, it's redeemed once for a token
+-- within a few minutes. code_challenge is the app's PKCE challenge.
+CREATE TABLE IF NOT EXISTS indieauth_code (
+    code TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    client_id TEXT NOT NULL,
+    redirect_uri TEXT NOT NULL,
+    code_challenge TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the tokens apps act on behalf of people with, until they're revoked
+CREATE TABLE IF NOT EXISTS indieauth_token (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    client_id TEXT NOT NULL,
+    scope TEXT NOT NULL DEFAULT '',
+    token TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP
+);
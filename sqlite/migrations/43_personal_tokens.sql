@@ -0,0 +1,3 @@
+-- tokens people create themselves, for automation platforms like Zapier that
+-- can't sign in with IndieAuth. They have a name instead of a client_id.
+ALTER TABLE indieauth_token ADD COLUMN name TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,11 @@
+-- new posts posted to a Slack channel, like discord_webhook. Admins can set up
+-- one for the whole instance (user_id 0), which gets the posts of every feed
+-- on the instance, for teams reading together.
+CREATE TABLE IF NOT EXISTS slack_webhook (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    webhook_url TEXT NOT NULL,
+    collection_id INTEGER NOT NULL DEFAULT 0,
+    last_post_id INTEGER NOT NULL DEFAULT 0,
+    UNIQUE (user_id, collection_id)
+);
@@ -0,0 +1,5 @@
+-- what feeds say about themselves, as of their last successful fetch, so that
+-- pages can show it before the reaper fetches them again after a restart
+ALTER TABLE feed ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE feed ADD COLUMN link TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,22 @@
+-- posts old enough to be archived, moved out of post so that timelines only
+-- go through recent posts. They keep their ids, reads and stars of archived
+-- posts still point at them.
+CREATE TABLE IF NOT EXISTS post_archive (
+    id INTEGER PRIMARY KEY,
+    feed_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    published_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP,
+    word_count INTEGER NOT NULL DEFAULT 0,
+    language TEXT NOT NULL DEFAULT '',
+    thumbnail_url TEXT NOT NULL DEFAULT '',
+    duration INTEGER NOT NULL DEFAULT 0,
+    comments_url TEXT NOT NULL DEFAULT '',
+    article_url TEXT NOT NULL DEFAULT '',
+    archived_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(feed_id, url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_archive_published_at ON post_archive(published_at);
+CREATE INDEX IF NOT EXISTS idx_post_published_at ON post(published_at);
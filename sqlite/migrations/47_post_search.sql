@@ -0,0 +1,28 @@
+-- full text index of the titles of posts, archived ones included. rowid is
+-- the id of the post. The triggers keep it up to date as posts are saved,
+-- renamed and deleted, it's only ever rebuilt by hand (see ReindexPostSearch).
+CREATE VIRTUAL TABLE IF NOT EXISTS post_search USING fts5(title);
+
+CREATE TRIGGER IF NOT EXISTS post_search_insert AFTER INSERT ON post BEGIN
+    INSERT INTO post_search (rowid, title) VALUES (new.id, new.title);
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_update AFTER UPDATE OF title ON post BEGIN
+    UPDATE post_search SET title = new.title WHERE rowid = new.id;
+END;
+
+-- archived posts are copied to post_archive before they're deleted from
+-- post, with the same id, they stay in the index
+CREATE TRIGGER IF NOT EXISTS post_search_delete AFTER DELETE ON post
+WHEN NOT EXISTS (SELECT 1 FROM post_archive WHERE id = old.id) BEGIN
+    DELETE FROM post_search WHERE rowid = old.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_archive_search_delete AFTER DELETE ON post_archive BEGIN
+    DELETE FROM post_search WHERE rowid = old.id;
+END;
+
+INSERT INTO post_search (rowid, title)
+SELECT id, title FROM post
+UNION ALL
+SELECT id, title FROM post_archive;
@@ -0,0 +1,34 @@
+-- the domain mire shows for a post, see URLDomain, so that it's not parsed out
+-- of the url every time the post is shown or filtered on
+ALTER TABLE post ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+ALTER TABLE post_archive ADD COLUMN domain TEXT NOT NULL DEFAULT '';
+
+-- existing posts get theirs from their url: drop the scheme, then everything
+-- from the path, query or fragment on, then the user and port
+UPDATE post SET domain = lower(CASE WHEN instr(url, '://') > 0 THEN substr(url, instr(url, '://') + 3) ELSE url END);
+UPDATE post SET domain = substr(domain, 1, instr(domain, '/') - 1) WHERE instr(domain, '/') > 0;
+UPDATE post SET domain = substr(domain, 1, instr(domain, '?') - 1) WHERE instr(domain, '?') > 0;
+UPDATE post SET domain = substr(domain, 1, instr(domain, '#') - 1) WHERE instr(domain, '#') > 0;
+UPDATE post SET domain = substr(domain, instr(domain, '@') + 1) WHERE instr(domain, '@') > 0;
+UPDATE post SET domain = substr(domain, 1, instr(domain, ':') - 1) WHERE instr(domain, ':') > 0 AND domain NOT LIKE '[%';
+
+UPDATE post_archive SET domain = lower(CASE WHEN instr(url, '://') > 0 THEN substr(url, instr(url, '://') + 3) ELSE url END);
+UPDATE post_archive SET domain = substr(domain, 1, instr(domain, '/') - 1) WHERE instr(domain, '/') > 0;
+UPDATE post_archive SET domain = substr(domain, 1, instr(domain, '?') - 1) WHERE instr(domain, '?') > 0;
+UPDATE post_archive SET domain = substr(domain, 1, instr(domain, '#') - 1) WHERE instr(domain, '#') > 0;
+UPDATE post_archive SET domain = substr(domain, instr(domain, '@') + 1) WHERE instr(domain, '@') > 0;
+UPDATE post_archive SET domain = substr(domain, 1, instr(domain, ':') - 1) WHERE instr(domain, ':') > 0 AND domain NOT LIKE '[%';
+
+-- medium posts are shown by their author's page, medium.com/@someone
+UPDATE post SET domain = 'medium.com/' || (
+    SELECT CASE WHEN instr(author, '/') > 0 THEN substr(author, 1, instr(author, '/') - 1) ELSE author END
+    FROM (SELECT substr(url, instr(url, '/@') + 1) AS author))
+WHERE (domain = 'medium.com' OR domain LIKE '%.medium.com') AND instr(url, '/@') > 0;
+UPDATE post_archive SET domain = 'medium.com/' || (
+    SELECT CASE WHEN instr(author, '/') > 0 THEN substr(author, 1, instr(author, '/') - 1) ELSE author END
+    FROM (SELECT substr(url, instr(url, '/@') + 1) AS author))
+WHERE (domain = 'medium.com' OR domain LIKE '%.medium.com') AND instr(url, '/@') > 0;
+UPDATE post SET domain = substr(domain, 1, instr(domain, '?') - 1) WHERE domain LIKE 'medium.com/%' AND instr(domain, '?') > 0;
+UPDATE post_archive SET domain = substr(domain, 1, instr(domain, '?') - 1) WHERE domain LIKE 'medium.com/%' AND instr(domain, '?') > 0;
+
+CREATE INDEX IF NOT EXISTS idx_post_domain ON post(domain);
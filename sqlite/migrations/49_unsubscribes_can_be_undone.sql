@@ -0,0 +1,13 @@
+-- subscriptions people removed lately, kept for a while so that they can be
+-- undone: the feed, its posts and what they read of it stay until then
+CREATE TABLE IF NOT EXISTS unsubscribe (
+    user_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    is_favorite BOOLEAN NOT NULL DEFAULT 0,
+    notify BOOLEAN NOT NULL DEFAULT 0,
+    unsubscribed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, feed_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_unsubscribe_unsubscribed_at ON unsubscribe(unsubscribed_at);
+CREATE INDEX IF NOT EXISTS idx_unsubscribe_feed_id ON unsubscribe(feed_id);
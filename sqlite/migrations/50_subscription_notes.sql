@@ -0,0 +1,3 @@
+-- a few words people keep about their subscriptions, only they see them
+ALTER TABLE subscribe ADD COLUMN note TEXT NOT NULL DEFAULT '';
+ALTER TABLE unsubscribe ADD COLUMN note TEXT NOT NULL DEFAULT '';
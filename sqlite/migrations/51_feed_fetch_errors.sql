@@ -0,0 +1,14 @@
+-- what happened the last times fetching a feed failed, and when it worked
+-- again (an empty error), so that a hiccup can be told from a broken feed
+CREATE TABLE IF NOT EXISTS feed_fetch_error (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    feed_id INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_feed_fetch_error_feed_id ON feed_fetch_error(feed_id, id);
+
+-- the errors feeds have now are where their history starts
+INSERT INTO feed_fetch_error (feed_id, error)
+SELECT id, fetch_error FROM feed WHERE fetch_error IS NOT NULL AND fetch_error != '';
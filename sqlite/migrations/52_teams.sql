@@ -0,0 +1,41 @@
+-- teams are small groups reading the same feeds: every member reads the
+-- team's feeds, with their own read state, and sees the posts any of them
+-- starred for the team
+CREATE TABLE IF NOT EXISTS team (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    owner_id INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS team_member (
+    team_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    joined_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_member_user_id ON team_member(user_id);
+
+CREATE TABLE IF NOT EXISTS team_feed (
+    team_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    added_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (team_id, feed_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_team_feed_feed_id ON team_feed(feed_id);
+
+-- like post_star, the post's details are copied so that the star outlives
+-- the post
+CREATE TABLE IF NOT EXISTS team_star (
+    team_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    user_id INTEGER NOT NULL,
+    title TEXT NOT NULL,
+    url TEXT NOT NULL,
+    feed_url TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (team_id, post_id)
+);
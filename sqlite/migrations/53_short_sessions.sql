@@ -0,0 +1,9 @@
+-- the sessions of people who didn't ask to be remembered when they logged in,
+-- they expire. The ones who did use user.session_token.
+CREATE TABLE IF NOT EXISTS short_session (
+    token TEXT PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_short_session_expires_at ON short_session(expires_at);
@@ -0,0 +1,4 @@
+-- what people call the feeds they're subscribed to, when they'd rather not go
+-- by the feed's own title. Only they see it.
+ALTER TABLE subscribe ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE unsubscribe ADD COLUMN title TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,17 @@
+-- rules people set to mark read or hide the posts whose title matches, in
+-- one of their feeds or all of them (feed_url is '' then). They apply to
+-- posts as they're saved, and to the unread ones when a rule is added.
+CREATE TABLE IF NOT EXISTS filter_rule (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    feed_url TEXT NOT NULL DEFAULT '',
+    match TEXT NOT NULL,
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_filter_rule_user_id ON filter_rule(user_id);
+
+-- hidden posts are read too, and left out of the timelines
+ALTER TABLE post_read ADD COLUMN hidden BOOLEAN NOT NULL DEFAULT 0;
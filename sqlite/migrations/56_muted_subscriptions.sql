@@ -0,0 +1,4 @@
+-- muted feeds are still subscribed to, with what was read of them, but stay
+-- out of the timeline and the unread count until they're unmuted
+ALTER TABLE subscribe ADD COLUMN is_muted BOOLEAN NOT NULL DEFAULT 0;
+ALTER TABLE unsubscribe ADD COLUMN is_muted BOOLEAN NOT NULL DEFAULT 0;
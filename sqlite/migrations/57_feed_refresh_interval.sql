@@ -0,0 +1,3 @@
+-- how long after being fetched a feed is fetched again, in seconds, or 0 for
+-- the reaper's default
+ALTER TABLE feed ADD COLUMN refresh_interval INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,6 @@
+-- the url feeds share with the other urls of the same feed, see
+-- feedurl.Canonical. It's filled in (and the duplicate feeds merged) when
+-- mire starts, since it's computed in go.
+ALTER TABLE feed ADD COLUMN canonical_url TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_feed_canonical_url ON feed(canonical_url);
@@ -0,0 +1,14 @@
+-- how many times in a row fetching a feed failed, and since when, to tell
+-- the feeds that are probably dead from the ones having a bad day
+ALTER TABLE feed ADD COLUMN fetch_failures INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE feed ADD COLUMN failing_since TIMESTAMP;
+
+-- feeds failing now have been since their first error after they last
+-- worked, as far as their history goes back
+UPDATE feed SET fetch_failures = 1, failing_since = COALESCE((
+    SELECT MIN(e.created_at) FROM feed_fetch_error e
+    WHERE e.feed_id = feed.id AND e.id > COALESCE((
+        SELECT MAX(ok.id) FROM feed_fetch_error ok
+        WHERE ok.feed_id = feed.id AND ok.error = ''), 0)
+), CURRENT_TIMESTAMP)
+WHERE fetch_error IS NOT NULL AND fetch_error != '';
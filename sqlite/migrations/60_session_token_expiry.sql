@@ -0,0 +1,3 @@
+-- when lasting session tokens end, like short sessions do. The ones from
+-- before they did are given one when mire starts, see LimitSessionTokens.
+ALTER TABLE user ADD COLUMN session_expires_at TIMESTAMP;
@@ -0,0 +1,3 @@
+-- used to estimate how long a post takes to read. Posts saved before this
+-- migration have an unknown (0) word count.
+ALTER TABLE post ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,73 @@
+package sqlite
+
+// kinds of discover mutes
+const (
+	MuteKindFeed   = "feed"
+	MuteKindDomain = "domain"
+)
+
+// DiscoverMute is a feed or a domain a user has hidden from their discover
+type DiscoverMute struct {
+	Kind  string
+	Value string
+}
+
+// discoverMuteClause leaves out the posts muted by a user, it expects the post
+// and feed tables to be aliased as `p` and `f` and takes the username as its
+// only argument.
+const discoverMuteClause = ` AND NOT EXISTS (
+			SELECT 1 FROM discover_mute m JOIN user u ON m.user_id = u.id
+			WHERE u.username = ? AND (
+				(m.kind = 'feed' AND m.value = f.url)
+				OR (m.kind = 'domain' AND (p.domain = m.value OR p.domain LIKE '%.' || m.value OR p.domain LIKE m.value || '/%'))
+			))`
+
+// AddDiscoverMute hides a feed or domain from the user's discover
+func (db *DB) AddDiscoverMute(username string, kind string, value string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(
+		"INSERT OR IGNORE INTO discover_mute (user_id, kind, value) VALUES (?, ?, ?)",
+		userId, kind, value)
+	unlock()
+
+	return err
+}
+
+// RemoveDiscoverMute shows a previously muted feed or domain again
+func (db *DB) RemoveDiscoverMute(username string, kind string, value string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(
+		"DELETE FROM discover_mute WHERE user_id = ? AND kind = ? AND value = ?",
+		userId, kind, value)
+	unlock()
+
+	return err
+}
+
+// GetDiscoverMutes returns everything a user has muted on discover
+func (db *DB) GetDiscoverMutes(username string) ([]*DiscoverMute, error) {
+	rows, err := db.sql.Query(`
+		SELECT m.kind, m.value
+		FROM discover_mute m
+		JOIN user u ON m.user_id = u.id
+		WHERE u.username = ?
+		ORDER BY m.kind, m.value`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var mutes []*DiscoverMute
+	for rows.Next() {
+		var m DiscoverMute
+		if err := rows.Scan(&m.Kind, &m.Value); err != nil {
+			return nil, err
+		}
+		mutes = append(mutes, &m)
+	}
+	return mutes, rows.Err()
+}
@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+)
+
+// NewFeed is a feed somebody on the instance subscribed to for the first time
+// recently, along with its latest post.
+type NewFeed struct {
+	URL               string
+	FirstSubscribedAt time.Time
+	LatestPost        *Post
+}
+
+// GetNewFeeds returns the feeds first subscribed to in the last `windowDays`
+// days, newest first. Feeds without any posts yet and feeds hidden from
+// discover are left out.
+func (db *DB) GetNewFeeds(windowDays int, limit int) ([]*NewFeed, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, MIN(s.created_at) AS first_subscribed, f.sensitive,
+			p.id, p.title, p.url, p.domain, p.published_at, p.word_count
+		FROM feed f
+		JOIN subscribe s ON s.feed_id = f.id
+		JOIN post p ON p.id = (
+			SELECT id FROM post WHERE feed_id = f.id ORDER BY published_at DESC LIMIT 1)
+		WHERE f.hide_from_discover = 0
+		GROUP BY f.id
+		HAVING first_subscribed >= datetime('now', ?)
+		ORDER BY first_subscribed DESC
+		LIMIT ?`, fmt.Sprintf("-%d days", windowDays), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*NewFeed
+	for rows.Next() {
+		var f NewFeed
+		var p Post
+		var firstSubscribed, publishedTime string
+		err = rows.Scan(&f.URL, &firstSubscribed, &p.Sensitive, &p.ID, &p.Title, &p.URL, &p.Domain, &publishedTime, &p.WordCount)
+		if err != nil {
+			return nil, err
+		}
+
+		f.FirstSubscribedAt, err = db.TryParseDate(firstSubscribed)
+		if err != nil {
+			return nil, err
+		}
+		p.PublishedDatetime, err = db.TryParseDate(publishedTime)
+		if err != nil {
+			return nil, err
+		}
+
+		p.FeedURL = f.URL
+		f.LatestPost = &p
+		feeds = append(feeds, &f)
+	}
+	return feeds, rows.Err()
+}
@@ -0,0 +1,61 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+// NotificationPost is a new post that might be worth a notification
+type NotificationPost struct {
+	ID                int
+	Title             string
+	URL               string
+	PublishedDatetime time.Time
+	FeedURL           string
+	IsFavorite        bool
+
+	// whether the user asked to be notified about every post of the feed
+	Notify bool
+}
+
+func scanNotificationPosts(rows *sql.Rows) ([]*NotificationPost, error) {
+	var posts []*NotificationPost
+	for rows.Next() {
+		var p NotificationPost
+		err := rows.Scan(&p.ID, &p.Title, &p.URL, &p.PublishedDatetime, &p.FeedURL, &p.IsFavorite, &p.Notify)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &p)
+	}
+	return posts, rows.Err()
+}
+
+// GetLatestPostID returns the id of the newest post, or 0 if there are none.
+// Post ids only go up, notifications remember the last one they looked at.
+func (db *DB) GetLatestPostID() (int, error) {
+	var id int
+	err := db.sql.QueryRow("SELECT COALESCE(MAX(id), 0) FROM post").Scan(&id)
+	return id, err
+}
+
+// GetNewSubscribedPosts returns the posts saved after afterPostId, up to and
+// including upToPostId, in the feeds a user is subscribed to, oldest first
+func (db *DB) GetNewSubscribedPosts(username string, afterPostId int, upToPostId int, limit int) ([]*NotificationPost, error) {
+	userId := db.GetUserID(username)
+
+	rows, err := db.sql.Query(`
+		SELECT p.id, p.title, p.url, p.published_at, f.url, s.is_favorite, s.notify
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		JOIN subscribe s ON f.id = s.feed_id
+		WHERE s.user_id = ? AND p.id > ? AND p.id <= ?
+		ORDER BY p.id ASC
+		LIMIT ?`, userId, afterPostId, upToPostId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotificationPosts(rows)
+}
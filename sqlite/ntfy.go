@@ -0,0 +1,105 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+)
+
+type NtfySubscription struct {
+	Username        string
+	TopicURL        string
+	NotifyFavorites bool
+	Keywords        []string
+	LastPostID      int
+}
+
+// SetNtfySubscription sets where and when a user gets push notifications.
+// Only posts saved from now on are notified about.
+func (db *DB) SetNtfySubscription(username string, topicURL string, notifyFavorites bool, keywords []string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO ntfy_subscription (user_id, topic_url, notify_favorites, keywords, last_post_id)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(user_id) DO UPDATE SET
+			topic_url = excluded.topic_url,
+			notify_favorites = excluded.notify_favorites,
+			keywords = excluded.keywords`,
+		userId, topicURL, notifyFavorites, strings.Join(keywords, "\n"))
+	unlock()
+
+	return err
+}
+
+func (db *DB) RemoveNtfySubscription(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM ntfy_subscription WHERE user_id = ?", userId)
+	unlock()
+
+	return err
+}
+
+const ntfySubscriptionColumns = `u.username, n.topic_url, n.notify_favorites, n.keywords, n.last_post_id`
+
+func scanNtfySubscription(row interface{ Scan(...any) error }) (*NtfySubscription, error) {
+	var sub NtfySubscription
+	var keywords string
+	err := row.Scan(&sub.Username, &sub.TopicURL, &sub.NotifyFavorites, &keywords, &sub.LastPostID)
+	if err != nil {
+		return nil, err
+	}
+	if keywords != "" {
+		sub.Keywords = strings.Split(keywords, "\n")
+	}
+	return &sub, nil
+}
+
+// GetNtfySubscription returns how a user gets push notifications, or nil if
+// they don't
+func (db *DB) GetNtfySubscription(username string) (*NtfySubscription, error) {
+	sub, err := scanNtfySubscription(db.sql.QueryRow(`
+		SELECT `+ntfySubscriptionColumns+`
+		FROM ntfy_subscription n
+		JOIN user u ON n.user_id = u.id
+		WHERE u.username = ?`, username))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return sub, err
+}
+
+func (db *DB) GetNtfySubscriptions() ([]*NtfySubscription, error) {
+	rows, err := db.sql.Query(`
+		SELECT ` + ntfySubscriptionColumns + `
+		FROM ntfy_subscription n
+		JOIN user u ON n.user_id = u.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*NtfySubscription
+	for rows.Next() {
+		sub, err := scanNtfySubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// SetNtfyLastPostID moves the point where the next check for a user's
+// notifications starts
+func (db *DB) SetNtfyLastPostID(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE ntfy_subscription SET last_post_id = ? WHERE user_id = ?", postId, userId)
+	unlock()
+
+	return err
+}
@@ -0,0 +1,293 @@
+package sqlite
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+type OutgoingWebhook struct {
+	ID         int
+	Username   string
+	URL        string
+	Secret     string
+	Events     []string
+	LastPostID int
+}
+
+func (w *OutgoingWebhook) HasEvent(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// status of an outgoing webhook delivery
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliveryDelivered = "delivered"
+	WebhookDeliveryFailed    = "failed"
+)
+
+type WebhookDelivery struct {
+	ID        int
+	WebhookID int
+	URL       string
+	Secret    string
+	Event     string
+	Payload   string
+	Status    string
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+}
+
+// AddOutgoingWebhook sets up a new webhook for a user. It's only told about
+// posts saved, and feeds that start failing, from now on.
+func (db *DB) AddOutgoingWebhook(username string, url string, secret string, events []string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO outgoing_webhook (user_id, url, secret, events, last_post_id)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))`,
+		userId, url, secret, strings.Join(events, ","))
+	if err != nil {
+		return err
+	}
+	webhookId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO outgoing_webhook_failing_feed (webhook_id, feed_url)
+		SELECT ?, f.url FROM feed f
+		JOIN subscribe s ON f.id = s.feed_id
+		WHERE s.user_id = ? AND f.fetch_error IS NOT NULL AND f.fetch_error != ''`, webhookId, userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// RemoveOutgoingWebhook removes one of the user's webhooks along with the
+// deliveries it still had to make
+func (db *DB) RemoveOutgoingWebhook(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM outgoing_webhook WHERE id = ? AND user_id = ?", id, userId)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	for _, table := range []string{"outgoing_webhook_delivery", "outgoing_webhook_failing_feed"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE webhook_id = ?", id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) queryOutgoingWebhooks(where string, args ...any) ([]*OutgoingWebhook, error) {
+	rows, err := db.sql.Query(`
+		SELECT w.id, u.username, w.url, w.secret, w.events, w.last_post_id
+		FROM outgoing_webhook w
+		JOIN user u ON w.user_id = u.id
+		`+where+`
+		ORDER BY w.id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*OutgoingWebhook
+	for rows.Next() {
+		var w OutgoingWebhook
+		var events string
+		err = rows.Scan(&w.ID, &w.Username, &w.URL, &w.Secret, &events, &w.LastPostID)
+		if err != nil {
+			return nil, err
+		}
+		if events != "" {
+			w.Events = strings.Split(events, ",")
+		}
+		webhooks = append(webhooks, &w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (db *DB) GetUserOutgoingWebhooks(username string) ([]*OutgoingWebhook, error) {
+	return db.queryOutgoingWebhooks("WHERE u.username = ?", username)
+}
+
+func (db *DB) GetOutgoingWebhooks() ([]*OutgoingWebhook, error) {
+	return db.queryOutgoingWebhooks("")
+}
+
+func (db *DB) SetOutgoingWebhookLastPostID(webhookId int, postId int) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE outgoing_webhook SET last_post_id = ? WHERE id = ?", postId, webhookId)
+	unlock()
+
+	return err
+}
+
+type FailingFeed struct {
+	URL   string
+	Error string
+}
+
+// GetNewlyFailingFeeds returns the feeds a webhook's user is subscribed to
+// that are failing and that the webhook wasn't told about yet
+func (db *DB) GetNewlyFailingFeeds(webhookId int) ([]*FailingFeed, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, f.fetch_error
+		FROM feed f
+		JOIN subscribe s ON f.id = s.feed_id
+		JOIN outgoing_webhook w ON s.user_id = w.user_id
+		WHERE w.id = ? AND f.fetch_error IS NOT NULL AND f.fetch_error != ''
+		AND f.url NOT IN (SELECT feed_url FROM outgoing_webhook_failing_feed WHERE webhook_id = w.id)`, webhookId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanFailingFeeds(rows)
+}
+
+func (db *DB) MarkFeedFailureReported(webhookId int, feedURL string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO outgoing_webhook_failing_feed (webhook_id, feed_url) VALUES (?, ?)
+		ON CONFLICT DO NOTHING`, webhookId, feedURL)
+	unlock()
+
+	return err
+}
+
+// ForgetRecoveredFeeds forgets about the failures of feeds that work again,
+// so that the webhook is told if they break again
+func (db *DB) ForgetRecoveredFeeds(webhookId int) error {
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM outgoing_webhook_failing_feed
+		WHERE webhook_id = ? AND feed_url NOT IN (
+			SELECT url FROM feed WHERE fetch_error IS NOT NULL AND fetch_error != ''
+		)`, webhookId)
+	unlock()
+
+	return err
+}
+
+// QueueWebhookDelivery schedules an event to be delivered to a webhook as
+// soon as possible
+func (db *DB) QueueWebhookDelivery(webhookId int, event string, payload string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO outgoing_webhook_delivery (webhook_id, event, payload, next_attempt_at)
+		VALUES (?, ?, ?, ?)`, webhookId, event, payload, time.Now().UTC())
+	unlock()
+
+	return err
+}
+
+// GetDueWebhookDeliveries returns the pending deliveries that should be
+// attempted by now, oldest first
+func (db *DB) GetDueWebhookDeliveries(now time.Time, limit int) ([]*WebhookDelivery, error) {
+	rows, err := db.sql.Query(`
+		SELECT d.id, d.webhook_id, w.url, w.secret, d.event, d.payload, d.status, d.attempts, d.last_error, d.created_at
+		FROM outgoing_webhook_delivery d
+		JOIN outgoing_webhook w ON d.webhook_id = w.id
+		WHERE d.status = ? AND d.next_attempt_at <= ?
+		ORDER BY d.id ASC
+		LIMIT ?`, WebhookDeliveryPending, now.UTC(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+// GetRecentWebhookDeliveries returns the latest deliveries to a user's
+// webhooks, newest first
+func (db *DB) GetRecentWebhookDeliveries(username string, limit int) ([]*WebhookDelivery, error) {
+	rows, err := db.sql.Query(`
+		SELECT d.id, d.webhook_id, w.url, '', d.event, d.payload, d.status, d.attempts, d.last_error, d.created_at
+		FROM outgoing_webhook_delivery d
+		JOIN outgoing_webhook w ON d.webhook_id = w.id
+		JOIN user u ON w.user_id = u.id
+		WHERE u.username = ?
+		ORDER BY d.id DESC
+		LIMIT ?`, username, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanWebhookDeliveries(rows)
+}
+
+func scanWebhookDeliveries(rows *sql.Rows) ([]*WebhookDelivery, error) {
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.Event, &d.Payload, &d.Status, &d.Attempts, &d.LastError, &d.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, &d)
+	}
+	return deliveries, rows.Err()
+}
+
+// RecordWebhookDeliveryAttempt saves how an attempt at a delivery went. A
+// pending delivery is retried at nextAttemptAt.
+func (db *DB) RecordWebhookDeliveryAttempt(deliveryId int, status string, nextAttemptAt time.Time, lastError string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		UPDATE outgoing_webhook_delivery
+		SET status = ?, attempts = attempts + 1, next_attempt_at = ?, last_error = ?
+		WHERE id = ?`, status, nextAttemptAt.UTC(), lastError, deliveryId)
+	unlock()
+
+	return err
+}
+
+// DeleteOldWebhookDeliveries forgets about the deliveries that are done with
+// (delivered or failed for good) and older than a given time
+func (db *DB) DeleteOldWebhookDeliveries(before time.Time) error {
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM outgoing_webhook_delivery
+		WHERE status != ? AND created_at < ?`, WebhookDeliveryPending, before.UTC())
+	unlock()
+
+	return err
+}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"strings"
+	"time"
+)
+
+// the columns post and post_archive share
+const archivedPostColumns = "id, feed_id, title, url, published_at, created_at, word_count, language, thumbnail_url, duration, comments_url, article_url, domain"
+
+// ArchivePosts moves up to limit posts published before olderThan from post
+// to post_archive, oldest first, and returns how many it moved. Posts someone
+// starred, commented on or recommended stay, their pages link to them by id.
+func (db *DB) ArchivePosts(olderThan time.Time, limit int) (int, error) {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id FROM post
+		WHERE published_at < ?
+			AND id NOT IN (SELECT post_id FROM post_star)
+			AND id NOT IN (SELECT post_id FROM team_star)
+			AND id NOT IN (SELECT post_id FROM post_comment)
+			AND id NOT IN (SELECT post_id FROM post_recommendation)
+		ORDER BY published_at ASC
+		LIMIT ?`, olderThan, limit)
+	if err != nil {
+		return 0, err
+	}
+	var ids []any
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	in := "(" + strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",") + ")"
+	_, err = tx.Exec(`
+		INSERT INTO post_archive (`+archivedPostColumns+`)
+		SELECT `+archivedPostColumns+` FROM post WHERE id IN `+in, ids...)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec("DELETE FROM post WHERE id IN "+in, ids...)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	// archived posts don't count as unread anymore
+	db.unreadCounts.forgetAll()
+
+	return len(ids), nil
+}
+
+// GetNumArchivedPosts returns how many posts were archived
+func (db *DB) GetNumArchivedPosts() (int, error) {
+	var count int
+	err := db.sql.QueryRow("SELECT COUNT(*) FROM post_archive").Scan(&count)
+	return count, err
+}
+
+// SearchArchivedPosts returns the archived posts of the feeds a user is
+// subscribed to whose title has the words of query, the most recent first
+func (db *DB) SearchArchivedPosts(username string, query string, limit int) ([]*Post, error) {
+	userId := db.GetUserID(username)
+
+	match := searchQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	rows, err := db.sql.Query(`
+		SELECT pa.id, pa.title, pa.url, f.url, pa.published_at, pa.word_count, pa.language, pa.thumbnail_url, pa.duration, pa.comments_url, pa.article_url
+		FROM post_search ps
+		JOIN post_archive pa ON pa.id = ps.rowid
+		JOIN feed f ON f.id = pa.feed_id
+		JOIN subscribe s ON s.feed_id = pa.feed_id
+		WHERE post_search MATCH ? AND s.user_id = ?
+		ORDER BY pa.published_at DESC
+		LIMIT ?`, match, userId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*Post
+	for rows.Next() {
+		var post Post
+		err = rows.Scan(&post.ID, &post.Title, &post.URL, &post.FeedURL, &post.PublishedDatetime, &post.WordCount,
+			&post.Language, &post.ThumbnailURL, &post.Duration, &post.CommentsURL, &post.ArticleURL)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,32 @@
+package sqlite
+
+import (
+	"net/url"
+	"strings"
+)
+
+// URLDomain does a best-effort parse of a URL and returns the domain mire
+// shows for it: its hostname, lowercased, or the author's page for medium
+// posts. Posts store theirs when they're saved.
+func URLDomain(rawURL string) string {
+	parsedURL, err := url.Parse(rawURL)
+	if err == nil {
+		hostname := strings.ToLower(parsedURL.Hostname())
+		if hostname == "medium.com" || strings.HasSuffix(hostname, ".medium.com") {
+			// Handle Medium URLs
+			pathSegments := strings.Split(parsedURL.Path, "/")
+			for _, segment := range pathSegments {
+				if len(segment) > 0 && segment[0] == '@' {
+					return "medium.com/" + segment
+				}
+			}
+		}
+		return hostname
+	}
+	// do our best to trim it manually if url parsing fails
+	trimmedStr := strings.TrimSpace(rawURL)
+	trimmedStr = strings.TrimPrefix(trimmedStr, "http://")
+	trimmedStr = strings.TrimPrefix(trimmedStr, "https://")
+
+	return strings.ToLower(strings.Split(trimmedStr, "/")[0])
+}
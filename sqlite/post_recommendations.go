@@ -0,0 +1,128 @@
+package sqlite
+
+import (
+	"time"
+)
+
+func (db *DB) RecommendPost(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO post_recommendation (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT(user_id, post_id) DO NOTHING`, userId, postId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) UnrecommendPost(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM post_recommendation WHERE user_id=? AND post_id=?", userId, postId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) IsPostRecommendedBy(username string, postId int) (bool, error) {
+	var exists bool
+	err := db.sql.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM post_recommendation pr
+			JOIN user u ON pr.user_id = u.id
+			WHERE u.username = ? AND pr.post_id = ?
+		)`, username, postId).Scan(&exists)
+
+	return exists, err
+}
+
+// GetPostRecommenders returns the usernames of everyone who publicly
+// recommended the given post, most recent first
+func (db *DB) GetPostRecommenders(postId int) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT u.username
+		FROM post_recommendation pr
+		JOIN user u ON pr.user_id = u.id
+		WHERE pr.post_id = ?
+		ORDER BY pr.created_at DESC, u.username`, postId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err := rows.Scan(&username); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	return usernames, rows.Err()
+}
+
+// RecommendedPost is a post along with when a user recommended it
+type RecommendedPost struct {
+	*Post
+	RecommendedAt time.Time
+}
+
+const recommendedPostColumns = `
+	SELECT p.id, p.title, p.url, p.published_at, p.word_count, f.url, f.sensitive, pr.created_at
+	FROM post_recommendation pr
+	JOIN post p ON pr.post_id = p.id
+	JOIN feed f ON p.feed_id = f.id`
+
+// GetUserRecommendedPosts returns the posts a user publicly recommended, most
+// recent recommendation first
+func (db *DB) GetUserRecommendedPosts(username string, limit int) ([]*RecommendedPost, error) {
+	userId := db.GetUserID(username)
+
+	return db.queryRecommendedPosts(recommendedPostColumns+`
+		WHERE pr.user_id = ?
+		ORDER BY pr.created_at DESC, p.id DESC
+		LIMIT ?`, userId, limit)
+}
+
+// GetUserRecommendedPost returns a single post recommended by a user, or nil
+// if they didn't recommend it
+func (db *DB) GetUserRecommendedPost(username string, postId int) (*RecommendedPost, error) {
+	userId := db.GetUserID(username)
+
+	posts, err := db.queryRecommendedPosts(recommendedPostColumns+`
+		WHERE pr.user_id = ? AND pr.post_id = ?`, userId, postId)
+	if err != nil || len(posts) == 0 {
+		return nil, err
+	}
+	return posts[0], nil
+}
+
+func (db *DB) queryRecommendedPosts(query string, args ...any) ([]*RecommendedPost, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*RecommendedPost
+	for rows.Next() {
+		var p Post
+		var rp RecommendedPost
+		var publishedTime string
+		err = rows.Scan(&p.ID, &p.Title, &p.URL, &publishedTime, &p.WordCount, &p.FeedURL, &p.Sensitive, &rp.RecommendedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		p.PublishedDatetime, err = db.TryParseDate(publishedTime)
+		if err != nil {
+			return nil, err
+		}
+
+		rp.Post = &p
+		posts = append(posts, &rp)
+	}
+	return posts, rows.Err()
+}
@@ -0,0 +1,54 @@
+package sqlite
+
+import "strings"
+
+// searchQuery turns what someone typed into a query of post_search: titles
+// with every word, or words starting with them. Words are quoted, so that
+// nothing in them is taken for FTS syntax.
+func searchQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"*`
+	}
+	return strings.Join(words, " ")
+}
+
+// ReindexPostSearch rebuilds the search index from scratch. It's kept up to
+// date as posts are saved, this is for when it got out of sync somehow.
+func (db *DB) ReindexPostSearch() error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM post_search")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		INSERT INTO post_search (rowid, title)
+		SELECT id, title FROM post
+		UNION ALL
+		SELECT id, title FROM post_archive`)
+	if err != nil {
+		return err
+	}
+	// merges the index into as few segments as it can, for quick searches
+	_, err = tx.Exec("INSERT INTO post_search (post_search) VALUES ('optimize')")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetNumIndexedPosts returns how many posts the search index has
+func (db *DB) GetNumIndexedPosts() (int, error) {
+	var count int
+	err := db.sql.QueryRow("SELECT COUNT(*) FROM post_search").Scan(&count)
+	return count, err
+}
@@ -0,0 +1,62 @@
+package sqlite
+
+import "sync"
+
+// past this many users, the preferences of any of them are dropped as new
+// ones are kept
+const maxPreferenceUsers = 10000
+
+// preferences keeps the preferences people set, every page they see asks for
+// some of them (how dates are shown, whether their profile is hidden from
+// search engines). A user's preferences are loaded at once, and forgotten
+// when one of them changes.
+type preferences struct {
+	sync.Mutex
+
+	// by user id, then by preference name
+	byUser map[int]map[string]string
+
+	// changes with every preference saved, so that preferences that were
+	// being loaded meanwhile aren't kept
+	version int
+}
+
+func newPreferences() *preferences {
+	return &preferences{byUser: make(map[int]map[string]string)}
+}
+
+// get returns the preferences of a user if they're known, or else the version
+// to pass to set along with them
+func (p *preferences) get(userId int) (map[string]string, bool, int) {
+	p.Lock()
+	defer p.Unlock()
+
+	found, ok := p.byUser[userId]
+	return found, ok, p.version
+}
+
+// set keeps the preferences of a user, unless preferences were saved since
+// version
+func (p *preferences) set(userId int, values map[string]string, version int) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.version != version {
+		return
+	}
+	for id := range p.byUser {
+		if len(p.byUser) < maxPreferenceUsers {
+			break
+		}
+		delete(p.byUser, id)
+	}
+	p.byUser[userId] = values
+}
+
+func (p *preferences) forget(userId int) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.version++
+	delete(p.byUser, userId)
+}
@@ -0,0 +1,67 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type UserProfile struct {
+	Bio      string
+	Homepage string
+
+	// whether the user has uploaded an avatar
+	HasAvatar bool
+
+	// sha256 hash of the email the user's libravatar is registered to
+	LibravatarHash string
+}
+
+func (db *DB) GetUserProfile(username string) (*UserProfile, error) {
+	var profile UserProfile
+
+	err := db.sql.QueryRow(`
+		SELECT bio, homepage, avatar IS NOT NULL, libravatar_hash
+		FROM user
+		WHERE username = ?`, username).Scan(&profile.Bio, &profile.Homepage, &profile.HasAvatar, &profile.LibravatarHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return &profile, nil
+}
+
+// UpdateUserProfile updates the text fields of a user's profile. The uploaded
+// avatar is managed separately through SetUserAvatar.
+func (db *DB) UpdateUserProfile(username string, bio string, homepage string, libravatarHash string) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE user SET bio=?, homepage=?, libravatar_hash=? WHERE username=?", bio, homepage, libravatarHash, username)
+	unlock()
+
+	return err
+}
+
+// SetUserAvatar stores the uploaded avatar for a user. Passing nil data
+// removes it.
+func (db *DB) SetUserAvatar(username string, data []byte, contentType string) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE user SET avatar=?, avatar_content_type=? WHERE username=?", data, contentType, username)
+	unlock()
+
+	return err
+}
+
+// GetUserAvatar returns the uploaded avatar for a user along with its content
+// type. Returns nil data if the user hasn't uploaded one.
+func (db *DB) GetUserAvatar(username string) ([]byte, string, error) {
+	var data []byte
+	var contentType string
+
+	err := db.sql.QueryRow("SELECT avatar, avatar_content_type FROM user WHERE username=?", username).Scan(&data, &contentType)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, contentType, nil
+}
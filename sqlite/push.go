@@ -0,0 +1,91 @@
+package sqlite
+
+type PushSubscription struct {
+	ID         int
+	Username   string
+	Endpoint   string
+	P256dh     string
+	Auth       string
+	LastPostID int
+}
+
+// AddPushSubscription saves a browser a user turned push notifications on in.
+// A browser subscribing again (with new keys, or for someone else) replaces
+// its old subscription. Only posts saved from now on are notified about.
+func (db *DB) AddPushSubscription(username string, endpoint string, p256dh string, auth string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO push_subscription (user_id, endpoint, p256dh, auth, last_post_id)
+		VALUES (?, ?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(endpoint) DO UPDATE SET
+			user_id = excluded.user_id,
+			p256dh = excluded.p256dh,
+			auth = excluded.auth`,
+		userId, endpoint, p256dh, auth)
+	unlock()
+
+	return err
+}
+
+// RemovePushSubscription forgets one of a user's browsers
+func (db *DB) RemovePushSubscription(username string, endpoint string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM push_subscription WHERE endpoint = ? AND user_id = ?", endpoint, userId)
+	unlock()
+
+	return err
+}
+
+// DeletePushSubscription forgets a browser whose push service says it's no
+// longer subscribed
+func (db *DB) DeletePushSubscription(id int) error {
+	lock()
+	_, err := db.sql.Exec("DELETE FROM push_subscription WHERE id = ?", id)
+	unlock()
+
+	return err
+}
+
+const pushSubscriptionQuery = `
+	SELECT p.id, u.username, p.endpoint, p.p256dh, p.auth, p.last_post_id
+	FROM push_subscription p
+	JOIN user u ON p.user_id = u.id`
+
+func (db *DB) getPushSubscriptions(where string, args ...any) ([]*PushSubscription, error) {
+	rows, err := db.sql.Query(pushSubscriptionQuery+where+" ORDER BY p.id ASC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var subs []*PushSubscription
+	for rows.Next() {
+		var sub PushSubscription
+		err := rows.Scan(&sub.ID, &sub.Username, &sub.Endpoint, &sub.P256dh, &sub.Auth, &sub.LastPostID)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, &sub)
+	}
+	return subs, rows.Err()
+}
+
+func (db *DB) GetUserPushSubscriptions(username string) ([]*PushSubscription, error) {
+	return db.getPushSubscriptions(" WHERE u.username = ?", username)
+}
+
+func (db *DB) GetPushSubscriptions() ([]*PushSubscription, error) {
+	return db.getPushSubscriptions("")
+}
+
+func (db *DB) SetPushSubscriptionLastPostID(id int, postId int) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE push_subscription SET last_post_id = ? WHERE id = ?", postId, id)
+	unlock()
+
+	return err
+}
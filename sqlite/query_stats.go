@@ -0,0 +1,170 @@
+package sqlite
+
+import (
+	"database/sql"
+	"log"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// queries taking at least this long are logged
+const slowQueryThreshold = 200 * time.Millisecond
+
+// QueryStats is how a family of queries, the ones run by one method of the
+// DB, has been doing since mire started. Durations are until the results are
+// ready to be read, reading them isn't counted.
+type QueryStats struct {
+	Family string
+	Count  int
+	Slow   int
+	Total  time.Duration
+	Max    time.Duration
+}
+
+func (q QueryStats) Average() time.Duration {
+	if q.Count == 0 {
+		return 0
+	}
+	return q.Total / time.Duration(q.Count)
+}
+
+type queryStats struct {
+	sync.Mutex
+	byFamily map[string]*QueryStats
+}
+
+func newQueryStats() *queryStats {
+	return &queryStats{byFamily: make(map[string]*QueryStats)}
+}
+
+// record counts a query that started at start, it must be called by the
+// instrumentedDB or instrumentedTx method that ran it
+func (s *queryStats) record(start time.Time, query string) {
+	elapsed := time.Since(start)
+	family := queryFamily()
+
+	s.Lock()
+	stats := s.byFamily[family]
+	if stats == nil {
+		stats = &QueryStats{Family: family}
+		s.byFamily[family] = stats
+	}
+	stats.Count++
+	stats.Total += elapsed
+	stats.Max = max(stats.Max, elapsed)
+	slow := elapsed >= slowQueryThreshold
+	if slow {
+		stats.Slow++
+	}
+	s.Unlock()
+
+	if slow {
+		log.Printf("[warning] sqlite: slow query in %s took %s: %s\n", family, elapsed.Round(time.Millisecond), strings.Join(strings.Fields(query), " "))
+	}
+}
+
+// queryFamily returns the name of the function that ran a query, eg.
+// "GetPostsForUser"
+func queryFamily() string {
+	// skip queryFamily, record and the method running the query
+	pc, _, _, ok := runtime.Caller(3)
+	if !ok {
+		return "unknown"
+	}
+
+	name := runtime.FuncForPC(pc).Name()
+	name = name[strings.LastIndex(name, "/")+1:]
+	name = strings.TrimPrefix(name, "sqlite.")
+	name = strings.TrimPrefix(name, "(*DB).")
+	return name
+}
+
+// instrumentedDB is an *sql.DB that keeps stats about the queries run
+// through it
+type instrumentedDB struct {
+	*sql.DB
+	stats *queryStats
+}
+
+func (db *instrumentedDB) Exec(query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.Exec(query, args...)
+	db.stats.record(start, query)
+	return res, err
+}
+
+func (db *instrumentedDB) Query(query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := db.DB.Query(query, args...)
+	db.stats.record(start, query)
+	return rows, err
+}
+
+func (db *instrumentedDB) QueryRow(query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := db.DB.QueryRow(query, args...)
+	db.stats.record(start, query)
+	return row
+}
+
+func (db *instrumentedDB) Begin() (*instrumentedTx, error) {
+	tx, err := db.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedTx{Tx: tx, stats: db.stats}, nil
+}
+
+// instrumentedTx is an *sql.Tx that keeps stats about the queries run
+// through it
+type instrumentedTx struct {
+	*sql.Tx
+	stats *queryStats
+}
+
+func (tx *instrumentedTx) Exec(query string, args ...any) (sql.Result, error) {
+	start := time.Now()
+	res, err := tx.Tx.Exec(query, args...)
+	tx.stats.record(start, query)
+	return res, err
+}
+
+func (tx *instrumentedTx) Query(query string, args ...any) (*sql.Rows, error) {
+	start := time.Now()
+	rows, err := tx.Tx.Query(query, args...)
+	tx.stats.record(start, query)
+	return rows, err
+}
+
+func (tx *instrumentedTx) QueryRow(query string, args ...any) *sql.Row {
+	start := time.Now()
+	row := tx.Tx.QueryRow(query, args...)
+	tx.stats.record(start, query)
+	return row
+}
+
+// GetQueryStats returns the stats of every family of queries run since mire
+// started, the ones that took the most time in total first
+func (db *DB) GetQueryStats() []QueryStats {
+	db.sql.stats.Lock()
+	defer db.sql.stats.Unlock()
+
+	stats := make([]QueryStats, 0, len(db.sql.stats.byFamily))
+	for _, s := range db.sql.stats.byFamily {
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Total > stats[j].Total
+	})
+	return stats
+}
+
+// ResetQueryStats forgets the stats of the queries run so far
+func (db *DB) ResetQueryStats() {
+	db.sql.stats.Lock()
+	clear(db.sql.stats.byFamily)
+	db.sql.stats.Unlock()
+}
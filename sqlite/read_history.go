@@ -0,0 +1,86 @@
+package sqlite
+
+import "time"
+
+// ReadPost is a post someone read, for exporting their read history
+type ReadPost struct {
+	Title       string
+	URL         string
+	FeedURL     string
+	PublishedAt time.Time
+
+	// when the post was first marked, read or unread
+	ReadAt time.Time
+}
+
+// EachReadPost calls fn with every post a user read (archived ones too) and
+// didn't forget reading (see ForgetReadHistory), oldest first, as they're
+// read from the database so that long histories never have to be in memory
+// at once. It stops at the first error fn returns.
+func (db *DB) EachReadPost(username string, fn func(*ReadPost) error) error {
+	userId := db.GetUserID(username)
+
+	rows, err := db.sql.Query(`
+		SELECT p.title, p.url, f.url, p.published_at, pr.created_at
+		FROM post_read pr
+		JOIN (
+			SELECT id, feed_id, title, url, published_at FROM post
+			UNION ALL
+			SELECT id, feed_id, title, url, published_at FROM post_archive
+		) p ON p.id = pr.post_id
+		JOIN feed f ON f.id = p.feed_id
+		WHERE pr.user_id = ? AND pr.has_read = 1 AND pr.created_at IS NOT NULL
+		ORDER BY pr.created_at ASC, pr.id ASC`, userId)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var post ReadPost
+		err = rows.Scan(&post.Title, &post.URL, &post.FeedURL, &post.PublishedAt, &post.ReadAt)
+		if err != nil {
+			return err
+		}
+		if err = fn(&post); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ForgetReadHistory forgets that a user read the posts they read before a
+// time, and returns how many they were. Posts that are still around stay read,
+// or they'd be unread again, but when they were read is forgotten and they're
+// left out of the history. Archived posts are forgotten altogether.
+func (db *DB) ForgetReadHistory(username string, readBefore time.Time) (int, error) {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		DELETE FROM post_read
+		WHERE user_id = ? AND has_read = 1 AND created_at < ?
+			AND post_id NOT IN (SELECT id FROM post)`, userId, readBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	deleted, _ := res.RowsAffected()
+
+	res, err = tx.Exec(`
+		UPDATE post_read SET created_at = NULL
+		WHERE user_id = ? AND has_read = 1 AND created_at < ?`, userId, readBefore.UTC())
+	if err != nil {
+		return 0, err
+	}
+	forgotten, _ := res.RowsAffected()
+
+	return int(deleted + forgotten), tx.Commit()
+}
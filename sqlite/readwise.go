@@ -0,0 +1,114 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ReadwiseConnection struct {
+	Username     string
+	Token        string
+	LastSyncedAt *time.Time
+	LastError    string
+}
+
+// SetReadwiseToken connects a readwise account to a user. Every star is sent
+// to it, even those sent to the account connected before.
+func (db *DB) SetReadwiseToken(username string, token string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO readwise_token (user_id, token) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET token=excluded.token, last_synced_at=NULL, last_error=''`,
+		userId, token)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("UPDATE post_star SET readwise_synced=0 WHERE user_id=?", userId)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *DB) RemoveReadwiseToken(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM readwise_token WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
+
+const readwiseConnectionColumns = `
+	SELECT u.username, r.token, r.last_synced_at, r.last_error
+	FROM readwise_token r
+	JOIN user u ON r.user_id = u.id`
+
+func (db *DB) queryReadwiseConnections(query string, args ...any) ([]*ReadwiseConnection, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var connections []*ReadwiseConnection
+	for rows.Next() {
+		var c ReadwiseConnection
+		var lastSyncedAt sql.NullTime
+		err = rows.Scan(&c.Username, &c.Token, &lastSyncedAt, &c.LastError)
+		if err != nil {
+			return nil, err
+		}
+		if lastSyncedAt.Valid {
+			c.LastSyncedAt = &lastSyncedAt.Time
+		}
+		connections = append(connections, &c)
+	}
+	return connections, rows.Err()
+}
+
+// GetReadwiseConnection returns the readwise account a user connected, or nil
+// if they didn't connect one
+func (db *DB) GetReadwiseConnection(username string) (*ReadwiseConnection, error) {
+	connections, err := db.queryReadwiseConnections(readwiseConnectionColumns+`
+		WHERE u.username = ?`, username)
+	if err != nil || len(connections) == 0 {
+		return nil, err
+	}
+	return connections[0], nil
+}
+
+// GetReadwiseConnections returns every connected readwise account
+func (db *DB) GetReadwiseConnections() ([]*ReadwiseConnection, error) {
+	return db.queryReadwiseConnections(readwiseConnectionColumns)
+}
+
+// SetReadwiseSyncResult records how sending someone's stars to readwise went,
+// an empty error meaning it worked
+func (db *DB) SetReadwiseSyncResult(username string, syncedAt time.Time, syncErr string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	var err error
+	if syncErr == "" {
+		_, err = db.sql.Exec("UPDATE readwise_token SET last_synced_at=?, last_error='' WHERE user_id=?", syncedAt.UTC(), userId)
+	} else {
+		_, err = db.sql.Exec("UPDATE readwise_token SET last_error=? WHERE user_id=?", syncErr, userId)
+	}
+	unlock()
+
+	return err
+}
@@ -0,0 +1,102 @@
+package sqlite
+
+// FeedRecommendation is a feed recommended to a user. The score is the sum of
+// the overlap between the user's subscriptions and the subscriptions of each
+// user subscribed to the feed.
+type FeedRecommendation struct {
+	URL   string
+	Score int
+}
+
+// RefreshFeedRecommendations recomputes the recommendations for all users.
+func (db *DB) RefreshFeedRecommendations() error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM feed_recommendation")
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		WITH overlap AS (
+			SELECT a.user_id AS user_id, b.user_id AS other_user_id, COUNT(*) AS shared
+			FROM subscribe a
+			JOIN subscribe b ON a.feed_id = b.feed_id AND a.user_id != b.user_id
+			GROUP BY a.user_id, b.user_id
+		)
+		INSERT INTO feed_recommendation (user_id, feed_id, score)
+		SELECT o.user_id, s.feed_id, SUM(o.shared)
+		FROM overlap o
+		JOIN subscribe s ON s.user_id = o.other_user_id
+		WHERE s.feed_id NOT IN (SELECT feed_id FROM subscribe WHERE user_id = o.user_id)
+		GROUP BY o.user_id, s.feed_id`)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetFeedRecommendations returns the best recommendations for a user, leaving
+// out the ones they dismissed or have subscribed to since they were computed.
+// If languages are given, feeds known to be written in other languages are
+// left out too.
+func (db *DB) GetFeedRecommendations(username string, languages []string, limit int) ([]*FeedRecommendation, error) {
+	userId := db.GetUserID(username)
+
+	query := `
+		SELECT f.url, fr.score
+		FROM feed_recommendation fr
+		JOIN feed f ON f.id = fr.feed_id
+		WHERE fr.user_id = ?
+			AND fr.feed_id NOT IN (SELECT feed_id FROM dismissed_recommendation WHERE user_id = ?)
+			AND fr.feed_id NOT IN (SELECT feed_id FROM subscribe WHERE user_id = ?)`
+	args := []any{userId, userId, userId}
+
+	if len(languages) > 0 {
+		clause, languageArgs := languageClause("f.language", languages)
+		query += " AND " + clause
+		args = append(args, languageArgs...)
+	}
+
+	query += `
+		ORDER BY fr.score DESC, f.url ASC
+		LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recommendations []*FeedRecommendation
+	for rows.Next() {
+		var fr FeedRecommendation
+		if err := rows.Scan(&fr.URL, &fr.Score); err != nil {
+			return nil, err
+		}
+		recommendations = append(recommendations, &fr)
+	}
+	return recommendations, rows.Err()
+}
+
+// DismissFeedRecommendation stops recommending a feed to a user
+func (db *DB) DismissFeedRecommendation(username string, feedURL string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT OR IGNORE INTO dismissed_recommendation (user_id, feed_id)
+		SELECT ?, id FROM feed WHERE url = ?`, userId, feedURL)
+	unlock()
+
+	return err
+}
@@ -0,0 +1,52 @@
+package sqlite
+
+import "fmt"
+
+// GetFeedSensitivity returns whether a feed is flagged as sensitive and
+// whether that was decided by an admin (as opposed to guessed).
+func (db *DB) GetFeedSensitivity(feedURL string) (sensitive bool, setByAdmin bool, err error) {
+	err = db.sql.QueryRow("SELECT sensitive, sensitive_set_by_admin FROM feed WHERE url = ?", feedURL).
+		Scan(&sensitive, &setByAdmin)
+	return sensitive, setByAdmin, err
+}
+
+// SetFeedSensitive flags (or unflags) a feed as sensitive. Flags set by an
+// admin are never overwritten by the heuristics.
+func (db *DB) SetFeedSensitive(feedURL string, sensitive bool, setByAdmin bool) error {
+	lock()
+	res, err := db.sql.Exec("UPDATE feed SET sensitive = ?, sensitive_set_by_admin = ? WHERE url = ?",
+		sensitive, setByAdmin, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("unknown feed '%s'", feedURL)
+	}
+	return nil
+}
+
+// GetFeedsWithoutAdminSensitivity returns the feeds whose sensitive flag is
+// left for the heuristics to guess.
+func (db *DB) GetFeedsWithoutAdminSensitivity() ([]string, error) {
+	rows, err := db.sql.Query("SELECT url FROM feed WHERE sensitive_set_by_admin = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
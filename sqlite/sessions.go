@@ -0,0 +1,113 @@
+package sqlite
+
+import (
+	"sync"
+	"time"
+)
+
+// how long a session token is remembered to be someone's without asking the
+// database again
+const sessionTTL = time.Minute
+
+// past this many sessions, expired ones are dropped as new ones are kept, and
+// then any others
+const maxSessions = 10000
+
+// sessions remembers who session tokens belong to, every request looks it up
+// at least once. Tokens that don't belong to anyone aren't remembered, there's
+// no end to those.
+type sessions struct {
+	sync.Mutex
+
+	byToken map[string]session
+
+	// changes with every session token or password changed, so that lookups
+	// that were being made meanwhile aren't kept
+	version int
+}
+
+type session struct {
+	username string
+	expires  time.Time
+}
+
+func newSessions() *sessions {
+	return &sessions{byToken: make(map[string]session)}
+}
+
+// get returns who a token belongs to if it's known, or else the version to
+// pass to set along with its username
+func (s *sessions) get(token string) (string, bool, int) {
+	s.Lock()
+	defer s.Unlock()
+
+	found, ok := s.byToken[token]
+	if !ok || time.Now().After(found.expires) {
+		return "", false, s.version
+	}
+	return found.username, true, s.version
+}
+
+// set remembers who a token belongs to, unless sessions changed since version,
+// and not past when the session ends if it does
+func (s *sessions) set(token string, username string, version int, ends time.Time) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.version != version {
+		return
+	}
+
+	now := time.Now()
+	if len(s.byToken) >= maxSessions {
+		for t, found := range s.byToken {
+			if now.After(found.expires) {
+				delete(s.byToken, t)
+			}
+		}
+	}
+	// the sessions dropped are only looked up in the database again
+	for t := range s.byToken {
+		if len(s.byToken) < maxSessions {
+			break
+		}
+		delete(s.byToken, t)
+	}
+	expires := now.Add(sessionTTL)
+	if !ends.IsZero() && ends.Before(expires) {
+		expires = ends
+	}
+	s.byToken[token] = session{username: username, expires: expires}
+}
+
+// forgetToken forgets who a token belongs to, for when their session ends
+func (s *sessions) forgetToken(token string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.version++
+	delete(s.byToken, token)
+}
+
+// forgetAll forgets every session, for when they're all cut short
+func (s *sessions) forgetAll() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.version++
+	clear(s.byToken)
+}
+
+// forgetUser forgets the sessions of a user, for when their token or their
+// password changes
+func (s *sessions) forgetUser(username string) {
+	s.Lock()
+	defer s.Unlock()
+
+	s.version++
+	for token, found := range s.byToken {
+		if found.username == username {
+			delete(s.byToken, token)
+		}
+	}
+}
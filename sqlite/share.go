@@ -0,0 +1,43 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// GetPost returns the post with the given id, or nil if there's no such post
+func (db *DB) GetPost(postId int) (*Post, error) {
+	var p Post
+	var publishedTime string
+	err := db.sql.QueryRow(`
+		SELECT p.id, p.title, p.url, p.published_at, p.word_count, p.thumbnail_url, p.duration, p.comments_url, p.article_url, f.url
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		WHERE p.id = ?`, postId).Scan(&p.ID, &p.Title, &p.URL, &publishedTime, &p.WordCount, &p.ThumbnailURL, &p.Duration, &p.CommentsURL, &p.ArticleURL, &p.FeedURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.PublishedDatetime, err = db.TryParseDate(publishedTime)
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPostByURL returns a post by its URL, nil if mire doesn't have it. Posts
+// shared by several feeds are returned once, from any of them.
+func (db *DB) GetPostByURL(postURL string) (*Post, error) {
+	var postId int
+	err := db.sql.QueryRow("SELECT id FROM post WHERE url = ? LIMIT 1", postURL).Scan(&postId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return db.GetPost(postId)
+}
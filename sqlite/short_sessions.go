@@ -0,0 +1,31 @@
+package sqlite
+
+import "time"
+
+// AddShortSession starts a session for username that lasts until expiresAt,
+// and forgets the sessions that are over
+func (db *DB) AddShortSession(username string, token string, expiresAt time.Time) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	_, err := db.sql.Exec("DELETE FROM short_session WHERE expires_at < ?", time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	_, err = db.sql.Exec("INSERT INTO short_session (token, user_id, expires_at) VALUES (?, ?, ?)",
+		token, userId, expiresAt.UTC())
+	return err
+}
+
+// DeleteShortSession ends a session, for when someone logs out. Lasting
+// tokens are kept, but who they belong to is looked up again.
+func (db *DB) DeleteShortSession(token string) error {
+	lock()
+	_, err := db.sql.Exec("DELETE FROM short_session WHERE token = ?", token)
+	unlock()
+
+	db.sessions.forgetToken(token)
+	return err
+}
@@ -0,0 +1,35 @@
+package sqlite
+
+// SimilarFeed is a feed that is commonly subscribed to along with another one
+type SimilarFeed struct {
+	URL               string
+	SharedSubscribers int
+}
+
+// GetSimilarFeeds returns the feeds that share the most subscribers with the
+// given feed.
+func (db *DB) GetSimilarFeeds(feedURL string, limit int) ([]*SimilarFeed, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, COUNT(*) AS shared
+		FROM subscribe a
+		JOIN subscribe b ON a.user_id = b.user_id AND a.feed_id != b.feed_id
+		JOIN feed f ON f.id = b.feed_id
+		WHERE a.feed_id = (SELECT id FROM feed WHERE url = ?)
+		GROUP BY b.feed_id
+		ORDER BY shared DESC, f.url ASC
+		LIMIT ?`, feedURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var feeds []*SimilarFeed
+	for rows.Next() {
+		var f SimilarFeed
+		if err := rows.Scan(&f.URL, &f.SharedSubscribers); err != nil {
+			return nil, err
+		}
+		feeds = append(feeds, &f)
+	}
+	return feeds, rows.Err()
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// instance wide settings
+const (
+	SettingCommentsEnabled = "comments_enabled"
+
+	// the key the instance sends web push notifications with
+	SettingVAPIDKey = "vapid_private_key"
+
+	// how often the stats on /about are computed, as a duration like "6h"
+	SettingStatsInterval = "stats_interval"
+
+	// how many days old posts are when they're archived, 0 to never archive
+	SettingArchiveAfterDays = "archive_after_days"
+)
+
+// GetSiteSetting returns the value of an instance wide setting, or the given
+// default if it was never set
+func (db *DB) GetSiteSetting(key string, defaultValue string) (string, error) {
+	var value string
+	err := db.sql.QueryRow("SELECT value FROM site_setting WHERE key=?", key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return defaultValue, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return value, nil
+}
+
+func (db *DB) SetSiteSetting(key string, value string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO site_setting (key, value) VALUES (?, ?)
+		ON CONFLICT(key) DO UPDATE SET value=excluded.value`, key, value)
+	unlock()
+
+	return err
+}
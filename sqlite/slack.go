@@ -0,0 +1,166 @@
+package sqlite
+
+import (
+	"database/sql"
+)
+
+type SlackWebhook struct {
+	ID int
+
+	// empty for the instance's webhook
+	Username   string
+	WebhookURL string
+
+	// empty when the webhook gets posts from all the user's subscriptions
+	CollectionSlug string
+	CollectionName string
+
+	LastPostID int
+}
+
+// SetSlackWebhook sets where the new posts of a user's subscriptions, or of
+// one of their collections when collectionSlug isn't empty, are posted. Only
+// posts saved from now on are posted.
+func (db *DB) SetSlackWebhook(username string, webhookURL string, collectionSlug string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	collectionId := 0
+	if collectionSlug != "" {
+		err := db.sql.QueryRow("SELECT id FROM collection WHERE user_id = ? AND slug = ?", userId, collectionSlug).Scan(&collectionId)
+		if err != nil {
+			return err
+		}
+	}
+
+	return setSlackWebhook(db.sql, userId, webhookURL, collectionId)
+}
+
+// SetInstanceSlackWebhook sets where the new posts of every feed on the
+// instance are posted
+func (db *DB) SetInstanceSlackWebhook(webhookURL string) error {
+	lock()
+	defer unlock()
+
+	return setSlackWebhook(db.sql, 0, webhookURL, 0)
+}
+
+func setSlackWebhook(conn *instrumentedDB, userId int, webhookURL string, collectionId int) error {
+	_, err := conn.Exec(`
+		INSERT INTO slack_webhook (user_id, webhook_url, collection_id, last_post_id)
+		VALUES (?, ?, ?, (SELECT COALESCE(MAX(id), 0) FROM post))
+		ON CONFLICT(user_id, collection_id) DO UPDATE SET webhook_url = excluded.webhook_url`,
+		userId, webhookURL, collectionId)
+	return err
+}
+
+// RemoveSlackWebhook removes one of the user's webhooks
+func (db *DB) RemoveSlackWebhook(username string, id int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM slack_webhook WHERE id = ? AND user_id = ?", id, userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) RemoveInstanceSlackWebhook() error {
+	lock()
+	_, err := db.sql.Exec("DELETE FROM slack_webhook WHERE user_id = 0")
+	unlock()
+
+	return err
+}
+
+const slackWebhookQuery = `
+	SELECT d.id, COALESCE(u.username, ''), d.webhook_url, COALESCE(c.slug, ''), COALESCE(c.name, ''), d.last_post_id
+	FROM slack_webhook d
+	LEFT JOIN user u ON d.user_id = u.id
+	LEFT JOIN collection c ON d.collection_id = c.id`
+
+func scanSlackWebhooks(rows *sql.Rows) ([]*SlackWebhook, error) {
+	var webhooks []*SlackWebhook
+	for rows.Next() {
+		var w SlackWebhook
+		err := rows.Scan(&w.ID, &w.Username, &w.WebhookURL, &w.CollectionSlug, &w.CollectionName, &w.LastPostID)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &w)
+	}
+	return webhooks, rows.Err()
+}
+
+func (db *DB) GetUserSlackWebhooks(username string) ([]*SlackWebhook, error) {
+	rows, err := db.sql.Query(slackWebhookQuery+`
+		WHERE u.username = ?
+		ORDER BY d.collection_id ASC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSlackWebhooks(rows)
+}
+
+// GetInstanceSlackWebhook returns the instance's webhook, or nil if there's
+// none
+func (db *DB) GetInstanceSlackWebhook() (*SlackWebhook, error) {
+	rows, err := db.sql.Query(slackWebhookQuery + " WHERE d.user_id = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks, err := scanSlackWebhooks(rows)
+	if err != nil || len(webhooks) == 0 {
+		return nil, err
+	}
+	return webhooks[0], nil
+}
+
+func (db *DB) GetSlackWebhooks() ([]*SlackWebhook, error) {
+	rows, err := db.sql.Query(slackWebhookQuery)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSlackWebhooks(rows)
+}
+
+// GetPostsForSlackWebhook returns the posts saved after afterPostId, up to
+// and including upToPostId, that a webhook should post, oldest first
+func (db *DB) GetPostsForSlackWebhook(webhookId int, afterPostId int, upToPostId int, limit int) ([]*NotificationPost, error) {
+	rows, err := db.sql.Query(`
+		SELECT p.id, p.title, p.url, p.published_at, f.url, COALESCE(s.is_favorite, 0), COALESCE(s.notify, 0)
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		JOIN slack_webhook d ON d.id = ?
+		LEFT JOIN subscribe s ON s.feed_id = f.id AND s.user_id = d.user_id
+		WHERE p.id > ? AND p.id <= ?
+		AND (
+			d.user_id = 0
+			OR (d.collection_id = 0 AND s.user_id IS NOT NULL)
+			OR f.url IN (SELECT cf.feed_url FROM collection_feed cf WHERE cf.collection_id = d.collection_id)
+		)
+		ORDER BY p.id ASC
+		LIMIT ?`, webhookId, afterPostId, upToPostId, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanNotificationPosts(rows)
+}
+
+func (db *DB) SetSlackWebhookLastPostID(webhookId int, postId int) error {
+	lock()
+	_, err := db.sql.Exec("UPDATE slack_webhook SET last_post_id = ? WHERE id = ?", postId, webhookId)
+	unlock()
+
+	return err
+}
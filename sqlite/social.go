@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"database/sql"
+	"time"
+)
+
+// kinds of activity
+const (
+	ActivitySubscribe = "subscribe"
+	ActivityFavorite  = "favorite"
+	ActivityRecommend = "recommend"
+)
+
+type Activity struct {
+	ID          int
+	Username    string
+	Kind        string
+	TargetURL   string
+	TargetTitle string
+	CreatedAt   time.Time
+}
+
+func (db *DB) Follow(followerUsername string, followeeUsername string) error {
+	followerId := db.GetUserID(followerUsername)
+	followeeId := db.GetUserID(followeeUsername)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO follow (follower_id, followee_id) VALUES (?, ?)
+		ON CONFLICT(follower_id, followee_id) DO NOTHING`, followerId, followeeId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) Unfollow(followerUsername string, followeeUsername string) error {
+	followerId := db.GetUserID(followerUsername)
+	followeeId := db.GetUserID(followeeUsername)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM follow WHERE follower_id=? AND followee_id=?", followerId, followeeId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) IsFollowing(followerUsername string, followeeUsername string) (bool, error) {
+	var exists bool
+	err := db.sql.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM follow f
+			JOIN user a ON f.follower_id = a.id
+			JOIN user b ON f.followee_id = b.id
+			WHERE a.username = ? AND b.username = ?
+		)`, followerUsername, followeeUsername).Scan(&exists)
+
+	return exists, err
+}
+
+// GetFollowing returns the usernames of the users the given user follows
+func (db *DB) GetFollowing(username string) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT b.username
+		FROM follow f
+		JOIN user a ON f.follower_id = a.id
+		JOIN user b ON f.followee_id = b.id
+		WHERE a.username = ?
+		ORDER BY b.username`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var usernames []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		usernames = append(usernames, u)
+	}
+	return usernames, nil
+}
+
+func (db *DB) RecordActivity(username string, kind string, targetURL string, targetTitle string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(
+		"INSERT INTO activity (user_id, kind, target_url, target_title) VALUES (?, ?, ?, ?)",
+		userId, kind, targetURL, targetTitle,
+	)
+	unlock()
+
+	return err
+}
+
+// GetActivityOfFollowedUsers returns the latest activity of the users that the
+// given user follows, newest first.
+func (db *DB) GetActivityOfFollowedUsers(username string, limit int) ([]*Activity, error) {
+	userId := db.GetUserID(username)
+
+	return db.queryActivity(`
+		SELECT a.id, u.username, a.kind, a.target_url, a.target_title, a.created_at
+		FROM activity a
+		JOIN user u ON a.user_id = u.id
+		JOIN follow f ON f.followee_id = a.user_id
+		WHERE f.follower_id = ?
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?`, userId, limit)
+}
+
+// GetUserActivity returns the latest activity of a single user, newest first.
+func (db *DB) GetUserActivity(username string, limit int) ([]*Activity, error) {
+	userId := db.GetUserID(username)
+
+	return db.queryActivity(`
+		SELECT a.id, u.username, a.kind, a.target_url, a.target_title, a.created_at
+		FROM activity a
+		JOIN user u ON a.user_id = u.id
+		WHERE a.user_id = ?
+		ORDER BY a.created_at DESC, a.id DESC
+		LIMIT ?`, userId, limit)
+}
+
+// DeleteActivity removes a single activity event, as long as it belongs to
+// the given user.
+func (db *DB) DeleteActivity(username string, activityId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM activity WHERE id=? AND user_id=?", activityId, userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) queryActivity(query string, args ...any) ([]*Activity, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err == sql.ErrNoRows {
+		return []*Activity{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activities []*Activity
+	for rows.Next() {
+		var a Activity
+		err = rows.Scan(&a.ID, &a.Username, &a.Kind, &a.TargetURL, &a.TargetTitle, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		activities = append(activities, &a)
+	}
+	return activities, nil
+}
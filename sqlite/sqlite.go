@@ -1,14 +1,17 @@
 package sqlite
 
 import (
+	"cmp"
 	"database/sql"
 	"embed"
 	"fmt"
 	"io/fs"
 	"log"
+	"sort"
 	"strings"
 	"time"
 
+	"codeberg.org/meadowingc/mire/feedurl"
 	_ "github.com/glebarez/go-sqlite"
 	"github.com/mmcdole/gofeed"
 )
@@ -17,38 +20,72 @@ import (
 var migrationFiles embed.FS
 
 type DB struct {
-	sql *sql.DB
+	sql *instrumentedDB
+
+	unreadCounts *unreadCounts
+
+	sessions *sessions
+
+	preferences *preferences
 }
 
 type Post struct {
+	ID                int
 	Title             string
 	URL               string
 	FeedURL           string
 	PublishedDatetime time.Time
+	WordCount         int
+	Language          string
+	Sensitive         bool
+
+	// the thumbnail and length in seconds of the video or audio the post is
+	// about, when its feed says
+	ThumbnailURL string
+	Duration     int
+
+	// where the post is discussed, and the article it's about when that's not
+	// its URL, for posts of link aggregators
+	CommentsURL string
+	ArticleURL  string
+
+	// the domain shown for the post, see URLDomain
+	Domain string
 }
 
 type UserPostEntry struct {
-	Post    *gofeed.Item
-	IsRead  bool
-	FeedURL string
-}
-
-var listOfSpammyFeeds = []string{
-	"slashdot.org",
-	"thisiscolossal.com",
-	"vox.com",
-	"arstechnica.com",
-	"www.youtube.com",
-	"www.facebook.com",
-	"longreads.com",
-	"nautil.us",
-	"codeberg.org",
-	"finshots.in",
-	"namecoin.org",
-	"kagifeedback.org",
-	"scotthyoung.com",
-	"nesslabs.com",
-	"frame.work",
+	PostID    int
+	Post      *gofeed.Item
+	IsRead    bool
+	FeedURL   string
+	Domain    string
+	WordCount int
+	Sensitive bool
+
+	// the thumbnail and length in seconds of a video or audio post, when known
+	ThumbnailURL string
+	Duration     int
+
+	// where the post is discussed, and the article it's about when that's not
+	// its link, for posts of link aggregators
+	CommentsURL string
+	ArticleURL  string
+
+	// not stored, set when the viewer connected a mastodon account
+	CanShareToMastodon bool
+
+	// not stored, set when the viewer connected an instapaper account
+	CanSaveToInstapaper bool
+
+	// not stored, set when the viewer connected a wallabag account
+	CanSaveToWallabag bool
+
+	// not stored, set when the post is sensitive and the viewer wants those
+	// blurred
+	Blur bool
+
+	// not stored, set when the viewer gave the feed a title of their own
+	FeedTitle string
 }
 
 var mutex = make(chan struct{}, 1)
@@ -83,12 +120,24 @@ func New(path string) *DB {
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// ReadDir sorts files by name, which would run "10_" before "2_", so we
+	// sort them by their version number instead
+	versions := make(map[string]int)
 	for _, f := range files {
 		var version int
 		_, err = fmt.Sscanf(f.Name(), "%d_", &version)
 		if err != nil {
 			log.Fatal(err)
 		}
+		versions[f.Name()] = version
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return versions[files[i].Name()] < versions[files[j].Name()]
+	})
+
+	for _, f := range files {
+		version := versions[f.Name()]
 
 		// Apply migration if not already applied
 		if version > latestVersion {
@@ -105,10 +154,17 @@ func New(path string) *DB {
 		}
 	}
 
-	// open up mutex
-	mutex <- struct{}{}
+	// open up mutex (unless a previous call to New already did)
+	select {
+	case mutex <- struct{}{}:
+	default:
+	}
 
-	return &DB{sql: db}
+	d := &DB{sql: &instrumentedDB{DB: db, stats: newQueryStats()}, unreadCounts: newUnreadCounts(), sessions: newSessions(), preferences: newPreferences()}
+	if err := d.canonicalizeFeeds(); err != nil {
+		log.Fatalf("Failed to canonicalize the feed urls: %v", err)
+	}
+	return d
 }
 
 func (db *DB) Close() error {
@@ -130,6 +186,8 @@ func (db *DB) TryParseDate(dateStr string) (time.Time, error) {
 		// custom formats
 		"Mon Jan 2 03:04:05 PM MST 2006",
 		"2006-01-02 15:04:05-07:00",
+		// sqlite's CURRENT_TIMESTAMP, when it can't be told apart from text
+		"2006-01-02 15:04:05",
 	}
 
 	for _, layout := range formats {
@@ -150,10 +208,24 @@ func unlock() {
 	mutex <- struct{}{}
 }
 
+// GetUsernameBySessionToken returns who a session token belongs to, or an
+// empty string if it's no one's or it ended. Tokens are either someone's
+// lasting one or one of their short sessions, see AddShortSession.
 func (db *DB) GetUsernameBySessionToken(token string) string {
-	var username string
+	username, ok, version := db.sessions.get(token)
+	if ok {
+		return username
+	}
 
-	err := db.sql.QueryRow("SELECT username FROM user WHERE session_token=?", token).Scan(&username)
+	var expiresAt time.Time
+	err := db.sql.QueryRow("SELECT username, session_expires_at FROM user WHERE session_token = ? AND session_expires_at > ?",
+		token, time.Now().UTC()).Scan(&username, &expiresAt)
+	if err == sql.ErrNoRows {
+		err = db.sql.QueryRow(`
+			SELECT u.username, s.expires_at FROM short_session s
+			JOIN user u ON u.id = s.user_id
+			WHERE s.token = ? AND s.expires_at > ?`, token, time.Now().UTC()).Scan(&username, &expiresAt)
+	}
 
 	if err == sql.ErrNoRows {
 		return ""
@@ -162,6 +234,7 @@ func (db *DB) GetUsernameBySessionToken(token string) string {
 		log.Fatal(err)
 	}
 
+	db.sessions.set(token, username, version, expiresAt)
 	return username
 }
 
@@ -179,10 +252,13 @@ func (db *DB) GetPassword(username string) string {
 	return password
 }
 
+// GetSessionToken returns the lasting session token of username, or an empty
+// string if they have none or it ended
 func (db *DB) GetSessionToken(username string) (string, error) {
 	var result sql.NullString
 
-	err := db.sql.QueryRow("SELECT session_token FROM user WHERE username=?", username).Scan(&result)
+	err := db.sql.QueryRow("SELECT session_token FROM user WHERE username = ? AND session_expires_at > ?",
+		username, time.Now().UTC()).Scan(&result)
 
 	if err == sql.ErrNoRows {
 		return "", nil
@@ -190,11 +266,30 @@ func (db *DB) GetSessionToken(username string) (string, error) {
 	return result.String, err
 }
 
-func (db *DB) SetSessionToken(username string, token string) error {
+// SetSessionToken makes token the lasting session token of username, until
+// expiresAt
+func (db *DB) SetSessionToken(username string, token string, expiresAt time.Time) error {
 	lock()
-	_, err := db.sql.Exec("UPDATE user SET session_token=? WHERE username=?", token, username)
+	_, err := db.sql.Exec("UPDATE user SET session_token = ?, session_expires_at = ? WHERE username = ?",
+		token, expiresAt.UTC(), username)
 	unlock()
 
+	db.sessions.forgetUser(username)
+	return err
+}
+
+// LimitSessionTokens makes the lasting session tokens end by ends at the
+// latest, those from before they ended included, for when the instance
+// shortens how long sessions last
+func (db *DB) LimitSessionTokens(ends time.Time) error {
+	lock()
+	_, err := db.sql.Exec(`
+		UPDATE user SET session_expires_at = ?
+		WHERE session_token IS NOT NULL AND (session_expires_at IS NULL OR session_expires_at > ?)`,
+		ends.UTC(), ends.UTC())
+	unlock()
+
+	db.sessions.forgetAll()
 	return err
 }
 
@@ -216,7 +311,12 @@ func (db *DB) Subscribe(username string, feedURL string) {
 	if err == sql.ErrNoRows {
 		lock()
 		_, err := db.sql.Exec("INSERT INTO subscribe (user_id, feed_id, is_favorite) VALUES (?, ?, ?)", uid, fid, false)
+		if err == nil {
+			// subscribing again is as good as undoing an unsubscribe
+			_, err = db.sql.Exec("DELETE FROM unsubscribe WHERE user_id = ? AND feed_id = ?", uid, fid)
+		}
 		unlock()
+		db.unreadCounts.forgetAll()
 
 		if err != nil {
 			log.Fatal(err)
@@ -228,6 +328,31 @@ func (db *DB) Subscribe(username string, feedURL string) {
 	}
 }
 
+// MoveSubscription moves a user's subscription from a feed to another,
+// keeping its settings (favorite, notifications). If they're already
+// subscribed to the other feed, they're just unsubscribed from the first one.
+func (db *DB) MoveSubscription(username string, fromURL string, toURL string) error {
+	userId := db.GetUserID(username)
+	fromId := db.GetFeedID(fromURL)
+	toId := db.GetFeedID(toURL)
+
+	lock()
+	defer unlock()
+
+	_, err := db.sql.Exec(`
+		UPDATE subscribe SET feed_id = ?
+		WHERE user_id = ? AND feed_id = ?
+		AND NOT EXISTS (SELECT 1 FROM subscribe WHERE user_id = ? AND feed_id = ?)`,
+		toId, userId, fromId, userId, toId)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.sql.Exec("DELETE FROM subscribe WHERE user_id = ? AND feed_id = ?", userId, fromId)
+	db.unreadCounts.forgetAll()
+	return err
+}
+
 // SetFeedFavoriteStatus toggles the favorite status of a feed for a user.
 func (db *DB) SetFeedFavoriteStatus(username string, feedURL string, isFavorite bool) error {
 	userId := db.GetUserID(username)
@@ -240,17 +365,65 @@ func (db *DB) SetFeedFavoriteStatus(username string, feedURL string, isFavorite
 	return err
 }
 
+// SetFeedNotify sets whether a user wants to be notified right away when one
+// of their feeds posts
+func (db *DB) SetFeedNotify(username string, feedURL string, notify bool) error {
+	userId := db.GetUserID(username)
+	feedId := db.GetFeedID(feedURL)
+
+	lock()
+	defer unlock()
+
+	_, err := db.sql.Exec("UPDATE subscribe SET notify=? WHERE user_id=? AND feed_id=?", notify, userId, feedId)
+	return err
+}
+
+// SetFeedMuted mutes or unmutes one of a user's feeds: muted feeds stay out of
+// their timeline and unread count, see timelineFeedIDs
+func (db *DB) SetFeedMuted(username string, feedURL string, muted bool) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	res, err := db.sql.Exec(`
+		UPDATE subscribe SET is_muted = ?
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, muted, userId, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("you're not subscribed to '%s'", feedURL)
+	}
+	db.unreadCounts.forget(userId)
+	return nil
+}
+
+// IsFeedMuted tells whether a user muted one of their feeds
+func (db *DB) IsFeedMuted(username string, feedURL string) (bool, error) {
+	var muted bool
+	err := db.sql.QueryRow(`
+		SELECT s.is_muted FROM subscribe s
+		JOIN user u ON u.id = s.user_id
+		JOIN feed f ON f.id = s.feed_id
+		WHERE u.username = ? AND f.url = ?`, username, feedURL).Scan(&muted)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return muted, err
+}
+
 // GetFavoriteUnreadPosts fetches unread posts from favorite feeds for a user.
 func (db *DB) GetFavoriteUnreadPosts(username string, limit int) ([]*UserPostEntry, error) {
 	userId := db.GetUserID(username)
 	rows, err := db.sql.Query(`
-		SELECT p.title, p.url, p.published_at, pr.has_read
+		SELECT p.id, p.title, p.url, p.domain, p.published_at, p.word_count, p.thumbnail_url, p.duration, p.comments_url, p.article_url, pr.has_read
 		FROM post p
 		JOIN feed f ON p.feed_id = f.id
 		JOIN subscribe s ON f.id = s.feed_id
 		JOIN user u ON s.user_id = u.id
 		LEFT JOIN post_read pr ON p.id = pr.post_id AND u.id = pr.user_id
-		WHERE u.id = ? AND s.is_favorite = 1 AND (pr.has_read IS NULL OR pr.has_read = 0)
+		WHERE u.id = ? AND s.is_favorite = 1 AND s.is_muted = 0 AND (pr.has_read IS NULL OR pr.has_read = 0)
 		ORDER BY p.published_at ASC
 		LIMIT ?`, userId, limit)
 	if err != nil {
@@ -267,7 +440,7 @@ func (db *DB) GetFavoriteUnreadPosts(username string, limit int) ([]*UserPostEnt
 		var entry UserPostEntry
 		var p gofeed.Item
 		var hasRead sql.NullBool
-		err = rows.Scan(&p.Title, &p.Link, &p.PublishedParsed, &hasRead)
+		err = rows.Scan(&entry.PostID, &p.Title, &p.Link, &entry.Domain, &p.PublishedParsed, &entry.WordCount, &entry.ThumbnailURL, &entry.Duration, &entry.CommentsURL, &entry.ArticleURL, &hasRead)
 		if err != nil {
 			return nil, err
 		}
@@ -287,12 +460,85 @@ func (db *DB) UnsubscribeAll(username string) {
 	lock()
 	_, err := db.sql.Exec("DELETE FROM subscribe WHERE user_id=?", userId)
 	unlock()
+	db.unreadCounts.forgetAll()
 
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 
+// Unsubscribe unsubscribes a user from a single feed. It can be undone for a
+// while, see UndoUnsubscribe.
+func (db *DB) Unsubscribe(username string, feedURL string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT OR REPLACE INTO unsubscribe (user_id, feed_id, is_favorite, notify, note, title, is_muted)
+		SELECT user_id, feed_id, is_favorite, notify, note, title, is_muted FROM subscribe
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)
+		LIMIT 1`, userId, feedURL)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		DELETE FROM subscribe
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, userId, feedURL)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forgetAll()
+	return err
+}
+
+// GetNotifyFeedURLs returns the feeds a user asked to be notified about
+func (db *DB) GetNotifyFeedURLs(username string) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url FROM subscribe s
+		JOIN feed f ON s.feed_id = f.id
+		JOIN user u ON s.user_id = u.id
+		WHERE u.username = ? AND s.notify = 1
+		ORDER BY f.url`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (db *DB) IsAdmin(username string) bool {
+	var isAdmin bool
+
+	err := db.sql.QueryRow("SELECT is_admin FROM user WHERE username=?", username).Scan(&isAdmin)
+
+	if err == sql.ErrNoRows {
+		return false
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	return isAdmin
+}
+
 func (db *DB) UserExists(username string) bool {
 	var result string
 
@@ -307,23 +553,29 @@ func (db *DB) UserExists(username string) bool {
 	return true
 }
 
-func (db *DB) GetAllFeedURLs() []string {
-	rows, err := db.sql.Query("SELECT url FROM feed")
+// GetSubscriberCounts returns the number of subscribers of every feed, by
+// feed url
+func (db *DB) GetSubscriberCounts() (map[string]int, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, COUNT(s.id)
+		FROM feed f
+		LEFT JOIN subscribe s ON s.feed_id = f.id
+		GROUP BY f.id`)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 	defer rows.Close()
 
-	var urls []string
+	counts := make(map[string]int)
 	for rows.Next() {
 		var url string
-		err = rows.Scan(&url)
-		if err != nil {
-			log.Fatal(err)
+		var count int
+		if err := rows.Scan(&url, &count); err != nil {
+			return nil, err
 		}
-		urls = append(urls, url)
+		counts[url] = count
 	}
-	return urls
+	return counts, rows.Err()
 }
 
 func (db *DB) GetNumSubscribersForFeed(feedUrl string) int {
@@ -378,13 +630,17 @@ type FeedUrlForSettings struct {
 	URL        string
 	Error      string
 	IsFavorite bool
+	Notify     bool
+	Note       string
+	Title      string
+	Muted      bool
 }
 
 func (db *DB) GetUserFeedURLsForSettings(username string) []FeedUrlForSettings {
 	uid := db.GetUserID(username)
 
 	rows, err := db.sql.Query(`
-		SELECT f.url, f.fetch_error, s.is_favorite
+		SELECT f.url, f.fetch_error, s.is_favorite, s.notify, s.note, s.title, s.is_muted
 		FROM feed f
 		JOIN subscribe s ON f.id = s.feed_id
 		JOIN user u ON s.user_id = u.id
@@ -403,7 +659,7 @@ func (db *DB) GetUserFeedURLsForSettings(username string) []FeedUrlForSettings {
 		var fetchError sql.NullString
 		var isFavorite sql.NullBool
 
-		err = rows.Scan(&feedError.URL, &fetchError, &isFavorite)
+		err = rows.Scan(&feedError.URL, &fetchError, &isFavorite, &feedError.Notify, &feedError.Note, &feedError.Title, &feedError.Muted)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -419,7 +675,8 @@ func (db *DB) GetUserFeedURLsForSettings(username string) []FeedUrlForSettings {
 }
 
 // DeleteOrphanedPostReads deletes all post_read entries for a given user if
-// that user is not subscribed to the feed that the post belongs to.
+// that user is not subscribed to the feed that the post belongs to, nor reads
+// it with one of their teams.
 func (db *DB) DeleteOrphanedPostReads(username string) {
 	userId := db.GetUserID(username)
 
@@ -430,10 +687,11 @@ func (db *DB) DeleteOrphanedPostReads(username string) {
         DELETE FROM post_read 
         WHERE user_id = ? AND post_id IN (
             SELECT post.id FROM post
-            WHERE post.feed_id NOT IN (
-                SELECT feed_id FROM subscribe WHERE user_id = ?
-            )
-        )`, userId, userId)
+            WHERE post.feed_id NOT IN (`+timelineFeedIDs+`)
+                AND post.feed_id NOT IN (SELECT feed_id FROM subscribe WHERE user_id = ?)
+                AND post.feed_id NOT IN (SELECT feed_id FROM unsubscribe WHERE user_id = ?)
+                AND post.feed_id NOT IN (`+teamFeedIDs+`)
+        )`, userId, userId, userId, userId, userId, userId)
 
 	if err != nil {
 		log.Fatal(err)
@@ -441,7 +699,8 @@ func (db *DB) DeleteOrphanedPostReads(username string) {
 }
 
 // DeleteOrphanFeeds deletes all feeds that are not subscribed to by any user,
-// as well as all posts that belong to those feeds.
+// as well as all posts that belong to those feeds. Feeds someone unsubscribed
+// from lately are kept until their unsubscribe can't be undone anymore.
 func (db *DB) DeleteOrphanFeeds() []string {
 	lock()
 	defer unlock()
@@ -449,7 +708,7 @@ func (db *DB) DeleteOrphanFeeds() []string {
 	// Select the URLs of the orphan feeds (feeds that are not subscribed to by any user)
 	rows, err := db.sql.Query(`
         SELECT url FROM feed
-        WHERE id NOT IN (SELECT feed_id FROM subscribe)`)
+        WHERE id NOT IN (` + keptFeedIDs + `)`)
 	if err != nil {
 		return []string{}
 	}
@@ -468,7 +727,19 @@ func (db *DB) DeleteOrphanFeeds() []string {
 	// subscribed to by any user)
 	_, err = db.sql.Exec(`
 		DELETE FROM post
-		WHERE feed_id NOT IN (SELECT feed_id FROM subscribe)`)
+		WHERE feed_id NOT IN (` + keptFeedIDs + `)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.sql.Exec(`
+		DELETE FROM post_archive
+		WHERE feed_id NOT IN (` + keptFeedIDs + `)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.sql.Exec(`
+		DELETE FROM feed_fetch_error
+		WHERE feed_id NOT IN (` + keptFeedIDs + `)`)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -476,7 +747,7 @@ func (db *DB) DeleteOrphanFeeds() []string {
 	// Delete the orphan feeds (feeds that are not subscribed to by any user)
 	_, err = db.sql.Exec(`
 		DELETE FROM feed
-		WHERE id NOT IN (SELECT feed_id FROM subscribe)`)
+		WHERE id NOT IN (` + keptFeedIDs + `)`)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -507,10 +778,11 @@ func (db *DB) GetFeedID(feedURL string) int {
 }
 
 // WriteFeed writes an rss feed to the database for permanent storage
-// if the given feed already exists, WriteFeed does nothing.
+// if the given feed already exists, WriteFeed does nothing. Callers go through
+// KnownFeedURL first, for another url of a feed not to be written again.
 func (db *DB) WriteFeed(url string) {
 	lock()
-	_, err := db.sql.Exec(`INSERT INTO feed(url) VALUES(?) ON CONFLICT(url) DO NOTHING`, url)
+	_, err := db.sql.Exec(`INSERT INTO feed(url, canonical_url) VALUES(?, ?) ON CONFLICT(url) DO NOTHING`, url, feedurl.Canonical(url))
 	unlock()
 
 	if err != nil {
@@ -518,15 +790,42 @@ func (db *DB) WriteFeed(url string) {
 	}
 }
 
+// SetFeedFetchError keeps why fetching a feed failed, or an empty string once
+// it's fetched fine, and counts the failures in a row. Both go in the feed's
+// fetch history, see GetFeedFetchHistory, fetches that keep working don't.
 func (db *DB) SetFeedFetchError(url string, fetchErr string) error {
 	lock()
-	_, err := db.sql.Exec("UPDATE feed SET fetch_error=? WHERE url=?", fetchErr, url)
-	unlock()
+	defer unlock()
 
+	tx, err := db.sql.Begin()
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO feed_fetch_error (feed_id, error)
+		SELECT id, ? FROM feed
+		WHERE url = ? AND (? != '' OR COALESCE(fetch_error, '') != '')`, fetchErr, url, fetchErr)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		err = pruneFeedFetchHistory(tx, url)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE feed SET fetch_error = ?,
+			fetch_failures = CASE WHEN ? = '' THEN 0 ELSE fetch_failures + 1 END,
+			failing_since = CASE WHEN ? = '' THEN NULL ELSE COALESCE(failing_since, CURRENT_TIMESTAMP) END
+		WHERE url = ?`, fetchErr, fetchErr, fetchErr, url)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (db *DB) GetFeedFetchError(url string) (string, error) {
@@ -544,22 +843,118 @@ func (db *DB) GetFeedFetchError(url string) (string, error) {
 }
 
 func (db *DB) SavePostStruct(feedUrl string, post *Post) {
-	db.SavePost(feedUrl, post.Title, post.URL, post.PublishedDatetime)
+	post.FeedURL = feedUrl
+	db.SavePosts([]*Post{post})
 }
 
-func (db *DB) SavePost(feedUrl string, title string, url string, publishedDatetime time.Time) {
-	feedId := db.GetFeedID(feedUrl)
+// SavePosts saves posts of any feeds, by their FeedURL, in one transaction.
+// Posts that were already saved are left as they are. It returns how many
+// posts are new.
+func (db *DB) SavePosts(posts []*Post) int {
+	feedIds := make(map[string]int)
+	for _, post := range posts {
+		if _, ok := feedIds[post.FeedURL]; !ok {
+			feedIds[post.FeedURL] = db.GetFeedID(post.FeedURL)
+		}
+	}
+
+	type savedPost struct {
+		id     int64
+		feedId int
+		title  string
+	}
+	var saved []savedPost
 
 	lock()
-	_, err := db.sql.Exec(
-		"INSERT INTO post (feed_id, title, url, published_at) VALUES (?, ?, ?, ?) ON CONFLICT(feed_id, url) DO NOTHING",
-		feedId, title, url, publishedDatetime,
-	)
+	tx, err := db.sql.Begin()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, post := range posts {
+		feedId := feedIds[post.FeedURL]
+		// archived posts are still in their feeds for a while, they're not
+		// new again
+		res, err := tx.Exec(`
+			INSERT INTO post (feed_id, title, url, domain, published_at, word_count, language, thumbnail_url, duration, comments_url, article_url)
+			SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM post_archive WHERE feed_id = ? AND url = ?)
+			ON CONFLICT(feed_id, url) DO NOTHING`,
+			feedId, post.Title, post.URL, URLDomain(cmp.Or(post.ArticleURL, post.URL)), post.PublishedDatetime, post.WordCount, post.Language,
+			post.ThumbnailURL, post.Duration, post.CommentsURL, post.ArticleURL,
+			feedId, post.URL,
+		)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			postId, _ := res.LastInsertId()
+			saved = append(saved, savedPost{postId, feedId, post.Title})
+		}
+	}
+	err = tx.Commit()
 	unlock()
 
 	if err != nil {
 		log.Fatal(err)
 	}
+
+	// keyword alerts and filter rules only look at posts the first time
+	// they're saved
+	for _, post := range saved {
+		db.countNewPost(post.feedId)
+
+		err = db.matchKeywordAlerts(post.id, post.feedId, post.title)
+		if err != nil {
+			log.Printf("[err] SavePosts: could not match keyword alerts: %s\n", err)
+		}
+
+		err = db.applyFilterRules(post.id, post.feedId, post.title)
+		if err != nil {
+			log.Printf("[err] SavePosts: could not apply filter rules: %s\n", err)
+		}
+	}
+
+	return len(saved)
+}
+
+// GetRecentPostURLs returns the URLs of the last posts of a feed, archived
+// ones included, oldest first
+func (db *DB) GetRecentPostURLs(feedURL string, limit int) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT url FROM (
+			SELECT p.url, p.published_at FROM post p
+			JOIN feed f ON f.id = p.feed_id
+			WHERE f.url = ?
+			UNION ALL
+			SELECT pa.url, pa.published_at FROM post_archive pa
+			JOIN feed f ON f.id = pa.feed_id
+			WHERE f.url = ?
+			ORDER BY published_at DESC
+			LIMIT ?
+		)
+		ORDER BY published_at ASC`, feedURL, feedURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err = rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+func (db *DB) SavePost(feedUrl string, title string, url string, publishedDatetime time.Time) {
+	db.SavePostStruct(feedUrl, &Post{
+		Title:             title,
+		URL:               url,
+		PublishedDatetime: publishedDatetime,
+	})
 }
 
 func (db *DB) GetPostId(postUrl, username string) int {
@@ -585,27 +980,82 @@ func (db *DB) GetPostId(postUrl, username string) int {
 	return pid
 }
 
+// DiscoverFilter narrows down the posts shown on discover. The zero value
+// doesn't filter anything (besides the feeds admins hid from discover).
+type DiscoverFilter struct {
+	// only show posts from feeds with this topic
+	Topic string
+
+	// leave out posts from feeds this user is subscribed to
+	ExcludeSubscribedBy string
+
+	// leave out the feeds and domains this user has muted
+	ApplyMutesOf string
+
+	// only show posts in these languages (and the ones we couldn't tell the
+	// language of). Empty means every language.
+	Languages []string
+
+	// leave out posts from feeds flagged as sensitive
+	HideSensitive bool
+}
+
+// languageClause returns an SQL condition matching rows whose language column
+// is one of the given languages, or unknown
+func languageClause(column string, languages []string) (string, []any) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(languages)), ", ")
+	args := make([]any, 0, len(languages))
+	for _, l := range languages {
+		args = append(args, l)
+	}
+	return fmt.Sprintf("(%s = '' OR %s IN (%s))", column, column, placeholders), args
+}
+
 func (db *DB) GetLatestPostsForDiscover(limit int) []*Post {
+	return db.GetDiscoverPosts(DiscoverFilter{}, limit)
+}
+
+func (db *DB) GetDiscoverPosts(filter DiscoverFilter, limit int) []*Post {
 	query := `
-        SELECT p.title, p.url, MAX(p.published_at) as published_at, f.url
+        SELECT p.id, p.title, p.url, p.domain, MAX(p.published_at) as published_at, f.url, f.sensitive
         FROM post p
         JOIN feed f ON p.feed_id = f.id
-        WHERE `
+        WHERE f.hide_from_discover = 0`
+	var args []any
 
-	// Add a 'NOT LIKE' clause for each item in the exclusion list
-	for i, url := range listOfSpammyFeeds {
-		if i > 0 {
-			query += " AND "
-		}
-		query += fmt.Sprintf("p.url NOT LIKE '%%%s%%'", url)
+	if filter.Topic != "" {
+		query += " AND p.feed_id IN (SELECT feed_id FROM feed_topic WHERE topic = ?)"
+		args = append(args, filter.Topic)
+	}
+
+	if filter.ExcludeSubscribedBy != "" {
+		query += ` AND p.feed_id NOT IN (
+			SELECT s.feed_id FROM subscribe s JOIN user u ON s.user_id = u.id WHERE u.username = ?)`
+		args = append(args, filter.ExcludeSubscribedBy)
+	}
+
+	if filter.ApplyMutesOf != "" {
+		query += discoverMuteClause
+		args = append(args, filter.ApplyMutesOf)
+	}
+
+	if len(filter.Languages) > 0 {
+		clause, languageArgs := languageClause("p.language", filter.Languages)
+		query += " AND " + clause
+		args = append(args, languageArgs...)
+	}
+
+	if filter.HideSensitive {
+		query += " AND f.sensitive = 0"
 	}
 
 	query += `
         GROUP BY p.url
         ORDER BY p.published_at DESC
         LIMIT ?`
+	args = append(args, limit)
 
-	rows, err := db.sql.Query(query, limit)
+	rows, err := db.sql.Query(query, args...)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -615,7 +1065,7 @@ func (db *DB) GetLatestPostsForDiscover(limit int) []*Post {
 	for rows.Next() {
 		var p Post
 		var publishedTime string
-		err = rows.Scan(&p.Title, &p.URL, &publishedTime, &p.FeedURL)
+		err = rows.Scan(&p.ID, &p.Title, &p.URL, &p.Domain, &publishedTime, &p.FeedURL, &p.Sensitive)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -634,7 +1084,7 @@ func (db *DB) GetPostsForFeed(feedUrl string) []*Post {
 	feedId := db.GetFeedID(feedUrl)
 
 	rows, err := db.sql.Query(`
-        SELECT p.title, p.url, p.published_at, f.url
+        SELECT p.id, p.title, p.url, p.published_at, f.url
         FROM post p
         JOIN feed f ON p.feed_id = f.id
         WHERE feed_id=?`, feedId)
@@ -646,7 +1096,7 @@ func (db *DB) GetPostsForFeed(feedUrl string) []*Post {
 	var posts []*Post
 	for rows.Next() {
 		var p Post
-		err = rows.Scan(&p.Title, &p.URL, &p.PublishedDatetime, &p.FeedURL)
+		err = rows.Scan(&p.ID, &p.Title, &p.URL, &p.PublishedDatetime, &p.FeedURL)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -659,15 +1109,13 @@ func (db *DB) GetPostsForUser(username string, limit int) []*UserPostEntry {
 	uid := db.GetUserID(username)
 
 	rows, err := db.sql.Query(`
-        SELECT p.title, p.url, p.published_at, pr.has_read, f.url
+        SELECT p.id, p.title, p.url, p.domain, p.published_at, p.word_count, p.thumbnail_url, p.duration, p.comments_url, p.article_url, pr.has_read, f.url, f.sensitive
         FROM post p
         JOIN feed f ON p.feed_id = f.id
-        JOIN subscribe s ON f.id = s.feed_id
-        JOIN user u ON s.user_id = u.id
-        LEFT JOIN post_read pr ON p.id = pr.post_id AND u.id = pr.user_id
-        WHERE u.id = ?
+        LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+        WHERE p.feed_id IN (`+timelineFeedIDs+`) AND COALESCE(pr.hidden, 0) = 0
         ORDER BY p.published_at DESC
-        LIMIT ?`, uid, limit)
+        LIMIT ?`, uid, uid, uid, limit)
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -678,7 +1126,7 @@ func (db *DB) GetPostsForUser(username string, limit int) []*UserPostEntry {
 		var p gofeed.Item
 		var hasRead sql.NullBool
 		var feedURL string
-		err = rows.Scan(&p.Title, &p.Link, &p.PublishedParsed, &hasRead, &feedURL)
+		err = rows.Scan(&entry.PostID, &p.Title, &p.Link, &entry.Domain, &p.PublishedParsed, &entry.WordCount, &entry.ThumbnailURL, &entry.Duration, &entry.CommentsURL, &entry.ArticleURL, &hasRead, &feedURL, &entry.Sensitive)
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -695,37 +1143,75 @@ func (db *DB) GetPostsForUser(username string, limit int) []*UserPostEntry {
 	return userPostsEntries
 }
 
-func (db *DB) GetRandomPost() *Post {
-	var p Post
+// RandomPostFilter narrows down where random posts are picked from. The zero
+// value picks from every post on the instance.
+type RandomPostFilter struct {
+	// only pick posts from this feed
+	FeedURL string
 
-	// Select a random post from a feed that has at least one post
-	err := db.sql.QueryRow(`
-        SELECT title, url, published_at 
-        FROM post 
-        WHERE feed_id IN (SELECT id FROM feed WHERE EXISTS (SELECT 1 FROM post WHERE feed_id = feed.id))
-        ORDER BY RANDOM() 
-        LIMIT 1
-    `).Scan(&p.Title, &p.URL, &p.PublishedDatetime)
+	// only pick posts from feeds with this topic
+	Topic string
 
+	// only pick posts from this user's subscriptions that they haven't read
+	UnreadBy string
+}
+
+// GetRandomPost returns a random post matching the filter, or nil if there's
+// none.
+func (db *DB) GetRandomPost(filter RandomPostFilter) (*Post, error) {
+	query := `
+		SELECT p.id, p.title, p.url, f.url
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		WHERE 1 = 1`
+	var args []any
+
+	if filter.FeedURL != "" {
+		query += " AND f.url = ?"
+		args = append(args, filter.FeedURL)
+	}
+
+	if filter.Topic != "" {
+		query += " AND p.feed_id IN (SELECT feed_id FROM feed_topic WHERE topic = ?)"
+		args = append(args, filter.Topic)
+	}
+
+	if filter.UnreadBy != "" {
+		userId := db.GetUserID(filter.UnreadBy)
+		query += `
+			AND p.feed_id IN (` + timelineFeedIDs + `)
+			AND NOT EXISTS (SELECT 1 FROM post_read pr WHERE pr.post_id = p.id AND pr.user_id = ? AND pr.has_read = 1)`
+		args = append(args, userId, userId, userId)
+	}
+
+	query += `
+		ORDER BY RANDOM()
+		LIMIT 1`
+
+	var p Post
+	err := db.sql.QueryRow(query, args...).Scan(&p.ID, &p.Title, &p.URL, &p.FeedURL)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
-	return &p
+	return &p, nil
 }
 
 func (db *DB) SetReadStatus(username string, postUrl string, read bool) {
 	userId := db.GetUserID(username)
 	postId := db.GetPostId(postUrl, username)
 
-	var exists bool
-	err := db.sql.QueryRow("SELECT 1 FROM post_read WHERE user_id=? AND post_id=?", userId, postId).Scan(&exists)
+	var wasRead sql.NullBool
+	err := db.sql.QueryRow("SELECT has_read FROM post_read WHERE user_id=? AND post_id=?", userId, postId).Scan(&wasRead)
 	if err != nil && err != sql.ErrNoRows {
 		log.Fatal(err)
 	}
 
 	lock()
-	if exists {
+	if wasRead.Valid {
 		_, err = db.sql.Exec("UPDATE post_read SET has_read=? WHERE user_id=? AND post_id=?", read, userId, postId)
 		if err != nil {
 			log.Fatal(err)
@@ -737,6 +1223,8 @@ func (db *DB) SetReadStatus(username string, postUrl string, read bool) {
 		}
 	}
 	unlock()
+
+	db.countReadStatusChange(userId, postId, wasRead.Bool, read)
 }
 
 func (db *DB) ToggleReadStatus(username string, postUrl string) {
@@ -768,6 +1256,29 @@ func (db *DB) GetReadStatus(username string, postUrl string) bool {
 	return read
 }
 
+// GetUnreadCountForUser returns the number of posts from the feeds a user is
+// subscribed to which they haven't read yet.
+func (db *DB) GetUnreadCountForUser(username string) (int, error) {
+	userId := db.GetUserID(username)
+
+	count, ok, version := db.unreadCounts.get(userId)
+	if ok {
+		return count, nil
+	}
+
+	err := db.sql.QueryRow(`
+		SELECT COUNT(*)
+		FROM post p
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+timelineFeedIDs+`) AND (pr.has_read IS NULL OR pr.has_read = 0)`,
+		userId, userId, userId).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+	db.unreadCounts.set(userId, count, version)
+	return count, nil
+}
+
 func (db *DB) GetGlobalNumReadPosts() int {
 	var count int
 	err := db.sql.QueryRow("SELECT COUNT(*) FROM post_read WHERE has_read=1").Scan(&count)
@@ -798,23 +1309,45 @@ func (db *DB) GetGlobalNumUsers() int {
 	return count
 }
 
+// GetSingleUserPreference returns the value a user set a preference to, or
+// nil if they didn't. The first one asked for loads all of theirs, see
+// preferences.
 func (db *DB) GetSingleUserPreference(userId int, preferenceName string) *string {
-	var preferenceValue string
+	values, ok, version := db.preferences.get(userId)
+	if !ok {
+		values = make(map[string]string)
 
-	query := `SELECT preference_value FROM user_preferences WHERE user_id = ? AND preference_name = ?`
-	err := db.sql.QueryRow(query, userId, preferenceName).Scan(&preferenceValue)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Preference not found for this user
-			return nil
+		query := `SELECT preference_name, preference_value FROM user_preferences WHERE user_id = ?`
+		rows, err := db.sql.Query(query, userId)
+		if err != nil {
+			log.Fatal("getGenericUserPreference:: Query failed: ", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name, value string
+			if err := rows.Scan(&name, &value); err != nil {
+				log.Fatal("getGenericUserPreference:: Scan failed: ", err)
+			}
+			values[name] = value
+		}
+		if err := rows.Err(); err != nil {
+			log.Fatal("getGenericUserPreference:: Query failed: ", err)
 		}
-		log.Fatal("getGenericUserPreference:: QueryRow failed: ", err)
+		db.preferences.set(userId, values, version)
 	}
 
+	preferenceValue, ok := values[preferenceName]
+	if !ok {
+		// Preference not found for this user
+		return nil
+	}
 	return &preferenceValue
 }
 
 func (db *DB) SaveSingleUserPreference(userId int, preferenceName, preferenceValue string) error {
+	defer db.preferences.forget(userId)
+
 	// Check if the preference already exists
 	var exists bool
 	err := db.sql.QueryRow("SELECT EXISTS(SELECT 1 FROM user_preferences WHERE user_id = ? AND preference_name = ?)", userId, preferenceName).Scan(&exists)
@@ -865,9 +1398,21 @@ func (db *DB) UpdateFeedLastRefreshTime(feedURL string, lastRefreshed time.Time)
 	}
 }
 
+// SetFeedLanguage stores the language most of a feed's posts are written in
+func (db *DB) SetFeedLanguage(feedURL string, language string) {
+	lock()
+	_, err := db.sql.Exec("UPDATE feed SET language=? WHERE url=?", language, feedURL)
+	unlock()
+	if err != nil {
+		log.Printf("SetFeedLanguage:: Error updating language for feed %s: %v", feedURL, err)
+	}
+}
+
 func (db *DB) UpdatePassword(username string, newPassword string) error {
 	lock()
 	_, err := db.sql.Exec("UPDATE user SET password=? WHERE username=?", newPassword, username)
 	unlock()
+
+	db.sessions.forgetUser(username)
 	return err
 }
@@ -1,7 +1,10 @@
 package sqlite
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"slices"
 	"testing"
 	"time"
 )
@@ -80,3 +83,3311 @@ func TestReadStatus(t *testing.T) {
 		t.Errorf("Expected post to be unread")
 	}
 }
+
+func TestSavePosts(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedA = "http://feed-a.com"
+	const feedB = "http://feed-b.com"
+	db.WriteFeed(feedA)
+	db.WriteFeed(feedB)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", feedA)
+	db.Subscribe("testuser", feedB)
+
+	db.SavePost(feedA, "Old Post", "https://feed-a.com/old", time.Now())
+
+	saved := db.SavePosts([]*Post{
+		{FeedURL: feedA, Title: "Old Post", URL: "https://feed-a.com/old", PublishedDatetime: time.Now()},
+		{FeedURL: feedA, Title: "New Post", URL: "https://feed-a.com/new", PublishedDatetime: time.Now()},
+		{FeedURL: feedB, Title: "Other Post", URL: "https://feed-b.com/1", PublishedDatetime: time.Now(), WordCount: 300},
+	})
+	if saved != 2 {
+		t.Errorf("Expected 2 new posts, got %d", saved)
+	}
+
+	posts := db.GetPostsForUser("testuser", 10)
+	if len(posts) != 3 {
+		t.Fatalf("Expected 3 posts, got %d", len(posts))
+	}
+	for _, post := range posts {
+		if post.FeedURL == feedB && post.WordCount != 300 {
+			t.Errorf("Expected word count of 300, got %d", post.WordCount)
+		}
+	}
+}
+
+func TestSubscriberCounts(t *testing.T) {
+	db := createNewTestDB()
+
+	db.WriteFeed("http://popular.com")
+	db.WriteFeed("http://lonely.com")
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", "http://popular.com")
+	db.Subscribe("bob", "http://popular.com")
+
+	counts, err := db.GetSubscriberCounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if counts["http://popular.com"] != 2 || counts["http://lonely.com"] != 0 {
+		t.Errorf("Expected 2 and 0 subscribers, got %v", counts)
+	}
+}
+
+func TestFeedMetadata(t *testing.T) {
+	db := createNewTestDB()
+
+	db.WriteFeed("http://example-feed.com")
+	db.SetFeedMetadata("http://example-feed.com", "Example", "An example feed", "http://example.com")
+
+	m, err := db.GetFeedMetadata("http://example-feed.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m == nil || m.Title != "Example" || m.Description != "An example feed" || m.Link != "http://example.com" {
+		t.Errorf("Expected the saved metadata, got %+v", m)
+	}
+
+	m, err = db.GetFeedMetadata("http://unknown-feed.com")
+	if err != nil || m != nil {
+		t.Errorf("Expected no metadata for an unknown feed, got %+v, %v", m, err)
+	}
+
+	feeds, err := db.GetAllFeedMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != "http://example-feed.com" || feeds[0].Title != "Example" {
+		t.Errorf("Expected the one feed, got %+v", feeds)
+	}
+}
+
+func TestQueryStats(t *testing.T) {
+	db := createNewTestDB()
+
+	db.AddUser("testuser", "testpass")
+	db.GetUserID("testuser")
+	db.GetUserID("testuser")
+
+	var found *QueryStats
+	for _, stats := range db.GetQueryStats() {
+		if stats.Family == "GetUserID" {
+			found = &stats
+		}
+	}
+	if found == nil {
+		t.Fatalf("Expected stats for GetUserID, got %+v", db.GetQueryStats())
+	}
+	if found.Count != 2 || found.Total <= 0 || found.Max > found.Total {
+		t.Errorf("Expected 2 timed queries, got %+v", found)
+	}
+}
+
+func TestEachReadPost(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePost(testFeedUrl, "Post 1", "https://example.com/1", time.Now())
+	db.SavePost(testFeedUrl, "Post 2", "https://example.com/2", time.Now())
+	db.SavePost(testFeedUrl, "Post 3", "https://example.com/3", time.Now())
+	db.SetReadStatus("testuser", "https://example.com/2", true)
+	db.SetReadStatus("testuser", "https://example.com/1", true)
+	db.SetReadStatus("testuser", "https://example.com/3", true)
+	db.SetReadStatus("testuser", "https://example.com/3", false)
+
+	var urls []string
+	err := db.EachReadPost("testuser", func(post *ReadPost) error {
+		if post.FeedURL != testFeedUrl {
+			t.Errorf("Expected feed %s, got %s", testFeedUrl, post.FeedURL)
+		}
+		urls = append(urls, post.URL)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(urls, []string{"https://example.com/2", "https://example.com/1"}) {
+		t.Errorf("Expected the read posts in the order they were read, got %v", urls)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = db.EachReadPost("testuser", func(post *ReadPost) error {
+		calls++
+		return stop
+	})
+	if err != stop || calls != 1 {
+		t.Errorf("Expected to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestPostWordCount(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePostStruct(testFeedUrl, &Post{
+		Title:             "Long Post",
+		URL:               "https://example.com/long",
+		PublishedDatetime: time.Now(),
+		WordCount:         1200,
+	})
+
+	posts := db.GetPostsForUser("testuser", 10)
+	if len(posts) != 1 {
+		t.Fatalf("Expected 1 post, got %d", len(posts))
+	}
+	if posts[0].WordCount != 1200 {
+		t.Errorf("Expected word count of 1200, got %d", posts[0].WordCount)
+	}
+}
+
+func TestUnreadCount(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePost(testFeedUrl, "Test Post", "https://example.com/1", time.Now())
+	db.SavePost(testFeedUrl, "Test Post 2", "https://example.com/2", time.Now())
+
+	count, err := db.GetUnreadCountForUser("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 unread posts, got %d", count)
+	}
+
+	db.SetReadStatus("testuser", "https://example.com/1", true)
+
+	count, _ = db.GetUnreadCountForUser("testuser")
+	if count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+}
+
+func TestTriageCursor(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	now := time.Now()
+	db.SavePost(testFeedUrl, "Newest", "https://example.com/3", now)
+	db.SavePost(testFeedUrl, "Middle", "https://example.com/2", now.Add(-time.Hour))
+	db.SavePost(testFeedUrl, "Oldest", "https://example.com/1", now.Add(-2*time.Hour))
+	db.SetReadStatus("testuser", "https://example.com/2", true)
+
+	cursor, err := db.GetTriageCursor("testuser")
+	if err != nil || cursor != nil {
+		t.Fatalf("Expected no cursor yet, got %v (err: %v)", cursor, err)
+	}
+
+	next, err := db.MoveTriageCursorToNextUnread("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Post.Title != "Newest" {
+		t.Errorf("Expected cursor to start at the newest post, got %s", next.Post.Title)
+	}
+
+	// skips the read post in the middle
+	next, _ = db.MoveTriageCursorToNextUnread("testuser")
+	if next.Post.Title != "Oldest" {
+		t.Errorf("Expected cursor to skip to the oldest post, got %s", next.Post.Title)
+	}
+
+	next, _ = db.MoveTriageCursorToNextUnread("testuser")
+	if next != nil {
+		t.Errorf("Expected no more unread posts, got %s", next.Post.Title)
+	}
+
+	// going back doesn't skip read posts
+	prev, _ := db.MoveTriageCursorToPrevious("testuser")
+	if prev.Post.Title != "Middle" || !prev.IsRead {
+		t.Errorf("Expected cursor to move back to the (read) middle post, got %s", prev.Post.Title)
+	}
+
+	cursor, _ = db.GetTriageCursor("testuser")
+	if cursor.Post.Title != "Middle" {
+		t.Errorf("Expected cursor to be at the middle post, got %s", cursor.Post.Title)
+	}
+}
+
+func TestUserProfile(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("testuser", "testpass")
+
+	profile, err := db.GetUserProfile("testuser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profile.Bio != "" || profile.HasAvatar {
+		t.Errorf("Expected an empty profile, got %+v", profile)
+	}
+
+	db.UpdateUserProfile("testuser", "I read things", "https://example.com", "")
+	db.SetUserAvatar("testuser", []byte("fake png"), "image/png")
+
+	profile, _ = db.GetUserProfile("testuser")
+	if profile.Bio != "I read things" || profile.Homepage != "https://example.com" || !profile.HasAvatar {
+		t.Errorf("Profile was not updated, got %+v", profile)
+	}
+
+	db.SetUserAvatar("testuser", nil, "")
+
+	data, _, _ := db.GetUserAvatar("testuser")
+	if data != nil {
+		t.Errorf("Expected avatar to be removed")
+	}
+}
+
+func TestFollowActivity(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.AddUser("carol", "testpass")
+
+	db.Follow("alice", "bob")
+
+	following, _ := db.IsFollowing("alice", "bob")
+	if !following {
+		t.Errorf("Expected alice to follow bob")
+	}
+
+	db.RecordActivity("bob", ActivitySubscribe, "https://example.com/feed", "Example")
+	db.RecordActivity("carol", ActivitySubscribe, "https://example.org/feed", "")
+
+	activities, err := db.GetActivityOfFollowedUsers("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(activities) != 1 || activities[0].Username != "bob" {
+		t.Fatalf("Expected only bob's activity, got %v", activities)
+	}
+
+	// can't delete someone else's activity
+	db.DeleteActivity("alice", activities[0].ID)
+	activities, _ = db.GetActivityOfFollowedUsers("alice", 10)
+	if len(activities) != 1 {
+		t.Errorf("Expected bob's activity to still be there")
+	}
+
+	db.DeleteActivity("bob", activities[0].ID)
+	activities, _ = db.GetActivityOfFollowedUsers("alice", 10)
+	if len(activities) != 0 {
+		t.Errorf("Expected bob's activity to be deleted")
+	}
+
+	db.Unfollow("alice", "bob")
+	following, _ = db.IsFollowing("alice", "bob")
+	if following {
+		t.Errorf("Expected alice to not follow bob anymore")
+	}
+}
+
+func TestFeedTopics(t *testing.T) {
+	db := createNewTestDB()
+
+	const techFeedUrl = "http://tech-feed.com"
+	const foodFeedUrl = "http://food-feed.com"
+	db.WriteFeed(techFeedUrl)
+	db.WriteFeed(foodFeedUrl)
+
+	db.SavePostStruct(techFeedUrl, &Post{
+		Title:             "Compilers",
+		URL:               "https://tech-feed.com/compilers",
+		PublishedDatetime: time.Now(),
+	})
+	db.SavePostStruct(foodFeedUrl, &Post{
+		Title:             "Sourdough",
+		URL:               "https://food-feed.com/sourdough",
+		PublishedDatetime: time.Now(),
+	})
+
+	db.SetFeedTopics(techFeedUrl, []string{"tech"}, TopicSourceHeuristic)
+	db.SetFeedTopics(foodFeedUrl, []string{"food"}, TopicSourceAdmin)
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{Topic: "tech"}, 10)
+	if len(posts) != 1 || posts[0].FeedURL != techFeedUrl {
+		t.Fatalf("Expected only the tech post, got %v", posts)
+	}
+
+	feedTopics, assignedByAdmin, err := db.GetFeedTopics(foodFeedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feedTopics) != 1 || feedTopics[0] != "food" || !assignedByAdmin {
+		t.Errorf("Expected admin assigned 'food' topic, got %v (admin: %v)", feedTopics, assignedByAdmin)
+	}
+
+	urls, _ := db.GetFeedsWithoutAdminTopics()
+	if len(urls) != 1 || urls[0] != techFeedUrl {
+		t.Errorf("Expected only the tech feed to be classified by heuristics, got %v", urls)
+	}
+}
+
+func TestTrendingCandidates(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.Subscribe("bob", testFeedUrl)
+	db.SetFeedFavoriteStatus("alice", testFeedUrl, true)
+
+	db.SavePostStruct(testFeedUrl, &Post{
+		Title:             "Popular",
+		URL:               "https://example.com/popular",
+		PublishedDatetime: time.Now(),
+	})
+	db.SetReadStatus("alice", "https://example.com/popular", true)
+	db.SetReadStatus("bob", "https://example.com/popular", true)
+	db.RecommendPost("bob", db.GetPostsForFeed(testFeedUrl)[0].ID)
+
+	candidates, err := db.GetTrendingCandidates(7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(candidates) != 1 {
+		t.Fatalf("Expected 1 candidate, got %d", len(candidates))
+	}
+
+	c := candidates[0]
+	if c.RecentReads != 2 || c.Subscribers != 2 || c.Favorites != 1 {
+		t.Errorf("Expected 2 reads, 2 subscribers and 1 favorite, got %d, %d and %d",
+			c.RecentReads, c.Subscribers, c.Favorites)
+	}
+	if c.Recommendations != 1 {
+		t.Errorf("Expected 1 recommendation, got %d", c.Recommendations)
+	}
+}
+
+func TestMostSubscribedFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const popularFeedUrl = "http://popular-feed.com"
+	const nicheFeedUrl = "http://niche-feed.com"
+	db.WriteFeed(popularFeedUrl)
+	db.WriteFeed(nicheFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", popularFeedUrl)
+	db.Subscribe("bob", popularFeedUrl)
+	db.Subscribe("bob", nicheFeedUrl)
+
+	feeds, err := db.GetMostSubscribedFeeds(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 2 || feeds[0].URL != popularFeedUrl || feeds[0].Subscribers != 2 {
+		t.Fatalf("Expected the popular feed to come first, got %v", feeds)
+	}
+
+	db.SetFeedHiddenFromLeaderboard(popularFeedUrl, true)
+	feeds, _ = db.GetMostSubscribedFeeds(10)
+	if len(feeds) != 1 || feeds[0].URL != nicheFeedUrl {
+		t.Errorf("Expected the hidden feed to be left out, got %v", feeds)
+	}
+
+	if err := db.SetFeedHiddenFromLeaderboard("http://unknown.com", true); err == nil {
+		t.Errorf("Expected an error when hiding an unknown feed")
+	}
+}
+
+func TestSimilarFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedA = "http://feed-a.com"
+	const feedB = "http://feed-b.com"
+	const feedC = "http://feed-c.com"
+	db.WriteFeed(feedA)
+	db.WriteFeed(feedB)
+	db.WriteFeed(feedC)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", feedA)
+	db.Subscribe("alice", feedB)
+	db.Subscribe("bob", feedA)
+	db.Subscribe("bob", feedB)
+	db.Subscribe("bob", feedC)
+
+	similar, err := db.GetSimilarFeeds(feedA, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(similar) != 2 {
+		t.Fatalf("Expected 2 similar feeds, got %d", len(similar))
+	}
+	if similar[0].URL != feedB || similar[0].SharedSubscribers != 2 {
+		t.Errorf("Expected feed B to be the most similar with 2 shared subscribers, got %v", similar[0])
+	}
+	if similar[1].URL != feedC || similar[1].SharedSubscribers != 1 {
+		t.Errorf("Expected feed C to come next with 1 shared subscriber, got %v", similar[1])
+	}
+}
+
+func TestFeedRecommendations(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedA = "http://feed-a.com"
+	const feedB = "http://feed-b.com"
+	const feedC = "http://feed-c.com"
+	db.WriteFeed(feedA)
+	db.WriteFeed(feedB)
+	db.WriteFeed(feedC)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", feedA)
+	db.Subscribe("bob", feedA)
+	db.Subscribe("bob", feedB)
+	db.Subscribe("bob", feedC)
+
+	err := db.RefreshFeedRecommendations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recommendations, err := db.GetFeedRecommendations("alice", nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommendations) != 2 {
+		t.Fatalf("Expected 2 recommendations, got %d", len(recommendations))
+	}
+
+	db.DismissFeedRecommendation("alice", feedB)
+	recommendations, _ = db.GetFeedRecommendations("alice", nil, 10)
+	if len(recommendations) != 1 || recommendations[0].URL != feedC {
+		t.Errorf("Expected only feed C to be recommended, got %v", recommendations)
+	}
+
+	// bob is already subscribed to everything alice reads
+	recommendations, _ = db.GetFeedRecommendations("bob", nil, 10)
+	if len(recommendations) != 0 {
+		t.Errorf("Expected no recommendations for bob, got %v", recommendations)
+	}
+}
+
+func TestDiscoverExcludesSubscribedFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const subscribedFeedUrl = "http://subscribed-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(subscribedFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", subscribedFeedUrl)
+
+	db.SavePostStruct(subscribedFeedUrl, &Post{
+		Title:             "Already Seen",
+		URL:               "https://subscribed-feed.com/seen",
+		PublishedDatetime: time.Now(),
+	})
+	db.SavePostStruct(otherFeedUrl, &Post{
+		Title:             "New To Me",
+		URL:               "https://other-feed.com/new",
+		PublishedDatetime: time.Now(),
+	})
+
+	if posts := db.GetDiscoverPosts(DiscoverFilter{}, 10); len(posts) != 2 {
+		t.Fatalf("Expected 2 posts without filtering, got %d", len(posts))
+	}
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{ExcludeSubscribedBy: "alice"}, 10)
+	if len(posts) != 1 || posts[0].FeedURL != otherFeedUrl {
+		t.Errorf("Expected only the post from the other feed, got %v", posts)
+	}
+}
+
+func TestDiscoverLanguages(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://feed.com"
+	db.WriteFeed(feedUrl)
+
+	db.SavePostStruct(feedUrl, &Post{Title: "English", URL: "https://feed.com/en", Language: "en", PublishedDatetime: time.Now()})
+	db.SavePostStruct(feedUrl, &Post{Title: "German", URL: "https://feed.com/de", Language: "de", PublishedDatetime: time.Now()})
+	db.SavePostStruct(feedUrl, &Post{Title: "Unknown", URL: "https://feed.com/unknown", PublishedDatetime: time.Now()})
+
+	if posts := db.GetDiscoverPosts(DiscoverFilter{}, 10); len(posts) != 3 {
+		t.Fatalf("Expected 3 posts without filtering, got %d", len(posts))
+	}
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{Languages: []string{"en"}}, 10)
+	if len(posts) != 2 {
+		t.Fatalf("Expected the english and the unknown post, got %v", posts)
+	}
+	for _, p := range posts {
+		if p.Title == "German" {
+			t.Errorf("Expected the german post to be filtered out")
+		}
+	}
+}
+
+func TestFeedRecommendationsLanguages(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedA = "http://feed-a.com"
+	const feedB = "http://feed-b.com"
+	const feedC = "http://feed-c.com"
+	db.WriteFeed(feedA)
+	db.WriteFeed(feedB)
+	db.WriteFeed(feedC)
+	db.SetFeedLanguage(feedB, "de")
+	db.SetFeedLanguage(feedC, "en")
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", feedA)
+	db.Subscribe("bob", feedA)
+	db.Subscribe("bob", feedB)
+	db.Subscribe("bob", feedC)
+
+	err := db.RefreshFeedRecommendations()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recommendations, err := db.GetFeedRecommendations("alice", []string{"en"}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommendations) != 1 || recommendations[0].URL != feedC {
+		t.Errorf("Expected only the english feed to be recommended, got %v", recommendations)
+	}
+}
+
+func TestSensitiveFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const sensitiveFeedUrl = "http://sensitive-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(sensitiveFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+
+	db.SavePostStruct(sensitiveFeedUrl, &Post{Title: "Sensitive", URL: "https://sensitive-feed.com/1", PublishedDatetime: time.Now()})
+	db.SavePostStruct(otherFeedUrl, &Post{Title: "Other", URL: "https://other-feed.com/1", PublishedDatetime: time.Now()})
+
+	if err := db.SetFeedSensitive(sensitiveFeedUrl, true, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetFeedSensitive("http://unknown.com", true, true); err == nil {
+		t.Errorf("Expected an error when flagging an unknown feed")
+	}
+
+	sensitive, setByAdmin, err := db.GetFeedSensitivity(sensitiveFeedUrl)
+	if err != nil || !sensitive || !setByAdmin {
+		t.Errorf("Expected the feed to be flagged by an admin, got %v %v %v", sensitive, setByAdmin, err)
+	}
+
+	// the heuristics leave alone what admins decided
+	feeds, err := db.GetFeedsWithoutAdminSensitivity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0] != otherFeedUrl {
+		t.Errorf("Expected only the other feed to be left to the heuristics, got %v", feeds)
+	}
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{}, 10)
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 posts without filtering, got %d", len(posts))
+	}
+	for _, p := range posts {
+		if p.Sensitive != (p.FeedURL == sensitiveFeedUrl) {
+			t.Errorf("Expected only posts from the sensitive feed to be sensitive, got %v", p)
+		}
+	}
+
+	posts = db.GetDiscoverPosts(DiscoverFilter{HideSensitive: true}, 10)
+	if len(posts) != 1 || posts[0].FeedURL != otherFeedUrl {
+		t.Errorf("Expected only the post from the other feed, got %v", posts)
+	}
+}
+
+func TestFeedReports(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://spammy-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(feedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("bob", feedUrl)
+	db.SavePostStruct(feedUrl, &Post{Title: "Buy now", URL: "https://spammy-feed.com/1", PublishedDatetime: time.Now()})
+	db.SavePostStruct(otherFeedUrl, &Post{Title: "Hello", URL: "https://other-feed.com/1", PublishedDatetime: time.Now()})
+
+	db.ReportFeed("alice", feedUrl, "spam")
+	db.ReportFeed("alice", feedUrl, "lots of spam")
+	db.ReportFeed("bob", feedUrl, "ads")
+
+	reports, err := db.GetOpenFeedReports()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 2 {
+		t.Fatalf("Expected reporting twice to update the first report, got %d reports", len(reports))
+	}
+	if reports[0].Username != "alice" || reports[0].Reason != "lots of spam" {
+		t.Errorf("Expected alice's report to have the latest reason, got %v", reports[0])
+	}
+
+	if reported, _ := db.HasOpenFeedReport("alice", feedUrl); !reported {
+		t.Errorf("Expected alice to have an open report")
+	}
+
+	db.SetFeedHiddenFromDiscover(feedUrl, true)
+	posts := db.GetDiscoverPosts(DiscoverFilter{}, 10)
+	if len(posts) != 1 || posts[0].FeedURL != otherFeedUrl {
+		t.Errorf("Expected the hidden feed to be left out of discover, got %v", posts)
+	}
+
+	db.ResolveFeedReports(feedUrl, ReportResolutionHidden)
+	if reports, _ := db.GetOpenFeedReports(); len(reports) != 0 {
+		t.Errorf("Expected no open reports, got %v", reports)
+	}
+	resolved, _ := db.GetResolvedFeedReports(10)
+	if len(resolved) != 2 || resolved[0].Resolution != ReportResolutionHidden || resolved[0].ResolvedAt == nil {
+		t.Errorf("Expected both reports to be resolved, got %v", resolved)
+	}
+
+	// once resolved, the feed can be reported again
+	db.ReportFeed("alice", feedUrl, "still spam")
+	if reports, _ := db.GetOpenFeedReports(); len(reports) != 1 {
+		t.Errorf("Expected a new open report, got %v", reports)
+	}
+
+	err = db.DeleteFeed(feedUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := db.FeedExists(feedUrl); exists {
+		t.Errorf("Expected the feed to be deleted")
+	}
+	if feeds := db.GetUserFeedURLs("bob"); len(feeds) != 0 {
+		t.Errorf("Expected bob's subscription to be gone, got %v", feeds)
+	}
+	if err := db.DeleteFeed(feedUrl); err == nil {
+		t.Errorf("Expected an error when deleting an unknown feed")
+	}
+}
+
+func TestGetNewFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const newFeedUrl = "http://new-feed.com"
+	const oldFeedUrl = "http://old-feed.com"
+	const emptyFeedUrl = "http://empty-feed.com"
+	db.WriteFeed(newFeedUrl)
+	db.WriteFeed(oldFeedUrl)
+	db.WriteFeed(emptyFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", newFeedUrl)
+	db.Subscribe("alice", oldFeedUrl)
+	db.Subscribe("alice", emptyFeedUrl)
+
+	// bob subscribing today doesn't make an old feed new again
+	_, err := db.sql.Exec("UPDATE subscribe SET created_at = datetime('now', '-30 days') WHERE feed_id = ?", db.GetFeedID(oldFeedUrl))
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Subscribe("bob", oldFeedUrl)
+
+	db.SavePostStruct(newFeedUrl, &Post{Title: "First", URL: "https://new-feed.com/1", PublishedDatetime: time.Now().Add(-time.Hour)})
+	db.SavePostStruct(newFeedUrl, &Post{Title: "Second", URL: "https://new-feed.com/2", PublishedDatetime: time.Now()})
+	db.SavePostStruct(oldFeedUrl, &Post{Title: "Old", URL: "https://old-feed.com/1", PublishedDatetime: time.Now()})
+
+	feeds, err := db.GetNewFeeds(7, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != newFeedUrl {
+		t.Fatalf("Expected only the new feed, got %v", feeds)
+	}
+	if feeds[0].LatestPost.Title != "Second" || feeds[0].FirstSubscribedAt.IsZero() {
+		t.Errorf("Expected the new feed's latest post, got %v", feeds[0].LatestPost)
+	}
+}
+
+func TestEmailDigests(t *testing.T) {
+	db := createNewTestDB()
+
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+
+	if email, _ := db.GetDigestEmail("alice"); email != "" {
+		t.Errorf("Expected no email by default, got '%s'", email)
+	}
+
+	db.SetDigestEmail("alice", "alice@example.com", "token-1")
+	db.SetDigestEmail("alice", "alice@example.org", "token-2")
+	if email, _ := db.GetDigestEmail("alice"); email != "alice@example.org" {
+		t.Errorf("Expected the email to be updated, got '%s'", email)
+	}
+
+	// changing the address keeps the links in earlier emails working
+	if username, _ := db.GetUsernameByUnsubscribeToken("token-1"); username != "alice" {
+		t.Errorf("Expected the first token to still belong to alice, got '%s'", username)
+	}
+	if username, _ := db.GetUsernameByUnsubscribeToken("nope"); username != "" {
+		t.Errorf("Expected an unknown token to belong to nobody, got '%s'", username)
+	}
+
+	recipients, err := db.GetDigestRecipients()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 1 || recipients[0].Username != "alice" || recipients[0].LastSentAt != nil {
+		t.Fatalf("Expected alice to be the only recipient, got %v", recipients)
+	}
+
+	db.MarkDigestSent("alice", time.Now())
+	recipients, _ = db.GetDigestRecipients()
+	if recipients[0].LastSentAt == nil {
+		t.Errorf("Expected the digest to be marked as sent")
+	}
+
+	db.RemoveDigestEmail("alice")
+	if recipients, _ := db.GetDigestRecipients(); len(recipients) != 0 {
+		t.Errorf("Expected no recipients, got %v", recipients)
+	}
+}
+
+func TestDiscoverMutes(t *testing.T) {
+	db := createNewTestDB()
+
+	const mutedFeedUrl = "http://muted-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(mutedFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+
+	db.SavePostStruct(mutedFeedUrl, &Post{
+		Title:             "Muted Feed Post",
+		URL:               "https://muted-feed.com/post",
+		PublishedDatetime: time.Now(),
+	})
+	db.SavePostStruct(otherFeedUrl, &Post{
+		Title:             "Muted Domain Post",
+		URL:               "https://blog.noisy.com/post",
+		PublishedDatetime: time.Now(),
+	})
+	db.SavePostStruct(otherFeedUrl, &Post{
+		Title:             "Visible Post",
+		URL:               "https://other-feed.com/post",
+		PublishedDatetime: time.Now(),
+	})
+
+	db.AddDiscoverMute("alice", MuteKindFeed, mutedFeedUrl)
+	db.AddDiscoverMute("alice", MuteKindDomain, "noisy.com")
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{ApplyMutesOf: "alice"}, 10)
+	if len(posts) != 1 || posts[0].Title != "Visible Post" {
+		t.Errorf("Expected only the visible post, got %v", posts)
+	}
+
+	// mutes are per user
+	if posts := db.GetDiscoverPosts(DiscoverFilter{ApplyMutesOf: "bob"}, 10); len(posts) != 3 {
+		t.Errorf("Expected bob to see all 3 posts, got %d", len(posts))
+	}
+
+	db.RemoveDiscoverMute("alice", MuteKindDomain, "noisy.com")
+	mutes, _ := db.GetDiscoverMutes("alice")
+	if len(mutes) != 1 || mutes[0].Kind != MuteKindFeed {
+		t.Errorf("Expected only the feed mute to be left, got %v", mutes)
+	}
+}
+
+func TestRandomUnreadPost(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePost(testFeedUrl, "Read Post", "https://example.com/read", time.Now())
+	db.SavePost(testFeedUrl, "Unread Post", "https://example.com/unread", time.Now())
+	db.SetReadStatus("testuser", "https://example.com/read", true)
+
+	for i := 0; i < 5; i++ {
+		post, err := db.GetRandomPost(RandomPostFilter{UnreadBy: "testuser"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if post == nil || post.URL != "https://example.com/unread" {
+			t.Fatalf("Expected the unread post, got %v", post)
+		}
+	}
+
+	db.SetReadStatus("testuser", "https://example.com/unread", true)
+	post, _ := db.GetRandomPost(RandomPostFilter{UnreadBy: "testuser"})
+	if post != nil {
+		t.Errorf("Expected no post once everything is read, got %v", post)
+	}
+}
+
+func TestScopedRandomPost(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedA = "http://feed-a.com"
+	const feedB = "http://feed-b.com"
+	db.WriteFeed(feedA)
+	db.WriteFeed(feedB)
+	db.SavePost(feedA, "Post A", "https://feed-a.com/post", time.Now())
+	db.SavePost(feedB, "Post B", "https://feed-b.com/post", time.Now())
+	db.SetFeedTopics(feedB, []string{"food"}, TopicSourceAdmin)
+
+	for i := 0; i < 5; i++ {
+		post, _ := db.GetRandomPost(RandomPostFilter{FeedURL: feedA})
+		if post == nil || post.FeedURL != feedA {
+			t.Fatalf("Expected a post from feed A, got %v", post)
+		}
+
+		post, _ = db.GetRandomPost(RandomPostFilter{Topic: "food"})
+		if post == nil || post.FeedURL != feedB {
+			t.Fatalf("Expected a post from feed B, got %v", post)
+		}
+	}
+
+	post, _ := db.GetRandomPost(RandomPostFilter{FeedURL: feedA, Topic: "food"})
+	if post != nil {
+		t.Errorf("Expected no post matching both filters, got %v", post)
+	}
+}
+
+func TestStarterPacks(t *testing.T) {
+	db := createNewTestDB()
+
+	packs, err := db.GetStarterPacks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packs) != 3 {
+		t.Fatalf("Expected the 3 default starter packs, got %d", len(packs))
+	}
+
+	err = db.SaveStarterPack(&StarterPack{
+		Slug:     "cooking",
+		Name:     "cooking",
+		FeedURLs: []string{"https://food.example.com/feed", "https://bread.example.com/feed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// saving again replaces the feeds
+	db.SaveStarterPack(&StarterPack{
+		Slug:     "cooking",
+		Name:     "good food",
+		FeedURLs: []string{"https://food.example.com/feed"},
+	})
+
+	pack, _ := db.GetStarterPack("cooking")
+	if pack == nil || pack.Name != "good food" || len(pack.FeedURLs) != 1 {
+		t.Fatalf("Expected the updated starter pack, got %v", pack)
+	}
+
+	db.DeleteStarterPack("cooking")
+	pack, _ = db.GetStarterPack("cooking")
+	if pack != nil {
+		t.Errorf("Expected the starter pack to be deleted, got %v", pack)
+	}
+}
+
+func TestCollections(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+
+	err := db.SaveCollection(&Collection{
+		Username: "alice",
+		Slug:     "friends",
+		Name:     "friends",
+		FeedURLs: []string{"https://a.example.com/feed", "https://b.example.com/feed"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// bob can use the same slug
+	db.SaveCollection(&Collection{Username: "bob", Slug: "friends", Name: "bob's friends"})
+
+	c, _ := db.GetCollection("alice", "friends")
+	if c == nil || len(c.FeedURLs) != 2 {
+		t.Fatalf("Expected alice's collection with 2 feeds, got %v", c)
+	}
+
+	c, _ = db.GetCollection("bob", "friends")
+	if c == nil || c.Name != "bob's friends" || len(c.FeedURLs) != 0 {
+		t.Fatalf("Expected bob's empty collection, got %v", c)
+	}
+
+	db.DeleteCollection("alice", "friends")
+	collections, _ := db.GetUserCollections("alice")
+	if len(collections) != 0 {
+		t.Errorf("Expected alice to have no collections left, got %v", collections)
+	}
+	collections, _ = db.GetUserCollections("bob")
+	if len(collections) != 1 {
+		t.Errorf("Expected bob's collection to be left alone, got %v", collections)
+	}
+}
+
+func TestUnreadCountCache(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePost(testFeedUrl, "Test Post", "https://example.com/1", time.Now())
+
+	count, _ := db.GetUnreadCountForUser("testuser")
+	if count != 1 {
+		t.Fatalf("Expected 1 unread post, got %d", count)
+	}
+
+	// counted as they're saved and read, once the count is known
+	db.SavePost(testFeedUrl, "Test Post 2", "https://example.com/2", time.Now())
+	db.SavePost(testFeedUrl, "Test Post 2", "https://example.com/2", time.Now())
+	db.SavePost(otherFeedUrl, "Other Post", "https://other.com/1", time.Now())
+	if count, _ = db.GetUnreadCountForUser("testuser"); count != 2 {
+		t.Errorf("Expected 2 unread posts after saving, got %d", count)
+	}
+
+	db.SetReadStatus("testuser", "https://example.com/1", true)
+	db.SetReadStatus("testuser", "https://example.com/1", true)
+	db.SetReadStatus("testuser", "https://other.com/1", true)
+	if count, _ = db.GetUnreadCountForUser("testuser"); count != 1 {
+		t.Errorf("Expected 1 unread post after reading, got %d", count)
+	}
+
+	db.SetReadStatus("testuser", "https://example.com/1", false)
+	if count, _ = db.GetUnreadCountForUser("testuser"); count != 2 {
+		t.Errorf("Expected 2 unread posts after marking unread, got %d", count)
+	}
+
+	// counted again when subscriptions change
+	db.Subscribe("testuser", otherFeedUrl)
+	if count, _ = db.GetUnreadCountForUser("testuser"); count != 2 {
+		t.Errorf("Expected 2 unread posts after subscribing, got %d", count)
+	}
+
+	db.Unsubscribe("testuser", testFeedUrl)
+	if count, _ = db.GetUnreadCountForUser("testuser"); count != 0 {
+		t.Errorf("Expected no unread posts after unsubscribing, got %d", count)
+	}
+}
+
+func TestBlogrollFollow(t *testing.T) {
+	db := createNewTestDB()
+
+	const aliceFeedUrl = "http://alice-feed.com"
+	const bobFeedUrl = "http://bob-feed.com"
+	db.WriteFeed(aliceFeedUrl)
+	db.WriteFeed(bobFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", aliceFeedUrl)
+
+	db.SavePost(aliceFeedUrl, "Alice's Post", "https://alice-feed.com/post", time.Now())
+	db.SavePost(bobFeedUrl, "Bob's Post", "https://bob-feed.com/post", time.Now())
+
+	db.FollowBlogroll("alice", "bob")
+
+	// bob subscribing after alice followed his blogroll still counts
+	db.Subscribe("bob", bobFeedUrl)
+
+	posts := db.GetPostsForUser("alice", 10)
+	if len(posts) != 2 {
+		t.Fatalf("Expected 2 posts on alice's timeline, got %d", len(posts))
+	}
+
+	count, _ := db.GetUnreadCountForUser("alice")
+	if count != 2 {
+		t.Errorf("Expected 2 unread posts, got %d", count)
+	}
+
+	// reading a post from a followed blogroll survives cleaning up orphaned reads
+	db.SetReadStatus("alice", "https://bob-feed.com/post", true)
+	db.DeleteOrphanedPostReads("alice")
+	count, _ = db.GetUnreadCountForUser("alice")
+	if count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+
+	db.UnfollowBlogroll("alice", "bob")
+	posts = db.GetPostsForUser("alice", 10)
+	if len(posts) != 1 {
+		t.Errorf("Expected only alice's own post after unfollowing, got %d", len(posts))
+	}
+}
+
+func TestGetPost(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.SavePostStruct(testFeedUrl, &Post{
+		Title:             "Shared",
+		URL:               "https://example.com/shared",
+		PublishedDatetime: time.Now(),
+	})
+
+	posts := db.GetPostsForFeed(testFeedUrl)
+	if len(posts) != 1 {
+		t.Fatalf("Expected 1 post, got %d", len(posts))
+	}
+
+	post, err := db.GetPost(posts[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if post == nil || post.URL != "https://example.com/shared" || post.FeedURL != testFeedUrl {
+		t.Fatalf("Expected the shared post, got %+v", post)
+	}
+
+	missing, err := db.GetPost(posts[0].ID + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if missing != nil {
+		t.Errorf("Expected no post for an unknown id, got %+v", missing)
+	}
+
+	db.RecommendPost("alice", post.ID)
+	recommenders, err := db.GetPostRecommenders(post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recommenders) != 1 || recommenders[0] != "alice" {
+		t.Errorf("Expected alice to recommend the post, got %v", recommenders)
+	}
+}
+
+func TestPostComments(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.SavePostStruct(testFeedUrl, &Post{
+		Title:             "Shared",
+		URL:               "https://example.com/shared",
+		PublishedDatetime: time.Now(),
+	})
+	postId := db.GetPostsForFeed(testFeedUrl)[0].ID
+
+	db.AddPostComment("alice", postId, "first")
+	db.AddPostComment("bob", postId, "second")
+
+	comments, err := db.GetPostComments(postId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Body != "first" || comments[1].Username != "bob" {
+		t.Fatalf("Expected alice's then bob's comment, got %+v", comments)
+	}
+	if comments[0].PostTitle != "Shared" {
+		t.Errorf("Expected the comment to carry the post title, got '%s'", comments[0].PostTitle)
+	}
+
+	db.DeleteComment(comments[0].ID)
+	if c, _ := db.GetComment(comments[0].ID); c != nil {
+		t.Errorf("Expected the comment to be deleted, got %+v", c)
+	}
+
+	db.DeleteUserComments("bob")
+	recent, err := db.GetRecentComments(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recent) != 0 {
+		t.Errorf("Expected no comments left, got %d", len(recent))
+	}
+}
+
+func TestSiteSettings(t *testing.T) {
+	db := createNewTestDB()
+
+	value, err := db.GetSiteSetting(SettingCommentsEnabled, "true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != "true" {
+		t.Errorf("Expected the default value, got '%s'", value)
+	}
+
+	db.SetSiteSetting(SettingCommentsEnabled, "false")
+	value, _ = db.GetSiteSetting(SettingCommentsEnabled, "true")
+	if value != "false" {
+		t.Errorf("Expected the stored value, got '%s'", value)
+	}
+}
+
+func TestRecommendPost(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.SavePostStruct(testFeedUrl, &Post{
+		Title:             "Recommended",
+		URL:               "https://example.com/recommended",
+		PublishedDatetime: time.Now(),
+	})
+	postId := db.GetPostsForFeed(testFeedUrl)[0].ID
+
+	db.RecommendPost("alice", postId)
+	// recommending twice is a no-op
+	db.RecommendPost("alice", postId)
+
+	recommended, _ := db.IsPostRecommendedBy("alice", postId)
+	if !recommended {
+		t.Errorf("Expected alice to recommend the post")
+	}
+
+	posts, err := db.GetUserRecommendedPosts("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].ID != postId {
+		t.Fatalf("Expected alice's recommended post, got %+v", posts)
+	}
+
+	db.UnrecommendPost("alice", postId)
+	recommended, _ = db.IsPostRecommendedBy("alice", postId)
+	if recommended {
+		t.Errorf("Expected alice to no longer recommend the post")
+	}
+}
+
+func TestActivityPubFollowers(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	privateKey, _, err := db.GetActivityPubKeys("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if privateKey != "" {
+		t.Errorf("Expected alice to have no keys yet")
+	}
+
+	db.SaveActivityPubKeys("alice", "private", "public")
+	// keys are never replaced
+	db.SaveActivityPubKeys("alice", "other private", "other public")
+	privateKey, publicKey, _ := db.GetActivityPubKeys("alice")
+	if privateKey != "private" || publicKey != "public" {
+		t.Errorf("Expected alice's first keys, got '%s' and '%s'", privateKey, publicKey)
+	}
+
+	db.AddActivityPubFollower("alice", "https://a.example/users/bob", "https://a.example/inbox")
+	db.AddActivityPubFollower("alice", "https://a.example/users/carol", "https://a.example/inbox")
+	db.AddActivityPubFollower("alice", "https://b.example/users/dave", "https://b.example/users/dave/inbox")
+
+	count, _ := db.CountActivityPubFollowers("alice")
+	if count != 3 {
+		t.Errorf("Expected 3 followers, got %d", count)
+	}
+
+	inboxes, err := db.GetActivityPubFollowerInboxes("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inboxes) != 2 {
+		t.Errorf("Expected followers to share inboxes, got %v", inboxes)
+	}
+
+	db.RemoveActivityPubFollower("alice", "https://b.example/users/dave")
+	inboxes, _ = db.GetActivityPubFollowerInboxes("alice")
+	if len(inboxes) != 1 || inboxes[0] != "https://a.example/inbox" {
+		t.Errorf("Expected only the shared inbox to be left, got %v", inboxes)
+	}
+}
+
+func TestMastodonAccount(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	app, err := db.GetMastodonApp("mastodon.example")
+	if err != nil || app != nil {
+		t.Fatalf("Expected no app yet, got %+v (%v)", app, err)
+	}
+	db.SaveMastodonApp(&MastodonApp{Instance: "mastodon.example", ClientID: "id", ClientSecret: "secret"})
+	app, _ = db.GetMastodonApp("mastodon.example")
+	if app == nil || app.ClientID != "id" {
+		t.Fatalf("Expected the saved app, got %+v", app)
+	}
+
+	db.SaveMastodonAccount("alice", &MastodonAccount{Instance: "mastodon.example", AccessToken: "token", AccountName: "alice"})
+	db.SetMastodonTootTemplate("alice", "{title}")
+	// reconnecting keeps the template
+	db.SaveMastodonAccount("alice", &MastodonAccount{Instance: "mastodon.example", AccessToken: "new token", AccountName: "alice"})
+
+	account, err := db.GetMastodonAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account == nil || account.AccessToken != "new token" || account.TootTemplate != "{title}" {
+		t.Fatalf("Expected the reconnected account with its template, got %+v", account)
+	}
+
+	db.DeleteMastodonAccount("alice")
+	account, _ = db.GetMastodonAccount("alice")
+	if account != nil {
+		t.Errorf("Expected the account to be disconnected, got %+v", account)
+	}
+}
+
+func TestInstapaperAccount(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	account, err := db.GetInstapaperAccount("alice")
+	if err != nil || account != nil {
+		t.Fatalf("Expected no account yet, got %+v (%v)", account, err)
+	}
+
+	db.SaveInstapaperAccount("alice", &InstapaperAccount{AccountName: "alice@example.com", Token: "token", TokenSecret: "secret"})
+	db.SaveInstapaperAccount("alice", &InstapaperAccount{AccountName: "alice@example.org", Token: "new token", TokenSecret: "new secret"})
+
+	account, err = db.GetInstapaperAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account == nil || account.AccountName != "alice@example.org" || account.Token != "new token" || account.TokenSecret != "new secret" {
+		t.Fatalf("Expected the reconnected account, got %+v", account)
+	}
+
+	db.DeleteInstapaperAccount("alice")
+	account, _ = db.GetInstapaperAccount("alice")
+	if account != nil {
+		t.Errorf("Expected the account to be disconnected, got %+v", account)
+	}
+}
+
+func TestWallabagAccount(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	account, err := db.GetWallabagAccount("alice")
+	if err != nil || account != nil {
+		t.Fatalf("Expected no account yet, got %+v (%v)", account, err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour).Truncate(time.Second)
+	db.SaveWallabagAccount("alice", &WallabagAccount{
+		Instance:     "https://wallabag.example.com",
+		ClientID:     "id",
+		ClientSecret: "secret",
+		AccountName:  "alice",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    expiresAt,
+	})
+
+	account, err = db.GetWallabagAccount("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account == nil || account.ClientSecret != "secret" || account.AccessToken != "access" || !account.ExpiresAt.Equal(expiresAt) {
+		t.Fatalf("Expected the saved account, got %+v", account)
+	}
+
+	refreshedAt := expiresAt.Add(time.Hour)
+	db.SetWallabagTokens("alice", "access2", "refresh2", refreshedAt)
+	account, _ = db.GetWallabagAccount("alice")
+	if account.AccessToken != "access2" || account.RefreshToken != "refresh2" || !account.ExpiresAt.Equal(refreshedAt) {
+		t.Errorf("Expected the refreshed tokens, got %+v", account)
+	}
+
+	db.DeleteWallabagAccount("alice")
+	account, _ = db.GetWallabagAccount("alice")
+	if account != nil {
+		t.Errorf("Expected the account to be disconnected, got %+v", account)
+	}
+}
+
+func TestKindleAddress(t *testing.T) {
+	db := createNewTestDB()
+
+	db.AddUser("alice", "testpass")
+
+	if email, _ := db.GetKindleAddress("alice"); email != "" {
+		t.Errorf("Expected no kindle address by default, got '%s'", email)
+	}
+
+	db.SetKindleAddress("alice", "alice@kindle.com")
+	db.SetKindleAddress("alice", "alice_2@kindle.com")
+	if email, _ := db.GetKindleAddress("alice"); email != "alice_2@kindle.com" {
+		t.Errorf("Expected the kindle address to be updated, got '%s'", email)
+	}
+
+	db.RemoveKindleAddress("alice")
+	if email, _ := db.GetKindleAddress("alice"); email != "" {
+		t.Errorf("Expected the kindle address to be removed, got '%s'", email)
+	}
+}
+
+func TestNtfySubscription(t *testing.T) {
+	db := createNewTestDB()
+
+	const favoriteFeedUrl = "http://favorite.com"
+	const otherFeedUrl = "http://other.com"
+	db.WriteFeed(favoriteFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", favoriteFeedUrl)
+	db.Subscribe("alice", otherFeedUrl)
+	db.SetFeedFavoriteStatus("alice", favoriteFeedUrl, true)
+
+	if sub, _ := db.GetNtfySubscription("alice"); sub != nil {
+		t.Errorf("Expected no ntfy subscription by default, got %v", sub)
+	}
+
+	// posts from before subscribing aren't notified about
+	db.SavePost(favoriteFeedUrl, "Old", "https://favorite.com/old", time.Now())
+
+	err := db.SetNtfySubscription("alice", "https://ntfy.sh/alice", true, []string{"rust", "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.SavePost(favoriteFeedUrl, "New", "https://favorite.com/new", time.Now())
+	db.SavePost(otherFeedUrl, "Other", "https://other.com/1", time.Now())
+
+	sub, err := db.GetNtfySubscription("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.TopicURL != "https://ntfy.sh/alice" || !sub.NotifyFavorites || len(sub.Keywords) != 2 || sub.Keywords[1] != "go" {
+		t.Fatalf("Expected the subscription to be saved, got %v", sub)
+	}
+
+	latest, _ := db.GetLatestPostID()
+	posts, err := db.GetNewSubscribedPosts("alice", sub.LastPostID, latest, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].Title != "New" || !posts[0].IsFavorite || posts[1].IsFavorite {
+		t.Fatalf("Expected the two new posts, got %v", posts)
+	}
+
+	db.SetNtfyLastPostID("alice", latest)
+
+	// changing the topic doesn't notify about posts again
+	db.SetNtfySubscription("alice", "https://ntfy.sh/alice2", false, nil)
+	sub, _ = db.GetNtfySubscription("alice")
+	if sub.LastPostID != latest || sub.NotifyFavorites || len(sub.Keywords) != 0 {
+		t.Errorf("Expected the subscription to be updated, got %v", sub)
+	}
+
+	subs, _ := db.GetNtfySubscriptions()
+	if len(subs) != 1 || subs[0].Username != "alice" {
+		t.Errorf("Expected alice to be the only subscription, got %v", subs)
+	}
+
+	db.RemoveNtfySubscription("alice")
+	if sub, _ := db.GetNtfySubscription("alice"); sub != nil {
+		t.Errorf("Expected the subscription to be removed, got %v", sub)
+	}
+}
+
+func TestDiscordWebhooks(t *testing.T) {
+	db := createNewTestDB()
+
+	const subscribedFeedUrl = "http://subscribed.com"
+	const collectedFeedUrl = "http://collected.com"
+	db.WriteFeed(subscribedFeedUrl)
+	db.WriteFeed(collectedFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", subscribedFeedUrl)
+	db.SaveCollection(&Collection{Username: "alice", Slug: "friends", Name: "Friends", FeedURLs: []string{collectedFeedUrl}})
+
+	db.SavePost(subscribedFeedUrl, "Old", "https://subscribed.com/old", time.Now())
+
+	if err := db.SetDiscordWebhook("alice", "https://discord.com/api/webhooks/1/a", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetDiscordWebhook("alice", "https://discord.com/api/webhooks/2/b", "friends"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetDiscordWebhook("alice", "https://discord.com/api/webhooks/3/c", "nope"); err == nil {
+		t.Errorf("Expected a webhook for an unknown collection to be refused")
+	}
+
+	db.SavePost(subscribedFeedUrl, "Subscribed", "https://subscribed.com/1", time.Now())
+	db.SavePost(collectedFeedUrl, "Collected", "https://collected.com/1", time.Now())
+
+	webhooks, err := db.GetUserDiscordWebhooks("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 2 || webhooks[0].CollectionSlug != "" || webhooks[1].CollectionName != "Friends" {
+		t.Fatalf("Expected a webhook for all feeds and one for the collection, got %v", webhooks)
+	}
+
+	latest, _ := db.GetLatestPostID()
+	posts, _ := db.GetPostsForDiscordWebhook(webhooks[0].ID, webhooks[0].LastPostID, latest, 10)
+	if len(posts) != 1 || posts[0].Title != "Subscribed" {
+		t.Errorf("Expected the webhook for all feeds to get the new subscribed post, got %v", posts)
+	}
+	posts, _ = db.GetPostsForDiscordWebhook(webhooks[1].ID, webhooks[1].LastPostID, latest, 10)
+	if len(posts) != 1 || posts[0].Title != "Collected" {
+		t.Errorf("Expected the collection webhook to get the new collected post, got %v", posts)
+	}
+
+	db.SetDiscordWebhookLastPostID(webhooks[0].ID, latest)
+	webhooks, _ = db.GetDiscordWebhooks()
+	if len(webhooks) != 2 || webhooks[0].LastPostID != latest {
+		t.Errorf("Expected the progress of the webhook to be saved, got %v", webhooks)
+	}
+
+	// deleting a collection deletes its webhook
+	db.DeleteCollection("alice", "friends")
+	webhooks, _ = db.GetUserDiscordWebhooks("alice")
+	if len(webhooks) != 1 {
+		t.Fatalf("Expected only the webhook for all feeds to be left, got %v", webhooks)
+	}
+
+	db.RemoveDiscordWebhook("alice", webhooks[0].ID)
+	if webhooks, _ := db.GetUserDiscordWebhooks("alice"); len(webhooks) != 0 {
+		t.Errorf("Expected no webhooks left, got %v", webhooks)
+	}
+}
+
+func TestSlackWebhooks(t *testing.T) {
+	db := createNewTestDB()
+
+	const subscribedFeedUrl = "http://subscribed.com"
+	const collectedFeedUrl = "http://collected.com"
+	const otherFeedUrl = "http://other.com"
+	db.WriteFeed(subscribedFeedUrl)
+	db.WriteFeed(collectedFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", subscribedFeedUrl)
+	db.SaveCollection(&Collection{Username: "alice", Slug: "friends", Name: "Friends", FeedURLs: []string{collectedFeedUrl}})
+
+	db.SavePost(subscribedFeedUrl, "Old", "https://subscribed.com/old", time.Now())
+
+	if err := db.SetSlackWebhook("alice", "https://hooks.slack.com/services/T1/B1/a", "friends"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetInstanceSlackWebhook("https://hooks.slack.com/services/T1/B2/b"); err != nil {
+		t.Fatal(err)
+	}
+
+	db.SavePost(subscribedFeedUrl, "Subscribed", "https://subscribed.com/1", time.Now())
+	db.SavePost(collectedFeedUrl, "Collected", "https://collected.com/1", time.Now())
+	db.SavePost(otherFeedUrl, "Other", "https://other.com/1", time.Now())
+
+	webhooks, _ := db.GetUserSlackWebhooks("alice")
+	if len(webhooks) != 1 || webhooks[0].CollectionName != "Friends" {
+		t.Fatalf("Expected alice's webhook for the collection, got %v", webhooks)
+	}
+	instance, err := db.GetInstanceSlackWebhook()
+	if err != nil || instance == nil || instance.Username != "" {
+		t.Fatalf("Expected the instance's webhook, got %v %v", instance, err)
+	}
+
+	latest, _ := db.GetLatestPostID()
+	posts, _ := db.GetPostsForSlackWebhook(webhooks[0].ID, webhooks[0].LastPostID, latest, 10)
+	if len(posts) != 1 || posts[0].Title != "Collected" {
+		t.Errorf("Expected the collection webhook to get the new collected post, got %v", posts)
+	}
+	posts, _ = db.GetPostsForSlackWebhook(instance.ID, instance.LastPostID, latest, 10)
+	if len(posts) != 3 {
+		t.Errorf("Expected the instance's webhook to get every new post, got %v", posts)
+	}
+
+	if webhooks, _ := db.GetSlackWebhooks(); len(webhooks) != 2 {
+		t.Errorf("Expected both webhooks, got %v", webhooks)
+	}
+
+	db.DeleteCollection("alice", "friends")
+	db.RemoveInstanceSlackWebhook()
+	if webhooks, _ := db.GetSlackWebhooks(); len(webhooks) != 0 {
+		t.Errorf("Expected no webhooks left, got %v", webhooks)
+	}
+}
+
+func TestOutgoingWebhooks(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://feed.com"
+	const brokenFeedUrl = "http://broken.com"
+	db.WriteFeed(feedUrl)
+	db.WriteFeed(brokenFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+	db.Subscribe("alice", brokenFeedUrl)
+	db.SetFeedFetchError(brokenFeedUrl, "404")
+
+	err := db.AddOutgoingWebhook("alice", "https://example.com/hook", "secret", []string{"new_post", "feed_error"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	webhooks, err := db.GetUserOutgoingWebhooks("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(webhooks) != 1 || !webhooks[0].HasEvent("feed_error") || webhooks[0].HasEvent("favorite") {
+		t.Fatalf("Expected the webhook to be saved with its events, got %v", webhooks)
+	}
+	webhook := webhooks[0]
+
+	// feeds that were already failing aren't reported
+	if feeds, _ := db.GetNewlyFailingFeeds(webhook.ID); len(feeds) != 0 {
+		t.Errorf("Expected no newly failing feeds, got %v", feeds)
+	}
+
+	db.SetFeedFetchError(feedUrl, "timeout")
+	feeds, err := db.GetNewlyFailingFeeds(webhook.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != feedUrl || feeds[0].Error != "timeout" {
+		t.Fatalf("Expected the feed that started failing, got %v", feeds)
+	}
+	db.MarkFeedFailureReported(webhook.ID, feedUrl)
+	if feeds, _ := db.GetNewlyFailingFeeds(webhook.ID); len(feeds) != 0 {
+		t.Errorf("Expected the failure to only be reported once, got %v", feeds)
+	}
+
+	// a feed that recovers and breaks again is reported again
+	db.SetFeedFetchError(feedUrl, "")
+	db.ForgetRecoveredFeeds(webhook.ID)
+	db.SetFeedFetchError(feedUrl, "timeout again")
+	if feeds, _ := db.GetNewlyFailingFeeds(webhook.ID); len(feeds) != 1 {
+		t.Errorf("Expected the feed to be reported again, got %v", feeds)
+	}
+
+	db.QueueWebhookDelivery(webhook.ID, "new_post", `{"event":"new_post"}`)
+	due, err := db.GetDueWebhookDeliveries(time.Now(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 1 || due[0].URL != "https://example.com/hook" || due[0].Secret != "secret" {
+		t.Fatalf("Expected the queued delivery to be due, got %v", due)
+	}
+
+	// a failed attempt is retried later
+	db.RecordWebhookDeliveryAttempt(due[0].ID, WebhookDeliveryPending, time.Now().Add(time.Hour), "500")
+	if due, _ := db.GetDueWebhookDeliveries(time.Now(), 10); len(due) != 0 {
+		t.Errorf("Expected the delivery to wait before being retried, got %v", due)
+	}
+	due, _ = db.GetDueWebhookDeliveries(time.Now().Add(2*time.Hour), 10)
+	if len(due) != 1 || due[0].Attempts != 1 || due[0].LastError != "500" {
+		t.Fatalf("Expected the delivery to be retried later, got %v", due)
+	}
+
+	db.RecordWebhookDeliveryAttempt(due[0].ID, WebhookDeliveryDelivered, time.Now(), "")
+	recent, _ := db.GetRecentWebhookDeliveries("alice", 10)
+	if len(recent) != 1 || recent[0].Status != WebhookDeliveryDelivered || recent[0].Secret != "" {
+		t.Errorf("Expected the delivery to be marked as delivered, got %v", recent)
+	}
+
+	db.DeleteOldWebhookDeliveries(time.Now().Add(time.Hour))
+	if recent, _ := db.GetRecentWebhookDeliveries("alice", 10); len(recent) != 0 {
+		t.Errorf("Expected old deliveries to be deleted, got %v", recent)
+	}
+
+	db.RemoveOutgoingWebhook("alice", webhook.ID)
+	if webhooks, _ := db.GetOutgoingWebhooks(); len(webhooks) != 0 {
+		t.Errorf("Expected the webhook to be removed, got %v", webhooks)
+	}
+}
+
+func TestMatrixNotification(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://feed.com"
+	const brokenFeedUrl = "http://broken.com"
+	db.WriteFeed(feedUrl)
+	db.WriteFeed(brokenFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+	db.Subscribe("alice", brokenFeedUrl)
+	db.SetFeedFetchError(brokenFeedUrl, "404")
+	db.SavePost(feedUrl, "Old", "https://feed.com/old", time.Now())
+
+	if n, _ := db.GetMatrixNotification("alice"); n != nil {
+		t.Errorf("Expected no matrix notifications by default, got %v", n)
+	}
+
+	err := db.SetMatrixNotification(&MatrixNotification{
+		Username:     "alice",
+		Homeserver:   "https://matrix.org",
+		AccessToken:  "token",
+		RoomID:       "!abc:matrix.org",
+		Posts:        MatrixPostsFavorites,
+		FeedFailures: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := db.GetMatrixNotification("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := db.GetLatestPostID()
+	if n.RoomID != "!abc:matrix.org" || n.Posts != MatrixPostsFavorites || !n.FeedFailures || n.LastPostID != latest {
+		t.Fatalf("Expected the matrix notification to be saved, got %v", n)
+	}
+
+	// feeds that were already failing aren't reported
+	if feeds, _ := db.GetNewlyFailingFeedsForMatrix("alice"); len(feeds) != 0 {
+		t.Errorf("Expected no newly failing feeds, got %v", feeds)
+	}
+
+	db.SetFeedFetchError(feedUrl, "timeout")
+	feeds, err := db.GetNewlyFailingFeedsForMatrix("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != feedUrl {
+		t.Fatalf("Expected the feed that started failing, got %v", feeds)
+	}
+	db.MarkMatrixFeedFailuresReported("alice", feeds)
+	if feeds, _ := db.GetNewlyFailingFeedsForMatrix("alice"); len(feeds) != 0 {
+		t.Errorf("Expected the failure to only be reported once, got %v", feeds)
+	}
+
+	// a feed that recovers and breaks again is reported again
+	db.SetFeedFetchError(feedUrl, "")
+	db.GetNewlyFailingFeedsForMatrix("alice")
+	db.SetFeedFetchError(feedUrl, "timeout again")
+	if feeds, _ := db.GetNewlyFailingFeedsForMatrix("alice"); len(feeds) != 1 {
+		t.Errorf("Expected the feed to be reported again, got %v", feeds)
+	}
+
+	db.SetMatrixLastPostID("alice", latest+5)
+	notifications, _ := db.GetMatrixNotifications()
+	if len(notifications) != 1 || notifications[0].LastPostID != latest+5 {
+		t.Errorf("Expected the progress to be saved, got %v", notifications)
+	}
+
+	db.RemoveMatrixNotification("alice")
+	if n, _ := db.GetMatrixNotification("alice"); n != nil {
+		t.Errorf("Expected the matrix notification to be removed, got %v", n)
+	}
+}
+
+func TestMatchesKeyword(t *testing.T) {
+	for _, c := range []struct {
+		title    string
+		keyword  string
+		expected bool
+	}{
+		{"Learning Go in 2024", "go", true},
+		{"A good day", "go", false},
+		{"Go, go, go!", "go", true},
+		{"Notes on sourdough", "Sourdough", true},
+		{"Machine learning for cats", "machine learning", true},
+		{"Écoles de Paris", "école", false},
+		{"Les écoles", "écoles", true},
+		{"anything", " ", false},
+	} {
+		if got := MatchesKeyword(c.title, c.keyword); got != c.expected {
+			t.Errorf("Expected MatchesKeyword(%q, %q) to be %v", c.title, c.keyword, c.expected)
+		}
+	}
+}
+
+func TestKeywordAlerts(t *testing.T) {
+	db := createNewTestDB()
+
+	const myFeedUrl = "http://mine.com"
+	const otherFeedUrl = "http://other.com"
+	const hiddenFeedUrl = "http://hidden.com"
+	db.WriteFeed(myFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.WriteFeed(hiddenFeedUrl)
+	db.SetFeedHiddenFromDiscover(hiddenFeedUrl, true)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", myFeedUrl)
+
+	db.AddKeywordAlert("alice", "rust", AlertScopeMine, true)
+	db.AddKeywordAlert("alice", "sourdough", AlertScopeAll, false)
+
+	alerts, err := db.GetUserKeywordAlerts("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 2 || alerts[0].Keyword != "rust" || !alerts[0].Notify || alerts[1].Scope != AlertScopeAll {
+		t.Fatalf("Expected both alerts to be saved, got %v", alerts)
+	}
+
+	db.SavePost(myFeedUrl, "Rewriting it in Rust", "https://mine.com/1", time.Now())
+	db.SavePost(otherFeedUrl, "Why Rust", "https://other.com/1", time.Now())
+	db.SavePost(otherFeedUrl, "My sourdough starter", "https://other.com/2", time.Now())
+	db.SavePost(hiddenFeedUrl, "Buy sourdough now", "https://hidden.com/1", time.Now())
+	// saving a post again doesn't match it again
+	db.SavePost(myFeedUrl, "Rewriting it in Rust", "https://mine.com/1", time.Now())
+
+	matches, err := db.GetKeywordAlertMatches("alice", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matches) != 2 {
+		t.Fatalf("Expected a match from alice's feed and one from everywhere, got %v", matches)
+	}
+	for _, m := range matches {
+		if m.URL == "https://other.com/1" || m.URL == "https://hidden.com/1" {
+			t.Errorf("Expected '%s' to not match", m.URL)
+		}
+	}
+
+	unnotified, _ := db.GetUnnotifiedKeywordAlertMatches("alice")
+	if len(unnotified) != 1 || unnotified[0].Keyword != "rust" {
+		t.Fatalf("Expected only the match of the alert that notifies, got %v", unnotified)
+	}
+	if users, _ := db.GetUsersWithUnnotifiedKeywordAlerts(); len(users) != 1 || users[0] != "alice" {
+		t.Errorf("Expected alice to have matches waiting, got %v", users)
+	}
+	db.MarkKeywordAlertMatchesNotified(unnotified)
+	if users, _ := db.GetUsersWithUnnotifiedKeywordAlerts(); len(users) != 0 {
+		t.Errorf("Expected no matches waiting, got %v", users)
+	}
+
+	db.RemoveKeywordAlert("alice", alerts[0].ID)
+	if matches, _ := db.GetKeywordAlertMatches("alice", 10); len(matches) != 1 {
+		t.Errorf("Expected the matches of the removed alert to go away, got %v", matches)
+	}
+
+	db.ClearKeywordAlertMatches("alice")
+	if matches, _ := db.GetKeywordAlertMatches("alice", 10); len(matches) != 0 {
+		t.Errorf("Expected the matches to be cleared, got %v", matches)
+	}
+}
+
+func TestFeedNotify(t *testing.T) {
+	db := createNewTestDB()
+
+	const notifyFeedUrl = "http://notify.com"
+	const otherFeedUrl = "http://other.com"
+	db.WriteFeed(notifyFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", notifyFeedUrl)
+	db.Subscribe("alice", otherFeedUrl)
+
+	for _, feed := range db.GetUserFeedURLsForSettings("alice") {
+		if feed.Notify {
+			t.Errorf("Expected feeds not to notify by default, got %v", feed)
+		}
+	}
+
+	db.SavePost(notifyFeedUrl, "Old", "https://notify.com/old", time.Now())
+
+	// addresses start from the posts saved after they're set
+	db.SetDigestEmail("alice", "alice@example.com", "token")
+	recipients, _ := db.GetDigestRecipients()
+	oldLatest, _ := db.GetLatestPostID()
+	if len(recipients) != 1 || recipients[0].NotifyLastPostID != oldLatest {
+		t.Fatalf("Expected the notification emails to start from the latest post, got %v", recipients)
+	}
+
+	err := db.SetFeedNotify("alice", notifyFeedUrl, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, feed := range db.GetUserFeedURLsForSettings("alice") {
+		if feed.Notify != (feed.URL == notifyFeedUrl) {
+			t.Errorf("Expected only %s to notify, got %v", notifyFeedUrl, feed)
+		}
+	}
+
+	db.SavePost(notifyFeedUrl, "New", "https://notify.com/new", time.Now())
+	db.SavePost(otherFeedUrl, "Other", "https://other.com/1", time.Now())
+
+	latest, _ := db.GetLatestPostID()
+	posts, err := db.GetNewSubscribedPosts("alice", recipients[0].NotifyLastPostID, latest, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 2 || posts[0].Title != "New" || !posts[0].Notify || posts[1].Notify {
+		t.Fatalf("Expected the new post from %s to be flagged, got %v", notifyFeedUrl, posts)
+	}
+
+	db.SetEmailNotifyLastPostID("alice", latest)
+	recipients, _ = db.GetDigestRecipients()
+	if recipients[0].NotifyLastPostID != latest {
+		t.Errorf("Expected the progress to be saved, got %d", recipients[0].NotifyLastPostID)
+	}
+
+	db.SetFeedNotify("alice", notifyFeedUrl, false)
+	for _, feed := range db.GetUserFeedURLsForSettings("alice") {
+		if feed.Notify {
+			t.Errorf("Expected notifications to be turned off, got %v", feed)
+		}
+	}
+}
+
+func TestPostStars(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://example.com"
+	db.WriteFeed(feedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+	db.SavePost(feedUrl, "First", "https://example.com/1", time.Now())
+	db.SavePost(feedUrl, "Second", "https://example.com/2", time.Now())
+
+	latest, _ := db.GetLatestPostID()
+	first, _ := db.GetPost(latest - 1)
+	second, _ := db.GetPost(latest)
+
+	if star, err := db.GetPostStar("alice", first.ID); err != nil || star != nil {
+		t.Fatalf("Expected no star yet, got %+v (%v)", star, err)
+	}
+
+	db.StarPost("alice", first, "a quote", "")
+	db.StarPost("alice", second, "", "")
+	db.StarPost("alice", first, "a better quote", "a note")
+
+	star, err := db.GetPostStar("alice", first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if star == nil || star.Title != "First" || star.FeedURL != feedUrl || star.Quote != "a better quote" || star.Note != "a note" {
+		t.Fatalf("Expected the updated star, got %+v", star)
+	}
+
+	stars, _ := db.GetPostStars("alice")
+	if len(stars) != 2 {
+		t.Fatalf("Expected two stars, got %d", len(stars))
+	}
+
+	// nothing is sent to readwise before an account is connected, but what
+	// was starred before is sent once it is
+	if c, _ := db.GetReadwiseConnection("alice"); c != nil {
+		t.Errorf("Expected no readwise account yet, got %+v", c)
+	}
+	db.SetReadwiseToken("alice", "token")
+	connections, _ := db.GetReadwiseConnections()
+	if len(connections) != 1 || connections[0].Token != "token" || connections[0].LastSyncedAt != nil {
+		t.Fatalf("Expected alice's readwise account, got %v", connections)
+	}
+
+	unsynced, _ := db.GetUnsyncedPostStars("alice", 10)
+	if len(unsynced) != 2 || unsynced[0].PostID != second.ID {
+		t.Fatalf("Expected both stars to be unsynced, oldest change first, got %v", unsynced)
+	}
+
+	db.MarkPostStarsSynced("alice", unsynced)
+	if unsynced, _ := db.GetUnsyncedPostStars("alice", 10); len(unsynced) != 0 {
+		t.Errorf("Expected every star to be synced, got %v", unsynced)
+	}
+
+	// changing a star sends it again
+	time.Sleep(10 * time.Millisecond)
+	db.StarPost("alice", second, "", "changed my mind")
+	unsynced, _ = db.GetUnsyncedPostStars("alice", 10)
+	if len(unsynced) != 1 || unsynced[0].Note != "changed my mind" {
+		t.Errorf("Expected the changed star to be unsynced, got %v", unsynced)
+	}
+
+	db.SetReadwiseSyncResult("alice", time.Now(), "")
+	db.SetReadwiseSyncResult("alice", time.Now(), "boom")
+	c, _ := db.GetReadwiseConnection("alice")
+	if c.LastSyncedAt == nil || c.LastError != "boom" {
+		t.Errorf("Expected the sync results to be saved, got %+v", c)
+	}
+
+	// stars outlive their posts
+	db.UnsubscribeAll("alice")
+	db.DeleteOrphanFeeds()
+	stars, _ = db.GetPostStars("alice")
+	if len(stars) != 2 {
+		t.Errorf("Expected the stars to be kept, got %d", len(stars))
+	}
+
+	db.UnstarPost("alice", first.ID)
+	db.RemoveReadwiseToken("alice")
+	stars, _ = db.GetPostStars("alice")
+	if len(stars) != 1 || stars[0].PostID != second.ID {
+		t.Errorf("Expected only the second star to be left, got %v", stars)
+	}
+	if c, _ := db.GetReadwiseConnection("alice"); c != nil {
+		t.Errorf("Expected the readwise account to be disconnected, got %+v", c)
+	}
+}
+
+func TestBookmarkService(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	service, err := db.GetBookmarkService("alice")
+	if err != nil || service != nil {
+		t.Fatalf("Expected no bookmark service yet, got %+v (%v)", service, err)
+	}
+
+	db.SetBookmarkService("alice", &BookmarkService{Service: "linkding", Instance: "https://links.example.com", Token: "token", Tags: []string{"mire", "reading"}})
+	db.SetBookmarkServiceError("alice", "boom")
+
+	service, _ = db.GetBookmarkService("alice")
+	if service == nil || service.Token != "token" || len(service.Tags) != 2 || service.Tags[1] != "reading" || service.LastError != "boom" {
+		t.Fatalf("Expected the saved service, got %+v", service)
+	}
+
+	// connecting again forgets the last error
+	db.SetBookmarkService("alice", &BookmarkService{Service: "shaarli", Instance: "https://example.com/shaarli", Token: "secret"})
+	service, _ = db.GetBookmarkService("alice")
+	if service.Service != "shaarli" || len(service.Tags) != 0 || service.LastError != "" {
+		t.Errorf("Expected the service to be replaced, got %+v", service)
+	}
+
+	db.RemoveBookmarkService("alice")
+	if service, _ := db.GetBookmarkService("alice"); service != nil {
+		t.Errorf("Expected the service to be removed, got %+v", service)
+	}
+}
+
+func TestPostMedia(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw"
+	db.WriteFeed(feedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+	db.SetFeedFavoriteStatus("alice", feedUrl, true)
+	db.SavePostStruct(feedUrl, &Post{
+		Title:             "A video",
+		URL:               "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+		PublishedDatetime: time.Now().UTC(),
+		ThumbnailURL:      "https://i3.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg",
+		Duration:          213,
+		CommentsURL:       "https://www.reddit.com/r/videos/comments/abc123/a_video/",
+	})
+	db.SavePost(feedUrl, "A post", "https://example.com/post", time.Now().UTC().Add(-time.Hour))
+
+	entries := db.GetPostsForUser("alice", 10)
+	if len(entries) != 2 {
+		t.Fatalf("Expected two posts, got %d", len(entries))
+	}
+	if entries[0].ThumbnailURL != "https://i3.ytimg.com/vi/dQw4w9WgXcQ/hqdefault.jpg" || entries[0].Duration != 213 {
+		t.Errorf("Expected the video's thumbnail and duration, got %+v", entries[0])
+	}
+	if entries[1].ThumbnailURL != "" || entries[1].Duration != 0 {
+		t.Errorf("Expected no thumbnail nor duration for the post, got %+v", entries[1])
+	}
+
+	favorites, err := db.GetFavoriteUnreadPosts("alice", 10)
+	if err != nil || len(favorites) != 2 || favorites[1].Duration != 213 {
+		t.Errorf("Expected the video's duration among unread favorites, got %+v (%v)", favorites, err)
+	}
+
+	if entries[0].CommentsURL != "https://www.reddit.com/r/videos/comments/abc123/a_video/" || entries[1].CommentsURL != "" {
+		t.Errorf("Expected only the video to have comments, got '%s' and '%s'", entries[0].CommentsURL, entries[1].CommentsURL)
+	}
+
+	post, err := db.GetPost(entries[0].PostID)
+	if err != nil || post.ThumbnailURL != entries[0].ThumbnailURL || post.Duration != 213 || post.CommentsURL != entries[0].CommentsURL {
+		t.Errorf("Expected the video's thumbnail and duration, got %+v (%v)", post, err)
+	}
+}
+
+func TestPostArticles(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "https://www.reddit.com/r/rss/.rss"
+	db.WriteFeed(feedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+
+	// two discussions of the same article are two posts
+	for i, discussion := range []string{"abc123", "def456"} {
+		db.SavePostStruct(feedUrl, &Post{
+			Title:             "An article",
+			URL:               "https://www.reddit.com/r/rss/comments/" + discussion + "/an_article/",
+			PublishedDatetime: time.Now().UTC().Add(-time.Duration(i) * time.Hour),
+			ArticleURL:        "https://example.com/article",
+		})
+	}
+
+	entries := db.GetPostsForUser("alice", 10)
+	if len(entries) != 2 {
+		t.Fatalf("Expected both discussions, got %d posts", len(entries))
+	}
+	for _, entry := range entries {
+		if entry.ArticleURL != "https://example.com/article" || entry.Domain != "example.com" {
+			t.Errorf("Expected the post to be about the article on example.com, got '%s' on '%s'", entry.ArticleURL, entry.Domain)
+		}
+	}
+
+	post, err := db.GetPost(entries[0].PostID)
+	if err != nil || post.URL != "https://www.reddit.com/r/rss/comments/abc123/an_article/" || post.ArticleURL != "https://example.com/article" {
+		t.Errorf("Expected the discussion and its article, got %+v (%v)", post, err)
+	}
+}
+
+func TestMoveSubscription(t *testing.T) {
+	db := createNewTestDB()
+
+	const (
+		withoutReplies = "https://example.social/@alice.rss"
+		withReplies    = "https://example.social/@alice/with_replies.rss"
+	)
+	db.WriteFeed(withoutReplies)
+	db.WriteFeed(withReplies)
+	db.AddUser("bob", "testpass")
+	db.AddUser("carol", "testpass")
+
+	db.Subscribe("bob", withoutReplies)
+	db.SetFeedFavoriteStatus("bob", withoutReplies, true)
+	db.SetFeedNotify("bob", withoutReplies, true)
+
+	err := db.MoveSubscription("bob", withoutReplies, withReplies)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	feeds := db.GetUserFeedURLsForSettings("bob")
+	if len(feeds) != 1 || feeds[0].URL != withReplies || !feeds[0].IsFavorite || !feeds[0].Notify {
+		t.Errorf("Expected the subscription to move with its settings, got %+v", feeds)
+	}
+
+	// already subscribed to both
+	db.Subscribe("carol", withoutReplies)
+	db.Subscribe("carol", withReplies)
+	err = db.MoveSubscription("carol", withoutReplies, withReplies)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls := db.GetUserFeedURLs("carol"); len(urls) != 1 || urls[0] != withReplies {
+		t.Errorf("Expected a single subscription left, got %v", urls)
+	}
+}
+
+func TestPushSubscriptions(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://example.com"
+	db.WriteFeed(feedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", feedUrl)
+
+	db.SavePost(feedUrl, "Old", "https://example.com/old", time.Now())
+
+	if err := db.AddPushSubscription("alice", "https://push.example/phone", "key1", "auth1"); err != nil {
+		t.Fatal(err)
+	}
+	db.AddPushSubscription("alice", "https://push.example/laptop", "key2", "auth2")
+
+	subs, err := db.GetUserPushSubscriptions("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	latest, _ := db.GetLatestPostID()
+	if len(subs) != 2 || subs[0].Endpoint != "https://push.example/phone" || subs[0].LastPostID != latest {
+		t.Fatalf("Expected both browsers, only notified about new posts, got %v", subs)
+	}
+
+	// the same browser subscribing again replaces its subscription
+	db.AddPushSubscription("alice", "https://push.example/phone", "key3", "auth3")
+	subs, _ = db.GetUserPushSubscriptions("alice")
+	if len(subs) != 2 || subs[0].P256dh != "key3" || subs[0].Auth != "auth3" {
+		t.Errorf("Expected the phone's keys to be replaced, got %v", subs)
+	}
+
+	db.SetPushSubscriptionLastPostID(subs[0].ID, latest+1)
+	db.RemovePushSubscription("bob", "https://push.example/laptop")
+	db.DeletePushSubscription(subs[0].ID + 100)
+
+	subs, _ = db.GetPushSubscriptions()
+	if len(subs) != 2 || subs[0].LastPostID != latest+1 {
+		t.Errorf("Expected others not to remove alice's browsers, got %v", subs)
+	}
+
+	db.RemovePushSubscription("alice", "https://push.example/laptop")
+	db.DeletePushSubscription(subs[0].ID)
+	if subs, _ := db.GetPushSubscriptions(); len(subs) != 0 {
+		t.Errorf("Expected no subscriptions left, got %v", subs)
+	}
+}
+
+func TestIndieAuth(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	err := db.SaveIndieAuthCode("code1", &IndieAuthCode{
+		Username:      "alice",
+		ClientID:      "https://reader.example/",
+		RedirectURI:   "https://reader.example/callback",
+		CodeChallenge: "challenge",
+		Scope:         "read follow",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := db.RedeemIndieAuthCode("code1", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code == nil || code.Username != "alice" || code.RedirectURI != "https://reader.example/callback" || code.Scope != "read follow" {
+		t.Fatalf("Expected the code to be redeemed, got %+v", code)
+	}
+	if code, _ := db.RedeemIndieAuthCode("code1", 10); code != nil {
+		t.Errorf("Expected codes to only be redeemed once, got %+v", code)
+	}
+
+	// expired codes can't be redeemed
+	db.SaveIndieAuthCode("code2", &IndieAuthCode{Username: "alice", ClientID: "https://reader.example/"})
+	db.sql.Exec("UPDATE indieauth_code SET created_at = datetime('now', '-11 minutes') WHERE code = 'code2'")
+	if code, _ := db.RedeemIndieAuthCode("code2", 10); code != nil {
+		t.Errorf("Expected expired codes not to be redeemed, got %+v", code)
+	}
+
+	db.AddIndieAuthToken("alice", "https://reader.example/", "read", "token1")
+	db.AddIndieAuthToken("alice", "https://other.example/", "read follow", "token2")
+
+	token, err := db.GetIndieAuthToken("token1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == nil || token.Username != "alice" || token.Scope != "read" || !token.LastUsedAt.IsZero() {
+		t.Fatalf("Expected alice's token, never used, got %+v", token)
+	}
+	db.TouchIndieAuthToken(token.ID)
+	if token, _ := db.GetIndieAuthToken("token1"); token.LastUsedAt.IsZero() {
+		t.Errorf("Expected the token to have been used")
+	}
+	if token, _ := db.GetIndieAuthToken("nope"); token != nil {
+		t.Errorf("Expected no token, got %+v", token)
+	}
+
+	tokens, _ := db.GetUserIndieAuthTokens("alice")
+	if len(tokens) != 2 || tokens[0].ClientID != "https://other.example/" {
+		t.Fatalf("Expected both apps, newest first, got %v", tokens)
+	}
+
+	db.RevokeIndieAuthToken("alice", tokens[0].ID)
+	db.DeleteIndieAuthToken("token1")
+	if tokens, _ := db.GetUserIndieAuthTokens("alice"); len(tokens) != 0 {
+		t.Errorf("Expected every token to be revoked, got %v", tokens)
+	}
+
+	db.AddPersonalToken("alice", "zapier", "read", "token3")
+	if token, _ := db.GetIndieAuthToken("token3"); token == nil || token.Name != "zapier" || token.ClientID != "" {
+		t.Errorf("Expected alice's zapier token, got %+v", token)
+	}
+}
+
+func TestTimelinePage(t *testing.T) {
+	db := createNewTestDB()
+
+	const feedUrl = "http://feed.com"
+	const notifyFeedUrl = "http://notify.com"
+	const collectedFeedUrl = "http://collected.com"
+	db.WriteFeed(feedUrl)
+	db.WriteFeed(notifyFeedUrl)
+	db.WriteFeed(collectedFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", feedUrl)
+	db.Subscribe("alice", notifyFeedUrl)
+	db.SetFeedNotify("alice", notifyFeedUrl, true)
+	db.SaveCollection(&Collection{Username: "alice", Slug: "friends", Name: "Friends", FeedURLs: []string{collectedFeedUrl}})
+
+	for i := 1; i <= 5; i++ {
+		db.SavePost(feedUrl, fmt.Sprintf("Post %d", i), fmt.Sprintf("https://feed.com/%d", i), time.Now())
+	}
+	db.SavePost(notifyFeedUrl, "Notify", "https://notify.com/1", time.Now())
+	db.SavePost(collectedFeedUrl, "Collected", "https://collected.com/1", time.Now())
+
+	page, err := db.GetTimelinePage("alice", TimelineFilter{}, 0, 0, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Entries) != 4 || page.Entries[0].Post.Title != "Notify" || page.After != page.Entries[3].PostID {
+		t.Fatalf("Expected the 4 newest subscribed posts and a next page, got %+v", page)
+	}
+
+	older, _ := db.GetTimelinePage("alice", TimelineFilter{}, 0, page.After, 4)
+	if len(older.Entries) != 2 || older.Entries[1].Post.Title != "Post 1" || older.After != 0 {
+		t.Errorf("Expected the 2 oldest posts and no more pages, got %+v", older)
+	}
+
+	newer, _ := db.GetTimelinePage("alice", TimelineFilter{}, 0, 0, 10)
+	db.SavePost(feedUrl, "Post 6", "https://feed.com/6", time.Now())
+	db.SavePost(feedUrl, "Post 7", "https://feed.com/7", time.Now())
+	newer, _ = db.GetTimelinePage("alice", TimelineFilter{}, newer.Before, 0, 10)
+	if len(newer.Entries) != 2 || newer.Entries[0].Post.Title != "Post 7" {
+		t.Errorf("Expected the posts saved since, newest first, got %+v", newer)
+	}
+
+	notified, _ := db.GetTimelinePage("alice", TimelineFilter{NotifyOnly: true}, 0, 0, 10)
+	if len(notified.Entries) != 1 || notified.Entries[0].Post.Title != "Notify" {
+		t.Errorf("Expected the post of the feed with notifications, got %+v", notified)
+	}
+	collected, _ := db.GetTimelinePage("alice", TimelineFilter{CollectionSlug: "friends"}, 0, 0, 10)
+	if len(collected.Entries) != 1 || collected.Entries[0].Post.Title != "Collected" {
+		t.Errorf("Expected the post of the collection's feed, got %+v", collected)
+	}
+
+	unread, _ := db.GetTimelineUnreadCount("alice", TimelineFilter{})
+	if unread != 8 {
+		t.Errorf("Expected 8 unread posts, got %d", unread)
+	}
+
+	err = db.SetPostsReadStatus("alice", []int{page.Entries[0].PostID, 9999}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread, _ := db.GetTimelineUnreadCount("alice", TimelineFilter{NotifyOnly: true}); unread != 0 {
+		t.Errorf("Expected the notified post to be read, got %d unread", unread)
+	}
+
+	err = db.MarkTimelineReadUpTo("alice", TimelineFilter{}, older.Entries[0].PostID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unread, _ := db.GetTimelineUnreadCount("alice", TimelineFilter{}); unread != 5 {
+		t.Errorf("Expected 5 unread posts left, got %d", unread)
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 5 {
+		t.Errorf("Expected the timeline to agree, got %d", count)
+	}
+
+	db.SetPostsReadStatus("alice", []int{older.Entries[0].PostID}, false)
+	if unread, _ := db.GetTimelineUnreadCount("alice", TimelineFilter{}); unread != 6 {
+		t.Errorf("Expected the post to be unread again, got %d unread", unread)
+	}
+
+	db.Unsubscribe("alice", feedUrl)
+	if urls := db.GetUserFeedURLs("alice"); len(urls) != 1 || urls[0] != notifyFeedUrl {
+		t.Errorf("Expected a single subscription left, got %v", urls)
+	}
+	if urls, _ := db.GetNotifyFeedURLs("alice"); len(urls) != 1 || urls[0] != notifyFeedUrl {
+		t.Errorf("Expected the feed with notifications, got %v", urls)
+	}
+}
+
+func TestArchivePosts(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	old := time.Now().AddDate(-2, 0, 0)
+	db.SavePost(testFeedUrl, "Old post", "https://example.com/old", old)
+	db.SavePost(testFeedUrl, "Old starred post", "https://example.com/starred", old)
+	db.SavePost(testFeedUrl, "New post", "https://example.com/new", time.Now())
+	db.SetReadStatus("testuser", "https://example.com/old", true)
+
+	starred, _ := db.GetPost(db.GetPostId("https://example.com/starred", "testuser"))
+	db.StarPost("testuser", starred, "", "")
+
+	archived, err := db.ArchivePosts(time.Now().AddDate(-1, 0, 0), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 1 {
+		t.Fatalf("Expected the old post that isn't starred to be archived, got %d", archived)
+	}
+	if n, _ := db.GetNumArchivedPosts(); n != 1 {
+		t.Errorf("Expected 1 archived post, got %d", n)
+	}
+	if n := len(db.GetPostsForUser("testuser", 100)); n != 2 {
+		t.Errorf("Expected archived posts out of the timeline, got %d posts", n)
+	}
+
+	// still in the feed, but not new
+	if saved := db.SavePosts([]*Post{{FeedURL: testFeedUrl, Title: "Old post", URL: "https://example.com/old", PublishedDatetime: old}}); saved != 0 {
+		t.Errorf("Expected archived posts not to be saved again, saved %d", saved)
+	}
+
+	posts, err := db.SearchArchivedPosts("testuser", "old", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].URL != "https://example.com/old" || posts[0].FeedURL != testFeedUrl {
+		t.Errorf("Expected to find the archived post, got %v", posts)
+	}
+	if posts, _ := db.SearchArchivedPosts("testuser", "%", 10); len(posts) != 0 {
+		t.Errorf("Expected the query to be matched literally, got %v", posts)
+	}
+
+	var read []string
+	db.EachReadPost("testuser", func(post *ReadPost) error {
+		read = append(read, post.URL)
+		return nil
+	})
+	if !slices.Equal(read, []string{"https://example.com/old"}) {
+		t.Errorf("Expected archived posts in the read history, got %v", read)
+	}
+
+	if err := db.DeleteFeed(testFeedUrl); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.GetNumArchivedPosts(); n != 0 {
+		t.Errorf("Expected archived posts to be deleted with their feed, got %d", n)
+	}
+}
+
+func TestPostSearchIndex(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	old := time.Now().AddDate(-2, 0, 0)
+	db.SavePost(testFeedUrl, "Gardening in winter", "https://example.com/1", old)
+	db.SavePost(testFeedUrl, "Winter is coming", "https://example.com/2", time.Now())
+	if n, _ := db.GetNumIndexedPosts(); n != 2 {
+		t.Fatalf("Expected saved posts to be indexed, got %d", n)
+	}
+
+	// archiving moves posts, they stay indexed
+	db.ArchivePosts(time.Now().AddDate(-1, 0, 0), 100)
+	if n, _ := db.GetNumIndexedPosts(); n != 2 {
+		t.Errorf("Expected archived posts to stay indexed, got %d", n)
+	}
+	posts, err := db.SearchArchivedPosts("testuser", "wint", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(posts) != 1 || posts[0].Title != "Gardening in winter" {
+		t.Errorf("Expected to find the archived post by the start of a word, got %v", posts)
+	}
+	if posts, _ := db.SearchArchivedPosts("testuser", `winter "gardening`, 10); len(posts) != 1 {
+		t.Errorf("Expected quotes to be searched for, not taken for syntax, got %v", posts)
+	}
+
+	if err := db.ReindexPostSearch(); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := db.GetNumIndexedPosts(); n != 2 {
+		t.Errorf("Expected reindexing to index every post, got %d", n)
+	}
+
+	// deleted with their feed
+	db.Unsubscribe("testuser", testFeedUrl)
+	db.ExpireUnsubscribes(time.Now().Add(time.Hour))
+	db.DeleteOrphanFeeds()
+	if n, _ := db.GetNumIndexedPosts(); n != 0 {
+		t.Errorf("Expected deleted posts out of the index, got %d", n)
+	}
+}
+
+func TestGetRecentPostURLs(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.WriteFeed("http://other-feed.com")
+	db.AddUser("testuser", "testpass")
+	db.Subscribe("testuser", testFeedUrl)
+
+	db.SavePost(testFeedUrl, "Archived", "https://example.com/1", time.Now().AddDate(-2, 0, 0))
+	db.SavePost(testFeedUrl, "Older", "https://example.com/2", time.Now().Add(-2*time.Hour))
+	db.SavePost(testFeedUrl, "Newer", "https://example.com/3", time.Now().Add(-time.Hour))
+	db.SavePost("http://other-feed.com", "Other", "https://other.com/1", time.Now())
+	db.ArchivePosts(time.Now().AddDate(-1, 0, 0), 100)
+
+	urls, err := db.GetRecentPostURLs(testFeedUrl, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(urls, []string{"https://example.com/1", "https://example.com/2", "https://example.com/3"}) {
+		t.Errorf("Expected the posts of the feed oldest first, archived ones too, got %v", urls)
+	}
+
+	urls, _ = db.GetRecentPostURLs(testFeedUrl, 2)
+	if !slices.Equal(urls, []string{"https://example.com/2", "https://example.com/3"}) {
+		t.Errorf("Expected the 2 most recent posts, got %v", urls)
+	}
+}
+
+func TestPostDomains(t *testing.T) {
+	for rawURL, expected := range map[string]string{
+		"https://Blog.Example.com/2024/post?utm=rss": "blog.example.com",
+		"http://example.com:8080/post":               "example.com",
+		"https://medium.com/@someone/a-post-123":     "medium.com/@someone",
+		"https://writer.medium.com/a-post-123":       "writer.medium.com",
+	} {
+		if domain := URLDomain(rawURL); domain != expected {
+			t.Errorf("Expected the domain of %s to be %s, got %s", rawURL, expected, domain)
+		}
+	}
+
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+
+	db.SavePost(testFeedUrl, "Medium Post", "https://medium.com/@someone/a-post-123", time.Now())
+	db.SavePost(testFeedUrl, "Archived Post", "https://old.example.com/post", time.Now().AddDate(-2, 0, 0))
+	db.ArchivePosts(time.Now().AddDate(-1, 0, 0), 100)
+
+	posts := db.GetDiscoverPosts(DiscoverFilter{}, 10)
+	if len(posts) != 1 || posts[0].Domain != "medium.com/@someone" {
+		t.Fatalf("Expected the post to be saved with its domain, got %v", posts)
+	}
+
+	var archivedDomain string
+	db.sql.QueryRow("SELECT domain FROM post_archive").Scan(&archivedDomain)
+	if archivedDomain != "old.example.com" {
+		t.Errorf("Expected archived posts to keep their domain, got '%s'", archivedDomain)
+	}
+
+	// muting medium.com mutes every medium author
+	db.AddDiscoverMute("alice", MuteKindDomain, "medium.com")
+	if posts := db.GetDiscoverPosts(DiscoverFilter{ApplyMutesOf: "alice"}, 10); len(posts) != 0 {
+		t.Errorf("Expected the medium post to be muted, got %v", posts)
+	}
+}
+
+func TestSessions(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+	db.SetSessionToken("alice", "old-token", time.Now().Add(time.Hour))
+
+	if username := db.GetUsernameBySessionToken("old-token"); username != "alice" {
+		t.Fatalf("Expected the token to be alice's, got '%s'", username)
+	}
+	// looked up again, from memory this time
+	if username := db.GetUsernameBySessionToken("old-token"); username != "alice" {
+		t.Errorf("Expected the token to still be alice's, got '%s'", username)
+	}
+	if username := db.GetUsernameBySessionToken("someone-elses"); username != "" {
+		t.Errorf("Expected an unknown token to be no one's, got '%s'", username)
+	}
+
+	db.SetSessionToken("alice", "new-token", time.Now().Add(time.Hour))
+	if username := db.GetUsernameBySessionToken("old-token"); username != "" {
+		t.Errorf("Expected the old token to be forgotten, got '%s'", username)
+	}
+	if username := db.GetUsernameBySessionToken("new-token"); username != "alice" {
+		t.Errorf("Expected the new token to be alice's, got '%s'", username)
+	}
+
+	db.UpdatePassword("alice", "newpass")
+	if _, ok, _ := db.sessions.get("new-token"); ok {
+		t.Error("Expected alice's sessions to be forgotten when their password changes")
+	}
+
+	// lasting tokens end too
+	db.SetSessionToken("alice", "ended-token", time.Now().Add(-time.Second))
+	if username := db.GetUsernameBySessionToken("ended-token"); username != "" {
+		t.Errorf("Expected the ended token to be no one's, got '%s'", username)
+	}
+	if token, _ := db.GetSessionToken("alice"); token != "" {
+		t.Errorf("Expected alice to have no token to log in with, got '%s'", token)
+	}
+
+	// the instance shortened how long sessions last
+	db.SetSessionToken("alice", "long-token", time.Now().Add(time.Hour))
+	db.GetUsernameBySessionToken("long-token")
+	db.LimitSessionTokens(time.Now().Add(-time.Second))
+	if username := db.GetUsernameBySessionToken("long-token"); username != "" {
+		t.Errorf("Expected the token to have been cut short, got '%s'", username)
+	}
+
+	// logging out forgets who the token belongs to
+	db.SetSessionToken("alice", "lasting-token", time.Now().Add(time.Hour))
+	db.GetUsernameBySessionToken("lasting-token")
+	db.DeleteShortSession("lasting-token")
+	if _, ok, _ := db.sessions.get("lasting-token"); ok {
+		t.Error("Expected the token to be forgotten on logging out")
+	}
+
+	// there's only room for so many sessions
+	s := newSessions()
+	for i := range maxSessions + 10 {
+		_, _, version := s.get("token")
+		s.set(fmt.Sprintf("token-%d", i), "alice", version, time.Time{})
+	}
+	if n := len(s.byToken); n > maxSessions {
+		t.Errorf("Expected at most %d sessions to be remembered, got %d", maxSessions, n)
+	}
+}
+
+func TestUserPreferences(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+	uid := db.GetUserID("alice")
+
+	if value := db.GetSingleUserPreference(uid, "dateDisplay"); value != nil {
+		t.Errorf("Expected no preference, got '%s'", *value)
+	}
+
+	db.SaveSingleUserPreference(uid, "dateDisplay", "absolute")
+	db.SaveSingleUserPreference(uid, "dateFormat", "DD/MM/YYYY")
+	if value := db.GetSingleUserPreference(uid, "dateDisplay"); value == nil || *value != "absolute" {
+		t.Fatalf("Expected the saved preference, got %v", value)
+	}
+	// all of alice's preferences were loaded with the first one
+	if _, ok, _ := db.preferences.get(uid); !ok {
+		t.Error("Expected alice's preferences to be remembered")
+	}
+	if value := db.GetSingleUserPreference(uid, "dateFormat"); value == nil || *value != "DD/MM/YYYY" {
+		t.Errorf("Expected the other preference, got %v", value)
+	}
+
+	db.SaveSingleUserPreference(uid, "dateDisplay", "relative")
+	if value := db.GetSingleUserPreference(uid, "dateDisplay"); value == nil || *value != "relative" {
+		t.Errorf("Expected the preference to change, got %v", value)
+	}
+}
+
+func TestShortSessions(t *testing.T) {
+	db := createNewTestDB()
+	db.AddUser("alice", "testpass")
+
+	if err := db.AddShortSession("alice", "short-token", time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	db.AddShortSession("alice", "expired-token", time.Now().Add(-time.Second))
+
+	if username := db.GetUsernameBySessionToken("short-token"); username != "alice" {
+		t.Errorf("Expected the short session to be alice's, got '%s'", username)
+	}
+	if username := db.GetUsernameBySessionToken("expired-token"); username != "" {
+		t.Errorf("Expected the expired session to be no one's, got '%s'", username)
+	}
+
+	// remembered, but only until the session ends
+	db.AddShortSession("alice", "ending-token", time.Now().Add(100*time.Millisecond))
+	db.GetUsernameBySessionToken("ending-token")
+	time.Sleep(200 * time.Millisecond)
+	if username := db.GetUsernameBySessionToken("ending-token"); username != "" {
+		t.Errorf("Expected the session to have ended, got '%s'", username)
+	}
+
+	db.DeleteShortSession("short-token")
+	if username := db.GetUsernameBySessionToken("short-token"); username != "" {
+		t.Errorf("Expected the session to end on logging out, got '%s'", username)
+	}
+}
+
+func TestUndoUnsubscribe(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.SetFeedFavoriteStatus("alice", testFeedUrl, true)
+	db.SavePost(testFeedUrl, "Read Post", "https://example.com/1", time.Now())
+	db.SetReadStatus("alice", "https://example.com/1", true)
+
+	if err := db.Unsubscribe("alice", testFeedUrl); err != nil {
+		t.Fatal(err)
+	}
+	db.DeleteOrphanedPostReads("alice")
+	if orphans := db.DeleteOrphanFeeds(); len(orphans) != 0 {
+		t.Errorf("Expected the feed to be kept while the unsubscribe can be undone, got %v deleted", orphans)
+	}
+
+	unsubscribes, _ := db.GetRecentUnsubscribes("alice")
+	if len(unsubscribes) != 1 || unsubscribes[0].FeedURL != testFeedUrl || unsubscribes[0].UnsubscribedAt.IsZero() {
+		t.Fatalf("Expected the unsubscribe to be listed, got %v", unsubscribes)
+	}
+
+	if err := db.UndoUnsubscribe("alice", testFeedUrl); err != nil {
+		t.Fatal(err)
+	}
+	feeds := db.GetUserFeedURLsForSettings("alice")
+	if len(feeds) != 1 || !feeds[0].IsFavorite {
+		t.Errorf("Expected alice to be subscribed again, to a favorite, got %v", feeds)
+	}
+	if posts := db.GetPostsForUser("alice", 10); len(posts) != 1 || !posts[0].IsRead {
+		t.Errorf("Expected the post to still be read, got %v", posts)
+	}
+	if err := db.UndoUnsubscribe("alice", testFeedUrl); err == nil {
+		t.Error("Expected an unsubscribe to be undone only once")
+	}
+
+	// once it expires, it's final
+	db.Unsubscribe("alice", testFeedUrl)
+	if usernames, _ := db.ExpireUnsubscribes(time.Now().Add(-time.Hour)); len(usernames) != 0 {
+		t.Errorf("Expected the unsubscribe not to expire yet, got %v", usernames)
+	}
+	usernames, err := db.ExpireUnsubscribes(time.Now().Add(time.Hour))
+	if err != nil || !slices.Equal(usernames, []string{"alice"}) {
+		t.Fatalf("Expected alice's unsubscribe to expire, got %v (%v)", usernames, err)
+	}
+	if orphans := db.DeleteOrphanFeeds(); len(orphans) != 1 {
+		t.Errorf("Expected the feed to be deleted, got %v", orphans)
+	}
+	if err := db.UndoUnsubscribe("alice", testFeedUrl); err == nil {
+		t.Error("Expected an expired unsubscribe not to be undone")
+	}
+}
+
+func TestSubscriptionNotes(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+
+	if err := db.SetSubscriptionNote("alice", testFeedUrl, "friend's blog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSubscriptionNote("bob", testFeedUrl, "not mine"); err == nil {
+		t.Error("Expected notes to be kept only about subscriptions")
+	}
+
+	note, subscribed, err := db.GetSubscriptionNote("alice", testFeedUrl)
+	if err != nil || !subscribed || note != "friend's blog" {
+		t.Errorf("Expected alice's note, got '%s' (subscribed: %t, %v)", note, subscribed, err)
+	}
+	if _, subscribed, _ := db.GetSubscriptionNote("bob", testFeedUrl); subscribed {
+		t.Error("Expected bob not to be subscribed")
+	}
+	if feeds := db.GetUserFeedURLsForSettings("alice"); len(feeds) != 1 || feeds[0].Note != "friend's blog" {
+		t.Errorf("Expected the note in the settings, got %v", feeds)
+	}
+
+	// undoing an unsubscribe brings the note back
+	db.Unsubscribe("alice", testFeedUrl)
+	db.UndoUnsubscribe("alice", testFeedUrl)
+	if note, _, _ := db.GetSubscriptionNote("alice", testFeedUrl); note != "friend's blog" {
+		t.Errorf("Expected the note to be kept, got '%s'", note)
+	}
+}
+
+func TestFeedFetchHistory(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+
+	// fetches that keep working aren't history
+	db.SetFeedFetchError(testFeedUrl, "")
+	db.SetFeedFetchError(testFeedUrl, "timeout")
+	db.SetFeedFetchError(testFeedUrl, "404")
+	db.SetFeedFetchError(testFeedUrl, "")
+	db.SetFeedFetchError(testFeedUrl, "")
+
+	events, err := db.GetFeedFetchHistory(testFeedUrl, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Error)
+	}
+	if !slices.Equal(got, []string{"", "404", "timeout"}) {
+		t.Errorf("Expected the failures and the recovery, the last first, got %q", got)
+	}
+	if fetchErr, _ := db.GetFeedFetchError(testFeedUrl); fetchErr != "" {
+		t.Errorf("Expected the feed to be fine now, got '%s'", fetchErr)
+	}
+
+	for range feedFetchHistoryLength + 5 {
+		db.SetFeedFetchError(testFeedUrl, "timeout")
+	}
+	if events, _ := db.GetFeedFetchHistory(testFeedUrl, 1000); len(events) != feedFetchHistoryLength {
+		t.Errorf("Expected only the last %d events to be kept, got %d", feedFetchHistoryLength, len(events))
+	}
+}
+
+func TestFeedStats(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+
+	stats, err := db.GetFeedStats(testFeedUrl, "alice")
+	if err != nil || stats.NumPosts != 0 || stats.ReadPercentage() != 0 {
+		t.Fatalf("Expected no posts yet, got %+v (%v)", stats, err)
+	}
+
+	now := time.Now()
+	db.SavePosts([]*Post{
+		{FeedURL: testFeedUrl, Title: "First", URL: "https://example.com/1", PublishedDatetime: now.AddDate(0, 0, -60)},
+		{FeedURL: testFeedUrl, Title: "Second", URL: "https://example.com/2", PublishedDatetime: now.AddDate(0, 0, -40)},
+		{FeedURL: testFeedUrl, Title: "Third", URL: "https://example.com/3", PublishedDatetime: now.AddDate(0, 0, -20)},
+		{FeedURL: testFeedUrl, Title: "Fourth", URL: "https://example.com/4", PublishedDatetime: now},
+	})
+	db.SetReadStatus("alice", "https://example.com/1", true)
+
+	// archived posts still count
+	if _, err := db.ArchivePosts(now.AddDate(0, 0, -30), 100); err != nil {
+		t.Fatal(err)
+	}
+
+	stats, err = db.GetFeedStats(testFeedUrl, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumPosts != 4 || stats.NumPostsLast30Days != 2 {
+		t.Errorf("Expected 4 posts, 2 of them lately, got %d and %d", stats.NumPosts, stats.NumPostsLast30Days)
+	}
+	if days := int(stats.AverageInterval.Hours() / 24); days != 20 {
+		t.Errorf("Expected a post every 20 days, got every %d", days)
+	}
+	if !stats.FirstPost.Before(stats.LastPost) {
+		t.Errorf("Expected the first post before the last, got %s and %s", stats.FirstPost, stats.LastPost)
+	}
+	if stats.NumRead != 1 || stats.ReadPercentage() != 25 {
+		t.Errorf("Expected alice to have read 25%% of the posts, got %d%%", stats.ReadPercentage())
+	}
+
+	if stats, _ := db.GetFeedStats(testFeedUrl, ""); stats.NumRead != 0 {
+		t.Errorf("Expected no reads without a user, got %d", stats.NumRead)
+	}
+}
+
+func TestGetPostByURL(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.SavePost(testFeedUrl, "Post", "https://example.com/post", time.Now())
+
+	post, err := db.GetPostByURL("https://example.com/post")
+	if err != nil || post == nil || post.Title != "Post" || post.FeedURL != testFeedUrl {
+		t.Errorf("Expected the post, got %+v (%v)", post, err)
+	}
+	if post, err := db.GetPostByURL("https://example.com/missing"); post != nil || err != nil {
+		t.Errorf("Expected no post, got %+v (%v)", post, err)
+	}
+}
+
+func TestRestoreReadsAndStars(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.SavePost(testFeedUrl, "One", "https://example.com/1", time.Now())
+	db.SavePost(testFeedUrl, "Two", "https://example.com/2", time.Now())
+	db.SetReadStatus("alice", "https://example.com/2", false)
+
+	readAt := time.Now().Add(-time.Hour)
+	restored, err := db.RestoreReads("alice", []RestoredRead{
+		{URL: "https://example.com/1", ReadAt: readAt},
+		{URL: "https://example.com/2", ReadAt: readAt},
+		{URL: "https://example.com/missing", ReadAt: readAt},
+	})
+	if err != nil || restored != 2 {
+		t.Fatalf("Expected 2 reads restored, got %d (%v)", restored, err)
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 0 {
+		t.Errorf("Expected every post read, %d unread", count)
+	}
+
+	post, _ := db.GetPostByURL("https://example.com/1")
+	starred, err := db.RestoreStar("alice", post, "a quote", "", readAt)
+	if err != nil || !starred {
+		t.Fatalf("Expected the star restored (%v)", err)
+	}
+	if starred, _ := db.RestoreStar("alice", post, "another quote", "", readAt); starred {
+		t.Error("Expected the star there already to be kept")
+	}
+	star, _ := db.GetPostStar("alice", post.ID)
+	if star == nil || star.Quote != "a quote" || star.CreatedAt.Sub(readAt).Abs() > time.Second {
+		t.Errorf("Expected the star as of when it was starred, got %+v", star)
+	}
+}
+
+func TestTeams(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.SavePost(testFeedUrl, "One", "https://example.com/1", time.Now().Add(-time.Hour))
+	db.SavePost(testFeedUrl, "Two", "https://example.com/2", time.Now())
+
+	if err := db.CreateTeam("alice", "readers", "Readers"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreateTeam("bob", "readers", "Other readers"); err == nil {
+		t.Error("Expected an error creating a team with a taken slug")
+	}
+	if team, _ := db.GetTeam("missing"); team != nil {
+		t.Errorf("Expected no team, got %+v", team)
+	}
+
+	db.AddTeamMember("readers", "bob")
+	if err := db.AddTeamFeeds("readers", []string{testFeedUrl}); err != nil {
+		t.Fatal(err)
+	}
+	team, err := db.GetTeam("readers")
+	if err != nil || team == nil {
+		t.Fatalf("Expected the team (%v)", err)
+	}
+	if team.Owner != "alice" || !team.HasMember("bob") || len(team.FeedURLs) != 1 {
+		t.Errorf("Expected alice's team with bob and a feed, got %+v", team)
+	}
+	if teams, _ := db.GetUserTeams("bob"); len(teams) != 1 || teams[0].Slug != "readers" {
+		t.Errorf("Expected bob to be in the team, got %+v", teams)
+	}
+
+	// members each have their own read state
+	db.SetReadStatus("bob", "https://example.com/2", true)
+	posts, err := db.GetTeamPosts("readers", "bob", 10)
+	if err != nil || len(posts) != 2 {
+		t.Fatalf("Expected 2 posts, got %d (%v)", len(posts), err)
+	}
+	if !posts[0].IsRead || posts[1].IsRead {
+		t.Error("Expected bob to have read only the latest post")
+	}
+	if posts, _ := db.GetTeamPosts("readers", "alice", 10); posts[0].IsRead {
+		t.Error("Expected alice not to have read anything")
+	}
+
+	// stars are the team's
+	post, _ := db.GetPostByURL("https://example.com/1")
+	if err := db.StarTeamPost("readers", "bob", post); err != nil {
+		t.Fatal(err)
+	}
+	stars, _ := db.GetTeamStars("readers")
+	if len(stars) != 1 || stars[0].StarredBy != "bob" || stars[0].PostID != post.ID {
+		t.Errorf("Expected bob's star, got %+v", stars)
+	}
+
+	// the team keeps its feeds and what its members read of them
+	if deleted := db.DeleteOrphanFeeds(); len(deleted) != 0 {
+		t.Errorf("Expected the team's feed kept, %v deleted", deleted)
+	}
+	db.DeleteOrphanedPostReads("bob")
+	if posts, _ := db.GetTeamPosts("readers", "bob", 10); !posts[0].IsRead {
+		t.Error("Expected bob's reads kept")
+	}
+
+	db.RemoveTeamMember("readers", "bob")
+	db.DeleteOrphanedPostReads("bob")
+	if posts, _ := db.GetTeamPosts("readers", "bob", 10); posts[0].IsRead {
+		t.Error("Expected bob's reads gone once they left")
+	}
+
+	db.UnstarTeamPost("readers", post.ID)
+	if stars, _ := db.GetTeamStars("readers"); len(stars) != 0 {
+		t.Errorf("Expected no stars, got %+v", stars)
+	}
+
+	if err := db.DeleteTeam("readers"); err != nil {
+		t.Fatal(err)
+	}
+	if team, _ := db.GetTeam("readers"); team != nil {
+		t.Error("Expected the team deleted")
+	}
+	if deleted := db.DeleteOrphanFeeds(); len(deleted) != 1 {
+		t.Errorf("Expected the feed deleted with the team, got %v", deleted)
+	}
+}
+
+func TestMarkReadPublishedBefore(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.SavePost(testFeedUrl, "Old Post", "https://example.com/old", time.Now().AddDate(0, 0, -40))
+	db.SavePost(testFeedUrl, "Old Read Post", "https://example.com/old-read", time.Now().AddDate(0, 0, -50))
+	db.SavePost(testFeedUrl, "New Post", "https://example.com/new", time.Now())
+	db.SetReadStatus("alice", "https://example.com/old-read", true)
+
+	marked, err := db.MarkReadPublishedBefore("alice", time.Now().AddDate(0, 0, -30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 1 {
+		t.Errorf("Expected 1 post to be marked read, got %d", marked)
+	}
+	if !db.GetReadStatus("alice", "https://example.com/old") {
+		t.Errorf("Expected the old post to be read")
+	}
+	if db.GetReadStatus("alice", "https://example.com/new") {
+		t.Errorf("Expected the new post to still be unread")
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+
+	db.AddUser("bob", "testpass")
+	db.SaveSingleUserPreference(db.GetUserID("alice"), "autoMarkReadAfterDays", "30")
+	values, err := db.GetUsersWithPreference("autoMarkReadAfterDays")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values["alice"] != "30" {
+		t.Errorf("Expected only alice's preference, got %v", values)
+	}
+}
+
+func TestForgetReadHistory(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.SavePost(testFeedUrl, "Archived Post", "https://example.com/archived", time.Now().AddDate(-2, 0, 0))
+	db.SavePost(testFeedUrl, "Read Post", "https://example.com/read", time.Now())
+	db.SavePost(testFeedUrl, "Unread Post", "https://example.com/unread", time.Now())
+	db.SetReadStatus("alice", "https://example.com/archived", true)
+	db.SetReadStatus("alice", "https://example.com/read", true)
+	if _, err := db.ArchivePosts(time.Now().AddDate(-1, 0, 0), 10); err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing was read that long ago
+	if forgotten, _ := db.ForgetReadHistory("alice", time.Now().AddDate(0, 0, -1)); forgotten != 0 {
+		t.Errorf("Expected nothing to be forgotten, got %d", forgotten)
+	}
+
+	forgotten, err := db.ForgetReadHistory("alice", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if forgotten != 2 {
+		t.Errorf("Expected 2 reads to be forgotten, got %d", forgotten)
+	}
+
+	if !db.GetReadStatus("alice", "https://example.com/read") {
+		t.Errorf("Expected the read post to stay read")
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+
+	var history []string
+	db.EachReadPost("alice", func(post *ReadPost) error {
+		history = append(history, post.URL)
+		return nil
+	})
+	if len(history) != 0 {
+		t.Errorf("Expected the history to be empty, got %v", history)
+	}
+}
+
+func TestSubscriptionTitles(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.WriteFeed("http://other-feed.com")
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.Subscribe("alice", "http://other-feed.com")
+
+	if err := db.SetSubscriptionTitle("alice", testFeedUrl, "Dad's blog"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetSubscriptionTitle("bob", testFeedUrl, "not mine"); err == nil {
+		t.Error("Expected titles to be given only to subscriptions")
+	}
+
+	titles, err := db.GetSubscriptionTitles("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(titles) != 1 || titles[testFeedUrl] != "Dad's blog" {
+		t.Errorf("Expected alice's title only, got %v", titles)
+	}
+	if titles, _ := db.GetSubscriptionTitles("bob"); len(titles) != 0 {
+		t.Errorf("Expected bob to have no titles, got %v", titles)
+	}
+
+	// undoing an unsubscribe brings the title back, and an empty one removes it
+	db.Unsubscribe("alice", testFeedUrl)
+	db.UndoUnsubscribe("alice", testFeedUrl)
+	if titles, _ := db.GetSubscriptionTitles("alice"); titles[testFeedUrl] != "Dad's blog" {
+		t.Errorf("Expected the title to be kept, got %v", titles)
+	}
+	db.SetSubscriptionTitle("alice", testFeedUrl, "")
+	if titles, _ := db.GetSubscriptionTitles("alice"); len(titles) != 0 {
+		t.Errorf("Expected the title to be removed, got %v", titles)
+	}
+}
+
+func TestFilterRules(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.Subscribe("alice", otherFeedUrl)
+	db.Subscribe("bob", testFeedUrl)
+	db.SavePost(testFeedUrl, "Sponsored: buy this", "https://example.com/sponsored", time.Now())
+	db.SavePost(otherFeedUrl, "Sponsored elsewhere", "https://other.com/sponsored", time.Now())
+
+	// rules apply to the unread posts already there, of their feed only
+	applied, err := db.AddFilterRule("alice", &FilterRule{FeedURL: testFeedUrl, Match: FilterMatchContains, Pattern: "sponsored", Action: FilterActionHide})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 {
+		t.Errorf("Expected the rule to apply to 1 post, got %d", applied)
+	}
+	_, err = db.AddFilterRule("alice", &FilterRule{Match: FilterMatchRegex, Pattern: `^\[ad\]`, Action: FilterActionRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// and to the posts saved afterwards
+	db.SavePost(otherFeedUrl, "[ad] a gadget", "https://other.com/ad", time.Now())
+	db.SavePost(testFeedUrl, "Sponsored again", "https://example.com/sponsored-again", time.Now())
+
+	var titles []string
+	for _, entry := range db.GetPostsForUser("alice", 10) {
+		titles = append(titles, entry.Post.Title)
+		if entry.Post.Title == "[ad] a gadget" && !entry.IsRead {
+			t.Errorf("Expected the ad to be read")
+		}
+	}
+	if len(titles) != 2 || slices.Contains(titles, "Sponsored: buy this") || slices.Contains(titles, "Sponsored again") {
+		t.Errorf("Expected the sponsored posts to be hidden, got %v", titles)
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+
+	// other people's timelines are left alone
+	if posts := db.GetPostsForUser("bob", 10); len(posts) != 2 {
+		t.Errorf("Expected bob to see both posts of the feed, got %d", len(posts))
+	}
+
+	rules, err := db.GetUserFilterRules("alice")
+	if err != nil || len(rules) != 2 {
+		t.Fatalf("Expected alice's 2 rules, got %v (%v)", rules, err)
+	}
+	db.RemoveFilterRule("bob", rules[0].ID)
+	db.RemoveFilterRule("alice", rules[1].ID)
+	if rules, _ := db.GetUserFilterRules("alice"); len(rules) != 1 || rules[0].Action != FilterActionHide {
+		t.Errorf("Expected only alice's hide rule to be left, got %v", rules)
+	}
+}
+
+func TestMutedFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "http://example-feed.com"
+	const otherFeedUrl = "http://other-feed.com"
+	db.WriteFeed(testFeedUrl)
+	db.WriteFeed(otherFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.Subscribe("alice", otherFeedUrl)
+	db.Subscribe("bob", testFeedUrl)
+	db.SavePost(testFeedUrl, "Read before muting", "https://example.com/read", time.Now())
+	db.SavePost(otherFeedUrl, "Other post", "https://other.com/post", time.Now())
+	db.SetReadStatus("alice", "https://example.com/read", true)
+
+	if err := db.SetFeedMuted("alice", testFeedUrl, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetFeedMuted("bob", otherFeedUrl, true); err == nil {
+		t.Error("Expected only subscriptions to be muted")
+	}
+	if muted, _ := db.IsFeedMuted("alice", testFeedUrl); !muted {
+		t.Error("Expected the feed to be muted")
+	}
+
+	// muted feeds stay out of the timeline and the unread count, even for posts
+	// saved afterwards
+	db.SavePost(testFeedUrl, "Posted while muted", "https://example.com/muted", time.Now())
+	if posts := db.GetPostsForUser("alice", 10); len(posts) != 1 || posts[0].Post.Title != "Other post" {
+		t.Errorf("Expected only the other feed's post, got %v", posts)
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 1 {
+		t.Errorf("Expected 1 unread post, got %d", count)
+	}
+	if count, _ := db.GetUnreadCountForUser("bob"); count != 2 {
+		t.Errorf("Expected bob's timeline to be left alone, got %d unread", count)
+	}
+
+	// while keeping what was read of them
+	db.DeleteOrphanedPostReads("alice")
+	db.SetFeedMuted("alice", testFeedUrl, false)
+	if !db.GetReadStatus("alice", "https://example.com/read") {
+		t.Error("Expected the read state of the muted feed to be kept")
+	}
+	if posts := db.GetPostsForUser("alice", 10); len(posts) != 3 {
+		t.Errorf("Expected the feed's posts back once unmuted, got %d", len(posts))
+	}
+	if count, _ := db.GetUnreadCountForUser("alice"); count != 2 {
+		t.Errorf("Expected 2 unread posts, got %d", count)
+	}
+}
+
+func TestCanonicalFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const testFeedUrl = "https://example-feed.com/feed"
+	const otherUrl = "http://Example-Feed.com/feed/?utm_source=x"
+	db.WriteFeed(testFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.AddUser("bob", "testpass")
+	db.Subscribe("alice", testFeedUrl)
+	db.SavePost(testFeedUrl, "Both", "https://example-feed.com/both", time.Now())
+
+	if known := db.KnownFeedURL(otherUrl); known != testFeedUrl {
+		t.Errorf("Expected the other url to be the known feed, got %s", known)
+	}
+	if known := db.KnownFeedURL("https://example-feed.com/other"); known != "https://example-feed.com/other" {
+		t.Errorf("Expected unknown feeds to keep their url, got %s", known)
+	}
+
+	// feeds from before canonical urls were kept are merged once they are
+	db.WriteFeed(otherUrl)
+	db.Subscribe("alice", otherUrl)
+	db.Subscribe("bob", otherUrl)
+	db.SavePost(otherUrl, "Both", "https://example-feed.com/both", time.Now())
+	db.SavePost(otherUrl, "Only the other", "https://example-feed.com/other-only", time.Now())
+	db.SetReadStatus("bob", "https://example-feed.com/both", true)
+	db.sql.Exec("UPDATE feed SET canonical_url = NULL")
+
+	if err := db.canonicalizeFeeds(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the feed with the most subscribers stays
+	feeds, _ := db.GetAllFeedMetadata()
+	if len(feeds) != 1 || feeds[0].URL != otherUrl {
+		t.Fatalf("Expected only the other url to be left, got %+v", feeds)
+	}
+	if feeds := db.GetUserFeedURLs("alice"); len(feeds) != 1 {
+		t.Errorf("Expected alice to be subscribed once, got %v", feeds)
+	}
+	if posts := db.GetPostsForFeed(otherUrl); len(posts) != 2 {
+		t.Errorf("Expected the posts to be merged, got %d", len(posts))
+	}
+	if !db.GetReadStatus("bob", "https://example-feed.com/both") {
+		t.Error("Expected bob's read post to stay read")
+	}
+}
+
+func TestMoveFeed(t *testing.T) {
+	db := createNewTestDB()
+
+	const oldUrl = "http://feeds.feedburner.com/example"
+	const newUrl = "https://example.com/feed"
+	db.WriteFeed(oldUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", oldUrl)
+	db.SavePost(oldUrl, "Read", "https://example.com/read", time.Now())
+	db.SetReadStatus("alice", "https://example.com/read", true)
+
+	// moving renames the feed, keeping subscriptions and reads
+	movedTo, err := db.MoveFeed(oldUrl, newUrl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movedTo != newUrl {
+		t.Errorf("Expected the feed to go by its new url, got %s", movedTo)
+	}
+	if feeds := db.GetUserFeedURLs("alice"); len(feeds) != 1 || feeds[0] != newUrl {
+		t.Errorf("Expected alice to be subscribed to the new url, got %v", feeds)
+	}
+	if !db.GetReadStatus("alice", "https://example.com/read") {
+		t.Error("Expected the read post to stay read")
+	}
+
+	// moving to another url of a feed mire has merges them
+	const otherUrl = "https://other.example.com/rss"
+	db.WriteFeed(otherUrl)
+	db.AddUser("bob", "testpass")
+	db.Subscribe("bob", otherUrl)
+	movedTo, err = db.MoveFeed(otherUrl, "http://Example.com/feed/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movedTo != newUrl {
+		t.Errorf("Expected the feed to be merged into %s, got %s", newUrl, movedTo)
+	}
+	if feeds := db.GetUserFeedURLs("bob"); len(feeds) != 1 || feeds[0] != newUrl {
+		t.Errorf("Expected bob to be subscribed to the merged feed, got %v", feeds)
+	}
+
+	if _, err := db.MoveFeed("https://unknown.example.com", newUrl); err == nil {
+		t.Error("Expected unknown feeds not to move")
+	}
+}
+
+func TestDeadFeeds(t *testing.T) {
+	db := createNewTestDB()
+
+	const deadFeedUrl = "http://dead-feed.com"
+	const flakyFeedUrl = "http://flaky-feed.com"
+	db.WriteFeed(deadFeedUrl)
+	db.WriteFeed(flakyFeedUrl)
+	db.AddUser("alice", "testpass")
+	db.Subscribe("alice", deadFeedUrl)
+	db.Subscribe("alice", flakyFeedUrl)
+
+	for range 3 {
+		db.SetFeedFetchError(deadFeedUrl, "404 Not Found")
+		db.SetFeedFetchError(flakyFeedUrl, "timeout")
+	}
+	db.sql.Exec("UPDATE feed SET failing_since = datetime('now', '-40 days')")
+
+	// only the feeds that failed long enough and often enough are dead
+	if feeds, _ := db.GetDeadFeeds("alice", 30, 3); len(feeds) != 2 {
+		t.Errorf("Expected both feeds to be dead, got %d", len(feeds))
+	}
+	if feeds, _ := db.GetDeadFeeds("alice", 30, 4); len(feeds) != 0 {
+		t.Errorf("Expected feeds that failed 3 times not to be dead, got %d", len(feeds))
+	}
+	if feeds, _ := db.GetDeadFeeds("alice", 50, 3); len(feeds) != 0 {
+		t.Errorf("Expected feeds failing for 40 days not to be dead, got %d", len(feeds))
+	}
+
+	// fetching a feed fine starts it over
+	db.SetFeedFetchError(flakyFeedUrl, "")
+	db.SetFeedFetchError(flakyFeedUrl, "timeout")
+	feeds, err := db.GetDeadFeeds("alice", 30, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feeds) != 1 || feeds[0].URL != deadFeedUrl || feeds[0].Failures != 3 || feeds[0].Error != "404 Not Found" {
+		t.Errorf("Expected only the dead feed, got %+v", feeds)
+	}
+}
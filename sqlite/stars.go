@@ -0,0 +1,127 @@
+package sqlite
+
+import "time"
+
+// PostStar is a post a user starred, with what they wanted to remember
+// about it
+type PostStar struct {
+	PostID    int
+	Title     string
+	URL       string
+	FeedURL   string
+	Quote     string
+	Note      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// StarPost stars a post for a user, or updates the quote and note of a post
+// they already starred
+func (db *DB) StarPost(username string, post *Post, quote string, note string) error {
+	userId := db.GetUserID(username)
+	now := time.Now().UTC()
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO post_star (user_id, post_id, title, url, feed_url, quote, note, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id, post_id) DO UPDATE SET
+			quote=excluded.quote,
+			note=excluded.note,
+			updated_at=excluded.updated_at,
+			readwise_synced=0`,
+		userId, post.ID, post.Title, post.URL, post.FeedURL, quote, note, now, now)
+	unlock()
+
+	return err
+}
+
+func (db *DB) UnstarPost(username string, postId int) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM post_star WHERE user_id=? AND post_id=?", userId, postId)
+	unlock()
+
+	return err
+}
+
+const postStarColumns = `
+	SELECT ps.post_id, ps.title, ps.url, ps.feed_url, ps.quote, ps.note, ps.created_at, ps.updated_at
+	FROM post_star ps`
+
+func (db *DB) queryPostStars(query string, args ...any) ([]*PostStar, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stars []*PostStar
+	for rows.Next() {
+		var star PostStar
+		err = rows.Scan(&star.PostID, &star.Title, &star.URL, &star.FeedURL, &star.Quote, &star.Note, &star.CreatedAt, &star.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		stars = append(stars, &star)
+	}
+	return stars, rows.Err()
+}
+
+// GetPostStar returns a user's star of a post, or nil if they didn't star it
+func (db *DB) GetPostStar(username string, postId int) (*PostStar, error) {
+	userId := db.GetUserID(username)
+
+	stars, err := db.queryPostStars(postStarColumns+`
+		WHERE ps.user_id = ? AND ps.post_id = ?`, userId, postId)
+	if err != nil || len(stars) == 0 {
+		return nil, err
+	}
+	return stars[0], nil
+}
+
+// GetPostStars returns the posts a user starred, most recent first
+func (db *DB) GetPostStars(username string) ([]*PostStar, error) {
+	userId := db.GetUserID(username)
+
+	return db.queryPostStars(postStarColumns+`
+		WHERE ps.user_id = ?
+		ORDER BY ps.created_at DESC, ps.post_id DESC`, userId)
+}
+
+// GetUnsyncedPostStars returns the stars of a user that changed since they
+// were last sent to readwise, oldest first
+func (db *DB) GetUnsyncedPostStars(username string, limit int) ([]*PostStar, error) {
+	userId := db.GetUserID(username)
+
+	return db.queryPostStars(postStarColumns+`
+		WHERE ps.user_id = ? AND NOT ps.readwise_synced
+		ORDER BY ps.updated_at ASC, ps.post_id ASC
+		LIMIT ?`, userId, limit)
+}
+
+// MarkPostStarsSynced marks stars as sent to readwise, unless they changed
+// since they were read
+func (db *DB) MarkPostStarsSynced(username string, stars []*PostStar) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, star := range stars {
+		_, err = tx.Exec("UPDATE post_star SET readwise_synced=1 WHERE user_id=? AND post_id=? AND updated_at=?",
+			userId, star.PostID, star.UpdatedAt.UTC())
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
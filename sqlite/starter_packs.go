@@ -0,0 +1,125 @@
+package sqlite
+
+import "database/sql"
+
+// StarterPack is a curated bundle of feeds offered to new users
+type StarterPack struct {
+	Slug        string
+	Name        string
+	Description string
+	FeedURLs    []string
+}
+
+// GetStarterPacks returns every starter pack along with its feeds
+func (db *DB) GetStarterPacks() ([]*StarterPack, error) {
+	rows, err := db.sql.Query(`
+		SELECT sp.slug, sp.name, sp.description, spf.feed_url
+		FROM starter_pack sp
+		LEFT JOIN starter_pack_feed spf ON spf.starter_pack_id = sp.id
+		ORDER BY sp.name, spf.feed_url`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var packs []*StarterPack
+	for rows.Next() {
+		var pack StarterPack
+		var feedURL sql.NullString
+		if err := rows.Scan(&pack.Slug, &pack.Name, &pack.Description, &feedURL); err != nil {
+			return nil, err
+		}
+
+		if len(packs) == 0 || packs[len(packs)-1].Slug != pack.Slug {
+			packs = append(packs, &pack)
+		}
+		if feedURL.Valid {
+			last := packs[len(packs)-1]
+			last.FeedURLs = append(last.FeedURLs, feedURL.String)
+		}
+	}
+	return packs, rows.Err()
+}
+
+// GetStarterPack returns a single starter pack, or nil if it doesn't exist
+func (db *DB) GetStarterPack(slug string) (*StarterPack, error) {
+	packs, err := db.GetStarterPacks()
+	if err != nil {
+		return nil, err
+	}
+	for _, pack := range packs {
+		if pack.Slug == slug {
+			return pack, nil
+		}
+	}
+	return nil, nil
+}
+
+// SaveStarterPack creates a starter pack or, if one with the same slug already
+// exists, replaces it.
+func (db *DB) SaveStarterPack(pack *StarterPack) error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		INSERT INTO starter_pack (slug, name, description) VALUES (?, ?, ?)
+		ON CONFLICT(slug) DO UPDATE SET name = excluded.name, description = excluded.description`,
+		pack.Slug, pack.Name, pack.Description)
+	if err != nil {
+		return err
+	}
+
+	var packId int
+	err = tx.QueryRow("SELECT id FROM starter_pack WHERE slug = ?", pack.Slug).Scan(&packId)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM starter_pack_feed WHERE starter_pack_id = ?", packId)
+	if err != nil {
+		return err
+	}
+
+	for _, feedURL := range pack.FeedURLs {
+		_, err = tx.Exec(
+			"INSERT OR IGNORE INTO starter_pack_feed (starter_pack_id, feed_url) VALUES (?, ?)",
+			packId, feedURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteStarterPack removes a starter pack and its feeds
+func (db *DB) DeleteStarterPack(slug string) error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		DELETE FROM starter_pack_feed
+		WHERE starter_pack_id IN (SELECT id FROM starter_pack WHERE slug = ?)`, slug)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM starter_pack WHERE slug = ?", slug)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// GetSubscriptionNote returns the note a user keeps about one of their
+// subscriptions, and whether they're subscribed to the feed at all
+func (db *DB) GetSubscriptionNote(username string, feedURL string) (string, bool, error) {
+	var note string
+	err := db.sql.QueryRow(`
+		SELECT s.note FROM subscribe s
+		JOIN user u ON u.id = s.user_id
+		JOIN feed f ON f.id = s.feed_id
+		WHERE u.username = ? AND f.url = ?`, username, feedURL).Scan(&note)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return note, true, nil
+}
+
+// SetSubscriptionNote keeps a note about one of a user's subscriptions, an
+// empty one removes it
+func (db *DB) SetSubscriptionNote(username string, feedURL string, note string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	res, err := db.sql.Exec(`
+		UPDATE subscribe SET note = ?
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, note, userId, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("you're not subscribed to '%s'", feedURL)
+	}
+	return nil
+}
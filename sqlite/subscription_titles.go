@@ -0,0 +1,47 @@
+package sqlite
+
+import "fmt"
+
+// GetSubscriptionTitles returns the titles a user gave the feeds they're
+// subscribed to, by feed URL. Feeds they didn't give one aren't in it.
+func (db *DB) GetSubscriptionTitles(username string) (map[string]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, s.title FROM subscribe s
+		JOIN user u ON u.id = s.user_id
+		JOIN feed f ON f.id = s.feed_id
+		WHERE u.username = ? AND s.title != ''`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	titles := make(map[string]string)
+	for rows.Next() {
+		var feedURL, title string
+		if err = rows.Scan(&feedURL, &title); err != nil {
+			return nil, err
+		}
+		titles[feedURL] = title
+	}
+	return titles, rows.Err()
+}
+
+// SetSubscriptionTitle gives one of a user's subscriptions a title of their
+// own, an empty one goes back to the feed's title
+func (db *DB) SetSubscriptionTitle(username string, feedURL string, title string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	res, err := db.sql.Exec(`
+		UPDATE subscribe SET title = ?
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, title, userId, feedURL)
+	unlock()
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("you're not subscribed to '%s'", feedURL)
+	}
+	return nil
+}
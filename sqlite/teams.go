@@ -0,0 +1,330 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// the feeds of the teams a user is in
+const teamFeedIDs = `
+	SELECT tf.feed_id FROM team_feed tf
+	JOIN team_member tm ON tm.team_id = tf.team_id
+	WHERE tm.user_id = ?`
+
+// Team is a small group reading the same feeds, see the team table
+type Team struct {
+	Slug     string
+	Name     string
+	Owner    string
+	Members  []string
+	FeedURLs []string
+}
+
+// TeamStar is a post a member starred for their team
+type TeamStar struct {
+	PostID    int
+	Title     string
+	URL       string
+	FeedURL   string
+	StarredBy string
+	CreatedAt time.Time
+}
+
+// CreateTeam creates a team, with its owner as its first member
+func (db *DB) CreateTeam(owner string, slug string, name string) error {
+	ownerId := db.GetUserID(owner)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("INSERT INTO team (slug, name, owner_id, created_at) VALUES (?, ?, ?, ?) ON CONFLICT(slug) DO NOTHING",
+		slug, name, ownerId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("there's already a team called '%s'", slug)
+	}
+	teamId, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO team_member (team_id, user_id, joined_at) VALUES (?, ?, ?)", teamId, ownerId, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTeam returns a team with its members and feeds, or nil if there's no
+// such team
+func (db *DB) GetTeam(slug string) (*Team, error) {
+	var team Team
+	var teamId int
+	err := db.sql.QueryRow(`
+		SELECT t.id, t.slug, t.name, u.username FROM team t
+		JOIN user u ON u.id = t.owner_id
+		WHERE t.slug = ?`, slug).Scan(&teamId, &team.Slug, &team.Name, &team.Owner)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	team.Members, err = db.queryStrings(`
+		SELECT u.username FROM team_member tm
+		JOIN user u ON u.id = tm.user_id
+		WHERE tm.team_id = ?
+		ORDER BY tm.joined_at, u.username`, teamId)
+	if err != nil {
+		return nil, err
+	}
+
+	team.FeedURLs, err = db.queryStrings(`
+		SELECT f.url FROM team_feed tf
+		JOIN feed f ON f.id = tf.feed_id
+		WHERE tf.team_id = ?
+		ORDER BY f.url`, teamId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &team, nil
+}
+
+func (db *DB) queryStrings(query string, args ...any) ([]string, error) {
+	rows, err := db.sql.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err = rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// GetUserTeams returns the teams a user is in, without their members and
+// feeds
+func (db *DB) GetUserTeams(username string) ([]*Team, error) {
+	rows, err := db.sql.Query(`
+		SELECT t.slug, t.name, o.username FROM team t
+		JOIN user o ON o.id = t.owner_id
+		JOIN team_member tm ON tm.team_id = t.id
+		JOIN user u ON u.id = tm.user_id
+		WHERE u.username = ?
+		ORDER BY t.name, t.slug`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var teams []*Team
+	for rows.Next() {
+		var team Team
+		if err = rows.Scan(&team.Slug, &team.Name, &team.Owner); err != nil {
+			return nil, err
+		}
+		teams = append(teams, &team)
+	}
+	return teams, rows.Err()
+}
+
+// AddTeamMember adds a user to a team
+func (db *DB) AddTeamMember(slug string, username string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT OR IGNORE INTO team_member (team_id, user_id, joined_at)
+		SELECT t.id, u.id, ? FROM team t, user u
+		WHERE t.slug = ? AND u.username = ?`, time.Now().UTC(), slug, username)
+	unlock()
+
+	return err
+}
+
+// RemoveTeamMember removes a user from a team. What they read of its feeds
+// can go, see DeleteOrphanedPostReads, and so can the feeds no one else reads,
+// see DeleteOrphanFeeds.
+func (db *DB) RemoveTeamMember(slug string, username string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM team_member
+		WHERE team_id IN (SELECT id FROM team WHERE slug = ?)
+			AND user_id IN (SELECT id FROM user WHERE username = ?)`, slug, username)
+	unlock()
+
+	return err
+}
+
+// AddTeamFeeds adds feeds to a team, feeds mire knows already
+func (db *DB) AddTeamFeeds(slug string, feedURLs []string) error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, feedURL := range feedURLs {
+		_, err = tx.Exec(`
+			INSERT OR IGNORE INTO team_feed (team_id, feed_id, added_at)
+			SELECT t.id, f.id, ? FROM team t, feed f
+			WHERE t.slug = ? AND f.url = ?`, time.Now().UTC(), slug, feedURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// RemoveTeamFeed removes a feed from a team, see RemoveTeamMember for what
+// can go with it
+func (db *DB) RemoveTeamFeed(slug string, feedURL string) error {
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM team_feed
+		WHERE team_id IN (SELECT id FROM team WHERE slug = ?)
+			AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, slug, feedURL)
+	unlock()
+
+	return err
+}
+
+// DeleteTeam deletes a team along with its stars, see RemoveTeamMember for
+// what can go with it
+func (db *DB) DeleteTeam(slug string) error {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, table := range []string{"team_star", "team_feed", "team_member"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE team_id IN (SELECT id FROM team WHERE slug = ?)", slug)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM team WHERE slug = ?", slug)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetTeamPosts returns the latest posts of a team's feeds, whether username
+// read them or not
+func (db *DB) GetTeamPosts(slug string, username string, limit int) ([]*UserPostEntry, error) {
+	rows, err := db.sql.Query(`
+		SELECT p.id, p.title, p.url, p.domain, p.published_at, p.word_count, p.thumbnail_url, p.duration, p.comments_url, p.article_url, pr.has_read, f.url, f.sensitive
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		JOIN team_feed tf ON tf.feed_id = p.feed_id
+		JOIN team t ON t.id = tf.team_id
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = (SELECT id FROM user WHERE username = ?)
+		WHERE t.slug = ?
+		ORDER BY p.published_at DESC
+		LIMIT ?`, username, slug, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []*UserPostEntry
+	for rows.Next() {
+		var entry UserPostEntry
+		var p gofeed.Item
+		var hasRead sql.NullBool
+		err = rows.Scan(&entry.PostID, &p.Title, &p.Link, &entry.Domain, &p.PublishedParsed, &entry.WordCount, &entry.ThumbnailURL,
+			&entry.Duration, &entry.CommentsURL, &entry.ArticleURL, &hasRead, &entry.FeedURL, &entry.Sensitive)
+		if err != nil {
+			return nil, err
+		}
+		entry.Post = &p
+		entry.IsRead = hasRead.Valid && hasRead.Bool
+		entries = append(entries, &entry)
+	}
+	return entries, rows.Err()
+}
+
+// StarTeamPost stars a post for a team, on behalf of one of its members
+func (db *DB) StarTeamPost(slug string, username string, post *Post) error {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT OR IGNORE INTO team_star (team_id, post_id, user_id, title, url, feed_url, created_at)
+		SELECT t.id, ?, u.id, ?, ?, ?, ? FROM team t, user u
+		WHERE t.slug = ? AND u.username = ?`,
+		post.ID, post.Title, post.URL, post.FeedURL, time.Now().UTC(), slug, username)
+	unlock()
+
+	return err
+}
+
+// UnstarTeamPost takes a post out of a team's stars
+func (db *DB) UnstarTeamPost(slug string, postId int) error {
+	lock()
+	_, err := db.sql.Exec(`
+		DELETE FROM team_star
+		WHERE team_id IN (SELECT id FROM team WHERE slug = ?) AND post_id = ?`, slug, postId)
+	unlock()
+
+	return err
+}
+
+// GetTeamStars returns the posts starred for a team, the most recent first
+func (db *DB) GetTeamStars(slug string) ([]*TeamStar, error) {
+	rows, err := db.sql.Query(`
+		SELECT ts.post_id, ts.title, ts.url, ts.feed_url, u.username, ts.created_at
+		FROM team_star ts
+		JOIN team t ON t.id = ts.team_id
+		JOIN user u ON u.id = ts.user_id
+		WHERE t.slug = ?
+		ORDER BY ts.created_at DESC`, slug)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stars []*TeamStar
+	for rows.Next() {
+		var star TeamStar
+		err = rows.Scan(&star.PostID, &star.Title, &star.URL, &star.FeedURL, &star.StarredBy, &star.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		stars = append(stars, &star)
+	}
+	return stars, rows.Err()
+}
+
+// HasMember tells whether a user is in the team
+func (t *Team) HasMember(username string) bool {
+	return slices.Contains(t.Members, username)
+}
@@ -0,0 +1,109 @@
+package sqlite
+
+// sources of a feed's topics
+const (
+	TopicSourceAdmin     = "admin"
+	TopicSourceHeuristic = "heuristic"
+)
+
+// GetFeedTopics returns the topics of a feed along with whether they were
+// assigned by an admin.
+func (db *DB) GetFeedTopics(feedURL string) ([]string, bool, error) {
+	rows, err := db.sql.Query(`
+		SELECT ft.topic, ft.source
+		FROM feed_topic ft
+		JOIN feed f ON ft.feed_id = f.id
+		WHERE f.url = ?
+		ORDER BY ft.topic`, feedURL)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+
+	var topics []string
+	assignedByAdmin := false
+	for rows.Next() {
+		var topic, source string
+		if err := rows.Scan(&topic, &source); err != nil {
+			return nil, false, err
+		}
+		topics = append(topics, topic)
+		assignedByAdmin = assignedByAdmin || source == TopicSourceAdmin
+	}
+	return topics, assignedByAdmin, nil
+}
+
+// SetFeedTopics replaces all the topics of a feed.
+func (db *DB) SetFeedTopics(feedURL string, topics []string, source string) error {
+	feedId := db.GetFeedID(feedURL)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM feed_topic WHERE feed_id = ?", feedId)
+	if err != nil {
+		return err
+	}
+
+	for _, topic := range topics {
+		_, err = tx.Exec("INSERT INTO feed_topic (feed_id, topic, source) VALUES (?, ?, ?)", feedId, topic, source)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetFeedsWithoutAdminTopics returns the urls of all the feeds whose topics
+// can be (re)computed by the heuristics.
+func (db *DB) GetFeedsWithoutAdminTopics() ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT url FROM feed
+		WHERE id NOT IN (SELECT feed_id FROM feed_topic WHERE source = ?)`, TopicSourceAdmin)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
+
+// GetRecentPostTitlesForFeed returns the titles of the latest posts of a feed
+func (db *DB) GetRecentPostTitlesForFeed(feedURL string, limit int) ([]string, error) {
+	rows, err := db.sql.Query(`
+		SELECT p.title
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		WHERE f.url = ?
+		ORDER BY p.published_at DESC
+		LIMIT ?`, feedURL, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var titles []string
+	for rows.Next() {
+		var title string
+		if err := rows.Scan(&title); err != nil {
+			return nil, err
+		}
+		titles = append(titles, title)
+	}
+	return titles, nil
+}
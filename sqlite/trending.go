@@ -0,0 +1,62 @@
+package sqlite
+
+import (
+	"fmt"
+)
+
+// TrendingCandidate is a recent post along with the engagement signals used to
+// rank it on the "hot" tab of discover.
+type TrendingCandidate struct {
+	Post            *Post
+	RecentReads     int
+	Subscribers     int
+	Favorites       int
+	Recommendations int
+}
+
+// GetTrendingCandidates returns all the posts first seen in the last
+// `windowDays` days along with how many times they were read in that window,
+// how many users recommended them in that window and how many users subscribe
+// to (and favorite) their feed.
+func (db *DB) GetTrendingCandidates(windowDays int) ([]*TrendingCandidate, error) {
+	window := fmt.Sprintf("-%d days", windowDays)
+
+	query := `
+		SELECT p.id, p.title, p.url, p.domain, p.published_at, p.word_count, p.language, f.url, f.sensitive,
+			(SELECT COUNT(*) FROM post_read pr
+				WHERE pr.post_id = p.id AND pr.has_read = 1 AND pr.created_at >= datetime('now', ?)),
+			(SELECT COUNT(*) FROM subscribe s WHERE s.feed_id = p.feed_id),
+			(SELECT COUNT(*) FROM subscribe s WHERE s.feed_id = p.feed_id AND s.is_favorite = 1),
+			(SELECT COUNT(*) FROM post_recommendation rec
+				WHERE rec.post_id = p.id AND rec.created_at >= datetime('now', ?))
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		WHERE p.created_at >= datetime('now', ?) AND f.hide_from_discover = 0`
+
+	rows, err := db.sql.Query(query, window, window, window)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []*TrendingCandidate
+	for rows.Next() {
+		var p Post
+		var c TrendingCandidate
+		var publishedTime string
+		err = rows.Scan(&p.ID, &p.Title, &p.URL, &p.Domain, &publishedTime, &p.WordCount, &p.Language, &p.FeedURL, &p.Sensitive,
+			&c.RecentReads, &c.Subscribers, &c.Favorites, &c.Recommendations)
+		if err != nil {
+			return nil, err
+		}
+
+		p.PublishedDatetime, err = db.TryParseDate(publishedTime)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Post = &p
+		candidates = append(candidates, &c)
+	}
+	return candidates, rows.Err()
+}
@@ -0,0 +1,140 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// The triage cursor points at the post a user is currently looking at when
+// going through their timeline with the keyboard. It moves in the same order
+// the timeline is displayed in (newest first).
+
+// GetTriageCursor returns the post the user's triage cursor is pointing at, or
+// nil if the cursor hasn't been placed yet.
+func (db *DB) GetTriageCursor(username string) (*UserPostEntry, error) {
+	userId := db.GetUserID(username)
+
+	var postId int
+	err := db.sql.QueryRow(`
+		SELECT tc.post_id
+		FROM triage_cursor tc
+		JOIN post p ON p.id = tc.post_id
+		WHERE tc.user_id = ?`, userId).Scan(&postId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return db.getUserPostEntry(userId, postId)
+}
+
+// MoveTriageCursorToNextUnread moves the user's triage cursor to the next
+// unread post after the current one, or to the newest unread post if the
+// cursor hasn't been placed yet. Returns nil if there are no more unread
+// posts, in which case the cursor is left where it was.
+func (db *DB) MoveTriageCursorToNextUnread(username string) (*UserPostEntry, error) {
+	userId := db.GetUserID(username)
+
+	var postId int
+	err := db.sql.QueryRow(`
+		WITH cur AS (
+			SELECT p.id, p.published_at
+			FROM triage_cursor tc
+			JOIN post p ON p.id = tc.post_id
+			WHERE tc.user_id = ?
+		)
+		SELECT p.id
+		FROM post p
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.feed_id IN (`+timelineFeedIDs+`)
+			AND (pr.has_read IS NULL OR pr.has_read = 0)
+			AND (
+				NOT EXISTS (SELECT 1 FROM cur)
+				OR p.published_at < (SELECT published_at FROM cur)
+				OR (p.published_at = (SELECT published_at FROM cur) AND p.id < (SELECT id FROM cur))
+			)
+		ORDER BY p.published_at DESC, p.id DESC
+		LIMIT 1`, userId, userId, userId, userId).Scan(&postId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return db.setTriageCursor(userId, postId)
+}
+
+// MoveTriageCursorToPrevious moves the user's triage cursor to the post right
+// before the current one, whether it has been read or not. Returns nil if
+// the cursor is already at the top of the timeline (or hasn't been placed).
+func (db *DB) MoveTriageCursorToPrevious(username string) (*UserPostEntry, error) {
+	userId := db.GetUserID(username)
+
+	var postId int
+	err := db.sql.QueryRow(`
+		WITH cur AS (
+			SELECT p.id, p.published_at
+			FROM triage_cursor tc
+			JOIN post p ON p.id = tc.post_id
+			WHERE tc.user_id = ?
+		)
+		SELECT p.id
+		FROM post p
+		WHERE p.feed_id IN (`+timelineFeedIDs+`)
+			AND (
+				p.published_at > (SELECT published_at FROM cur)
+				OR (p.published_at = (SELECT published_at FROM cur) AND p.id > (SELECT id FROM cur))
+			)
+		ORDER BY p.published_at ASC, p.id ASC
+		LIMIT 1`, userId, userId, userId).Scan(&postId)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return db.setTriageCursor(userId, postId)
+}
+
+func (db *DB) setTriageCursor(userId int, postId int) (*UserPostEntry, error) {
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO triage_cursor (user_id, post_id) VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET post_id = excluded.post_id, updated_at = CURRENT_TIMESTAMP`,
+		userId, postId)
+	unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return db.getUserPostEntry(userId, postId)
+}
+
+// getUserPostEntry returns a single post along with its read status for the
+// given user.
+func (db *DB) getUserPostEntry(userId int, postId int) (*UserPostEntry, error) {
+	entry := UserPostEntry{PostID: postId}
+	var p gofeed.Item
+	var hasRead sql.NullBool
+
+	err := db.sql.QueryRow(`
+		SELECT p.title, p.url, p.domain, p.published_at, p.word_count, pr.has_read, f.url
+		FROM post p
+		JOIN feed f ON p.feed_id = f.id
+		LEFT JOIN post_read pr ON p.id = pr.post_id AND pr.user_id = ?
+		WHERE p.id = ?`, userId, postId).Scan(&p.Title, &p.Link, &entry.Domain, &p.PublishedParsed, &entry.WordCount, &hasRead, &entry.FeedURL)
+	if err != nil {
+		return nil, err
+	}
+
+	entry.Post = &p
+	entry.IsRead = hasRead.Valid && hasRead.Bool
+
+	return &entry, nil
+}
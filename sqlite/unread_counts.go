@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"log"
+	"sync"
+)
+
+// unreadCounts keeps the number of unread posts on people's timelines, so
+// that pages and APIs can show it without counting every time. Counts are
+// kept up to date as posts are saved and read, and forgotten when
+// subscriptions change, to be counted again the next time they're asked for.
+type unreadCounts struct {
+	sync.Mutex
+
+	// by user id
+	counts map[int]int
+
+	// changes with every post saved or read, so that counts that were being
+	// counted meanwhile aren't kept, they might have missed it
+	version int
+}
+
+func newUnreadCounts() *unreadCounts {
+	return &unreadCounts{counts: make(map[int]int)}
+}
+
+// get returns the count of a user if it's known, or else the version to
+// pass to set along with the count
+func (u *unreadCounts) get(userId int) (int, bool, int) {
+	u.Lock()
+	defer u.Unlock()
+
+	count, ok := u.counts[userId]
+	return count, ok, u.version
+}
+
+// set keeps a count, unless posts were saved or read since version
+func (u *unreadCounts) set(userId int, count int, version int) {
+	u.Lock()
+	if u.version == version {
+		u.counts[userId] = count
+	}
+	u.Unlock()
+}
+
+// changed tells counts being counted that posts were saved or read
+func (u *unreadCounts) changed() {
+	u.Lock()
+	u.version++
+	u.Unlock()
+}
+
+// add changes the count of a user, if it's known
+func (u *unreadCounts) add(userId int, delta int) {
+	u.Lock()
+	u.version++
+	if count, ok := u.counts[userId]; ok {
+		u.counts[userId] = max(count+delta, 0)
+	}
+	u.Unlock()
+}
+
+func (u *unreadCounts) forget(userId int) {
+	u.Lock()
+	u.version++
+	delete(u.counts, userId)
+	u.Unlock()
+}
+
+// forgetAll forgets every count, for changes to subscriptions: they can change
+// the timelines of the users following the subscriber's blogroll too
+func (u *unreadCounts) forgetAll() {
+	u.Lock()
+	u.version++
+	clear(u.counts)
+	u.Unlock()
+}
+
+func (u *unreadCounts) userIds() []int {
+	u.Lock()
+	defer u.Unlock()
+
+	ids := make([]int, 0, len(u.counts))
+	for id := range u.counts {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// countNewPost counts a post that was just saved as unread on the timelines
+// it's on
+func (db *DB) countNewPost(feedId int) {
+	db.unreadCounts.changed()
+	if len(db.unreadCounts.userIds()) == 0 {
+		return
+	}
+
+	rows, err := db.sql.Query(timelineUserIDs, feedId, feedId)
+	if err != nil {
+		log.Printf("[err] countNewPost: %s\n", err)
+		db.unreadCounts.forgetAll()
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userId int
+		if err := rows.Scan(&userId); err != nil {
+			log.Printf("[err] countNewPost: %s\n", err)
+			db.unreadCounts.forgetAll()
+			return
+		}
+		db.unreadCounts.add(userId, 1)
+	}
+}
+
+// countReadStatusChange counts a post a user just read, or marked unread, if
+// it's on their timeline
+func (db *DB) countReadStatusChange(userId int, postId int, wasRead bool, read bool) {
+	if wasRead == read {
+		return
+	}
+	db.unreadCounts.changed()
+	if _, ok, _ := db.unreadCounts.get(userId); !ok {
+		return
+	}
+
+	var onTimeline bool
+	err := db.sql.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM post WHERE id = ? AND feed_id IN (`+timelineFeedIDs+`))`,
+		postId, userId, userId).Scan(&onTimeline)
+	if err != nil {
+		log.Printf("[err] countReadStatusChange: %s\n", err)
+		db.unreadCounts.forget(userId)
+		return
+	}
+
+	if !onTimeline {
+		return
+	}
+	if read {
+		db.unreadCounts.add(userId, -1)
+	} else {
+		db.unreadCounts.add(userId, 1)
+	}
+}
@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"fmt"
+	"time"
+)
+
+// the feeds to keep around: the ones someone is subscribed to, the ones
+// someone could still undo their unsubscribe from and the ones teams read
+const keptFeedIDs = `
+	SELECT feed_id FROM subscribe
+	UNION
+	SELECT feed_id FROM unsubscribe
+	UNION
+	SELECT feed_id FROM team_feed`
+
+// RecentUnsubscribe is a feed someone unsubscribed from lately, that they can
+// still subscribe to again as if they never left
+type RecentUnsubscribe struct {
+	FeedURL        string
+	UnsubscribedAt time.Time
+}
+
+// GetRecentUnsubscribes returns the feeds a user unsubscribed from that they
+// can still undo, the most recent first
+func (db *DB) GetRecentUnsubscribes(username string) ([]*RecentUnsubscribe, error) {
+	rows, err := db.sql.Query(`
+		SELECT f.url, us.unsubscribed_at
+		FROM unsubscribe us
+		JOIN feed f ON f.id = us.feed_id
+		JOIN user u ON u.id = us.user_id
+		WHERE u.username = ?
+		ORDER BY us.unsubscribed_at DESC`, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unsubscribes []*RecentUnsubscribe
+	for rows.Next() {
+		var unsubscribe RecentUnsubscribe
+		if err = rows.Scan(&unsubscribe.FeedURL, &unsubscribe.UnsubscribedAt); err != nil {
+			return nil, err
+		}
+		unsubscribes = append(unsubscribes, &unsubscribe)
+	}
+	return unsubscribes, rows.Err()
+}
+
+// UndoUnsubscribe subscribes a user to a feed they unsubscribed from again,
+// the way they were subscribed before (favorite, notifications, note, title, muted)
+func (db *DB) UndoUnsubscribe(username string, feedURL string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`
+		INSERT INTO subscribe (user_id, feed_id, is_favorite, notify, note, title, is_muted)
+		SELECT us.user_id, us.feed_id, us.is_favorite, us.notify, us.note, us.title, us.is_muted FROM unsubscribe us
+		WHERE us.user_id = ? AND us.feed_id IN (SELECT id FROM feed WHERE url = ?)
+			AND NOT EXISTS (SELECT 1 FROM subscribe s WHERE s.user_id = us.user_id AND s.feed_id = us.feed_id)`,
+		userId, feedURL)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("there's no unsubscribe from '%s' to undo", feedURL)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM unsubscribe
+		WHERE user_id = ? AND feed_id IN (SELECT id FROM feed WHERE url = ?)`, userId, feedURL)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	db.unreadCounts.forgetAll()
+	return err
+}
+
+// ExpireUnsubscribes makes the unsubscribes made before olderThan final, and
+// returns the users who made them: what they read of those feeds can go,
+// see DeleteOrphanedPostReads, and so can the feeds no one else reads, see
+// DeleteOrphanFeeds.
+func (db *DB) ExpireUnsubscribes(olderThan time.Time) ([]string, error) {
+	lock()
+	defer unlock()
+
+	tx, err := db.sql.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT DISTINCT u.username FROM unsubscribe us
+		JOIN user u ON u.id = us.user_id
+		WHERE us.unsubscribed_at < ?`, olderThan.UTC())
+	if err != nil {
+		return nil, err
+	}
+	var usernames []string
+	for rows.Next() {
+		var username string
+		if err = rows.Scan(&username); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		usernames = append(usernames, username)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec("DELETE FROM unsubscribe WHERE unsubscribed_at < ?", olderThan.UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	return usernames, tx.Commit()
+}
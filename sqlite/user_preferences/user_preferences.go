@@ -1,19 +1,85 @@
 package user_preferences
 
 import (
+	"fmt"
 	"log"
 	"reflect"
+	"regexp"
 	"strconv"
 
 	"codeberg.org/meadowingc/mire/sqlite"
 )
 
 type UserPreferences struct {
-	NumPostsToShowInHomeScreen       int  `db:"numPostsToShowInHomeScreen" default:"300"`
-	NumUnreadPostsToShowInHomeScreen int  `db:"numUnreadPostsToShowInHomeScreen" default:"7"`
-	OpenLinksInNewTab                bool `db:"openLinksInNewTab" default:"false"`
+	NumPostsToShowInHomeScreen        int    `db:"numPostsToShowInHomeScreen" default:"300"`
+	NumUnreadPostsToShowInHomeScreen  int    `db:"numUnreadPostsToShowInHomeScreen" default:"7"`
+	OpenLinksInNewTab                 bool   `db:"openLinksInNewTab" default:"false"`
+	ShowReadingTime                   bool   `db:"showReadingTime" default:"true"`
+	DisplayDensity                    string `db:"displayDensity" default:"comfortable"`
+	ShareSubscriptionActivity         bool   `db:"shareSubscriptionActivity" default:"true"`
+	ShareFavoriteActivity             bool   `db:"shareFavoriteActivity" default:"false"`
+	HideSubscribedFeedsInDiscover     bool   `db:"hideSubscribedFeedsInDiscover" default:"false"`
+	PublishRecommendationsToFediverse bool   `db:"publishRecommendationsToFediverse" default:"false"`
+	SendWebmentions                   bool   `db:"sendWebmentions" default:"false"`
+	SensitivePosts                    string `db:"sensitivePosts" default:"blur"`
+	DigestSchedule                    string `db:"digestSchedule" default:"off"`
+	DigestFavoritesOnly               bool   `db:"digestFavoritesOnly" default:"false"`
+	NotifyByEmail                     bool   `db:"notifyByEmail" default:"false"`
+	// comma separated language codes, or "any"
+	DiscoverLanguages string `db:"discoverLanguages" default:"any"`
+	DateDisplay       string `db:"dateDisplay" default:"relative"`
+	// how absolute dates are shown, see DateFormatRegex
+	DateFormat string `db:"dateFormat" default:"YYYY-MM-DD HH:mm"`
+	// asks search engines not to index someone's profile and blogroll
+	HideFromSearchEngines bool `db:"hideFromSearchEngines" default:"false"`
+	// posts published more than this many days ago are marked read, 0 to
+	// leave them be
+	AutoMarkReadAfterDays int `db:"autoMarkReadAfterDays" default:"0"`
+	// when posts were read is forgotten after this many days, 0 to keep it
+	ReadHistoryDays int `db:"readHistoryDays" default:"0"`
 }
 
+// valid values for UserPreferences.DisplayDensity
+const (
+	DisplayDensityComfortable = "comfortable"
+	DisplayDensityCompact     = "compact"
+)
+
+// valid values for UserPreferences.SensitivePosts
+const (
+	SensitivePostsShow = "show"
+	SensitivePostsBlur = "blur"
+	SensitivePostsHide = "hide"
+)
+
+// valid values for UserPreferences.DigestSchedule
+const (
+	DigestOff    = "off"
+	DigestDaily  = "daily"
+	DigestWeekly = "weekly"
+)
+
+// value of UserPreferences.DiscoverLanguages when every language is shown
+const AnyLanguage = "any"
+
+// valid values for UserPreferences.DateDisplay
+const (
+	DateDisplayRelative = "relative"
+	DateDisplayAbsolute = "absolute"
+)
+
+// the most days UserPreferences.AutoMarkReadAfterDays and
+// UserPreferences.ReadHistoryDays can be
+const (
+	MaxAutoMarkReadAfterDays = 3650
+	MaxReadHistoryDays       = 3650
+)
+
+// DateFormatRegex matches the valid values of UserPreferences.DateFormat:
+// tokens like YYYY, MMM, DD, HH, hh, mm and A (AM/PM), separated by spaces
+// and punctuation. Pages format dates in the browser, see tail.tmpl.html.
+var DateFormatRegex = regexp.MustCompile(`^[YMDdHhmA \-/.,:]{1,40}$`)
+
 func SetFieldValue(field reflect.Value, value string) {
 	switch field.Kind() {
 	case reflect.Int:
@@ -107,6 +173,8 @@ func SaveUserPreferences(db *sqlite.DB, userID int, userPreferences *UserPrefere
 			fieldValue = strconv.FormatInt(field.Int(), 10)
 		case reflect.Bool:
 			fieldValue = strconv.FormatBool(field.Bool())
+		case reflect.String:
+			fieldValue = field.String()
 		default:
 			log.Fatalf("SaveUserPreferences:: Unsupported type for field %s", fieldName)
 		}
@@ -121,3 +189,78 @@ func SaveUserPreferences(db *sqlite.DB, userID int, userPreferences *UserPrefere
 		}
 	}
 }
+
+// ToMap returns the preferences by their db name, the way they're stored, for
+// account archives
+func ToMap(userPreferences *UserPreferences) map[string]string {
+	values := make(map[string]string)
+	val := reflect.ValueOf(userPreferences).Elem()
+	typ := val.Type()
+
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Field(i)
+		dbTag := typ.Field(i).Tag.Get("db")
+
+		switch field.Kind() {
+		case reflect.Int:
+			values[dbTag] = strconv.FormatInt(field.Int(), 10)
+		case reflect.Bool:
+			values[dbTag] = strconv.FormatBool(field.Bool())
+		case reflect.String:
+			values[dbTag] = field.String()
+		}
+	}
+	return values
+}
+
+// SetFromMap sets the preferences found in values, by their db name, the other
+// way around from ToMap. Unknown names are skipped, values that aren't of the
+// preference's type are an error (whether they make sense is up to the
+// caller).
+func SetFromMap(userPreferences *UserPreferences, values map[string]string) error {
+	val := reflect.ValueOf(userPreferences).Elem()
+	typ := val.Type()
+
+	for i := 0; i < val.NumField(); i++ {
+		dbTag := typ.Field(i).Tag.Get("db")
+		value, ok := values[dbTag]
+		if !ok {
+			continue
+		}
+
+		field := val.Field(i)
+		switch field.Kind() {
+		case reflect.Int:
+			intVal, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' for %s", value, dbTag)
+			}
+			field.SetInt(int64(intVal))
+		case reflect.Bool:
+			boolVal, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid value '%s' for %s", value, dbTag)
+			}
+			field.SetBool(boolVal)
+		case reflect.String:
+			field.SetString(value)
+		}
+	}
+	return nil
+}
+
+// GetDateFormat returns the format a user picked for dates, or an empty
+// string when they'd rather have them relative ("3 days ago"). Every page
+// shows dates, these two preferences are all they need.
+func GetDateFormat(db *sqlite.DB, userId int) string {
+	display := db.GetSingleUserPreference(userId, "dateDisplay")
+	if display == nil || *display != DateDisplayAbsolute {
+		return ""
+	}
+
+	format := db.GetSingleUserPreference(userId, "dateFormat")
+	if format == nil {
+		return GetDefaultUserPreferences().DateFormat
+	}
+	return *format
+}
@@ -0,0 +1,84 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type WallabagAccount struct {
+	Instance     string
+	ClientID     string
+	ClientSecret string
+	AccountName  string
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// GetWallabagAccount returns the wallabag account a user connected, or nil if
+// they didn't connect one
+func (db *DB) GetWallabagAccount(username string) (*WallabagAccount, error) {
+	var account WallabagAccount
+	err := db.sql.QueryRow(`
+		SELECT w.instance, w.client_id, w.client_secret, w.account_name, w.access_token, w.refresh_token, w.expires_at
+		FROM wallabag_account w
+		JOIN user u ON w.user_id = u.id
+		WHERE u.username = ?`, username).
+		Scan(&account.Instance, &account.ClientID, &account.ClientSecret, &account.AccountName,
+			&account.AccessToken, &account.RefreshToken, &account.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+// SaveWallabagAccount connects a wallabag account to a user, replacing the one
+// they had connected before
+func (db *DB) SaveWallabagAccount(username string, account *WallabagAccount) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec(`
+		INSERT INTO wallabag_account (user_id, instance, client_id, client_secret, account_name, access_token, refresh_token, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET
+			instance=excluded.instance,
+			client_id=excluded.client_id,
+			client_secret=excluded.client_secret,
+			account_name=excluded.account_name,
+			access_token=excluded.access_token,
+			refresh_token=excluded.refresh_token,
+			expires_at=excluded.expires_at`,
+		userId, account.Instance, account.ClientID, account.ClientSecret, account.AccountName,
+		account.AccessToken, account.RefreshToken, account.ExpiresAt.UTC())
+	unlock()
+
+	return err
+}
+
+// SetWallabagTokens saves the tokens a user's wallabag account was refreshed
+// with
+func (db *DB) SetWallabagTokens(username string, accessToken string, refreshToken string, expiresAt time.Time) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("UPDATE wallabag_account SET access_token=?, refresh_token=?, expires_at=? WHERE user_id=?",
+		accessToken, refreshToken, expiresAt.UTC(), userId)
+	unlock()
+
+	return err
+}
+
+func (db *DB) DeleteWallabagAccount(username string) error {
+	userId := db.GetUserID(username)
+
+	lock()
+	_, err := db.sql.Exec("DELETE FROM wallabag_account WHERE user_id=?", userId)
+	unlock()
+
+	return err
+}
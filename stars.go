@@ -0,0 +1,238 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/readwise"
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	maxStarQuoteLength = 4000
+	maxStarNoteLength  = 4000
+
+	// stars sent to readwise per person on every check
+	numReadwiseStarsPerCheck = 500
+)
+
+// starredHandler shows the posts a user starred, with their quotes and notes
+func (s *Site) starredHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("starredHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	stars, err := s.db.GetPostStars(username)
+	if err != nil {
+		s.renderErr("starredHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	readwiseConnection, err := s.db.GetReadwiseConnection(username)
+	if err != nil {
+		s.renderErr("starredHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Stars    []*sqlite.PostStar
+		Readwise *sqlite.ReadwiseConnection
+	}{
+		Stars:    stars,
+		Readwise: readwiseConnection,
+	}
+
+	s.renderPage(w, r, "starred", data)
+}
+
+// starredCSVHandler exports a user's stars in the CSV format readwise imports
+func (s *Site) starredCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("starredCSVHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	stars, err := s.db.GetPostStars(s.username(r))
+	if err != nil {
+		s.renderErr("starredCSVHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="mire-starred.csv"`)
+	err = readwise.WriteCSV(w, s.starHighlights(stars))
+	if err != nil {
+		log.Printf("[err] starredCSVHandler: could not write the export: %s\n", err)
+	}
+}
+
+// starHighlights turns stars into readwise highlights: the quote if there's
+// one, the post's title otherwise
+func (s *Site) starHighlights(stars []*sqlite.PostStar) []*readwise.Highlight {
+	highlights := make([]*readwise.Highlight, 0, len(stars))
+	for _, star := range stars {
+		text := star.Quote
+		if text == "" {
+			text = star.Title
+		}
+		highlights = append(highlights, &readwise.Highlight{
+			Text:          text,
+			Title:         star.Title,
+			Author:        s.feedTitleOrDomain(star.FeedURL),
+			SourceURL:     star.URL,
+			SourceType:    "mire",
+			Category:      "articles",
+			Note:          star.Note,
+			HighlightedAt: star.CreatedAt,
+		})
+	}
+	return highlights
+}
+
+func (s *Site) starPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("starPostHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("starPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	quote := strings.TrimSpace(strings.ReplaceAll(r.FormValue("quote"), "\r\n", "\n"))
+	note := strings.TrimSpace(strings.ReplaceAll(r.FormValue("note"), "\r\n", "\n"))
+	if len([]rune(quote)) > maxStarQuoteLength || len([]rune(note)) > maxStarNoteLength {
+		e := fmt.Sprintf("quotes and notes can be at most %d characters long", maxStarNoteLength)
+		s.renderErr("starPostHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	existing, err := s.db.GetPostStar(username, postId)
+	if err != nil {
+		s.renderErr("starPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = s.db.StarPost(username, post, quote, note)
+	if err != nil {
+		s.renderErr("starPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// only new stars are bookmarked, editing the quote or note doesn't
+	// bookmark the post again
+	if existing == nil {
+		go s.bookmarkStar(username, post, quote, note)
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
+
+func (s *Site) unstarPostHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("unstarPostHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = s.db.UnstarPost(s.username(r), postId)
+	if err != nil {
+		s.renderErr("unstarPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
+
+// settingsReadwiseHandler sets (or clears) the readwise access token stars
+// are sent with
+func (s *Site) settingsReadwiseHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsReadwiseHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	token := strings.TrimSpace(r.FormValue("token"))
+
+	var err error
+	if token == "" {
+		err = s.db.RemoveReadwiseToken(username)
+	} else {
+		err = readwise.CheckToken(token)
+		if err == readwise.ErrInvalidToken {
+			s.renderErr("settingsReadwiseHandler", w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			s.renderErr("settingsReadwiseHandler", w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		err = s.db.SetReadwiseToken(username, token)
+	}
+	if err != nil {
+		s.renderErr("settingsReadwiseHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#readwise", http.StatusSeeOther)
+}
+
+// sendReadwiseHighlights sends the stars that changed since they were last
+// sent to everyone's readwise
+func sendReadwiseHighlights(s *Site) {
+	connections, err := s.db.GetReadwiseConnections()
+	if err != nil {
+		log.Printf("[err] sendReadwiseHighlights: could not get the connected accounts: %s\n", err)
+		return
+	}
+
+	for _, connection := range connections {
+		stars, err := s.db.GetUnsyncedPostStars(connection.Username, numReadwiseStarsPerCheck)
+		if err != nil {
+			log.Printf("[err] sendReadwiseHighlights: could not get the stars of '%s': %s\n", connection.Username, err)
+			continue
+		}
+		if len(stars) == 0 {
+			continue
+		}
+
+		err = readwise.Send(connection.Token, s.starHighlights(stars))
+		if err != nil {
+			// shown in the settings, tried again on the next check
+			log.Printf("[err] sendReadwiseHighlights: could not send the stars of '%s': %s\n", connection.Username, err)
+			s.db.SetReadwiseSyncResult(connection.Username, time.Now(), err.Error())
+			continue
+		}
+
+		err = s.db.MarkPostStarsSynced(connection.Username, stars)
+		if err != nil {
+			log.Printf("[err] sendReadwiseHighlights: could not mark the stars of '%s' as sent: %s\n", connection.Username, err)
+		}
+		s.db.SetReadwiseSyncResult(connection.Username, time.Now(), "")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// welcomeHandler is where new users land after registering, it offers them
+// the starter packs so they don't start with an empty timeline.
+func (s *Site) welcomeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	packs, err := s.db.GetStarterPacks()
+	if err != nil {
+		s.renderErr("welcomeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Packs         []*sqlite.StarterPack
+		Subscriptions []string
+	}{
+		Packs:         packs,
+		Subscriptions: s.db.GetUserFeedURLs(s.username(r)),
+	}
+
+	s.renderPage(w, r, "welcome", data)
+}
+
+// starterPackSubscribeHandler subscribes the user to every feed in a starter
+// pack, on top of the feeds they're already subscribed to.
+func (s *Site) starterPackSubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("starterPackSubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	pack, err := s.db.GetStarterPack(r.PathValue("slug"))
+	if err != nil {
+		s.renderErr("starterPackSubscribeHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pack == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if err := s.subscribeToFeeds(s.username(r), pack.FeedURLs); err != nil {
+		s.renderQuotaErr("starterPackSubscribeHandler", w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/welcome", http.StatusSeeOther)
+}
+
+func (s *Site) adminStarterPacksHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminStarterPacksHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	packs, err := s.db.GetStarterPacks()
+	if err != nil {
+		s.renderErr("adminStarterPacksHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderPage(w, r, "admin_starter_packs", packs)
+}
+
+// adminSaveStarterPackHandler creates or updates a starter pack
+func (s *Site) adminSaveStarterPackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminSaveStarterPackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	pack := &sqlite.StarterPack{
+		Slug:        strings.TrimSpace(r.FormValue("slug")),
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+
+	if !slugRegex.MatchString(pack.Slug) {
+		e := fmt.Sprintf("invalid slug '%s', use lowercase letters, numbers and dashes", pack.Slug)
+		s.renderErr("adminSaveStarterPackHandler", w, e, http.StatusBadRequest)
+		return
+	}
+	if pack.Name == "" {
+		s.renderErr("adminSaveStarterPackHandler", w, "a starter pack needs a name", http.StatusBadRequest)
+		return
+	}
+
+	feedURLs, err := parseFeedURLList(r.FormValue("feeds"))
+	if err != nil {
+		s.renderErr("adminSaveStarterPackHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pack.FeedURLs = feedURLs
+
+	err = s.db.SaveStarterPack(pack)
+	if err != nil {
+		s.renderErr("adminSaveStarterPackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/starter-packs", http.StatusSeeOther)
+}
+
+func (s *Site) adminDeleteStarterPackHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.isAdmin(r) {
+		s.renderErr("adminDeleteStarterPackHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.DeleteStarterPack(r.PathValue("slug"))
+	if err != nil {
+		s.renderErr("adminDeleteStarterPackHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/admin/starter-packs", http.StatusSeeOther)
+}
@@ -1,6 +1,14 @@
 package main
 
-import "time"
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/topics"
+)
 
 type MireSiteStats struct {
 	LastComputed   time.Time
@@ -9,15 +17,137 @@ type MireSiteStats struct {
 	NumUniqueFeeds int
 }
 
-var globalSiteStats *MireSiteStats = &MireSiteStats{}
+// how often the stats (and the feed topics) are computed, unless an admin
+// says otherwise, see statsInterval. They're never computed more often than
+// every minStatsInterval.
+const (
+	defaultStatsInterval = 6 * time.Hour
+	minStatsInterval     = 10 * time.Minute
+)
+
+// globalSiteStats are the stats shown on /about, computed by the stats
+// process
+var globalSiteStats = struct {
+	sync.RWMutex
+	stats MireSiteStats
+}{}
+
+func getSiteStats() MireSiteStats {
+	globalSiteStats.RLock()
+	defer globalSiteStats.RUnlock()
+	return globalSiteStats.stats
+}
+
+// recomputeStats wakes up the stats process to compute everything right
+// away, see recomputeStatsNow
+var recomputeStats = make(chan struct{}, 1)
+
+// recomputeStatsNow has the stats process compute everything without waiting
+// for its next round. It doesn't wait for it to be done.
+func recomputeStatsNow() {
+	select {
+	case recomputeStats <- struct{}{}:
+	default:
+		// already asked to
+	}
+}
+
+// statsInterval is how often the stats are computed, as set by an admin
+func statsInterval(s *Site) time.Duration {
+	value, err := s.db.GetSiteSetting(sqlite.SettingStatsInterval, "")
+	if err != nil {
+		log.Printf("[err] statsInterval: could not get the stats interval: %s\n", err)
+		return defaultStatsInterval
+	}
+	if value == "" {
+		return defaultStatsInterval
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil || interval < minStatsInterval {
+		log.Printf("[err] statsInterval: invalid stats interval '%s', using %s\n", value, defaultStatsInterval)
+		return defaultStatsInterval
+	}
+	return interval
+}
+
+func statsCalculatorProcess(ctx context.Context, s *Site) error {
+	// the counts are quick, nobody should see zeroes on /about while the
+	// rest is computed
+	computeSiteStats(s)
+
+	// the topics are classified on startup too, feeds added since the last
+	// round would go without them for a whole interval otherwise
+	force := true
 
-func statsCalculatorProcess(s *Site) {
 	for {
-		globalSiteStats.LastComputed = time.Now()
-		globalSiteStats.NumReadPosts = s.db.GetGlobalNumReadPosts()
-		globalSiteStats.NumUniqueFeeds = s.db.GetGlobalNumUniqueFeeds()
-		globalSiteStats.TotalUsers = s.db.GetGlobalNumUsers()
+		// trending posts and recommendations go stale a lot faster than the
+		// rest of the stats
+		computeTrendingPosts(s)
+
+		err := s.db.RefreshFeedRecommendations()
+		if err != nil {
+			log.Printf("[err] statsCalculatorProcess: could not refresh recommendations: %s\n", err)
+		}
+
+		interval := statsInterval(s)
+		if force || time.Since(getSiteStats().LastComputed) >= interval {
+			computeSiteStats(s)
+			classifyFeedTopics(s)
+			classifySensitiveFeeds(s)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-recomputeStats:
+			force = true
+		case <-time.After(min(1*time.Hour, interval)):
+			force = false
+		}
+	}
+}
+
+// computeSiteStats counts what's shown on /about
+func computeSiteStats(s *Site) {
+	stats := MireSiteStats{
+		LastComputed:   time.Now(),
+		NumReadPosts:   s.db.GetGlobalNumReadPosts(),
+		NumUniqueFeeds: s.db.GetGlobalNumUniqueFeeds(),
+		TotalUsers:     s.db.GetGlobalNumUsers(),
+	}
+
+	globalSiteStats.Lock()
+	globalSiteStats.stats = stats
+	globalSiteStats.Unlock()
+}
+
+// classifyFeedTopics guesses the topics of every feed that doesn't have its
+// topics assigned by an admin.
+func classifyFeedTopics(s *Site) {
+	feedURLs, err := s.db.GetFeedsWithoutAdminTopics()
+	if err != nil {
+		log.Printf("[err] classifyFeedTopics: could not get feeds: %s\n", err)
+		return
+	}
+
+	for _, feedURL := range feedURLs {
+		postTitles, err := s.db.GetRecentPostTitlesForFeed(feedURL, 30)
+		if err != nil {
+			log.Printf("[err] classifyFeedTopics: could not get posts for '%s': %s\n", feedURL, err)
+			continue
+		}
+
+		var title, description string
+		if s.reaper.HasFeed(feedURL) {
+			feed := s.reaper.GetFeed(feedURL)
+			title, description = feed.Title, feed.Description
+		}
 
-		time.Sleep(6 * time.Hour)
+		feedTopics := topics.Classify(title, description, postTitles)
+		err = s.db.SetFeedTopics(feedURL, feedTopics, sqlite.TopicSourceHeuristic)
+		if err != nil {
+			log.Printf("[err] classifyFeedTopics: could not save topics for '%s': %s\n", feedURL, err)
+		}
 	}
 }
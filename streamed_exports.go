@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+// Exports that can get big (every post someone ever read) are written as
+// they're read from the database, and flushed every streamFlushEvery items,
+// so that they never sit in memory whole and proxies see the download moving.
+const streamFlushEvery = 100
+
+// exportStream writes an export as it goes, flushing it every now and then
+type exportStream struct {
+	w     http.ResponseWriter
+	rc    *http.ResponseController
+	items int
+
+	// flushed before the response, for writers that buffer on top of the
+	// stream
+	flushFirst interface{ Flush() }
+}
+
+// startExport sends the headers of an export download, after which errors
+// can only be logged
+func startExport(w http.ResponseWriter, contentType string, filename string) *exportStream {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	return &exportStream{w: w, rc: http.NewResponseController(w)}
+}
+
+func (e *exportStream) Write(b []byte) (int, error) {
+	return e.w.Write(b)
+}
+
+// wrote counts an item written, and flushes the ones before it if it's time
+func (e *exportStream) wrote() error {
+	e.items++
+	if e.items%streamFlushEvery != 0 {
+		return nil
+	}
+	if e.flushFirst != nil {
+		e.flushFirst.Flush()
+	}
+	return e.rc.Flush()
+}
+
+func exportFilename(name string, extension string) string {
+	return "mire-" + name + "-" + time.Now().Format("2006-01-02") + "." + extension
+}
+
+// exportSubscriptionsHandler downloads the feeds someone is subscribed to as
+// OPML, which every feed reader can import
+func (s *Site) exportSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("exportSubscriptionsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	feedURLs := s.db.GetUserFeedURLs(username)
+
+	stream := startExport(w, "text/x-opml; charset=utf-8", exportFilename("subscriptions", "opml"))
+	err := s.writeOPML(stream, username, feedURLs)
+	if err != nil {
+		log.Printf("[err] exportSubscriptionsHandler: could not export the subscriptions of '%s': %s\n", username, err)
+	}
+}
+
+func (s *Site) writeOPML(stream *exportStream, username string, feedURLs []string) error {
+	_, err := fmt.Fprintf(stream, "%s<opml version=\"2.0\">\n<head><title>%s's subscriptions on mire</title></head>\n<body>\n",
+		xml.Header, xmlEscape(username))
+	if err != nil {
+		return err
+	}
+
+	titles, err := s.db.GetSubscriptionTitles(username)
+	if err != nil {
+		return err
+	}
+
+	for _, feedURL := range feedURLs {
+		title := titles[feedURL]
+		if title == "" {
+			title = s.feedTitle(feedURL)
+		}
+		if title == "" {
+			title = s.printDomain(feedURL)
+		}
+		_, err = fmt.Fprintf(stream, "<outline type=\"rss\" text=\"%s\" title=\"%s\" xmlUrl=\"%s\"/>\n",
+			xmlEscape(title), xmlEscape(title), xmlEscape(feedURL))
+		if err != nil {
+			return err
+		}
+		if err = stream.wrote(); err != nil {
+			return err
+		}
+	}
+
+	_, err = io.WriteString(stream, "</body>\n</opml>\n")
+	return err
+}
+
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// exportHistoryHandler downloads every post someone read, oldest first, as
+// CSV
+func (s *Site) exportHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("exportHistoryHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	stream := startExport(w, "text/csv; charset=utf-8", exportFilename("history", "csv"))
+
+	out := csv.NewWriter(stream)
+	stream.flushFirst = out
+	out.Write([]string{"title", "url", "feed_url", "published_at", "read_at"})
+	err := s.db.EachReadPost(username, func(post *sqlite.ReadPost) error {
+		err := out.Write([]string{
+			post.Title,
+			post.URL,
+			post.FeedURL,
+			post.PublishedAt.UTC().Format(time.RFC3339),
+			post.ReadAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+		return stream.wrote()
+	})
+	out.Flush()
+	if err == nil {
+		err = out.Error()
+	}
+	if err != nil {
+		log.Printf("[err] exportHistoryHandler: could not export the history of '%s': %s\n", username, err)
+	}
+}
+
+type archiveSubscription struct {
+	URL      string `json:"url"`
+	Title    string `json:"title"`
+	Favorite bool   `json:"favorite,omitempty"`
+	Notify   bool   `json:"notify,omitempty"`
+	Note     string `json:"note,omitempty"`
+	// the title whoever exported it gave the feed, see subscription_titles.go
+	CustomTitle string `json:"custom_title,omitempty"`
+}
+
+type archiveStar struct {
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	FeedURL   string `json:"feed_url"`
+	Quote     string `json:"quote"`
+	Note      string `json:"note"`
+	StarredAt string `json:"starred_at"`
+}
+
+type archiveRead struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	FeedURL     string `json:"feed_url"`
+	PublishedAt string `json:"published_at"`
+	ReadAt      string `json:"read_at"`
+}
+
+// exportArchiveHandler downloads everything someone has on mire as one JSON
+// document: their preferences, subscriptions, stars and read history. It can
+// be restored, on this instance or another one, see settingsRestoreHandler.
+func (s *Site) exportArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("exportArchiveHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	stars, err := s.db.GetPostStars(username)
+	if err != nil {
+		s.renderErr("exportArchiveHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stream := startExport(w, "application/json", exportFilename("archive", "json"))
+	err = s.writeArchive(stream, username, stars)
+	if err != nil {
+		log.Printf("[err] exportArchiveHandler: could not export the archive of '%s': %s\n", username, err)
+	}
+}
+
+// writeArchive writes the archive one item at a time, the JSON of the whole
+// thing would be as big as the download
+func (s *Site) writeArchive(stream *exportStream, username string, stars []*sqlite.PostStar) error {
+	header, _ := json.Marshal(username)
+	preferences, err := json.Marshal(user_preferences.ToMap(user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username))))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stream, "{\"username\":%s,\"exported_at\":%q,\n\"preferences\":%s,\n",
+		header, time.Now().UTC().Format(time.RFC3339), preferences)
+	if err != nil {
+		return err
+	}
+
+	// writeItem writes an item of the current list, with the comma before it
+	// unless it's the first
+	first := true
+	writeItem := func(item any) error {
+		b, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		if !first {
+			b = append([]byte(",\n"), b...)
+		}
+		first = false
+		if _, err = stream.Write(b); err != nil {
+			return err
+		}
+		return stream.wrote()
+	}
+	startList := func(name string, isFirst bool) error {
+		first = true
+		sep := ",\n"
+		if isFirst {
+			sep = ""
+		}
+		_, err := fmt.Fprintf(stream, "%s%q:[\n", sep, name)
+		return err
+	}
+	endList := func() error {
+		_, err := io.WriteString(stream, "\n]")
+		return err
+	}
+
+	if err = startList("subscriptions", true); err != nil {
+		return err
+	}
+	for _, feed := range s.db.GetUserFeedURLsForSettings(username) {
+		err = writeItem(archiveSubscription{
+			URL:         feed.URL,
+			Title:       s.feedTitle(feed.URL),
+			Favorite:    feed.IsFavorite,
+			Notify:      feed.Notify,
+			Note:        feed.Note,
+			CustomTitle: feed.Title,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = endList(); err != nil {
+		return err
+	}
+
+	if err = startList("stars", false); err != nil {
+		return err
+	}
+	for _, star := range stars {
+		err = writeItem(archiveStar{
+			Title:     star.Title,
+			URL:       star.URL,
+			FeedURL:   star.FeedURL,
+			Quote:     star.Quote,
+			Note:      star.Note,
+			StarredAt: star.CreatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = endList(); err != nil {
+		return err
+	}
+
+	if err = startList("read", false); err != nil {
+		return err
+	}
+	err = s.db.EachReadPost(username, func(post *sqlite.ReadPost) error {
+		return writeItem(archiveRead{
+			Title:       post.Title,
+			URL:         post.URL,
+			FeedURL:     post.FeedURL,
+			PublishedAt: post.PublishedAt.UTC().Format(time.RFC3339),
+			ReadAt:      post.ReadAt.UTC().Format(time.RFC3339),
+		})
+	})
+	if err != nil {
+		return err
+	}
+	if err = endList(); err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(stream, "}\n")
+	return err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/autodiscovery"
+	"codeberg.org/meadowingc/mire/constants"
+)
+
+// bookmarkletURL returns the bookmarklet that opens the subscribe page for the
+// page someone is on
+func bookmarkletURL() template.URL {
+	return template.URL("javascript:location.href='" + constants.BASE_URL +
+		"/subscribe?url='+encodeURIComponent(location.href)")
+}
+
+// subscribeHandler shows the feeds of the page the bookmarklet was clicked on,
+// to pick the ones to subscribe to. The one most likely to be the page's posts
+// is picked already, so it's one click in the usual case.
+func (s *Site) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		http.Redirect(w, r, "/login?next="+url.QueryEscape(r.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+
+	pageURL, err := pageURLParam(r)
+	if err != nil {
+		s.renderErr("subscribeHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	feeds, err := s.pageFeeds(pageURL, nil)
+	if err != nil {
+		s.renderErr("subscribeHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	entries := s.pageFeedEntries(s.username(r), feeds)
+	picked := pickPageFeed(entries)
+
+	data := struct {
+		PageURL string
+		Feeds   []pageFeedEntry
+		Picked  string
+	}{
+		PageURL: pageURL,
+		Feeds:   entries,
+		Picked:  picked,
+	}
+
+	s.renderPage(w, r, "subscribe", data)
+}
+
+// discoverFeeds returns the feeds found at a URL someone wants to subscribe
+// to: the URL itself when it's a feed, or the feeds the page there links to.
+// It errors when there's none, subscribing to a page would only ever fail.
+func (s *Site) discoverFeeds(username string, pageURL string) ([]pageFeedEntry, error) {
+	feeds, err := autodiscovery.Find(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("could not look for feeds at '%s': %s", pageURL, err)
+	}
+	if len(feeds) == 0 {
+		return nil, fmt.Errorf("'%s' is not a feed, and doesn't link to any", pageURL)
+	}
+	return s.pageFeedEntries(username, feeds), nil
+}
+
+// subscribeConfirmHandler subscribes someone to the feeds they picked on the
+// subscribe page and takes them to the feed, or to their subscriptions if
+// they picked more than one
+func (s *Site) subscribeConfirmHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("subscribeConfirmHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+	r.ParseForm()
+
+	var feedURLs []string
+	for _, picked := range r.Form["feed"] {
+		picked = strings.TrimSpace(picked)
+		if picked == "" {
+			continue
+		}
+
+		feedURL := picked
+		if !s.reaper.HasFeed(picked) {
+			var err error
+			feedURL, err = resolveFeedURL(picked)
+			if err != nil {
+				s.renderErr("subscribeConfirmHandler", w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if !slices.Contains(feedURLs, feedURL) {
+			feedURLs = append(feedURLs, feedURL)
+		}
+	}
+	if len(feedURLs) == 0 {
+		s.renderErr("subscribeConfirmHandler", w, "pick a feed to subscribe to", http.StatusBadRequest)
+		return
+	}
+
+	if err := s.subscribeToFeeds(s.username(r), feedURLs); err != nil {
+		s.renderQuotaErr("subscribeConfirmHandler", w, err)
+		return
+	}
+
+	if len(feedURLs) > 1 {
+		http.Redirect(w, r, "/settings#subscriptions", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/feeds/"+url.QueryEscape(feedURLs[0]), http.StatusSeeOther)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+// how long the notes people keep about their subscriptions can be
+const maxSubscriptionNoteLength = 200
+
+// feedNoteHandler keeps someone's private note about one of their
+// subscriptions, shown to them in their settings and on the feed's page
+func (s *Site) feedNoteHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedNoteHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedNoteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	note := strings.TrimSpace(r.FormValue("note"))
+	if utf8.RuneCountInString(note) > maxSubscriptionNoteLength {
+		e := fmt.Sprintf("notes can be %d characters long at most", maxSubscriptionNoteLength)
+		s.renderErr("feedNoteHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err = s.db.SetSubscriptionNote(s.username(r), feedURL, note)
+	if err != nil {
+		s.renderErr("feedNoteHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/feeds/"+url.QueryEscape(feedURL)), http.StatusSeeOther)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// how long the titles people give their subscriptions can be
+const maxSubscriptionTitleLength = 100
+
+// feedTitleHandler gives one of someone's subscriptions a title of their own,
+// shown to them instead of the feed's
+func (s *Site) feedTitleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("feedTitleHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("url"))
+	if err != nil {
+		s.renderErr("feedTitleHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.setSubscriptionTitle(s.username(r), feedURL, r.FormValue("title")); err != nil {
+		s.renderErr("feedTitleHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, "/feeds/"+url.QueryEscape(feedURL)), http.StatusSeeOther)
+}
+
+// apiSetFeedTitleHandler is feedTitleHandler for apps, it answers with the
+// title the feed goes by now
+func (s *Site) apiSetFeedTitleHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiSetFeedTitleHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	feedURL, err := url.QueryUnescape(r.PathValue("feedUrl"))
+	if err != nil || feedURL == "" {
+		s.renderErr("apiSetFeedTitleHandler", w, "Feed URL is required", http.StatusBadRequest)
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if err := s.setSubscriptionTitle(s.username(r), feedURL, title); err != nil {
+		s.renderErr("apiSetFeedTitleHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	shownTitle := title
+	if shownTitle == "" {
+		shownTitle = s.feedTitleOrDomain(feedURL)
+	}
+	s.renderJSON(w, struct {
+		Title  string `json:"title"`
+		Custom bool   `json:"custom"`
+	}{
+		Title:  shownTitle,
+		Custom: title != "",
+	})
+}
+
+func (s *Site) setSubscriptionTitle(username string, feedURL string, title string) error {
+	title = strings.TrimSpace(title)
+	if utf8.RuneCountInString(title) > maxSubscriptionTitleLength {
+		return fmt.Errorf("titles can be %d characters long at most", maxSubscriptionTitleLength)
+	}
+	return s.db.SetSubscriptionTitle(username, feedURL, title)
+}
+
+// applySubscriptionTitles sets the titles someone gave their feeds on the
+// posts they're looking at
+func (s *Site) applySubscriptionTitles(username string, entryLists ...[]*sqlite.UserPostEntry) error {
+	titles, err := s.db.GetSubscriptionTitles(username)
+	if err != nil {
+		return err
+	}
+	for _, entries := range entryLists {
+		for _, entry := range entries {
+			entry.FeedTitle = titles[entry.FeedURL]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// at most this many feeds can be subscribed to or unsubscribed from at once,
+// and that's about how big their list can be
+const (
+	maxBatchSubscriptions     = 500
+	maxBatchSubscriptionsSize = 1 << 20
+)
+
+// what happened to each feed of a batch
+const (
+	batchSubscribed    = "subscribed"
+	batchFetchError    = "fetch_error"
+	batchInvalid       = "invalid"
+	batchUnsubscribed  = "unsubscribed"
+	batchNotSubscribed = "not_subscribed"
+	batchOverQuota     = "over_quota"
+	batchHostile       = "hostile"
+	batchHostFlood     = "host_flood"
+)
+
+// batchSubscriptions is what's posted to /api/v1/subscriptions
+type batchSubscriptions struct {
+	Subscribe   []string `json:"subscribe"`
+	Unsubscribe []string `json:"unsubscribe"`
+}
+
+// batchSubscriptionResult is what happened to one of the URLs of a batch.
+// Feeds that can't be fetched are still subscribed to, mire keeps trying.
+type batchSubscriptionResult struct {
+	URL     string `json:"url"`
+	FeedURL string `json:"feed_url,omitempty"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// resolveBatchFeedURL finds the feed of a URL of a batch, like the subscribe
+// form does, under the URL mire knows it by if it does
+func (s *Site) resolveBatchFeedURL(input string) (string, error) {
+	if known := s.db.KnownFeedURL(input); s.reaper.HasFeed(known) {
+		return known, nil
+	}
+
+	feedURL, err := resolveFeedURL(input)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(feedURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "", fmt.Errorf("'%s' is not the URL of a feed", input)
+	}
+	return s.db.KnownFeedURL(feedURL), nil
+}
+
+// apiBatchSubscriptionsHandler subscribes someone to, and unsubscribes them
+// from, many feeds at once, for importers and extensions. It takes a JSON
+// object with a "subscribe" and an "unsubscribe" list of URLs and tells what
+// happened to each of them.
+func (s *Site) apiBatchSubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiBatchSubscriptionsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	var batch batchSubscriptions
+	err := json.NewDecoder(io.LimitReader(r.Body, maxBatchSubscriptionsSize)).Decode(&batch)
+	if err != nil {
+		s.renderErr("apiBatchSubscriptionsHandler", w, fmt.Sprintf("could not read the subscriptions: %s", err), http.StatusBadRequest)
+		return
+	}
+	if len(batch.Subscribe)+len(batch.Unsubscribe) > maxBatchSubscriptions {
+		s.renderErr("apiBatchSubscriptionsHandler", w,
+			fmt.Sprintf("at most %d feeds can be changed at once", maxBatchSubscriptions), http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	results := []batchSubscriptionResult{}
+
+	if len(batch.Unsubscribe) > 0 {
+		subscriptions := s.db.GetUserFeedURLs(username)
+		for _, input := range batch.Unsubscribe {
+			result := batchSubscriptionResult{URL: input, FeedURL: s.db.KnownFeedURL(strings.TrimSpace(input))}
+			if !slices.Contains(subscriptions, result.FeedURL) {
+				result.Status = batchNotSubscribed
+				results = append(results, result)
+				continue
+			}
+
+			if err := s.db.Unsubscribe(username, result.FeedURL); err != nil {
+				s.renderErr("apiBatchSubscriptionsHandler", w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result.Status = batchUnsubscribed
+			results = append(results, result)
+		}
+
+		s.db.DeleteOrphanedPostReads(username)
+		s.removeOrphanFeeds()
+	}
+
+	var feedURLs []string
+	subscribeResults := make([]batchSubscriptionResult, len(batch.Subscribe))
+	for i, input := range batch.Subscribe {
+		subscribeResults[i].URL = input
+		feedURL, err := s.resolveBatchFeedURL(strings.TrimSpace(input))
+		if err != nil {
+			subscribeResults[i].Status = batchInvalid
+			if errors.Is(err, reaper.ErrHostileTarget) {
+				subscribeResults[i].Status = batchHostile
+			}
+			subscribeResults[i].Error = err.Error()
+			continue
+		}
+		subscribeResults[i].FeedURL = feedURL
+		if !slices.Contains(feedURLs, feedURL) {
+			feedURLs = append(feedURLs, feedURL)
+		}
+	}
+
+	// the feeds the reaper won't have are left out, the others are still
+	// subscribed to
+	refused := s.reaper.RefusedFeeds(feedURLs)
+	feedURLs = slices.DeleteFunc(feedURLs, func(feedURL string) bool {
+		_, ok := refused[feedURL]
+		return ok
+	})
+
+	// over their quota, none of the feeds are subscribed to
+	var quotaErr quotaError
+	err = s.subscribeToFeeds(username, feedURLs)
+	if err != nil && !errors.As(err, &quotaErr) {
+		s.renderErr("apiBatchSubscriptionsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for _, result := range subscribeResults {
+		if refusal, ok := refused[result.FeedURL]; result.Status == "" && ok {
+			result.Status = batchRefusalStatus(refusal)
+			result.Error = refusal.Error()
+		}
+		if result.Status == "" && err != nil {
+			result.Status = batchRefusalStatus(err)
+			result.Error = err.Error()
+		}
+		if result.Status == "" {
+			fetchErr, err := s.db.GetFeedFetchError(result.FeedURL)
+			if err != nil {
+				s.renderErr("apiBatchSubscriptionsHandler", w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			result.Status = batchSubscribed
+			if fetchErr != "" {
+				result.Status = batchFetchError
+				result.Error = fetchErr
+			}
+		}
+		results = append(results, result)
+	}
+
+	s.renderJSON(w, struct {
+		Results []batchSubscriptionResult `json:"results"`
+	}{
+		Results: results,
+	})
+}
+
+// batchRefusalStatus is the status of the feeds of a batch that weren't
+// subscribed to because of err
+func batchRefusalStatus(err error) string {
+	switch {
+	case errors.Is(err, reaper.ErrHostileTarget):
+		return batchHostile
+	case errors.Is(err, reaper.ErrHostFlood):
+		return batchHostFlood
+	default:
+		return batchOverQuota
+	}
+}
@@ -0,0 +1,100 @@
+// Package supervisor keeps the processes mire runs in the background going:
+// they all stop together when mire shuts down, and one that panics is
+// started again instead of taking the whole site down with it.
+package supervisor
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// how long to wait before starting a process that panicked again, doubled
+// every time it panics right after being started, up to maxRestartDelay
+const (
+	restartDelay    = time.Second
+	maxRestartDelay = 5 * time.Minute
+)
+
+// Group is a set of processes that share a context
+type Group struct {
+	group *errgroup.Group
+	ctx   context.Context
+}
+
+// New returns a group whose processes stop when ctx is done
+func New(ctx context.Context) *Group {
+	group, ctx := errgroup.WithContext(ctx)
+	return &Group{group: group, ctx: ctx}
+}
+
+// Context is done when the group is stopping, because the context it was
+// made with is done or because one of its processes failed
+func (g *Group) Context() context.Context {
+	return g.ctx
+}
+
+// Go runs process in the background until it returns. Processes must return
+// once their context is done. One that returns an error stops the whole
+// group, one that panics is logged and run again after a while.
+func (g *Group) Go(name string, process func(ctx context.Context) error) {
+	g.group.Go(func() error {
+		delay := restartDelay
+		for {
+			started := time.Now()
+			err, panicked := run(g.ctx, name, process)
+			if !panicked {
+				if err != nil {
+					return fmt.Errorf("%s: %w", name, err)
+				}
+				return nil
+			}
+
+			// it ran fine for a while, this panic isn't part of a crash loop
+			if time.Since(started) > maxRestartDelay {
+				delay = restartDelay
+			}
+
+			log.Printf("[err] supervisor: restarting %s in %s\n", name, delay)
+			if !Sleep(g.ctx, delay) {
+				return nil
+			}
+			delay = min(2*delay, maxRestartDelay)
+		}
+	})
+}
+
+// run runs process once, telling whether it panicked
+func run(ctx context.Context, name string, process func(ctx context.Context) error) (err error, panicked bool) {
+	defer func() {
+		if v := recover(); v != nil {
+			log.Printf("[err] supervisor: %s panicked: %v\n%s", name, v, debug.Stack())
+			panicked = true
+		}
+	}()
+	return process(ctx), false
+}
+
+// Wait waits for every process to return, and returns the first error one
+// of them returned
+func (g *Group) Wait() error {
+	return g.group.Wait()
+}
+
+// Sleep waits for d to pass, or for ctx to be done. It returns false in the
+// latter case, when the process calling it should stop.
+func Sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
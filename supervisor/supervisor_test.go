@@ -0,0 +1,72 @@
+package supervisor
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPanickingProcessesAreRestarted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	group := New(ctx)
+
+	var runs atomic.Int32
+	group.Go("panicky", func(ctx context.Context) error {
+		if runs.Add(1) == 1 {
+			panic("oh no")
+		}
+		<-ctx.Done()
+		return nil
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runs.Load() < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runs.Load(); n != 2 {
+		t.Fatalf("expected the process to be run again after panicking, it ran %d times", n)
+	}
+
+	cancel()
+	if err := group.Wait(); err != nil {
+		t.Errorf("expected no error after stopping, got %s", err)
+	}
+}
+
+func TestFailingProcessStopsTheGroup(t *testing.T) {
+	group := New(context.Background())
+
+	stopped := make(chan struct{})
+	group.Go("waiting", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return nil
+	})
+	group.Go("failing", func(ctx context.Context) error {
+		return errors.New("broken")
+	})
+
+	err := group.Wait()
+	if err == nil || err.Error() != "failing: broken" {
+		t.Errorf("expected the error of the failing process, got %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Error("expected the other processes to be stopped")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	if !Sleep(context.Background(), time.Millisecond) {
+		t.Error("expected sleeping to finish")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if Sleep(ctx, time.Hour) {
+		t.Error("expected sleeping to stop when the context is done")
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+const (
+	maxTeamMembers = 50
+	maxTeamFeeds   = 500
+
+	// how many of the latest posts of a team's feeds its page shows
+	numTeamPosts = 100
+)
+
+// teamsHandler lists the teams someone is in, and lets them start one
+func (s *Site) teamsHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("teamsHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	teams, err := s.db.GetUserTeams(s.username(r))
+	if err != nil {
+		s.renderErr("teamsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s.renderPage(w, r, "teams", teams)
+}
+
+// createTeamHandler starts a team, with whoever started it as its owner
+func (s *Site) createTeamHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("createTeamHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	slug := strings.TrimSpace(r.FormValue("slug"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	if !slugRegex.MatchString(slug) {
+		e := fmt.Sprintf("invalid slug '%s', use lowercase letters, numbers and dashes", slug)
+		s.renderErr("createTeamHandler", w, e, http.StatusBadRequest)
+		return
+	}
+	if name == "" {
+		s.renderErr("createTeamHandler", w, "a team needs a name", http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.CreateTeam(s.username(r), slug, name)
+	if err != nil {
+		s.renderErr("createTeamHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, teamURL(slug), http.StatusSeeOther)
+}
+
+// requestTeam returns the team of the request if whoever is asking is in it,
+// or else renders an error and returns nil. Teams are private, so to anyone
+// else they don't exist.
+func (s *Site) requestTeam(caller string, w http.ResponseWriter, r *http.Request) *sqlite.Team {
+	if !s.loggedIn(r) {
+		s.renderErr(caller, w, "", http.StatusUnauthorized)
+		return nil
+	}
+
+	team, err := s.db.GetTeam(r.PathValue("slug"))
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return nil
+	}
+	if team == nil || !team.HasMember(s.username(r)) {
+		http.NotFound(w, r)
+		return nil
+	}
+	return team
+}
+
+// teamHandler shows a team's feeds' latest posts, read or not by whoever is
+// looking, and what the team starred
+func (s *Site) teamHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamHandler", w, r)
+	if team == nil {
+		return
+	}
+
+	username := s.username(r)
+	posts, err := s.db.GetTeamPosts(team.Slug, username, numTeamPosts)
+	if err != nil {
+		s.renderErr("teamHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stars, err := s.db.GetTeamStars(team.Slug)
+	if err != nil {
+		s.renderErr("teamHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	starred := make(map[int]bool)
+	for _, star := range stars {
+		starred[star.PostID] = true
+	}
+
+	data := struct {
+		Team    *sqlite.Team
+		Posts   []*sqlite.UserPostEntry
+		Stars   []*sqlite.TeamStar
+		Starred map[int]bool
+		IsOwner bool
+	}{
+		Team:    team,
+		Posts:   posts,
+		Stars:   stars,
+		Starred: starred,
+		IsOwner: team.Owner == username,
+	}
+
+	s.renderPageWithTitle(w, r, "team", team.Name+" | "+s.title, data)
+}
+
+// teamAddFeedsHandler adds the feeds a member listed, one per line, to their
+// team
+func (s *Site) teamAddFeedsHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamAddFeedsHandler", w, r)
+	if team == nil {
+		return
+	}
+
+	feedURLs, err := parseFeedURLList(r.FormValue("feeds"))
+	if err != nil {
+		s.renderErr("teamAddFeedsHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var newFeedURLs []string
+	for _, feedURL := range s.knownFeedURLs(feedURLs) {
+		if !slices.Contains(team.FeedURLs, feedURL) && !slices.Contains(newFeedURLs, feedURL) {
+			newFeedURLs = append(newFeedURLs, feedURL)
+		}
+	}
+	if len(team.FeedURLs)+len(newFeedURLs) > maxTeamFeeds {
+		e := fmt.Sprintf("teams can read at most %d feeds", maxTeamFeeds)
+		s.renderErr("teamAddFeedsHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	if err := s.registerFeeds(newFeedURLs); err != nil {
+		s.renderQuotaErr("teamAddFeedsHandler", w, err)
+		return
+	}
+	err = s.db.AddTeamFeeds(team.Slug, newFeedURLs)
+	if err != nil {
+		s.renderErr("teamAddFeedsHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, teamURL(team.Slug)+"#feeds", http.StatusSeeOther)
+}
+
+// teamRemoveFeedHandler takes a feed out of a team
+func (s *Site) teamRemoveFeedHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamRemoveFeedHandler", w, r)
+	if team == nil {
+		return
+	}
+
+	err := s.db.RemoveTeamFeed(team.Slug, r.FormValue("url"))
+	if err != nil {
+		s.renderErr("teamRemoveFeedHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.forgetTeamReads(team.Members)
+
+	http.Redirect(w, r, teamURL(team.Slug)+"#feeds", http.StatusSeeOther)
+}
+
+// teamAddMemberHandler lets a team's owner add someone to it
+func (s *Site) teamAddMemberHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamAddMemberHandler", w, r)
+	if team == nil {
+		return
+	}
+	if team.Owner != s.username(r) {
+		s.renderErr("teamAddMemberHandler", w, "only the team's owner can add people to it", http.StatusForbidden)
+		return
+	}
+
+	member := strings.TrimSpace(r.FormValue("username"))
+	if !s.db.UserExists(member) {
+		s.renderErr("teamAddMemberHandler", w, fmt.Sprintf("there's no one called '%s'", member), http.StatusBadRequest)
+		return
+	}
+	if len(team.Members) >= maxTeamMembers {
+		e := fmt.Sprintf("teams can have at most %d members", maxTeamMembers)
+		s.renderErr("teamAddMemberHandler", w, e, http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.AddTeamMember(team.Slug, member)
+	if err != nil {
+		s.renderErr("teamAddMemberHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, teamURL(team.Slug)+"#members", http.StatusSeeOther)
+}
+
+// teamRemoveMemberHandler lets a team's owner remove someone from it, and
+// members leave it. Owners can't leave their team, only delete it.
+func (s *Site) teamRemoveMemberHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamRemoveMemberHandler", w, r)
+	if team == nil {
+		return
+	}
+
+	username := s.username(r)
+	member := r.FormValue("username")
+	if member != username && team.Owner != username {
+		s.renderErr("teamRemoveMemberHandler", w, "only the team's owner can remove people from it", http.StatusForbidden)
+		return
+	}
+	if member == team.Owner {
+		s.renderErr("teamRemoveMemberHandler", w, "the team's owner can't leave it, delete it instead", http.StatusBadRequest)
+		return
+	}
+	if !team.HasMember(member) {
+		s.renderErr("teamRemoveMemberHandler", w, fmt.Sprintf("'%s' isn't in the team", member), http.StatusBadRequest)
+		return
+	}
+
+	err := s.db.RemoveTeamMember(team.Slug, member)
+	if err != nil {
+		s.renderErr("teamRemoveMemberHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.forgetTeamReads([]string{member})
+
+	if member == username {
+		http.Redirect(w, r, "/teams", http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, teamURL(team.Slug)+"#members", http.StatusSeeOther)
+}
+
+// deleteTeamHandler lets a team's owner delete it
+func (s *Site) deleteTeamHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("deleteTeamHandler", w, r)
+	if team == nil {
+		return
+	}
+	if team.Owner != s.username(r) {
+		s.renderErr("deleteTeamHandler", w, "only the team's owner can delete it", http.StatusForbidden)
+		return
+	}
+
+	err := s.db.DeleteTeam(team.Slug)
+	if err != nil {
+		s.renderErr("deleteTeamHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	s.forgetTeamReads(team.Members)
+
+	http.Redirect(w, r, "/teams", http.StatusSeeOther)
+}
+
+// forgetTeamReads forgets what people read of the feeds they don't read
+// anymore, and the feeds nobody reads anymore, once they left a team or it
+// stopped reading some feeds
+func (s *Site) forgetTeamReads(usernames []string) {
+	for _, username := range usernames {
+		s.db.DeleteOrphanedPostReads(username)
+	}
+	s.removeOrphanFeeds()
+}
+
+// teamPostHandler marks a post of a team's feeds read or unread for the
+// member asking, or stars it or unstars it for the whole team
+func (s *Site) teamPostHandler(w http.ResponseWriter, r *http.Request) {
+	team := s.requestTeam("teamPostHandler", w, r)
+	if team == nil {
+		return
+	}
+
+	postId, err := strconv.Atoi(r.FormValue("post"))
+	if err != nil {
+		s.renderErr("teamPostHandler", w, "invalid post", http.StatusBadRequest)
+		return
+	}
+
+	username := s.username(r)
+	action := r.FormValue("action")
+	next := localRedirectTarget(r, teamURL(team.Slug))
+
+	// starred posts can be gone from the feeds, they're unstarred by id
+	if action == "unstar" {
+		err = s.db.UnstarTeamPost(team.Slug, postId)
+		if err != nil {
+			s.renderErr("teamPostHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, next, http.StatusSeeOther)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("teamPostHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil || !slices.Contains(team.FeedURLs, post.FeedURL) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch action {
+	case "star":
+		err = s.db.StarTeamPost(team.Slug, username, post)
+		if err != nil {
+			s.renderErr("teamPostHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "read", "unread":
+		s.db.SetReadStatus(username, post.URL, action == "read")
+	default:
+		s.renderErr("teamPostHandler", w, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+func teamURL(slug string) string {
+	return "/teams/" + url.PathEscape(slug)
+}
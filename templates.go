@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"html/template"
+	"log"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"codeberg.org/meadowingc/mire/discord"
+	"codeberg.org/meadowingc/mire/language"
+	"codeberg.org/meadowingc/mire/lib"
+	"codeberg.org/meadowingc/mire/slack"
+	"github.com/fsnotify/fsnotify"
+)
+
+// where the templates are, relative to where mire runs
+const templatesDir = "files"
+
+// the parsed templates, swapped for new ones when they change in debug mode
+var templates atomic.Pointer[template.Template]
+
+// templateFuncs are the functions templates can call
+func (s *Site) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"printDomain":      s.printDomain,
+		"timeSince":        s.timeSince,
+		"trimSpace":        strings.TrimSpace,
+		"escapeURL":        url.QueryEscape,
+		"readingTime":      s.readingTime,
+		"mediaDuration":    s.mediaDuration,
+		"postingInterval":  lib.PostingInterval,
+		"refreshInterval":  s.refreshInterval,
+		"languageName":     language.Name,
+		"hasItem":          slices.Contains[[]string],
+		"discordWebhookID": discord.WebhookID,
+		"slackWebhookID":   slack.WebhookID,
+		"makeSlice": func(args ...interface{}) []interface{} {
+			return args
+		},
+	}
+}
+
+// parseTemplates parses every template in templatesDir
+func (s *Site) parseTemplates() (*template.Template, error) {
+	tmplFiles := filepath.Join(templatesDir, "*.tmpl.html")
+	return template.New("whatever").Funcs(s.templateFuncs()).ParseGlob(tmplFiles)
+}
+
+// templateReloaderProcess parses the templates again whenever one of them
+// changes, so that they can be worked on without restarting mire. It's only
+// run in debug mode. Templates that don't parse are logged, and the ones that
+// did are kept until they're fixed.
+func templateReloaderProcess(ctx context.Context, s *Site) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	// editors often save by replacing the file, the directory is watched to
+	// see those new files too
+	if err = watcher.Add(templatesDir); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-watcher.Errors:
+			log.Printf("[err] templateReloaderProcess: %s\n", err)
+		case event := <-watcher.Events:
+			if !strings.HasSuffix(event.Name, ".tmpl.html") || event.Op == fsnotify.Chmod {
+				continue
+			}
+
+			parsed, err := s.parseTemplates()
+			if err != nil {
+				log.Printf("[err] templateReloaderProcess: could not reload templates: %s\n", err)
+				continue
+			}
+			templates.Store(parsed)
+			log.Printf("templateReloaderProcess: reloaded templates, %s changed\n", filepath.Base(event.Name))
+		}
+	}
+}
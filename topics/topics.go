@@ -0,0 +1,170 @@
+// Package topics sorts feeds into a handful of coarse topics so that the
+// global firehose on Discover can be browsed by subject.
+package topics
+
+import (
+	"slices"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// All lists every topic a feed can be classified into, in display order
+var All = []string{
+	"tech",
+	"writing",
+	"art",
+	"science",
+	"food",
+	"games",
+	"music",
+	"politics",
+	"personal",
+}
+
+// minimum number of keyword hits needed for the heuristics to assign a topic
+const minScore = 3
+
+// max number of topics the heuristics assign to a single feed
+const maxTopics = 2
+
+var keywords = map[string][]string{
+	"tech": {
+		"programming", "software", "code", "coding", "linux", "rust", "golang",
+		"python", "javascript", "developer", "api", "database", "kernel", "web",
+		"server", "open source", "opensource", "computer", "tech", "hardware",
+		"security", "engineering", "devops", "framework", "compiler",
+	},
+	"writing": {
+		"writing", "writer", "poetry", "poem", "poems", "fiction", "novel",
+		"essay", "essays", "story", "stories", "book", "books", "reading",
+		"literature", "author",
+	},
+	"art": {
+		"art", "artist", "drawing", "painting", "illustration", "design",
+		"photography", "photo", "photos", "sketch", "comics", "gallery",
+	},
+	"science": {
+		"science", "physics", "biology", "chemistry", "research", "math",
+		"mathematics", "astronomy", "climate", "ecology", "paper", "study",
+	},
+	"food": {
+		"food", "recipe", "recipes", "cooking", "baking", "kitchen", "bread",
+		"vegan", "restaurant", "coffee", "tea", "cook",
+	},
+	"games": {
+		"game", "games", "gaming", "videogame", "videogames", "nintendo",
+		"playstation", "xbox", "steam", "rpg", "boardgame", "boardgames",
+	},
+	"music": {
+		"music", "album", "albums", "song", "songs", "band", "playlist",
+		"guitar", "synth", "concert", "vinyl",
+	},
+	"politics": {
+		"politics", "political", "election", "government", "policy",
+		"democracy", "senate", "parliament", "congress", "labor", "union",
+	},
+	"personal": {
+		"diary", "journal", "life", "weeknotes", "weeknote", "personal",
+		"thoughts", "ramblings", "musings", "update", "now",
+	},
+}
+
+// IsValid reports whether topic is one of the known topics
+func IsValid(topic string) bool {
+	for _, t := range All {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Classify guesses the topics of a feed based on its title, description and
+// the titles of some of its posts. It may return no topics at all if nothing
+// stands out.
+func Classify(title string, description string, postTitles []string) []string {
+	counts := make(map[string]int)
+	for _, w := range tokenize(title + " " + description + " " + strings.Join(postTitles, " ")) {
+		counts[w]++
+	}
+
+	// the feed's own title and description are a much stronger signal than
+	// any single post title
+	headerWords := make(map[string]bool)
+	for _, w := range tokenize(title + " " + description) {
+		headerWords[w] = true
+	}
+
+	scores := make(map[string]int)
+	for topic, kws := range keywords {
+		for _, kw := range kws {
+			scores[topic] += counts[kw]
+			if headerWords[kw] {
+				scores[topic] += minScore
+			}
+		}
+	}
+
+	var result []string
+	for _, topic := range All {
+		if scores[topic] >= minScore {
+			result = append(result, topic)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return scores[result[i]] > scores[result[j]]
+	})
+
+	if len(result) > maxTopics {
+		result = result[:maxTopics]
+	}
+	return result
+}
+
+// words that suggest a feed publishes content not everyone wants to run into
+// while browsing
+var sensitiveKeywords = []string{
+	"nsfw", "porn", "porno", "xxx", "erotic", "erotica", "hentai", "fetish",
+	"kink", "nude", "nudes", "gore", "adults only", "adult content",
+}
+
+// IsSensitive guesses whether a feed should be flagged as sensitive. A single
+// hit in the feed's own title or description is enough, post titles need a
+// few hits so that a one-off post doesn't flag a whole feed.
+func IsSensitive(title string, description string, postTitles []string) bool {
+	score := 0
+	for _, w := range tokenize(title + " " + description) {
+		if slices.Contains(sensitiveKeywords, w) {
+			score += minScore
+		}
+	}
+	for _, w := range tokenize(strings.Join(postTitles, " ")) {
+		if slices.Contains(sensitiveKeywords, w) {
+			score++
+		}
+	}
+	return score >= minScore
+}
+
+// tokenize splits text into lowercase words, plus every pair of consecutive
+// words so that keywords like "open source" can be matched too.
+func tokenize(text string) []string {
+	words := strings.Fields(strings.Map(func(r rune) rune {
+		r = unicode.ToLower(r)
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, text))
+
+	tokens := make([]string, 0, 2*len(words))
+	for i, w := range words {
+		tokens = append(tokens, w)
+		if i+1 < len(words) {
+			tokens = append(tokens, w+" "+words[i+1])
+		}
+	}
+	return tokens
+}
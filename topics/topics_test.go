@@ -0,0 +1,52 @@
+package topics
+
+import (
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	got := Classify("Rusty bits", "a blog about programming and linux", []string{
+		"Writing a compiler in Rust",
+		"My linux setup",
+	})
+	if len(got) == 0 || got[0] != "tech" {
+		t.Errorf("Expected feed to be classified as tech, got %v", got)
+	}
+
+	got = Classify("Grandma's kitchen", "", []string{
+		"Sourdough bread recipe",
+		"Baking with kids",
+		"The best vegan recipe for cookies",
+	})
+	if len(got) == 0 || got[0] != "food" {
+		t.Errorf("Expected feed to be classified as food, got %v", got)
+	}
+
+	got = Classify("A blog", "", []string{"Hello world"})
+	if len(got) != 0 {
+		t.Errorf("Expected no topics, got %v", got)
+	}
+}
+
+func TestIsSensitive(t *testing.T) {
+	if !IsSensitive("Late night", "NSFW art and photography", nil) {
+		t.Errorf("Expected a feed describing itself as nsfw to be sensitive")
+	}
+
+	if IsSensitive("A blog", "", []string{"Why I stopped reading nsfw subreddits", "Hello world"}) {
+		t.Errorf("Expected a single post title to not flag the feed")
+	}
+
+	if !IsSensitive("A blog", "", []string{"nsfw: part 1", "nsfw: part 2", "more gore"}) {
+		t.Errorf("Expected many sensitive post titles to flag the feed")
+	}
+}
+
+func TestIsValid(t *testing.T) {
+	if !IsValid("tech") {
+		t.Errorf("Expected tech to be a valid topic")
+	}
+	if IsValid("banana") {
+		t.Errorf("Expected banana to not be a valid topic")
+	}
+}
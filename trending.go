@@ -0,0 +1,125 @@
+package main
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+)
+
+const trendingWindowDays = 7
+const numTrendingPosts = 100
+
+// trendingPosts caches the ranking shown on the "hot" tab of discover. It is
+// recomputed periodically by the stats process since ranking every recent
+// post on each request would be too expensive.
+var trendingPosts = struct {
+	sync.RWMutex
+	posts        []*sqlite.Post
+	lastComputed time.Time
+}{}
+
+func getTrendingPosts() ([]*sqlite.Post, time.Time) {
+	trendingPosts.RLock()
+	defer trendingPosts.RUnlock()
+	return trendingPosts.posts, trendingPosts.lastComputed
+}
+
+// trendingScore weighs public recommendations the most, then recent reads,
+// then how many people favorite the post's feed and then how many people
+// subscribe to it. The result decays with the post's age so that fresh posts
+// bubble up.
+func trendingScore(c *sqlite.TrendingCandidate, now time.Time) float64 {
+	weight := 4*float64(c.Recommendations) + 3*float64(c.RecentReads) +
+		2*float64(c.Favorites) + float64(c.Subscribers)
+
+	ageHours := now.Sub(c.Post.PublishedDatetime).Hours()
+	if ageHours < 0 {
+		// some feeds publish posts "from the future"
+		ageHours = 0
+	}
+
+	return weight / math.Pow(ageHours+2, 1.5)
+}
+
+func computeTrendingPosts(s *Site) {
+	candidates, err := s.db.GetTrendingCandidates(trendingWindowDays)
+	if err != nil {
+		log.Printf("[err] computeTrendingPosts: could not get candidates: %s\n", err)
+		return
+	}
+
+	now := time.Now()
+	scores := make(map[*sqlite.TrendingCandidate]float64, len(candidates))
+	for _, c := range candidates {
+		scores[c] = trendingScore(c, now)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return scores[candidates[i]] > scores[candidates[j]]
+	})
+
+	posts := make([]*sqlite.Post, 0, numTrendingPosts)
+	for _, c := range candidates {
+		if len(posts) == numTrendingPosts {
+			break
+		}
+		posts = append(posts, c.Post)
+	}
+
+	trendingPosts.Lock()
+	trendingPosts.posts = posts
+	trendingPosts.lastComputed = now
+	trendingPosts.Unlock()
+}
+
+func (s *Site) discoverHotHandler(w http.ResponseWriter, r *http.Request) {
+	userPreferences := user_preferences.GetDefaultUserPreferences()
+	if s.loggedIn(r) {
+		userPreferences = user_preferences.GetUserPreferences(s.db, s.db.GetUserID(s.username(r)))
+	}
+
+	posts, lastComputed := getTrendingPosts()
+
+	hideSubscribed := s.discoverHidesSubscribedFeeds(r, userPreferences)
+	var languages []string
+	if s.loggedIn(r) {
+		mutes, err := s.db.GetDiscoverMutes(s.username(r))
+		if err != nil {
+			s.renderErr("discoverHotHandler", w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		var userFeeds []string
+		if hideSubscribed {
+			userFeeds = s.db.GetUserFeedURLs(s.username(r))
+		}
+
+		languages = discoverLanguages(userPreferences)
+		hideSensitive := userPreferences.SensitivePosts == user_preferences.SensitivePostsHide
+
+		posts = slices.DeleteFunc(slices.Clone(posts), func(p *sqlite.Post) bool {
+			return slices.Contains(userFeeds, p.FeedURL) || isPostMuted(mutes, p) ||
+				(len(languages) > 0 && p.Language != "" && !slices.Contains(languages, p.Language)) ||
+				(hideSensitive && p.Sensitive)
+		})
+	}
+
+	data := discoverData{
+		Items:           posts,
+		UserPreferences: userPreferences,
+		Hot:             true,
+		LastComputed:    lastComputed,
+		HideSubscribed:  hideSubscribed,
+		Languages:       languages,
+		CurrentPath:     r.URL.RequestURI(),
+	}
+
+	s.renderPage(w, r, "discover", data)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+)
+
+// apiPost is the JSON representation of a post in a user's timeline
+type apiPost struct {
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	FeedURL     string    `json:"feed_url"`
+	PublishedAt time.Time `json:"published_at"`
+	IsRead      bool      `json:"is_read"`
+	WordCount   int       `json:"word_count"`
+}
+
+func newAPIPost(entry *sqlite.UserPostEntry) *apiPost {
+	post := &apiPost{
+		Title:     entry.Post.Title,
+		URL:       entry.Post.Link,
+		FeedURL:   entry.FeedURL,
+		IsRead:    entry.IsRead,
+		WordCount: entry.WordCount,
+	}
+	if entry.Post.PublishedParsed != nil {
+		post.PublishedAt = *entry.Post.PublishedParsed
+	}
+	return post
+}
+
+// The triage API lets a client (the web frontend or a TUI) walk through the
+// user's timeline with j/k style navigation. The position is kept server side
+// so the client doesn't need to hold on to the whole timeline.
+
+// apiTriageCurrentHandler returns the post the triage cursor points at.
+func (s *Site) apiTriageCurrentHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiTriageCurrentHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := s.db.GetTriageCursor(s.username(r))
+	s.renderTriageEntry("apiTriageCurrentHandler", w, entry, err)
+}
+
+// apiTriageNextHandler moves the triage cursor to the next unread post.
+func (s *Site) apiTriageNextHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiTriageNextHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := s.db.MoveTriageCursorToNextUnread(s.username(r))
+	s.renderTriageEntry("apiTriageNextHandler", w, entry, err)
+}
+
+// apiTriagePreviousHandler moves the triage cursor to the previous post.
+func (s *Site) apiTriagePreviousHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiTriagePreviousHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	entry, err := s.db.MoveTriageCursorToPrevious(s.username(r))
+	s.renderTriageEntry("apiTriagePreviousHandler", w, entry, err)
+}
+
+// apiTriageToggleReadHandler flips the read status of the post under the
+// triage cursor.
+func (s *Site) apiTriageToggleReadHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiTriageToggleReadHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	entry, err := s.db.GetTriageCursor(username)
+	if err != nil || entry == nil {
+		s.renderTriageEntry("apiTriageToggleReadHandler", w, entry, err)
+		return
+	}
+
+	s.db.SetReadStatus(username, entry.Post.Link, !entry.IsRead)
+	entry.IsRead = !entry.IsRead
+
+	s.renderTriageEntry("apiTriageToggleReadHandler", w, entry, nil)
+}
+
+// apiTriageOpenHandler marks the post under the triage cursor as read and
+// redirects to it.
+func (s *Site) apiTriageOpenHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("apiTriageOpenHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	username := s.username(r)
+	entry, err := s.db.GetTriageCursor(username)
+	if err != nil || entry == nil {
+		s.renderTriageEntry("apiTriageOpenHandler", w, entry, err)
+		return
+	}
+
+	s.db.SetReadStatus(username, entry.Post.Link, true)
+
+	http.Redirect(w, r, entry.Post.Link, http.StatusSeeOther)
+}
+
+func (s *Site) renderTriageEntry(caller string, w http.ResponseWriter, entry *sqlite.UserPostEntry, err error) {
+	if err != nil {
+		s.renderErr(caller, w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if entry == nil {
+		s.renderErr(caller, w, "no post to move to", http.StatusNotFound)
+		return
+	}
+
+	s.renderJSON(w, newAPIPost(entry))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/indieauth"
+	"codeberg.org/meadowingc/mire/lib"
+)
+
+// Triggers are what automation platforms (Zapier, Make, n8n, IFTTT through
+// webhooks) poll to start a workflow when something happens in mire. They
+// return the newest items first, each with an id that never changes, which
+// the platforms use to tell the new ones from the ones they've seen.
+const (
+	defaultTriggerItems = 50
+	maxTriggerItems     = 100
+	maxTokenNameLength  = 50
+)
+
+// triggerLimit returns how many items the platform asked for
+func triggerLimit(r *http.Request) int {
+	limit, err := strconv.Atoi(r.FormValue("limit"))
+	if err != nil || limit <= 0 {
+		return defaultTriggerItems
+	}
+	return min(limit, maxTriggerItems)
+}
+
+// triggerUser returns who the token of a trigger request was given to, or
+// renders the error and returns "" if there's no token that can read
+func (s *Site) triggerUser(caller string, w http.ResponseWriter, r *http.Request) string {
+	token, err := s.indieAuthToken(r)
+	if err != nil {
+		s.renderOAuthErr(caller, w, "server_error", err.Error(), http.StatusInternalServerError)
+		return ""
+	}
+	if token == nil {
+		s.renderOAuthErr(caller, w, "unauthorized", "the token is missing or was revoked", http.StatusUnauthorized)
+		return ""
+	}
+	if !indieauth.HasScope(token.Scope, "read") {
+		s.renderOAuthErr(caller, w, "insufficient_scope", "this needs the read scope", http.StatusForbidden)
+		return ""
+	}
+	return token.Username
+}
+
+type starredTrigger struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	FeedURL   string `json:"feed_url"`
+	Quote     string `json:"quote"`
+	Note      string `json:"note"`
+	ShareURL  string `json:"share_url"`
+}
+
+// apiStarredTriggerHandler lists the posts someone starred, newest first
+func (s *Site) apiStarredTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	username := s.triggerUser("apiStarredTriggerHandler", w, r)
+	if username == "" {
+		return
+	}
+
+	stars, err := s.db.GetPostStars(username)
+	if err != nil {
+		s.renderOAuthErr("apiStarredTriggerHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := []starredTrigger{}
+	for _, star := range stars[:min(len(stars), triggerLimit(r))] {
+		items = append(items, starredTrigger{
+			ID:        strconv.Itoa(star.PostID),
+			CreatedAt: star.CreatedAt.UTC().Format(time.RFC3339),
+			Title:     star.Title,
+			URL:       star.URL,
+			FeedURL:   star.FeedURL,
+			Quote:     star.Quote,
+			Note:      star.Note,
+			ShareURL:  constants.BASE_URL + "/share/" + strconv.Itoa(star.PostID),
+		})
+	}
+
+	s.renderJSON(w, items)
+}
+
+type alertTrigger struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"created_at"`
+	Keyword   string `json:"keyword"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	FeedURL   string `json:"feed_url"`
+	ShareURL  string `json:"share_url"`
+}
+
+// apiAlertTriggerHandler lists the posts that matched someone's keyword
+// alerts, newest first, or the ones that matched the keyword asked for
+func (s *Site) apiAlertTriggerHandler(w http.ResponseWriter, r *http.Request) {
+	username := s.triggerUser("apiAlertTriggerHandler", w, r)
+	if username == "" {
+		return
+	}
+
+	keyword := strings.TrimSpace(r.FormValue("keyword"))
+	limit := triggerLimit(r)
+
+	// filter from the ones the alerts page shows, which are the ones kept
+	matches, err := s.db.GetKeywordAlertMatches(username, numKeywordAlertMatches)
+	if err != nil {
+		s.renderOAuthErr("apiAlertTriggerHandler", w, "server_error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := []alertTrigger{}
+	for _, match := range matches {
+		if keyword != "" && !strings.EqualFold(match.Keyword, keyword) {
+			continue
+		}
+		items = append(items, alertTrigger{
+			// a post can match several alerts, each is its own item
+			ID:        strconv.Itoa(match.AlertID) + "-" + strconv.Itoa(match.PostID),
+			CreatedAt: match.MatchedAt.UTC().Format(time.RFC3339),
+			Keyword:   match.Keyword,
+			Title:     match.Title,
+			URL:       match.URL,
+			FeedURL:   match.FeedURL,
+			ShareURL:  constants.BASE_URL + "/share/" + strconv.Itoa(match.PostID),
+		})
+		if len(items) == limit {
+			break
+		}
+	}
+
+	s.renderJSON(w, items)
+}
+
+// settingsCreateTokenHandler creates a token for automation platforms, and
+// shows it the only time it can be seen
+func (s *Site) settingsCreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsCreateTokenHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxTokenNameLength {
+		s.renderErr("settingsCreateTokenHandler", w, "a token needs a name, of up to 50 characters", http.StatusBadRequest)
+		return
+	}
+
+	token := lib.GenerateSecureToken(32)
+	err := s.db.AddPersonalToken(s.username(r), name, "read", token)
+	if err != nil {
+		s.renderErr("settingsCreateTokenHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Name     string
+		Token    string
+		Triggers []string
+	}{
+		Name:  name,
+		Token: token,
+		Triggers: []string{
+			constants.BASE_URL + "/api/v1/triggers/starred",
+			constants.BASE_URL + "/api/v1/triggers/alerts",
+		},
+	}
+
+	s.renderPage(w, r, "token", data)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"codeberg.org/meadowingc/mire/supervisor"
+)
+
+// how long people have to undo an unsubscribe. Until then the feed, its posts
+// and what they read of it are kept.
+const unsubscribeGracePeriod = 7 * 24 * time.Hour
+
+// unsubscribeExpiryProcess makes unsubscribes final once they can't be undone
+// anymore, every hour
+func unsubscribeExpiryProcess(ctx context.Context, s *Site) error {
+	for {
+		expireUnsubscribes(s)
+		if !supervisor.Sleep(ctx, time.Hour) {
+			return nil
+		}
+	}
+}
+
+func expireUnsubscribes(s *Site) {
+	usernames, err := s.db.ExpireUnsubscribes(time.Now().Add(-unsubscribeGracePeriod))
+	if err != nil {
+		log.Printf("[err] expireUnsubscribes: %s\n", err)
+		return
+	}
+	if len(usernames) == 0 {
+		return
+	}
+
+	for _, username := range usernames {
+		s.db.DeleteOrphanedPostReads(username)
+	}
+	s.removeOrphanFeeds()
+}
+
+// settingsUndoUnsubscribeHandler subscribes someone again to a feed they
+// unsubscribed from lately
+func (s *Site) settingsUndoUnsubscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("settingsUndoUnsubscribeHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.UndoUnsubscribe(s.username(r), r.FormValue("url"))
+	if err != nil {
+		s.renderErr("settingsUndoUnsubscribeHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#subscriptions", http.StatusSeeOther)
+}
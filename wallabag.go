@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/wallabag"
+)
+
+var errWallabagNotConnected = errors.New("no wallabag account is connected")
+
+func wallabagClient(account *sqlite.WallabagAccount) *wallabag.Client {
+	return &wallabag.Client{
+		Instance:     account.Instance,
+		ClientID:     account.ClientID,
+		ClientSecret: account.ClientSecret,
+	}
+}
+
+// wallabagConnectHandler gets a token for the wallabag account someone
+// entered, with the API client they created on their instance
+func (s *Site) wallabagConnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("wallabagConnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	instance, err := wallabag.NormalizeInstance(r.FormValue("instance"))
+	if err != nil {
+		s.renderErr("wallabagConnectHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account := &sqlite.WallabagAccount{
+		Instance:     instance,
+		ClientID:     strings.TrimSpace(r.FormValue("client_id")),
+		ClientSecret: strings.TrimSpace(r.FormValue("client_secret")),
+		AccountName:  strings.TrimSpace(r.FormValue("wallabag_username")),
+	}
+	if account.ClientID == "" || account.ClientSecret == "" || account.AccountName == "" {
+		s.renderErr("wallabagConnectHandler", w, "the client id, client secret and username are required", http.StatusBadRequest)
+		return
+	}
+
+	token, err := wallabagClient(account).PasswordToken(account.AccountName, r.FormValue("wallabag_password"))
+	if errors.Is(err, wallabag.ErrInvalidGrant) {
+		s.renderErr("wallabagConnectHandler", w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		s.renderErr("wallabagConnectHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	account.AccessToken = token.AccessToken
+	account.RefreshToken = token.RefreshToken
+	account.ExpiresAt = token.ExpiresAt
+
+	err = s.db.SaveWallabagAccount(s.username(r), account)
+	if err != nil {
+		s.renderErr("wallabagConnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#wallabag", http.StatusSeeOther)
+}
+
+func (s *Site) wallabagDisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("wallabagDisconnectHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	err := s.db.DeleteWallabagAccount(s.username(r))
+	if err != nil {
+		s.renderErr("wallabagDisconnectHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/settings#wallabag", http.StatusSeeOther)
+}
+
+// saveToWallabagHandler saves a post to the user's connected wallabag
+// instance, refreshing mire's access to it first if needed
+func (s *Site) saveToWallabagHandler(w http.ResponseWriter, r *http.Request) {
+	if !s.loggedIn(r) {
+		s.renderErr("saveToWallabagHandler", w, "", http.StatusUnauthorized)
+		return
+	}
+
+	postId, err := strconv.Atoi(r.PathValue("postID"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	post, err := s.db.GetPost(postId)
+	if err != nil {
+		s.renderErr("saveToWallabagHandler", w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if post == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = s.saveToWallabag(s.username(r), post.URL, post.Title)
+	if errors.Is(err, errWallabagNotConnected) {
+		http.Redirect(w, r, "/settings#wallabag", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		s.renderErr("saveToWallabagHandler", w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, localRedirectTarget(r, shareURL(postId)), http.StatusSeeOther)
+}
+
+// saveToWallabag saves a page to someone's connected wallabag instance,
+// refreshing mire's access first if it expired
+func (s *Site) saveToWallabag(username string, link string, title string) error {
+	account, err := s.db.GetWallabagAccount(username)
+	if err != nil {
+		return err
+	}
+	if account == nil {
+		return errWallabagNotConnected
+	}
+
+	client := wallabagClient(account)
+	token := &wallabag.Token{
+		AccessToken:  account.AccessToken,
+		RefreshToken: account.RefreshToken,
+		ExpiresAt:    account.ExpiresAt,
+	}
+	if token.Expired() {
+		token, err = client.Refresh(token)
+		if errors.Is(err, wallabag.ErrInvalidGrant) {
+			return errors.New("wallabag doesn't accept mire's access anymore, please connect your account again in your settings")
+		}
+		if err != nil {
+			return err
+		}
+
+		err = s.db.SetWallabagTokens(username, token.AccessToken, token.RefreshToken, token.ExpiresAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return client.Add(token, link, title)
+}
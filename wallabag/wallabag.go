@@ -0,0 +1,150 @@
+// Package wallabag saves links to a (usually self-hosted) wallabag instance
+// with its API (https://doc.wallabag.org/developer/api/oauth/), using an API
+// client people created on their instance.
+//
+// The username and password are only used once to get a token. Access tokens
+// expire after an hour and are refreshed as needed, refresh tokens are
+// forgotten by wallabag after two weeks without use (by default), after which
+// people have to connect again.
+package wallabag
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// max size of the response body read
+const maxResponseSize = 1 << 20
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+// ErrInvalidGrant is returned when wallabag doesn't accept a username and
+// password, or a refresh token anymore
+var ErrInvalidGrant = errors.New("wallabag didn't accept these credentials")
+
+// Client is an API client created on a wallabag instance
+type Client struct {
+	Instance     string
+	ClientID     string
+	ClientSecret string
+}
+
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+}
+
+// Expired reports whether an access token needs to be refreshed, with a bit of
+// slack for slow requests
+func (t *Token) Expired() bool {
+	return time.Now().After(t.ExpiresAt.Add(-time.Minute))
+}
+
+// NormalizeInstance turns what someone typed ("wallabag.example.com",
+// "https://example.com/wallabag/") into the base URL of an instance
+func NormalizeInstance(instance string) (string, error) {
+	instance = strings.TrimSpace(instance)
+	if !strings.Contains(instance, "://") {
+		instance = "https://" + instance
+	}
+
+	u, err := url.Parse(instance)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || u.User != nil || u.RawQuery != "" {
+		return "", fmt.Errorf("'%s' is not a wallabag URL", instance)
+	}
+	return u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/"), nil
+}
+
+// PasswordToken gets a token for the account with the given username and
+// password
+func (c *Client) PasswordToken(username string, password string) (*Token, error) {
+	return c.token(url.Values{
+		"grant_type": {"password"},
+		"username":   {username},
+		"password":   {password},
+	})
+}
+
+// Refresh gets a new token in place of an expired one
+func (c *Client) Refresh(token *Token) (*Token, error) {
+	return c.token(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+}
+
+func (c *Client) token(form url.Values) (*Token, error) {
+	form.Set("client_id", c.ClientID)
+	form.Set("client_secret", c.ClientSecret)
+
+	resp, err := client.PostForm(c.Instance+"/oauth/v2/token", form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Error        string `json:"error"`
+	}
+	json.Unmarshal(body, &result)
+
+	switch {
+	case result.Error == "invalid_grant" || result.Error == "invalid_client":
+		return nil, ErrInvalidGrant
+	case resp.StatusCode >= 300:
+		return nil, fmt.Errorf("%s returned status %d: %s", c.Instance, resp.StatusCode, body)
+	case result.AccessToken == "":
+		return nil, fmt.Errorf("%s didn't return a token: %s", c.Instance, body)
+	}
+
+	return &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(result.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// Add saves a link with its title. Saving a link that's already saved doesn't
+// create a second entry.
+func (c *Client) Add(token *Token, link string, title string) error {
+	form := url.Values{"url": {link}}
+	if title != "" {
+		form.Set("title", title)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.Instance+"/api/entries.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+		return fmt.Errorf("%s returned status %d: %s", c.Instance, resp.StatusCode, body)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package wallabag
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestNormalizeInstance(t *testing.T) {
+	for instance, expected := range map[string]string{
+		"wallabag.example.com":           "https://wallabag.example.com",
+		" https://example.com/wallabag/": "https://example.com/wallabag",
+		"http://localhost:8080":          "http://localhost:8080",
+		"https://user:pw@example.com":    "",
+		"https://example.com/?a=b":       "",
+		"ftp://example.com":              "",
+	} {
+		got, err := NormalizeInstance(instance)
+		if expected == "" {
+			if err == nil {
+				t.Errorf("Expected '%s' to be rejected, got '%s'", instance, got)
+			}
+			continue
+		}
+		if err != nil || got != expected {
+			t.Errorf("Expected '%s' to be '%s', got '%s' (%v)", instance, expected, got, err)
+		}
+	}
+}
+
+func TestTokensAndAdd(t *testing.T) {
+	var added url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/oauth/v2/token":
+			if r.PostForm.Get("client_id") != "id" || r.PostForm.Get("client_secret") != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"error":"invalid_client"}`))
+				return
+			}
+			if r.PostForm.Get("password") == "hunter2" || r.PostForm.Get("refresh_token") == "refresh" {
+				w.Write([]byte(`{"access_token":"access","expires_in":3600,"refresh_token":"refresh2","token_type":"bearer"}`))
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant","error_description":"Invalid username and password combination"}`))
+		case "/api/entries.json":
+			if r.Header.Get("Authorization") != "Bearer access" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			added = r.PostForm
+			w.Write([]byte(`{"id":1}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	c := &Client{Instance: server.URL, ClientID: "id", ClientSecret: "secret"}
+
+	if _, err := c.PasswordToken("alice", "wrong"); err != ErrInvalidGrant {
+		t.Errorf("Expected a wrong password to be rejected, got %v", err)
+	}
+	if _, err := (&Client{Instance: server.URL, ClientID: "id"}).PasswordToken("alice", "hunter2"); err != ErrInvalidGrant {
+		t.Errorf("Expected a wrong client to be rejected, got %v", err)
+	}
+
+	token, err := c.PasswordToken("alice", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh2" || token.Expired() {
+		t.Fatalf("Unexpected token %+v", token)
+	}
+
+	if _, err := c.Refresh(token); err != ErrInvalidGrant {
+		t.Errorf("Expected an unknown refresh token to be rejected, got %v", err)
+	}
+	refreshed, err := c.Refresh(&Token{RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Hour)})
+	if err != nil || refreshed.AccessToken != "access" {
+		t.Errorf("Expected the token to be refreshed, got %+v (%v)", refreshed, err)
+	}
+
+	err = c.Add(token, "https://example.com/post", "A post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.Get("url") != "https://example.com/post" || added.Get("title") != "A post" {
+		t.Errorf("Expected the post to be saved, got %v", added)
+	}
+
+	if err := c.Add(&Token{AccessToken: "expired"}, "https://example.com/post", ""); err == nil {
+		t.Errorf("Expected an error when the access token isn't accepted")
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// wallabag instances inside the instance's network are only reached when
+	// it allows it
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	c := &Client{Instance: server.URL, ClientID: "id", ClientSecret: "secret"}
+	_, err := c.PasswordToken("alice", "hunter2")
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,118 @@
+// Package webhooks delivers signed JSON events to URLs people configured, so
+// they can wire mire into their own automation.
+//
+// Every request carries the event type in X-Mire-Event, the id of the
+// delivery (the same across retries) in X-Mire-Delivery, a unix timestamp in
+// X-Mire-Timestamp and X-Mire-Signature, which is "sha256=" followed by the
+// hex HMAC-SHA256 of the timestamp, a dot and the body, keyed with the
+// webhook's secret.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// the events people can subscribe to
+const (
+	EventNewPost   = "new_post"
+	EventFeedError = "feed_error"
+	EventFavorite  = "favorite"
+	// a new post from a feed the user asked to be notified about
+	EventNotify = "notify"
+)
+
+var Events = []string{EventNewPost, EventFeedError, EventFavorite, EventNotify}
+
+// max size of the response body read after delivering
+const maxResponseSize = 1 << 16
+
+var client = &http.Client{
+	Transport: reaper.NewTransport(),
+	Timeout:   15 * time.Second,
+	// a redirect would send the payload somewhere the user didn't ask for
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func ValidEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidURL reports whether events can be delivered to a URL
+func ValidURL(webhookURL string) bool {
+	u, err := url.Parse(webhookURL)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != "" && u.User == nil
+}
+
+// Sign returns the signature of a body sent at a given time
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a delivery, for receivers written in Go
+func Verify(secret string, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Deliver POSTs an event to a webhook. Anything but a 2xx response is an
+// error, the delivery should be retried later.
+func Deliver(webhookURL string, secret string, deliveryId int, event string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mire webhooks (+https://mire.meadow.cafe)")
+	req.Header.Set("X-Mire-Event", event)
+	req.Header.Set("X-Mire-Delivery", strconv.Itoa(deliveryId))
+	req.Header.Set("X-Mire-Timestamp", timestamp)
+	req.Header.Set("X-Mire-Signature", Sign(secret, timestamp, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// RetryDelay returns how long to wait before retrying a delivery that failed
+// a number of times, doubling every time
+func RetryDelay(attempts int) time.Duration {
+	const maxDelay = 6 * time.Hour
+	if attempts < 1 {
+		attempts = 1
+	}
+	if attempts > 16 {
+		return maxDelay
+	}
+	return min(time.Minute<<(attempts-1), maxDelay)
+}
@@ -0,0 +1,109 @@
+package webhooks
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestDeliver(t *testing.T) {
+	const secret = "s3cret"
+	body := []byte(`{"event":"favorite"}`)
+
+	var verified bool
+	var event, delivery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ := io.ReadAll(r.Body)
+		verified = Verify(secret, r.Header.Get("X-Mire-Timestamp"), received, r.Header.Get("X-Mire-Signature"))
+		event = r.Header.Get("X-Mire-Event")
+		delivery = r.Header.Get("X-Mire-Delivery")
+	}))
+	defer server.Close()
+
+	err := Deliver(server.URL, secret, 42, EventFavorite, body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified {
+		t.Errorf("Expected the signature to verify")
+	}
+	if event != EventFavorite || delivery != "42" {
+		t.Errorf("Expected the event and delivery headers to be set, got '%s' and '%s'", event, delivery)
+	}
+
+	if Verify("wrong", "1", body, Sign(secret, "1", body)) {
+		t.Errorf("Expected a signature made with another secret to not verify")
+	}
+	if Verify(secret, "2", body, Sign(secret, "1", body)) {
+		t.Errorf("Expected a signature made at another time to not verify")
+	}
+
+	redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, server.URL, http.StatusFound)
+	}))
+	defer redirecting.Close()
+
+	if err := Deliver(redirecting.URL, secret, 1, EventFavorite, body); err == nil {
+		t.Errorf("Expected redirects to not be followed")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d := RetryDelay(1); d != time.Minute {
+		t.Errorf("Expected the first retry after a minute, got %s", d)
+	}
+	if d := RetryDelay(4); d != 8*time.Minute {
+		t.Errorf("Expected the delay to double with every attempt, got %s", d)
+	}
+	if d := RetryDelay(100); d != 6*time.Hour {
+		t.Errorf("Expected the delay to be capped, got %s", d)
+	}
+}
+
+func TestValidURL(t *testing.T) {
+	for webhookURL, expected := range map[string]bool{
+		"https://example.com/hook":      true,
+		"http://localhost:8080/hook":    true,
+		"ftp://example.com/hook":        false,
+		"https://user:pw@example.com/x": false,
+		"example.com/hook":              false,
+	} {
+		if got := ValidURL(webhookURL); got != expected {
+			t.Errorf("Expected ValidURL(%q) to be %v", webhookURL, expected)
+		}
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// webhooks inside the instance's network are only delivered when it
+	// allows it
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	err := Deliver(server.URL, "s3cret", 1, EventFavorite, []byte(`{}`))
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
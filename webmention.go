@@ -0,0 +1,30 @@
+package main
+
+import (
+	"log"
+
+	"codeberg.org/meadowingc/mire/constants"
+	"codeberg.org/meadowingc/mire/sqlite"
+	"codeberg.org/meadowingc/mire/sqlite/user_preferences"
+	"codeberg.org/meadowingc/mire/webmention"
+)
+
+// sendRecommendationWebmention lets the author of a post know it was
+// recommended, pointing them at the post's share page. It's opt-in and
+// happens in the background.
+func (s *Site) sendRecommendationWebmention(username string, post *sqlite.Post) {
+	if !user_preferences.GetUserPreferences(s.db, s.db.GetUserID(username)).SendWebmentions {
+		return
+	}
+
+	go func() {
+		sent, err := webmention.Send(constants.BASE_URL+shareURL(post.ID), post.URL)
+		if err != nil {
+			log.Printf("[err] sendRecommendationWebmention: could not send webmention to '%s': %s\n", post.URL, err)
+			return
+		}
+		if sent {
+			log.Printf("webmention: sent webmention to '%s' for '%s'\n", post.URL, username)
+		}
+	}()
+}
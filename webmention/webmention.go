@@ -0,0 +1,158 @@
+// Package webmention sends webmentions (https://www.w3.org/TR/webmention/),
+// letting authors know that a page links to one of their articles.
+package webmention
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+	"golang.org/x/net/html"
+)
+
+// max size of the target page read while looking for its endpoint
+const maxPageSize = 1 << 20
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+// Send notifies the target that the source links to it. It's not an error for
+// the target not to support webmentions, in that case nothing is sent and
+// sent is false.
+func Send(source string, target string) (sent bool, err error) {
+	endpoint, err := DiscoverEndpoint(target)
+	if err != nil || endpoint == "" {
+		return false, err
+	}
+
+	resp, err := client.PostForm(endpoint, url.Values{
+		"source": {source},
+		"target": {target},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxPageSize))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return false, fmt.Errorf("webmention endpoint '%s' returned status %d", endpoint, resp.StatusCode)
+	}
+	return true, nil
+}
+
+// DiscoverEndpoint finds the webmention endpoint of a page, looking at its
+// Link headers first and then at its HTML. Returns an empty string if the
+// page doesn't advertise one.
+func DiscoverEndpoint(target string) (string, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("fetching '%s' returned status %d", target, resp.StatusCode)
+	}
+
+	// relative endpoints are relative to where we ended up after redirects
+	base := resp.Request.URL
+
+	for _, header := range resp.Header.Values("Link") {
+		if href, ok := webmentionLinkHeader(header); ok {
+			return resolve(base, href)
+		}
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return "", nil
+	}
+
+	href, ok := webmentionLinkElement(io.LimitReader(resp.Body, maxPageSize))
+	if !ok {
+		return "", nil
+	}
+	return resolve(base, href)
+}
+
+// webmentionLinkHeader looks for rel="webmention" in a Link header, which can
+// hold several comma separated links
+func webmentionLinkHeader(header string) (string, bool) {
+	for _, link := range strings.Split(header, ",") {
+		target, params, found := strings.Cut(link, ";")
+		if !found {
+			continue
+		}
+
+		target = strings.TrimSpace(target)
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(key, "rel") && hasRel(strings.Trim(value, `"`)) {
+				return strings.Trim(target, "<>"), true
+			}
+		}
+	}
+	return "", false
+}
+
+// webmentionLinkElement returns the href of the first <link> or <a> element
+// with rel="webmention"
+func webmentionLinkElement(body io.Reader) (string, bool) {
+	tokenizer := html.NewTokenizer(body)
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return "", false
+		case html.StartTagToken, html.SelfClosingTagToken:
+			token := tokenizer.Token()
+			if token.Data != "link" && token.Data != "a" {
+				continue
+			}
+
+			var rel, href string
+			hasHref := false
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "rel":
+					rel = attr.Val
+				case "href":
+					href, hasHref = attr.Val, true
+				}
+			}
+			if hasHref && hasRel(rel) {
+				return href, true
+			}
+		}
+	}
+}
+
+func hasRel(rels string) bool {
+	for _, rel := range strings.Fields(rels) {
+		if strings.EqualFold(rel, "webmention") {
+			return true
+		}
+	}
+	return false
+}
+
+func resolve(base *url.URL, href string) (string, error) {
+	ref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return "", err
+	}
+
+	endpoint := base.ResolveReference(ref)
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return "", fmt.Errorf("invalid webmention endpoint '%s'", endpoint)
+	}
+	return endpoint.String(), nil
+}
@@ -0,0 +1,90 @@
+package webmention
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestDiscoverEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `<https://other.example/>; rel="me", </mentions>; rel="webmention"`)
+		fmt.Fprint(w, `<html></html>`)
+	})
+	mux.HandleFunc("/link", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/style.css"><link rel="webmention" href="/from-link"></head></html>`)
+	})
+	mux.HandleFunc("/anchor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a rel="nofollow webmention" href="endpoint?x=1">mentions</a></body></html>`)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/posts/anchor", http.StatusFound)
+	})
+	mux.HandleFunc("/posts/anchor", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<a rel="webmention" href="endpoint">mentions</a>`)
+	})
+	mux.HandleFunc("/none", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><body><a href="/elsewhere">nothing here</a></body></html>`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := map[string]string{
+		"/header":   server.URL + "/mentions",
+		"/link":     server.URL + "/from-link",
+		"/anchor":   server.URL + "/endpoint?x=1",
+		"/redirect": server.URL + "/posts/endpoint",
+		"/none":     "",
+	}
+	for path, expected := range cases {
+		endpoint, err := DiscoverEndpoint(server.URL + path)
+		if err != nil {
+			t.Errorf("%s: %v", path, err)
+			continue
+		}
+		if endpoint != expected {
+			t.Errorf("%s: expected endpoint '%s', got '%s'", path, expected, endpoint)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	var source, target string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/post", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<link rel="webmention" href="/webmention">`)
+	})
+	mux.HandleFunc("/webmention", func(w http.ResponseWriter, r *http.Request) {
+		source, target = r.FormValue("source"), r.FormValue("target")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	sent, err := Send("https://mire.example/share/1", server.URL+"/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sent {
+		t.Fatalf("Expected the webmention to be sent")
+	}
+	if source != "https://mire.example/share/1" || target != server.URL+"/post" {
+		t.Errorf("Expected the endpoint to receive the source and target, got '%s' and '%s'", source, target)
+	}
+}
@@ -0,0 +1,320 @@
+// Package webpush sends Web Push notifications (RFC 8030) to the browsers
+// people turned them on in, encrypting them for the browser (RFC 8291) and
+// identifying the instance with a VAPID key (RFC 8292), which is what the
+// push services of every browser require.
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// how long push services hold on to a notification for a browser that's
+// offline
+const defaultTTL = 24 * time.Hour
+
+// push services accept at most 4096 bytes, the encryption takes 103 of them
+const MaxPayloadSize = 3993
+
+// max size of the response body read after sending
+const maxResponseSize = 1 << 16
+
+// the size of the one record notifications are encrypted into
+const recordSize = 4096
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+// ErrGone is returned when the browser is no longer subscribed, the
+// subscription should be forgotten
+var ErrGone = errors.New("the push subscription is gone")
+
+var encoding = base64.RawURLEncoding
+
+// Subscription is where a browser receives notifications, as
+// PushSubscription.toJSON() gives it
+type Subscription struct {
+	Endpoint string `json:"endpoint"`
+	Keys     struct {
+		P256dh string `json:"p256dh"`
+		Auth   string `json:"auth"`
+	} `json:"keys"`
+}
+
+// Validate checks that a subscription sent by a browser can be pushed to
+func (sub *Subscription) Validate() error {
+	u, err := url.Parse(sub.Endpoint)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("'%s' is not a push endpoint", sub.Endpoint)
+	}
+	if _, err := sub.publicKey(); err != nil {
+		return err
+	}
+	if _, err := sub.authSecret(); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sub *Subscription) publicKey() (*ecdh.PublicKey, error) {
+	raw, err := decode(sub.Keys.P256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	key, err := ecdh.P256().NewPublicKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	return key, nil
+}
+
+func (sub *Subscription) authSecret() ([]byte, error) {
+	secret, err := decode(sub.Keys.Auth)
+	if err != nil || len(secret) != 16 {
+		return nil, errors.New("invalid auth secret")
+	}
+	return secret, nil
+}
+
+// browsers give base64url keys, but some pad them and some libraries use
+// standard base64
+func decode(s string) ([]byte, error) {
+	s = strings.TrimRight(strings.TrimSpace(s), "=")
+	s = strings.NewReplacer("+", "-", "/", "_").Replace(s)
+	return encoding.DecodeString(s)
+}
+
+// VAPIDKey identifies the instance to push services
+type VAPIDKey struct {
+	key *ecdsa.PrivateKey
+}
+
+// GenerateVAPIDKey returns a new key, encoded to be stored and parsed back
+// with ParseVAPIDKey
+func GenerateVAPIDKey() (string, error) {
+	key, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return encoding.EncodeToString(key.Bytes()), nil
+}
+
+// ParseVAPIDKey parses a key made by GenerateVAPIDKey
+func ParseVAPIDKey(encoded string) (*VAPIDKey, error) {
+	raw, err := decode(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %w", err)
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID key: %w", err)
+	}
+
+	// crypto/ecdsa can't import raw keys, but the public point is all that's
+	// missing from it
+	point := ecdhKey.PublicKey().Bytes()
+	key := &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: new(big.Int).SetBytes(raw),
+	}
+	return &VAPIDKey{key: key}, nil
+}
+
+// PublicKey returns the key browsers are given as the applicationServerKey
+// when subscribing
+func (k *VAPIDKey) PublicKey() string {
+	return encoding.EncodeToString(k.publicKeyBytes())
+}
+
+func (k *VAPIDKey) publicKeyBytes() []byte {
+	point := make([]byte, 65)
+	point[0] = 4
+	k.key.X.FillBytes(point[1:33])
+	k.key.Y.FillBytes(point[33:])
+	return point
+}
+
+// authorization returns the VAPID Authorization header for a push service:
+// a JWT signed with the key, good for 12 hours
+func (k *VAPIDKey) authorization(endpoint string, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	header := encoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`))
+	claims, err := json.Marshal(map[string]any{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(12 * time.Hour).Unix(),
+		"sub": subject,
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + encoding.EncodeToString(claims)
+
+	hash := sha256.Sum256([]byte(unsigned))
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, hash[:])
+	if err != nil {
+		return "", err
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return "vapid t=" + unsigned + "." + encoding.EncodeToString(signature) + ", k=" + k.PublicKey(), nil
+}
+
+// Notification is what the service worker gets, as JSON
+type Notification struct {
+	Title string `json:"title"`
+	Body  string `json:"body"`
+
+	// opened when the notification is clicked
+	URL string `json:"url,omitempty"`
+
+	// notifications with the same tag replace each other
+	Tag string `json:"tag,omitempty"`
+}
+
+// Send pushes a notification to a browser. subject is a mailto: or https:
+// URL push services can reach the instance's admin at.
+func Send(sub *Subscription, n *Notification, key *VAPIDKey, subject string) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	if len(payload) > MaxPayloadSize {
+		return fmt.Errorf("the notification is %d bytes, at most %d fit", len(payload), MaxPayloadSize)
+	}
+
+	body, err := encrypt(sub, payload)
+	if err != nil {
+		return err
+	}
+
+	authorization, err := key.authorization(sub.Endpoint, subject, time.Now())
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("TTL", strconv.Itoa(int(defaultTTL.Seconds())))
+	req.Header.Set("Urgency", "normal")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone {
+		return ErrGone
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("push service '%s' returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// encrypt encrypts a payload for a browser the aes128gcm way (RFC 8291), with
+// a fresh key and salt every time
+func encrypt(sub *Subscription, payload []byte) ([]byte, error) {
+	uaPublic, err := sub.publicKey()
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := sub.authSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	return encryptWith(uaPublic, authSecret, asPrivate, salt, payload)
+}
+
+func encryptWith(uaPublic *ecdh.PublicKey, authSecret []byte, asPrivate *ecdh.PrivateKey, salt []byte, payload []byte) ([]byte, error) {
+	ecdhSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+
+	keyInfo := append([]byte("WebPush: info\x00"), uaPublic.Bytes()...)
+	keyInfo = append(keyInfo, asPublic...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	cek := hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16)
+	nonce := hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12)
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// a single record, ended by the delimiter of the last one
+	plaintext := append(append([]byte{}, payload...), 2)
+
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, recordSize)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+
+	return gcm.Seal(header, nonce, plaintext, nil), nil
+}
+
+// hkdf is HKDF-SHA-256 (RFC 5869) for outputs of at most one hash
+func hkdf(salt, ikm, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(ikm)
+	prk := extract.Sum(nil)
+
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(info)
+	expand.Write([]byte{1})
+	return expand.Sum(nil)[:length]
+}
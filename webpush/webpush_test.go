@@ -0,0 +1,245 @@
+package webpush
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+// newBrowser returns a subscription and the keys a browser would keep to
+// decrypt what's pushed to it
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func newBrowser(t *testing.T, endpoint string) (*Subscription, *ecdh.PrivateKey, []byte) {
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authSecret := make([]byte, 16)
+	rand.Read(authSecret)
+
+	sub := &Subscription{Endpoint: endpoint}
+	sub.Keys.P256dh = encoding.EncodeToString(uaPrivate.PublicKey().Bytes())
+	sub.Keys.Auth = encoding.EncodeToString(authSecret)
+	return sub, uaPrivate, authSecret
+}
+
+// decrypt is what the browser does with a push message
+func decrypt(t *testing.T, uaPrivate *ecdh.PrivateKey, authSecret []byte, body []byte) []byte {
+	salt := body[:16]
+	if rs := binary.BigEndian.Uint32(body[16:20]); rs != recordSize {
+		t.Fatalf("Expected a record size of %d, got %d", recordSize, rs)
+	}
+	keyLength := int(body[20])
+	asPublic, err := ecdh.P256().NewPublicKey(body[21 : 21+keyLength])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdhSecret, err := uaPrivate.ECDH(asPublic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyInfo := append([]byte("WebPush: info\x00"), uaPrivate.PublicKey().Bytes()...)
+	keyInfo = append(keyInfo, asPublic.Bytes()...)
+	ikm := hkdf(authSecret, ecdhSecret, keyInfo, 32)
+
+	block, _ := aes.NewCipher(hkdf(salt, ikm, []byte("Content-Encoding: aes128gcm\x00"), 16))
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, hkdf(salt, ikm, []byte("Content-Encoding: nonce\x00"), 12), body[21+keyLength:], nil)
+	if err != nil {
+		t.Fatalf("Could not decrypt the message: %s", err)
+	}
+	if plaintext[len(plaintext)-1] != 2 {
+		t.Fatalf("Expected the message to end with the last record delimiter")
+	}
+	return plaintext[:len(plaintext)-1]
+}
+
+func TestEncrypt(t *testing.T) {
+	sub, uaPrivate, authSecret := newBrowser(t, "https://push.example.com/send/1")
+
+	body, err := encrypt(sub, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decrypt(t, uaPrivate, authSecret, body); string(got) != "hello" {
+		t.Errorf("Expected 'hello', got '%s'", got)
+	}
+
+	// every message gets its own key and salt
+	other, _ := encrypt(sub, []byte("hello"))
+	if bytes.Equal(body[:16], other[:16]) || bytes.Equal(body[21:86], other[21:86]) {
+		t.Errorf("Expected a fresh salt and key for every message")
+	}
+}
+
+func TestEncryptRFC8291Example(t *testing.T) {
+	// the example in appendix A of RFC 8291
+	asPrivateKey, _ := decode("yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw")
+	asPrivate, _ := ecdh.P256().NewPrivateKey(asPrivateKey)
+	uaPublicKey, _ := decode("BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	uaPublic, _ := ecdh.P256().NewPublicKey(uaPublicKey)
+	authSecret, _ := decode("BTBZMqHH6r4Tts7J_aSIgg")
+	salt, _ := decode("DGv6ra1nlYgDCS1FRnbzlw")
+
+	body, err := encryptWith(uaPublic, authSecret, asPrivate, salt, []byte("When I grow up, I want to be a watermelon"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "DGv6ra1nlYgDCS1FRnbzlwAAEABBBP4z9KsN6nGRTbVYI_c7VJSPQTBtkgcy27mlmlMoZIIgDll6e3vCYLocInmYWAmS6TlzAC8wEqKK6PBru3jl7A_yl95bQpu6cVPTpK4Mqgkf1CXztLVBSt2Ks3oZwbuwXPXLWyouBWLVWGNWQexSgSxsj_Qulcy4a-fN"
+	if got := encoding.EncodeToString(body); got != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, got)
+	}
+}
+
+func TestVAPIDKey(t *testing.T) {
+	encoded, err := GenerateVAPIDKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ParseVAPIDKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if publicKey, _ := decode(key.PublicKey()); len(publicKey) != 65 || publicKey[0] != 4 {
+		t.Errorf("Expected an uncompressed P-256 public key, got %x", publicKey)
+	}
+
+	if _, err := ParseVAPIDKey("not a key"); err == nil {
+		t.Errorf("Expected an error for an invalid key")
+	}
+}
+
+func TestSend(t *testing.T) {
+	encoded, _ := GenerateVAPIDKey()
+	key, _ := ParseVAPIDKey(encoded)
+
+	var received []byte
+	var authorization string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+			return
+		}
+		if r.Header.Get("Content-Encoding") != "aes128gcm" || r.Header.Get("TTL") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	defaultClient := client
+	client = server.Client()
+	defer func() { client = defaultClient }()
+
+	sub, uaPrivate, authSecret := newBrowser(t, server.URL+"/send/1")
+	if err := sub.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := &Notification{Title: "mire", Body: "3 new posts", URL: "https://mire.example/u/alice"}
+	err := Send(sub, n, key, "mailto:admin@mire.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Notification
+	json.Unmarshal(decrypt(t, uaPrivate, authSecret, received), &got)
+	if got != *n {
+		t.Errorf("Expected %+v, got %+v", n, got)
+	}
+
+	// the push service checks the JWT is signed by the key browsers were
+	// given and meant for it
+	jwt, publicKey, ok := strings.Cut(strings.TrimPrefix(authorization, "vapid t="), ", k=")
+	if !ok || publicKey != key.PublicKey() {
+		t.Fatalf("Expected a VAPID authorization, got '%s'", authorization)
+	}
+	parts := strings.Split(jwt, ".")
+	claimsJSON, _ := encoding.DecodeString(parts[1])
+	var claims struct {
+		Aud string `json:"aud"`
+		Exp int64  `json:"exp"`
+		Sub string `json:"sub"`
+	}
+	json.Unmarshal(claimsJSON, &claims)
+	if claims.Aud != server.URL || claims.Sub != "mailto:admin@mire.example" || claims.Exp < time.Now().Unix() {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	signature, _ := encoding.DecodeString(parts[2])
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r := new(big.Int).SetBytes(signature[:32])
+	s := new(big.Int).SetBytes(signature[32:])
+	if !ecdsa.Verify(&key.key.PublicKey, hash[:], r, s) {
+		t.Errorf("Expected the JWT to be signed by the VAPID key")
+	}
+
+	sub.Endpoint = server.URL + "/gone"
+	if err := Send(sub, n, key, "mailto:admin@mire.example"); !errors.Is(err, ErrGone) {
+		t.Errorf("Expected ErrGone for an expired subscription, got %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	sub, _, _ := newBrowser(t, "http://push.example.com/send/1")
+	if err := sub.Validate(); err == nil {
+		t.Errorf("Expected endpoints to be https")
+	}
+
+	sub, _, _ = newBrowser(t, "https://push.example.com/send/1")
+	sub.Keys.Auth = "short"
+	if err := sub.Validate(); err == nil {
+		t.Errorf("Expected an error for an invalid auth secret")
+	}
+}
+
+func TestPrivateAddressesAreRejected(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+	}))
+	defer server.Close()
+
+	// push services are out on the internet, an endpoint inside the
+	// instance's network isn't one
+	reaper.AllowPrivateAddresses = false
+	defer func() { reaper.AllowPrivateAddresses = true }()
+
+	encoded, _ := GenerateVAPIDKey()
+	key, _ := ParseVAPIDKey(encoded)
+	sub, _, _ := newBrowser(t, server.URL+"/send/1")
+	err := Send(sub, &Notification{Title: "mire"}, key, "mailto:admin@mire.example")
+	if !errors.Is(err, reaper.ErrHostileTarget) {
+		t.Errorf("Expected the loopback to be blocked, got %v", err)
+	}
+	if n := requests.Load(); n != 0 {
+		t.Errorf("Expected no requests, got %d", n)
+	}
+}
@@ -0,0 +1,130 @@
+// Package youtube turns the YouTube URLs people paste (channels, handles,
+// playlists, videos) into the RSS feed YouTube publishes for them, at
+// https://www.youtube.com/feeds/videos.xml.
+package youtube
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+const feedBase = "https://www.youtube.com/feeds/videos.xml"
+
+// max size of the pages read to find a channel's id, they're big
+const maxPageSize = 4 << 20
+
+var client = &http.Client{Transport: reaper.NewTransport(), Timeout: 15 * time.Second}
+
+var (
+	channelIDRegexp = regexp.MustCompile(`^UC[\w-]{22}$`)
+
+	// where channel ids show up on channel and video pages, most reliable
+	// first
+	pageChannelIDRegexps = []*regexp.Regexp{
+		regexp.MustCompile(`feeds/videos\.xml\?channel_id=(UC[\w-]{22})`),
+		regexp.MustCompile(`<meta itemprop="(?:identifier|channelId)" content="(UC[\w-]{22})"`),
+		regexp.MustCompile(`"externalId":"(UC[\w-]{22})"`),
+		regexp.MustCompile(`"channelId":"(UC[\w-]{22})"`),
+	}
+)
+
+// IsYouTubeURL reports whether a URL points to youtube
+func IsYouTubeURL(rawURL string) bool {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return false
+	}
+	switch strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.") {
+	case "youtube.com", "m.youtube.com", "music.youtube.com", "youtu.be":
+		return true
+	}
+	return false
+}
+
+func channelFeed(channelID string) string {
+	return feedBase + "?channel_id=" + channelID
+}
+
+// FeedURL returns the feed of a youtube URL when it can be told from the URL
+// alone (channel ids, legacy usernames, playlists, feeds), or false if the
+// page has to be looked at
+func FeedURL(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || !IsYouTubeURL(rawURL) {
+		return "", false
+	}
+
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	query := u.Query()
+
+	switch {
+	case u.Path == "/feeds/videos.xml":
+		for _, key := range []string{"channel_id", "playlist_id", "user"} {
+			if value := query.Get(key); value != "" {
+				return feedBase + "?" + key + "=" + url.QueryEscape(value), true
+			}
+		}
+	case segments[0] == "channel" && len(segments) > 1 && channelIDRegexp.MatchString(segments[1]):
+		return channelFeed(segments[1]), true
+	case segments[0] == "user" && len(segments) > 1 && segments[1] != "":
+		return feedBase + "?user=" + url.QueryEscape(segments[1]), true
+	case segments[0] == "playlist" && query.Get("list") != "":
+		return feedBase + "?playlist_id=" + url.QueryEscape(query.Get("list")), true
+	}
+	return "", false
+}
+
+// ChannelIDFromPage finds the id of the channel a channel or video page
+// belongs to, or returns an empty string if there's none
+func ChannelIDFromPage(page []byte) string {
+	for _, re := range pageChannelIDRegexps {
+		if match := re.FindSubmatch(page); match != nil {
+			return string(match[1])
+		}
+	}
+	return ""
+}
+
+// ResolveFeedURL returns the feed of the channel (or playlist) a youtube URL
+// points to, fetching the page if that can't be told from the URL
+func ResolveFeedURL(rawURL string) (string, error) {
+	if feedURL, ok := FeedURL(rawURL); ok {
+		return feedURL, nil
+	}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSpace(rawURL), nil)
+	if err != nil {
+		return "", err
+	}
+	// without it youtube shows a cookie consent page to some regions
+	req.Header.Set("Cookie", "CONSENT=YES+")
+	req.Header.Set("Accept-Language", "en")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("youtube returned status %d for '%s'", resp.StatusCode, rawURL)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return "", err
+	}
+
+	channelID := ChannelIDFromPage(page)
+	if channelID == "" {
+		return "", fmt.Errorf("could not find the youtube channel of '%s'", rawURL)
+	}
+	return channelFeed(channelID), nil
+}
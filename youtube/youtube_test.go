@@ -0,0 +1,82 @@
+package youtube
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"codeberg.org/meadowingc/mire/reaper"
+)
+
+func TestMain(m *testing.M) {
+	// the test servers are on the loopback
+	reaper.AllowPrivateAddresses = true
+	os.Exit(m.Run())
+}
+
+func TestFeedURL(t *testing.T) {
+	for input, expected := range map[string]string{
+		"https://www.youtube.com/channel/UCXuqSBlHAE6Xw-yeJA0Tunw":                     "https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw",
+		"https://youtube.com/channel/UCXuqSBlHAE6Xw-yeJA0Tunw/videos":                  "https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw",
+		"https://m.youtube.com/user/LinusTechTips":                                     "https://www.youtube.com/feeds/videos.xml?user=LinusTechTips",
+		"https://www.youtube.com/playlist?list=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI":     "https://www.youtube.com/feeds/videos.xml?playlist_id=PLFgquLnL59alCl_2TQvOiD5Vgm1hCaGSI",
+		"https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw": "https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw",
+		"https://www.youtube.com/@LinusTechTips":                                       "",
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":                                  "",
+		"https://www.youtube.com/channel/not-an-id":                                    "",
+		"https://example.com/channel/UCXuqSBlHAE6Xw-yeJA0Tunw":                         "",
+	} {
+		got, ok := FeedURL(input)
+		if got != expected || ok != (expected != "") {
+			t.Errorf("Expected '%s' to be '%s', got '%s' (%v)", input, expected, got, ok)
+		}
+	}
+}
+
+func TestIsYouTubeURL(t *testing.T) {
+	for input, expected := range map[string]bool{
+		"https://www.youtube.com/@someone":    true,
+		"https://youtu.be/dQw4w9WgXcQ":        true,
+		"https://music.youtube.com/channel/x": true,
+		"https://notyoutube.com/@someone":     false,
+		"https://example.com/youtube.com":     false,
+	} {
+		if IsYouTubeURL(input) != expected {
+			t.Errorf("Expected IsYouTubeURL('%s') to be %v", input, expected)
+		}
+	}
+}
+
+func TestChannelIDFromPage(t *testing.T) {
+	for page, expected := range map[string]string{
+		`<link rel="alternate" type="application/rss+xml" title="RSS" href="https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw">`: "UCXuqSBlHAE6Xw-yeJA0Tunw",
+		`<meta itemprop="identifier" content="UCXuqSBlHAE6Xw-yeJA0Tunw">`:                                                                                   "UCXuqSBlHAE6Xw-yeJA0Tunw",
+		`{"videoId":"dQw4w9WgXcQ","channelId":"UCuAXFkgsw1L7xaCfnd5JJOw"}`:                                                                                  "UCuAXFkgsw1L7xaCfnd5JJOw",
+		`<html>nothing here</html>`: "",
+	} {
+		if got := ChannelIDFromPage([]byte(page)); got != expected {
+			t.Errorf("Expected '%s', got '%s' from %s", expected, got, page)
+		}
+	}
+}
+
+func TestResolveFeedURL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/@someone" {
+			w.Write([]byte(`<meta itemprop="identifier" content="UCXuqSBlHAE6Xw-yeJA0Tunw">`))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	got, err := ResolveFeedURL(server.URL + "/@someone")
+	if err != nil || got != "https://www.youtube.com/feeds/videos.xml?channel_id=UCXuqSBlHAE6Xw-yeJA0Tunw" {
+		t.Errorf("Expected the channel's feed, got '%s' (%v)", got, err)
+	}
+
+	if _, err := ResolveFeedURL(server.URL + "/@nobody"); err == nil {
+		t.Errorf("Expected an error for a page that doesn't exist")
+	}
+}